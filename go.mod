@@ -57,6 +57,7 @@ require (
 	github.com/grafana-tools/sdk v0.0.0-20211220201350-966b3088eec9
 	github.com/grafana/regexp v0.0.0-20220304095617-2e8d9baf4ac2
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db
+	go.opentelemetry.io/collector/pdata v0.52.0
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 )
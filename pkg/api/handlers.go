@@ -201,9 +201,12 @@ func NewQuerierHandler(
 		Help:      "Current number of inflight requests to the querier.",
 	}, []string{"method", "route"})
 
+	translatedEngine := errorTranslateQueryEngine{engine}
+	translatedQueryable := querier.NewErrorTranslateSampleAndChunkQueryable(queryable) // Translate errors to errors expected by API.
+
 	api := v1.NewAPI(
-		errorTranslateQueryEngine{engine},
-		querier.NewErrorTranslateSampleAndChunkQueryable(queryable), // Translate errors to errors expected by API.
+		translatedEngine,
+		translatedQueryable,
 		nil, // No remote write support.
 		exemplarQueryable,
 		func(context.Context) v1.TargetRetriever { return &querier.DummyTargetRetriever{} },
@@ -251,8 +254,11 @@ func NewQuerierHandler(
 	// https://github.com/prometheus/prometheus/pull/7125/files
 	router.Path(path.Join(prefix, "/api/v1/metadata")).Handler(querier.MetadataHandler(distributor))
 	router.Path(path.Join(prefix, "/api/v1/read")).Methods("POST").Handler(querier.RemoteReadHandler(queryable, logger))
-	router.Path(path.Join(prefix, "/api/v1/query")).Methods("GET", "POST").Handler(promRouter)
-	router.Path(path.Join(prefix, "/api/v1/query_range")).Methods("GET", "POST").Handler(promRouter)
+	// The query results requested in the protobuf format by the query-frontend are not returned by the Prometheus API.
+	queryHandler := querier.NewProtobufQueryHandler(translatedEngine, translatedQueryable, promRouter, logger)
+
+	router.Path(path.Join(prefix, "/api/v1/query")).Methods("GET", "POST").Handler(queryHandler)
+	router.Path(path.Join(prefix, "/api/v1/query_range")).Methods("GET", "POST").Handler(queryHandler)
 	router.Path(path.Join(prefix, "/api/v1/query_exemplars")).Methods("GET", "POST").Handler(promRouter)
 	router.Path(path.Join(prefix, "/api/v1/labels")).Methods("GET", "POST").Handler(promRouter)
 	router.Path(path.Join(prefix, "/api/v1/label/{name}/values")).Methods("GET").Handler(promRouter)
@@ -8,8 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
 	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/go-kit/log"
@@ -17,22 +20,44 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
 
 	"github.com/grafana/dskit/tenant"
 	"github.com/grafana/regexp"
 
+	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/storage/bucket"
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
-// Name of file where we store a block's meta file while it's being uploaded.
-const uploadingMetaFilename = "uploading-" + block.MetaFilename
+const (
+	// Name of file where we store a block's meta file while it's being uploaded.
+	uploadingMetaFilename = "uploading-" + block.MetaFilename
+	// Name of file where we store the state of the validation of an uploaded block.
+	validationFilename = "validation.json"
+
+	// How often the validation file is updated while a block is being validated. A validation
+	// whose file hasn't been updated within validationHeartbeatTimeout is considered stale
+	// (e.g. because the compactor has been restarted), and can be started again.
+	validationHeartbeatInterval = 1 * time.Minute
+	validationHeartbeatTimeout  = 5 * time.Minute
+
+	// Max time to record the final state of a validation, even if the compactor is stopping.
+	validationCompletionTimeout = 30 * time.Second
+)
+
+var errValidationInterrupted = errors.New("the validation has been interrupted because the compactor is stopping, please complete the upload again")
 
 var rePath = regexp.MustCompile(`^(index|chunks/\d{6})$`)
 
@@ -80,7 +105,7 @@ func (c *MultitenantCompactor) HandleBlockUpload(w http.ResponseWriter, r *http.
 	}
 
 	if shouldComplete {
-		err = c.completeBlockUpload(ctx, r, logger, userBkt, bULID)
+		err = c.completeBlockUpload(ctx, r, logger, userBkt, tenantID, bULID)
 	} else {
 		err = c.createBlockUpload(ctx, r, logger, userBkt, tenantID, bULID)
 	}
@@ -251,6 +276,95 @@ func (c *MultitenantCompactor) UploadBlockFile(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusOK)
 }
 
+// GetBlockUploadStateHandler handles requests for getting the state of a block upload, including the
+// result of the validation of the block if enabled for the tenant.
+//
+// The state is returned as a JSON object with the "result" field set to one of "complete", "uploading",
+// "validating" or "failed", and the "error" field set to the reason of the validation failure.
+func (c *MultitenantCompactor) GetBlockUploadStateHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "get block upload state"
+
+	vars := mux.Vars(r)
+	blockID := vars["block"]
+	bULID, err := ulid.Parse(blockID)
+	if err != nil {
+		http.Error(w, "invalid block ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	tenantID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, "invalid tenant ID", http.StatusBadRequest)
+		return
+	}
+	if !c.cfgProvider.CompactorBlockUploadEnabled(tenantID) {
+		http.Error(w, "block upload is disabled", http.StatusBadRequest)
+		return
+	}
+
+	logger := log.With(util_log.WithContext(ctx, c.logger), "block", blockID)
+
+	userBkt := bucket.NewUserBucketClient(tenantID, c.bucketClient, c.cfgProvider)
+	state, err := getBlockUploadState(ctx, userBkt, bULID)
+	if err != nil {
+		writeBlockUploadError(err, op, "while getting the block upload state", logger, w)
+		return
+	}
+
+	util.WriteJSONResponse(w, state)
+}
+
+// blockUploadState is the state of a block upload returned by GetBlockUploadStateHandler.
+type blockUploadState struct {
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+const (
+	blockUploadComplete   = "complete"
+	blockUploadUploading  = "uploading"
+	blockUploadValidating = "validating"
+	blockUploadFailed     = "failed"
+)
+
+// getBlockUploadState returns the state of the upload of the block, or an httpError with
+// the http.StatusNotFound status code if the upload of the block hasn't been started.
+func getBlockUploadState(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID) (blockUploadState, error) {
+	exists, err := userBkt.Exists(ctx, path.Join(blockID.String(), block.MetaFilename))
+	if err != nil {
+		return blockUploadState{}, errors.Wrap(err, fmt.Sprintf("failed to check existence of %s in object storage", block.MetaFilename))
+	}
+	if exists {
+		return blockUploadState{Result: blockUploadComplete}, nil
+	}
+
+	exists, err = userBkt.Exists(ctx, path.Join(blockID.String(), uploadingMetaFilename))
+	if err != nil {
+		return blockUploadState{}, errors.Wrap(err, fmt.Sprintf("failed to check existence of %s in object storage", uploadingMetaFilename))
+	}
+	if !exists {
+		return blockUploadState{}, httpError{
+			message:    fmt.Sprintf("upload of block %s not started yet", blockID),
+			statusCode: http.StatusNotFound,
+		}
+	}
+
+	v, err := getBlockValidation(ctx, userBkt, blockID)
+	switch {
+	case err != nil:
+		return blockUploadState{}, err
+	case v == nil:
+		return blockUploadState{Result: blockUploadUploading}, nil
+	case v.Error != "":
+		return blockUploadState{Result: blockUploadFailed, Error: v.Error}, nil
+	case v.isStale():
+		return blockUploadState{Result: blockUploadFailed, Error: "validation of the block timed out"}, nil
+	default:
+		return blockUploadState{Result: blockUploadValidating}, nil
+	}
+}
+
 func decodeMeta(r io.Reader, name string) (metadata.Meta, error) {
 	dec := json.NewDecoder(r)
 	var meta metadata.Meta
@@ -261,8 +375,11 @@ func decodeMeta(r io.Reader, name string) (metadata.Meta, error) {
 	return meta, nil
 }
 
+// completeBlockUpload completes the upload of a block. If the validation of the uploaded blocks is
+// enabled for the tenant, the block is validated asynchronously and only completed if valid, while
+// the validation state can be retrieved via GetBlockUploadStateHandler.
 func (c *MultitenantCompactor) completeBlockUpload(ctx context.Context, r *http.Request,
-	logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID) error {
+	logger log.Logger, userBkt objstore.Bucket, tenantID string, blockID ulid.ULID) error {
 	level.Debug(logger).Log("msg", "received request to complete block upload", "content_length", r.ContentLength)
 
 	uploadingMetaPath := path.Join(blockID.String(), uploadingMetaFilename)
@@ -285,6 +402,63 @@ func (c *MultitenantCompactor) completeBlockUpload(ctx context.Context, r *http.
 		return err
 	}
 
+	if !c.cfgProvider.CompactorBlockUploadValidationEnabled(tenantID) {
+		return c.markBlockComplete(ctx, logger, userBkt, blockID, meta)
+	}
+
+	// The object storage doesn't support conditional writes, so concurrent requests to complete the
+	// upload are serialized by this compactor, which checks that the validation isn't in progress and
+	// records it as in progress as a single step.
+	validationKey := blockUploadValidationKey(tenantID, blockID)
+	if _, loaded := c.blockUploadValidationsInProgress.LoadOrStore(validationKey, struct{}{}); loaded {
+		return errValidationInProgress(blockID)
+	}
+
+	started := false
+	defer func() {
+		if !started {
+			c.blockUploadValidationsInProgress.Delete(validationKey)
+		}
+	}()
+
+	// The validation may have been started by another compactor.
+	v, err := getBlockValidation(ctx, userBkt, blockID)
+	if err != nil {
+		return err
+	}
+	if v != nil && v.Error == "" && !v.isStale() {
+		return errValidationInProgress(blockID)
+	}
+
+	// Record the validation as in progress before returning, so that it's visible to the client.
+	if err := uploadValidation(ctx, blockID, "", userBkt); err != nil {
+		return err
+	}
+
+	level.Debug(logger).Log("msg", "validating block before completing its upload", "files", len(meta.Thanos.Files))
+
+	started = true
+	c.blockUploadValidations.Add(1)
+	go c.validateAndCompleteBlockUpload(logger, userBkt, tenantID, blockID, meta)
+
+	return nil
+}
+
+func blockUploadValidationKey(tenantID string, blockID ulid.ULID) string {
+	return path.Join(tenantID, blockID.String())
+}
+
+func errValidationInProgress(blockID ulid.ULID) error {
+	return httpError{
+		message:    fmt.Sprintf("validation of block %s already in progress", blockID),
+		statusCode: http.StatusConflict,
+	}
+}
+
+// markBlockComplete uploads the meta file of the block, so that it's considered complete,
+// and deletes the files used while it was being uploaded.
+func (c *MultitenantCompactor) markBlockComplete(ctx context.Context, logger log.Logger, userBkt objstore.Bucket,
+	blockID ulid.ULID, meta metadata.Meta) error {
 	level.Debug(logger).Log("msg", "completing block upload", "files", len(meta.Thanos.Files))
 
 	// Upload meta file so block is considered complete
@@ -292,6 +466,7 @@ func (c *MultitenantCompactor) completeBlockUpload(ctx context.Context, r *http.
 		return err
 	}
 
+	uploadingMetaPath := path.Join(blockID.String(), uploadingMetaFilename)
 	if err := userBkt.Delete(ctx, uploadingMetaPath); err != nil {
 		level.Warn(logger).Log("msg", fmt.Sprintf(
 			"failed to delete %s from block in object storage", uploadingMetaFilename), "err", err)
@@ -302,6 +477,221 @@ func (c *MultitenantCompactor) completeBlockUpload(ctx context.Context, r *http.
 	return nil
 }
 
+// validateAndCompleteBlockUpload validates the uploaded block and completes its upload if valid,
+// otherwise the validation is marked as failed with the reason. It's meant to be run asynchronously,
+// keeping the validation file updated while the block is being validated.
+func (c *MultitenantCompactor) validateAndCompleteBlockUpload(logger log.Logger, userBkt objstore.Bucket,
+	tenantID string, blockID ulid.ULID, meta metadata.Meta) {
+	defer c.blockUploadValidations.Done()
+	defer c.blockUploadValidationsInProgress.Delete(blockUploadValidationKey(tenantID, blockID))
+
+	// The validation outlives the request which started it, and it's canceled when the compactor stops.
+	ctx := c.blockUploadValidationsCtx
+
+	heartbeatCtx, cancelHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		validationHeartbeat(heartbeatCtx, logger, userBkt, blockID)
+	}()
+
+	// The number of concurrent validations is limited, because each one downloads the whole block.
+	// The validations waiting for their turn keep their validation file updated meanwhile.
+	var err error
+	select {
+	case c.blockUploadValidationsSem <- struct{}{}:
+		err = c.validateBlock(ctx, logger, userBkt, tenantID, blockID, meta)
+		<-c.blockUploadValidationsSem
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil && ctx.Err() != nil {
+		err = errValidationInterrupted
+	}
+
+	// Stop the heartbeat before updating the validation file, to not overwrite its final state.
+	cancelHeartbeat()
+	<-heartbeatDone
+
+	// The final state of the validation is recorded even if the compactor is stopping, so that
+	// the client doesn't have to wait for the validation to become stale to complete the upload again.
+	ctx, cancel := context.WithTimeout(context.Background(), validationCompletionTimeout)
+	defer cancel()
+
+	if err != nil {
+		level.Warn(logger).Log("msg", "uploaded block failed validation", "err", err)
+		if err := uploadValidation(ctx, blockID, err.Error(), userBkt); err != nil {
+			level.Error(logger).Log("msg", "failed to mark the validation of the uploaded block as failed", "err", err)
+		}
+		return
+	}
+
+	if err := c.markBlockComplete(ctx, logger, userBkt, blockID, meta); err != nil {
+		level.Error(logger).Log("msg", "failed to complete the upload of the validated block", "err", err)
+		if err := uploadValidation(ctx, blockID, "failed to complete block upload", userBkt); err != nil {
+			level.Error(logger).Log("msg", "failed to mark the validation of the uploaded block as failed", "err", err)
+		}
+		return
+	}
+
+	if err := userBkt.Delete(ctx, path.Join(blockID.String(), validationFilename)); err != nil {
+		level.Warn(logger).Log("msg", fmt.Sprintf(
+			"failed to delete %s from block in object storage", validationFilename), "err", err)
+	}
+}
+
+// validationHeartbeat periodically updates the validation file of the block until the context is canceled.
+func validationHeartbeat(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID) {
+	ticker := time.NewTicker(validationHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := uploadValidation(ctx, blockID, "", userBkt); err != nil && ctx.Err() == nil {
+				level.Warn(logger).Log("msg", "failed to update the validation file of the uploaded block", "err", err)
+			}
+		}
+	}
+}
+
+// validateBlock downloads the uploaded block to a scratch directory, and checks the integrity of
+// its index and chunks, and that the labels of its series are valid for the tenant's limits.
+func (c *MultitenantCompactor) validateBlock(ctx context.Context, logger log.Logger, userBkt objstore.Bucket,
+	tenantID string, blockID ulid.ULID, meta metadata.Meta) (err error) {
+	uploadDir := filepath.Join(c.compactorCfg.DataDir, "upload")
+	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed to create the directory to validate the block")
+	}
+	blockDir, err := os.MkdirTemp(uploadDir, blockID.String())
+	if err != nil {
+		return errors.Wrap(err, "failed to create the directory to validate the block")
+	}
+	defer func() {
+		if err := os.RemoveAll(blockDir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove the directory used to validate the block", "dir", blockDir, "err", err)
+		}
+	}()
+
+	hasIndex := false
+	for _, f := range meta.Thanos.Files {
+		if f.RelPath == block.MetaFilename {
+			continue
+		}
+		if f.RelPath == block.IndexFilename {
+			hasIndex = true
+		}
+
+		dst := filepath.Join(blockDir, filepath.FromSlash(f.RelPath))
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return errors.Wrapf(err, "failed to create the directory of %s", f.RelPath)
+		}
+		if err := objstore.DownloadFile(ctx, logger, userBkt, path.Join(blockID.String(), f.RelPath), dst); err != nil {
+			return errors.Wrapf(err, "failed to download %s", f.RelPath)
+		}
+
+		info, err := os.Stat(dst)
+		if err != nil {
+			return errors.Wrapf(err, "failed to stat %s", f.RelPath)
+		}
+		if info.Size() != f.SizeBytes {
+			return fmt.Errorf("file %s has size %d, while its size in the meta file is %d", f.RelPath, info.Size(), f.SizeBytes)
+		}
+	}
+	if !hasIndex {
+		return fmt.Errorf("missing %s file", block.IndexFilename)
+	}
+
+	if err := meta.WriteToDir(logger, blockDir); err != nil {
+		return errors.Wrap(err, "failed to write the meta file")
+	}
+
+	// Check the series are sorted, and the chunks are in order and within the block time range.
+	if err := block.VerifyIndex(logger, filepath.Join(blockDir, block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		return errors.Wrap(err, "invalid index")
+	}
+
+	return c.validateBlockSeries(ctx, logger, tenantID, blockDir)
+}
+
+// validateBlockSeries checks that the labels of the series of the block in blockDir are valid for the
+// tenant's limits, and that their chunks are readable and their samples are within the chunks time range.
+func (c *MultitenantCompactor) validateBlockSeries(ctx context.Context, logger log.Logger, tenantID, blockDir string) (err error) {
+	b, err := tsdb.OpenBlock(logger, blockDir, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to open block")
+	}
+	defer runutil.CloseWithErrCapture(&err, b, "close block")
+
+	idx, err := b.Index()
+	if err != nil {
+		return errors.Wrap(err, "failed to open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, idx, "close index")
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return errors.Wrap(err, "failed to open chunks")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkr, "close chunks")
+
+	postings, err := idx.Postings(index.AllPostingsKey())
+	if err != nil {
+		return errors.Wrap(err, "failed to get all postings")
+	}
+
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for postings.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := idx.Series(postings.At(), &lset, &chks); err != nil {
+			return errors.Wrap(err, "failed to read series")
+		}
+
+		if err := validation.ValidateSeriesLabels(c.cfgProvider, tenantID, mimirpb.FromLabelsToLabelAdapters(lset)); err != nil {
+			return errors.Wrap(err, "invalid series")
+		}
+
+		for _, chk := range chks {
+			if err := validateChunk(chunkr, chk); err != nil {
+				return errors.Wrapf(err, "invalid chunk of series %s", lset)
+			}
+		}
+	}
+
+	return errors.Wrap(postings.Err(), "failed to iterate postings")
+}
+
+// validateChunk checks that the chunk is readable, and that its samples are sorted and within the chunk time range.
+func validateChunk(chunkr tsdb.ChunkReader, chk chunks.Meta) error {
+	c, err := chunkr.Chunk(chk.Ref)
+	if err != nil {
+		return errors.Wrap(err, "failed to read chunk")
+	}
+
+	it := c.Iterator(nil)
+	prevTs := int64(math.MinInt64)
+	for it.Next() {
+		ts, _ := it.At()
+		if ts < chk.MinTime || ts > chk.MaxTime {
+			return fmt.Errorf("sample with timestamp %d outside of the chunk time range [%d, %d]", ts, chk.MinTime, chk.MaxTime)
+		}
+		if ts <= prevTs {
+			return fmt.Errorf("sample with timestamp %d out of order", ts)
+		}
+		prevTs = ts
+	}
+
+	return errors.Wrap(it.Err(), "failed to iterate samples")
+}
+
 // sanitizeMeta sanitizes and validates a metadata.Meta object. If a validation error occurs, an error
 // message gets returned, otherwise an empty string.
 func (c *MultitenantCompactor) sanitizeMeta(logger log.Logger, blockID ulid.ULID, meta *metadata.Meta) string {
@@ -387,6 +777,53 @@ func (c *MultitenantCompactor) uploadMeta(ctx context.Context, logger log.Logger
 	return nil
 }
 
+// validationFile is the content of the validation file of an uploaded block.
+type validationFile struct {
+	LastUpdate int64  `json:"lastUpdate"` // Unix milliseconds of the last update.
+	Error      string `json:"error"`      // The reason of the failure if the validation failed.
+}
+
+// isStale returns whether the validation is in progress but hasn't been updated for too long.
+func (v *validationFile) isStale() bool {
+	return v.Error == "" && time.Since(time.UnixMilli(v.LastUpdate)) > validationHeartbeatTimeout
+}
+
+// uploadValidation uploads the validation file of the block, with the error message if the validation failed.
+func uploadValidation(ctx context.Context, blockID ulid.ULID, errMsg string, userBkt objstore.Bucket) error {
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(validationFile{
+		LastUpdate: time.Now().UnixMilli(),
+		Error:      errMsg,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to encode %s", validationFilename)
+	}
+
+	if err := userBkt.Upload(ctx, path.Join(blockID.String(), validationFilename), buf); err != nil {
+		return errors.Wrapf(err, "failed uploading %s to bucket", validationFilename)
+	}
+	return nil
+}
+
+// getBlockValidation returns the validation file of the block, or nil if the block hasn't been validated.
+func getBlockValidation(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID) (*validationFile, error) {
+	rdr, err := userBkt.Get(ctx, path.Join(blockID.String(), validationFilename))
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to download %s from object storage", validationFilename)
+	}
+	defer func() {
+		_ = rdr.Close()
+	}()
+
+	var v validationFile
+	if err := json.NewDecoder(rdr).Decode(&v); err != nil {
+		return nil, errors.Wrapf(err, "failed decoding %s", validationFilename)
+	}
+	return &v, nil
+}
+
 type httpError struct {
 	message    string
 	statusCode int
@@ -11,14 +11,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/gorilla/mux"
 	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -1234,3 +1238,385 @@ func uploadMeta(t *testing.T, bkt *objstore.InMemBucket, pth string, meta metada
 	ctx := context.Background()
 	require.NoError(t, bkt.Upload(ctx, pth, buf))
 }
+
+func TestMultitenantCompactor_ValidateAndCompleteBlockUpload(t *testing.T) {
+	const tenantID = "test"
+
+	now := time.Now()
+	minTime := now.Add(-2 * time.Hour).UnixMilli()
+	maxTime := now.Add(-time.Hour).UnixMilli()
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "metric", "series", "1"),
+		labels.FromStrings(labels.MetricName, "metric", "series", "2"),
+	}
+
+	testCases := map[string]struct {
+		maxLabelValueLength int
+		modifyBlock         func(t *testing.T, blockDir string)
+		modifyMeta          func(meta *metadata.Meta)
+		stopCompactor       bool
+		expState            blockUploadState
+		expErrorContains    string
+	}{
+		"valid block": {
+			expState: blockUploadState{Result: blockUploadComplete},
+		},
+		"validation waiting for its turn interrupted by the compactor stopping": {
+			stopCompactor:    true,
+			expState:         blockUploadState{Result: blockUploadFailed},
+			expErrorContains: "the validation has been interrupted because the compactor is stopping",
+		},
+		"series with label value exceeding the limit": {
+			maxLabelValueLength: 5,
+			expState:            blockUploadState{Result: blockUploadFailed},
+			expErrorContains:    "invalid series",
+		},
+		"out of order chunks": {
+			modifyBlock: func(t *testing.T, blockDir string) {
+				require.NoError(t, putOutOfOrderIndex(blockDir, minTime, maxTime))
+			},
+			expState:         blockUploadState{Result: blockUploadFailed},
+			expErrorContains: "invalid index",
+		},
+		"file size not matching the meta file": {
+			modifyMeta: func(meta *metadata.Meta) {
+				meta.Thanos.Files[0].SizeBytes++
+			},
+			expState:         blockUploadState{Result: blockUploadFailed},
+			expErrorContains: "while its size in the meta file is",
+		},
+		"missing file": {
+			modifyMeta: func(meta *metadata.Meta) {
+				meta.Thanos.Files = append(meta.Thanos.Files, metadata.File{RelPath: "chunks/000002", SizeBytes: 1024})
+			},
+			expState:         blockUploadState{Result: blockUploadFailed},
+			expErrorContains: "failed to download chunks/000002",
+		},
+		"missing index file": {
+			modifyMeta: func(meta *metadata.Meta) {
+				var files []metadata.File
+				for _, f := range meta.Thanos.Files {
+					if f.RelPath != block.IndexFilename {
+						files = append(files, f)
+					}
+				}
+				meta.Thanos.Files = files
+			},
+			expState:         blockUploadState{Result: blockUploadFailed},
+			expErrorContains: "missing index file",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			bkt := objstore.NewInMemBucket()
+
+			// Create the block and upload it as done by a client of the block upload API.
+			blocksDir := t.TempDir()
+			blockID, err := createBlockWithOptions(ctx, blocksDir, series, 10, minTime, maxTime, nil, 0, false, metadata.NoneFunc)
+			require.NoError(t, err)
+			blockDir := filepath.Join(blocksDir, blockID.String())
+			if tc.modifyBlock != nil {
+				tc.modifyBlock(t, blockDir)
+			}
+
+			meta, err := metadata.ReadFromDir(blockDir)
+			require.NoError(t, err)
+			files, err := block.GatherFileStats(blockDir, metadata.NoneFunc, log.NewNopLogger())
+			require.NoError(t, err)
+			meta.Thanos.Files = nil
+			for _, f := range files {
+				if f.RelPath == block.MetaFilename {
+					continue
+				}
+				meta.Thanos.Files = append(meta.Thanos.Files, f)
+				require.NoError(t, objstore.UploadFile(ctx, log.NewNopLogger(), bkt, filepath.Join(blockDir, f.RelPath), path.Join(tenantID, blockID.String(), f.RelPath)))
+			}
+			if tc.modifyMeta != nil {
+				tc.modifyMeta(meta)
+			}
+			uploadMeta(t, bkt, path.Join(tenantID, blockID.String(), uploadingMetaFilename), *meta)
+
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tenantID] = true
+			cfgProvider.blockUploadValidationEnabled[tenantID] = true
+			if tc.maxLabelValueLength > 0 {
+				cfgProvider.maxLabelValueLength = tc.maxLabelValueLength
+			}
+			validationsCtx, cancelValidations := context.WithCancel(ctx)
+			defer cancelValidations()
+			c := &MultitenantCompactor{
+				compactorCfg:                Config{DataDir: t.TempDir()},
+				logger:                      log.NewNopLogger(),
+				bucketClient:                bkt,
+				cfgProvider:                 cfgProvider,
+				blockUploadValidationsCtx:   validationsCtx,
+				cancelBlockUploadValidation: cancelValidations,
+				blockUploadValidationsSem:   make(chan struct{}, 1),
+			}
+
+			// Take the only validation slot, so that the validation waits for its turn until the compactor stops.
+			if tc.stopCompactor {
+				c.blockUploadValidationsSem <- struct{}{}
+			}
+
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s?uploadComplete=true", blockID), nil)
+			r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			r = mux.SetURLVars(r, map[string]string{"block": blockID.String()})
+			w := httptest.NewRecorder()
+			c.HandleBlockUpload(w, r)
+			require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+			if tc.stopCompactor {
+				statusCode, state := getBlockUploadStateFromHandler(t, c, tenantID, blockID.String())
+				require.Equal(t, http.StatusOK, statusCode)
+				assert.Equal(t, blockUploadValidating, state.Result)
+
+				c.cancelBlockUploadValidation()
+			}
+
+			// Wait until the asynchronous validation has completed.
+			c.blockUploadValidations.Wait()
+
+			statusCode, state := getBlockUploadStateFromHandler(t, c, tenantID, blockID.String())
+			require.Equal(t, http.StatusOK, statusCode)
+			assert.Equal(t, tc.expState.Result, state.Result)
+			assert.Contains(t, state.Error, tc.expErrorContains)
+
+			exists, err := bkt.Exists(ctx, path.Join(tenantID, blockID.String(), block.MetaFilename))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expState.Result == blockUploadComplete, exists)
+
+			for _, name := range []string{uploadingMetaFilename, validationFilename} {
+				exists, err := bkt.Exists(ctx, path.Join(tenantID, blockID.String(), name))
+				require.NoError(t, err)
+				assert.Equal(t, tc.expState.Result != blockUploadComplete, exists, name)
+			}
+
+			// The block downloaded for the validation should have been removed.
+			entries, err := os.ReadDir(filepath.Join(c.compactorCfg.DataDir, "upload"))
+			if !tc.stopCompactor {
+				require.NoError(t, err)
+			}
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestMultitenantCompactor_GetBlockUploadStateHandler(t *testing.T) {
+	const (
+		tenantID = "test"
+		blockID  = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	)
+
+	uploadValidationFile := func(t *testing.T, bkt objstore.Bucket, v validationFile) {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, json.NewEncoder(buf).Encode(v))
+		require.NoError(t, bkt.Upload(context.Background(), path.Join(tenantID, blockID, validationFilename), buf))
+	}
+
+	testCases := map[string]struct {
+		setUpBucket   func(t *testing.T, bkt *objstore.InMemBucket)
+		expStatusCode int
+		expState      blockUploadState
+	}{
+		"upload not started": {
+			expStatusCode: http.StatusNotFound,
+		},
+		"upload in progress": {
+			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
+				uploadMeta(t, bkt, path.Join(tenantID, blockID, uploadingMetaFilename), metadata.Meta{})
+			},
+			expStatusCode: http.StatusOK,
+			expState:      blockUploadState{Result: blockUploadUploading},
+		},
+		"validation in progress": {
+			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
+				uploadMeta(t, bkt, path.Join(tenantID, blockID, uploadingMetaFilename), metadata.Meta{})
+				uploadValidationFile(t, bkt, validationFile{LastUpdate: time.Now().UnixMilli()})
+			},
+			expStatusCode: http.StatusOK,
+			expState:      blockUploadState{Result: blockUploadValidating},
+		},
+		"validation failed": {
+			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
+				uploadMeta(t, bkt, path.Join(tenantID, blockID, uploadingMetaFilename), metadata.Meta{})
+				uploadValidationFile(t, bkt, validationFile{LastUpdate: time.Now().UnixMilli(), Error: "invalid index"})
+			},
+			expStatusCode: http.StatusOK,
+			expState:      blockUploadState{Result: blockUploadFailed, Error: "invalid index"},
+		},
+		"validation stale": {
+			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
+				uploadMeta(t, bkt, path.Join(tenantID, blockID, uploadingMetaFilename), metadata.Meta{})
+				uploadValidationFile(t, bkt, validationFile{LastUpdate: time.Now().Add(-2 * validationHeartbeatTimeout).UnixMilli()})
+			},
+			expStatusCode: http.StatusOK,
+			expState:      blockUploadState{Result: blockUploadFailed, Error: "validation of the block timed out"},
+		},
+		"upload complete": {
+			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
+				uploadMeta(t, bkt, path.Join(tenantID, blockID, block.MetaFilename), metadata.Meta{})
+			},
+			expStatusCode: http.StatusOK,
+			expState:      blockUploadState{Result: blockUploadComplete},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			if tc.setUpBucket != nil {
+				tc.setUpBucket(t, bkt)
+			}
+
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tenantID] = true
+			c := &MultitenantCompactor{
+				logger:       log.NewNopLogger(),
+				bucketClient: bkt,
+				cfgProvider:  cfgProvider,
+			}
+
+			statusCode, state := getBlockUploadStateFromHandler(t, c, tenantID, blockID)
+			assert.Equal(t, tc.expStatusCode, statusCode)
+			if tc.expStatusCode == http.StatusOK {
+				assert.Equal(t, tc.expState, state)
+			}
+		})
+	}
+}
+
+func TestMultitenantCompactor_HandleBlockUpload_CompleteWhileValidating(t *testing.T) {
+	const (
+		tenantID = "test"
+		blockID  = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	)
+
+	bkt := objstore.NewInMemBucket()
+	uploadMeta(t, bkt, path.Join(tenantID, blockID, uploadingMetaFilename), metadata.Meta{})
+	require.NoError(t, uploadValidation(context.Background(), ulid.MustParse(blockID), "", bucket.NewPrefixedBucketClient(bkt, tenantID)))
+
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+	cfgProvider.blockUploadValidationEnabled[tenantID] = true
+	c := &MultitenantCompactor{
+		logger:       log.NewNopLogger(),
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+	}
+
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s?uploadComplete=true", blockID), nil)
+	r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+	r = mux.SetURLVars(r, map[string]string{"block": blockID})
+	w := httptest.NewRecorder()
+	c.HandleBlockUpload(w, r)
+
+	resp := w.Result()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("validation of block %s already in progress\n", blockID), string(body))
+}
+
+func TestMultitenantCompactor_HandleBlockUpload_ConcurrentComplete(t *testing.T) {
+	const (
+		tenantID    = "test"
+		blockID     = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+		numRequests = 10
+	)
+
+	bkt := objstore.NewInMemBucket()
+	uploadMeta(t, bkt, path.Join(tenantID, blockID, uploadingMetaFilename), metadata.Meta{})
+
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+	cfgProvider.blockUploadValidationEnabled[tenantID] = true
+	validationsCtx, cancelValidations := context.WithCancel(context.Background())
+	defer cancelValidations()
+	c := &MultitenantCompactor{
+		compactorCfg: Config{DataDir: t.TempDir()},
+		logger:       log.NewNopLogger(),
+		// Slow down reading the validation file, so that the requests would all find no validation in progress
+		// if checking and recording the validation wasn't atomic.
+		bucketClient:                &slowValidationReadBucket{Bucket: bkt, delay: 100 * time.Millisecond},
+		cfgProvider:                 cfgProvider,
+		blockUploadValidationsCtx:   validationsCtx,
+		cancelBlockUploadValidation: cancelValidations,
+		blockUploadValidationsSem:   make(chan struct{}, 1),
+	}
+
+	// Take the only validation slot, so that the started validation stays in progress until the compactor stops.
+	c.blockUploadValidationsSem <- struct{}{}
+
+	var (
+		start       = make(chan struct{})
+		wg          sync.WaitGroup
+		mtx         sync.Mutex
+		statusCodes = map[int]int{}
+	)
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s?uploadComplete=true", blockID), nil)
+			r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			r = mux.SetURLVars(r, map[string]string{"block": blockID})
+			w := httptest.NewRecorder()
+			c.HandleBlockUpload(w, r)
+
+			mtx.Lock()
+			statusCodes[w.Result().StatusCode]++
+			mtx.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	// Only one of the requests should have started the validation.
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusConflict: numRequests - 1}, statusCodes)
+
+	c.cancelBlockUploadValidation()
+	c.blockUploadValidations.Wait()
+
+	// Once the validation has been interrupted, it can be started again.
+	_, loaded := c.blockUploadValidationsInProgress.Load(blockUploadValidationKey(tenantID, ulid.MustParse(blockID)))
+	assert.False(t, loaded)
+}
+
+// slowValidationReadBucket is an objstore.Bucket delaying the reads of the validation files
+// after reading them, so that they can be outdated by the time they're returned.
+type slowValidationReadBucket struct {
+	objstore.Bucket
+	delay time.Duration
+}
+
+func (b *slowValidationReadBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rdr, err := b.Bucket.Get(ctx, name)
+	if path.Base(name) == validationFilename {
+		time.Sleep(b.delay)
+	}
+	return rdr, err
+}
+
+// getBlockUploadStateFromHandler is a test helper calling MultitenantCompactor.GetBlockUploadStateHandler,
+// returning the response status code and the decoded state.
+func getBlockUploadStateFromHandler(t *testing.T, c *MultitenantCompactor, tenantID, blockID string) (int, blockUploadState) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/upload/block/%s/check", blockID), nil)
+	r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+	r = mux.SetURLVars(r, map[string]string{"block": blockID})
+	w := httptest.NewRecorder()
+	c.GetBlockUploadStateHandler(w, r)
+
+	resp := w.Result()
+	var state blockUploadState
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+	}
+	return resp.StatusCode, state
+}
@@ -31,6 +31,7 @@ import (
 	mimir_testutil "github.com/grafana/mimir/pkg/storage/tsdb/testutil"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/test"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 type testBlocksCleanerOptions struct {
@@ -695,19 +696,31 @@ func (m *mockBucketFailure) Delete(ctx context.Context, name string) error {
 }
 
 type mockConfigProvider struct {
-	userRetentionPeriods map[string]time.Duration
-	splitAndMergeShards  map[string]int
-	instancesShardSize   map[string]int
-	splitGroups          map[string]int
-	blockUploadEnabled   map[string]bool
+	userRetentionPeriods         map[string]time.Duration
+	splitAndMergeShards          map[string]int
+	instancesShardSize           map[string]int
+	splitGroups                  map[string]int
+	blockUploadEnabled           map[string]bool
+	blockUploadValidationEnabled map[string]bool
+	downsamplingEnabled          map[string]bool
+	seriesRetentionRules         map[string][]validation.SeriesRetentionRule
+	maxLabelNamesPerSeries       int
+	maxLabelNameLength           int
+	maxLabelValueLength          int
 }
 
 func newMockConfigProvider() *mockConfigProvider {
 	return &mockConfigProvider{
-		userRetentionPeriods: make(map[string]time.Duration),
-		splitAndMergeShards:  make(map[string]int),
-		splitGroups:          make(map[string]int),
-		blockUploadEnabled:   make(map[string]bool),
+		userRetentionPeriods:         make(map[string]time.Duration),
+		splitAndMergeShards:          make(map[string]int),
+		splitGroups:                  make(map[string]int),
+		blockUploadEnabled:           make(map[string]bool),
+		blockUploadValidationEnabled: make(map[string]bool),
+		downsamplingEnabled:          make(map[string]bool),
+		seriesRetentionRules:         make(map[string][]validation.SeriesRetentionRule),
+		maxLabelNamesPerSeries:       30,
+		maxLabelNameLength:           1024,
+		maxLabelValueLength:          2048,
 	}
 }
 
@@ -743,6 +756,30 @@ func (m *mockConfigProvider) CompactorBlockUploadEnabled(tenantID string) bool {
 	return m.blockUploadEnabled[tenantID]
 }
 
+func (m *mockConfigProvider) CompactorBlockUploadValidationEnabled(tenantID string) bool {
+	return m.blockUploadValidationEnabled[tenantID]
+}
+
+func (m *mockConfigProvider) CompactorDownsamplingEnabled(tenantID string) bool {
+	return m.downsamplingEnabled[tenantID]
+}
+
+func (m *mockConfigProvider) SeriesRetentionRules(tenantID string) []validation.SeriesRetentionRule {
+	return m.seriesRetentionRules[tenantID]
+}
+
+func (m *mockConfigProvider) MaxLabelNamesPerSeries(userID string) int {
+	return m.maxLabelNamesPerSeries
+}
+
+func (m *mockConfigProvider) MaxLabelNameLength(userID string) int {
+	return m.maxLabelNameLength
+}
+
+func (m *mockConfigProvider) MaxLabelValueLength(userID string) int {
+	return m.maxLabelValueLength
+}
+
 func (m *mockConfigProvider) S3SSEType(user string) string {
 	return ""
 }
@@ -16,6 +16,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -24,6 +25,7 @@ import (
 	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -35,6 +37,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const (
@@ -52,12 +55,13 @@ const (
 )
 
 var (
-	errInvalidBlockRanges                 = "compactor block range periods should be divisible by the previous one, but %s is not divisible by %s"
-	errInvalidCompactionOrder             = fmt.Errorf("unsupported compaction order (supported values: %s)", strings.Join(CompactionOrders, ", "))
-	errInvalidMaxOpeningBlocksConcurrency = fmt.Errorf("invalid max-opening-blocks-concurrency value, must be positive")
-	errInvalidMaxClosingBlocksConcurrency = fmt.Errorf("invalid max-closing-blocks-concurrency value, must be positive")
-	errInvalidSymbolFlushersConcurrency   = fmt.Errorf("invalid symbols-flushers-concurrency value, must be positive")
-	RingOp                                = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, nil)
+	errInvalidBlockRanges                      = "compactor block range periods should be divisible by the previous one, but %s is not divisible by %s"
+	errInvalidCompactionOrder                  = fmt.Errorf("unsupported compaction order (supported values: %s)", strings.Join(CompactionOrders, ", "))
+	errInvalidMaxOpeningBlocksConcurrency      = fmt.Errorf("invalid max-opening-blocks-concurrency value, must be positive")
+	errInvalidMaxClosingBlocksConcurrency      = fmt.Errorf("invalid max-closing-blocks-concurrency value, must be positive")
+	errInvalidSymbolFlushersConcurrency        = fmt.Errorf("invalid symbols-flushers-concurrency value, must be positive")
+	errInvalidBlockUploadValidationConcurrency = fmt.Errorf("invalid block-upload-validation-concurrency value, must be positive")
+	RingOp                                     = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, nil)
 )
 
 // BlocksGrouperFactory builds and returns the grouper to use to compact a tenant's blocks.
@@ -93,12 +97,16 @@ type Config struct {
 	DeletionDelay         time.Duration           `yaml:"deletion_delay" category:"advanced"`
 	TenantCleanupDelay    time.Duration           `yaml:"tenant_cleanup_delay" category:"advanced"`
 	MaxCompactionTime     time.Duration           `yaml:"max_compaction_time" category:"advanced"`
+	SeriesDeletionDelay   time.Duration           `yaml:"series_deletion_delay" category:"experimental"`
 
 	// Compactor concurrency options
 	MaxOpeningBlocksConcurrency int `yaml:"max_opening_blocks_concurrency" category:"advanced"` // Number of goroutines opening blocks before compaction.
 	MaxClosingBlocksConcurrency int `yaml:"max_closing_blocks_concurrency" category:"advanced"` // Max number of blocks that can be closed concurrently during split compaction. Note that closing of newly compacted block uses a lot of memory for writing index.
 	SymbolsFlushersConcurrency  int `yaml:"symbols_flushers_concurrency" category:"advanced"`   // Number of symbols flushers used when doing split compaction.
 
+	// Max number of uploaded blocks validated concurrently.
+	BlockUploadValidationConcurrency int `yaml:"block_upload_validation_concurrency" category:"experimental"`
+
 	EnabledTenants  flagext.StringSliceCSV `yaml:"enabled_tenants" category:"advanced"`
 	DisabledTenants flagext.StringSliceCSV `yaml:"disabled_tenants" category:"advanced"`
 
@@ -141,11 +149,13 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.DurationVar(&cfg.DeletionDelay, "compactor.deletion-delay", 12*time.Hour, "Time before a block marked for deletion is deleted from bucket. "+
 		"If not 0, blocks will be marked for deletion and compactor component will permanently delete blocks marked for deletion from the bucket. "+
 		"If 0, blocks will be deleted straight away. Note that deleting blocks immediately can cause query failures.")
+	f.DurationVar(&cfg.SeriesDeletionDelay, "compactor.series-deletion-delay", 12*time.Hour, "Time after the creation of a series deletion request before the blocks are rewritten to remove the deleted samples. It should be long enough for the ingesters to upload the blocks containing the samples written before the request, which are filtered out at query time meanwhile.")
 	f.DurationVar(&cfg.TenantCleanupDelay, "compactor.tenant-cleanup-delay", 6*time.Hour, "For tenants marked for deletion, this is time between deleting of last block, and doing final cleanup (marker files, debug files) of the tenant.")
 	// compactor concurrency options
 	f.IntVar(&cfg.MaxOpeningBlocksConcurrency, "compactor.max-opening-blocks-concurrency", 1, "Number of goroutines opening blocks before compaction.")
 	f.IntVar(&cfg.MaxClosingBlocksConcurrency, "compactor.max-closing-blocks-concurrency", 1, "Max number of blocks that can be closed concurrently during split compaction. Note that closing of newly compacted block uses a lot of memory for writing index.")
 	f.IntVar(&cfg.SymbolsFlushersConcurrency, "compactor.symbols-flushers-concurrency", 1, "Number of symbols flushers used when doing split compaction.")
+	f.IntVar(&cfg.BlockUploadValidationConcurrency, "compactor.block-upload-validation-concurrency", 1, "Max number of uploaded blocks validated concurrently. Each validation downloads the whole block to the compactor data directory. The other validations wait for their turn.")
 
 	f.Var(&cfg.EnabledTenants, "compactor.enabled-tenants", "Comma separated list of tenants that can be compacted. If specified, only these tenants will be compacted by compactor, otherwise all tenants can be compacted. Subject to sharding.")
 	f.Var(&cfg.DisabledTenants, "compactor.disabled-tenants", "Comma separated list of tenants that cannot be compacted by this compactor. If specified, and compactor would normally pick given tenant for compaction (via -compactor.enabled-tenants or sharding), it will be ignored instead.")
@@ -168,6 +178,9 @@ func (cfg *Config) Validate() error {
 	if cfg.SymbolsFlushersConcurrency < 1 {
 		return errInvalidSymbolFlushersConcurrency
 	}
+	if cfg.BlockUploadValidationConcurrency < 1 {
+		return errInvalidBlockUploadValidationConcurrency
+	}
 
 	if !util.StringsContain(CompactionOrders, cfg.CompactionJobsOrder) {
 		return errInvalidCompactionOrder
@@ -195,6 +208,18 @@ type ConfigProvider interface {
 
 	// CompactorBlockUploadEnabled returns whether block upload is enabled for a given tenant.
 	CompactorBlockUploadEnabled(tenantID string) bool
+
+	// CompactorBlockUploadValidationEnabled returns whether the validation of the uploaded blocks is enabled for a given tenant.
+	CompactorBlockUploadValidationEnabled(tenantID string) bool
+
+	// CompactorDownsamplingEnabled returns whether the downsampling of the blocks is enabled for a given tenant.
+	CompactorDownsamplingEnabled(tenantID string) bool
+
+	// SeriesRetentionRules returns the retention periods applying to the tenant's series matching a series selector.
+	SeriesRetentionRules(tenantID string) []validation.SeriesRetentionRule
+
+	// LabelValidationConfig provides the limits used to validate the series labels of the uploaded blocks.
+	validation.LabelValidationConfig
 }
 
 // MultitenantCompactor is a multi-tenant TSDB blocks compactor based on Thanos.
@@ -245,11 +270,39 @@ type MultitenantCompactor struct {
 	compactionRunInterval          prometheus.Gauge
 	blocksMarkedForDeletion        prometheus.Counter
 
+	// Series deletion metrics.
+	seriesDeletionRequestsProcessed       prometheus.Counter
+	seriesDeletionBlocksRewritten         prometheus.Counter
+	seriesDeletionBlocksMarkedForDeletion prometheus.Counter
+
+	// Metrics for downsampling.
+	blocksDownsampled *prometheus.CounterVec
+
+	// Series retention metrics.
+	seriesRetentionBlocksRewritten         prometheus.Counter
+	seriesRetentionReclaimedBytes          prometheus.Counter
+	seriesRetentionBlocksMarkedForDeletion prometheus.Counter
+
+	// The blocks checked for the series retention rules without being rewritten, by tenant. The value is
+	// the key of the retention tombstones applied to the block.
+	seriesRetentionChecked map[string]map[ulid.ULID]string
+
 	// Metrics shared across all BucketCompactor instances.
 	bucketCompactorMetrics *BucketCompactorMetrics
 
 	// TSDB syncer metrics
 	syncerMetrics *aggregatedSyncerMetrics
+
+	// In-flight validations of the uploaded blocks, which are canceled when the compactor stops,
+	// and the semaphore limiting the number of validations running concurrently.
+	blockUploadValidations      sync.WaitGroup
+	blockUploadValidationsCtx   context.Context
+	cancelBlockUploadValidation context.CancelFunc
+	blockUploadValidationsSem   chan struct{}
+
+	// Blocks whose validation has been started by this compactor, keyed by tenant and block ID, used
+	// to atomically check that a validation isn't in progress and start it.
+	blockUploadValidationsInProgress sync.Map
 }
 
 // NewMultitenantCompactor makes a new MultitenantCompactor.
@@ -286,7 +339,13 @@ func newMultitenantCompactor(
 	blocksGrouperFactory BlocksGrouperFactory,
 	blocksCompactorFactory BlocksCompactorFactory,
 ) (*MultitenantCompactor, error) {
+	blockUploadValidationsCtx, cancelBlockUploadValidation := context.WithCancel(context.Background())
+
 	c := &MultitenantCompactor{
+		blockUploadValidationsCtx:   blockUploadValidationsCtx,
+		cancelBlockUploadValidation: cancelBlockUploadValidation,
+		blockUploadValidationsSem:   make(chan struct{}, compactorCfg.BlockUploadValidationConcurrency),
+
 		compactorCfg:           compactorCfg,
 		storageCfg:             storageCfg,
 		cfgProvider:            cfgProvider,
@@ -339,6 +398,37 @@ func newMultitenantCompactor(
 			Help:        blocksMarkedForDeletionHelp,
 			ConstLabels: prometheus.Labels{"reason": "compaction"},
 		}),
+		seriesDeletionRequestsProcessed: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_series_deletion_requests_processed_total",
+			Help: "Total number of series deletion requests whose deleted samples have been removed from the blocks.",
+		}),
+		seriesDeletionBlocksRewritten: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_series_deletion_blocks_rewritten_total",
+			Help: "Total number of blocks rewritten to remove the samples deleted by series deletion requests.",
+		}),
+		seriesDeletionBlocksMarkedForDeletion: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name:        blocksMarkedForDeletionName,
+			Help:        blocksMarkedForDeletionHelp,
+			ConstLabels: prometheus.Labels{"reason": "series-deletion"},
+		}),
+		blocksDownsampled: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_compactor_blocks_downsampled_total",
+			Help: "Total number of blocks downsampled by the compactor.",
+		}, []string{"resolution"}),
+		seriesRetentionBlocksRewritten: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_series_retention_blocks_rewritten_total",
+			Help: "Total number of blocks rewritten to remove the samples older than the retention period of the series retention rules.",
+		}),
+		seriesRetentionReclaimedBytes: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_series_retention_reclaimed_bytes_total",
+			Help: "Total number of bytes reclaimed by rewriting the blocks to remove the samples older than the retention period of the series retention rules.",
+		}),
+		seriesRetentionBlocksMarkedForDeletion: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name:        blocksMarkedForDeletionName,
+			Help:        blocksMarkedForDeletionHelp,
+			ConstLabels: prometheus.Labels{"reason": "series-retention"},
+		}),
+		seriesRetentionChecked: map[string]map[ulid.ULID]string{},
 	}
 
 	c.bucketCompactorMetrics = NewBucketCompactorMetrics(c.blocksMarkedForDeletion, registerer)
@@ -461,6 +551,11 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 func (c *MultitenantCompactor) stopping(_ error) error {
 	ctx := context.Background()
 
+	// Cancel the validations of the uploaded blocks and wait until they're marked as failed,
+	// otherwise the blocks would be left in the validation state until it's considered stale.
+	c.cancelBlockUploadValidation()
+	c.blockUploadValidations.Wait()
+
 	services.StopAndAwaitTerminated(ctx, c.blocksCleaner) //nolint:errcheck
 	if c.ringSubservices != nil {
 		return services.StopManagerAndAwaitStopped(ctx, c.ringSubservices)
@@ -700,6 +795,20 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 		return errors.Wrap(err, "compaction")
 	}
 
+	if err := c.processSeriesDeletions(ctx, userID, bucket, fetcher, ulogger); err != nil {
+		return errors.Wrap(err, "series deletion")
+	}
+
+	if err := c.applySeriesRetention(ctx, userID, bucket, fetcher, ulogger); err != nil {
+		return errors.Wrap(err, "series retention")
+	}
+
+	if c.cfgProvider.CompactorDownsamplingEnabled(userID) {
+		if err := c.downsampleBlocks(ctx, userID, bucket, fetcher, ulogger); err != nil {
+			return errors.Wrap(err, "downsampling")
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+// downsampleJob holds a block to downsample to the given resolution.
+type downsampleJob struct {
+	meta       *metadata.Meta
+	resolution int64
+}
+
+// newJob returns the compaction Job used to check which compactor owns the downsampling job. The jobs are
+// sharded across the compactors of the tenant like the split and merge jobs are.
+func (j downsampleJob) newJob(userID string) *Job {
+	key := fmt.Sprintf("downsample-%s-%s", resolutionString(j.resolution), j.meta.ULID)
+	return NewJob(userID, key, labels.FromMap(j.meta.Thanos.Labels), j.meta.Thanos.Downsample.Resolution, metadata.NoneFunc, false, 0, j.meta.ULID.String())
+}
+
+// planDownsampling returns the jobs to downsample the raw blocks to 5m resolution, and the 5m blocks to 1h resolution.
+// Raw blocks are downsampled only once they've been fully compacted, which is when the largest compaction range they
+// belong to is over and they aren't part of any split or merge job.
+func planDownsampling(userID string, metas map[ulid.ULID]*metadata.Meta, ranges []int64, shardCount, splitGroups uint32) []downsampleJob {
+	if len(metas) == 0 || len(ranges) == 0 {
+		return nil
+	}
+
+	var (
+		largestRange = ranges[len(ranges)-1]
+		raw          []*metadata.Meta
+		downsampled  []*metadata.Meta
+
+		// Downsampled blocks keep the external labels and the sources of the block they've been downsampled from.
+		existing = map[int64]map[string]struct{}{}
+	)
+
+	for _, m := range metas {
+		res := m.Thanos.Downsample.Resolution
+		if res == downsample.ResLevel0 {
+			raw = append(raw, m)
+			continue
+		}
+
+		downsampled = append(downsampled, m)
+		if existing[res] == nil {
+			existing[res] = map[string]struct{}{}
+		}
+		existing[res][downsampleSourceKey(m)] = struct{}{}
+	}
+
+	// The raw blocks which are still going to be split or merged are not downsampled yet.
+	pending := blocksPendingCompaction(userID, raw, ranges, shardCount, splitGroups)
+
+	var jobs []downsampleJob
+	highestMaxTime := getMaxTime(raw)
+
+	for _, m := range raw {
+		if _, ok := pending[m.ULID]; ok {
+			continue
+		}
+
+		// The block must be within a single largest compaction range, which must be over.
+		rangeStart := m.MinTime - m.MinTime%largestRange
+		if m.MaxTime > rangeStart+largestRange || rangeStart+largestRange > highestMaxTime {
+			continue
+		}
+
+		if _, ok := existing[downsample.ResLevel1][downsampleSourceKey(m)]; ok {
+			continue
+		}
+		jobs = append(jobs, downsampleJob{meta: m, resolution: downsample.ResLevel1})
+	}
+
+	for _, m := range downsampled {
+		if m.Thanos.Downsample.Resolution != downsample.ResLevel1 {
+			continue
+		}
+		if _, ok := existing[downsample.ResLevel2][downsampleSourceKey(m)]; ok {
+			continue
+		}
+		jobs = append(jobs, downsampleJob{meta: m, resolution: downsample.ResLevel2})
+	}
+
+	// Sort the jobs to keep the output stable.
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].resolution != jobs[j].resolution {
+			return jobs[i].resolution < jobs[j].resolution
+		}
+		if jobs[i].meta.MinTime != jobs[j].meta.MinTime {
+			return jobs[i].meta.MinTime < jobs[j].meta.MinTime
+		}
+		return jobs[i].meta.ULID.Compare(jobs[j].meta.ULID) < 0
+	})
+
+	return jobs
+}
+
+// blocksPendingCompaction returns the IDs of the blocks which are part of a split or merge job.
+func blocksPendingCompaction(userID string, blocks []*metadata.Meta, ranges []int64, shardCount, splitGroups uint32) map[ulid.ULID]struct{} {
+	pending := map[ulid.ULID]struct{}{}
+	for _, job := range planCompaction(userID, blocks, ranges, shardCount, splitGroups) {
+		for _, m := range job.blocks {
+			pending[m.ULID] = struct{}{}
+		}
+	}
+	return pending
+}
+
+func downsampleSourceKey(m *metadata.Meta) string {
+	return fmt.Sprintf("%s-%v", labels.FromMap(m.Thanos.Labels).String(), m.Compaction.Sources)
+}
+
+// downsampleBlocks runs the downsampling jobs of the tenant owned by this compactor.
+func (c *MultitenantCompactor) downsampleBlocks(ctx context.Context, userID string, userBucket objstore.Bucket, fetcher block.MetadataFetcher, logger log.Logger) error {
+	metas, _, err := fetcher.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch blocks metadata")
+	}
+
+	jobs := planDownsampling(userID, metas, c.compactorCfg.BlockRanges.ToMilliseconds(), uint32(c.cfgProvider.CompactorSplitAndMergeShards(userID)), uint32(c.cfgProvider.CompactorSplitGroups(userID)))
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if owned, err := c.shardingStrategy.ownJob(job.newJob(userID)); err != nil {
+			return errors.Wrap(err, "check if downsampling job is owned")
+		} else if !owned {
+			continue
+		}
+
+		if err := c.downsampleBlock(ctx, userBucket, job.meta, job.resolution, log.With(logger, "block", job.meta.ULID, "resolution", resolutionString(job.resolution))); err != nil {
+			return errors.Wrapf(err, "downsample block %s", job.meta.ULID)
+		}
+	}
+	return nil
+}
+
+// downsampleBlock uploads a copy of the block downsampled to the given resolution.
+func (c *MultitenantCompactor) downsampleBlock(ctx context.Context, userBucket objstore.Bucket, meta *metadata.Meta, resolution int64, logger log.Logger) error {
+	start := time.Now()
+
+	jobDir := filepath.Join(c.compactorCfg.DataDir, "downsample", meta.ULID.String())
+	defer func() {
+		if err := os.RemoveAll(jobDir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove downsampling job directory", "path", jobDir, "err", err)
+		}
+	}()
+
+	bdir := filepath.Join(jobDir, meta.ULID.String())
+	if err := os.RemoveAll(bdir); err != nil {
+		return errors.Wrap(err, "clean block directory")
+	}
+	if err := block.Download(ctx, logger, userBucket, meta.ULID, bdir); err != nil {
+		return errors.Wrap(err, "download block")
+	}
+
+	b, err := tsdb.OpenBlock(logger, bdir, downsample.NewPool())
+	if err != nil {
+		return errors.Wrap(err, "open block")
+	}
+	id, err := downsample.Downsample(logger, meta, b, jobDir, resolution)
+	if closeErr := b.Close(); closeErr != nil {
+		level.Warn(logger).Log("msg", "failed to close block", "err", closeErr)
+	}
+	if err != nil {
+		return errors.Wrap(err, "downsample block")
+	}
+
+	resdir := filepath.Join(jobDir, id.String())
+	if err := block.VerifyIndex(logger, filepath.Join(resdir, block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		return errors.Wrap(err, "invalid result block")
+	}
+	if err := mimir_tsdb.UploadBlock(ctx, logger, userBucket, resdir, nil); err != nil {
+		return errors.Wrap(err, "upload block")
+	}
+
+	c.blocksDownsampled.WithLabelValues(resolutionString(resolution)).Inc()
+	level.Info(logger).Log("msg", "downsampled block", "result_block", id, "duration", time.Since(start), "duration_ms", time.Since(start).Milliseconds())
+	return nil
+}
+
+func resolutionString(resolution int64) string {
+	return model.Duration(time.Duration(resolution) * time.Millisecond).String()
+}
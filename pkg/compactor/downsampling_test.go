@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+)
+
+func TestPlanDownsampling(t *testing.T) {
+	const userID = "user-1"
+
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	block3 := ulid.MustNew(3, nil)
+	block4 := ulid.MustNew(4, nil)
+	block5 := ulid.MustNew(5, nil)
+
+	newMeta := func(id ulid.ULID, minTime, maxTime, resolution int64, sources ...ulid.ULID) *metadata.Meta {
+		if len(sources) == 0 {
+			sources = []ulid.ULID{id}
+		}
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: minTime, MaxTime: maxTime, Compaction: tsdb.BlockMetaCompaction{Sources: sources}},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"external": "1"}, Downsample: metadata.ThanosDownsample{Resolution: resolution}},
+		}
+	}
+
+	tests := map[string]struct {
+		blocks   []*metadata.Meta
+		expected []downsampleJob
+	}{
+		"no input blocks": {
+			expected: nil,
+		},
+		"should downsample a raw block once its largest compaction range is over": {
+			blocks: []*metadata.Meta{
+				newMeta(block1, 0, 40, downsample.ResLevel0),
+				newMeta(block2, 40, 60, downsample.ResLevel0),
+			},
+			expected: []downsampleJob{
+				{meta: newMeta(block1, 0, 40, downsample.ResLevel0), resolution: downsample.ResLevel1},
+			},
+		},
+		"should NOT downsample raw blocks which are going to be merged": {
+			blocks: []*metadata.Meta{
+				newMeta(block1, 0, 20, downsample.ResLevel0),
+				newMeta(block2, 20, 40, downsample.ResLevel0),
+				newMeta(block3, 40, 60, downsample.ResLevel0),
+			},
+			expected: nil,
+		},
+		"should NOT downsample a raw block spanning multiple compaction ranges": {
+			blocks: []*metadata.Meta{
+				newMeta(block1, 20, 60, downsample.ResLevel0),
+				newMeta(block2, 80, 100, downsample.ResLevel0),
+			},
+			expected: nil,
+		},
+		"should downsample a 5m block to 1h if the raw block has already been downsampled": {
+			blocks: []*metadata.Meta{
+				newMeta(block1, 0, 40, downsample.ResLevel0),
+				newMeta(block2, 40, 60, downsample.ResLevel0),
+				newMeta(block3, 0, 40, downsample.ResLevel1, block1),
+			},
+			expected: []downsampleJob{
+				{meta: newMeta(block3, 0, 40, downsample.ResLevel1, block1), resolution: downsample.ResLevel2},
+			},
+		},
+		"should NOT downsample blocks which have already been downsampled to both resolutions": {
+			blocks: []*metadata.Meta{
+				newMeta(block1, 0, 40, downsample.ResLevel0),
+				newMeta(block2, 40, 60, downsample.ResLevel0),
+				newMeta(block3, 0, 40, downsample.ResLevel1, block1),
+				newMeta(block4, 0, 40, downsample.ResLevel2, block1),
+			},
+			expected: nil,
+		},
+		"should downsample a raw block again if its sources differ from the downsampled one": {
+			blocks: []*metadata.Meta{
+				newMeta(block1, 0, 40, downsample.ResLevel0, block4, block5),
+				newMeta(block2, 40, 60, downsample.ResLevel0),
+				newMeta(block3, 0, 40, downsample.ResLevel1, block4),
+			},
+			expected: []downsampleJob{
+				{meta: newMeta(block1, 0, 40, downsample.ResLevel0, block4, block5), resolution: downsample.ResLevel1},
+				{meta: newMeta(block3, 0, 40, downsample.ResLevel1, block4), resolution: downsample.ResLevel2},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			metas := map[ulid.ULID]*metadata.Meta{}
+			for _, b := range testData.blocks {
+				metas[b.ULID] = b
+			}
+
+			actual := planDownsampling(userID, metas, []int64{20, 40}, 0, 0)
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
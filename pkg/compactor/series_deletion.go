@@ -0,0 +1,565 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// newSeriesDeletionJob returns the job processing a series deletion request of the tenant. The jobs
+// are sharded across the compactors of the tenant like the split and merge jobs are.
+func newSeriesDeletionJob(userID string, t *mimir_tsdb.Tombstone) *Job {
+	return NewJob(userID, "series-deletion-"+t.RequestID, nil, 0, metadata.NoneFunc, false, 0, t.RequestID)
+}
+
+// newSeriesDeletionBlockJob returns the job rewriting a block without the samples deleted by a series deletion
+// request. The jobs are sharded by block, so that the compactor rewriting the block is the one applying the
+// series retention rules to it and downsampling it.
+func newSeriesDeletionBlockJob(userID string, t *mimir_tsdb.Tombstone, meta *metadata.Meta) *Job {
+	return NewJob(userID, "series-deletion-"+t.RequestID+"-"+meta.ULID.String(), labels.FromMap(meta.Thanos.Labels), meta.Thanos.Downsample.Resolution, metadata.NoneFunc, false, 0, meta.ULID.String())
+}
+
+// processSeriesDeletions runs the series deletion jobs of the tenant for the pending series deletion requests
+// older than the configured delay. Each compactor rewrites the blocks it owns containing samples deleted by the
+// requests, while the compactor owning a request marks it as processed once there are no such blocks anymore,
+// and as done once the blocks replaced by the rewritten ones have been deleted.
+func (c *MultitenantCompactor) processSeriesDeletions(ctx context.Context, userID string, userBucket objstore.Bucket, fetcher block.MetadataFetcher, logger log.Logger) error {
+	ts, err := mimir_tsdb.ReadTombstones(ctx, c.bucketClient, userID)
+	if err != nil {
+		return errors.Wrap(err, "read series deletion requests")
+	}
+
+	var pending mimir_tsdb.Tombstones
+	for _, t := range ts {
+		switch t.State {
+		case mimir_tsdb.TombstonePending:
+			if time.Since(util.TimeFromMillis(t.RequestCreatedAt)) >= c.compactorCfg.SeriesDeletionDelay {
+				pending = append(pending, t)
+			}
+		case mimir_tsdb.TombstoneProcessed:
+			if err := c.completeSeriesDeletion(ctx, userID, t, log.With(logger, "request_id", t.RequestID)); err != nil {
+				return errors.Wrapf(err, "series deletion request %s", t.RequestID)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	metas, _, err := fetcher.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch blocks metadata")
+	}
+
+	raw := make([]*metadata.Meta, 0, len(metas))
+	for _, meta := range metas {
+		if meta.Thanos.Downsample.Resolution == 0 {
+			raw = append(raw, meta)
+		}
+	}
+	sortMetasByMinTime(raw)
+
+	// The blocks which are still going to be split or merged are rewritten once compacted, so that they're
+	// not rewritten by a compactor while another one compacts them.
+	compacting := blocksPendingCompaction(userID, raw, c.compactorCfg.BlockRanges.ToMilliseconds(), uint32(c.cfgProvider.CompactorSplitAndMergeShards(userID)), uint32(c.cfgProvider.CompactorSplitGroups(userID)))
+
+	for _, t := range pending {
+		if err := c.runSeriesDeletionJob(ctx, userID, userBucket, metas, compacting, t, log.With(logger, "request_id", t.RequestID)); err != nil {
+			return errors.Wrapf(err, "series deletion request %s", t.RequestID)
+		}
+	}
+	return nil
+}
+
+// runSeriesDeletionJob rewrites the blocks owned by this compactor containing samples deleted by the request. The
+// request is only marked as processed by the compactor owning it when no block needs to be rewritten, because the
+// blocks compacted in the meanwhile from the source blocks of the rewritten ones may still contain deleted samples.
+func (c *MultitenantCompactor) runSeriesDeletionJob(ctx context.Context, userID string, userBucket objstore.Bucket, metas map[ulid.ULID]*metadata.Meta, compacting map[ulid.ULID]struct{}, t *mimir_tsdb.Tombstone, logger log.Logger) error {
+	requestOwned, err := c.shardingStrategy.ownJob(newSeriesDeletionJob(userID, t))
+	if err != nil {
+		return errors.Wrap(err, "check if series deletion job is owned")
+	}
+
+	jobDir := filepath.Join(c.compactorCfg.DataDir, "series-deletion", t.RequestID)
+	defer func() {
+		if err := os.RemoveAll(jobDir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove series deletion job directory", "path", jobDir, "err", err)
+		}
+	}()
+
+	remaining := 0
+	for _, meta := range metas {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !t.Overlaps(meta.MinTime, meta.MaxTime-1) || hasDeletionApplied(meta, t.RequestID) {
+			continue
+		}
+		if _, ok := compacting[meta.ULID]; ok {
+			remaining++
+			continue
+		}
+
+		blockLogger := log.With(logger, "block", meta.ULID)
+		if owned, err := c.shardingStrategy.ownJob(newSeriesDeletionBlockJob(userID, t, meta)); err != nil {
+			return errors.Wrap(err, "check if series deletion block job is owned")
+		} else if !owned {
+			if !requestOwned {
+				continue
+			}
+
+			// The block is rewritten by another compactor, if it contains any deleted sample.
+			ok, err := c.blockHasDeletedSamples(ctx, userBucket, meta, mimir_tsdb.Tombstones{t}, jobDir, blockLogger)
+			if err != nil {
+				return errors.Wrapf(err, "check block %s", meta.ULID)
+			}
+			if ok {
+				remaining++
+			}
+			continue
+		}
+
+		ok, err := c.rewriteBlockWithoutDeletedSeries(ctx, userBucket, meta, t, jobDir, blockLogger)
+		if err != nil {
+			return errors.Wrapf(err, "rewrite block %s", meta.ULID)
+		}
+		if ok {
+			remaining++
+		}
+	}
+
+	if remaining > 0 || !requestOwned {
+		level.Info(logger).Log("msg", "series deletion request not processed yet", "remaining_blocks", remaining)
+		return nil
+	}
+
+	t.State = mimir_tsdb.TombstoneProcessed
+	t.StateCreatedAt = time.Now().UnixMilli()
+	if err := mimir_tsdb.WriteTombstone(ctx, c.bucketClient, userID, c.cfgProvider, t); err != nil {
+		return err
+	}
+
+	c.seriesDeletionRequestsProcessed.Inc()
+	level.Info(logger).Log("msg", "series deletion request processed")
+	return nil
+}
+
+// completeSeriesDeletion marks the processed request as done once the blocks replaced by the rewritten ones
+// have been deleted, so that it's not applied at query time anymore.
+func (c *MultitenantCompactor) completeSeriesDeletion(ctx context.Context, userID string, t *mimir_tsdb.Tombstone, logger log.Logger) error {
+	if time.Since(util.TimeFromMillis(t.StateCreatedAt)) < c.compactorCfg.DeletionDelay {
+		return nil
+	}
+	if owned, err := c.shardingStrategy.ownJob(newSeriesDeletionJob(userID, t)); err != nil {
+		return errors.Wrap(err, "check if series deletion job is owned")
+	} else if !owned {
+		return nil
+	}
+
+	t.State = mimir_tsdb.TombstoneDone
+	t.StateCreatedAt = time.Now().UnixMilli()
+	if err := mimir_tsdb.WriteTombstone(ctx, c.bucketClient, userID, c.cfgProvider, t); err != nil {
+		return err
+	}
+
+	level.Info(logger).Log("msg", "series deletion request done")
+	return nil
+}
+
+// rewriteBlockWithoutDeletedSeries uploads a copy of the block without the samples deleted by the request, and marks
+// the block for deletion. It returns false if the block doesn't contain any deleted sample, in which case only the
+// block index is downloaded.
+func (c *MultitenantCompactor) rewriteBlockWithoutDeletedSeries(ctx context.Context, userBucket objstore.Bucket, meta *metadata.Meta, t *mimir_tsdb.Tombstone, jobDir string, logger log.Logger) (bool, error) {
+	ok, _, err := c.rewriteBlock(ctx, userBucket, meta, mimir_tsdb.Tombstones{t}, jobDir, logger)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := markRewrittenBlockForDeletion(logger, userBucket, meta, "rewritten by series deletion request "+t.RequestID, c.seriesDeletionBlocksMarkedForDeletion); err != nil {
+		return false, err
+	}
+
+	c.seriesDeletionBlocksRewritten.Inc()
+	return true, nil
+}
+
+// blockHasDeletedSamples returns whether the block contains samples deleted by the tombstones. Only the block index
+// is downloaded.
+func (c *MultitenantCompactor) blockHasDeletedSamples(ctx context.Context, userBucket objstore.Bucket, meta *metadata.Meta, ts mimir_tsdb.Tombstones, jobDir string, logger log.Logger) (bool, error) {
+	_, numTombstones, err := downloadBlockIndexWithTombstones(ctx, userBucket, meta, ts, jobDir, logger)
+	return numTombstones > 0, err
+}
+
+// downloadBlockIndexWithTombstones downloads the block index to the job directory, and deletes the series matching
+// the tombstones from the local block. It returns the block directory and the number of TSDB tombstones written.
+func downloadBlockIndexWithTombstones(ctx context.Context, userBucket objstore.Bucket, meta *metadata.Meta, ts mimir_tsdb.Tombstones, jobDir string, logger log.Logger) (string, uint64, error) {
+	bdir := filepath.Join(jobDir, meta.ULID.String())
+	if err := os.RemoveAll(bdir); err != nil {
+		return "", 0, errors.Wrap(err, "clean block directory")
+	}
+	if err := os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0750); err != nil {
+		return "", 0, errors.Wrap(err, "create block directory")
+	}
+
+	if err := objstore.DownloadFile(ctx, logger, userBucket, path.Join(meta.ULID.String(), block.IndexFilename), filepath.Join(bdir, block.IndexFilename)); err != nil {
+		return "", 0, errors.Wrap(err, "download index")
+	}
+	if err := meta.WriteToDir(logger, bdir); err != nil {
+		return "", 0, errors.Wrap(err, "write meta")
+	}
+
+	// Deleting the series from the block only writes the tombstones, so the chunks aren't needed to find
+	// out whether the block contains any deleted sample.
+	numTombstones, err := writeBlockTombstones(bdir, ts, logger)
+	return bdir, numTombstones, err
+}
+
+// rewriteBlock uploads a copy of the block without the samples deleted by the tombstones. It returns false if
+// the block doesn't contain any deleted sample, in which case only the block index is downloaded. Otherwise it
+// also returns the difference between the size of the original block and the size of the rewritten one. The
+// original block is left untouched, and must be marked for deletion by the caller.
+func (c *MultitenantCompactor) rewriteBlock(ctx context.Context, userBucket objstore.Bucket, meta *metadata.Meta, ts mimir_tsdb.Tombstones, jobDir string, logger log.Logger) (bool, int64, error) {
+	bdir, numTombstones, err := downloadBlockIndexWithTombstones(ctx, userBucket, meta, ts, jobDir, logger)
+	if err != nil {
+		return false, 0, err
+	}
+	if numTombstones == 0 {
+		return false, 0, nil
+	}
+
+	if err := objstore.DownloadDir(ctx, logger, userBucket, meta.ULID.String(), path.Join(meta.ULID.String(), block.ChunksDirname), filepath.Join(bdir, block.ChunksDirname)); err != nil {
+		return false, 0, errors.Wrap(err, "download chunks")
+	}
+	originalSize, err := blockSize(bdir)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var newID ulid.ULID
+	if meta.Thanos.Downsample.Resolution == 0 {
+		newID, err = c.writeBlockWithoutDeletedSamples(jobDir, bdir, meta, logger)
+	} else {
+		newID, err = writeDownsampledBlockWithoutDeletedSamples(jobDir, bdir, meta, ts, logger)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	if newID == (ulid.ULID{}) {
+		level.Info(logger).Log("msg", "all the samples of the block have been deleted")
+		return true, originalSize, nil
+	}
+
+	newDir := filepath.Join(jobDir, newID.String())
+	newSize, err := blockSize(newDir)
+	if err != nil {
+		return false, 0, err
+	}
+	if err := c.uploadRewrittenBlock(ctx, userBucket, meta, newDir, ts, logger); err != nil {
+		return false, 0, err
+	}
+	level.Info(logger).Log("msg", "uploaded block without deleted series", "result_block", newID)
+
+	return true, originalSize - newSize, nil
+}
+
+// writeBlockWithoutDeletedSamples writes a copy of the raw block without the samples deleted by its TSDB tombstones,
+// using the TSDB compactor. It returns an empty ULID if all the samples have been deleted.
+func (c *MultitenantCompactor) writeBlockWithoutDeletedSamples(jobDir, bdir string, meta *metadata.Meta, logger log.Logger) (ulid.ULID, error) {
+	b, err := tsdb.OpenBlock(logger, bdir, nil)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open block")
+	}
+	newID, err := c.blocksCompactor.Write(jobDir, b, meta.MinTime, meta.MaxTime, &meta.BlockMeta)
+	if closeErr := b.Close(); closeErr != nil {
+		level.Warn(logger).Log("msg", "failed to close block", "err", closeErr)
+	}
+	return newID, errors.Wrap(err, "write block")
+}
+
+// writeDownsampledBlockWithoutDeletedSamples writes a copy of the downsampled block without the samples deleted by
+// the tombstones. The TSDB compactor can't re-encode the aggregated chunks, so the partially deleted chunks are
+// re-encoded one aggregate at a time. It returns an empty ULID if all the samples have been deleted.
+func writeDownsampledBlockWithoutDeletedSamples(jobDir, bdir string, meta *metadata.Meta, ts mimir_tsdb.Tombstones, logger log.Logger) (_ ulid.ULID, err error) {
+	b, err := tsdb.OpenBlock(logger, bdir, downsample.NewPool())
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithErrCapture(&err, b, "close block")
+
+	indexr, err := b.Index()
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open index reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexr, "close index reader")
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "open chunk reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkr, "close chunk reader")
+
+	newMeta := *meta
+	newMeta.ULID = ulid.MustNew(ulid.Now(), rand.Reader)
+	newDir := filepath.Join(jobDir, newMeta.ULID.String())
+	if err := os.MkdirAll(newDir, 0750); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create block directory")
+	}
+
+	w, err := downsample.NewStreamedBlockWriter(newDir, indexr, logger, newMeta)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create block writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, w, "close block writer")
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "get all postings")
+	}
+
+	var (
+		lset      labels.Labels
+		chks      []chunks.Meta
+		numSeries int
+	)
+	for postings.Next() {
+		if err := indexr.Series(postings.At(), &lset, &chks); err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "get series %d", postings.At())
+		}
+
+		intervals := ts.DeletedIntervals(lset)
+		res := chks[:0]
+		for _, c := range chks {
+			if (tombstones.Interval{Mint: c.MinTime, Maxt: c.MaxTime}).IsSubrange(intervals) {
+				continue
+			}
+
+			chk, err := chunkr.Chunk(c.Ref)
+			if err != nil {
+				return ulid.ULID{}, errors.Wrapf(err, "get chunk %d of series %d", c.Ref, postings.At())
+			}
+			aggr, ok := chk.(*downsample.AggrChunk)
+			if !ok {
+				return ulid.ULID{}, errors.Errorf("expected downsampled chunk, got %T for series %d", chk, postings.At())
+			}
+
+			if overlapsIntervals(intervals, c.MinTime, c.MaxTime) {
+				if aggr, c.MinTime, c.MaxTime, err = filterDeletedAggrChunk(*aggr, intervals); err != nil {
+					return ulid.ULID{}, errors.Wrapf(err, "filter chunk %d of series %d", c.Ref, postings.At())
+				}
+				if aggr == nil {
+					continue
+				}
+			}
+
+			c.Chunk = aggr
+			res = append(res, c)
+		}
+
+		if len(res) == 0 {
+			continue
+		}
+		if err := w.WriteSeries(lset, res); err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "write series %d", postings.At())
+		}
+		numSeries++
+	}
+	if err := postings.Err(); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "iterate postings")
+	}
+
+	if numSeries == 0 {
+		return ulid.ULID{}, nil
+	}
+	return newMeta.ULID, nil
+}
+
+// filterDeletedAggrChunk re-encodes each aggregate of the chunk without the samples in the deleted intervals,
+// and returns the re-encoded chunk with its time range, which is the one of the count aggregate like for the
+// chunks written by the downsampling. It returns a nil chunk if all the samples have been deleted.
+func filterDeletedAggrChunk(chk downsample.AggrChunk, intervals tombstones.Intervals) (*downsample.AggrChunk, int64, int64, error) {
+	var (
+		aggrs      [5]chunkenc.Chunk
+		mint, maxt int64
+	)
+
+	for i := range aggrs {
+		in, err := chk.Get(downsample.AggrType(i))
+		if errors.Is(err, downsample.ErrAggrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		out := chunkenc.NewXORChunk()
+		app, err := out.Appender()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		it := in.Iterator(nil)
+		for it.Next() {
+			ts, v := it.At()
+			if (tombstones.Interval{Mint: ts, Maxt: ts}).IsSubrange(intervals) {
+				continue
+			}
+
+			if downsample.AggrType(i) == downsample.AggrCount {
+				if out.NumSamples() == 0 {
+					mint = ts
+				}
+				maxt = ts
+			}
+			app.Append(ts, v)
+		}
+		if err := it.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		aggrs[i] = out
+	}
+
+	if aggrs[downsample.AggrCount] == nil || aggrs[downsample.AggrCount].NumSamples() == 0 {
+		return nil, 0, 0, nil
+	}
+	return downsample.EncodeAggrChunk(aggrs), mint, maxt, nil
+}
+
+func overlapsIntervals(intervals tombstones.Intervals, mint, maxt int64) bool {
+	for _, interval := range intervals {
+		if interval.Mint <= maxt && interval.Maxt >= mint {
+			return true
+		}
+	}
+	return false
+}
+
+// markRewrittenBlockForDeletion marks the block replaced by its rewritten copy for deletion.
+func markRewrittenBlockForDeletion(logger log.Logger, userBucket objstore.Bucket, meta *metadata.Meta, details string, markedForDeletion prometheus.Counter) error {
+	// Spawn a new context so we always mark a block for deletion in full on shutdown.
+	delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	return errors.Wrap(block.MarkForDeletion(delCtx, logger, userBucket, meta.ULID, details, markedForDeletion), "mark block for deletion")
+}
+
+// blockSize returns the size of the index and chunks of the block in the local directory.
+func blockSize(bdir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(bdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && (info.Name() == block.IndexFilename || filepath.Base(filepath.Dir(path)) == block.ChunksDirname) {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, errors.Wrap(err, "compute block size")
+}
+
+// writeBlockTombstones deletes the series matching the tombstones from the block, and returns the number of tombstones.
+func writeBlockTombstones(bdir string, ts mimir_tsdb.Tombstones, logger log.Logger) (uint64, error) {
+	b, err := tsdb.OpenBlock(logger, bdir, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "open block")
+	}
+	defer func() {
+		if err := b.Close(); err != nil {
+			level.Warn(logger).Log("msg", "failed to close block", "err", err)
+		}
+	}()
+
+	for _, t := range ts {
+		for _, matchers := range t.Matchers() {
+			if err := b.Delete(t.StartTime, t.EndTime, matchers...); err != nil {
+				return 0, errors.Wrap(err, "delete series")
+			}
+		}
+	}
+	return b.Meta().Stats.NumTombstones, nil
+}
+
+// uploadRewrittenBlock uploads the block rewritten from the original one, keeping its external labels,
+// compaction level and sources, and recording the deletion requests applied.
+func (c *MultitenantCompactor) uploadRewrittenBlock(ctx context.Context, userBucket objstore.Bucket, original *metadata.Meta, bdir string, ts mimir_tsdb.Tombstones, logger log.Logger) error {
+	var deletions []metadata.DeletionRequest
+	for _, t := range ts {
+		for _, matchers := range t.Matchers() {
+			deletions = append(deletions, metadata.DeletionRequest{
+				Matchers:  matchers,
+				Intervals: tombstones.Intervals{{Mint: t.StartTime, Maxt: t.EndTime}},
+				RequestID: t.RequestID,
+			})
+		}
+	}
+
+	rewrites := append([]metadata.Rewrite(nil), original.Thanos.Rewrites...)
+	rewrites = append(rewrites, metadata.Rewrite{
+		Sources:          original.Compaction.Sources,
+		DeletionsApplied: deletions,
+	})
+
+	newMeta, err := metadata.InjectThanos(logger, bdir, metadata.Thanos{
+		Labels:       original.Thanos.Labels,
+		Downsample:   original.Thanos.Downsample,
+		Source:       metadata.CompactorSource,
+		SegmentFiles: block.GetSegmentFiles(bdir),
+		Rewrites:     rewrites,
+	}, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to finalize the block")
+	}
+
+	newMeta.Compaction.Level = original.Compaction.Level
+	newMeta.Compaction.Sources = original.Compaction.Sources
+	if err := newMeta.WriteToDir(logger, bdir); err != nil {
+		return errors.Wrap(err, "write meta")
+	}
+
+	// The downsampled blocks are written without tombstones.
+	if err := os.Remove(filepath.Join(bdir, "tombstones")); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove tombstones")
+	}
+
+	if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), newMeta.MinTime, newMeta.MaxTime); err != nil {
+		return errors.Wrap(err, "invalid result block")
+	}
+
+	return errors.Wrap(mimir_tsdb.UploadBlock(ctx, logger, userBucket, bdir, nil), "upload block")
+}
+
+func hasDeletionApplied(meta *metadata.Meta, requestID string) bool {
+	for _, rewrite := range meta.Thanos.Rewrites {
+		for _, deletion := range rewrite.DeletionsApplied {
+			if deletion.RequestID == requestID {
+				return true
+			}
+		}
+	}
+	return false
+}
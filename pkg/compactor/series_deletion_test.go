@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+func TestMultitenantCompactor_RunSeriesDeletionJob(t *testing.T) {
+	const userID = "user"
+
+	var (
+		ctx     = context.Background()
+		logger  = log.NewNopLogger()
+		minTime = int64(0)
+		maxTime = 2 * time.Hour.Milliseconds()
+		series  = []labels.Labels{
+			labels.FromStrings(labels.MetricName, "metric", "series", "1"),
+			labels.FromStrings(labels.MetricName, "metric", "series", "2"),
+		}
+	)
+
+	bkt := objstore.NewInMemBucket()
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+
+	// Create and upload a block with two series.
+	blocksDir := t.TempDir()
+	blockID, err := createBlockWithOptions(ctx, blocksDir, series, 10, minTime, maxTime, labels.FromStrings("shard", "1"), 0, false, metadata.NoneFunc)
+	require.NoError(t, err)
+	require.NoError(t, mimir_tsdb.UploadBlock(ctx, logger, userBkt, filepath.Join(blocksDir, blockID.String()), nil))
+
+	tsdbCompactor, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{maxTime - minTime}, nil, nil, true)
+	require.NoError(t, err)
+
+	c := &MultitenantCompactor{
+		compactorCfg:                          Config{DataDir: t.TempDir()},
+		logger:                                logger,
+		bucketClient:                          bkt,
+		cfgProvider:                           newMockConfigProvider(),
+		blocksCompactor:                       tsdbCompactor,
+		shardingStrategy:                      ownAllJobsShardingStrategy{},
+		seriesDeletionRequestsProcessed:       prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesDeletionBlocksRewritten:         prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesDeletionBlocksMarkedForDeletion: prometheus.NewCounter(prometheus.CounterOpts{}),
+	}
+
+	readMetas := func(ids ...ulid.ULID) map[ulid.ULID]*metadata.Meta {
+		metas := map[ulid.ULID]*metadata.Meta{}
+		for _, id := range ids {
+			r, err := userBkt.Get(ctx, path.Join(id.String(), block.MetaFilename))
+			require.NoError(t, err)
+			meta, err := metadata.Read(r)
+			require.NoError(t, err)
+			metas[id] = meta
+		}
+		return metas
+	}
+
+	t.Run("request not overlapping the blocks", func(t *testing.T) {
+		tombstone, err := mimir_tsdb.NewTombstone(maxTime, maxTime+1000, []string{`{series="1"}`}, time.Now())
+		require.NoError(t, err)
+
+		require.NoError(t, c.runSeriesDeletionJob(ctx, userID, userBkt, readMetas(blockID), nil, tombstone, logger))
+		assert.Equal(t, mimir_tsdb.TombstoneProcessed, tombstone.State)
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.seriesDeletionBlocksRewritten))
+
+		exists, err := userBkt.Exists(ctx, path.Join(blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("block pending compaction", func(t *testing.T) {
+		tombstone, err := mimir_tsdb.NewTombstone(minTime, maxTime, []string{`{series="1"}`}, time.Now())
+		require.NoError(t, err)
+
+		// The block is rewritten once compacted, so the request isn't processed yet.
+		require.NoError(t, c.runSeriesDeletionJob(ctx, userID, userBkt, readMetas(blockID), map[ulid.ULID]struct{}{blockID: {}}, tombstone, logger))
+		assert.Equal(t, mimir_tsdb.TombstonePending, tombstone.State)
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.seriesDeletionBlocksRewritten))
+	})
+
+	t.Run("block owned by another compactor", func(t *testing.T) {
+		tombstone, err := mimir_tsdb.NewTombstone(minTime, maxTime, []string{`{series="1"}`}, time.Now())
+		require.NoError(t, err)
+
+		c.shardingStrategy = ownJobsShardingStrategy(func(job *Job) bool { return job.ShardingKey() == tombstone.RequestID })
+		t.Cleanup(func() { c.shardingStrategy = ownAllJobsShardingStrategy{} })
+
+		// The block isn't rewritten, but it still contains deleted samples, so the request isn't processed yet.
+		require.NoError(t, c.runSeriesDeletionJob(ctx, userID, userBkt, readMetas(blockID), nil, tombstone, logger))
+		assert.Equal(t, mimir_tsdb.TombstonePending, tombstone.State)
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.seriesDeletionBlocksRewritten))
+
+		exists, err := userBkt.Exists(ctx, path.Join(blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("request deleting a series of the block", func(t *testing.T) {
+		tombstone, err := mimir_tsdb.NewTombstone(minTime, maxTime, []string{`{series="1"}`}, time.Now())
+		require.NoError(t, err)
+		require.NoError(t, mimir_tsdb.WriteTombstone(ctx, bkt, userID, nil, tombstone))
+
+		// The first run rewrites the block, without marking the request as processed.
+		require.NoError(t, c.runSeriesDeletionJob(ctx, userID, userBkt, readMetas(blockID), nil, tombstone, logger))
+		assert.Equal(t, mimir_tsdb.TombstonePending, tombstone.State)
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.seriesDeletionBlocksRewritten))
+
+		exists, err := userBkt.Exists(ctx, path.Join(blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		var newBlockID ulid.ULID
+		require.NoError(t, userBkt.Iter(ctx, "", func(name string) error {
+			if id, ok := block.IsBlockDir(name); ok && id != blockID {
+				newBlockID = id
+			}
+			return nil
+		}))
+		require.NotEqual(t, ulid.ULID{}, newBlockID)
+
+		newMeta := readMetas(newBlockID)[newBlockID]
+		original := readMetas(blockID)[blockID]
+		assert.Equal(t, original.Thanos.Labels, newMeta.Thanos.Labels)
+		assert.Equal(t, original.Compaction.Sources, newMeta.Compaction.Sources)
+		assert.Equal(t, original.MinTime, newMeta.MinTime)
+		assert.Equal(t, original.MaxTime, newMeta.MaxTime)
+		assert.True(t, hasDeletionApplied(newMeta, tombstone.RequestID))
+
+		// The rewritten block only contains the series not deleted.
+		blockDir := filepath.Join(t.TempDir(), newBlockID.String())
+		require.NoError(t, block.Download(ctx, logger, userBkt, newBlockID, blockDir))
+		b, err := tsdb.OpenBlock(logger, blockDir, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, b.Close()) })
+
+		q, err := tsdb.NewBlockQuerier(b, minTime, maxTime)
+		require.NoError(t, err)
+		set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "metric"))
+		var actual []labels.Labels
+		for set.Next() {
+			actual = append(actual, set.At().Labels())
+			samples, err := storage.ExpandSamples(set.At().Iterator(), nil)
+			require.NoError(t, err)
+			assert.Len(t, samples, 10)
+		}
+		require.NoError(t, set.Err())
+		assert.Equal(t, []labels.Labels{series[1]}, actual)
+		require.NoError(t, q.Close())
+
+		// The next run finds no block to rewrite, and marks the request as processed.
+		require.NoError(t, c.runSeriesDeletionJob(ctx, userID, userBkt, readMetas(newBlockID), nil, tombstone, logger))
+		assert.Equal(t, mimir_tsdb.TombstoneProcessed, tombstone.State)
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.seriesDeletionBlocksRewritten))
+		assert.Equal(t, float64(2), testutil.ToFloat64(c.seriesDeletionRequestsProcessed))
+
+		stored, err := mimir_tsdb.ReadTombstones(ctx, bkt, userID)
+		require.NoError(t, err)
+		for _, s := range stored {
+			assert.Equal(t, mimir_tsdb.TombstoneProcessed, s.State)
+		}
+	})
+}
+
+func TestMultitenantCompactor_RunSeriesDeletionJob_DownsampledBlock(t *testing.T) {
+	const userID = "user"
+
+	var (
+		ctx     = context.Background()
+		logger  = log.NewNopLogger()
+		minTime = int64(0)
+		maxTime = 2 * time.Hour.Milliseconds()
+		series  = []labels.Labels{
+			labels.FromStrings(labels.MetricName, "metric", "series", "1"),
+			labels.FromStrings(labels.MetricName, "metric", "series", "2"),
+		}
+	)
+
+	bkt := objstore.NewInMemBucket()
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+
+	// Create a raw block with a sample per minute, and upload its 5m downsampled copy.
+	blocksDir := t.TempDir()
+	rawID, err := createBlockWithOptions(ctx, blocksDir, series, 120, minTime, maxTime, labels.FromStrings("shard", "1"), 0, false, metadata.NoneFunc)
+	require.NoError(t, err)
+	rawMeta, err := metadata.ReadFromDir(filepath.Join(blocksDir, rawID.String()))
+	require.NoError(t, err)
+
+	raw, err := tsdb.OpenBlock(logger, filepath.Join(blocksDir, rawID.String()), nil)
+	require.NoError(t, err)
+	blockID, err := downsample.Downsample(logger, rawMeta, raw, blocksDir, downsample.ResLevel1)
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
+	require.NoError(t, mimir_tsdb.UploadBlock(ctx, logger, userBkt, filepath.Join(blocksDir, blockID.String()), nil))
+
+	c := &MultitenantCompactor{
+		compactorCfg:                          Config{DataDir: t.TempDir()},
+		logger:                                logger,
+		bucketClient:                          bkt,
+		cfgProvider:                           newMockConfigProvider(),
+		shardingStrategy:                      ownAllJobsShardingStrategy{},
+		seriesDeletionRequestsProcessed:       prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesDeletionBlocksRewritten:         prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesDeletionBlocksMarkedForDeletion: prometheus.NewCounter(prometheus.CounterOpts{}),
+	}
+
+	// Delete the first hour of a series.
+	deletedUntil := time.Hour.Milliseconds()
+	tombstone, err := mimir_tsdb.NewTombstone(minTime, deletedUntil, []string{`{series="1"}`}, time.Now())
+	require.NoError(t, err)
+
+	r, err := userBkt.Get(ctx, path.Join(blockID.String(), block.MetaFilename))
+	require.NoError(t, err)
+	meta, err := metadata.Read(r)
+	require.NoError(t, err)
+
+	require.NoError(t, c.runSeriesDeletionJob(ctx, userID, userBkt, map[ulid.ULID]*metadata.Meta{blockID: meta}, nil, tombstone, logger))
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.seriesDeletionBlocksRewritten))
+
+	var newBlockID ulid.ULID
+	require.NoError(t, userBkt.Iter(ctx, "", func(name string) error {
+		if id, ok := block.IsBlockDir(name); ok && id != blockID {
+			newBlockID = id
+		}
+		return nil
+	}))
+	require.NotEqual(t, ulid.ULID{}, newBlockID)
+
+	blockDir := filepath.Join(t.TempDir(), newBlockID.String())
+	require.NoError(t, block.Download(ctx, logger, userBkt, newBlockID, blockDir))
+	newMeta, err := metadata.ReadFromDir(blockDir)
+	require.NoError(t, err)
+	assert.Equal(t, downsample.ResLevel1, newMeta.Thanos.Downsample.Resolution)
+	assert.True(t, hasDeletionApplied(newMeta, tombstone.RequestID))
+
+	b, err := tsdb.OpenBlock(logger, blockDir, downsample.NewPool())
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, b.Close()) })
+	indexr, err := b.Index()
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, indexr.Close()) })
+	chunkr, err := b.Chunks()
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, chunkr.Close()) })
+
+	// The deleted samples are removed from every aggregate, while the other series is untouched.
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	require.NoError(t, err)
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for postings.Next() {
+		require.NoError(t, indexr.Series(postings.At(), &lset, &chks))
+		for _, c := range chks {
+			chk, err := chunkr.Chunk(c.Ref)
+			require.NoError(t, err)
+
+			for _, aggr := range []downsample.AggrType{downsample.AggrCount, downsample.AggrSum, downsample.AggrMin, downsample.AggrMax, downsample.AggrCounter} {
+				sub, err := chk.(*downsample.AggrChunk).Get(aggr)
+				require.NoError(t, err)
+				it := sub.Iterator(nil)
+				for it.Next() {
+					ts, _ := it.At()
+					if lset.Get("series") == "1" {
+						assert.Greater(t, ts, deletedUntil)
+					}
+				}
+				require.NoError(t, it.Err())
+			}
+			if lset.Get("series") == "1" {
+				assert.Greater(t, c.MinTime, deletedUntil)
+			}
+		}
+	}
+	require.NoError(t, postings.Err())
+}
+
+func TestMultitenantCompactor_ProcessSeriesDeletions_ShouldMarkProcessedRequestsAsDone(t *testing.T) {
+	const userID = "user"
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := objstore.NewInMemBucket()
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+
+	recent, err := mimir_tsdb.NewTombstone(0, 10, []string{`{series="1"}`}, time.Now())
+	require.NoError(t, err)
+	recent.State = mimir_tsdb.TombstoneProcessed
+	require.NoError(t, mimir_tsdb.WriteTombstone(ctx, bkt, userID, nil, recent))
+
+	old, err := mimir_tsdb.NewTombstone(0, 10, []string{`{series="2"}`}, time.Now().Add(-2*time.Hour))
+	require.NoError(t, err)
+	old.State = mimir_tsdb.TombstoneProcessed
+	require.NoError(t, mimir_tsdb.WriteTombstone(ctx, bkt, userID, nil, old))
+
+	c := &MultitenantCompactor{
+		compactorCfg:     Config{DataDir: t.TempDir(), DeletionDelay: time.Hour},
+		logger:           logger,
+		bucketClient:     bkt,
+		cfgProvider:      newMockConfigProvider(),
+		shardingStrategy: ownAllJobsShardingStrategy{},
+	}
+
+	fetcher, err := block.NewMetaFetcher(logger, 1, userBkt, t.TempDir(), nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.processSeriesDeletions(ctx, userID, userBkt, fetcher, logger))
+
+	// Only the request processed before the deletion delay is done.
+	stored, err := mimir_tsdb.ReadTombstones(ctx, bkt, userID)
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.Equal(t, old.RequestID, stored[0].RequestID)
+	assert.Equal(t, mimir_tsdb.TombstoneDone, stored[0].State)
+	assert.Equal(t, recent.RequestID, stored[1].RequestID)
+	assert.Equal(t, mimir_tsdb.TombstoneProcessed, stored[1].State)
+}
+
+// ownJobsShardingStrategy owns the jobs for which the function returns true.
+type ownJobsShardingStrategy func(job *Job) bool
+
+func (ownJobsShardingStrategy) compactorOwnUser(string) (bool, error)     { return true, nil }
+func (ownJobsShardingStrategy) blocksCleanerOwnUser(string) (bool, error) { return true, nil }
+func (s ownJobsShardingStrategy) ownJob(job *Job) (bool, error)           { return s(job), nil }
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// newSeriesRetentionJob returns the job applying the series retention rules to a block. The jobs are
+// sharded across the compactors of the tenant like the split and merge jobs are.
+func newSeriesRetentionJob(userID string, meta *metadata.Meta) *Job {
+	return NewJob(userID, "series-retention-"+meta.ULID.String(), labels.FromMap(meta.Thanos.Labels), meta.Thanos.Downsample.Resolution, metadata.NoneFunc, false, 0, meta.ULID.String())
+}
+
+// seriesRetentionTombstones returns the tombstones deleting the samples older than the retention period of
+// each rule. The compactor doesn't need to be as accurate as the queriers, so the retention cut-off time is
+// aligned to the largest compaction range: this way each fully compacted block is rewritten once per rule,
+// instead of at every compaction while the cut-off time moves through the block.
+func seriesRetentionTombstones(rules []validation.SeriesRetentionRule, now time.Time, largestRange int64) (mimir_tsdb.Tombstones, error) {
+	ts := make(mimir_tsdb.Tombstones, 0, len(rules))
+	for _, rule := range rules {
+		t, err := mimir_tsdb.NewSeriesRetentionTombstone(rule.Matchers, time.Duration(rule.Retention), now)
+		if err != nil {
+			return nil, err
+		}
+
+		if largestRange > 0 {
+			cutoff := t.EndTime + 1
+			t.EndTime = cutoff - cutoff%largestRange - 1
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// seriesRetentionTombstonesForBlock returns the tombstones which need to be applied to the block, and a key
+// identifying them. The tombstones deleting the whole block time range which have already been applied to
+// the block are skipped.
+func seriesRetentionTombstonesForBlock(meta *metadata.Meta, ts mimir_tsdb.Tombstones) (mimir_tsdb.Tombstones, string) {
+	var (
+		res  mimir_tsdb.Tombstones
+		keys []string
+	)
+
+	for _, t := range ts {
+		if !t.Overlaps(meta.MinTime, meta.MaxTime-1) {
+			continue
+		}
+
+		// The block max time is exclusive.
+		if meta.MaxTime-1 <= t.EndTime {
+			if hasSeriesRetentionApplied(meta, t.RequestID) {
+				continue
+			}
+			keys = append(keys, t.RequestID)
+		} else {
+			keys = append(keys, fmt.Sprintf("%s@%d", t.RequestID, t.EndTime))
+		}
+		res = append(res, t)
+	}
+
+	sort.Strings(keys)
+	return res, strings.Join(keys, ",")
+}
+
+// hasSeriesRetentionApplied returns whether the block has been rewritten by the retention tombstone with the
+// input request ID deleting the whole block time range.
+func hasSeriesRetentionApplied(meta *metadata.Meta, requestID string) bool {
+	for _, rewrite := range meta.Thanos.Rewrites {
+		for _, deletion := range rewrite.DeletionsApplied {
+			if deletion.RequestID != requestID {
+				continue
+			}
+			for _, interval := range deletion.Intervals {
+				if interval.Mint <= meta.MinTime && interval.Maxt >= meta.MaxTime-1 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// applySeriesRetention runs the series retention jobs of the tenant owned by this compactor. Each job rewrites
+// a block without the samples older than the retention period of the series retention rules. Downsampled blocks
+// can't be rewritten by the TSDB compactor: their expired samples are filtered out at query time.
+func (c *MultitenantCompactor) applySeriesRetention(ctx context.Context, userID string, userBucket objstore.Bucket, fetcher block.MetadataFetcher, logger log.Logger) error {
+	rules := c.cfgProvider.SeriesRetentionRules(userID)
+	if len(rules) == 0 {
+		delete(c.seriesRetentionChecked, userID)
+		return nil
+	}
+
+	ranges := c.compactorCfg.BlockRanges.ToMilliseconds()
+	var largestRange int64
+	if len(ranges) > 0 {
+		largestRange = ranges[len(ranges)-1]
+	}
+
+	ts, err := seriesRetentionTombstones(rules, time.Now(), largestRange)
+	if err != nil {
+		return errors.Wrap(err, "invalid series retention rules")
+	}
+
+	metas, _, err := fetcher.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch blocks metadata")
+	}
+
+	raw := make([]*metadata.Meta, 0, len(metas))
+	for _, meta := range metas {
+		if meta.Thanos.Downsample.Resolution == 0 {
+			raw = append(raw, meta)
+		}
+	}
+	sortMetasByMinTime(raw)
+
+	// The blocks which are still going to be split or merged are rewritten once compacted.
+	pending := blocksPendingCompaction(userID, raw, ranges, uint32(c.cfgProvider.CompactorSplitAndMergeShards(userID)), uint32(c.cfgProvider.CompactorSplitGroups(userID)))
+
+	jobDir := filepath.Join(c.compactorCfg.DataDir, "series-retention", userID)
+	defer func() {
+		if err := os.RemoveAll(jobDir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove series retention job directory", "path", jobDir, "err", err)
+		}
+	}()
+
+	// Only keep track of the blocks which still exist.
+	checked := c.seriesRetentionChecked[userID]
+	c.seriesRetentionChecked[userID] = map[ulid.ULID]string{}
+
+	for _, meta := range raw {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, ok := pending[meta.ULID]; ok {
+			continue
+		}
+
+		blockTombstones, key := seriesRetentionTombstonesForBlock(meta, ts)
+		if len(blockTombstones) == 0 {
+			continue
+		}
+
+		// The blocks without expired samples aren't rewritten, so they're remembered to avoid downloading
+		// their index again at each compaction.
+		if checked[meta.ULID] == key {
+			c.seriesRetentionChecked[userID][meta.ULID] = key
+			continue
+		}
+
+		if owned, err := c.shardingStrategy.ownJob(newSeriesRetentionJob(userID, meta)); err != nil {
+			return errors.Wrap(err, "check if series retention job is owned")
+		} else if !owned {
+			continue
+		}
+
+		blockLogger := log.With(logger, "block", meta.ULID)
+		ok, reclaimed, err := c.rewriteBlock(ctx, userBucket, meta, blockTombstones, jobDir, blockLogger)
+		if err != nil {
+			return errors.Wrapf(err, "rewrite block %s", meta.ULID)
+		}
+		if !ok {
+			c.seriesRetentionChecked[userID][meta.ULID] = key
+			continue
+		}
+
+		if err := markRewrittenBlockForDeletion(blockLogger, userBucket, meta, "rewritten by series retention rules", c.seriesRetentionBlocksMarkedForDeletion); err != nil {
+			return err
+		}
+
+		c.seriesRetentionBlocksRewritten.Inc()
+		c.seriesRetentionReclaimedBytes.Add(float64(reclaimed))
+		level.Info(blockLogger).Log("msg", "rewritten block to remove the series older than their retention period", "reclaimed_bytes", reclaimed)
+	}
+
+	return nil
+}
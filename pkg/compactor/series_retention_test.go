@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestSeriesRetentionTombstonesForBlock(t *testing.T) {
+	const day = int64(24 * time.Hour / time.Millisecond)
+
+	now := time.UnixMilli(10*day + 5*day/10)
+	ts, err := seriesRetentionTombstones([]validation.SeriesRetentionRule{
+		{Matchers: `{job="debug"}`, Retention: model.Duration(2 * 24 * time.Hour)},
+		{Matchers: `{job="other"}`, Retention: model.Duration(5 * 24 * time.Hour)},
+	}, now, day)
+	require.NoError(t, err)
+
+	// The cut-off times are aligned to the largest compaction range.
+	require.Len(t, ts, 2)
+	assert.Equal(t, 8*day-1, ts[0].EndTime)
+	assert.Equal(t, 5*day-1, ts[1].EndTime)
+
+	newMeta := func(minTime, maxTime int64, applied ...*mimir_tsdb.Tombstone) *metadata.Meta {
+		meta := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MinTime: minTime, MaxTime: maxTime}}
+		for _, t := range applied {
+			meta.Thanos.Rewrites = append(meta.Thanos.Rewrites, metadata.Rewrite{DeletionsApplied: []metadata.DeletionRequest{
+				{RequestID: t.RequestID, Intervals: tombstones.Intervals{{Mint: t.StartTime, Maxt: t.EndTime}}},
+			}})
+		}
+		return meta
+	}
+
+	tests := map[string]struct {
+		meta        *metadata.Meta
+		expected    mimir_tsdb.Tombstones
+		expectedKey string
+	}{
+		"block newer than the cut-off times": {
+			meta: newMeta(8*day, 9*day),
+		},
+		"block older than one cut-off time": {
+			meta:        newMeta(7*day, 8*day),
+			expected:    mimir_tsdb.Tombstones{ts[0]},
+			expectedKey: ts[0].RequestID,
+		},
+		"block older than both cut-off times": {
+			meta:        newMeta(3*day, 4*day),
+			expected:    mimir_tsdb.Tombstones{ts[0], ts[1]},
+			expectedKey: ts[0].RequestID + "," + ts[1].RequestID,
+		},
+		"block older than both cut-off times, with one tombstone already applied": {
+			meta:        newMeta(3*day, 4*day, ts[1]),
+			expected:    mimir_tsdb.Tombstones{ts[0]},
+			expectedKey: ts[0].RequestID,
+		},
+		"block spanning a cut-off time": {
+			meta:        newMeta(7*day, 9*day, ts[0]),
+			expected:    mimir_tsdb.Tombstones{ts[0]},
+			expectedKey: ts[0].RequestID + "@" + "691199999",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, key := seriesRetentionTombstonesForBlock(tc.meta, ts)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.expectedKey, key)
+		})
+	}
+}
+
+func TestMultitenantCompactor_ApplySeriesRetention(t *testing.T) {
+	const userID = "user"
+
+	var (
+		ctx     = context.Background()
+		logger  = log.NewNopLogger()
+		minTime = int64(0)
+		maxTime = 2 * time.Hour.Milliseconds()
+		series  = []labels.Labels{
+			labels.FromStrings(labels.MetricName, "metric", "series", "1"),
+			labels.FromStrings(labels.MetricName, "metric", "series", "2"),
+		}
+	)
+
+	bkt := objstore.NewInMemBucket()
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+
+	// Create and upload a block with two series.
+	blocksDir := t.TempDir()
+	blockID, err := createBlockWithOptions(ctx, blocksDir, series, 10, minTime, maxTime, labels.FromStrings("shard", "1"), 0, false, metadata.NoneFunc)
+	require.NoError(t, err)
+	require.NoError(t, mimir_tsdb.UploadBlock(ctx, logger, userBkt, filepath.Join(blocksDir, blockID.String()), nil))
+
+	tsdbCompactor, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{maxTime - minTime}, nil, nil, true)
+	require.NoError(t, err)
+
+	cfgProvider := newMockConfigProvider()
+	c := &MultitenantCompactor{
+		compactorCfg:                           Config{DataDir: t.TempDir(), BlockRanges: mimir_tsdb.DurationList{2 * time.Hour}},
+		logger:                                 logger,
+		bucketClient:                           bkt,
+		cfgProvider:                            cfgProvider,
+		blocksCompactor:                        tsdbCompactor,
+		shardingStrategy:                       ownAllJobsShardingStrategy{},
+		seriesRetentionBlocksRewritten:         prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesRetentionReclaimedBytes:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesRetentionBlocksMarkedForDeletion: prometheus.NewCounter(prometheus.CounterOpts{}),
+		seriesRetentionChecked:                 map[string]map[ulid.ULID]string{},
+	}
+
+	fetcher, err := block.NewMetaFetcher(logger, 1, userBkt, t.TempDir(), nil, []block.MetadataFilter{NewExcludeMarkedForDeletionFilter(userBkt)})
+	require.NoError(t, err)
+
+	t.Run("rule not matching any series", func(t *testing.T) {
+		cfgProvider.seriesRetentionRules[userID] = []validation.SeriesRetentionRule{{Matchers: `{series="3"}`, Retention: model.Duration(time.Hour)}}
+
+		require.NoError(t, c.applySeriesRetention(ctx, userID, userBkt, fetcher, logger))
+		assert.Equal(t, float64(0), testutil.ToFloat64(c.seriesRetentionBlocksRewritten))
+
+		// The block is remembered, so that it isn't checked again.
+		assert.Contains(t, c.seriesRetentionChecked[userID], blockID)
+	})
+
+	t.Run("rule matching a series of the block", func(t *testing.T) {
+		cfgProvider.seriesRetentionRules[userID] = []validation.SeriesRetentionRule{{Matchers: `{series="1"}`, Retention: model.Duration(time.Hour)}}
+
+		require.NoError(t, c.applySeriesRetention(ctx, userID, userBkt, fetcher, logger))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.seriesRetentionBlocksRewritten))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.seriesRetentionBlocksMarkedForDeletion))
+		assert.Greater(t, testutil.ToFloat64(c.seriesRetentionReclaimedBytes), float64(0))
+
+		exists, err := userBkt.Exists(ctx, path.Join(blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		var newBlockID ulid.ULID
+		require.NoError(t, userBkt.Iter(ctx, "", func(name string) error {
+			if id, ok := block.IsBlockDir(name); ok && id != blockID {
+				newBlockID = id
+			}
+			return nil
+		}))
+		require.NotEqual(t, ulid.ULID{}, newBlockID)
+
+		// The rewritten block only contains the series not expired.
+		blockDir := filepath.Join(t.TempDir(), newBlockID.String())
+		require.NoError(t, block.Download(ctx, logger, userBkt, newBlockID, blockDir))
+		b, err := tsdb.OpenBlock(logger, blockDir, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, b.Close()) })
+
+		q, err := tsdb.NewBlockQuerier(b, minTime, maxTime)
+		require.NoError(t, err)
+		set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "metric"))
+		var actual []labels.Labels
+		for set.Next() {
+			actual = append(actual, set.At().Labels())
+		}
+		require.NoError(t, set.Err())
+		assert.Equal(t, []labels.Labels{series[1]}, actual)
+		require.NoError(t, q.Close())
+
+		// The next run doesn't rewrite the block again.
+		require.NoError(t, c.applySeriesRetention(ctx, userID, userBkt, fetcher, logger))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.seriesRetentionBlocksRewritten))
+		assert.Empty(t, c.seriesRetentionChecked[userID])
+	})
+}
+
+type ownAllJobsShardingStrategy struct{}
+
+func (ownAllJobsShardingStrategy) compactorOwnUser(string) (bool, error)     { return true, nil }
+func (ownAllJobsShardingStrategy) blocksCleanerOwnUser(string) (bool, error) { return true, nil }
+func (ownAllJobsShardingStrategy) ownJob(*Job) (bool, error)                 { return true, nil }
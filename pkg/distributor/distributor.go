@@ -41,9 +41,11 @@ import (
 	"github.com/grafana/dskit/tenant"
 
 	"github.com/grafana/mimir/pkg/distributor/forwarding"
+	"github.com/grafana/mimir/pkg/ingester"
 	ingester_client "github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/costattribution"
 	"github.com/grafana/mimir/pkg/util/globalerror"
 	"github.com/grafana/mimir/pkg/util/httpgrpcutil"
 	util_math "github.com/grafana/mimir/pkg/util/math"
@@ -71,6 +73,15 @@ const (
 
 const (
 	instanceIngestionRateTickInterval = time.Second
+
+	// The cost attributions which haven't received samples for costAttributionIdleTimeout are purged,
+	// to make room for new ones.
+	costAttributionPurgeInterval = time.Minute
+	costAttributionIdleTimeout   = 20 * time.Minute
+
+	// costAttributionReasonInvalidSeries is the reason the samples of series which failed validation
+	// are attributed to. The validation reason of each series isn't tracked by the cost attribution.
+	costAttributionReasonInvalidSeries = "invalid_series"
 )
 
 // Distributor is a storage.SampleAppender and a client.Querier which
@@ -85,6 +96,9 @@ type Distributor struct {
 	limits        *validation.Overrides
 	forwarder     forwarding.Forwarder
 
+	// Tracks the samples received and discarded by cost attribution.
+	costAttribution *costattribution.Tracker
+
 	// The global rate limiter requires a distributors ring to count
 	// the number of healthy instances
 	distributorsLifeCycler *ring.Lifecycler
@@ -179,6 +193,10 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		return errInvalidTenantShardSize
 	}
 
+	if err := cfg.Forwarding.Validate(); err != nil {
+		return err
+	}
+
 	return cfg.HATrackerConfig.Validate()
 }
 
@@ -351,12 +369,20 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		return d.ingestionRate.Rate()
 	})
 
-	d.forwarder = forwarding.NewForwarder(reg, d.cfg.Forwarding)
+	d.forwarder = forwarding.NewForwarder(reg, d.cfg.Forwarding, log)
+
+	d.costAttribution = costattribution.NewTracker("distributor", limits)
+	if reg != nil {
+		reg.MustRegister(d.costAttribution)
+	}
 
 	d.replicationFactor.Set(float64(ingestersRing.ReplicationFactor()))
 	d.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(d.cleanupInactiveUser)
 
 	subservices = append(subservices, d.ingesterPool, d.activeUsers)
+	if d.forwarder != nil {
+		subservices = append(subservices, d.forwarder)
+	}
 	d.subservices, err = services.NewManager(subservices...)
 	if err != nil {
 		return nil, err
@@ -377,6 +403,9 @@ func (d *Distributor) running(ctx context.Context) error {
 	ingestionRateTicker := time.NewTicker(instanceIngestionRateTickInterval)
 	defer ingestionRateTicker.Stop()
 
+	costAttributionPurgeTicker := time.NewTicker(costAttributionPurgeInterval)
+	defer costAttributionPurgeTicker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -385,6 +414,9 @@ func (d *Distributor) running(ctx context.Context) error {
 		case <-ingestionRateTicker.C:
 			d.ingestionRate.Tick()
 
+		case now := <-costAttributionPurgeTicker.C:
+			d.costAttribution.Purge(now.Add(-costAttributionIdleTimeout))
+
 		case err := <-d.subservicesWatcher.Chan():
 			return errors.Wrap(err, "distributor subservice failed")
 		}
@@ -410,6 +442,7 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	}
 
 	validation.DeletePerUserValidationMetrics(userID, d.log)
+	d.costAttribution.RemoveUser(userID)
 }
 
 // Called after distributor is asked to stop via StopAsync.
@@ -434,19 +467,12 @@ func shardByMetricName(userID string, metricName string) uint32 {
 }
 
 func shardByUser(userID string) uint32 {
-	h := ingester_client.HashNew32()
-	h = ingester_client.HashAdd32(h, userID)
-	return h
+	return ingester_client.ShardByUser(userID)
 }
 
 // This function generates different values for different order of same labels.
 func shardByAllLabels(userID string, labels []mimirpb.LabelAdapter) uint32 {
-	h := shardByUser(userID)
-	for _, label := range labels {
-		h = ingester_client.HashAdd32(h, label.Name)
-		h = ingester_client.HashAdd32(h, label.Value)
-	}
-	return h
+	return ingester_client.ShardByAllLabelAdapters(userID, labels)
 }
 
 // Remove the label labelname from a slice of LabelPairs if it exists.
@@ -608,6 +634,16 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	var firstPartialErr error
 	removeReplica := false
 
+	// Native histograms are converted to classic histogram series before any accounting, so that
+	// the resulting series are handled like any other series in the request.
+	var histogramsErr error
+	req.Timeseries, histogramsErr = convertNativeHistograms(d.limits, userID, req.Timeseries, d.limits.NativeHistogramsEnabled(userID))
+	if histogramsErr != nil {
+		// The series labels may be retained by histogramsErr but that's not a problem for this
+		// use case because we format it calling Error() and then we discard it.
+		firstPartialErr = httpgrpc.Errorf(http.StatusBadRequest, histogramsErr.Error())
+	}
+
 	numSamples := 0
 	numExemplars := 0
 	for _, ts := range req.Timeseries {
@@ -630,7 +666,11 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	validatedSamples := 0
 	validatedExemplars := 0
 
-	if d.limits.AcceptHASamples(userID) && len(req.Timeseries) > 0 {
+	// When the samples of HA replicas are deduplicated at sample level by the ingesters, the samples of all the
+	// replicas are accepted, so the HA tracker is not used.
+	haSampleDeduplication := d.limits.HASampleDeduplicationEnabled(userID)
+
+	if !haSampleDeduplication && d.limits.AcceptHASamples(userID) && len(req.Timeseries) > 0 {
 		cluster, replica := findHALabels(d.limits.HAReplicaLabel(userID), d.limits.HAClusterLabel(userID), req.Timeseries[0].Labels)
 		// Make a copy of these, since they may be retained as labels on our metrics, e.g. dedupedSamples.
 		cluster, replica = copyString(cluster), copyString(replica)
@@ -680,6 +720,7 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	}
 
 	forwardingReq := d.forwardingReq(ctx, userID)
+	attributeCost := d.costAttribution.Enabled(userID)
 
 	// For each timeseries, compute a hash to distribute across ingesters;
 	// check each sample and discard if outside limits.
@@ -691,8 +732,9 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 
 		// If we found both the cluster and replica labels, we only want to include the cluster label when
 		// storing series in Mimir. If we kept the replica label we would end up with another series for the same
-		// series we're trying to dedupe when HA tracking moves over to a different replica.
-		if removeReplica {
+		// series we're trying to dedupe when HA tracking moves over to a different replica. The same applies to the
+		// sample-level deduplication, where the samples of all the replicas must be appended to the same series.
+		if removeReplica || haSampleDeduplication {
 			removeLabel(d.limits.HAReplicaLabel(userID), &ts.Labels)
 		}
 
@@ -742,9 +784,16 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 				// use case because we format it calling Error() and then we discard it.
 				firstPartialErr = httpgrpc.Errorf(http.StatusBadRequest, validationErr.Error())
 			}
+			if attributeCost {
+				d.costAttribution.IncrementDiscardedSamples(userID, mimirpb.FromLabelAdaptersToLabels(ts.Labels), costAttributionReasonInvalidSeries, len(ts.Samples), now)
+			}
 			continue
 		}
 
+		if attributeCost {
+			d.costAttribution.IncrementReceivedSamples(userID, mimirpb.FromLabelAdaptersToLabels(ts.Labels), len(ts.Samples), now)
+		}
+
 		seriesKeys = append(seriesKeys, key)
 		validatedTimeseries = append(validatedTimeseries, ts)
 		validatedSamples += len(ts.Samples)
@@ -792,6 +841,11 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 		validation.DiscardedSamples.WithLabelValues(validation.ReasonRateLimited, userID).Add(float64(validatedSamples))
 		validation.DiscardedExemplars.WithLabelValues(validation.ReasonRateLimited, userID).Add(float64(validatedExemplars))
 		validation.DiscardedMetadata.WithLabelValues(validation.ReasonRateLimited, userID).Add(float64(len(validatedMetadata)))
+		if attributeCost {
+			for _, ts := range validatedTimeseries {
+				d.costAttribution.IncrementDiscardedSamples(userID, mimirpb.FromLabelAdaptersToLabels(ts.Labels), validation.ReasonRateLimited, len(ts.Samples), now)
+			}
+		}
 		// Return a 429 here to tell the client it is going too fast.
 		// Client may discard the data or slow down and re-send.
 		// Prometheus v2.26 added a remote-write option 'retry_on_http_429'.
@@ -820,7 +874,7 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	// so set this flag false and pass cleanup() to DoBatch.
 	cleanupInDefer = false
 
-	err = ring.DoBatch(ctx, ring.WriteNoExtend, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
+	err = ring.DoBatch(ctx, ingester.WriteOp, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
 		timeseries := make([]mimirpb.PreallocTimeseries, 0, len(indexes))
 		var metadata []*mimirpb.MetricMetadata
 
@@ -724,13 +724,14 @@ func TestDistributor_PushHAInstances(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
 	for i, tc := range []struct {
-		enableTracker    bool
-		acceptedReplica  string
-		testReplica      string
-		cluster          string
-		samples          int
-		expectedResponse *mimirpb.WriteResponse
-		expectedCode     int32
+		enableTracker         bool
+		haSampleDeduplication bool
+		acceptedReplica       string
+		testReplica           string
+		cluster               string
+		samples               int
+		expectedResponse      *mimirpb.WriteResponse
+		expectedCode          int32
 	}{
 		{
 			enableTracker:    true,
@@ -749,6 +750,16 @@ func TestDistributor_PushHAInstances(t *testing.T) {
 			samples:         5,
 			expectedCode:    202,
 		},
+		// The samples of all the replicas are accepted if they're deduplicated at sample level.
+		{
+			enableTracker:         true,
+			haSampleDeduplication: true,
+			acceptedReplica:       "instance2",
+			testReplica:           "instance0",
+			cluster:               "cluster0",
+			samples:               5,
+			expectedResponse:      emptyResponse,
+		},
 		// If the HA tracker is disabled we should still accept samples that have both labels.
 		{
 			enableTracker:    false,
@@ -774,6 +785,9 @@ func TestDistributor_PushHAInstances(t *testing.T) {
 			flagext.DefaultValues(&limits)
 			limits.AcceptHASamples = true
 			limits.MaxLabelValueLength = 15
+			if tc.haSampleDeduplication {
+				limits.HASampleDeduplicationEnabled = true
+			}
 
 			ds, _, _ := prepare(t, prepConfig{
 				numIngesters:    3,
@@ -1126,10 +1140,11 @@ func TestDistributor_Push_LabelRemoval(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
 	type testcase struct {
-		inputSeries    labels.Labels
-		expectedSeries labels.Labels
-		removeReplica  bool
-		removeLabels   []string
+		inputSeries           labels.Labels
+		expectedSeries        labels.Labels
+		removeReplica         bool
+		haSampleDeduplication bool
+		removeLabels          []string
 	}
 
 	cases := []testcase{
@@ -1162,6 +1177,19 @@ func TestDistributor_Push_LabelRemoval(t *testing.T) {
 				{Name: "cluster", Value: "one"},
 			},
 		},
+		// Remove the replica label only, if the samples of HA replicas are deduplicated at sample level.
+		{
+			haSampleDeduplication: true,
+			inputSeries: labels.Labels{
+				{Name: "__name__", Value: "some_metric"},
+				{Name: "cluster", Value: "one"},
+				{Name: "__replica__", Value: "two"},
+			},
+			expectedSeries: labels.Labels{
+				{Name: "__name__", Value: "some_metric"},
+				{Name: "cluster", Value: "one"},
+			},
+		},
 		// Don't remove any labels.
 		{
 			removeReplica: false,
@@ -1184,6 +1212,9 @@ func TestDistributor_Push_LabelRemoval(t *testing.T) {
 		flagext.DefaultValues(&limits)
 		limits.DropLabels = tc.removeLabels
 		limits.AcceptHASamples = tc.removeReplica
+		if tc.haSampleDeduplication {
+			limits.HASampleDeduplicationEnabled = true
+		}
 
 		ds, ingesters, _ := prepare(t, prepConfig{
 			numIngesters:    2,
@@ -3435,12 +3466,14 @@ outer:
 }
 
 func setMockForwarder(distributor *Distributor, ingest bool) *mockForwarder {
-	forwarder := &mockForwarder{ingest: ingest}
+	forwarder := &mockForwarder{Service: services.NewIdleService(nil, nil), ingest: ingest}
 	distributor.forwarder = forwarder
 	return forwarder
 }
 
 type mockForwarder struct {
+	services.Service
+
 	ingest    bool
 	sendCount atomic.Uint32
 }
@@ -5,16 +5,58 @@ package forwarding
 import (
 	"flag"
 	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidQueueShards          = errors.New("the forwarding queue shards must be greater than 0")
+	errInvalidQueueSegmentSize     = errors.New("the forwarding queue segment size must be greater than 0")
+	errInvalidQueueMaxSize         = errors.New("the forwarding queue max size must be greater than or equal to the segment size")
+	errInvalidQueueBackoffDuration = errors.New("the forwarding queue min backoff must be greater than 0 and less than or equal to the max backoff")
 )
 
 type Config struct {
 	Enabled         bool          `yaml:"enabled" category:"experimental"`
 	RequestTimeout  time.Duration `yaml:"request_timeout" category:"experimental"`
 	PropagateErrors bool          `yaml:"propagate_errors" category:"experimental"`
+
+	QueueDirectory        string        `yaml:"queue_directory" category:"experimental"`
+	QueueMaxSizeBytes     int64         `yaml:"queue_max_size_bytes" category:"experimental"`
+	QueueSegmentSizeBytes int64         `yaml:"queue_segment_size_bytes" category:"experimental"`
+	QueueShards           int           `yaml:"queue_shards" category:"experimental"`
+	QueueMinBackoff       time.Duration `yaml:"queue_min_backoff" category:"experimental"`
+	QueueMaxBackoff       time.Duration `yaml:"queue_max_backoff" category:"experimental"`
 }
 
 func (c *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&c.Enabled, "distributor.forwarding.enabled", false, "Enables the feature to forward certain metrics in remote_write requests, depending on defined rules.")
 	f.DurationVar(&c.RequestTimeout, "distributor.forwarding.request-timeout", 10*time.Second, "Timeout for requests to ingestion endpoints to which we forward metrics.")
 	f.BoolVar(&c.PropagateErrors, "distributor.forwarding.propagate-errors", true, "If disabled then forwarding requests are always considered to be successful, errors are ignored.")
+
+	f.StringVar(&c.QueueDirectory, "distributor.forwarding.queue-directory", "", "Directory where forwarded samples are buffered before being sent to the forwarding endpoints. If set, samples are forwarded asynchronously, retrying with backoff in case of recoverable errors, and errors are never propagated to the client. If empty, samples are forwarded synchronously.")
+	f.Int64Var(&c.QueueMaxSizeBytes, "distributor.forwarding.queue-max-size-bytes", 1<<30, "Maximum size of the buffered samples waiting to be forwarded, per tenant. When the limit is reached, new samples to forward are dropped.")
+	f.Int64Var(&c.QueueSegmentSizeBytes, "distributor.forwarding.queue-segment-size-bytes", 8<<20, "Size of the segment files in which the buffered samples are stored. The disk space of a segment is released once all its samples have been forwarded.")
+	f.IntVar(&c.QueueShards, "distributor.forwarding.queue-shards", 4, "Number of concurrent requests sent to each forwarding endpoint, per tenant. Series are sharded by their labels, so that the samples of a series are always sent in order.")
+	f.DurationVar(&c.QueueMinBackoff, "distributor.forwarding.queue-min-backoff", 100*time.Millisecond, "Minimum backoff period before retrying a forwarding request which failed with a recoverable error.")
+	f.DurationVar(&c.QueueMaxBackoff, "distributor.forwarding.queue-max-backoff", 10*time.Second, "Maximum backoff period before retrying a forwarding request which failed with a recoverable error.")
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled || c.QueueDirectory == "" {
+		return nil
+	}
+	if c.QueueShards <= 0 {
+		return errInvalidQueueShards
+	}
+	if c.QueueSegmentSizeBytes <= 0 {
+		return errInvalidQueueSegmentSize
+	}
+	if c.QueueMaxSizeBytes < c.QueueSegmentSizeBytes {
+		return errInvalidQueueMaxSize
+	}
+	if c.QueueMinBackoff <= 0 || c.QueueMinBackoff > c.QueueMaxBackoff {
+		return errInvalidQueueBackoffDuration
+	}
+	return nil
 }
@@ -13,8 +13,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
+	"github.com/grafana/dskit/services"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -28,6 +30,8 @@ import (
 var errBadEndpointConfiguration = errors.New("bad endpoint configuration")
 
 type Forwarder interface {
+	services.Service
+
 	NewRequest(ctx context.Context, tenant string, rules validation.ForwardingRules) Request
 }
 
@@ -57,76 +61,102 @@ type pools struct {
 }
 
 type forwarder struct {
-	cfg    Config
-	pools  pools
-	client http.Client
+	services.Service
+
+	cfg   Config
+	pools pools
+	sender
+
+	// queue buffers the forwarded samples on disk, it's nil if samples are forwarded synchronously.
+	queue *queue
+
+	requestsTotal prometheus.Counter
+	samplesTotal  prometheus.Counter
+}
+
+// sender sends snappy-compressed remote_write requests to the forwarding endpoints.
+type sender struct {
+	client  http.Client
+	timeout time.Duration
 
-	requestsTotal           prometheus.Counter
 	errorsTotal             *prometheus.CounterVec
-	samplesTotal            prometheus.Counter
 	requestLatencyHistogram prometheus.Histogram
 }
 
 // NewForwarder returns a new forwarder, if forwarding is disabled it returns nil.
-func NewForwarder(reg prometheus.Registerer, cfg Config) Forwarder {
+func NewForwarder(reg prometheus.Registerer, cfg Config, logger log.Logger) Forwarder {
 	if !cfg.Enabled {
 		return nil
 	}
 
-	return &forwarder{
+	f := &forwarder{
 		cfg: cfg,
 		pools: pools{
 			timeseries: sync.Pool{New: func() interface{} { return &[]mimirpb.PreallocTimeseries{} }},
 			protobuf:   sync.Pool{New: func() interface{} { return &[]byte{} }},
 			snappy:     sync.Pool{New: func() interface{} { return &[]byte{} }},
 		},
+		sender: sender{
+			timeout: cfg.RequestTimeout,
+
+			errorsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+				Namespace: "cortex",
+				Name:      "distributor_forward_errors_total",
+				Help:      "The total number of errors that the distributor received from forwarding targets when trying to send samples to them.",
+			}, []string{"status_code"}),
+			requestLatencyHistogram: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+				Namespace: "cortex",
+				Name:      "distributor_forward_requests_latency_seconds",
+				Help:      "The client-side latency of requests to forward metrics made by the Distributor.",
+				Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30},
+			}),
+		},
 
 		requestsTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Namespace: "cortex",
 			Name:      "distributor_forward_requests_total",
 			Help:      "The total number of requests the Distributor made to forward samples.",
 		}),
-		errorsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
-			Namespace: "cortex",
-			Name:      "distributor_forward_errors_total",
-			Help:      "The total number of errors that the distributor received from forwarding targets when trying to send samples to them.",
-		}, []string{"status_code"}),
 		samplesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Namespace: "cortex",
 			Name:      "distributor_forward_samples_total",
 			Help:      "The total number of samples the Distributor forwarded.",
 		}),
-		requestLatencyHistogram: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
-			Namespace: "cortex",
-			Name:      "distributor_forward_requests_latency_seconds",
-			Help:      "The client-side latency of requests to forward metrics made by the Distributor.",
-			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30},
-		}),
 	}
+
+	if cfg.QueueDirectory != "" {
+		f.queue = newQueue(cfg, f.sender.sendToEndpoint, reg, logger)
+		f.Service = services.NewIdleService(f.queue.start, f.queue.stop)
+	} else {
+		f.Service = services.NewIdleService(nil, nil)
+	}
+
+	return f
 }
 
 func (r *forwarder) NewRequest(ctx context.Context, tenant string, rules validation.ForwardingRules) Request {
 	return &request{
 		ctx:    ctx,
-		client: &r.client, // http client should be re-used so open connections get re-used.
+		tenant: tenant,
+		sender: &r.sender, // http client should be re-used so open connections get re-used.
+		queue:  r.queue,
 		pools:  &r.pools,
 
 		tsByEndpoint: make(map[string]*[]mimirpb.PreallocTimeseries),
 
 		rules:           rules,
-		timeout:         r.cfg.RequestTimeout,
-		propagateErrors: r.cfg.PropagateErrors,
+		propagateErrors: r.cfg.PropagateErrors && r.queue == nil,
 
 		requests: r.requestsTotal,
-		errors:   r.errorsTotal,
 		samples:  r.samplesTotal,
-		latency:  r.requestLatencyHistogram,
 	}
 }
 
 type request struct {
 	ctx    context.Context
-	client *http.Client
+	tenant string
+	sender *sender
+	queue  *queue
 	pools  *pools
 
 	tsByEndpoint map[string]*[]mimirpb.PreallocTimeseries
@@ -136,13 +166,10 @@ type request struct {
 	// - where the metrics get forwarded to
 	// - whether the forwarded metrics should also be ingested (sent to ingesters)
 	rules           validation.ForwardingRules
-	timeout         time.Duration
 	propagateErrors bool
 
 	requests prometheus.Counter
-	errors   *prometheus.CounterVec
 	samples  prometheus.Counter
-	latency  prometheus.Histogram
 }
 
 func (r *request) Add(sample mimirpb.PreallocTimeseries) bool {
@@ -204,7 +231,7 @@ func (r *request) Send(ctx context.Context) <-chan error {
 
 			errorsMtx.Lock()
 			defer errorsMtx.Unlock()
-			errorsByEndpoint[endpoint] = r.sendToEndpoint(ctx, endpoint, ts)
+			errorsByEndpoint[endpoint] = r.forwardToEndpoint(ctx, endpoint, ts)
 		}(endpoint, *ts)
 	}
 
@@ -238,9 +265,10 @@ func (r *request) Send(ctx context.Context) <-chan error {
 	return errCh
 }
 
-// sendToEndpoint sends the given timeseries to the given endpoint.
-// All returned errors which are recoverable are of the type recoverableError.
-func (r *request) sendToEndpoint(ctx context.Context, endpoint string, ts []mimirpb.PreallocTimeseries) error {
+// forwardToEndpoint sends the given timeseries to the given endpoint or, if the queue is enabled,
+// appends them to the endpoint's queue. All returned errors which are recoverable are of the type
+// recoverableError.
+func (r *request) forwardToEndpoint(ctx context.Context, endpoint string, ts []mimirpb.PreallocTimeseries) error {
 	protoBufBytes := (*r.pools.protobuf.Get().(*[]byte))[:0]
 	protoBuf := proto.NewBuffer(protoBufBytes)
 	err := protoBuf.Marshal(&mimirpb.WriteRequest{Timeseries: ts})
@@ -254,10 +282,20 @@ func (r *request) sendToEndpoint(ctx context.Context, endpoint string, ts []mimi
 	snappyBuf = snappy.Encode(snappyBuf[:cap(snappyBuf)], protoBufBytes)
 	defer r.pools.snappy.Put(&snappyBuf)
 
-	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	if r.queue != nil {
+		return r.queue.enqueue(r.tenant, endpoint, snappyBuf, countSamples(ts))
+	}
+
+	return r.sender.sendToEndpoint(ctx, endpoint, snappyBuf)
+}
+
+// sendToEndpoint sends the given snappy-compressed remote_write request to the given endpoint.
+// All returned errors which are recoverable are of the type recoverableError.
+func (s *sender) sendToEndpoint(ctx context.Context, endpoint string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(snappyBuf))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
 	if err != nil {
 		// Errors from NewRequest are from unparsable URLs being configured.
 		// Usually configuration errors should lead to recoverable errors (5xx), but this is an exception because we
@@ -270,8 +308,8 @@ func (r *request) sendToEndpoint(ctx context.Context, endpoint string, ts []mimi
 	httpReq.Header.Set("Content-Type", "application/x-protobuf")
 
 	beforeTs := time.Now()
-	httpResp, err := r.client.Do(httpReq)
-	r.latency.Observe(time.Since(beforeTs).Seconds())
+	httpResp, err := s.client.Do(httpReq)
+	s.requestLatencyHistogram.Observe(time.Since(beforeTs).Seconds())
 	if err != nil {
 		// Errors from Client.Do are from (for example) network errors, so are recoverable.
 		return recoverableError{err}
@@ -287,7 +325,7 @@ func (r *request) sendToEndpoint(ctx context.Context, endpoint string, ts []mimi
 		if scanner.Scan() {
 			line = scanner.Text()
 		}
-		r.errors.WithLabelValues(strconv.Itoa(httpResp.StatusCode)).Inc()
+		s.errorsTotal.WithLabelValues(strconv.Itoa(httpResp.StatusCode)).Inc()
 		err := errors.Errorf("server returned HTTP status %s: %s", httpResp.Status, line)
 		if httpResp.StatusCode/100 == 5 || httpResp.StatusCode == http.StatusTooManyRequests {
 			return recoverableError{err}
@@ -298,6 +336,14 @@ func (r *request) sendToEndpoint(ctx context.Context, endpoint string, ts []mimi
 	return nil
 }
 
+func countSamples(ts []mimirpb.PreallocTimeseries) int {
+	count := 0
+	for _, t := range ts {
+		count += len(t.Samples)
+	}
+	return count
+}
+
 // cleanup must be called to return the used buffers to their pools after a request has completed.
 func (r *request) cleanup() {
 	for _, ts := range r.tsByEndpoint {
@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/golang/snappy"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -41,7 +42,7 @@ func TestForwardingSamplesSuccessfully(t *testing.T) {
 	defer close2()
 
 	reg := prometheus.NewPedanticRegistry()
-	forwarder := NewForwarder(reg, testConfig)
+	forwarder := NewForwarder(reg, testConfig, log.NewNopLogger())
 
 	rules := validation.ForwardingRules{
 		"metric1": validation.ForwardingRule{Endpoint: url1, Ingest: false},
@@ -170,7 +171,7 @@ func TestForwardingSamplesWithDifferentErrorsWithPropagation(t *testing.T) {
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
 			reg := prometheus.NewRegistry()
-			forwarder := NewForwarder(reg, tc.config)
+			forwarder := NewForwarder(reg, tc.config, log.NewNopLogger())
 			urls := make([]string, len(tc.remoteStatusCodes))
 			closers := make([]func(), len(tc.remoteStatusCodes))
 			expectedErrorsByStatusCode := make(map[int]int)
@@ -320,7 +321,7 @@ func BenchmarkRemoteWriteForwarding(b *testing.B) {
 		rules[metric] = validation.ForwardingRule{Endpoint: "http://localhost/"}
 	}
 
-	forwarder := NewForwarder(nil, testConfig).(*forwarder)
+	forwarder := NewForwarder(nil, testConfig, log.NewNopLogger()).(*forwarder)
 
 	// No-op client, we don't want the benchmark to be skewed by TCP performance
 	forwarder.client = http.Client{Transport: &noopRoundTripper{}}
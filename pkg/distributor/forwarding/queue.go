@@ -0,0 +1,606 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package forwarding
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+const (
+	// recordHeaderSize is the size of the header of each record stored in a segment: the length
+	// of the record followed by its CRC32 checksum.
+	recordHeaderSize = 8
+
+	reasonQueueFull      = "queue_full"
+	reasonQueueError     = "queue_error"
+	reasonNonRecoverable = "non_recoverable_error"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// queue buffers the samples to forward in per-tenant and per-endpoint on-disk queues, so that they
+// survive temporary outages of the forwarding endpoints without slowing down the ingestion path.
+// Each queue is a sequence of segment files, in which the snappy-compressed remote_write requests
+// are appended. The requests are read back in order and their series are sharded by labels across
+// a fixed number of concurrent senders, which retry with backoff in case of recoverable errors.
+// A segment is deleted once all its requests have been sent, so samples are forwarded at least once.
+type queue struct {
+	cfg    Config
+	send   func(ctx context.Context, endpoint string, body []byte) error
+	logger log.Logger
+
+	mtx        sync.Mutex
+	queues     map[queueKey]*endpointQueue
+	tenantSize map[string]*atomic.Int64
+
+	// ctx is cancelled when the queue is stopped, to stop the queues' goroutines.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	sizeBytes      prometheus.Gauge
+	retriesTotal   prometheus.Counter
+	droppedSamples *prometheus.CounterVec
+}
+
+type queueKey struct {
+	tenant   string
+	endpoint string
+}
+
+func newQueue(cfg Config, send func(ctx context.Context, endpoint string, body []byte) error, reg prometheus.Registerer, logger log.Logger) *queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &queue{
+		cfg:        cfg,
+		send:       send,
+		logger:     logger,
+		queues:     map[queueKey]*endpointQueue{},
+		tenantSize: map[string]*atomic.Int64{},
+		ctx:        ctx,
+		cancel:     cancel,
+
+		sizeBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Namespace: "cortex",
+			Name:      "distributor_forward_queue_size_bytes",
+			Help:      "The size of the forwarding requests buffered on disk which haven't been forwarded yet.",
+		}),
+		retriesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_forward_retries_total",
+			Help:      "The total number of forwarding requests retried after a recoverable error.",
+		}),
+		droppedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_forward_dropped_samples_total",
+			Help:      "The total number of samples which have been dropped instead of being forwarded.",
+		}, []string{"reason"}),
+	}
+}
+
+// start resumes the queues found on disk, left over by a previous run.
+func (q *queue) start(_ context.Context) error {
+	if err := os.MkdirAll(q.cfg.QueueDirectory, os.ModePerm); err != nil {
+		return errors.Wrap(err, "create forwarding queue directory")
+	}
+
+	tenants, err := os.ReadDir(q.cfg.QueueDirectory)
+	if err != nil {
+		return errors.Wrap(err, "read forwarding queue directory")
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for _, tenant := range tenants {
+		if !tenant.IsDir() {
+			continue
+		}
+
+		endpoints, err := os.ReadDir(filepath.Join(q.cfg.QueueDirectory, tenant.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "read forwarding queue directory of tenant %s", tenant.Name())
+		}
+
+		for _, endpointDir := range endpoints {
+			endpoint, err := url.PathUnescape(endpointDir.Name())
+			if !endpointDir.IsDir() || err != nil {
+				continue
+			}
+
+			if _, err := q.getOrCreateQueue(tenant.Name(), endpoint); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// stop stops sending the queued requests. The requests which haven't been sent yet are
+// left on disk, and will be sent again once the queue is restarted.
+func (q *queue) stop(_ error) error {
+	q.cancel()
+	q.wg.Wait()
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for _, eq := range q.queues {
+		eq.close()
+	}
+	return nil
+}
+
+// enqueue appends the snappy-compressed remote_write request to the queue of the tenant and endpoint.
+// If the tenant's queue is full the request is dropped.
+func (q *queue) enqueue(tenant, endpoint string, body []byte, samples int) error {
+	q.mtx.Lock()
+	eq, err := q.getOrCreateQueue(tenant, endpoint)
+	q.mtx.Unlock()
+
+	if err == nil {
+		err = eq.append(body, samples)
+	}
+	if err != nil {
+		q.droppedSamples.WithLabelValues(reasonQueueError).Add(float64(samples))
+		level.Error(q.logger).Log("msg", "failed to enqueue forwarding request", "user", tenant, "endpoint", endpoint, "err", err)
+		return recoverableError{err}
+	}
+	return nil
+}
+
+// getOrCreateQueue must be called with the mtx held.
+func (q *queue) getOrCreateQueue(tenant, endpoint string) (*endpointQueue, error) {
+	key := queueKey{tenant: tenant, endpoint: endpoint}
+	if eq, ok := q.queues[key]; ok {
+		return eq, nil
+	}
+
+	tenantSize, ok := q.tenantSize[tenant]
+	if !ok {
+		tenantSize = atomic.NewInt64(0)
+		q.tenantSize[tenant] = tenantSize
+	}
+
+	dir := filepath.Join(q.cfg.QueueDirectory, tenant, url.PathEscape(endpoint))
+	eq, err := openEndpointQueue(q, dir, tenant, endpoint, tenantSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open forwarding queue of tenant %s and endpoint %s", tenant, endpoint)
+	}
+	q.queues[key] = eq
+
+	q.wg.Add(1 + q.cfg.QueueShards)
+	go func() {
+		defer q.wg.Done()
+		eq.read(q.ctx)
+	}()
+	for _, shard := range eq.shards {
+		go func(shard chan shardRequest) {
+			defer q.wg.Done()
+			eq.runShard(q.ctx, shard)
+		}(shard)
+	}
+
+	return eq, nil
+}
+
+// endpointQueue is the queue of the requests to forward to an endpoint, for a tenant.
+type endpointQueue struct {
+	parent     *queue
+	dir        string
+	tenant     string
+	endpoint   string
+	tenantSize *atomic.Int64
+	logger     log.Logger
+
+	// notify is signalled every time a record is appended.
+	notify chan struct{}
+	shards []chan shardRequest
+
+	mtx sync.Mutex
+	// segments are sorted by index, the last one is the head segment to which records are appended.
+	segments []*segment
+	head     *os.File
+}
+
+type segment struct {
+	index int
+	path  string
+	size  int64
+	// pending is the number of records read from the segment which haven't been completed yet.
+	pending int
+	// readDone is true once all the records of the segment have been read.
+	readDone bool
+}
+
+// record is a request read from a segment, whose series may be sent by multiple shards.
+type record struct {
+	segment *segment
+	size    int64
+	// pending is the number of shard requests of the record which haven't been completed yet.
+	pending int
+}
+
+type shardRequest struct {
+	record  *record
+	req     *mimirpb.WriteRequest
+	samples int
+}
+
+func openEndpointQueue(parent *queue, dir, tenant, endpoint string, tenantSize *atomic.Int64) (*endpointQueue, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	eq := &endpointQueue{
+		parent:     parent,
+		dir:        dir,
+		tenant:     tenant,
+		endpoint:   endpoint,
+		tenantSize: tenantSize,
+		logger:     log.With(parent.logger, "user", tenant, "endpoint", endpoint),
+		notify:     make(chan struct{}, 1),
+		shards:     make([]chan shardRequest, parent.cfg.QueueShards),
+	}
+	for i := range eq.shards {
+		eq.shards[i] = make(chan shardRequest)
+	}
+
+	// Resume the segments left over by a previous run.
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		index, err := strconv.Atoi(f.Name())
+		if f.IsDir() || err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		eq.segments = append(eq.segments, &segment{index: index, path: filepath.Join(dir, f.Name()), size: info.Size()})
+		eq.addSize(info.Size())
+	}
+	sort.Slice(eq.segments, func(i, j int) bool { return eq.segments[i].index < eq.segments[j].index })
+
+	// Records are never appended to a segment of a previous run, since it may end with a partially written record.
+	nextIndex := 0
+	if len(eq.segments) > 0 {
+		nextIndex = eq.segments[len(eq.segments)-1].index + 1
+	}
+	if err := eq.createHeadSegment(nextIndex); err != nil {
+		return nil, err
+	}
+
+	return eq, nil
+}
+
+// createHeadSegment must be called with the mtx held, if the queue is already in use.
+func (eq *endpointQueue) createHeadSegment(index int) error {
+	path := filepath.Join(eq.dir, fmt.Sprintf("%08d", index))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+
+	eq.head = f
+	eq.segments = append(eq.segments, &segment{index: index, path: path})
+	return nil
+}
+
+func (eq *endpointQueue) append(body []byte, samples int) error {
+	recordSize := int64(recordHeaderSize + len(body))
+	if eq.tenantSize.Load()+recordSize > eq.parent.cfg.QueueMaxSizeBytes {
+		eq.parent.droppedSamples.WithLabelValues(reasonQueueFull).Add(float64(samples))
+		return nil
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(body, castagnoliTable))
+	copy(record[recordHeaderSize:], body)
+
+	eq.mtx.Lock()
+	defer eq.mtx.Unlock()
+
+	if eq.head == nil {
+		return errors.New("queue is closed")
+	}
+
+	head := eq.segments[len(eq.segments)-1]
+	if _, err := eq.head.Write(record); err != nil {
+		return err
+	}
+	head.size += recordSize
+	eq.addSize(recordSize)
+
+	if head.size >= eq.parent.cfg.QueueSegmentSizeBytes {
+		if err := eq.head.Close(); err != nil {
+			level.Warn(eq.logger).Log("msg", "failed to close forwarding queue segment", "segment", head.path, "err", err)
+		}
+		eq.head = nil
+		if err := eq.createHeadSegment(head.index + 1); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case eq.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// read reads the records of the queue in order, dispatching their series to the shards.
+func (eq *endpointQueue) read(ctx context.Context) {
+	for ctx.Err() == nil {
+		eq.mtx.Lock()
+		var next *segment
+		for _, s := range eq.segments {
+			if !s.readDone {
+				next = s
+				break
+			}
+		}
+		eq.mtx.Unlock()
+
+		if next == nil {
+			// The queue has been closed.
+			return
+		}
+
+		if offset, err := eq.readSegment(ctx, next); err != nil {
+			level.Error(eq.logger).Log("msg", "failed to read forwarding queue segment, skipping the rest of it", "segment", next.path, "err", err)
+			eq.mtx.Lock()
+			eq.addSize(offset - next.size)
+			eq.mtx.Unlock()
+		}
+
+		eq.mtx.Lock()
+		if ctx.Err() == nil {
+			next.readDone = true
+			eq.maybeRemoveSegment(next)
+		}
+		eq.mtx.Unlock()
+	}
+}
+
+// readSegment dispatches the records of the segment, until the segment has been completely written
+// and read or the context is cancelled. It returns the offset of the first record which hasn't been read.
+func (eq *endpointQueue) readSegment(ctx context.Context, s *segment) (offset int64, _ error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	header := make([]byte, recordHeaderSize)
+	for {
+		// The size and whether the segment is still the head must be checked together, because once
+		// the segment is no longer the head its size can't change anymore.
+		eq.mtx.Lock()
+		size := s.size
+		isHead := eq.head != nil && eq.segments[len(eq.segments)-1] == s
+		eq.mtx.Unlock()
+
+		if offset >= size {
+			if !isHead {
+				return offset, nil
+			}
+
+			select {
+			case <-eq.notify:
+				continue
+			case <-ctx.Done():
+				return offset, nil
+			}
+		}
+
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return offset, errors.Wrap(err, "read record header")
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if offset+recordHeaderSize+length > size {
+			return offset, io.ErrUnexpectedEOF
+		}
+
+		body := make([]byte, length)
+		if _, err := f.ReadAt(body, offset+recordHeaderSize); err != nil {
+			return offset, errors.Wrap(err, "read record")
+		}
+		if crc32.Checksum(body, castagnoliTable) != binary.BigEndian.Uint32(header[4:8]) {
+			return offset, errors.New("record checksum mismatch")
+		}
+		offset += recordHeaderSize + length
+
+		rec := &record{segment: s, size: recordHeaderSize + length}
+		if err := eq.dispatch(ctx, rec, body); err != nil {
+			level.Warn(eq.logger).Log("msg", "failed to decode forwarding request, dropping it", "segment", s.path, "err", err)
+			eq.mtx.Lock()
+			eq.addSize(-rec.size)
+			eq.mtx.Unlock()
+		}
+	}
+}
+
+// dispatch decodes the request and sends its series to the shards, sharding them by labels so
+// that the samples of a series are always sent in order.
+func (eq *endpointQueue) dispatch(ctx context.Context, rec *record, body []byte) error {
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return err
+	}
+	var req mimirpb.WriteRequest
+	if err := req.Unmarshal(decoded); err != nil {
+		return err
+	}
+
+	shardReqs := make([]*shardRequest, len(eq.shards))
+	for _, ts := range req.Timeseries {
+		shard := mimirpb.FromLabelAdaptersToLabels(ts.Labels).Hash() % uint64(len(eq.shards))
+		if shardReqs[shard] == nil {
+			shardReqs[shard] = &shardRequest{record: rec, req: &mimirpb.WriteRequest{}}
+		}
+		shardReqs[shard].req.Timeseries = append(shardReqs[shard].req.Timeseries, ts)
+		shardReqs[shard].samples += len(ts.Samples)
+	}
+
+	// All the shard requests must be counted before dispatching them, because they may complete concurrently.
+	eq.mtx.Lock()
+	for _, shardReq := range shardReqs {
+		if shardReq != nil {
+			rec.pending++
+		}
+	}
+	if rec.pending == 0 {
+		eq.addSize(-rec.size)
+	} else {
+		rec.segment.pending++
+	}
+	eq.mtx.Unlock()
+
+	for i, shardReq := range shardReqs {
+		if shardReq == nil {
+			continue
+		}
+
+		select {
+		case eq.shards[i] <- *shardReq:
+		case <-ctx.Done():
+			// The segment won't be removed, so there's no need to keep track of the pending requests.
+			return nil
+		}
+	}
+	return nil
+}
+
+// runShard sends the requests of a shard one at a time, retrying the recoverable errors with backoff.
+func (eq *endpointQueue) runShard(ctx context.Context, shard chan shardRequest) {
+	for {
+		select {
+		case shardReq := <-shard:
+			if !eq.sendWithRetries(ctx, shardReq) {
+				return
+			}
+
+			eq.mtx.Lock()
+			eq.completeShardRequest(shardReq)
+			eq.mtx.Unlock()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendWithRetries returns false if the request couldn't be completed because the context has been cancelled.
+func (eq *endpointQueue) sendWithRetries(ctx context.Context, shardReq shardRequest) bool {
+	data, err := shardReq.req.Marshal()
+	if err != nil {
+		eq.parent.droppedSamples.WithLabelValues(reasonQueueError).Add(float64(shardReq.samples))
+		level.Warn(eq.logger).Log("msg", "failed to encode forwarding request, dropping it", "err", err)
+		return true
+	}
+	body := snappy.Encode(nil, data)
+
+	boff := backoff.New(ctx, backoff.Config{
+		MinBackoff: eq.parent.cfg.QueueMinBackoff,
+		MaxBackoff: eq.parent.cfg.QueueMaxBackoff,
+	})
+	for boff.Ongoing() {
+		err := eq.parent.send(ctx, eq.endpoint, body)
+		if err == nil {
+			return true
+		}
+
+		if !errors.As(err, &recoverableError{}) {
+			eq.parent.droppedSamples.WithLabelValues(reasonNonRecoverable).Add(float64(shardReq.samples))
+			level.Warn(eq.logger).Log("msg", "forwarding request failed with a non-recoverable error, dropping it", "err", err)
+			return true
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+		eq.parent.retriesTotal.Inc()
+		level.Debug(eq.logger).Log("msg", "forwarding request failed with a recoverable error, retrying", "err", err)
+		boff.Wait()
+	}
+
+	return false
+}
+
+// completeShardRequest must be called with the mtx held.
+func (eq *endpointQueue) completeShardRequest(shardReq shardRequest) {
+	rec := shardReq.record
+	rec.pending--
+	if rec.pending > 0 {
+		return
+	}
+
+	eq.addSize(-rec.size)
+	rec.segment.pending--
+	eq.maybeRemoveSegment(rec.segment)
+}
+
+// maybeRemoveSegment removes the segment if all its requests have been completed.
+// It must be called with the mtx held.
+func (eq *endpointQueue) maybeRemoveSegment(s *segment) {
+	if !s.readDone || s.pending > 0 {
+		return
+	}
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		level.Warn(eq.logger).Log("msg", "failed to remove forwarding queue segment", "segment", s.path, "err", err)
+	}
+
+	for i, other := range eq.segments {
+		if other == s {
+			eq.segments = append(eq.segments[:i], eq.segments[i+1:]...)
+			break
+		}
+	}
+}
+
+// addSize updates the size of the records which haven't been completed yet.
+func (eq *endpointQueue) addSize(delta int64) {
+	eq.tenantSize.Add(delta)
+	eq.parent.sizeBytes.Add(float64(delta))
+}
+
+// close must be called once the queue's goroutines have stopped.
+func (eq *endpointQueue) close() {
+	eq.mtx.Lock()
+	defer eq.mtx.Unlock()
+
+	if eq.head != nil {
+		if err := eq.head.Close(); err != nil {
+			level.Warn(eq.logger).Log("msg", "failed to close forwarding queue segment", "err", err)
+		}
+		eq.head = nil
+	}
+}
@@ -0,0 +1,247 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package forwarding
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func newTestQueueConfig(t *testing.T) Config {
+	cfg := testConfig
+	cfg.QueueDirectory = t.TempDir()
+	cfg.QueueMaxSizeBytes = 1 << 20
+	cfg.QueueSegmentSizeBytes = 1 << 10
+	cfg.QueueShards = 2
+	cfg.QueueMinBackoff = time.Millisecond
+	cfg.QueueMaxBackoff = 10 * time.Millisecond
+	return cfg
+}
+
+func TestQueueRetriesRecoverableErrors(t *testing.T) {
+	const tenant = "tenant"
+	now := time.Now().UnixMilli()
+
+	status := atomic.NewInt32(http.StatusServiceUnavailable)
+	url, received := newTestQueueServer(t, status)
+
+	reg := prometheus.NewPedanticRegistry()
+	f := startTestForwarder(t, reg, newTestQueueConfig(t))
+
+	rules := validation.ForwardingRules{"metric": validation.ForwardingRule{Endpoint: url}}
+	for i := 0; i < 10; i++ {
+		req := f.NewRequest(context.Background(), tenant, rules)
+		require.False(t, req.Add(newSample(t, now+int64(i), float64(i), "__name__", "metric", "series", string(rune('a'+i%3)))))
+		// Errors are never propagated when the queue is enabled, the requests are retried instead.
+		require.NoError(t, <-req.Send(context.Background()))
+	}
+
+	test.Poll(t, time.Second, true, func() interface{} {
+		return testutil.ToFloat64(f.(*forwarder).queue.retriesTotal) > 0
+	})
+	status.Store(http.StatusOK)
+
+	test.Poll(t, 5*time.Second, 10, func() interface{} {
+		return received.samples()
+	})
+
+	// The samples of each series are received in order, even if they are sent by multiple shards.
+	for series, samples := range received.bySeries() {
+		for i := 1; i < len(samples); i++ {
+			assert.Less(t, samples[i-1].TimestampMs, samples[i].TimestampMs, series)
+		}
+	}
+
+	test.Poll(t, time.Second, 0.0, func() interface{} {
+		return testutil.ToFloat64(f.(*forwarder).queue.sizeBytes)
+	})
+}
+
+func TestQueueResumesAfterRestart(t *testing.T) {
+	const tenant = "tenant"
+	now := time.Now().UnixMilli()
+
+	status := atomic.NewInt32(http.StatusInternalServerError)
+	url, received := newTestQueueServer(t, status)
+
+	cfg := newTestQueueConfig(t)
+	rules := validation.ForwardingRules{"metric": validation.ForwardingRule{Endpoint: url}}
+
+	f := startTestForwarder(t, prometheus.NewPedanticRegistry(), cfg)
+	for i := 0; i < 5; i++ {
+		req := f.NewRequest(context.Background(), tenant, rules)
+		req.Add(newSample(t, now+int64(i), float64(i), "__name__", "metric"))
+		require.NoError(t, <-req.Send(context.Background()))
+	}
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), f))
+	assert.Equal(t, 0, received.samples())
+
+	// The queued samples are sent once the forwarder is restarted.
+	status.Store(http.StatusOK)
+	startTestForwarder(t, prometheus.NewPedanticRegistry(), cfg)
+
+	test.Poll(t, 5*time.Second, 5, func() interface{} {
+		return received.samples()
+	})
+}
+
+func TestQueueDropsSamples(t *testing.T) {
+	const tenant = "tenant"
+	now := time.Now().UnixMilli()
+
+	t.Run("queue full", func(t *testing.T) {
+		url, _ := newTestQueueServer(t, atomic.NewInt32(http.StatusServiceUnavailable))
+
+		cfg := newTestQueueConfig(t)
+		cfg.QueueMaxSizeBytes = cfg.QueueSegmentSizeBytes
+		reg := prometheus.NewPedanticRegistry()
+		f := startTestForwarder(t, reg, cfg)
+
+		rules := validation.ForwardingRules{"metric": validation.ForwardingRule{Endpoint: url}}
+		for i := 0; i < 100; i++ {
+			req := f.NewRequest(context.Background(), tenant, rules)
+			req.Add(newSample(t, now+int64(i), float64(i), "__name__", "metric", "label", strings.Repeat("x", 100)))
+			require.NoError(t, <-req.Send(context.Background()))
+		}
+
+		dropped := testutil.ToFloat64(f.(*forwarder).queue.droppedSamples.WithLabelValues(reasonQueueFull))
+		assert.Greater(t, dropped, 0.0)
+		assert.LessOrEqual(t, testutil.ToFloat64(f.(*forwarder).queue.sizeBytes), float64(cfg.QueueMaxSizeBytes))
+	})
+
+	t.Run("non-recoverable error", func(t *testing.T) {
+		url, _ := newTestQueueServer(t, atomic.NewInt32(http.StatusBadRequest))
+
+		reg := prometheus.NewPedanticRegistry()
+		f := startTestForwarder(t, reg, newTestQueueConfig(t))
+
+		rules := validation.ForwardingRules{"metric": validation.ForwardingRule{Endpoint: url}}
+		req := f.NewRequest(context.Background(), tenant, rules)
+		req.Add(newSample(t, now, 1, "__name__", "metric"))
+		require.NoError(t, <-req.Send(context.Background()))
+
+		test.Poll(t, time.Second, 1.0, func() interface{} {
+			return testutil.ToFloat64(f.(*forwarder).queue.droppedSamples.WithLabelValues(reasonNonRecoverable))
+		})
+		assert.Equal(t, 0.0, testutil.ToFloat64(f.(*forwarder).queue.retriesTotal))
+
+		// The segment is removed once all its requests have been completed.
+		test.Poll(t, time.Second, 0.0, func() interface{} {
+			return testutil.ToFloat64(f.(*forwarder).queue.sizeBytes)
+		})
+	})
+}
+
+func TestQueueSegments(t *testing.T) {
+	const tenant = "tenant"
+	now := time.Now().UnixMilli()
+
+	status := atomic.NewInt32(http.StatusServiceUnavailable)
+	url, received := newTestQueueServer(t, status)
+
+	cfg := newTestQueueConfig(t)
+	f := startTestForwarder(t, prometheus.NewPedanticRegistry(), cfg)
+
+	rules := validation.ForwardingRules{"metric": validation.ForwardingRule{Endpoint: url}}
+	for i := 0; i < 50; i++ {
+		req := f.NewRequest(context.Background(), tenant, rules)
+		req.Add(newSample(t, now+int64(i), float64(i), "__name__", "metric", "label", strings.Repeat("x", 100)))
+		require.NoError(t, <-req.Send(context.Background()))
+	}
+
+	segments, err := filepath.Glob(filepath.Join(cfg.QueueDirectory, tenant, "*", "*"))
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+
+	status.Store(http.StatusOK)
+	test.Poll(t, 5*time.Second, 50, func() interface{} {
+		return received.samples()
+	})
+
+	// Only the head segment is left once all samples have been forwarded.
+	test.Poll(t, time.Second, 1, func() interface{} {
+		segments, err := filepath.Glob(filepath.Join(cfg.QueueDirectory, tenant, "*", "*"))
+		require.NoError(t, err)
+		return len(segments)
+	})
+	info, err := os.Stat(segments[len(segments)-1])
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), cfg.QueueSegmentSizeBytes)
+}
+
+func startTestForwarder(t *testing.T, reg prometheus.Registerer, cfg Config) Forwarder {
+	forwarder := NewForwarder(reg, cfg, log.NewNopLogger())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), forwarder))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), forwarder)
+	})
+	return forwarder
+}
+
+type receivedSamples struct {
+	mtx    sync.Mutex
+	series map[string][]mimirpb.Sample
+}
+
+func (r *receivedSamples) samples() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	count := 0
+	for _, samples := range r.series {
+		count += len(samples)
+	}
+	return count
+}
+
+func (r *receivedSamples) bySeries() map[string][]mimirpb.Sample {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.series
+}
+
+// newTestQueueServer returns a server which replies with the given status, recording the samples
+// received successfully.
+func newTestQueueServer(t *testing.T, status *atomic.Int32) (string, *receivedSamples) {
+	received := &receivedSamples{series: map[string][]mimirpb.Sample{}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code := int(status.Load())
+		if code/100 == 2 {
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			writeReq := decodeBody(t, body)
+
+			received.mtx.Lock()
+			for _, ts := range writeReq.Timeseries {
+				series := mimirpb.FromLabelAdaptersToLabels(ts.Labels).String()
+				received.series[series] = append(received.series[series], ts.Samples...)
+			}
+			received.mtx.Unlock()
+		}
+		http.Error(w, "", code)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, received
+}
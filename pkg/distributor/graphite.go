@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/weaveworks/common/middleware"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/push"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// GraphiteMappingRulesProvider provides the per-tenant rules mapping Graphite paths to metric names and labels.
+type GraphiteMappingRulesProvider interface {
+	GraphiteMappingRules(userID string) []validation.GraphiteMappingRule
+}
+
+// GraphiteHandler is a http.Handler which accepts metrics encoded in the Graphite plaintext protocol,
+// translates them into a WriteRequest and forwards them to push. Graphite paths are mapped to metric
+// names and labels using the tenant's mapping rules, and tags of tagged series are added as labels.
+func GraphiteHandler(
+	maxRecvMsgSize int,
+	sourceIPs *middleware.SourceIPExtractor,
+	limits GraphiteMappingRulesProvider,
+	pushFunc push.Func,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, logger := pushRequestContext(r, sourceIPs)
+
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		body, err := readPushRequestBody(r, maxRecvMsgSize)
+		if err != nil {
+			err = errors.Wrap(err, "read Graphite request body")
+			level.Error(logger).Log("err", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		series, invalidLines, firstErr := parseGraphitePlaintext(body, limits.GraphiteMappingRules(userID), time.Now().UnixMilli())
+		if invalidLines > 0 {
+			validation.DiscardedSamples.WithLabelValues(validation.ReasonGraphiteInvalidLine, userID).Add(float64(invalidLines))
+		}
+
+		if !pushParsedTimeseries(ctx, w, logger, series, firstErr, pushFunc) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// parseGraphitePlaintext translates the lines of a Graphite plaintext payload into series, returning
+// the number of invalid lines and the error of the first one. Lines without timestamp, or with
+// timestamp -1, get nowMs. Invalid lines are skipped, so that the valid ones can still be ingested.
+func parseGraphitePlaintext(body []byte, rules []validation.GraphiteMappingRule, nowMs int64) (_ []mimirpb.PreallocTimeseries, invalidLines int, firstErr error) {
+	builder := newTimeseriesBuilder()
+	lineNum := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if err := parseGraphiteLine(line, rules, nowMs, builder.add); err != nil {
+			invalidLines++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid Graphite plaintext at line %d: %w", lineNum, err)
+			}
+		}
+	}
+
+	return builder.build(), invalidLines, firstErr
+}
+
+// parseGraphiteLine parses a single line, in the format:
+//
+//	path[;tag=value...] value [timestamp]
+//
+// where the timestamp is in seconds.
+func parseGraphiteLine(line string, rules []validation.GraphiteMappingRule, nowMs int64, appendSample appendSampleFunc) error {
+	parts := strings.Fields(line)
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("expected 2 or 3 fields, got %d", len(parts))
+	}
+
+	value, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q", parts[1])
+	}
+
+	timestampMs := nowMs
+	if len(parts) == 3 && parts[2] != "-1" {
+		ts, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", parts[2])
+		}
+		timestampMs = int64(ts * float64(time.Second/time.Millisecond))
+	}
+
+	lbls, err := graphitePathToLabels(parts[0], rules)
+	if err != nil {
+		return err
+	}
+
+	appendSample(lbls, mimirpb.Sample{TimestampMs: timestampMs, Value: value}, nil)
+	return nil
+}
+
+// graphitePathToLabels maps a Graphite path, optionally tagged, to the series labels using the first
+// matching rule. If no rule matches, the metric name is the path with dots replaced by underscores.
+func graphitePathToLabels(graphitePath string, rules []validation.GraphiteMappingRule) (labels.Labels, error) {
+	tags := strings.Split(graphitePath, ";")
+	name := tags[0]
+	if name == "" {
+		return nil, errors.New("missing metric path")
+	}
+
+	builder := labels.NewBuilder(nil)
+	for _, tag := range tags[1:] {
+		idx := strings.IndexByte(tag, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("tag %q is not in the key=value format", tag)
+		}
+		builder.Set(sanitizeLabelName(tag[:idx]), tag[idx+1:])
+	}
+
+	metricName := strings.ReplaceAll(name, ".", "_")
+	for _, rule := range rules {
+		captures, ok := graphiteGlobMatch(rule.Match, name)
+		if !ok {
+			continue
+		}
+
+		expand := func(s string) string {
+			return os.Expand(s, func(key string) string {
+				if n, err := strconv.Atoi(key); err == nil && n > 0 && n <= len(captures) {
+					return captures[n-1]
+				}
+				return ""
+			})
+		}
+		metricName = expand(rule.Name)
+		for labelName, labelValue := range rule.Labels {
+			builder.Set(sanitizeLabelName(labelName), expand(labelValue))
+		}
+		break
+	}
+
+	builder.Set(labels.MetricName, sanitizeMetricName(metricName))
+	return builder.Labels(), nil
+}
+
+// graphiteGlobMatch matches the path against the glob pattern, where each "*" matches any sequence
+// of characters within a single path node, returning the sequences matched by the wildcards.
+func graphiteGlobMatch(pattern, graphitePath string) ([]string, bool) {
+	if pattern == "" {
+		return nil, false
+	}
+	return graphiteGlobMatchFrom(pattern, graphitePath, nil)
+}
+
+func graphiteGlobMatchFrom(pattern, graphitePath string, captures []string) ([]string, bool) {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			for i := 0; i <= len(graphitePath); i++ {
+				if i > 0 && graphitePath[i-1] == '.' {
+					break
+				}
+				if result, ok := graphiteGlobMatchFrom(pattern[1:], graphitePath[i:], append(captures, graphitePath[:i])); ok {
+					return result, true
+				}
+			}
+			return nil, false
+		}
+
+		if len(graphitePath) == 0 || graphitePath[0] != pattern[0] {
+			return nil, false
+		}
+		pattern, graphitePath = pattern[1:], graphitePath[1:]
+	}
+
+	return captures, len(graphitePath) == 0
+}
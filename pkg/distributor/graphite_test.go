@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type graphiteMappingRulesMock []validation.GraphiteMappingRule
+
+func (m graphiteMappingRulesMock) GraphiteMappingRules(string) []validation.GraphiteMappingRule {
+	return m
+}
+
+func TestGraphiteHandler(t *testing.T) {
+	const userID = "graphite-user"
+
+	rules := graphiteMappingRulesMock{
+		{Match: "servers.*.cpu.*", Name: "cpu_$2", Labels: map[string]string{"host": "$1"}},
+		{Match: "servers.*.disk-*.free", Name: "disk_free", Labels: map[string]string{"host": "$1", "disk": "$2"}},
+	}
+	body := strings.Join([]string{
+		"servers.host-1.cpu.user 10 1",
+		"servers.host-1.cpu.user 12 2",
+		"servers.host-2.disk-sda.free 100 1",
+		"app.requests.count;env=prod;region=eu 5 1",
+		"app.requests.count 6 -1",
+		"invalid_line",
+		"app.requests.count abc 1",
+	}, "\n")
+
+	httpReq := httptest.NewRequest("POST", "/api/v1/push/graphite", strings.NewReader(body))
+	httpReq = httpReq.WithContext(user.InjectOrgID(httpReq.Context(), userID))
+
+	var pushed map[string][]mimirpb.Sample
+	pushFunc := func(ctx context.Context, req *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+		defer cleanup()
+		pushed = map[string][]mimirpb.Sample{}
+		for _, ts := range req.Timeseries {
+			pushed[mimirpb.FromLabelAdaptersToLabels(ts.Labels).String()] = ts.Samples
+		}
+		return &mimirpb.WriteResponse{}, nil
+	}
+
+	resp := httptest.NewRecorder()
+	GraphiteHandler(100000, nil, rules, pushFunc).ServeHTTP(resp, httpReq)
+
+	// Valid lines are ingested, but invalid ones are reported back to the client.
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "line 6")
+	assert.Equal(t, float64(2), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.ReasonGraphiteInvalidLine, userID)))
+
+	require.Len(t, pushed, 4)
+	assert.Equal(t, []mimirpb.Sample{{TimestampMs: 1000, Value: 10}, {TimestampMs: 2000, Value: 12}}, pushed[`{__name__="cpu_user", host="host-1"}`])
+	assert.Equal(t, []mimirpb.Sample{{TimestampMs: 1000, Value: 100}}, pushed[`{__name__="disk_free", disk="sda", host="host-2"}`])
+	assert.Equal(t, []mimirpb.Sample{{TimestampMs: 1000, Value: 5}}, pushed[`{__name__="app_requests_count", env="prod", region="eu"}`])
+	require.Len(t, pushed[`{__name__="app_requests_count"}`], 1)
+	assert.Equal(t, 6.0, pushed[`{__name__="app_requests_count"}`][0].Value)
+}
+
+func TestGraphiteGlobMatch(t *testing.T) {
+	tests := map[string]struct {
+		pattern, path    string
+		expectedMatch    bool
+		expectedCaptures []string
+	}{
+		"exact match": {
+			pattern:       "a.b.c",
+			path:          "a.b.c",
+			expectedMatch: true,
+		},
+		"wildcard nodes": {
+			pattern:          "a.*.c.*",
+			path:             "a.b.c.d",
+			expectedMatch:    true,
+			expectedCaptures: []string{"b", "d"},
+		},
+		"partial wildcard node": {
+			pattern:          "a.b-*",
+			path:             "a.b-1",
+			expectedMatch:    true,
+			expectedCaptures: []string{"1"},
+		},
+		"multiple wildcards in a node": {
+			pattern:          "a.*-*",
+			path:             "a.b-c-d",
+			expectedMatch:    true,
+			expectedCaptures: []string{"b", "c-d"},
+		},
+		"wildcard doesn't match multiple nodes": {
+			pattern: "a.*",
+			path:    "a.b.c",
+		},
+		"different node": {
+			pattern: "a.*.d",
+			path:    "a.b.c",
+		},
+		"empty pattern": {
+			pattern: "",
+			path:    "a",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			captures, ok := graphiteGlobMatch(tc.pattern, tc.path)
+			assert.Equal(t, tc.expectedMatch, ok)
+			assert.Equal(t, tc.expectedCaptures, captures)
+		})
+	}
+}
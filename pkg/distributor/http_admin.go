@@ -62,3 +62,8 @@ func (d *Distributor) AllUserStatsHandler(w http.ResponseWriter, r *http.Request
 		ReplicationFactor: d.ingestersRing.ReplicationFactor(),
 	}, ingesterStatsPageTemplate, r)
 }
+
+// CostAttributionHandler returns the samples received and discarded by the distributor, by cost attribution.
+func (d *Distributor) CostAttributionHandler(w http.ResponseWriter, r *http.Request) {
+	d.costAttribution.ServeHTTP(w, r)
+}
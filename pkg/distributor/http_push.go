@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/middleware"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/push"
+)
+
+// pushRequestContext returns the context and logger to use for a push request, including
+// the request source IPs if sourceIPs is configured.
+func pushRequestContext(r *http.Request, sourceIPs *middleware.SourceIPExtractor) (context.Context, log.Logger) {
+	ctx := r.Context()
+	logger := util_log.WithContext(ctx, util_log.Logger)
+	if sourceIPs != nil {
+		source := sourceIPs.Get(r)
+		if source != "" {
+			ctx = util.AddSourceIPsToOutgoingContext(ctx, source)
+			logger = util_log.WithSourceIPs(source, logger)
+		}
+	}
+	return ctx, logger
+}
+
+// readPushRequestBody reads the body of a push request, optionally gzip compressed, and returns
+// an error if it's larger than maxRecvMsgSize once decompressed.
+func readPushRequestBody(r *http.Request, maxRecvMsgSize int) ([]byte, error) {
+	if r.ContentLength > int64(maxRecvMsgSize) {
+		return nil, fmt.Errorf("received message larger than max (%d vs %d)", r.ContentLength, maxRecvMsgSize)
+	}
+
+	var reader io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "create gzip reader")
+		}
+		defer gr.Close()
+		reader = gr
+	case "", "identity":
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s, only gzip is supported", r.Header.Get("Content-Encoding"))
+	}
+
+	// Read from LimitReader with limit max+1, so if the body (after decompression)
+	// is over the limit, the read buffer will be bigger than max.
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(reader, int64(maxRecvMsgSize)+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxRecvMsgSize {
+		return nil, fmt.Errorf("received message larger than max (%d vs %d)", buf.Len(), maxRecvMsgSize)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writePushError writes the error returned by a push.Func to the HTTP response.
+func writePushError(w http.ResponseWriter, logger log.Logger, err error) {
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if resp.GetCode() != http.StatusAccepted {
+		level.Error(logger).Log("msg", "push error", "err", err)
+	}
+	http.Error(w, string(resp.Body), int(resp.Code))
+}
+
+// pushParsedTimeseries pushes the series parsed from the body of a push request in a text format.
+// If some lines couldn't be parsed, the valid series are pushed anyway and parseErr is returned
+// to the client as a 400 error. It returns false if an error response has been written.
+func pushParsedTimeseries(ctx context.Context, w http.ResponseWriter, logger log.Logger, series []mimirpb.PreallocTimeseries, parseErr error, pushFunc push.Func) bool {
+	if len(series) > 0 {
+		req := &mimirpb.WriteRequest{
+			Timeseries: series,
+			Source:     mimirpb.API,
+		}
+		cleanup := func() {
+			mimirpb.ReuseSlice(req.Timeseries)
+		}
+
+		if _, err := pushFunc(ctx, req, cleanup); err != nil {
+			writePushError(w, logger, err)
+			return false
+		}
+	} else {
+		mimirpb.ReuseSlice(series)
+	}
+
+	if parseErr != nil {
+		level.Warn(logger).Log("msg", "discarded invalid lines from push request", "err", parseErr)
+		http.Error(w, parseErr.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+type appendSampleFunc func(lbls labels.Labels, sample mimirpb.Sample, exemplars []mimirpb.Exemplar)
+
+// timeseriesBuilder groups samples by series, for the push formats which don't encode series
+// with all their samples together.
+type timeseriesBuilder struct {
+	series map[string]*mimirpb.TimeSeries
+	// Keep track of the insertion order, so that the output is deterministic.
+	order []string
+}
+
+func newTimeseriesBuilder() *timeseriesBuilder {
+	return &timeseriesBuilder{series: map[string]*mimirpb.TimeSeries{}}
+}
+
+func (b *timeseriesBuilder) add(lbls labels.Labels, sample mimirpb.Sample, exemplars []mimirpb.Exemplar) {
+	key := lbls.String()
+	ts, ok := b.series[key]
+	if !ok {
+		ts = mimirpb.TimeseriesFromPool()
+		ts.Labels = append(ts.Labels, mimirpb.FromLabelsToLabelAdapters(lbls)...)
+		b.series[key] = ts
+		b.order = append(b.order, key)
+	}
+	ts.Samples = append(ts.Samples, sample)
+	ts.Exemplars = append(ts.Exemplars, exemplars...)
+}
+
+// build returns the series, with samples sorted by timestamp. The returned slice is taken
+// from the pool, so mimirpb.ReuseSlice() should be called when done.
+func (b *timeseriesBuilder) build() []mimirpb.PreallocTimeseries {
+	result := mimirpb.PreallocTimeseriesSliceFromPool()
+	for _, key := range b.order {
+		ts := b.series[key]
+		sort.Slice(ts.Samples, func(i, j int) bool {
+			return ts.Samples[i].TimestampMs < ts.Samples[j].TimestampMs
+		})
+		result = append(result, mimirpb.PreallocTimeseries{TimeSeries: ts})
+	}
+	return result
+}
@@ -0,0 +1,296 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/weaveworks/common/middleware"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/push"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// influxValueField is the name of the field which is translated to a metric named after
+// the measurement only, following the Telegraf Prometheus output conventions.
+const influxValueField = "value"
+
+// InfluxHandler is a http.Handler which accepts writes encoded in the Influx line protocol, as sent
+// to the InfluxDB v1 /write API, translates them into a WriteRequest and forwards them to push.
+// Each field of a line is translated into a sample of the series named after the measurement and
+// the field, with the tags as labels. String fields are not supported and are discarded.
+func InfluxHandler(
+	maxRecvMsgSize int,
+	sourceIPs *middleware.SourceIPExtractor,
+	pushFunc push.Func,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, logger := pushRequestContext(r, sourceIPs)
+
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		toMillis, err := influxPrecisionToMillis(r.URL.Query().Get("precision"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, err := readPushRequestBody(r, maxRecvMsgSize)
+		if err != nil {
+			err = errors.Wrap(err, "read Influx request body")
+			level.Error(logger).Log("err", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := parseInfluxLineProtocol(body, toMillis, time.Now().UnixMilli())
+		if result.invalidLines > 0 {
+			validation.DiscardedSamples.WithLabelValues(validation.ReasonInfluxInvalidLine, userID).Add(float64(result.invalidLines))
+		}
+		if result.unsupportedFields > 0 {
+			validation.DiscardedSamples.WithLabelValues(validation.ReasonInfluxUnsupportedFieldType, userID).Add(float64(result.unsupportedFields))
+		}
+
+		if !pushParsedTimeseries(ctx, w, logger, result.series, result.firstErr, pushFunc) {
+			return
+		}
+
+		// InfluxDB replies with 204 No Content on success.
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type influxParseResult struct {
+	series            []mimirpb.PreallocTimeseries
+	invalidLines      int
+	unsupportedFields int
+	// firstErr is the error of the first line which couldn't be parsed, if any.
+	firstErr error
+}
+
+// parseInfluxLineProtocol translates the lines of an Influx line protocol payload into series.
+// Timestamps are converted to milliseconds with toMillis, while lines without timestamp get nowMs.
+// Invalid lines are skipped, so that the valid ones can still be ingested.
+func parseInfluxLineProtocol(body []byte, toMillis func(int64) int64, nowMs int64) influxParseResult {
+	var (
+		result  influxParseResult
+		builder = newTimeseriesBuilder()
+		lineNum = 0
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		unsupported, err := parseInfluxLine(line, toMillis, nowMs, builder.add)
+		if err != nil {
+			result.invalidLines++
+			if result.firstErr == nil {
+				result.firstErr = fmt.Errorf("invalid Influx line protocol at line %d: %w", lineNum, err)
+			}
+			continue
+		}
+		result.unsupportedFields += unsupported
+	}
+
+	result.series = builder.build()
+	return result
+}
+
+// parseInfluxLine parses a single line, in the format:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Samples are only appended if the whole line is valid. The number of fields
+// with an unsupported type, which are skipped, is returned.
+func parseInfluxLine(line string, toMillis func(int64) int64, nowMs int64, appendSample appendSampleFunc) (unsupported int, _ error) {
+	keyEnd := influxIndexUnescaped(line, ' ', false)
+	if keyEnd < 0 {
+		return 0, errors.New("missing fields")
+	}
+	key, rest := line[:keyEnd], strings.TrimLeft(line[keyEnd+1:], " ")
+
+	fieldsEnd := influxIndexUnescaped(rest, ' ', true)
+	fieldsStr, timestampStr := rest, ""
+	if fieldsEnd >= 0 {
+		fieldsStr, timestampStr = rest[:fieldsEnd], strings.TrimSpace(rest[fieldsEnd+1:])
+	}
+
+	keyParts := influxSplitUnescaped(key, ',', false)
+	measurement := influxUnescape(keyParts[0])
+	if measurement == "" {
+		return 0, errors.New("missing measurement")
+	}
+
+	builder := labels.NewBuilder(nil)
+	for _, tag := range keyParts[1:] {
+		name, value, err := influxKeyValue(tag, false)
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid tag")
+		}
+		builder.Set(sanitizeLabelName(name), value)
+	}
+
+	timestampMs := nowMs
+	if timestampStr != "" {
+		ts, err := strconv.ParseInt(timestampStr, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", timestampStr)
+		}
+		timestampMs = toMillis(ts)
+	}
+
+	type sample struct {
+		name  string
+		value float64
+	}
+	var samples []sample
+	for _, field := range influxSplitUnescaped(fieldsStr, ',', true) {
+		name, rawValue, err := influxKeyValue(field, true)
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid field")
+		}
+
+		value, supported, err := parseInfluxFieldValue(rawValue)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid value for field %q", name)
+		}
+		if !supported {
+			unsupported++
+			continue
+		}
+
+		metricName := measurement
+		if name != influxValueField {
+			metricName = measurement + "_" + name
+		}
+		samples = append(samples, sample{name: sanitizeMetricName(metricName), value: value})
+	}
+
+	for _, s := range samples {
+		builder.Set(labels.MetricName, s.name)
+		appendSample(builder.Labels(), mimirpb.Sample{TimestampMs: timestampMs, Value: s.value}, nil)
+	}
+	return unsupported, nil
+}
+
+// parseInfluxFieldValue parses a field value. The returned bool is false if the value
+// has a type which can't be translated to a sample value, like strings.
+func parseInfluxFieldValue(v string) (float64, bool, error) {
+	if v == "" {
+		return 0, false, errors.New("empty value")
+	}
+
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	switch v[len(v)-1] {
+	case '"':
+		if len(v) < 2 || v[0] != '"' {
+			return 0, false, errors.New("unterminated string")
+		}
+		return 0, false, nil
+	case 'i':
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(i), true, err
+	case 'u':
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return float64(u), true, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	return f, true, err
+}
+
+// influxPrecisionToMillis returns a function converting timestamps with the given precision,
+// as specified in the "precision" query parameter of the InfluxDB v1 API, to milliseconds.
+func influxPrecisionToMillis(precision string) (func(int64) int64, error) {
+	switch precision {
+	case "", "n", "ns":
+		return func(ts int64) int64 { return ts / int64(time.Millisecond) }, nil
+	case "u", "us":
+		return func(ts int64) int64 { return ts / int64(time.Millisecond/time.Microsecond) }, nil
+	case "ms":
+		return func(ts int64) int64 { return ts }, nil
+	case "s":
+		return func(ts int64) int64 { return ts * int64(time.Second/time.Millisecond) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported precision %q, supported: ns, u, ms, s", precision)
+	}
+}
+
+// influxKeyValue splits a tag or field in its unescaped key and value. Field values are returned
+// as they are, because their escaping depends on their type.
+func influxKeyValue(s string, quotes bool) (string, string, error) {
+	idx := influxIndexUnescaped(s, '=', quotes)
+	if idx <= 0 {
+		return "", "", fmt.Errorf("%q is not in the key=value format", s)
+	}
+	value := s[idx+1:]
+	if !quotes {
+		value = influxUnescape(value)
+	}
+	return influxUnescape(s[:idx]), value, nil
+}
+
+// influxIndexUnescaped returns the index of the first occurrence of sep not escaped with
+// a backslash and, if quotes is true, outside a double-quoted string, or -1 if not found.
+func influxIndexUnescaped(s string, sep byte, quotes bool) int {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case quotes && c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && c == sep:
+			return i
+		}
+	}
+	return -1
+}
+
+func influxSplitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	for {
+		idx := influxIndexUnescaped(s, sep, quotes)
+		if idx < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:idx])
+		s = s[idx+1:]
+	}
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, `,`, `\ `, ` `, `\=`, `=`, `\"`, `"`, `\\`, `\`)
+
+func influxUnescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	return influxUnescaper.Replace(s)
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestInfluxHandler(t *testing.T) {
+	tests := map[string]struct {
+		body            string
+		precision       string
+		pushErr         error
+		expectedCode    int
+		expectedSamples map[string][]mimirpb.Sample
+	}{
+		"valid lines": {
+			body:         "cpu,host=a usage=1.5,value=2i 1000000000\ncpu,host=b usage=3 2000000000",
+			expectedCode: http.StatusNoContent,
+			expectedSamples: map[string][]mimirpb.Sample{
+				`{__name__="cpu_usage", host="a"}`: {{TimestampMs: 1000, Value: 1.5}},
+				`{__name__="cpu", host="a"}`:       {{TimestampMs: 1000, Value: 2}},
+				`{__name__="cpu_usage", host="b"}`: {{TimestampMs: 2000, Value: 3}},
+			},
+		},
+		"precision in seconds": {
+			body:         "cpu usage=1 1",
+			precision:    "s",
+			expectedCode: http.StatusNoContent,
+			expectedSamples: map[string][]mimirpb.Sample{
+				`{__name__="cpu_usage"}`: {{TimestampMs: 1000, Value: 1}},
+			},
+		},
+		"unsupported precision": {
+			body:         "cpu usage=1 1",
+			precision:    "h",
+			expectedCode: http.StatusBadRequest,
+		},
+		"partially invalid": {
+			body:         "cpu usage=1 1000000000\ncpu usage= 1000000000",
+			expectedCode: http.StatusBadRequest,
+			expectedSamples: map[string][]mimirpb.Sample{
+				`{__name__="cpu_usage"}`: {{TimestampMs: 1000, Value: 1}},
+			},
+		},
+		"all invalid": {
+			body:         "cpu",
+			expectedCode: http.StatusBadRequest,
+		},
+		"push error": {
+			body:         "cpu usage=1 1000000000",
+			pushErr:      httpgrpc.Errorf(http.StatusTooManyRequests, "too many requests"),
+			expectedCode: http.StatusTooManyRequests,
+			expectedSamples: map[string][]mimirpb.Sample{
+				`{__name__="cpu_usage"}`: {{TimestampMs: 1000, Value: 1}},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			httpReq := httptest.NewRequest("POST", "/api/v1/push/influx/write?precision="+tc.precision, strings.NewReader(tc.body))
+			httpReq = httpReq.WithContext(user.InjectOrgID(httpReq.Context(), "test"))
+
+			var pushed map[string][]mimirpb.Sample
+			pushFunc := func(ctx context.Context, req *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+				defer cleanup()
+				pushed = map[string][]mimirpb.Sample{}
+				for _, ts := range req.Timeseries {
+					pushed[mimirpb.FromLabelAdaptersToLabels(ts.Labels).String()] = ts.Samples
+				}
+				return &mimirpb.WriteResponse{}, tc.pushErr
+			}
+
+			resp := httptest.NewRecorder()
+			InfluxHandler(100000, nil, pushFunc).ServeHTTP(resp, httpReq)
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			assert.Equal(t, tc.expectedSamples, pushed)
+		})
+	}
+}
+
+func TestParseInfluxLineProtocol(t *testing.T) {
+	const nowMs = 5000
+	body := strings.Join([]string{
+		`# comment`,
+		``,
+		`weather,location=us\,midwest,sea\ level=low temperature=82,up=true,unit="fahrenheit",count=3u 1000000000`,
+		`disk\ usage,path=/var free=10 2000000000`,
+		`no_timestamp value=-1.5e3`,
+		`invalid_value value=abc`,
+		`missing_fields`,
+		`invalid_tag,tag value=1`,
+	}, "\n")
+
+	userID := "influx-user"
+	result := parseInfluxLineProtocol([]byte(body), func(ts int64) int64 { return ts / 1e6 }, nowMs)
+	defer mimirpb.ReuseSlice(result.series)
+
+	assert.Equal(t, 3, result.invalidLines)
+	assert.Equal(t, 1, result.unsupportedFields)
+	require.Error(t, result.firstErr)
+	assert.Contains(t, result.firstErr.Error(), "line 6")
+
+	actual := map[string][]mimirpb.Sample{}
+	for _, ts := range result.series {
+		actual[mimirpb.FromLabelAdaptersToLabels(ts.Labels).String()] = ts.Samples
+	}
+	assert.Equal(t, map[string][]mimirpb.Sample{
+		`{__name__="weather_temperature", location="us,midwest", sea_level="low"}`: {{TimestampMs: 1000, Value: 82}},
+		`{__name__="weather_up", location="us,midwest", sea_level="low"}`:          {{TimestampMs: 1000, Value: 1}},
+		`{__name__="weather_count", location="us,midwest", sea_level="low"}`:       {{TimestampMs: 1000, Value: 3}},
+		`{__name__="disk_usage_free", path="/var"}`:                                {{TimestampMs: 2000, Value: 10}},
+		`{__name__="no_timestamp"}`:                                                {{TimestampMs: nowMs, Value: -1500}},
+	}, actual)
+
+	// The discarded samples are tracked by the handler.
+	httpReq := httptest.NewRequest("POST", "/api/v1/push/influx/write", strings.NewReader(body))
+	httpReq = httpReq.WithContext(user.InjectOrgID(httpReq.Context(), userID))
+	InfluxHandler(100000, nil, func(_ context.Context, _ *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+		cleanup()
+		return &mimirpb.WriteResponse{}, nil
+	}).ServeHTTP(httptest.NewRecorder(), httpReq)
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.ReasonInfluxInvalidLine, userID)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.ReasonInfluxUnsupportedFieldType, userID)))
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"math"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// convertNativeHistograms replaces the native histograms in the input series with the equivalent
+// classic histogram series (_bucket, _count and _sum), so that they can be ingested and queried
+// with histogram_quantile() by a storage which doesn't support native histograms. Input series
+// only containing native histograms are removed. The returned error is the first validation
+// error, if any; invalid native histograms are discarded while the valid ones are converted.
+//
+// The conversion is lossy: the schema, the spans and the counter reset hints of the native
+// histograms are not preserved, and integer counts are converted to floats. Each distinct bucket
+// boundary becomes a _bucket series, so the number of buckets of each native histogram is limited
+// by cfg to bound the number of series created by a single native histogram.
+func convertNativeHistograms(cfg validation.HistogramValidationConfig, userID string, series []mimirpb.PreallocTimeseries, enabled bool) ([]mimirpb.PreallocTimeseries, error) {
+	var firstErr error
+
+	output := series[:0]
+	var converted []mimirpb.PreallocTimeseries
+	for _, ts := range series {
+		if len(ts.Histograms) == 0 {
+			output = append(output, ts)
+			continue
+		}
+
+		if !enabled {
+			validation.DiscardedSamples.WithLabelValues(validation.ReasonNativeHistogramsDisabled, userID).Add(float64(len(ts.Histograms)))
+		} else {
+			valid := ts.Histograms[:0]
+			for _, h := range ts.Histograms {
+				if err := validation.ValidateHistogram(cfg, userID, ts.Labels, h); err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+				valid = append(valid, h)
+			}
+
+			converted = appendClassicHistogramSeries(converted, ts.Labels, valid, ts.Exemplars)
+			ts.Exemplars = ts.Exemplars[:0]
+		}
+
+		ts.Histograms = ts.Histograms[:0]
+		if len(ts.Samples) == 0 && len(ts.Exemplars) == 0 {
+			mimirpb.ReuseTimeseries(ts.TimeSeries)
+			continue
+		}
+		output = append(output, ts)
+	}
+
+	return append(output, converted...), firstErr
+}
+
+// appendClassicHistogramSeries converts the input native histograms of a series into classic histogram
+// series and appends them to output. Exemplars are attached to the first bucket whose upper bound
+// includes the exemplar value.
+func appendClassicHistogramSeries(output []mimirpb.PreallocTimeseries, lbls []mimirpb.LabelAdapter, histograms []mimirpb.Histogram, exemplars []mimirpb.Exemplar) []mimirpb.PreallocTimeseries {
+	if len(histograms) == 0 {
+		return output
+	}
+
+	var name string
+	for _, l := range lbls {
+		if l.Name == labels.MetricName {
+			name = l.Value
+			break
+		}
+	}
+
+	// The buckets layout can change between native histograms of the same series,
+	// so we keep track of the series created for each bucket upper bound.
+	var (
+		countSeries   = newClassicHistogramSeries(lbls, name+countSuffix)
+		sumSeries     = newClassicHistogramSeries(lbls, name+sumSuffix)
+		bucketSeries  = map[float64]*mimirpb.TimeSeries{}
+		bucketsBounds []float64
+	)
+
+	appendBucket := func(upperBound float64, t int64, v float64) {
+		s, ok := bucketSeries[upperBound]
+		if !ok {
+			s = newClassicHistogramSeries(lbls, name+bucketSuffix, mimirpb.LabelAdapter{Name: labels.BucketLabel, Value: formatFloat(upperBound)})
+			bucketSeries[upperBound] = s
+			bucketsBounds = append(bucketsBounds, upperBound)
+		}
+		s.Samples = append(s.Samples, mimirpb.Sample{TimestampMs: t, Value: v})
+	}
+
+	for _, h := range histograms {
+		// A stale marker is encoded as a stale sum.
+		stale := value.IsStaleNaN(h.Sum)
+		valueOrStale := func(v float64) float64 {
+			if stale {
+				return math.Float64frombits(value.StaleNaN)
+			}
+			return v
+		}
+
+		countSeries.Samples = append(countSeries.Samples, mimirpb.Sample{TimestampMs: h.Timestamp, Value: valueOrStale(h.GetCountValue())})
+		sumSeries.Samples = append(sumSeries.Samples, mimirpb.Sample{TimestampMs: h.Timestamp, Value: h.Sum})
+
+		// Classic buckets are cumulative, so we start from the negative bucket with the lowest
+		// upper bound (which is the one with the highest index).
+		var cumulative float64
+		negative := histogramBuckets(h.Schema, h.NegativeSpans, h.NegativeDeltas, h.NegativeCounts, h.IsFloatHistogram())
+		for i := len(negative) - 1; i >= 0; i-- {
+			cumulative += negative[i].count
+			appendBucket(-negative[i].lowerBound, h.Timestamp, valueOrStale(cumulative))
+		}
+
+		if zeroCount := h.GetZeroCountValue(); zeroCount > 0 || h.ZeroThreshold > 0 {
+			cumulative += zeroCount
+			appendBucket(h.ZeroThreshold, h.Timestamp, valueOrStale(cumulative))
+		}
+
+		for _, b := range histogramBuckets(h.Schema, h.PositiveSpans, h.PositiveDeltas, h.PositiveCounts, h.IsFloatHistogram()) {
+			cumulative += b.count
+			appendBucket(b.upperBound, h.Timestamp, valueOrStale(cumulative))
+		}
+
+		appendBucket(math.Inf(1), h.Timestamp, valueOrStale(h.GetCountValue()))
+	}
+
+	sort.Float64s(bucketsBounds)
+	sort.Slice(exemplars, func(i, j int) bool { return exemplars[i].Value < exemplars[j].Value })
+	for _, bound := range bucketsBounds {
+		s := bucketSeries[bound]
+		for len(exemplars) > 0 && exemplars[0].Value <= bound {
+			s.Exemplars = append(s.Exemplars, exemplars[0])
+			exemplars = exemplars[1:]
+		}
+		output = append(output, mimirpb.PreallocTimeseries{TimeSeries: s})
+	}
+
+	return append(output, mimirpb.PreallocTimeseries{TimeSeries: countSeries}, mimirpb.PreallocTimeseries{TimeSeries: sumSeries})
+}
+
+func newClassicHistogramSeries(lbls []mimirpb.LabelAdapter, name string, extra ...mimirpb.LabelAdapter) *mimirpb.TimeSeries {
+	ts := mimirpb.TimeseriesFromPool()
+	for _, l := range lbls {
+		if l.Name == labels.MetricName {
+			l.Value = name
+		}
+		ts.Labels = append(ts.Labels, l)
+	}
+	ts.Labels = append(ts.Labels, extra...)
+	return ts
+}
+
+type histogramBucket struct {
+	lowerBound, upperBound float64
+	count                  float64
+}
+
+// histogramBuckets returns the non-cumulative buckets described by the input spans, sorted by index.
+func histogramBuckets(schema int32, spans []mimirpb.BucketSpan, deltas []int64, counts []float64, isFloat bool) []histogramBucket {
+	var (
+		buckets []histogramBucket
+		idx     int32
+		current int64
+		pos     int
+	)
+
+	for _, span := range spans {
+		idx += span.Offset
+		for i := uint32(0); i < span.Length; i++ {
+			var count float64
+			if isFloat {
+				count = counts[pos]
+			} else {
+				current += deltas[pos]
+				count = float64(current)
+			}
+			buckets = append(buckets, histogramBucket{
+				lowerBound: histogramBucketUpperBound(idx-1, schema),
+				upperBound: histogramBucketUpperBound(idx, schema),
+				count:      count,
+			})
+			idx++
+			pos++
+		}
+	}
+
+	return buckets
+}
+
+// histogramBucketUpperBound returns the upper bound of the bucket with the given index. Each power
+// of two is divided into 2^schema logarithmic buckets, and 1 is the upper bound of the bucket 0.
+func histogramBucketUpperBound(idx, schema int32) float64 {
+	if schema > 0 {
+		return math.Exp2(float64(idx) / float64(int64(1)<<schema))
+	}
+	return math.Ldexp(1, int(idx)<<-schema)
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/globalerror"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestConvertNativeHistograms(t *testing.T) {
+	const userID = "native-histograms"
+
+	lbls := []mimirpb.LabelAdapter{{Name: "__name__", Value: "latency"}, {Name: "job", Value: "test"}}
+	histogram := mimirpb.Histogram{
+		Count:          &mimirpb.Histogram_CountInt{CountInt: 6},
+		Sum:            10,
+		Schema:         0,
+		ZeroThreshold:  0.001,
+		ZeroCount:      &mimirpb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+		NegativeSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}},
+		NegativeDeltas: []int64{1},
+		PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 2}, {Offset: 1, Length: 1}},
+		PositiveDeltas: []int64{1, 1, -1},
+		Timestamp:      1000,
+	}
+	stale := mimirpb.Histogram{
+		Count:     &mimirpb.Histogram_CountInt{CountInt: 0},
+		Sum:       math.Float64frombits(value.StaleNaN),
+		Timestamp: 2000,
+	}
+	invalid := mimirpb.Histogram{
+		Count:     &mimirpb.Histogram_CountInt{CountInt: 0},
+		Schema:    10,
+		Timestamp: 3000,
+	}
+
+	input := []mimirpb.PreallocTimeseries{
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "float"}},
+			Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}},
+		}},
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels:     lbls,
+			Histograms: []mimirpb.Histogram{histogram, stale, invalid},
+			Exemplars:  []mimirpb.Exemplar{{Value: 1.5, TimestampMs: 1000}},
+		}},
+	}
+
+	output, err := convertNativeHistograms(nativeHistogramsTestLimits{maxBuckets: 10}, userID, input, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "schema 10 is out of range")
+
+	staleNaN := math.Float64frombits(value.StaleNaN)
+	type seriesData struct {
+		samples   []mimirpb.Sample
+		exemplars []mimirpb.Exemplar
+	}
+	expected := map[string]seriesData{
+		`{__name__="float"}`:                                  {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}}},
+		`{__name__="latency_count", job="test"}`:              {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 6}, {TimestampMs: 2000, Value: staleNaN}}},
+		`{__name__="latency_sum", job="test"}`:                {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 10}, {TimestampMs: 2000, Value: staleNaN}}},
+		`{__name__="latency_bucket", job="test", le="-0.5"}`:  {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1}}},
+		`{__name__="latency_bucket", job="test", le="0.001"}`: {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 2}}},
+		`{__name__="latency_bucket", job="test", le="1"}`:     {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 3}}},
+		`{__name__="latency_bucket", job="test", le="2"}`: {
+			samples:   []mimirpb.Sample{{TimestampMs: 1000, Value: 5}},
+			exemplars: []mimirpb.Exemplar{{Value: 1.5, TimestampMs: 1000}},
+		},
+		`{__name__="latency_bucket", job="test", le="8"}`:    {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 6}}},
+		`{__name__="latency_bucket", job="test", le="+Inf"}`: {samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 6}, {TimestampMs: 2000, Value: staleNaN}}},
+	}
+
+	require.Len(t, output, len(expected))
+	for _, ts := range output {
+		lbls := mimirpb.FromLabelAdaptersToLabels(ts.Labels).String()
+		exp, ok := expected[lbls]
+		require.True(t, ok, "unexpected series %s", lbls)
+		assert.Empty(t, ts.Histograms, lbls)
+		if len(exp.exemplars) > 0 {
+			assert.Equal(t, exp.exemplars, ts.Exemplars, lbls)
+		} else {
+			assert.Empty(t, ts.Exemplars, lbls)
+		}
+
+		require.Len(t, ts.Samples, len(exp.samples), lbls)
+		for i, s := range exp.samples {
+			assert.Equal(t, s.TimestampMs, ts.Samples[i].TimestampMs, lbls)
+			if value.IsStaleNaN(s.Value) {
+				assert.True(t, value.IsStaleNaN(ts.Samples[i].Value), lbls)
+			} else {
+				assert.Equal(t, s.Value, ts.Samples[i].Value, lbls)
+			}
+		}
+	}
+}
+
+func TestConvertNativeHistograms_Disabled(t *testing.T) {
+	const userID = "native-histograms-disabled"
+
+	input := []mimirpb.PreallocTimeseries{
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels:     []mimirpb.LabelAdapter{{Name: "__name__", Value: "latency"}},
+			Histograms: []mimirpb.Histogram{{Count: &mimirpb.Histogram_CountInt{CountInt: 1}, Timestamp: 1000}},
+		}},
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels:     []mimirpb.LabelAdapter{{Name: "__name__", Value: "mixed"}},
+			Samples:    []mimirpb.Sample{{TimestampMs: 1000, Value: 1}},
+			Histograms: []mimirpb.Histogram{{Count: &mimirpb.Histogram_CountInt{CountInt: 1}, Timestamp: 1000}},
+		}},
+	}
+
+	output, err := convertNativeHistograms(nativeHistogramsTestLimits{maxBuckets: 10}, userID, input, false)
+	require.NoError(t, err)
+	require.Len(t, output, 1)
+	assert.Equal(t, "mixed", output[0].Labels[0].Value)
+	assert.Equal(t, []mimirpb.Sample{{TimestampMs: 1000, Value: 1}}, output[0].Samples)
+	assert.Empty(t, output[0].Histograms)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.ReasonNativeHistogramsDisabled, userID)))
+}
+
+func TestConvertNativeHistograms_MaxBuckets(t *testing.T) {
+	const userID = "native-histograms-max-buckets"
+
+	input := []mimirpb.PreallocTimeseries{
+		{TimeSeries: &mimirpb.TimeSeries{
+			Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "latency"}},
+			Histograms: []mimirpb.Histogram{
+				{
+					Count:          &mimirpb.Histogram_CountInt{CountInt: 1},
+					PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}},
+					PositiveDeltas: []int64{1},
+					Timestamp:      1000,
+				},
+				{
+					// Sparse buckets far apart from each other count like contiguous buckets.
+					Count:          &mimirpb.Histogram_CountInt{CountInt: 2},
+					PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}, {Offset: 1000, Length: 1}},
+					PositiveDeltas: []int64{1, 0},
+					Timestamp:      2000,
+				},
+			},
+		}},
+	}
+
+	output, err := convertNativeHistograms(nativeHistogramsTestLimits{maxBuckets: 1}, userID, input, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), globalerror.MaxNativeHistogramBuckets.Message(""))
+
+	// Only the first native histogram is converted, to the _bucket series with le="1" and le="+Inf",
+	// plus the _count and _sum series.
+	require.Len(t, output, 4)
+	for _, ts := range output {
+		require.Len(t, ts.Samples, 1, mimirpb.FromLabelAdaptersToLabels(ts.Labels).String())
+		assert.Equal(t, int64(1000), ts.Samples[0].TimestampMs)
+	}
+}
+
+func TestHistogramBucketUpperBound(t *testing.T) {
+	assert.Equal(t, 1.0, histogramBucketUpperBound(0, 3))
+	assert.InDelta(t, math.Sqrt2, histogramBucketUpperBound(1, 1), 1e-12)
+	assert.Equal(t, 0.5, histogramBucketUpperBound(-1, 0))
+	assert.Equal(t, 16.0, histogramBucketUpperBound(1, -2))
+	assert.Equal(t, 1.0/16, histogramBucketUpperBound(-1, -2))
+}
+
+type nativeHistogramsTestLimits struct {
+	maxBuckets int
+}
+
+func (l nativeHistogramsTestLimits) MaxNativeHistogramBuckets(string) int {
+	return l.maxBuckets
+}
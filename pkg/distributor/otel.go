@@ -0,0 +1,509 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/weaveworks/common/middleware"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/push"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	pbContentType   = "application/x-protobuf"
+	jsonContentType = "application/json"
+
+	// Resource attributes which are mapped to the Prometheus job and instance labels,
+	// following the OpenTelemetry specification for Prometheus compatibility.
+	otelServiceName       = "service.name"
+	otelServiceNamespace  = "service.namespace"
+	otelServiceInstanceID = "service.instance.id"
+
+	bucketSuffix = "_bucket"
+	countSuffix  = "_count"
+	sumSuffix    = "_sum"
+
+	traceIDLabel = "trace_id"
+	spanIDLabel  = "span_id"
+)
+
+// OTLPHandler is a http.Handler which accepts OTLP metrics export requests, encoded either
+// as protobuf or JSON, translates them into a WriteRequest and forwards them to push.
+func OTLPHandler(
+	maxRecvMsgSize int,
+	sourceIPs *middleware.SourceIPExtractor,
+	allowSkipLabelNameValidation bool,
+	pushFunc push.Func,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, logger := pushRequestContext(r, sourceIPs)
+
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		otlpReq, err := decodeOTLPRequest(r, contentType, maxRecvMsgSize)
+		if err != nil {
+			level.Error(logger).Log("err", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metrics, dropped := otelMetricsToTimeseries(otlpReq.Metrics())
+		if dropped.deltaTemporality > 0 {
+			validation.DiscardedSamples.WithLabelValues(validation.ReasonOTLPDeltaTemporality, userID).Add(float64(dropped.deltaTemporality))
+		}
+		if dropped.exponentialHistogram > 0 {
+			validation.DiscardedSamples.WithLabelValues(validation.ReasonOTLPExponentialHistogram, userID).Add(float64(dropped.exponentialHistogram))
+		}
+
+		req := &mimirpb.WriteRequest{
+			Timeseries: metrics,
+			Metadata:   otelMetricsToMetadata(otlpReq.Metrics()),
+			Source:     mimirpb.API,
+		}
+		if allowSkipLabelNameValidation {
+			req.SkipLabelNameValidation = r.Header.Get(push.SkipLabelNameValidationHeader) == "true"
+		}
+
+		cleanup := func() {
+			mimirpb.ReuseSlice(req.Timeseries)
+		}
+
+		if _, err := pushFunc(ctx, req, cleanup); err != nil {
+			writePushError(w, logger, err)
+			return
+		}
+
+		// The data points which have been translated are ingested, but the client is notified with a
+		// non-retryable error that the other ones have been dropped.
+		if err := dropped.err(); err != nil {
+			level.Warn(logger).Log("msg", "dropped OTLP data points from push request", "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeOTLPResponse(w, contentType)
+	})
+}
+
+func decodeOTLPRequest(r *http.Request, contentType string, maxRecvMsgSize int) (pmetricotlp.Request, error) {
+	req := pmetricotlp.NewRequest()
+
+	body, err := readPushRequestBody(r, maxRecvMsgSize)
+	if err != nil {
+		return req, errors.Wrap(err, "read OTLP request body")
+	}
+
+	switch baseContentType(contentType) {
+	case jsonContentType:
+		if err := req.UnmarshalJSON(body); err != nil {
+			return req, errors.Wrap(err, "decode OTLP JSON request")
+		}
+	case pbContentType, "":
+		if err := req.UnmarshalProto(body); err != nil {
+			return req, errors.Wrap(err, "decode OTLP protobuf request")
+		}
+	default:
+		return req, fmt.Errorf("unsupported content type: %s, supported: [%s, %s]", contentType, pbContentType, jsonContentType)
+	}
+
+	return req, nil
+}
+
+func writeOTLPResponse(w http.ResponseWriter, contentType string) {
+	resp := pmetricotlp.NewResponse()
+
+	var (
+		body []byte
+		err  error
+	)
+	if baseContentType(contentType) == jsonContentType {
+		w.Header().Set("Content-Type", jsonContentType)
+		body, err = resp.MarshalJSON()
+	} else {
+		w.Header().Set("Content-Type", pbContentType)
+		body, err = resp.MarshalProto()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func baseContentType(contentType string) string {
+	if idx := strings.IndexByte(contentType, ';'); idx >= 0 {
+		contentType = contentType[:idx]
+	}
+	return strings.TrimSpace(contentType)
+}
+
+// otelDroppedPoints holds the number of OTLP data points which can't be represented as Prometheus samples.
+type otelDroppedPoints struct {
+	// Monotonic sums and histograms with delta temporality.
+	deltaTemporality int
+	// Exponential histograms.
+	exponentialHistogram int
+}
+
+func (d *otelDroppedPoints) add(other otelDroppedPoints) {
+	d.deltaTemporality += other.deltaTemporality
+	d.exponentialHistogram += other.exponentialHistogram
+}
+
+// err returns an error describing the dropped data points, or nil if no data point has been dropped.
+func (d otelDroppedPoints) err() error {
+	if d.deltaTemporality == 0 && d.exponentialHistogram == 0 {
+		return nil
+	}
+	return fmt.Errorf("dropped %d data points with delta temporality and %d exponential histogram data points which can't be translated to Prometheus samples", d.deltaTemporality, d.exponentialHistogram)
+}
+
+// otelMetricsToTimeseries translates the OTLP metrics into Prometheus series. Data points which
+// can't be represented as Prometheus samples (delta temporality sums and histograms, exponential
+// histograms) are skipped and their number is returned.
+func otelMetricsToTimeseries(md pmetric.Metrics) (_ []mimirpb.PreallocTimeseries, dropped otelDroppedPoints) {
+	builder := newTimeseriesBuilder()
+
+	resourceMetricsSlice := md.ResourceMetrics()
+	for i := 0; i < resourceMetricsSlice.Len(); i++ {
+		resourceMetrics := resourceMetricsSlice.At(i)
+		resourceLabels := otelResourceToLabels(resourceMetrics.Resource())
+
+		scopeMetricsSlice := resourceMetrics.ScopeMetrics()
+		for j := 0; j < scopeMetricsSlice.Len(); j++ {
+			metricSlice := scopeMetricsSlice.At(j).Metrics()
+			for k := 0; k < metricSlice.Len(); k++ {
+				dropped.add(otelMetricToSamples(metricSlice.At(k), resourceLabels, builder.add))
+			}
+		}
+	}
+
+	return builder.build(), dropped
+}
+
+func otelMetricToSamples(metric pmetric.Metric, resourceLabels labels.Labels, appendSample appendSampleFunc) otelDroppedPoints {
+	name := sanitizeMetricName(metric.Name())
+
+	switch metric.DataType() {
+	case pmetric.MetricDataTypeGauge:
+		points := metric.Gauge().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			otelNumberDataPointToSample(name, points.At(i), resourceLabels, appendSample)
+		}
+		return otelDroppedPoints{}
+
+	case pmetric.MetricDataTypeSum:
+		sum := metric.Sum()
+		points := sum.DataPoints()
+		// Non-monotonic delta sums are effectively gauges of the change, but monotonic ones
+		// can't be represented as a Prometheus counter without keeping state between requests.
+		if sum.IsMonotonic() && sum.AggregationTemporality() != pmetric.MetricAggregationTemporalityCumulative {
+			return otelDroppedPoints{deltaTemporality: points.Len()}
+		}
+		for i := 0; i < points.Len(); i++ {
+			otelNumberDataPointToSample(name, points.At(i), resourceLabels, appendSample)
+		}
+		return otelDroppedPoints{}
+
+	case pmetric.MetricDataTypeHistogram:
+		histogram := metric.Histogram()
+		points := histogram.DataPoints()
+		if histogram.AggregationTemporality() != pmetric.MetricAggregationTemporalityCumulative {
+			return otelDroppedPoints{deltaTemporality: points.Len()}
+		}
+		for i := 0; i < points.Len(); i++ {
+			otelHistogramDataPointToSamples(name, points.At(i), resourceLabels, appendSample)
+		}
+		return otelDroppedPoints{}
+
+	case pmetric.MetricDataTypeSummary:
+		points := metric.Summary().DataPoints()
+		for i := 0; i < points.Len(); i++ {
+			otelSummaryDataPointToSamples(name, points.At(i), resourceLabels, appendSample)
+		}
+		return otelDroppedPoints{}
+
+	case pmetric.MetricDataTypeExponentialHistogram:
+		return otelDroppedPoints{exponentialHistogram: metric.ExponentialHistogram().DataPoints().Len()}
+	}
+
+	return otelDroppedPoints{}
+}
+
+func otelNumberDataPointToSample(name string, pt pmetric.NumberDataPoint, resourceLabels labels.Labels, appendSample appendSampleFunc) {
+	var v float64
+	switch pt.ValueType() {
+	case pmetric.NumberDataPointValueTypeInt:
+		v = float64(pt.IntVal())
+	case pmetric.NumberDataPointValueTypeDouble:
+		v = pt.DoubleVal()
+	}
+	if pt.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue) {
+		v = math.Float64frombits(value.StaleNaN)
+	}
+
+	lbls := otelLabels(name, resourceLabels, pt.Attributes())
+	appendSample(lbls, otelSample(pt.Timestamp(), v), otelExemplars(pt.Exemplars()))
+}
+
+func otelHistogramDataPointToSamples(name string, pt pmetric.HistogramDataPoint, resourceLabels labels.Labels, appendSample appendSampleFunc) {
+	timestamp := pt.Timestamp()
+	stale := pt.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue)
+	valueOrStale := func(v float64) float64 {
+		if stale {
+			return math.Float64frombits(value.StaleNaN)
+		}
+		return v
+	}
+
+	if pt.HasSum() {
+		appendSample(otelLabels(name+sumSuffix, resourceLabels, pt.Attributes()), otelSample(timestamp, valueOrStale(pt.Sum())), nil)
+	}
+	appendSample(otelLabels(name+countSuffix, resourceLabels, pt.Attributes()), otelSample(timestamp, valueOrStale(float64(pt.Count()))), nil)
+
+	// Exemplars are attached to the first bucket whose upper bound includes the exemplar value.
+	exemplars := otelExemplars(pt.Exemplars())
+	bucketExemplars := func(upperBound float64) []mimirpb.Exemplar {
+		var result []mimirpb.Exemplar
+		for len(exemplars) > 0 && exemplars[0].Value <= upperBound {
+			result = append(result, exemplars[0])
+			exemplars = exemplars[1:]
+		}
+		return result
+	}
+	sort.Slice(exemplars, func(i, j int) bool { return exemplars[i].Value < exemplars[j].Value })
+
+	// OTLP buckets are not cumulative, while Prometheus ones are.
+	var cumulative uint64
+	bounds := pt.MExplicitBounds()
+	counts := pt.MBucketCounts()
+	for i := 0; i < len(bounds) && i < len(counts); i++ {
+		cumulative += counts[i]
+		bound := bounds[i]
+		lbls := otelLabels(name+bucketSuffix, resourceLabels, pt.Attributes(), labels.Label{Name: labels.BucketLabel, Value: formatFloat(bound)})
+		appendSample(lbls, otelSample(timestamp, valueOrStale(float64(cumulative))), bucketExemplars(bound))
+	}
+
+	lbls := otelLabels(name+bucketSuffix, resourceLabels, pt.Attributes(), labels.Label{Name: labels.BucketLabel, Value: "+Inf"})
+	appendSample(lbls, otelSample(timestamp, valueOrStale(float64(pt.Count()))), bucketExemplars(math.Inf(1)))
+}
+
+func otelSummaryDataPointToSamples(name string, pt pmetric.SummaryDataPoint, resourceLabels labels.Labels, appendSample appendSampleFunc) {
+	timestamp := pt.Timestamp()
+	stale := pt.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue)
+	valueOrStale := func(v float64) float64 {
+		if stale {
+			return math.Float64frombits(value.StaleNaN)
+		}
+		return v
+	}
+
+	appendSample(otelLabels(name+sumSuffix, resourceLabels, pt.Attributes()), otelSample(timestamp, valueOrStale(pt.Sum())), nil)
+	appendSample(otelLabels(name+countSuffix, resourceLabels, pt.Attributes()), otelSample(timestamp, valueOrStale(float64(pt.Count()))), nil)
+
+	quantiles := pt.QuantileValues()
+	for i := 0; i < quantiles.Len(); i++ {
+		q := quantiles.At(i)
+		lbls := otelLabels(name, resourceLabels, pt.Attributes(), labels.Label{Name: "quantile", Value: formatFloat(q.Quantile())})
+		appendSample(lbls, otelSample(timestamp, valueOrStale(q.Value())), nil)
+	}
+}
+
+// otelResourceToLabels promotes the resource attributes to labels. The service name, namespace and
+// instance ID attributes are additionally mapped to the job and instance labels.
+func otelResourceToLabels(resource pcommon.Resource) labels.Labels {
+	attrs := resource.Attributes()
+	b := labels.NewBuilder(nil)
+
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		b.Set(sanitizeLabelName(k), v.AsString())
+		return true
+	})
+
+	if serviceName, ok := attrs.Get(otelServiceName); ok {
+		job := serviceName.AsString()
+		if namespace, ok := attrs.Get(otelServiceNamespace); ok {
+			job = namespace.AsString() + "/" + job
+		}
+		b.Set(model.JobLabel, job)
+	}
+	if instance, ok := attrs.Get(otelServiceInstanceID); ok {
+		b.Set(model.InstanceLabel, instance.AsString())
+	}
+
+	return b.Labels()
+}
+
+// otelLabels builds the series labels out of the metric name, the resource labels, the data point
+// attributes and the extra labels. Data point attributes take precedence over resource labels.
+func otelLabels(name string, resourceLabels labels.Labels, attrs pcommon.Map, extra ...labels.Label) labels.Labels {
+	b := labels.NewBuilder(resourceLabels)
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		b.Set(sanitizeLabelName(k), v.AsString())
+		return true
+	})
+	for _, l := range extra {
+		b.Set(l.Name, l.Value)
+	}
+	b.Set(labels.MetricName, name)
+	return b.Labels()
+}
+
+func otelSample(ts pcommon.Timestamp, v float64) mimirpb.Sample {
+	return mimirpb.Sample{
+		TimestampMs: int64(ts) / 1e6,
+		Value:       v,
+	}
+}
+
+func otelExemplars(exemplars pmetric.ExemplarSlice) []mimirpb.Exemplar {
+	if exemplars.Len() == 0 {
+		return nil
+	}
+
+	result := make([]mimirpb.Exemplar, 0, exemplars.Len())
+	for i := 0; i < exemplars.Len(); i++ {
+		e := exemplars.At(i)
+
+		var v float64
+		switch e.ValueType() {
+		case pmetric.ExemplarValueTypeInt:
+			v = float64(e.IntVal())
+		case pmetric.ExemplarValueTypeDouble:
+			v = e.DoubleVal()
+		}
+
+		b := labels.NewBuilder(nil)
+		e.FilteredAttributes().Range(func(k string, v pcommon.Value) bool {
+			b.Set(sanitizeLabelName(k), v.AsString())
+			return true
+		})
+		if traceID := e.TraceID(); !traceID.IsEmpty() {
+			b.Set(traceIDLabel, traceID.HexString())
+		}
+		if spanID := e.SpanID(); !spanID.IsEmpty() {
+			b.Set(spanIDLabel, spanID.HexString())
+		}
+
+		result = append(result, mimirpb.Exemplar{
+			Labels:      mimirpb.FromLabelsToLabelAdapters(b.Labels()),
+			Value:       v,
+			TimestampMs: int64(e.Timestamp()) / 1e6,
+		})
+	}
+
+	return result
+}
+
+// otelMetricsToMetadata builds the metric metadata out of the OTLP metric description and type.
+func otelMetricsToMetadata(md pmetric.Metrics) []*mimirpb.MetricMetadata {
+	var metadata []*mimirpb.MetricMetadata
+	seen := map[string]struct{}{}
+
+	resourceMetricsSlice := md.ResourceMetrics()
+	for i := 0; i < resourceMetricsSlice.Len(); i++ {
+		scopeMetricsSlice := resourceMetricsSlice.At(i).ScopeMetrics()
+		for j := 0; j < scopeMetricsSlice.Len(); j++ {
+			metricSlice := scopeMetricsSlice.At(j).Metrics()
+			for k := 0; k < metricSlice.Len(); k++ {
+				metric := metricSlice.At(k)
+				name := sanitizeMetricName(metric.Name())
+				if _, ok := seen[name]; ok {
+					continue
+				}
+				seen[name] = struct{}{}
+
+				metadata = append(metadata, &mimirpb.MetricMetadata{
+					Type:             otelMetricTypeToMetadataType(metric),
+					MetricFamilyName: name,
+					Help:             metric.Description(),
+					Unit:             metric.Unit(),
+				})
+			}
+		}
+	}
+
+	return metadata
+}
+
+func otelMetricTypeToMetadataType(metric pmetric.Metric) mimirpb.MetricMetadata_MetricType {
+	switch metric.DataType() {
+	case pmetric.MetricDataTypeGauge:
+		return mimirpb.GAUGE
+	case pmetric.MetricDataTypeSum:
+		if metric.Sum().IsMonotonic() {
+			return mimirpb.COUNTER
+		}
+		return mimirpb.GAUGE
+	case pmetric.MetricDataTypeHistogram:
+		return mimirpb.HISTOGRAM
+	case pmetric.MetricDataTypeSummary:
+		return mimirpb.SUMMARY
+	}
+	return mimirpb.UNKNOWN
+}
+
+// sanitizeMetricName converts a metric name to a valid Prometheus metric name.
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, func(r rune, first bool) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || r == ':' || (!first && r >= '0' && r <= '9')
+	})
+}
+
+// sanitizeLabelName converts an attribute key or tag name to a valid Prometheus label name.
+func sanitizeLabelName(name string) string {
+	return sanitizeName(name, func(r rune, first bool) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || (!first && r >= '0' && r <= '9')
+	})
+}
+
+// sanitizeName replaces all the characters not allowed by valid with an underscore. Names starting
+// with a digit are prefixed with "key_", following the OpenTelemetry specification.
+func sanitizeName(name string, valid func(r rune, first bool) bool) string {
+	if name == "" {
+		return name
+	}
+
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case valid(r, i == 0):
+			sb.WriteRune(r)
+		case i == 0 && unicode.IsDigit(r):
+			sb.WriteString("key_")
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
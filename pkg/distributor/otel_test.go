@@ -0,0 +1,310 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestOTLPHandler(t *testing.T) {
+	ts := time.Unix(100, 0)
+
+	tests := map[string]struct {
+		contentType     string
+		contentEncoding string
+		pushErr         error
+		expectedCode    int
+	}{
+		"protobuf": {
+			contentType:  pbContentType,
+			expectedCode: http.StatusOK,
+		},
+		"protobuf with gzip": {
+			contentType:     pbContentType,
+			contentEncoding: "gzip",
+			expectedCode:    http.StatusOK,
+		},
+		"json": {
+			contentType:  jsonContentType + "; charset=utf-8",
+			expectedCode: http.StatusOK,
+		},
+		"unsupported content type": {
+			contentType:  "text/plain",
+			expectedCode: http.StatusBadRequest,
+		},
+		"push error": {
+			contentType:  pbContentType,
+			pushErr:      httpgrpc.Errorf(http.StatusTooManyRequests, "too many requests"),
+			expectedCode: http.StatusTooManyRequests,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := pmetricotlp.NewRequestFromMetrics(createOTLPGaugeMetrics(ts))
+
+			var body []byte
+			var err error
+			if baseContentType(tc.contentType) == jsonContentType {
+				body, err = req.MarshalJSON()
+			} else {
+				body, err = req.MarshalProto()
+			}
+			require.NoError(t, err)
+
+			if tc.contentEncoding == "gzip" {
+				var buf bytes.Buffer
+				gw := gzip.NewWriter(&buf)
+				_, err = gw.Write(body)
+				require.NoError(t, err)
+				require.NoError(t, gw.Close())
+				body = buf.Bytes()
+			}
+
+			httpReq := httptest.NewRequest("POST", "/otlp/v1/metrics", bytes.NewReader(body))
+			httpReq.Header.Set("Content-Type", tc.contentType)
+			if tc.contentEncoding != "" {
+				httpReq.Header.Set("Content-Encoding", tc.contentEncoding)
+			}
+			httpReq = httpReq.WithContext(user.InjectOrgID(httpReq.Context(), "test"))
+
+			pushed := false
+			pushFunc := func(ctx context.Context, req *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+				defer cleanup()
+				pushed = true
+
+				require.Len(t, req.Timeseries, 1)
+				assert.Equal(t, []mimirpb.LabelAdapter{
+					{Name: "__name__", Value: "http_requests_in_flight"},
+					{Name: "host_name", Value: "host-1"},
+					{Name: "instance", Value: "instance-1"},
+					{Name: "job", Value: "namespace-1/service-1"},
+					{Name: "method", Value: "GET"},
+					{Name: "service_instance_id", Value: "instance-1"},
+					{Name: "service_name", Value: "service-1"},
+					{Name: "service_namespace", Value: "namespace-1"},
+				}, req.Timeseries[0].Labels)
+				assert.Equal(t, []mimirpb.Sample{{TimestampMs: ts.UnixMilli(), Value: 12}}, req.Timeseries[0].Samples)
+				assert.Equal(t, mimirpb.API, req.Source)
+
+				require.Len(t, req.Metadata, 1)
+				assert.Equal(t, mimirpb.GAUGE, req.Metadata[0].Type)
+				assert.Equal(t, "http_requests_in_flight", req.Metadata[0].MetricFamilyName)
+
+				return &mimirpb.WriteResponse{}, tc.pushErr
+			}
+
+			resp := httptest.NewRecorder()
+			OTLPHandler(100000, nil, false, pushFunc).ServeHTTP(resp, httpReq)
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			assert.Equal(t, tc.expectedCode != http.StatusBadRequest, pushed)
+		})
+	}
+}
+
+func TestOTLPHandler_ShouldRejectTooLargeRequests(t *testing.T) {
+	body, err := pmetricotlp.NewRequestFromMetrics(createOTLPGaugeMetrics(time.Now())).MarshalProto()
+	require.NoError(t, err)
+
+	httpReq := httptest.NewRequest("POST", "/otlp/v1/metrics", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", pbContentType)
+	httpReq = httpReq.WithContext(user.InjectOrgID(httpReq.Context(), "test"))
+
+	resp := httptest.NewRecorder()
+	OTLPHandler(len(body)-1, nil, false, func(context.Context, *mimirpb.WriteRequest, func()) (*mimirpb.WriteResponse, error) {
+		t.Fatal("push should not be called")
+		return nil, nil
+	}).ServeHTTP(resp, httpReq)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestOTLPHandler_ShouldIngestTranslatedDataPointsAndReportDroppedOnes(t *testing.T) {
+	const userID = "otlp-dropped"
+	ts := time.Unix(100, 0)
+
+	md := createOTLPGaugeMetrics(ts)
+	metrics := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+
+	delta := metrics.AppendEmpty()
+	delta.SetName("delta")
+	delta.SetDataType(pmetric.MetricDataTypeHistogram)
+	delta.Histogram().SetAggregationTemporality(pmetric.MetricAggregationTemporalityDelta)
+	delta.Histogram().DataPoints().AppendEmpty().SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	delta.Histogram().DataPoints().AppendEmpty().SetTimestamp(pcommon.NewTimestampFromTime(ts))
+
+	exponential := metrics.AppendEmpty()
+	exponential.SetName("exponential")
+	exponential.SetDataType(pmetric.MetricDataTypeExponentialHistogram)
+	exponential.ExponentialHistogram().DataPoints().AppendEmpty().SetTimestamp(pcommon.NewTimestampFromTime(ts))
+
+	body, err := pmetricotlp.NewRequestFromMetrics(md).MarshalProto()
+	require.NoError(t, err)
+
+	httpReq := httptest.NewRequest("POST", "/otlp/v1/metrics", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", pbContentType)
+	httpReq = httpReq.WithContext(user.InjectOrgID(httpReq.Context(), userID))
+
+	var pushedSeries int
+	resp := httptest.NewRecorder()
+	OTLPHandler(100000, nil, false, func(_ context.Context, req *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+		defer cleanup()
+		pushedSeries = len(req.Timeseries)
+		return &mimirpb.WriteResponse{}, nil
+	}).ServeHTTP(resp, httpReq)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "dropped 2 data points with delta temporality and 1 exponential histogram data points")
+	assert.Equal(t, 1, pushedSeries)
+	assert.Equal(t, float64(2), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.ReasonOTLPDeltaTemporality, userID)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.ReasonOTLPExponentialHistogram, userID)))
+}
+
+func TestOTelMetricsToTimeseries(t *testing.T) {
+	ts := time.Unix(100, 0)
+	tsMs := ts.UnixMilli()
+
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().InsertString("service.name", "svc")
+	metrics := rm.ScopeMetrics().AppendEmpty().Metrics()
+
+	// Monotonic cumulative sum with an exemplar.
+	sum := metrics.AppendEmpty()
+	sum.SetName("requests.total")
+	sum.SetDataType(pmetric.MetricDataTypeSum)
+	sum.Sum().SetIsMonotonic(true)
+	sum.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+	sumPoint := sum.Sum().DataPoints().AppendEmpty()
+	sumPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	sumPoint.SetIntVal(5)
+	exemplar := sumPoint.Exemplars().AppendEmpty()
+	exemplar.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	exemplar.SetDoubleVal(1)
+	exemplar.SetTraceID(pcommon.NewTraceID([16]byte{1}))
+
+	// Monotonic delta sum, which can't be translated.
+	delta := metrics.AppendEmpty()
+	delta.SetName("delta")
+	delta.SetDataType(pmetric.MetricDataTypeSum)
+	delta.Sum().SetIsMonotonic(true)
+	delta.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityDelta)
+	delta.Sum().DataPoints().AppendEmpty().SetTimestamp(pcommon.NewTimestampFromTime(ts))
+
+	// Cumulative histogram.
+	histogram := metrics.AppendEmpty()
+	histogram.SetName("latency")
+	histogram.SetDataType(pmetric.MetricDataTypeHistogram)
+	histogram.Histogram().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+	histogramPoint := histogram.Histogram().DataPoints().AppendEmpty()
+	histogramPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	histogramPoint.SetCount(6)
+	histogramPoint.SetSum(10)
+	histogramPoint.SetMExplicitBounds([]float64{1, 5})
+	histogramPoint.SetMBucketCounts([]uint64{1, 2, 3})
+	histogramExemplar := histogramPoint.Exemplars().AppendEmpty()
+	histogramExemplar.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	histogramExemplar.SetDoubleVal(3)
+
+	// Summary with a stale data point.
+	summary := metrics.AppendEmpty()
+	summary.SetName("1st_summary")
+	summary.SetDataType(pmetric.MetricDataTypeSummary)
+	summaryPoint := summary.Summary().DataPoints().AppendEmpty()
+	summaryPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	summaryPoint.SetFlags(pmetric.NewMetricDataPointFlags(pmetric.MetricDataPointFlagNoRecordedValue))
+	quantile := summaryPoint.QuantileValues().AppendEmpty()
+	quantile.SetQuantile(0.5)
+	quantile.SetValue(2)
+
+	series, dropped := otelMetricsToTimeseries(md)
+	defer mimirpb.ReuseSlice(series)
+	assert.Equal(t, otelDroppedPoints{deltaTemporality: 1}, dropped)
+
+	type sampleWithExemplars struct {
+		value     float64
+		exemplars []mimirpb.Exemplar
+	}
+	actual := map[string]sampleWithExemplars{}
+	for _, s := range series {
+		require.Len(t, s.Samples, 1)
+		require.Equal(t, tsMs, s.Samples[0].TimestampMs)
+		actual[mimirpb.FromLabelAdaptersToLabels(s.Labels).String()] = sampleWithExemplars{value: s.Samples[0].Value, exemplars: s.Exemplars}
+	}
+
+	staleNaN := math.Float64frombits(value.StaleNaN)
+	expected := map[string]sampleWithExemplars{
+		`{__name__="requests_total", job="svc", service_name="svc"}`: {value: 5, exemplars: []mimirpb.Exemplar{{
+			Labels:      []mimirpb.LabelAdapter{{Name: "trace_id", Value: "01000000000000000000000000000000"}},
+			Value:       1,
+			TimestampMs: tsMs,
+		}}},
+		`{__name__="latency_sum", job="svc", service_name="svc"}`:            {value: 10},
+		`{__name__="latency_count", job="svc", service_name="svc"}`:          {value: 6},
+		`{__name__="latency_bucket", job="svc", le="1", service_name="svc"}`: {value: 1},
+		`{__name__="latency_bucket", job="svc", le="5", service_name="svc"}`: {value: 3, exemplars: []mimirpb.Exemplar{{
+			Labels:      []mimirpb.LabelAdapter{},
+			Value:       3,
+			TimestampMs: tsMs,
+		}}},
+		`{__name__="latency_bucket", job="svc", le="+Inf", service_name="svc"}`:       {value: 6},
+		`{__name__="key_1st_summary_sum", job="svc", service_name="svc"}`:             {value: staleNaN},
+		`{__name__="key_1st_summary_count", job="svc", service_name="svc"}`:           {value: staleNaN},
+		`{__name__="key_1st_summary", job="svc", quantile="0.5", service_name="svc"}`: {value: staleNaN},
+	}
+
+	require.Len(t, actual, len(expected))
+	for lbls, exp := range expected {
+		act, ok := actual[lbls]
+		require.True(t, ok, "series %s not found", lbls)
+		if value.IsStaleNaN(exp.value) {
+			assert.True(t, value.IsStaleNaN(act.value), lbls)
+		} else {
+			assert.Equal(t, exp.value, act.value, lbls)
+		}
+		assert.Len(t, act.exemplars, len(exp.exemplars), lbls)
+		for i := range exp.exemplars {
+			assert.Equal(t, exp.exemplars[i].Value, act.exemplars[i].Value, lbls)
+			assert.Equal(t, exp.exemplars[i].TimestampMs, act.exemplars[i].TimestampMs, lbls)
+			assert.ElementsMatch(t, exp.exemplars[i].Labels, act.exemplars[i].Labels, lbls)
+		}
+	}
+}
+
+func createOTLPGaugeMetrics(ts time.Time) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().InsertString("service.name", "service-1")
+	rm.Resource().Attributes().InsertString("service.namespace", "namespace-1")
+	rm.Resource().Attributes().InsertString("service.instance.id", "instance-1")
+	rm.Resource().Attributes().InsertString("host.name", "host-1")
+
+	metric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName("http.requests.in_flight")
+	metric.SetDataType(pmetric.MetricDataTypeGauge)
+	point := metric.Gauge().DataPoints().AppendEmpty()
+	point.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	point.SetDoubleVal(12)
+	point.Attributes().InsertString("method", "GET")
+
+	return md
+}
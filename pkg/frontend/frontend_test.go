@@ -35,6 +35,7 @@ import (
 	"github.com/grafana/mimir/pkg/frontend/transport"
 	"github.com/grafana/mimir/pkg/frontend/v1/frontendv1pb"
 	querier_worker "github.com/grafana/mimir/pkg/querier/worker"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const (
@@ -289,3 +290,7 @@ type limits struct {
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
+
+func (l limits) QueryPriorityRules(_ string) []validation.QueryPriorityRule {
+	return nil
+}
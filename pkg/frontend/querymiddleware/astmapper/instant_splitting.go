@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package astmapper
+
+import (
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// splittableRangeFuncs maps the range vector functions which can be split by time to the aggregation
+// used to combine the results of the time partitions.
+var splittableRangeFuncs = map[string]parser.ItemType{
+	"sum_over_time":   parser.SUM,
+	"count_over_time": parser.SUM,
+	"max_over_time":   parser.MAX,
+	"min_over_time":   parser.MIN,
+	"increase":        parser.SUM,
+	"rate":            parser.SUM,
+}
+
+// NewInstantQuerySplitter creates a new instant query splitting mapper. The range vector functions
+// whose range is longer than interval are split into time partitions of at most interval, which are
+// executed as embedded queries.
+func NewInstantQuerySplitter(interval time.Duration, logger log.Logger) ASTMapper {
+	return NewMultiMapper(
+		NewASTNodeMapper(&instantSplitter{
+			interval: interval,
+			logger:   logger,
+		}),
+		newSubtreeFolder(),
+	)
+}
+
+type instantSplitter struct {
+	interval time.Duration
+	logger   log.Logger
+}
+
+// MapNode implements NodeMapper.
+func (s *instantSplitter) MapNode(node parser.Node, stats *MapperStats) (mapped parser.Node, finished bool, err error) {
+	switch n := node.(type) {
+	case *parser.Call:
+		if _, ok := splittableRangeFuncs[n.Func.Name]; !ok {
+			return n, false, nil
+		}
+
+		rangeArg, ok := rangeOf(n)
+		if !ok || rangeArg <= s.interval || s.interval <= time.Millisecond {
+			return n, true, nil
+		}
+
+		mapped, err := s.splitCall(n, rangeArg, stats)
+		if err != nil {
+			return nil, true, err
+		}
+		level.Debug(s.logger).Log("msg", "range vector function has been split by time", "original", n, "split", mapped)
+		return mapped, true, nil
+
+	case *parser.SubqueryExpr:
+		// The embedded queries would only be evaluated at the query time, and not at each step of the subquery,
+		// so we can't split the functions inside a subquery. The subquery itself is split if it's the argument
+		// of a splittable function, which is handled above.
+		return n, true, nil
+
+	default:
+		return n, false, nil
+	}
+}
+
+// splitCall splits the range vector function call into one call per time partition. The calls are squashed
+// into a CONCAT expression, whose results are combined with the aggregation matching the function.
+func (s *instantSplitter) splitCall(call *parser.Call, rangeArg time.Duration, stats *MapperStats) (parser.Expr, error) {
+	/*
+		splitting a range vector function by 1h is representable naively as
+
+		sum without() (
+		  sum_over_time(metric[59m59s999ms]) or
+		  sum_over_time(metric[59m59s999ms] offset 1h) or
+		  sum_over_time(metric[1h] offset 2h)
+		)
+
+		The boundaries of a range are inclusive, so all the time partitions but the oldest one exclude their
+		first millisecond, which is already included by the older partition. The rate and increase functions
+		are approximated, because the increase between the last sample of a partition and the first sample
+		of the next one is lost.
+	*/
+	partitions := int((rangeArg + s.interval - 1) / s.interval)
+	children := make([]parser.Node, 0, partitions)
+
+	for i := 0; i < partitions; i++ {
+		offset := time.Duration(i) * s.interval
+		partitionRange := s.interval - time.Millisecond
+		if i == partitions-1 {
+			partitionRange = rangeArg - offset
+		}
+
+		cloned, err := cloneNode(call)
+		if err != nil {
+			return nil, err
+		}
+		clonedCall := cloned.(*parser.Call)
+
+		switch arg := clonedCall.Args[0].(type) {
+		case *parser.MatrixSelector:
+			vs, ok := arg.VectorSelector.(*parser.VectorSelector)
+			if !ok {
+				return nil, errors.Errorf("invalid selector type: %T", arg.VectorSelector)
+			}
+			vs.OriginalOffset += offset
+			arg.Range = partitionRange
+		case *parser.SubqueryExpr:
+			arg.OriginalOffset += offset
+			arg.Range = partitionRange
+		}
+
+		// The increase of each partition is summed and then divided by the whole range.
+		if clonedCall.Func.Name == "rate" {
+			clonedCall.Func = parser.Functions["increase"]
+		}
+
+		children = append(children, clonedCall)
+	}
+
+	// Update stats.
+	stats.AddSplitQueries(partitions)
+
+	squashed, err := vectorSquasher(children...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The time partitions of the same series have the same labels, so we aggregate them without
+	// dropping any label.
+	var combined parser.Expr = &parser.AggregateExpr{
+		Op:      splittableRangeFuncs[call.Func.Name],
+		Expr:    squashed,
+		Without: true,
+	}
+	if call.Func.Name == "rate" {
+		combined = &parser.BinaryExpr{
+			Op:  parser.DIV,
+			LHS: combined,
+			RHS: &parser.NumberLiteral{Val: rangeArg.Seconds()},
+		}
+	}
+
+	return &parser.ParenExpr{Expr: combined}, nil
+}
+
+// rangeOf returns the range of the matrix selector or subquery passed as the first argument of the call.
+func rangeOf(call *parser.Call) (time.Duration, bool) {
+	if len(call.Args) == 0 {
+		return 0, false
+	}
+
+	switch arg := call.Args[0].(type) {
+	case *parser.MatrixSelector:
+		return arg.Range, true
+	case *parser.SubqueryExpr:
+		return arg.Range, true
+	default:
+		return 0, false
+	}
+}
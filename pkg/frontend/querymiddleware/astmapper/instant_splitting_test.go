@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package astmapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstantQuerySplitter(t *testing.T) {
+	for _, tt := range []struct {
+		in                   string
+		out                  string
+		expectedSplitQueries int
+	}{
+		// Range shorter than or equal to the interval.
+		{
+			in:  `sum_over_time(foo[1h])`,
+			out: concat(`sum_over_time(foo[1h])`),
+		},
+		// Not splittable functions.
+		{
+			in:  `avg_over_time(foo[3h])`,
+			out: concat(`avg_over_time(foo[3h])`),
+		},
+		{
+			in:  `absent_over_time(foo[3h])`,
+			out: concat(`absent_over_time(foo[3h])`),
+		},
+		{
+			in: `sum_over_time(foo{bar="baz"}[3h])`,
+			out: `(sum without() (` + concat(
+				`sum_over_time(foo{bar="baz"}[59m59s999ms])`,
+				`sum_over_time(foo{bar="baz"}[59m59s999ms] offset 1h)`,
+				`sum_over_time(foo{bar="baz"}[1h] offset 2h)`,
+			) + `))`,
+			expectedSplitQueries: 3,
+		},
+		{
+			in: `count_over_time(foo[150m] offset 1d)`,
+			out: `(sum without() (` + concat(
+				`count_over_time(foo[59m59s999ms] offset 1d)`,
+				`count_over_time(foo[59m59s999ms] offset 1d1h)`,
+				`count_over_time(foo[30m] offset 1d2h)`,
+			) + `))`,
+			expectedSplitQueries: 3,
+		},
+		{
+			in: `max_over_time(foo[2h] @ 1000)`,
+			out: `(max without() (` + concat(
+				`max_over_time(foo[59m59s999ms] @ 1000)`,
+				`max_over_time(foo[1h] @ 1000 offset 1h)`,
+			) + `))`,
+			expectedSplitQueries: 2,
+		},
+		{
+			in: `min_over_time(foo[2h])`,
+			out: `(min without() (` + concat(
+				`min_over_time(foo[59m59s999ms])`,
+				`min_over_time(foo[1h] offset 1h)`,
+			) + `))`,
+			expectedSplitQueries: 2,
+		},
+		{
+			in: `increase(foo[2h])`,
+			out: `(sum without() (` + concat(
+				`increase(foo[59m59s999ms])`,
+				`increase(foo[1h] offset 1h)`,
+			) + `))`,
+			expectedSplitQueries: 2,
+		},
+		{
+			in: `rate(foo[2h])`,
+			out: `(sum without() (` + concat(
+				`increase(foo[59m59s999ms])`,
+				`increase(foo[1h] offset 1h)`,
+			) + `) / 7200)`,
+			expectedSplitQueries: 2,
+		},
+		// Subqueries passed to splittable functions are split too.
+		{
+			in: `max_over_time(rate(foo[5m])[2h:1m])`,
+			out: `(max without() (` + concat(
+				`max_over_time(rate(foo[5m])[59m59s999ms:1m])`,
+				`max_over_time(rate(foo[5m])[1h:1m] offset 1h)`,
+			) + `))`,
+			expectedSplitQueries: 2,
+		},
+		// Functions inside subqueries are not split.
+		{
+			in:  `max_over_time(sum_over_time(foo[2h])[5m:1m])`,
+			out: concat(`max_over_time(sum_over_time(foo[2h])[5m:1m])`),
+		},
+		// Splittable functions nested in other expressions.
+		{
+			in: `sum by(bar) (rate(foo[2h])) > 1`,
+			out: `sum by(bar) ((sum without() (` + concat(
+				`increase(foo[59m59s999ms])`,
+				`increase(foo[1h] offset 1h)`,
+			) + `) / 7200)) > 1`,
+			expectedSplitQueries: 2,
+		},
+		{
+			in: `sum_over_time(foo[2h]) / on() group_left() bar`,
+			out: `(sum without() (` + concat(
+				`sum_over_time(foo[59m59s999ms])`,
+				`sum_over_time(foo[1h] offset 1h)`,
+			) + `)) / on() group_left() ` + concat(`bar`),
+			expectedSplitQueries: 2,
+		},
+		{
+			in: `max_over_time(foo[2h]) + min_over_time(foo[2h])`,
+			out: `(max without() (` + concat(
+				`max_over_time(foo[59m59s999ms])`,
+				`max_over_time(foo[1h] offset 1h)`,
+			) + `)) + (min without() (` + concat(
+				`min_over_time(foo[59m59s999ms])`,
+				`min_over_time(foo[1h] offset 1h)`,
+			) + `))`,
+			expectedSplitQueries: 4,
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.in, func(t *testing.T) {
+			mapper := NewInstantQuerySplitter(time.Hour, log.NewNopLogger())
+			expr, err := parser.ParseExpr(tt.in)
+			require.NoError(t, err)
+			out, err := parser.ParseExpr(tt.out)
+			require.NoError(t, err)
+
+			stats := NewMapperStats()
+			mapped, err := mapper.Map(expr, stats)
+			require.NoError(t, err)
+			require.Equal(t, out.String(), mapped.String())
+			assert.Equal(t, tt.expectedSplitQueries, stats.GetSplitQueries())
+		})
+	}
+}
@@ -14,11 +14,17 @@ import (
 )
 
 var summableAggregates = map[parser.ItemType]struct{}{
-	parser.SUM:   {},
-	parser.MIN:   {},
-	parser.MAX:   {},
-	parser.COUNT: {},
-	parser.AVG:   {},
+	parser.SUM:          {},
+	parser.MIN:          {},
+	parser.MAX:          {},
+	parser.COUNT:        {},
+	parser.AVG:          {},
+	parser.TOPK:         {},
+	parser.BOTTOMK:      {},
+	parser.GROUP:        {},
+	parser.COUNT_VALUES: {},
+	parser.STDDEV:       {},
+	parser.STDVAR:       {},
 }
 
 // NonParallelFuncs is the list of functions that shouldn't be parallelized.
@@ -53,6 +59,12 @@ func CanParallelize(node parser.Node, logger log.Logger) bool {
 			return false
 		}
 
+		// The parameter of TOPK and BOTTOMK is evaluated by the outer aggregation in the query-frontend too,
+		// where only embedded queries can be selected, so it must be a constant.
+		if (n.Op == parser.TOPK || n.Op == parser.BOTTOMK) && !isConstantScalar(n.Param) {
+			return false
+		}
+
 		// Ensure there are no nested aggregations
 		nestedAggrs, err := anyNode(n.Expr, isAggregateExpr)
 
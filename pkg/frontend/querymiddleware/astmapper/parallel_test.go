@@ -125,6 +125,22 @@ func TestCanParallel_String(t *testing.T) {
 			)`,
 			false,
 		},
+		{
+			`topk(10, rate(foo[1m]))`,
+			true,
+		},
+		{
+			`topk(scalar(bar), rate(foo[1m]))`,
+			false,
+		},
+		{
+			`count_values("value", foo)`,
+			true,
+		},
+		{
+			`stddev by (foo) (rate(bar[1m]))`,
+			true,
+		},
 		{
 			`min_over_time(
 				sum by(group_1) (
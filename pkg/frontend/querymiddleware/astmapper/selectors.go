@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package astmapper
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Selector is a vector selector along with the length of the time range it selects at each evaluation step.
+type Selector struct {
+	*parser.VectorSelector
+
+	// Range is the sum of the ranges of the matrix selectors and subqueries wrapping the vector selector,
+	// or 0 if the vector selector is not wrapped by any of them.
+	Range time.Duration
+}
+
+// VectorSelectors returns all the vector selectors in the input node, including the ones
+// wrapped by matrix selectors and subqueries, in the order they're found while walking the AST.
+func VectorSelectors(node parser.Node) []Selector {
+	var selectors []Selector
+
+	parser.Inspect(node, func(n parser.Node, path []parser.Node) error {
+		selector, ok := n.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+
+		s := Selector{VectorSelector: selector}
+		for _, p := range path {
+			switch p := p.(type) {
+			case *parser.MatrixSelector:
+				s.Range += p.Range
+			case *parser.SubqueryExpr:
+				s.Range += p.Range
+			}
+		}
+		selectors = append(selectors, s)
+		return nil
+	})
+
+	return selectors
+}
+
+// SeriesSelector returns the series selector (eg. {__name__="up",job="app"}) matching the same series
+// of the input vector selector, without the offset and @ modifiers.
+func SeriesSelector(selector *parser.VectorSelector) string {
+	matchers := make([]string, 0, len(selector.LabelMatchers))
+	for _, m := range selector.LabelMatchers {
+		matchers = append(matchers, m.String())
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package astmapper
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorSelectors(t *testing.T) {
+	for query, expected := range map[string][]string{
+		`1 + 1`: nil,
+		`up`:    {`{__name__="up"} 0s`},
+		`sum by (job) (rate(http_requests_total{job=~"app.*"}[5m] offset 1h))`: {
+			`{job=~"app.*",__name__="http_requests_total"} 5m0s`,
+		},
+		`max_over_time(rate(up{job="a"}[1m])[1h:1m] @ 1000) / on() group_left vector(1) + absent(down)`: {
+			`{job="a",__name__="up"} 1h1m0s`,
+			`{__name__="down"} 0s`,
+		},
+		`{__name__=~"up|down",env!=""} * up`: {
+			`{__name__=~"up|down",env!=""} 0s`,
+			`{__name__="up"} 0s`,
+		},
+	} {
+		t.Run(query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(query)
+			require.NoError(t, err)
+
+			var actual []string
+			for _, selector := range VectorSelectors(expr) {
+				actual = append(actual, SeriesSelector(selector.VectorSelector)+" "+selector.Range.String())
+			}
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/prometheus/prometheus/promql/parser"
 
 	"github.com/grafana/mimir/pkg/storage/sharding"
+	"github.com/grafana/mimir/pkg/util"
 )
 
 // NewSharding creates a new query sharding mapper.
@@ -29,6 +30,10 @@ func NewSharding(shards int, logger log.Logger) (ASTMapper, error) {
 	), nil
 }
 
+// stdvarShardLabelName is the label added to the per-shard results of a sharded STDVAR
+// aggregation to tell them apart when merging them.
+const stdvarShardLabelName = "__stdvar_shard__"
+
 type squasher = func(...parser.Node) (parser.Expr, error)
 
 type shardSummer struct {
@@ -222,6 +227,30 @@ func (summer *shardSummer) shardAggregate(expr *parser.AggregateExpr, stats *Map
 			return nil, false, err
 		}
 		return mapped, true, nil
+	case parser.TOPK, parser.BOTTOMK, parser.GROUP:
+		mapped, err = summer.shardTwoStage(expr, stats)
+		if err != nil {
+			return nil, false, err
+		}
+		return mapped, true, nil
+	case parser.COUNT_VALUES:
+		mapped, err = summer.shardCountValues(expr, stats)
+		if err != nil {
+			return nil, false, err
+		}
+		return mapped, true, nil
+	case parser.STDDEV, parser.STDVAR:
+		mapped, err = summer.shardStdvar(expr, stats)
+		if err != nil {
+			return nil, false, err
+		}
+		if expr.Op == parser.STDDEV {
+			mapped = &parser.Call{
+				Func: parser.Functions["sqrt"],
+				Args: parser.Expressions{mapped.(parser.Expr)},
+			}
+		}
+		return mapped, true, nil
 	}
 
 	// If the aggregation operation is not shardable, we have to return the input
@@ -330,28 +359,225 @@ func (summer *shardSummer) shardAvg(expr *parser.AggregateExpr, stats *MapperSta
 	}, nil
 }
 
+// shardTwoStage attempts to shard the given TOPK, BOTTOMK or GROUP aggregation expression.
+func (summer *shardSummer) shardTwoStage(expr *parser.AggregateExpr, stats *MapperStats) (result parser.Node, err error) {
+	/*
+		The TOPK, BOTTOMK and GROUP aggregations can be parallelized running the same aggregation
+		on each shard, and then on the results of all shards. For example:
+
+		topk by(foo) (10,
+		  topk by(foo) (10, bar1{__query_shard__="0_of_2"}) or
+		  topk by(foo) (10, bar1{__query_shard__="1_of_2"})
+		)
+	*/
+	sharded, err := summer.shardAndSquash(expr.Expr, stats, func(_ int, sharded parser.Expr) parser.Expr {
+		return &parser.AggregateExpr{
+			Op:       expr.Op,
+			Expr:     sharded,
+			Param:    expr.Param,
+			Grouping: expr.Grouping,
+			Without:  expr.Without,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser.AggregateExpr{
+		Op:       expr.Op,
+		Expr:     sharded,
+		Param:    expr.Param,
+		Grouping: expr.Grouping,
+		Without:  expr.Without,
+	}, nil
+}
+
+// shardCountValues attempts to shard the given COUNT_VALUES aggregation expression.
+func (summer *shardSummer) shardCountValues(expr *parser.AggregateExpr, stats *MapperStats) (result parser.Node, err error) {
+	/*
+		The COUNT_VALUES aggregation can be parallelized as the SUM of per-shard COUNT_VALUES,
+		grouped by the same labels plus the label holding the values:
+
+		sum by(foo, value) (
+		  count_values by(foo) ("value", bar1{__query_shard__="0_of_2"}) or
+		  count_values by(foo) ("value", bar1{__query_shard__="1_of_2"})
+		)
+
+		When grouping "without", the per-shard results have no metric name and the same labels for the
+		same values, so they're summed without dropping any label.
+	*/
+	label, ok := expr.Param.(*parser.StringLiteral)
+	if !ok {
+		return nil, errors.Errorf("expected string literal parameter for COUNT_VALUES while got %T", expr.Param)
+	}
+
+	sharded, err := summer.shardAndSquashAggregateExpr(expr, parser.COUNT_VALUES, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	grouping := expr.Grouping
+	if !expr.Without && !util.StringsContain(grouping, label.Val) {
+		grouping = append(append(make([]string, 0, len(grouping)+1), grouping...), label.Val)
+	}
+	if expr.Without {
+		grouping = nil
+	}
+
+	return &parser.AggregateExpr{
+		Op:       parser.SUM,
+		Expr:     sharded,
+		Grouping: grouping,
+		Without:  expr.Without,
+	}, nil
+}
+
+// shardStdvar attempts to shard the given STDDEV or STDVAR aggregation expression, returning
+// the STDVAR expression.
+func (summer *shardSummer) shardStdvar(expr *parser.AggregateExpr, stats *MapperStats) (result parser.Expr, err error) {
+	/*
+		The STDVAR aggregation is parallelized merging the per-shard count (C), average (A) and
+		variance (V) with the parallel variance formula, which doesn't suffer from the catastrophic
+		cancellation of the sum of squares minus the squared sum. Each per-shard result is tagged
+		with the shard it comes from, so that the results of different shards don't collide:
+
+		N = sum(label_replace(count(bar1{__query_shard__="0_of_2"}), "__stdvar_shard__", "0_of_2", "", "") or ...)
+		M = sum(C * A) / N
+		sum(C * (V + (A - ignoring(__stdvar_shard__) group_left M) ^ 2)) / N
+
+		The same per-shard expression is referenced multiple times, but it's only executed once
+		by the query-frontend because the embedded queries results are cached by query.
+
+		The QUANTILE aggregation can't be sharded in the same way, because per-shard quantiles
+		can't be merged into the exact quantile of all series without having all of them.
+	*/
+	shardAndTag := func(op parser.ItemType) (parser.Expr, error) {
+		return summer.shardAndSquash(expr.Expr, stats, func(shard int, sharded parser.Expr) parser.Expr {
+			return &parser.Call{
+				Func: parser.Functions["label_replace"],
+				Args: parser.Expressions{
+					&parser.AggregateExpr{
+						Op:       op,
+						Expr:     sharded,
+						Grouping: expr.Grouping,
+						Without:  expr.Without,
+					},
+					&parser.StringLiteral{Val: stdvarShardLabelName},
+					&parser.StringLiteral{Val: sharding.ShardSelector{ShardIndex: uint64(shard), ShardCount: uint64(summer.shards)}.LabelValue()},
+					&parser.StringLiteral{Val: ""},
+					&parser.StringLiteral{Val: ""},
+				},
+			}
+		})
+	}
+
+	counts, err := shardAndTag(parser.COUNT)
+	if err != nil {
+		return nil, err
+	}
+	avgs, err := shardAndTag(parser.AVG)
+	if err != nil {
+		return nil, err
+	}
+	stdvars, err := shardAndTag(parser.STDVAR)
+	if err != nil {
+		return nil, err
+	}
+
+	// The outer aggregations merge the results of all shards, so the shard label must be dropped.
+	grouping := expr.Grouping
+	if expr.Without {
+		grouping = append(append(make([]string, 0, len(grouping)+1), grouping...), stdvarShardLabelName)
+	}
+	sum := func(e parser.Expr) parser.Expr {
+		return &parser.AggregateExpr{
+			Op:       parser.SUM,
+			Expr:     e,
+			Grouping: grouping,
+			Without:  expr.Without,
+		}
+	}
+
+	total := sum(counts)
+	mean := &parser.BinaryExpr{
+		Op: parser.DIV,
+		LHS: sum(&parser.BinaryExpr{
+			Op:             parser.MUL,
+			LHS:            counts,
+			RHS:            avgs,
+			VectorMatching: &parser.VectorMatching{Card: parser.CardOneToOne},
+		}),
+		RHS:            total,
+		VectorMatching: &parser.VectorMatching{Card: parser.CardOneToOne},
+	}
+	delta := &parser.BinaryExpr{
+		Op:  parser.SUB,
+		LHS: avgs,
+		RHS: &parser.ParenExpr{Expr: mean},
+		VectorMatching: &parser.VectorMatching{
+			Card:           parser.CardManyToOne,
+			MatchingLabels: []string{stdvarShardLabelName},
+		},
+	}
+
+	return &parser.ParenExpr{
+		Expr: &parser.BinaryExpr{
+			Op: parser.DIV,
+			LHS: sum(&parser.BinaryExpr{
+				Op:  parser.MUL,
+				LHS: counts,
+				RHS: &parser.ParenExpr{
+					Expr: &parser.BinaryExpr{
+						Op:  parser.ADD,
+						LHS: stdvars,
+						RHS: &parser.BinaryExpr{
+							Op:  parser.POW,
+							LHS: &parser.ParenExpr{Expr: delta},
+							RHS: &parser.NumberLiteral{Val: 2},
+						},
+						VectorMatching: &parser.VectorMatching{Card: parser.CardOneToOne},
+					},
+				},
+				VectorMatching: &parser.VectorMatching{Card: parser.CardOneToOne},
+			}),
+			RHS:            total,
+			VectorMatching: &parser.VectorMatching{Card: parser.CardOneToOne},
+		},
+	}, nil
+}
+
 // shardAndSquashAggregateExpr returns a squashed CONCAT expression including N embedded
 // queries, where N is the number of shards and each sub-query queries a different shard
 // with the given "op" aggregation operation.
 func (summer *shardSummer) shardAndSquashAggregateExpr(expr *parser.AggregateExpr, op parser.ItemType, stats *MapperStats) (parser.Expr, error) {
+	return summer.shardAndSquash(expr.Expr, stats, func(_ int, sharded parser.Expr) parser.Expr {
+		// Create the child expression, which runs the given aggregation operation
+		// on a single shard. We need to preserve the grouping and the parameter
+		// as they were in the original one.
+		return &parser.AggregateExpr{
+			Op:       op,
+			Expr:     sharded,
+			Param:    expr.Param,
+			Grouping: expr.Grouping,
+			Without:  expr.Without,
+		}
+	})
+}
+
+// shardAndSquash returns a squashed CONCAT expression including N embedded queries, where
+// N is the number of shards and each sub-query is built by the child function from the
+// given expression mapped to a different shard.
+func (summer *shardSummer) shardAndSquash(expr parser.Expr, stats *MapperStats, child func(shard int, sharded parser.Expr) parser.Expr) (parser.Expr, error) {
 	children := make([]parser.Node, 0, summer.shards)
 
 	// Create sub-query for each shard.
 	for i := 0; i < summer.shards; i++ {
-		sharded, err := cloneAndMap(NewASTNodeMapper(summer.CopyWithCurShard(i)), expr.Expr, stats)
+		sharded, err := cloneAndMap(NewASTNodeMapper(summer.CopyWithCurShard(i)), expr, stats)
 		if err != nil {
 			return nil, err
 		}
 
-		// Create the child expression, which runs the given aggregation operation
-		// on a single shard. We need to preserve the grouping as it was
-		// in the original one.
-		children = append(children, &parser.AggregateExpr{
-			Op:       op,
-			Expr:     sharded.(parser.Expr),
-			Grouping: expr.Grouping,
-			Without:  expr.Without,
-		})
+		children = append(children, child(i, sharded.(parser.Expr)))
 	}
 
 	// Update stats.
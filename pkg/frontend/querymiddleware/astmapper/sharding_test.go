@@ -175,6 +175,57 @@ func TestShardSummer(t *testing.T) {
 				`)`,
 			6,
 		},
+		{
+			`topk by (foo) (10, rate(bar1[1m]))`,
+			`topk by (foo) (10, ` + concatShards(3, `topk by (foo) (10, rate(bar1{__query_shard__="x_of_y"}[1m]))`) + `)`,
+			3,
+		},
+		{
+			`bottomk without (foo) (5, bar1)`,
+			`bottomk without (foo) (5, ` + concatShards(3, `bottomk without (foo) (5, bar1{__query_shard__="x_of_y"})`) + `)`,
+			3,
+		},
+		{
+			`topk(scalar(bar2), bar1)`,
+			concat(`topk(scalar(bar2), bar1)`),
+			0,
+		},
+		{
+			`group by (foo) (bar1)`,
+			`group by (foo) (` + concatShards(3, `group by (foo) (bar1{__query_shard__="x_of_y"})`) + `)`,
+			3,
+		},
+		{
+			`count_values by (foo) ("value", bar1)`,
+			`sum by (foo, value) (` + concatShards(3, `count_values by (foo) ("value", bar1{__query_shard__="x_of_y"})`) + `)`,
+			3,
+		},
+		{
+			`count_values without (foo) ("value", bar1)`,
+			`sum without () (` + concatShards(3, `count_values without (foo) ("value", bar1{__query_shard__="x_of_y"})`) + `)`,
+			3,
+		},
+		{
+			`stdvar by (foo) (bar1)`,
+			`(sum by (foo) (` + concatShards(3, `label_replace(count by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` * (` + concatShards(3, `label_replace(stdvar by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` + (` + concatShards(3, `label_replace(avg by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` - ignoring (__stdvar_shard__) group_left () (` +
+				`sum by (foo) (` + concatShards(3, `label_replace(count by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` * ` + concatShards(3, `label_replace(avg by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + `) / sum by (foo) (` + concatShards(3, `label_replace(count by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + `))) ^ 2)) / ` +
+				`sum by (foo) (` + concatShards(3, `label_replace(count by (foo) (bar1{__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + `))`,
+			9,
+		},
+		{
+			`stddev(rate(bar1[1m]))`,
+			`sqrt(` + `(sum (` + concatShards(3, `label_replace(count (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + ` * (` + concatShards(3, `label_replace(stdvar (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + ` + (` + concatShards(3, `label_replace(avg (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + ` - ignoring (__stdvar_shard__) group_left () (` +
+				`sum (` + concatShards(3, `label_replace(count (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + ` * ` + concatShards(3, `label_replace(avg (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + `) / sum (` + concatShards(3, `label_replace(count (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + `))) ^ 2)) / ` +
+				`sum (` + concatShards(3, `label_replace(count (rate(bar1{__query_shard__="x_of_y"}[1m])), "__stdvar_shard__", "x_of_y", "", "")`) + `))` + `)`,
+			9,
+		},
+		{
+			`stddev without (foo) ({__name__=~"bar1|bar2"})`,
+			`sqrt(` + `(sum without (foo, __stdvar_shard__) (` + concatShards(3, `label_replace(count without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` * (` + concatShards(3, `label_replace(stdvar without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` + (` + concatShards(3, `label_replace(avg without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` - ignoring (__stdvar_shard__) group_left () (` +
+				`sum without (foo, __stdvar_shard__) (` + concatShards(3, `label_replace(count without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + ` * ` + concatShards(3, `label_replace(avg without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + `) / sum without (foo, __stdvar_shard__) (` + concatShards(3, `label_replace(count without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + `))) ^ 2)) / ` +
+				`sum without (foo, __stdvar_shard__) (` + concatShards(3, `label_replace(count without (foo) ({__name__=~"bar1|bar2",__query_shard__="x_of_y"}), "__stdvar_shard__", "x_of_y", "", "")`) + `))` + `)`,
+			9,
+		},
 		{
 			`min_over_time(metric_counter[5m])`,
 			concat(`min_over_time(metric_counter[5m])`),
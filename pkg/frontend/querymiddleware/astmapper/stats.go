@@ -4,6 +4,7 @@ package astmapper
 
 type MapperStats struct {
 	shardedQueries int
+	splitQueries   int
 }
 
 func NewMapperStats() *MapperStats {
@@ -19,3 +20,13 @@ func (s *MapperStats) AddShardedQueries(num int) {
 func (s *MapperStats) GetShardedQueries() int {
 	return s.shardedQueries
 }
+
+// AddSplitQueries add num split queries to the counter.
+func (s *MapperStats) AddSplitQueries(num int) {
+	s.splitQueries += num
+}
+
+// GetSplitQueries returns the number of split queries.
+func (s *MapperStats) GetSplitQueries() int {
+	return s.splitQueries
+}
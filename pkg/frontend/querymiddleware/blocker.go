@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/regexp"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/globalerror"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+var errQueryBlocked = apierror.New(apierror.TypeBadData, globalerror.QueryBlocked.Message("the request has been blocked by the cluster administrator"))
+
+type queryBlockerMiddleware struct {
+	next                Handler
+	limits              Limits
+	logger              log.Logger
+	blockedQueriesCount *prometheus.CounterVec
+
+	// patterns caches the compiled patterns of the blocked queries, shared by all the middleware instances.
+	patterns *blockedPatterns
+}
+
+// newQueryBlockerMiddleware creates a new Middleware that rejects the queries blocked for the tenant.
+func newQueryBlockerMiddleware(limits Limits, logger log.Logger, reg prometheus.Registerer) Middleware {
+	blockedQueriesCount := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_blocked_queries_total",
+		Help: "Total number of queries rejected because blocked for the tenant.",
+	}, []string{"user"})
+	patterns := &blockedPatterns{}
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &queryBlockerMiddleware{
+			next:                next,
+			limits:              limits,
+			logger:              logger,
+			blockedQueriesCount: blockedQueriesCount,
+			patterns:            patterns,
+		}
+	})
+}
+
+func (b *queryBlockerMiddleware) Do(ctx context.Context, req Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	query := normalizeQuery(req.GetQuery())
+	timeRange := time.Duration(req.GetEnd()-req.GetStart()) * time.Millisecond
+
+	for _, tenantID := range tenantIDs {
+		for _, blocked := range b.limits.BlockedQueries(tenantID) {
+			if !b.isBlocked(query, timeRange, blocked) {
+				continue
+			}
+
+			spanLog := spanlogger.FromContext(ctx, b.logger)
+			level.Info(spanLog).Log("msg", "query blocked", "user", tenantID, "query", query, "pattern", blocked.Pattern, "regex", blocked.Regex)
+			b.blockedQueriesCount.WithLabelValues(tenantID).Inc()
+			return nil, errQueryBlocked
+		}
+	}
+
+	return b.next.Do(ctx, req)
+}
+
+// isBlocked returns whether the normalized query, whose time range has the given length, matches the blocked query.
+func (b *queryBlockerMiddleware) isBlocked(query string, timeRange time.Duration, blocked validation.BlockedQuery) bool {
+	if minTimeRange := time.Duration(blocked.MinTimeRange); minTimeRange > 0 && timeRange < minTimeRange {
+		return false
+	}
+
+	matches, err := b.patterns.matches(blocked, query)
+	if err != nil {
+		// The regular expressions are validated when loading the limits, so this should never happen.
+		level.Warn(b.logger).Log("msg", "invalid blocked query regular expression", "pattern", blocked.Pattern, "err", err)
+		return false
+	}
+	return matches
+}
+
+// blockedPatterns compiles the patterns of the blocked queries once, and caches them by pattern.
+// The patterns come from the limits, so the number of cached patterns is bounded by the configuration.
+type blockedPatterns struct {
+	exact sync.Map // Normalized query by pattern.
+	regex sync.Map // *regexp.Regexp by pattern.
+}
+
+// matches returns whether the normalized query matches the pattern of the blocked query.
+func (p *blockedPatterns) matches(blocked validation.BlockedQuery, query string) (bool, error) {
+	if !blocked.Regex {
+		normalized, ok := p.exact.Load(blocked.Pattern)
+		if !ok {
+			normalized, _ = p.exact.LoadOrStore(blocked.Pattern, normalizeQuery(blocked.Pattern))
+		}
+		return query == normalized.(string), nil
+	}
+
+	re, ok := p.regex.Load(blocked.Pattern)
+	if !ok {
+		compiled, err := regexp.Compile("^(?:" + blocked.Pattern + ")$")
+		if err != nil {
+			return false, err
+		}
+		re, _ = p.regex.LoadOrStore(blocked.Pattern, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(query), nil
+}
+
+// normalizeQuery returns the query formatted by the PromQL parser, so that queries differing only
+// by formatting are equal. The query is returned as is if it can't be parsed.
+func normalizeQuery(query string) string {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return query
+	}
+	return expr.String()
+}
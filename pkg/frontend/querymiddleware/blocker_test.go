@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestQueryBlockerMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		query          string
+		timeRange      time.Duration
+		blockedQueries []validation.BlockedQuery
+		expectedBlock  bool
+	}{
+		"should not block a query if no query is blocked": {
+			query:         `{__name__=~".+"}`,
+			expectedBlock: false,
+		},
+		"should block a query exactly matching a blocked query": {
+			query:          `{__name__=~".+"}`,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `{__name__=~".+"}`}},
+			expectedBlock:  true,
+		},
+		"should block a query matching a blocked query once normalized": {
+			query:          `sum  by(job) (rate(metric[5m]))`,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `sum(rate(metric[5m])) by (job)`}},
+			expectedBlock:  true,
+		},
+		"should not block a query only containing a blocked query": {
+			query:          `count({__name__=~".+"})`,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `{__name__=~".+"}`}},
+			expectedBlock:  false,
+		},
+		"should block a query matching a blocked regular expression": {
+			query:          `count({__name__=~".+"})`,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `.*__name__=~"\.\+".*`, Regex: true}},
+			expectedBlock:  true,
+		},
+		"should not block a query partially matching a blocked regular expression": {
+			query:          `count(up)`,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `count`, Regex: true}},
+			expectedBlock:  false,
+		},
+		"should block a query whose time range is longer than the blocked query min time range": {
+			query:          `up`,
+			timeRange:      24 * time.Hour,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `up`, MinTimeRange: model.Duration(12 * time.Hour)}},
+			expectedBlock:  true,
+		},
+		"should not block a query whose time range is shorter than the blocked query min time range": {
+			query:          `up`,
+			timeRange:      time.Hour,
+			blockedQueries: []validation.BlockedQuery{{Pattern: `up`, MinTimeRange: model.Duration(12 * time.Hour)}},
+			expectedBlock:  false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			mw := newQueryBlockerMiddleware(mockLimits{blockedQueries: tc.blockedQueries}, log.NewNopLogger(), reg)
+
+			downstreamReqs := 0
+			handler := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+				downstreamReqs++
+				return newEmptyPrometheusResponse(), nil
+			}))
+
+			end := time.Now().UnixMilli()
+			req := &PrometheusRangeQueryRequest{
+				Path:  "/api/v1/query_range",
+				Start: end - tc.timeRange.Milliseconds(),
+				End:   end,
+				Step:  1000,
+				Query: tc.query,
+			}
+
+			_, err := handler.Do(user.InjectOrgID(context.Background(), "user-1"), req)
+			if !tc.expectedBlock {
+				require.NoError(t, err)
+				assert.Equal(t, 1, downstreamReqs)
+				assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(""), "cortex_query_frontend_blocked_queries_total"))
+				return
+			}
+
+			require.Error(t, err)
+			assert.True(t, apierror.IsAPIError(err))
+			assert.Contains(t, err.Error(), "err-mimir-query-blocked")
+			assert.Equal(t, 0, downstreamReqs)
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_query_frontend_blocked_queries_total Total number of queries rejected because blocked for the tenant.
+				# TYPE cortex_query_frontend_blocked_queries_total counter
+				cortex_query_frontend_blocked_queries_total{user="user-1"} 1
+			`)))
+		})
+	}
+}
+
+func TestBlockedPatterns(t *testing.T) {
+	p := &blockedPatterns{}
+	exact := validation.BlockedQuery{Pattern: `sum  by(job) (up)`}
+	regex := validation.BlockedQuery{Pattern: `count\(.*\)`, Regex: true}
+
+	// Each pattern is compiled once, and then reused for the following queries.
+	for i := 0; i < 2; i++ {
+		matches, err := p.matches(exact, normalizeQuery(`sum by (job) (up)`))
+		require.NoError(t, err)
+		assert.True(t, matches)
+
+		matches, err = p.matches(regex, `count(up)`)
+		require.NoError(t, err)
+		assert.True(t, matches)
+
+		matches, err = p.matches(regex, `sum(count(up))`)
+		require.NoError(t, err)
+		assert.False(t, matches)
+	}
+
+	cached, ok := p.regex.Load(regex.Pattern)
+	require.True(t, ok)
+	matches, err := p.matches(regex, `count(up)`)
+	require.NoError(t, err)
+	assert.True(t, matches)
+	reloaded, _ := p.regex.Load(regex.Pattern)
+	assert.Same(t, cached, reloaded)
+
+	_, err = p.matches(validation.BlockedQuery{Pattern: `count(`, Regex: true}, `count(up)`)
+	assert.Error(t, err)
+}
@@ -9,8 +9,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"net/url"
 	"sort"
@@ -38,7 +38,10 @@ var (
 	errStepTooSmall   = apierror.New(apierror.TypeBadData, "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")
 
 	// PrometheusCodec is a codec to encode and decode Prometheus query range requests and responses.
-	PrometheusCodec Codec = prometheusCodec{}
+	PrometheusCodec = NewPrometheusCodec(formatJSON)
+
+	// allFormats are the formats of the query results which can be requested to the queriers.
+	allFormats = []string{formatJSON, formatProtobuf}
 )
 
 const (
@@ -48,6 +51,12 @@ const (
 	statusError = "error"
 
 	totalShardsControlHeader = "Sharding-Control"
+
+	// Formats of the query results returned by the queriers.
+	formatJSON     = "json"
+	formatProtobuf = "protobuf"
+
+	jsonMediaType = "application/json"
 )
 
 // Codec is used to encode/decode query range requests and responses so they can be passed down to middlewares.
@@ -108,7 +117,17 @@ type Response interface {
 	GetHeaders() []*PrometheusResponseHeader
 }
 
-type prometheusCodec struct{}
+type prometheusCodec struct {
+	// The format of the query results requested to the queriers.
+	preferredQueryResultResponseFormat string
+}
+
+// NewPrometheusCodec returns a codec to encode and decode Prometheus query range requests and responses,
+// which requests the query results to the queriers in the input format. Responses are decoded based on
+// their content type, so that queriers not supporting the requested format can reply with JSON.
+func NewPrometheusCodec(queryResultResponseFormat string) Codec {
+	return prometheusCodec{preferredQueryResultResponseFormat: queryResultResponseFormat}
+}
 
 func (prometheusCodec) MergeResponse(responses ...Response) (Response, error) {
 	if len(responses) == 0 {
@@ -171,7 +190,7 @@ func (prometheusCodec) decodeRangeQueryRequest(r *http.Request) (Request, error)
 		return nil, errEndBeforeStart
 	}
 
-	result.Step, err = parseDurationMs(r.FormValue("step"))
+	result.Step, err = util.ParseDurationMs(r.FormValue("step"))
 	if err != nil {
 		return nil, decorateWithParamName(err, "step")
 	}
@@ -181,8 +200,7 @@ func (prometheusCodec) decodeRangeQueryRequest(r *http.Request) (Request, error)
 	}
 
 	// For safety, limit the number of returned points per timeseries.
-	// This is sufficient for 60s resolution for a week or 1h resolution for a year.
-	if (result.End-result.Start)/result.Step > 11000 {
+	if (result.End-result.Start)/result.Step > util.MaxQueryResolutionPoints {
 		return nil, errStepTooSmall
 	}
 
@@ -226,7 +244,7 @@ func decodeOptions(r *http.Request, opts *Options) {
 	}
 }
 
-func (prometheusCodec) EncodeRequest(ctx context.Context, r Request) (*http.Request, error) {
+func (c prometheusCodec) EncodeRequest(ctx context.Context, r Request) (*http.Request, error) {
 	var u *url.URL
 	switch r := r.(type) {
 	case *PrometheusRangeQueryRequest:
@@ -259,6 +277,11 @@ func (prometheusCodec) EncodeRequest(ctx context.Context, r Request) (*http.Requ
 		Header:     http.Header{},
 	}
 
+	// Ask the queriers for the preferred format, falling back to JSON for the queriers not supporting it.
+	if c.preferredQueryResultResponseFormat == formatProtobuf {
+		req.Header.Set("Accept", mimirpb.QueryResponseMediaType+", "+jsonMediaType)
+	}
+
 	return req.WithContext(ctx), nil
 }
 
@@ -275,14 +298,27 @@ func (prometheusCodec) DecodeResponse(ctx context.Context, r *http.Response, _ R
 	defer log.Finish()
 	log.LogFields(otlog.Int("status_code", r.StatusCode))
 
-	buf, err := bodyBuffer(r)
-	if err != nil {
-		log.Error(err)
-		return nil, err
+	// The response is decoded while being read, and the bytes read are charged to the response size limiter
+	// as they're read, so that the query is aborted as soon as the limit is exceeded, without reading the
+	// rest of the response in memory.
+	var err error
+	body := responseSizeLimiterFromContext(ctx).reader(r.Body)
+	if r.Header.Get("Content-Type") == mimirpb.QueryResponseMediaType {
+		// A protobuf message can't be decoded until it has been fully read.
+		var buf []byte
+		if buf, err = ioutil.ReadAll(body); err == nil {
+			err = unmarshalQueryResponse(buf, &resp)
+		}
+	} else {
+		err = json.NewDecoder(body).Decode(&resp)
 	}
-	log.LogFields(otlog.Int("bytes", len(buf)))
+	log.LogFields(otlog.Int("bytes", body.read))
 
-	if err := json.Unmarshal(buf, &resp); err != nil {
+	if body.err != nil {
+		log.Error(body.err)
+		return nil, body.err
+	}
+	if err != nil {
 		return nil, apierror.Newf(apierror.TypeInternal, "error decoding response: %v", err)
 	}
 
@@ -295,6 +331,26 @@ func (prometheusCodec) DecodeResponse(ctx context.Context, r *http.Response, _ R
 	}
 	return &resp, nil
 }
+
+// unmarshalQueryResponse decodes a mimirpb.QueryResponse returned by a querier into resp. The warnings of
+// the query are ignored, like they are in the JSON format, because PrometheusResponse doesn't carry them.
+func unmarshalQueryResponse(buf []byte, resp *PrometheusResponse) error {
+	var qr mimirpb.QueryResponse
+	if err := qr.Unmarshal(buf); err != nil {
+		return err
+	}
+
+	resp.Status = statusSuccess
+	resp.Data = &PrometheusData{
+		ResultType: qr.ResultType,
+		Result:     make([]SampleStream, 0, len(qr.Result)),
+	}
+	for _, series := range qr.Result {
+		resp.Data.Result = append(resp.Data.Result, SampleStream{Labels: series.Labels, Samples: series.Samples})
+	}
+	return nil
+}
+
 func (prometheusCodec) EncodeResponse(ctx context.Context, res Response) (*http.Response, error) {
 	sp, _ := opentracing.StartSpanFromContext(ctx, "APIResponse.ToHTTPResponse")
 	defer sp.Finish()
@@ -307,6 +363,19 @@ func (prometheusCodec) EncodeResponse(ctx context.Context, res Response) (*http.
 		sp.LogFields(otlog.Int("series", len(a.Data.Result)))
 	}
 
+	// Matrix responses can be very large, so they're encoded progressively while being read,
+	// one series at a time, instead of buffering the whole encoded response in memory.
+	if isStreamableResponse(a) {
+		return &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body:          newMatrixResponseBody(a),
+			StatusCode:    http.StatusOK,
+			ContentLength: -1,
+		}, nil
+	}
+
 	b, err := json.Marshal(a)
 	if err != nil {
 		return nil, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
@@ -325,6 +394,72 @@ func (prometheusCodec) EncodeResponse(ctx context.Context, res Response) (*http.
 	return &resp, nil
 }
 
+// isStreamableResponse returns whether the response can be encoded by matrixResponseBody.
+func isStreamableResponse(res *PrometheusResponse) bool {
+	return res.Status == statusSuccess && res.ErrorType == "" && res.Error == "" &&
+		res.Data != nil && res.Data.ResultType == model.ValMatrix.String()
+}
+
+// matrixResponseBody is a response body which progressively encodes a successful matrix response
+// to JSON while being read. The output is the same as json.Marshal(), but at most the encoding of
+// a single series is buffered in memory at any time.
+type matrixResponseBody struct {
+	res *PrometheusResponse
+	buf bytes.Buffer
+
+	// The index of the next series to encode, and the error returned once the encoding ended.
+	next int
+	err  error
+}
+
+func newMatrixResponseBody(res *PrometheusResponse) *matrixResponseBody {
+	return &matrixResponseBody{res: res}
+}
+
+func (b *matrixResponseBody) Read(p []byte) (int, error) {
+	for b.buf.Len() == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.err = b.encodeNext()
+	}
+	return b.buf.Read(p)
+}
+
+// encodeNext encodes the next chunk of the response to the buffer. Returns io.EOF once the
+// whole response has been encoded.
+func (b *matrixResponseBody) encodeNext() error {
+	result := b.res.Data.Result
+
+	if b.next == 0 {
+		b.buf.WriteString(`{"status":"success","data":{"resultType":"matrix","result":[`)
+	} else {
+		b.buf.WriteByte(',')
+	}
+
+	if b.next < len(result) {
+		encoded, err := json.Marshal(&result[b.next])
+		if err != nil {
+			return apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
+		}
+		b.buf.Write(encoded)
+		b.next++
+
+		if b.next < len(result) {
+			return nil
+		}
+	}
+
+	b.buf.WriteString(`]}}`)
+	return io.EOF
+}
+
+func (b *matrixResponseBody) Close() error {
+	b.buf.Reset()
+	b.err = io.ErrClosedPipe
+	return nil
+}
+
 func matrixMerge(resps []*PrometheusResponse) []SampleStream {
 	output := map[string]*SampleStream{}
 	for _, resp := range resps {
@@ -408,20 +543,6 @@ func bodyBuffer(res *http.Response) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func parseDurationMs(s string) (int64, error) {
-	if d, err := strconv.ParseFloat(s, 64); err == nil {
-		ts := d * float64(time.Second/time.Millisecond)
-		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
-			return 0, apierror.Newf(apierror.TypeBadData, "cannot parse %q to a valid duration. It overflows int64", s)
-		}
-		return int64(ts), nil
-	}
-	if d, err := model.ParseDuration(s); err == nil {
-		return int64(d) / int64(time.Millisecond/time.Nanosecond), nil
-	}
-	return 0, apierror.Newf(apierror.TypeBadData, "cannot parse %q to a valid duration", s)
-}
-
 func encodeTime(t int64) string {
 	f := float64(t) / 1.0e3
 	return strconv.FormatFloat(f, 'f', -1, 64)
@@ -9,11 +9,14 @@ package querymiddleware
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"testing"
+	"testing/iotest"
 
 	"github.com/go-kit/log"
 	jsoniter "github.com/json-iterator/go"
@@ -25,6 +28,7 @@ import (
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 var (
@@ -114,6 +118,70 @@ type prometeheusResponseData struct {
 	Result model.Value     `json:"result"`
 }
 
+func TestPrometheusCodec_EncodeRequest_AcceptHeader(t *testing.T) {
+	for format, expected := range map[string]string{
+		formatJSON:     "",
+		formatProtobuf: mimirpb.QueryResponseMediaType + ", " + jsonMediaType,
+	} {
+		t.Run(format, func(t *testing.T) {
+			req, err := NewPrometheusCodec(format).EncodeRequest(context.Background(), &PrometheusInstantQueryRequest{Path: "/api/v1/query", Query: "up"})
+			require.NoError(t, err)
+			assert.Equal(t, expected, req.Header.Get("Accept"))
+		})
+	}
+}
+
+func TestPrometheusCodec_DecodeResponse_Protobuf(t *testing.T) {
+	series := []mimirpb.QueryResponseSeries{
+		{
+			Labels:  []mimirpb.LabelAdapter{{Name: "foo", Value: "bar"}},
+			Samples: []mimirpb.Sample{{TimestampMs: 1_000, Value: 1}, {TimestampMs: 2_000, Value: 2}},
+		},
+		{
+			Labels:  []mimirpb.LabelAdapter{{Name: "foo", Value: "baz"}},
+			Samples: []mimirpb.Sample{{TimestampMs: 1_000, Value: 3}},
+		},
+	}
+	body, err := (&mimirpb.QueryResponse{ResultType: matrix, Result: series, Warnings: []string{"warning"}}).Marshal()
+	require.NoError(t, err)
+
+	expected := &PrometheusResponse{
+		Status: statusSuccess,
+		Data: &PrometheusData{
+			ResultType: matrix,
+			Result: []SampleStream{
+				{Labels: series[0].Labels, Samples: series[0].Samples},
+				{Labels: series[1].Labels, Samples: series[1].Samples},
+			},
+		},
+		Headers: []*PrometheusResponseHeader{{Name: "Content-Type", Values: []string{mimirpb.QueryResponseMediaType}}},
+	}
+
+	for name, body := range map[string]io.ReadCloser{
+		"buffered body": bufferedBody{bytes.NewBuffer(body)},
+		"read body":     ioutil.NopCloser(bytes.NewReader(body)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{mimirpb.QueryResponseMediaType}},
+				Body:       body,
+			}
+
+			actual, err := NewPrometheusCodec(formatProtobuf).DecodeResponse(context.Background(), resp, nil, log.NewNopLogger())
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+// bufferedBody is a response body which has already been read in memory, like the httpgrpc round tripper does.
+type bufferedBody struct {
+	*bytes.Buffer
+}
+
+func (bufferedBody) Close() error { return nil }
+
 func TestResponseRoundtrip(t *testing.T) {
 	headers := http.Header{"Content-Type": []string{"application/json"}}
 	expectedRespHeaders := []*PrometheusResponseHeader{
@@ -285,7 +353,118 @@ func TestResponseRoundtrip(t *testing.T) {
 			require.NoError(t, err)
 
 			require.JSONEq(t, string(expectedJSON), string(encodedJSON))
-			assert.Equal(t, httpResponse, encoded)
+			assert.Equal(t, httpResponse.StatusCode, encoded.StatusCode)
+			assert.Equal(t, httpResponse.Header.Get("Content-Type"), encoded.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestPrometheusCodec_EncodeResponse_ShouldStreamMatrixResponses(t *testing.T) {
+	for _, numSeries := range []int{0, 1, 10} {
+		t.Run(fmt.Sprintf("series: %d", numSeries), func(t *testing.T) {
+			res := mockPrometheusResponse(numSeries, 10)
+			res.Data.ResultType = matrix
+			expected, err := json.Marshal(res)
+			require.NoError(t, err)
+
+			encoded, err := PrometheusCodec.EncodeResponse(context.Background(), res)
+			require.NoError(t, err)
+			assert.Equal(t, int64(-1), encoded.ContentLength)
+
+			// Read the body one byte at a time, to make sure the progressive encoding works with any buffer size.
+			actual, err := ioutil.ReadAll(iotest.OneByteReader(encoded.Body))
+			require.NoError(t, err)
+			require.NoError(t, encoded.Body.Close())
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestPrometheusCodec_DecodeResponse_ShouldLimitResponseSize(t *testing.T) {
+	res := mockPrometheusResponse(10, 10)
+	res.Data.ResultType = matrix
+	body, err := json.Marshal(res)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		limit         int
+		responses     int
+		expectedError bool
+	}{
+		"no limit": {
+			limit:     0,
+			responses: 3,
+		},
+		"responses below the limit": {
+			limit:     3 * len(body),
+			responses: 3,
+		},
+		"single response above the limit": {
+			limit:         len(body) - 1,
+			responses:     1,
+			expectedError: true,
+		},
+		"total size of the responses above the limit": {
+			limit:         2*len(body) + 1,
+			responses:     3,
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		for _, buffered := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s, buffered: %t", name, buffered), func(t *testing.T) {
+				ctx := contextWithResponseSizeLimiter(context.Background(), newResponseSizeLimiter(tc.limit))
+
+				var err error
+				for i := 0; i < tc.responses && err == nil; i++ {
+					var responseBody io.Reader = bytes.NewBuffer(body)
+					if !buffered {
+						// Hide the Bytes() function of the buffer.
+						responseBody = iotest.HalfReader(responseBody)
+					}
+
+					_, err = PrometheusCodec.DecodeResponse(ctx, &http.Response{
+						StatusCode: 200,
+						Body:       ioutil.NopCloser(responseBody),
+					}, nil, log.NewNopLogger())
+				}
+
+				if tc.expectedError {
+					require.Error(t, err)
+					assert.Equal(t, apierror.New(apierror.TypeBadData, validation.NewMaxQueryResponseSizeError(tc.limit).Error()), err)
+				} else {
+					require.NoError(t, err)
+				}
+			})
+		}
+	}
+}
+
+func TestPrometheusCodec_DecodeResponse_ShouldStopReadingOnceResponseSizeLimitIsExceeded(t *testing.T) {
+	res := mockPrometheusResponse(100, 10)
+	res.Data.ResultType = matrix
+	body, err := json.Marshal(res)
+	require.NoError(t, err)
+
+	for _, buffered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("buffered: %t", buffered), func(t *testing.T) {
+			const limit = 1024
+			ctx := contextWithResponseSizeLimiter(context.Background(), newResponseSizeLimiter(limit))
+
+			// Even a buffered response is charged to the limiter while being decoded.
+			buf := bytes.NewBuffer(body)
+			var responseBody io.Reader = buf
+			if !buffered {
+				responseBody = iotest.HalfReader(responseBody)
+			}
+
+			_, err := PrometheusCodec.DecodeResponse(ctx, &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(responseBody),
+			}, nil, log.NewNopLogger())
+			assert.Equal(t, apierror.New(apierror.TypeBadData, validation.NewMaxQueryResponseSizeError(limit).Error()), err)
+			assert.Greater(t, buf.Len(), len(body)/2)
 		})
 	}
 }
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/dskit/tenant"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/cache"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type instantQueryCacheMiddlewareMetrics struct {
+	cacheRequests prometheus.Counter
+	cacheHits     prometheus.Counter
+}
+
+func newInstantQueryCacheMiddlewareMetrics(reg prometheus.Registerer) *instantQueryCacheMiddlewareMetrics {
+	return &instantQueryCacheMiddlewareMetrics{
+		cacheRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_instant_query_results_cache_requests_total",
+			Help: "Total number of instant query requests looked up in the results cache",
+		}),
+		cacheHits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_instant_query_results_cache_hits_total",
+			Help: "Total number of instant query requests whose response has been found in the results cache",
+		}),
+	}
+}
+
+// instantQueryCacheMiddleware is a Middleware that caches the results of instant queries. Unlike range queries,
+// the results of instant queries can't be partially reused, so each response is cached as a whole, keyed on
+// the tenant, the normalized query and the evaluation time.
+type instantQueryCacheMiddleware struct {
+	next    Handler
+	limits  Limits
+	logger  log.Logger
+	metrics *instantQueryCacheMiddlewareMetrics
+
+	cache                  cache.Cache
+	step                   time.Duration
+	cacheUnalignedRequests bool
+	extractor              Extractor
+	shouldCacheReq         shouldCacheFn
+}
+
+// newInstantQueryCacheMiddleware makes a new instantQueryCacheMiddleware. Only the instant queries whose
+// evaluation time is aligned to the step are cached, unless cacheUnalignedRequests is true.
+func newInstantQueryCacheMiddleware(
+	cache cache.Cache,
+	step time.Duration,
+	cacheUnalignedRequests bool,
+	limits Limits,
+	extractor Extractor,
+	shouldCacheReq shouldCacheFn,
+	logger log.Logger,
+	reg prometheus.Registerer) Middleware {
+	metrics := newInstantQueryCacheMiddlewareMetrics(reg)
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &instantQueryCacheMiddleware{
+			next:                   next,
+			limits:                 limits,
+			logger:                 logger,
+			metrics:                metrics,
+			cache:                  cache,
+			step:                   step,
+			cacheUnalignedRequests: cacheUnalignedRequests,
+			extractor:              extractor,
+			shouldCacheReq:         shouldCacheReq,
+		}
+	})
+}
+
+func (c *instantQueryCacheMiddleware) Do(ctx context.Context, req Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	if c.shouldCacheReq != nil && !c.shouldCacheReq(req) {
+		return c.next.Do(ctx, req)
+	}
+
+	maxCacheFreshness := validation.MaxDurationPerTenant(tenantIDs, c.limits.MaxCacheFreshness)
+	maxCacheTime := int64(model.Now().Add(-maxCacheFreshness))
+	if !c.isRequestCachable(req, maxCacheTime) {
+		return c.next.Do(ctx, req)
+	}
+
+	key, err := generateInstantQueryCacheKey(tenant.JoinTenantIDs(tenantIDs), req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.metrics.cacheRequests.Inc()
+	if cached := c.fetchCachedResponse(ctx, key); cached != nil {
+		c.metrics.cacheHits.Inc()
+		return cached, nil
+	}
+
+	res, err := c.next.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if isResponseCachable(res, c.logger) {
+		c.storeCachedResponse(ctx, key, req, c.extractor.ResponseWithoutHeaders(res))
+	}
+	return res, nil
+}
+
+// isRequestCachable returns whether the instant query is eligible for caching. It's the equivalent
+// of isRequestCachable for instant queries, whose evaluation time must be aligned to the cache step.
+func (c *instantQueryCacheMiddleware) isRequestCachable(req Request, maxCacheTime int64) bool {
+	if !c.cacheUnalignedRequests && !isInstantQueryTimeAligned(req, c.step) {
+		return false
+	}
+
+	// Do not cache it at all if the evaluation time is more recent than the configured max cache freshness.
+	if req.GetStart() > maxCacheTime {
+		return false
+	}
+
+	return isAtModifierCachable(req, maxCacheTime, c.logger)
+}
+
+// fetchCachedResponse returns the response cached for the key, or nil in case of error or cache miss.
+func (c *instantQueryCacheMiddleware) fetchCachedResponse(ctx context.Context, key string) Response {
+	spanLog, ctx := spanlogger.NewWithLogger(ctx, c.logger, "fetchCachedResponse")
+	defer spanLog.Finish()
+
+	hashed := cacheHashKey(key)
+	spanLog.LogKV("key", key, "hashedKey", hashed)
+
+	founds := c.cache.Fetch(ctx, []string{hashed})
+	data, ok := founds[hashed]
+	if !ok {
+		return nil
+	}
+
+	var cached CachedResponse
+	if err := proto.Unmarshal(data, &cached); err != nil {
+		level.Error(spanLog).Log("msg", "error unmarshalling cached response", "err", err)
+		spanLog.Error(err)
+		return nil
+	}
+
+	// Ensure there's no hashed key collision.
+	if cached.Key != key || len(cached.Extents) != 1 {
+		return nil
+	}
+
+	res, err := cached.Extents[0].toResponse()
+	if err != nil {
+		level.Error(spanLog).Log("msg", "error decoding cached response", "err", err)
+		spanLog.Error(err)
+		return nil
+	}
+
+	spanLog.LogKV("returned bytes", len(data))
+	return res
+}
+
+// storeCachedResponse stores the response for the given key in the cache.
+func (c *instantQueryCacheMiddleware) storeCachedResponse(ctx context.Context, key string, req Request, res Response) {
+	extent, err := toExtent(ctx, req, res)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "error marshalling cached response", "err", err)
+		return
+	}
+
+	buf, err := proto.Marshal(&CachedResponse{
+		Key:     key,
+		Extents: []Extent{extent},
+	})
+	if err != nil {
+		level.Error(c.logger).Log("msg", "error marshalling cached response", "err", err)
+		return
+	}
+
+	c.cache.Store(ctx, map[string][]byte{cacheHashKey(key): buf}, resultsCacheTTL)
+}
+
+// generateInstantQueryCacheKey returns the cache key of the instant query for the tenant. The query is
+// normalized, and the start() and end() @ modifiers are resolved to the evaluation time, so that equivalent
+// queries share the same cache entry.
+func generateInstantQueryCacheKey(userID string, req Request) (string, error) {
+	query, err := evaluateAtModifierFunction(req.GetQuery(), req.GetStart(), req.GetEnd())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("instant:%s:%s:%d", userID, query, req.GetStart()), nil
+}
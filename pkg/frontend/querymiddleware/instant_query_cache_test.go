@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/cache"
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestInstantQueryCacheMiddleware(t *testing.T) {
+	now := time.Now()
+	alignedTime := now.Add(-time.Hour).Truncate(time.Minute).UnixMilli()
+
+	tests := map[string]struct {
+		query                  string
+		time                   int64
+		cacheUnalignedRequests bool
+		cacheDisabled          bool
+		expectedCached         bool
+	}{
+		"should cache a query with aligned evaluation time": {
+			query:          `sum(rate(metric[1m]))`,
+			time:           alignedTime,
+			expectedCached: true,
+		},
+		"should not cache a query with unaligned evaluation time": {
+			query:          `sum(rate(metric[1m]))`,
+			time:           alignedTime + 1000,
+			expectedCached: false,
+		},
+		"should cache a query with unaligned evaluation time if caching unaligned requests is enabled": {
+			query:                  `sum(rate(metric[1m]))`,
+			time:                   alignedTime + 1000,
+			cacheUnalignedRequests: true,
+			expectedCached:         true,
+		},
+		"should not cache a query whose evaluation time is more recent than the max cache freshness": {
+			query:          `sum(rate(metric[1m]))`,
+			time:           now.Truncate(time.Minute).UnixMilli(),
+			expectedCached: false,
+		},
+		"should not cache a query with @ modifier more recent than the max cache freshness": {
+			query:          `sum(rate(metric[1m] @ ` + model.TimeFromUnixNano(now.UnixNano()).String() + `))`,
+			time:           alignedTime,
+			expectedCached: false,
+		},
+		"should cache a query with @ end() modifier": {
+			query:          `sum(rate(metric[1m] @ end()))`,
+			time:           alignedTime,
+			expectedCached: true,
+		},
+		"should not cache a query if caching is disabled for the request": {
+			query:          `sum(rate(metric[1m]))`,
+			time:           alignedTime,
+			cacheDisabled:  true,
+			expectedCached: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cacheBackend := cache.NewInstrumentedMockCache()
+			reg := prometheus.NewPedanticRegistry()
+
+			mw := newInstantQueryCacheMiddleware(
+				cacheBackend,
+				time.Minute,
+				tc.cacheUnalignedRequests,
+				mockLimits{maxCacheFreshness: 10 * time.Minute},
+				PrometheusResponseExtractor{},
+				func(r Request) bool { return !r.GetOptions().CacheDisabled },
+				log.NewNopLogger(),
+				reg,
+			)
+
+			expectedResponse := &PrometheusResponse{
+				Status: "success",
+				Data: &PrometheusData{
+					ResultType: model.ValVector.String(),
+					Result: []SampleStream{
+						{
+							Labels:  []mimirpb.LabelAdapter{{Name: "foo", Value: "bar"}},
+							Samples: []mimirpb.Sample{{Value: 137, TimestampMs: tc.time}},
+						},
+					},
+				},
+			}
+
+			downstreamReqs := 0
+			handler := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+				downstreamReqs++
+				// The evaluation time of the query must never be changed.
+				assert.Equal(t, tc.time, req.GetStart())
+				return expectedResponse, nil
+			}))
+
+			req := &PrometheusInstantQueryRequest{
+				Path:    "/api/v1/query",
+				Time:    tc.time,
+				Query:   tc.query,
+				Options: Options{CacheDisabled: tc.cacheDisabled},
+			}
+
+			ctx := user.InjectOrgID(context.Background(), "1")
+			for i := 0; i < 2; i++ {
+				res, err := handler.Do(ctx, req)
+				require.NoError(t, err)
+				assert.Equal(t, expectedResponse, res)
+			}
+
+			expectedRequests, expectedHits, expectedDownstreamReqs, expectedStoreCalls := 0, 0, 2, 0
+			if tc.expectedCached {
+				expectedRequests, expectedHits, expectedDownstreamReqs, expectedStoreCalls = 2, 1, 1, 1
+			}
+			assert.Equal(t, expectedDownstreamReqs, downstreamReqs)
+			assert.Equal(t, expectedStoreCalls, cacheBackend.CountStoreCalls())
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_query_frontend_instant_query_results_cache_hits_total Total number of instant query requests whose response has been found in the results cache
+				# TYPE cortex_query_frontend_instant_query_results_cache_hits_total counter
+				cortex_query_frontend_instant_query_results_cache_hits_total `+strconv.Itoa(expectedHits)+`
+				# HELP cortex_query_frontend_instant_query_results_cache_requests_total Total number of instant query requests looked up in the results cache
+				# TYPE cortex_query_frontend_instant_query_results_cache_requests_total counter
+				cortex_query_frontend_instant_query_results_cache_requests_total `+strconv.Itoa(expectedRequests)+`
+			`)))
+		})
+	}
+}
+
+func TestInstantQueryCacheMiddleware_ShouldShareCacheEntryForEquivalentQueries(t *testing.T) {
+	cacheBackend := cache.NewInstrumentedMockCache()
+	mw := newInstantQueryCacheMiddleware(
+		cacheBackend,
+		time.Minute,
+		false,
+		mockLimits{maxCacheFreshness: 10 * time.Minute},
+		PrometheusResponseExtractor{},
+		resultsCacheAlwaysEnabled,
+		log.NewNopLogger(),
+		nil,
+	)
+
+	downstreamReqs := 0
+	handler := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+		downstreamReqs++
+		return &PrometheusResponse{Status: "success", Data: &PrometheusData{ResultType: model.ValVector.String()}}, nil
+	}))
+
+	evalTime := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	ctx := user.InjectOrgID(context.Background(), "1")
+
+	for _, query := range []string{
+		`sum(metric @ end())`,
+		`sum(metric @ start())`,
+		`sum(metric @ ` + model.TimeFromUnixNano(evalTime.UnixNano()).String() + `)`,
+	} {
+		_, err := handler.Do(ctx, &PrometheusInstantQueryRequest{Path: "/api/v1/query", Time: evalTime.UnixMilli(), Query: query})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, downstreamReqs)
+
+	// A different tenant doesn't share the cache entry.
+	_, err := handler.Do(user.InjectOrgID(context.Background(), "2"), &PrometheusInstantQueryRequest{Path: "/api/v1/query", Time: evalTime.UnixMilli(), Query: `sum(metric @ end())`})
+	require.NoError(t, err)
+	assert.Equal(t, 2, downstreamReqs)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/grafana/dskit/tenant"
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -49,6 +50,29 @@ type Limits interface {
 	// be run for a given received query. 0 to disable limit.
 	QueryShardingMaxShardedQueries(userID string) int
 
+	// ResultsCacheMaxMetadataEntrySize returns the max size in bytes of the label names, label values
+	// and series results cached for each split interval. 0 to disable the limit.
+	ResultsCacheMaxMetadataEntrySize(userID string) int
+
+	// BlockedQueries returns the queries blocked for the tenant.
+	BlockedQueries(userID string) []validation.BlockedQuery
+
+	// MaxEstimatedQueryCost returns the max estimated cost of a query, as the number of series
+	// matching the query selectors multiplied by the number of steps. 0 to disable the limit.
+	MaxEstimatedQueryCost(userID string) int
+
+	// LowPriorityEstimatedQueryCost returns the estimated cost of a query above which the query is
+	// executed with low priority. 0 to disable it.
+	LowPriorityEstimatedQueryCost(userID string) int
+
+	// MaxQueryResponseSizeBytes returns the max total size in bytes of the responses received by
+	// the query-frontend to execute a single query. 0 to disable the limit.
+	MaxQueryResponseSizeBytes(userID string) int
+
+	// SplitInstantQueriesByInterval returns the interval used to split the range vector functions
+	// of instant queries. 0 to disable it.
+	SplitInstantQueriesByInterval(userID string) time.Duration
+
 	// CompactorSplitAndMergeShards returns the number of shards to use when splitting blocks
 	// This method is copied from compactor.ConfigProvider.
 	CompactorSplitAndMergeShards(userID string) int
@@ -183,6 +207,14 @@ func (rt limitedParallelismRoundTripper) RoundTrip(r *http.Request) (*http.Respo
 		return nil, apierror.New(apierror.TypeBadData, err.Error())
 	}
 
+	// Limits the total size of the responses received from downstream for this query.
+	if maxSize := validation.SmallestPositiveIntPerTenant(tenantIDs, rt.limits.MaxQueryResponseSizeBytes); maxSize > 0 {
+		ctx = contextWithResponseSizeLimiter(ctx, newResponseSizeLimiter(maxSize))
+	}
+
+	// Keeps the headers of the original request, to propagate them to the requests sent downstream.
+	ctx = contextWithRequestHeaders(ctx, r.Header)
+
 	// Creates workers that will process the sub-requests in parallel for this query.
 	// The amount of workers is limited by the MaxQueryParallelism tenant setting.
 	parallelism := validation.SmallestPositiveIntPerTenant(tenantIDs, rt.limits.MaxQueryParallelism)
@@ -248,6 +280,12 @@ func (rth roundTripperHandler) Do(ctx context.Context, r Request) (Response, err
 	if err := user.InjectOrgIDIntoHTTPRequest(ctx, request); err != nil {
 		return nil, apierror.New(apierror.TypeBadData, err.Error())
 	}
+	propagateRequestHeaders(ctx, request)
+
+	// The queries whose estimated cost is too high are executed with low priority in the tenant's queue.
+	if isLowPriorityQuery(ctx) {
+		request.Header.Set(queue.PriorityHeader, queue.PriorityLow.String())
+	}
 
 	response, err := rth.next.RoundTrip(request)
 	if err != nil {
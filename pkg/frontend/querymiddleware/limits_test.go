@@ -20,6 +20,7 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
@@ -203,6 +204,12 @@ type mockLimits struct {
 	maxShardedQueries   int
 	totalShards         int
 	compactorShards     int
+	maxMetadataEntry    int
+	blockedQueries      []validation.BlockedQuery
+	maxEstimatedCost    int
+	lowPriorityCost     int
+	splitInstantQueries time.Duration
+	maxResponseSize     int
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -232,6 +239,30 @@ func (m mockLimits) QueryShardingMaxShardedQueries(string) int {
 	return m.maxShardedQueries
 }
 
+func (m mockLimits) ResultsCacheMaxMetadataEntrySize(string) int {
+	return m.maxMetadataEntry
+}
+
+func (m mockLimits) BlockedQueries(string) []validation.BlockedQuery {
+	return m.blockedQueries
+}
+
+func (m mockLimits) MaxEstimatedQueryCost(string) int {
+	return m.maxEstimatedCost
+}
+
+func (m mockLimits) LowPriorityEstimatedQueryCost(string) int {
+	return m.lowPriorityCost
+}
+
+func (m mockLimits) MaxQueryResponseSizeBytes(string) int {
+	return m.maxResponseSize
+}
+
+func (m mockLimits) SplitInstantQueriesByInterval(string) time.Duration {
+	return m.splitInstantQueries
+}
+
 func (m mockLimits) CompactorSplitAndMergeShards(userID string) int {
 	return m.compactorShards
 }
@@ -0,0 +1,555 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/regexp"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/cache"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	labelNamesPathSuffix = "/api/v1/labels"
+	seriesPathSuffix     = "/api/v1/series"
+)
+
+var labelValuesPathRegexp = regexp.MustCompile(`/api/v1/label/[^/]+/values$`)
+
+type metadataQueryRoundTripperMetrics struct {
+	splitQueriesCount prometheus.Counter
+	cacheRequests     prometheus.Counter
+	cacheHits         prometheus.Counter
+}
+
+func newMetadataQueryRoundTripperMetrics(reg prometheus.Registerer) *metadataQueryRoundTripperMetrics {
+	return &metadataQueryRoundTripperMetrics{
+		splitQueriesCount: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_frontend_metadata_split_queries_total",
+			Help: "Total number of underlying label names, label values and series requests after the split by interval is applied",
+		}),
+		cacheRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_frontend_metadata_query_results_cache_requests_total",
+			Help: "Total number of label names, label values and series requests looked up in the results cache",
+		}),
+		cacheHits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_frontend_metadata_query_results_cache_hits_total",
+			Help: "Total number of label names, label values and series requests whose response has been found in the results cache",
+		}),
+	}
+}
+
+// metadataQueryRoundTripper is a http.RoundTripper that splits the label names, label values and series
+// requests by time interval, runs the split requests through the results cache, and merges their results.
+type metadataQueryRoundTripper struct {
+	next    http.RoundTripper
+	limits  Limits
+	logger  log.Logger
+	metrics *metadataQueryRoundTripperMetrics
+
+	// Split by interval.
+	splitInterval time.Duration
+
+	// Results caching. The cache is nil if caching is disabled.
+	cache    cache.Cache
+	cacheTTL time.Duration
+}
+
+// newMetadataQueryRoundTripper makes a new metadataQueryRoundTripper. Requests are split by interval only
+// if splitInterval is greater than 0, and the results are cached only if c is not nil.
+func newMetadataQueryRoundTripper(
+	next http.RoundTripper,
+	splitInterval time.Duration,
+	c cache.Cache,
+	cacheTTL time.Duration,
+	limits Limits,
+	logger log.Logger,
+	metrics *metadataQueryRoundTripperMetrics,
+) http.RoundTripper {
+	return &metadataQueryRoundTripper{
+		next:          next,
+		limits:        limits,
+		logger:        logger,
+		metrics:       metrics,
+		splitInterval: splitInterval,
+		cache:         c,
+		cacheTTL:      cacheTTL,
+	}
+}
+
+func (rt *metadataQueryRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	req, err := decodeMetadataQueryRequest(r)
+	if err != nil || !req.hasTimeRange {
+		// Let the querier handle the requests we can't split or cache, including the invalid ones.
+		return rt.next.RoundTrip(r)
+	}
+
+	spanLog, ctx := spanlogger.NewWithLogger(ctx, rt.logger, "metadataQueryRoundTripper.RoundTrip")
+	defer spanLog.Finish()
+
+	splits := rt.splitRequest(req)
+	rt.metrics.splitQueriesCount.Add(float64(len(splits)))
+
+	// Lookup the results cache.
+	cacheEnabled := rt.cache != nil && !req.cacheDisabled
+	if cacheEnabled {
+		maxCacheFreshness := validation.MaxDurationPerTenant(tenantIDs, rt.limits.MaxCacheFreshness)
+		maxCacheTime := util.TimeToMillis(time.Now().Add(-maxCacheFreshness))
+		userID := tenant.JoinTenantIDs(tenantIDs)
+
+		for _, split := range splits {
+			// Do not cache the results of the time ranges more recent than the configured max cache freshness.
+			if split.end <= maxCacheTime {
+				split.cacheKey = generateMetadataQueryCacheKey(userID, req, split.start, split.end)
+			}
+		}
+		rt.fetchCachedResponses(ctx, splits)
+	}
+
+	// Run the requests whose results haven't been found in the cache.
+	var downstream []*metadataQuerySplit
+	for _, split := range splits {
+		if split.data == nil {
+			downstream = append(downstream, split)
+		}
+	}
+
+	parallelism := validation.SmallestPositiveIntPerTenant(tenantIDs, rt.limits.MaxQueryParallelism)
+	err = concurrency.ForEachJob(ctx, len(downstream), parallelism, func(ctx context.Context, idx int) error {
+		return rt.doRequest(ctx, req, downstream[idx])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the first unsuccessful response as is.
+	for _, split := range downstream {
+		if split.errResponse != nil {
+			return split.errResponse, nil
+		}
+	}
+
+	if cacheEnabled {
+		maxEntrySize := validation.SmallestPositiveIntPerTenant(tenantIDs, rt.limits.ResultsCacheMaxMetadataEntrySize)
+		rt.storeCachedResponses(ctx, downstream, maxEntrySize)
+	}
+
+	return mergeMetadataQueryResponses(req, splits)
+}
+
+// splitRequest splits the request time range into intervals aligned to the split interval.
+func (rt *metadataQueryRoundTripper) splitRequest(req *metadataQueryRequest) []*metadataQuerySplit {
+	if rt.splitInterval <= 0 {
+		return []*metadataQuerySplit{{start: req.start, end: req.end}}
+	}
+
+	var splits []*metadataQuerySplit
+	interval := rt.splitInterval.Milliseconds()
+	for start := req.start; start <= req.end; {
+		end := ((start/interval)+1)*interval - 1
+		if end > req.end {
+			end = req.end
+		}
+
+		splits = append(splits, &metadataQuerySplit{start: start, end: end})
+		start = end + 1
+	}
+	return splits
+}
+
+// doRequest runs the split request downstream and stores its result in the split.
+func (rt *metadataQueryRoundTripper) doRequest(ctx context.Context, req *metadataQueryRequest, split *metadataQuerySplit) error {
+	httpReq, err := req.toHTTPRequest(ctx, split.start, split.end)
+	if err != nil {
+		return err
+	}
+
+	res, err := rt.next.RoundTrip(httpReq)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := bodyBuffer(res)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		split.errResponse = res
+		return nil
+	}
+
+	var decoded metadataQueryResponse
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return apierror.Newf(apierror.TypeInternal, "error decoding response: %v", err)
+	}
+	if decoded.Status == statusError {
+		return apierror.New(apierror.Type(decoded.ErrorType), decoded.Error)
+	}
+
+	split.data = decoded.Data
+	split.warnings = decoded.Warnings
+	split.cachable = isMetadataQueryResponseCachable(res, &decoded)
+	return nil
+}
+
+// fetchCachedResponses looks up the results cache for the splits with a cache key, and stores the results
+// found in the splits.
+func (rt *metadataQueryRoundTripper) fetchCachedResponses(ctx context.Context, splits []*metadataQuerySplit) {
+	spanLog, ctx := spanlogger.NewWithLogger(ctx, rt.logger, "fetchCachedResponses")
+	defer spanLog.Finish()
+
+	hashedKeys := make([]string, 0, len(splits))
+	for _, split := range splits {
+		if split.cacheKey != "" {
+			hashedKeys = append(hashedKeys, cacheHashKey(split.cacheKey))
+		}
+	}
+	if len(hashedKeys) == 0 {
+		return
+	}
+
+	rt.metrics.cacheRequests.Add(float64(len(hashedKeys)))
+	founds := rt.cache.Fetch(ctx, hashedKeys)
+
+	hits := 0
+	for _, split := range splits {
+		if split.cacheKey == "" {
+			continue
+		}
+
+		data, ok := founds[cacheHashKey(split.cacheKey)]
+		if !ok {
+			continue
+		}
+
+		var cached cachedMetadataQueryResponse
+		if err := json.Unmarshal(data, &cached); err != nil {
+			level.Error(spanLog).Log("msg", "error unmarshalling cached response", "err", err)
+			continue
+		}
+
+		// Ensure there's no hashed key collision.
+		if cached.Key != split.cacheKey {
+			continue
+		}
+
+		split.data = cached.Data
+		hits++
+	}
+
+	rt.metrics.cacheHits.Add(float64(hits))
+	spanLog.LogKV("requested", len(hashedKeys), "hits", hits)
+}
+
+// storeCachedResponses stores the cachable results of the splits in the results cache, unless
+// they're bigger than maxEntrySize (0 to disable the limit).
+func (rt *metadataQueryRoundTripper) storeCachedResponses(ctx context.Context, splits []*metadataQuerySplit, maxEntrySize int) {
+	entries := map[string][]byte{}
+	for _, split := range splits {
+		if split.cacheKey == "" || !split.cachable {
+			continue
+		}
+
+		buf, err := json.Marshal(cachedMetadataQueryResponse{Key: split.cacheKey, Data: split.data})
+		if err != nil {
+			level.Error(rt.logger).Log("msg", "error marshalling cached response", "err", err)
+			continue
+		}
+
+		if maxEntrySize > 0 && len(buf) > maxEntrySize {
+			level.Debug(rt.logger).Log("msg", "not caching the response because it's bigger than the max cache entry size", "size", len(buf), "max_size", maxEntrySize)
+			continue
+		}
+
+		entries[cacheHashKey(split.cacheKey)] = buf
+	}
+
+	if len(entries) > 0 {
+		rt.cache.Store(ctx, entries, rt.cacheTTL)
+	}
+}
+
+// metadataQueryRequest is a label names, label values or series request.
+type metadataQueryRequest struct {
+	path string
+
+	// The request params other than start and end.
+	params url.Values
+
+	// Whether both the start and end of the time range have been specified.
+	hasTimeRange bool
+	start, end   int64
+
+	cacheDisabled bool
+}
+
+func decodeMetadataQueryRequest(r *http.Request) (*metadataQueryRequest, error) {
+	// Parse the form on a copy of the request, so that the request body can still be read
+	// if the request is passed through as is.
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		_ = r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	parsed := r.Clone(r.Context())
+	parsed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := parsed.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	req := &metadataQueryRequest{
+		path:   r.URL.Path,
+		params: url.Values{},
+	}
+	for name, values := range parsed.Form {
+		if name != "start" && name != "end" {
+			req.params[name] = values
+		}
+	}
+
+	if parsed.Form.Get("start") != "" && parsed.Form.Get("end") != "" {
+		var err error
+		if req.start, err = util.ParseTime(parsed.Form.Get("start")); err != nil {
+			return nil, decorateWithParamName(err, "start")
+		}
+		if req.end, err = util.ParseTime(parsed.Form.Get("end")); err != nil {
+			return nil, decorateWithParamName(err, "end")
+		}
+		req.hasTimeRange = req.start <= req.end
+	}
+
+	for _, value := range r.Header.Values(cacheControlHeader) {
+		if strings.Contains(value, noStoreValue) {
+			req.cacheDisabled = true
+			break
+		}
+	}
+
+	return req, nil
+}
+
+// toHTTPRequest returns the request for the given time range.
+func (r *metadataQueryRequest) toHTTPRequest(ctx context.Context, start, end int64) (*http.Request, error) {
+	params := url.Values{}
+	for name, values := range r.params {
+		params[name] = values
+	}
+	params.Set("start", encodeTime(start))
+	params.Set("end", encodeTime(end))
+
+	u := &url.URL{
+		Path:     r.path,
+		RawQuery: params.Encode(),
+	}
+
+	req := &http.Request{
+		Method:     "GET",
+		RequestURI: u.String(), // This is what the httpgrpc code looks at.
+		URL:        u,
+		Body:       http.NoBody,
+		Header:     http.Header{},
+	}
+
+	if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+	return req.WithContext(ctx), nil
+}
+
+// metadataQuerySplit is the part of a metadataQueryRequest for a time interval.
+type metadataQuerySplit struct {
+	start, end int64
+
+	// The key of the results cache entry, empty if the result isn't cachable.
+	cacheKey string
+
+	// The result, either found in the cache or returned by the downstream request.
+	data     stdjson.RawMessage
+	warnings []string
+	cachable bool
+
+	// The downstream response, if unsuccessful.
+	errResponse *http.Response
+}
+
+// metadataQueryResponse is the response of label names, label values and series requests,
+// whose data is either a list of strings or a list of label sets.
+type metadataQueryResponse struct {
+	Status    string             `json:"status"`
+	Data      stdjson.RawMessage `json:"data,omitempty"`
+	ErrorType string             `json:"errorType,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Warnings  []string           `json:"warnings,omitempty"`
+}
+
+// cachedMetadataQueryResponse is the results cache entry of a metadataQuerySplit.
+type cachedMetadataQueryResponse struct {
+	Key  string             `json:"key"`
+	Data stdjson.RawMessage `json:"data"`
+}
+
+// isMetadataQueryResponseCachable returns whether the response can be cached. Responses with
+// warnings aren't cached, because they may be incomplete.
+func isMetadataQueryResponseCachable(res *http.Response, decoded *metadataQueryResponse) bool {
+	for _, value := range res.Header.Values(cacheControlHeader) {
+		if strings.Contains(value, noStoreValue) {
+			return false
+		}
+	}
+	return len(decoded.Warnings) == 0
+}
+
+// generateMetadataQueryCacheKey returns the cache key of the request for the given time range.
+func generateMetadataQueryCacheKey(userID string, req *metadataQueryRequest, start, end int64) string {
+	// url.Values.Encode() sorts the params by name, but we also want to sort
+	// the values, so that the order of the matchers doesn't matter.
+	params := url.Values{}
+	for name, values := range req.params {
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		params[name] = sorted
+	}
+
+	return fmt.Sprintf("metadata:%s:%s:%s:%d:%d", userID, req.path, params.Encode(), start, end)
+}
+
+// mergeMetadataQueryResponses merges and deduplicates the results of the splits.
+func mergeMetadataQueryResponses(req *metadataQueryRequest, splits []*metadataQuerySplit) (*http.Response, error) {
+	var (
+		data     interface{}
+		err      error
+		warnings []string
+	)
+
+	if strings.HasSuffix(req.path, seriesPathSuffix) {
+		data, err = mergeSeriesData(splits)
+	} else {
+		data, err = mergeStringsData(splits)
+	}
+	if err != nil {
+		return nil, apierror.Newf(apierror.TypeInternal, "error decoding response: %v", err)
+	}
+
+	seenWarnings := map[string]struct{}{}
+	for _, split := range splits {
+		for _, w := range split.warnings {
+			if _, ok := seenWarnings[w]; !ok {
+				seenWarnings[w] = struct{}{}
+				warnings = append(warnings, w)
+			}
+		}
+	}
+
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return nil, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
+	}
+
+	b, err := json.Marshal(metadataQueryResponse{
+		Status:   statusSuccess,
+		Data:     encodedData,
+		Warnings: warnings,
+	})
+	if err != nil {
+		return nil, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
+	}
+
+	return &http.Response{
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		Body:          ioutil.NopCloser(bytes.NewBuffer(b)),
+		StatusCode:    http.StatusOK,
+		ContentLength: int64(len(b)),
+	}, nil
+}
+
+// mergeStringsData merges the label names or label values of the splits, returning them sorted.
+func mergeStringsData(splits []*metadataQuerySplit) ([]string, error) {
+	seen := map[string]struct{}{}
+	merged := []string{}
+
+	for _, split := range splits {
+		var values []string
+		if err := json.Unmarshal(split.data, &values); err != nil {
+			return nil, err
+		}
+
+		for _, v := range values {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				merged = append(merged, v)
+			}
+		}
+	}
+
+	sort.Strings(merged)
+	return merged, nil
+}
+
+// mergeSeriesData merges the series of the splits, returning them sorted by labels.
+func mergeSeriesData(splits []*metadataQuerySplit) ([]labels.Labels, error) {
+	seen := map[string]struct{}{}
+	merged := []labels.Labels{}
+
+	for _, split := range splits {
+		var series []labels.Labels
+		if err := json.Unmarshal(split.data, &series); err != nil {
+			return nil, err
+		}
+
+		for _, s := range series {
+			key := s.String()
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				merged = append(merged, s)
+			}
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return labels.Compare(merged[i], merged[j]) < 0
+	})
+	return merged, nil
+}
+
+func isMetadataQuery(path string) bool {
+	return strings.HasSuffix(path, labelNamesPathSuffix) || strings.HasSuffix(path, seriesPathSuffix) || labelValuesPathRegexp.MatchString(path)
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/cache"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+func TestMetadataQueryRoundTripper_SplitAndCache(t *testing.T) {
+	start := parseTimeRFC3339(t, "2021-10-01T01:00:00Z")
+	end := parseTimeRFC3339(t, "2021-10-04T12:00:00Z")
+
+	// Only the time ranges before 2021-10-04T06:00:00Z are cachable.
+	maxCacheFreshness := time.Since(parseTimeRFC3339(t, "2021-10-04T06:00:00Z"))
+
+	tests := map[string]struct {
+		path         string
+		downstream   func(start int64) string
+		expectedData string
+	}{
+		"label names": {
+			path: "/prometheus/api/v1/labels",
+			downstream: func(start int64) string {
+				return fmt.Sprintf(`["__name__","label_%d"]`, start/(24*time.Hour).Milliseconds()%2)
+			},
+			expectedData: `["__name__","label_0","label_1"]`,
+		},
+		"label values": {
+			path: "/prometheus/api/v1/label/job/values",
+			downstream: func(start int64) string {
+				return fmt.Sprintf(`["job_%d","other"]`, start/(24*time.Hour).Milliseconds()%2)
+			},
+			expectedData: `["job_0","job_1","other"]`,
+		},
+		"series": {
+			path: "/prometheus/api/v1/series",
+			downstream: func(start int64) string {
+				return fmt.Sprintf(`[{"__name__":"up","job":"job_%d"},{"__name__":"metric"}]`, start/(24*time.Hour).Milliseconds()%2)
+			},
+			expectedData: `[{"__name__":"metric"},{"__name__":"up","job":"job_0"},{"__name__":"up","job":"job_1"}]`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mtx            sync.Mutex
+				downstreamReqs []url.Values
+			)
+
+			downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, "user-1", r.Header.Get(user.OrgIDHeaderName))
+				assert.Equal(t, tc.path, r.URL.Path)
+
+				mtx.Lock()
+				downstreamReqs = append(downstreamReqs, r.URL.Query())
+				mtx.Unlock()
+
+				reqStart, err := util.ParseTime(r.URL.Query().Get("start"))
+				require.NoError(t, err)
+				return jsonResponse(http.StatusOK, `{"status":"success","data":`+tc.downstream(reqStart)+`}`), nil
+			})
+
+			cacheBackend := cache.NewInstrumentedMockCache()
+			reg := prometheus.NewPedanticRegistry()
+			rt := newMetadataQueryRoundTripper(downstream, 24*time.Hour, cacheBackend, time.Hour, mockLimits{maxCacheFreshness: maxCacheFreshness}, log.NewNopLogger(), newMetadataQueryRoundTripperMetrics(reg))
+
+			params := url.Values{
+				"start":   []string{encodeTime(util.TimeToMillis(start))},
+				"end":     []string{encodeTime(util.TimeToMillis(end))},
+				"match[]": []string{`{job=~".+"}`, `up`},
+			}
+
+			for i := 0; i < 2; i++ {
+				mtx.Lock()
+				downstreamReqs = nil
+				mtx.Unlock()
+
+				req := httptest.NewRequest("GET", tc.path+"?"+params.Encode(), nil)
+				req = req.WithContext(user.InjectOrgID(context.Background(), "user-1"))
+
+				res, err := rt.RoundTrip(req)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+
+				body, err := ioutil.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, `{"status":"success","data":`+tc.expectedData+`}`, string(body))
+
+				if i == 0 {
+					// The time range spans 4 days.
+					require.Len(t, downstreamReqs, 4)
+					for _, p := range downstreamReqs {
+						assert.Equal(t, params["match[]"], p["match[]"])
+					}
+				} else {
+					// Only the last day, which isn't cachable, is requested again.
+					require.Len(t, downstreamReqs, 1)
+					assert.Equal(t, params.Get("end"), downstreamReqs[0].Get("end"))
+				}
+			}
+
+			assert.Equal(t, 1, cacheBackend.CountStoreCalls())
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_frontend_metadata_query_results_cache_hits_total Total number of label names, label values and series requests whose response has been found in the results cache
+				# TYPE cortex_frontend_metadata_query_results_cache_hits_total counter
+				cortex_frontend_metadata_query_results_cache_hits_total 3
+				# HELP cortex_frontend_metadata_query_results_cache_requests_total Total number of label names, label values and series requests looked up in the results cache
+				# TYPE cortex_frontend_metadata_query_results_cache_requests_total counter
+				cortex_frontend_metadata_query_results_cache_requests_total 6
+				# HELP cortex_frontend_metadata_split_queries_total Total number of underlying label names, label values and series requests after the split by interval is applied
+				# TYPE cortex_frontend_metadata_split_queries_total counter
+				cortex_frontend_metadata_split_queries_total 8
+			`)))
+		})
+	}
+}
+
+func TestMetadataQueryRoundTripper_ShouldNotCacheResultsBiggerThanLimit(t *testing.T) {
+	downstreamReqs := 0
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		downstreamReqs++
+		return jsonResponse(http.StatusOK, `{"status":"success","data":["a_very_long_label_name"]}`), nil
+	})
+
+	cacheBackend := cache.NewInstrumentedMockCache()
+	limits := mockLimits{maxCacheFreshness: 10 * time.Minute, maxMetadataEntry: 10}
+	rt := newMetadataQueryRoundTripper(downstream, 0, cacheBackend, time.Hour, limits, log.NewNopLogger(), newMetadataQueryRoundTripperMetrics(nil))
+
+	end := time.Now().Add(-time.Hour)
+	params := url.Values{
+		"start": []string{encodeTime(util.TimeToMillis(end.Add(-time.Hour)))},
+		"end":   []string{encodeTime(util.TimeToMillis(end))},
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/v1/labels?"+params.Encode(), nil)
+		res, err := rt.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), "user-1")))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	assert.Equal(t, 2, downstreamReqs)
+	assert.Equal(t, 0, cacheBackend.CountStoreCalls())
+}
+
+func TestMetadataQueryRoundTripper_ShouldPassThroughRequestsWithoutTimeRange(t *testing.T) {
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "up", r.Form.Get("match[]"))
+		return jsonResponse(http.StatusOK, `{"status":"success","data":["__name__","__name__"]}`), nil
+	})
+
+	rt := newMetadataQueryRoundTripper(downstream, 24*time.Hour, nil, 0, mockLimits{}, log.NewNopLogger(), newMetadataQueryRoundTripperMetrics(nil))
+
+	req := httptest.NewRequest("POST", "/api/v1/labels", strings.NewReader(url.Values{"match[]": []string{"up"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := rt.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), "user-1")))
+	require.NoError(t, err)
+
+	// The response is returned as is.
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"status":"success","data":["__name__","__name__"]}`, string(body))
+}
+
+func TestMetadataQueryRoundTripper_ShouldReturnUnsuccessfulResponse(t *testing.T) {
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return jsonResponse(http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"invalid matcher"}`), nil
+	})
+
+	rt := newMetadataQueryRoundTripper(downstream, 24*time.Hour, nil, 0, mockLimits{}, log.NewNopLogger(), newMetadataQueryRoundTripperMetrics(nil))
+
+	req := httptest.NewRequest("GET", "/api/v1/series?start=0&end=200000&match[]={", nil)
+	res, err := rt.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), "user-1")))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"status":"error","errorType":"bad_data","error":"invalid matcher"}`, string(body))
+}
+
+func TestIsMetadataQuery(t *testing.T) {
+	assert.True(t, isMetadataQuery("/prometheus/api/v1/labels"))
+	assert.True(t, isMetadataQuery("/prometheus/api/v1/series"))
+	assert.True(t, isMetadataQuery("/prometheus/api/v1/label/job/values"))
+	assert.False(t, isMetadataQuery("/prometheus/api/v1/query"))
+	assert.False(t, isMetadataQuery("/prometheus/api/v1/cardinality/label_names"))
+	assert.False(t, isMetadataQuery("/prometheus/api/v1/label/job"))
+}
+
+func jsonResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
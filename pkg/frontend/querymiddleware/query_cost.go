@@ -0,0 +1,371 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/tenant"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/frontend/querymiddleware/astmapper"
+	"github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	cardinalityLabelValuesPathSuffix = "/cardinality/label_values"
+
+	// querySampleInterval is the interval at which the samples are assumed to be scraped, used to
+	// estimate the number of samples selected by the range vector selectors at each step.
+	querySampleInterval = time.Minute
+
+	// The number of series matching a selector is cached for a short period, so that the cost of the
+	// queries issued repeatedly doesn't require a cardinality request each time.
+	seriesCountCacheSize = 10000
+	seriesCountCacheTTL  = time.Minute
+)
+
+type queryCostMiddlewareMetrics struct {
+	estimatedQueries    prometheus.Counter
+	failedEstimates     prometheus.Counter
+	rejectedQueries     *prometheus.CounterVec
+	lowPriorityQueries  *prometheus.CounterVec
+	seriesCountRequests prometheus.Counter
+	seriesCountHits     prometheus.Counter
+}
+
+func newQueryCostMiddlewareMetrics(reg prometheus.Registerer) *queryCostMiddlewareMetrics {
+	return &queryCostMiddlewareMetrics{
+		estimatedQueries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_cost_estimations_total",
+			Help: "Total number of queries whose cost has been estimated before their execution.",
+		}),
+		failedEstimates: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_cost_estimation_failures_total",
+			Help: "Total number of queries whose cost couldn't be estimated. These queries are executed anyway.",
+		}),
+		rejectedQueries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_rejected_queries_estimated_cost_total",
+			Help: "Total number of queries rejected because their estimated cost exceeds the limit.",
+		}, []string{"user"}),
+		lowPriorityQueries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_low_priority_queries_estimated_cost_total",
+			Help: "Total number of queries executed with low priority because their estimated cost exceeds the threshold.",
+		}, []string{"user"}),
+		seriesCountRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_cost_series_count_requests_total",
+			Help: "Total number of lookups of the number of series matching a selector, to estimate the cost of the queries.",
+		}),
+		seriesCountHits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_query_cost_series_count_cache_hits_total",
+			Help: "Total number of lookups of the number of series matching a selector served from the cache.",
+		}),
+	}
+}
+
+type lowPriorityQueryContextKey int
+
+const lowPriorityQueryKey = lowPriorityQueryContextKey(0)
+
+// contextWithLowPriorityQuery returns a new context marking the query as executed with low priority.
+func contextWithLowPriorityQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lowPriorityQueryKey, true)
+}
+
+// isLowPriorityQuery returns whether the query has been given low priority.
+func isLowPriorityQuery(ctx context.Context) bool {
+	lowPriority, _ := ctx.Value(lowPriorityQueryKey).(bool)
+	return lowPriority
+}
+
+// queryCostMiddleware is a Middleware estimating the cost of range and instant queries before their execution.
+// The queries whose estimated cost exceeds the tenant's limit are rejected, and the ones whose estimated cost
+// exceeds the tenant's low priority threshold are executed with low priority in the tenant's queue.
+//
+// The middleware runs before the queries are split and looked up in the results cache, so the whole query is
+// estimated once, and both its rejection and the priority of all its split and sharded requests are decided
+// on this single estimate. The cost of a query is estimated as the number of series matching the query
+// selectors multiplied by the number of steps, and by the number of samples selected at each step by the
+// range vector selectors. The number of series is looked up via the cardinality analysis API, so it only
+// accounts for the series in the ingesters' memory.
+type queryCostMiddleware struct {
+	next         Handler
+	downstream   http.RoundTripper
+	limits       Limits
+	logger       log.Logger
+	metrics      *queryCostMiddlewareMetrics
+	seriesCounts *seriesCountCache
+}
+
+// newQueryCostMiddleware makes a new queryCostMiddleware. The cardinality requests used to estimate the
+// cost of the queries are sent to downstream.
+func newQueryCostMiddleware(downstream http.RoundTripper, limits Limits, logger log.Logger, metrics *queryCostMiddlewareMetrics, seriesCounts *seriesCountCache) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &queryCostMiddleware{
+			next:         next,
+			downstream:   downstream,
+			limits:       limits,
+			logger:       logger,
+			metrics:      metrics,
+			seriesCounts: seriesCounts,
+		}
+	})
+}
+
+func (m *queryCostMiddleware) Do(ctx context.Context, req Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	maxCost := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, m.limits.MaxEstimatedQueryCost)
+	lowPriorityCost := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, m.limits.LowPriorityEstimatedQueryCost)
+	if maxCost <= 0 && lowPriorityCost <= 0 {
+		return m.next.Do(ctx, req)
+	}
+
+	// Invalid queries are passed through, so that they're rejected with the usual error.
+	expr, err := parser.ParseExpr(req.GetQuery())
+	if err != nil {
+		return m.next.Do(ctx, req)
+	}
+
+	spanLog := spanlogger.FromContext(ctx, m.logger)
+	cost, err := m.estimateCost(ctx, tenantIDs, req, expr)
+
+	// The query is executed anyway if the cost can't be estimated, to not block queries
+	// when the cardinality analysis isn't available.
+	m.metrics.estimatedQueries.Inc()
+	if err != nil {
+		m.metrics.failedEstimates.Inc()
+		level.Warn(spanLog).Log("msg", "failed to estimate the query cost", "query", req.GetQuery(), "err", err)
+		return m.next.Do(ctx, req)
+	}
+
+	stats.FromContext(ctx).AddEstimatedQueryCost(cost)
+	userID := tenant.JoinTenantIDs(tenantIDs)
+
+	if maxCost > 0 && cost > uint64(maxCost) {
+		level.Info(spanLog).Log("msg", "query rejected because of the estimated cost", "user", userID, "query", req.GetQuery(), "estimated_cost", cost, "limit", maxCost)
+		m.metrics.rejectedQueries.WithLabelValues(userID).Inc()
+		return nil, apierror.New(apierror.TypeBadData, validation.NewMaxEstimatedQueryCostError(cost, maxCost).Error())
+	}
+
+	// The priority applies to all the requests sent downstream to execute the query.
+	if lowPriorityCost > 0 && cost > uint64(lowPriorityCost) {
+		level.Info(spanLog).Log("msg", "query executed with low priority because of the estimated cost", "user", userID, "query", req.GetQuery(), "estimated_cost", cost, "threshold", lowPriorityCost)
+		m.metrics.lowPriorityQueries.WithLabelValues(userID).Inc()
+		ctx = contextWithLowPriorityQuery(ctx)
+	}
+
+	return m.next.Do(ctx, req)
+}
+
+// estimateCost returns the estimated cost of the query, as the number of series matching its selectors,
+// summed across all tenants, multiplied by the number of steps and by the number of samples selected
+// at each step.
+func (m *queryCostMiddleware) estimateCost(ctx context.Context, tenantIDs []string, req Request, expr parser.Expr) (uint64, error) {
+	steps := uint64(1)
+	if req.GetStep() > 0 && req.GetEnd() > req.GetStart() {
+		steps = uint64((req.GetEnd()-req.GetStart())/req.GetStep()) + 1
+	}
+
+	// The same selector may appear multiple times in the query, but it's only looked up once.
+	// Each occurrence is weighted by the number of samples it selects at each step.
+	samples := map[string]uint64{}
+	for _, selector := range astmapper.VectorSelectors(expr) {
+		samples[astmapper.SeriesSelector(selector.VectorSelector)] += 1 + uint64(selector.Range/querySampleInterval)
+	}
+	if len(samples) == 0 {
+		return 0, nil
+	}
+
+	type job struct {
+		tenantID string
+		selector string
+		series   uint64
+	}
+
+	jobs := make([]interface{}, 0, len(samples)*len(tenantIDs))
+	for _, tenantID := range tenantIDs {
+		for selector := range samples {
+			jobs = append(jobs, &job{tenantID: tenantID, selector: selector})
+		}
+	}
+
+	cardinalityPath := strings.TrimSuffix(strings.TrimSuffix(requestPath(req), queryRangePathSuffix), instantQueryPathSuffix) + cardinalityLabelValuesPathSuffix
+	concurrencyLimit := validation.SmallestPositiveIntPerTenant(tenantIDs, m.limits.MaxQueryParallelism)
+
+	err := concurrency.ForEach(ctx, jobs, concurrencyLimit, func(ctx context.Context, j interface{}) error {
+		job := j.(*job)
+
+		series, err := m.seriesCount(user.InjectOrgID(ctx, job.tenantID), job.tenantID, cardinalityPath, job.selector)
+		if err != nil {
+			return errors.Wrapf(err, "tenant %s, selector %s", job.tenantID, job.selector)
+		}
+		job.series = series
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	cost := uint64(0)
+	for _, j := range jobs {
+		job := j.(*job)
+		cost += job.series * samples[job.selector] * steps
+	}
+	return cost, nil
+}
+
+// requestPath returns the path of the query request.
+func requestPath(req Request) string {
+	if r, ok := req.(interface{ GetPath() string }); ok {
+		return r.GetPath()
+	}
+	return ""
+}
+
+// seriesCount returns the number of in-memory series matching the selector for the tenant, from the
+// cache if it has been recently looked up.
+func (m *queryCostMiddleware) seriesCount(ctx context.Context, tenantID, path, selector string) (uint64, error) {
+	m.metrics.seriesCountRequests.Inc()
+	if series, ok := m.seriesCounts.get(tenantID, selector); ok {
+		m.metrics.seriesCountHits.Inc()
+		return series, nil
+	}
+
+	series, err := m.fetchSeriesCount(ctx, path, selector)
+	if err != nil {
+		return 0, err
+	}
+	m.seriesCounts.set(tenantID, selector, series)
+	return series, nil
+}
+
+// fetchSeriesCount returns the number of in-memory series matching the selector, for the tenant in the context.
+func (m *queryCostMiddleware) fetchSeriesCount(ctx context.Context, path, selector string) (uint64, error) {
+	params := url.Values{
+		"label_names[]": []string{labels.MetricName},
+		"selector":      []string{selector},
+		"limit":         []string{"0"},
+	}
+	u := &url.URL{
+		Path:     path,
+		RawQuery: params.Encode(),
+	}
+
+	req := &http.Request{
+		Method:     "GET",
+		RequestURI: u.String(), // This is what the httpgrpc code looks at.
+		URL:        u,
+		Body:       http.NoBody,
+		Header:     http.Header{},
+	}
+	if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
+		return 0, err
+	}
+
+	res, err := m.downstream.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var cardinality struct {
+		Labels []struct {
+			LabelName   string `json:"label_name"`
+			SeriesCount uint64 `json:"series_count"`
+		} `json:"labels"`
+	}
+	if err := stdjson.Unmarshal(body, &cardinality); err != nil {
+		return 0, errors.Wrap(err, "decoding cardinality response")
+	}
+
+	for _, l := range cardinality.Labels {
+		if l.LabelName == labels.MetricName {
+			return l.SeriesCount, nil
+		}
+	}
+
+	// No series match the selector.
+	return 0, nil
+}
+
+// seriesCountCache is a LRU cache of the number of series matching a selector, by tenant and selector.
+// The entries expire after a TTL, so that the cache follows the changes of the tenant's series.
+type seriesCountCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mtx sync.Mutex
+	lru *lru.LRU
+}
+
+type seriesCountCacheEntry struct {
+	series    uint64
+	expiresAt time.Time
+}
+
+func newSeriesCountCache(size int, ttl time.Duration) *seriesCountCache {
+	// The LRU can only fail to be created if the size isn't positive.
+	c, err := lru.NewLRU(size, nil)
+	if err != nil {
+		panic(err)
+	}
+	return &seriesCountCache{ttl: ttl, now: time.Now, lru: c}
+}
+
+func (c *seriesCountCache) get(tenantID, selector string) (uint64, bool) {
+	key := tenantID + ":" + selector
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return 0, false
+	}
+	entry := v.(seriesCountCacheEntry)
+	if c.now().After(entry.expiresAt) {
+		c.lru.Remove(key)
+		return 0, false
+	}
+	return entry.series, true
+}
+
+func (c *seriesCountCache) set(tenantID, selector string, series uint64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lru.Add(tenantID+":"+selector, seriesCountCacheEntry{series: series, expiresAt: c.now().Add(c.ttl)})
+}
@@ -0,0 +1,353 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/dskit/tenant"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/querier/stats"
+)
+
+func TestQueryCostMiddleware(t *testing.T) {
+	// Number of in-memory series per selector.
+	seriesCount := map[string]int{
+		`{__name__="up"}`:                     10,
+		`{job="app",__name__="http_req"}`:     100,
+		`{__name__="missing"}`:                0,
+		`{__name__=~"up|http_req",env="dev"}`: 5,
+	}
+
+	tests := map[string]struct {
+		path                 string
+		params               url.Values
+		maxCost              int
+		lowPriorityCost      int
+		cardinalityStatus    int
+		expectedCost         uint64
+		expectedCardinality  int
+		expectedRejected     bool
+		expectedLowPriority  bool
+		expectedFailedCount  int
+		expectedEstimatedCnt int
+	}{
+		"limit disabled": {
+			path:   "/prometheus/api/v1/query_range",
+			params: url.Values{"query": {"up"}, "start": {"0"}, "end": {"3600"}, "step": {"60"}},
+		},
+		"range query below the limit": {
+			path:                 "/prometheus/api/v1/query_range",
+			params:               url.Values{"query": {"up"}, "start": {"0"}, "end": {"3600"}, "step": {"60"}},
+			maxCost:              1000,
+			expectedCost:         10 * 61,
+			expectedCardinality:  1,
+			expectedEstimatedCnt: 1,
+		},
+		"range query above the limit": {
+			path:                 "/prometheus/api/v1/query_range",
+			params:               url.Values{"query": {`sum(rate(http_req{job="app"}[5m])) / sum(rate(http_req{job="app"}[5m] offset 1h))`}, "start": {"0"}, "end": {"3600"}, "step": {"60"}},
+			maxCost:              1000,
+			expectedCost:         2 * 100 * 6 * 61,
+			expectedCardinality:  1,
+			expectedRejected:     true,
+			expectedEstimatedCnt: 1,
+		},
+		"instant query below the limit": {
+			path:                 "/prometheus/api/v1/query",
+			params:               url.Values{"query": {`up + absent(missing) + {__name__=~"up|http_req",env="dev"}`}, "time": {"3600"}},
+			maxCost:              20,
+			expectedCost:         10 + 0 + 5,
+			expectedCardinality:  3,
+			expectedEstimatedCnt: 1,
+		},
+		"instant query above the limit": {
+			path:                 "/prometheus/api/v1/query",
+			params:               url.Values{"query": {`http_req{job="app"}`}, "time": {"3600"}},
+			maxCost:              20,
+			expectedCost:         100,
+			expectedCardinality:  1,
+			expectedRejected:     true,
+			expectedEstimatedCnt: 1,
+		},
+		"instant query above the limit because of the range vector selector": {
+			path:                 "/prometheus/api/v1/query",
+			params:               url.Values{"query": {`count_over_time(up[1h])`}, "time": {"3600"}},
+			maxCost:              100,
+			expectedCost:         10 * 61,
+			expectedCardinality:  1,
+			expectedRejected:     true,
+			expectedEstimatedCnt: 1,
+		},
+		"query above the low priority threshold": {
+			path:                 "/prometheus/api/v1/query_range",
+			params:               url.Values{"query": {"up"}, "start": {"0"}, "end": {"3600"}, "step": {"60"}},
+			maxCost:              1000,
+			lowPriorityCost:      100,
+			expectedCost:         10 * 61,
+			expectedCardinality:  1,
+			expectedLowPriority:  true,
+			expectedEstimatedCnt: 1,
+		},
+		"query below the low priority threshold": {
+			path:                 "/prometheus/api/v1/query",
+			params:               url.Values{"query": {"up"}, "time": {"3600"}},
+			lowPriorityCost:      100,
+			expectedCost:         10,
+			expectedCardinality:  1,
+			expectedEstimatedCnt: 1,
+		},
+		"query without selectors": {
+			path:                 "/prometheus/api/v1/query_range",
+			params:               url.Values{"query": {"vector(1)"}, "start": {"0"}, "end": {"3600"}, "step": {"60"}},
+			maxCost:              1,
+			expectedEstimatedCnt: 1,
+		},
+		"cardinality analysis failure": {
+			path:                 "/prometheus/api/v1/query_range",
+			params:               url.Values{"query": {`http_req{job="app"}`}, "start": {"0"}, "end": {"3600"}, "step": {"60"}},
+			maxCost:              1,
+			cardinalityStatus:    http.StatusBadRequest,
+			expectedCardinality:  1,
+			expectedFailedCount:  1,
+			expectedEstimatedCnt: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mtx                sync.Mutex
+				cardinalityReqs    int
+				executedQueryCount int
+			)
+
+			downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, "/prometheus/api/v1/cardinality/label_values", r.URL.Path)
+				assert.Equal(t, "user-1", r.Header.Get(user.OrgIDHeaderName))
+				assert.Equal(t, []string{"__name__"}, r.URL.Query()["label_names[]"])
+
+				mtx.Lock()
+				cardinalityReqs++
+				mtx.Unlock()
+
+				if tc.cardinalityStatus != 0 {
+					return jsonResponse(tc.cardinalityStatus, "cardinality analysis is disabled for the tenant: user-1"), nil
+				}
+
+				selector := r.URL.Query().Get("selector")
+				count, ok := seriesCount[selector]
+				require.True(t, ok, "unexpected selector %s", selector)
+				if count == 0 {
+					return jsonResponse(http.StatusOK, `{"series_count_total":1000,"labels":[]}`), nil
+				}
+				return jsonResponse(http.StatusOK, fmt.Sprintf(`{"series_count_total":1000,"labels":[{"label_name":"__name__","label_values_count":1,"series_count":%d,"cardinality":[]}]}`, count)), nil
+			})
+
+			next := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				if r.URL.Path == tc.path {
+					executedQueryCount++
+					expectedPriority := ""
+					if tc.expectedLowPriority {
+						expectedPriority = "low"
+					}
+					assert.Equal(t, expectedPriority, r.Header.Get("X-Query-Priority"))
+					return jsonResponse(http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[]}}`), nil
+				}
+				return downstream.RoundTrip(r)
+			})
+
+			reg := prometheus.NewPedanticRegistry()
+			metrics := newQueryCostMiddlewareMetrics(reg)
+			limits := mockLimits{maxEstimatedCost: tc.maxCost, lowPriorityCost: tc.lowPriorityCost}
+			rt := newLimitedParallelismRoundTripper(next, PrometheusCodec, limits, newQueryCostMiddleware(next, limits, log.NewNopLogger(), metrics, newSeriesCountCache(100, time.Minute)))
+
+			queryStats, ctx := stats.ContextWithEmptyStats(user.InjectOrgID(context.Background(), "user-1"))
+			req := httptest.NewRequest("GET", tc.path+"?"+tc.params.Encode(), nil).WithContext(ctx)
+
+			res, err := rt.RoundTrip(req)
+			if tc.expectedRejected {
+				require.Error(t, err)
+				assert.True(t, apierror.IsAPIError(err))
+				assert.Contains(t, err.Error(), "err-mimir-max-estimated-query-cost")
+				assert.Equal(t, 0, executedQueryCount)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, res.StatusCode)
+				assert.Equal(t, 1, executedQueryCount)
+			}
+
+			assert.Equal(t, tc.expectedCost, queryStats.LoadEstimatedQueryCost())
+			assert.Equal(t, tc.expectedCardinality, cardinalityReqs)
+
+			rejected, lowPriority := 0, 0
+			if tc.expectedRejected {
+				rejected = 1
+			}
+			if tc.expectedLowPriority {
+				lowPriority = 1
+			}
+			assert.Equal(t, float64(tc.expectedEstimatedCnt), testutil.ToFloat64(metrics.estimatedQueries))
+			assert.Equal(t, float64(tc.expectedFailedCount), testutil.ToFloat64(metrics.failedEstimates))
+			assert.Equal(t, float64(rejected), testutil.ToFloat64(metrics.rejectedQueries.WithLabelValues("user-1")))
+			assert.Equal(t, float64(lowPriority), testutil.ToFloat64(metrics.lowPriorityQueries.WithLabelValues("user-1")))
+		})
+	}
+}
+
+func TestQueryCostMiddleware_ShouldEstimateTheWholeQueryOnceBeforeSplitting(t *testing.T) {
+	const (
+		path                 = "/prometheus/api/v1/query_range"
+		expectedSplitQueries = 3
+	)
+
+	tests := map[string]struct {
+		maxCost             int
+		lowPriorityCost     int
+		expectedRejected    bool
+		expectedLowPriority bool
+	}{
+		// Each split query would be below the limit, but the whole query isn't.
+		"query rejected": {
+			maxCost:          1000,
+			expectedRejected: true,
+		},
+		// Each split query would be below the threshold, but the whole query isn't.
+		"query executed with low priority": {
+			lowPriorityCost:     1000,
+			expectedLowPriority: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mtx                sync.Mutex
+				cardinalityReqs    int
+				executedQueries    int
+				lowPriorityQueries int
+			)
+
+			next := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+				mtx.Lock()
+				defer mtx.Unlock()
+
+				if r.URL.Path != path {
+					cardinalityReqs++
+					return jsonResponse(http.StatusOK, `{"labels":[{"label_name":"__name__","series_count":10}]}`), nil
+				}
+
+				executedQueries++
+				if r.Header.Get("X-Query-Priority") == "low" {
+					lowPriorityQueries++
+				}
+				return jsonResponse(http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[]}}`), nil
+			})
+
+			reg := prometheus.NewPedanticRegistry()
+			tw, err := NewTripperware(
+				Config{SplitQueriesByInterval: time.Hour},
+				log.NewNopLogger(),
+				mockLimits{maxEstimatedCost: tc.maxCost, lowPriorityCost: tc.lowPriorityCost},
+				PrometheusCodec,
+				nil,
+				promql.EngineOpts{Logger: log.NewNopLogger(), MaxSamples: 1000, Timeout: time.Minute},
+				reg,
+			)
+			require.NoError(t, err)
+
+			// The query spans 3 hours, so it's split into 3 queries, with an estimated cost of 10 * 181.
+			params := url.Values{"query": {"up"}, "start": {"0"}, "end": {"10800"}, "step": {"60"}}
+			queryStats, ctx := stats.ContextWithEmptyStats(user.InjectOrgID(context.Background(), "user-1"))
+			req := httptest.NewRequest("GET", path+"?"+params.Encode(), nil).WithContext(ctx)
+			require.NoError(t, user.InjectOrgIDIntoHTTPRequest(ctx, req))
+
+			_, err = tw(next).RoundTrip(req)
+			if tc.expectedRejected {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "estimated cost: 1810, limit: 1000")
+				assert.Equal(t, 0, executedQueries)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, expectedSplitQueries, executedQueries)
+			}
+			if tc.expectedLowPriority {
+				assert.Equal(t, expectedSplitQueries, lowPriorityQueries)
+			}
+
+			assert.Equal(t, 1, cardinalityReqs)
+			assert.Equal(t, uint64(1810), queryStats.LoadEstimatedQueryCost())
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_query_frontend_query_cost_estimations_total Total number of queries whose cost has been estimated before their execution.
+				# TYPE cortex_query_frontend_query_cost_estimations_total counter
+				cortex_query_frontend_query_cost_estimations_total 1
+			`), "cortex_query_frontend_query_cost_estimations_total"))
+		})
+	}
+}
+
+func TestQueryCostMiddleware_ShouldSumTheCostAcrossTenants(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	defer tenant.WithDefaultResolver(tenant.NewSingleResolver())
+
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		count := 10
+		if r.Header.Get(user.OrgIDHeaderName) == "user-2" {
+			count = 20
+		}
+		return jsonResponse(http.StatusOK, fmt.Sprintf(`{"labels":[{"label_name":"__name__","series_count":%d}]}`, count)), nil
+	})
+	next := HandlerFunc(func(context.Context, Request) (Response, error) {
+		return &PrometheusResponse{Status: statusSuccess}, nil
+	})
+
+	handler := newQueryCostMiddleware(downstream, mockLimits{maxEstimatedCost: 25}, log.NewNopLogger(), newQueryCostMiddlewareMetrics(nil), newSeriesCountCache(100, time.Minute)).Wrap(next)
+
+	queryStats, ctx := stats.ContextWithEmptyStats(user.InjectOrgID(context.Background(), "user-1|user-2"))
+	_, err := handler.Do(ctx, &PrometheusInstantQueryRequest{Path: "/api/v1/query", Time: 3600 * 1000, Query: "up"})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "estimated cost: 30, limit: 25"), err.Error())
+	assert.Equal(t, uint64(30), queryStats.LoadEstimatedQueryCost())
+}
+
+func TestSeriesCountCache(t *testing.T) {
+	now := time.Now()
+	c := newSeriesCountCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, ok := c.get("user-1", `{__name__="up"}`)
+	assert.False(t, ok)
+
+	c.set("user-1", `{__name__="up"}`, 10)
+	c.set("user-2", `{__name__="up"}`, 20)
+
+	series, ok := c.get("user-1", `{__name__="up"}`)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), series)
+
+	series, ok = c.get("user-2", `{__name__="up"}`)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(20), series)
+
+	// The entries expire after the TTL.
+	now = now.Add(time.Minute + time.Second)
+	_, ok = c.get("user-1", `{__name__="up"}`)
+	assert.False(t, ok)
+}
@@ -398,18 +398,62 @@ func TestQueryShardingCorrectness(t *testing.T) {
 		},
 		"stddev()": {
 			query:                  `stddev(metric_counter{const="fixed"})`,
-			expectedShardedQueries: 0,
+			expectedShardedQueries: 3,
+		},
+		"stddev() grouping 'by'": {
+			query:                  `stddev by(group_1) (rate(metric_counter[1m]))`,
+			expectedShardedQueries: 3,
+		},
+		"stddev() with selector matching multiple metric names": {
+			query:                  `stddev({__name__=~"metric_counter|metric_histogram_bucket"})`,
+			expectedShardedQueries: 3,
 		},
 		"stdvar()": {
 			query:                  `stdvar(metric_counter{const="fixed"})`,
-			expectedShardedQueries: 0,
+			expectedShardedQueries: 3,
+		},
+		"stdvar() grouping 'without'": {
+			query:                  `stdvar without(unique) (metric_counter)`,
+			expectedShardedQueries: 3,
 		},
 		"topk()": {
 			query:                  `topk(2, metric_counter{const="fixed"})`,
+			expectedShardedQueries: 1,
+		},
+		"topk() grouping 'by'": {
+			query:                  `topk by(group_1) (2, rate(metric_counter[1m]))`,
+			expectedShardedQueries: 1,
+		},
+		"topk() with non constant parameter": {
+			query:                  `topk(scalar(metric_counter{unique="1"}), metric_counter)`,
 			expectedShardedQueries: 0,
 		},
 		"bottomk()": {
 			query:                  `bottomk(2, metric_counter{const="fixed"})`,
+			expectedShardedQueries: 1,
+		},
+		"bottomk() grouping 'without'": {
+			query:                  `bottomk without(unique, group_1) (2, metric_counter)`,
+			expectedShardedQueries: 1,
+		},
+		"group() grouping 'by'": {
+			query:                  `group by(group_1) (metric_counter)`,
+			expectedShardedQueries: 1,
+		},
+		"count_values() no grouping": {
+			query:                  `count_values("value", metric_counter{group_1="0"})`,
+			expectedShardedQueries: 1,
+		},
+		"count_values() grouping 'by'": {
+			query:                  `count_values by(group_2) ("value", floor(rate(metric_counter[1m])))`,
+			expectedShardedQueries: 1,
+		},
+		"count_values() grouping 'without'": {
+			query:                  `count_values without(unique) ("value", metric_counter{group_1="0"})`,
+			expectedShardedQueries: 1,
+		},
+		"quantile() is not sharded": {
+			query:                  `quantile(0.9, metric_counter)`,
 			expectedShardedQueries: 0,
 		},
 		"vector()": {
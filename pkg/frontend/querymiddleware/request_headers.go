@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"net/http"
+)
+
+type requestHeadersContextKey int
+
+const requestHeadersKey = requestHeadersContextKey(0)
+
+// nonPropagatedRequestHeaders are the headers of the original request which aren't propagated to the requests
+// sent downstream, because they describe the body of the original request or the encodings accepted by the
+// client, while the requests sent downstream have no body and their responses are decoded by the query-frontend.
+var nonPropagatedRequestHeaders = map[string]struct{}{
+	"Accept":           {},
+	"Accept-Encoding":  {},
+	"Content-Encoding": {},
+	"Content-Length":   {},
+	"Content-Type":     {},
+}
+
+// contextWithRequestHeaders returns a new context holding the headers of the original request.
+func contextWithRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, requestHeadersKey, headers)
+}
+
+// propagateRequestHeaders copies the headers of the original request stored in the context to the request
+// sent downstream, so that the request is handled like the original one, eg. the priority of the request in
+// the queue depends on the User-Agent and X-Query-Priority headers. The headers already set on the request
+// are left untouched.
+func propagateRequestHeaders(ctx context.Context, req *http.Request) {
+	headers, _ := ctx.Value(requestHeadersKey).(http.Header)
+	for name, values := range headers {
+		if _, ok := nonPropagatedRequestHeaders[name]; ok {
+			continue
+		}
+		if _, ok := req.Header[name]; ok {
+			continue
+		}
+		req.Header[name] = values
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"io"
+
+	"go.uber.org/atomic"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type responseSizeLimiterContextKey int
+
+const responseSizeLimiterKey = responseSizeLimiterContextKey(0)
+
+// responseSizeLimiter accounts the size of the responses received from downstream to execute
+// a single query, including the responses of the split and sharded queries, and fails once
+// their total size exceeds the limit. It's safe to use concurrently.
+type responseSizeLimiter struct {
+	limit int
+	size  atomic.Int64
+}
+
+func newResponseSizeLimiter(limit int) *responseSizeLimiter {
+	return &responseSizeLimiter{limit: limit}
+}
+
+// contextWithResponseSizeLimiter returns a new context holding the input limiter.
+func contextWithResponseSizeLimiter(ctx context.Context, limiter *responseSizeLimiter) context.Context {
+	return context.WithValue(ctx, responseSizeLimiterKey, limiter)
+}
+
+// responseSizeLimiterFromContext returns the limiter stored in the context, or nil if there's no limiter.
+func responseSizeLimiterFromContext(ctx context.Context) *responseSizeLimiter {
+	limiter, _ := ctx.Value(responseSizeLimiterKey).(*responseSizeLimiter)
+	return limiter
+}
+
+// add accounts size bytes and returns an error if the limit has been exceeded.
+// This function is a no-op on a nil limiter.
+func (l *responseSizeLimiter) add(size int) error {
+	if l == nil || l.limit <= 0 {
+		return nil
+	}
+
+	if l.size.Add(int64(size)) > int64(l.limit) {
+		return apierror.New(apierror.TypeBadData, validation.NewMaxQueryResponseSizeError(l.limit).Error())
+	}
+	return nil
+}
+
+// reader wraps r to charge the bytes read from it to the limiter as they're read, failing the read
+// once the limit has been exceeded, so that a response exceeding the limit is never fully read.
+// This function can be called on a nil limiter, in which case the bytes are just counted.
+func (l *responseSizeLimiter) reader(r io.Reader) *limitedResponseReader {
+	return &limitedResponseReader{r: r, limiter: l}
+}
+
+type limitedResponseReader struct {
+	r       io.Reader
+	limiter *responseSizeLimiter
+
+	// The number of bytes read so far, and the error returned once the limit has been exceeded.
+	read int
+	err  error
+}
+
+func (r *limitedResponseReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.r.Read(p)
+	r.read += n
+	if limitErr := r.limiter.add(n); limitErr != nil {
+		r.err = limitErr
+		return 0, limitErr
+	}
+	return n, err
+}
@@ -8,6 +8,7 @@ package querymiddleware
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -41,6 +42,21 @@ type Config struct {
 	MaxRetries             int  `yaml:"max_retries" category:"advanced"`
 	ShardedQueries         bool `yaml:"parallelize_shardable_queries"`
 	CacheUnalignedRequests bool `yaml:"cache_unaligned_requests" category:"advanced"`
+
+	// Instant queries results caching.
+	CacheInstantQueries     bool          `yaml:"cache_instant_queries" category:"experimental"`
+	InstantQueriesCacheStep time.Duration `yaml:"instant_queries_cache_step" category:"experimental"`
+
+	// Label names, label values and series queries splitting and results caching.
+	SplitMetadataQueriesByInterval time.Duration `yaml:"split_metadata_queries_by_interval" category:"experimental"`
+	CacheMetadataQueries           bool          `yaml:"cache_metadata_queries" category:"experimental"`
+	MetadataQueriesCacheTTL        time.Duration `yaml:"metadata_queries_cache_ttl" category:"experimental"`
+
+	// Federated queries results caching.
+	CacheFederatedQueriesPerTenant bool `yaml:"cache_federated_queries_per_tenant" category:"experimental"`
+
+	// Format of the query results requested to the queriers.
+	QueryResultResponseFormat string `yaml:"query_result_response_format" category:"experimental"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -51,6 +67,13 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.CacheResults, "query-frontend.cache-results", false, "Cache query results.")
 	f.BoolVar(&cfg.ShardedQueries, "query-frontend.parallelize-shardable-queries", false, "True to enable query sharding.")
 	f.BoolVar(&cfg.CacheUnalignedRequests, "query-frontend.cache-unaligned-requests", false, "Cache requests that are not step-aligned.")
+	f.BoolVar(&cfg.CacheInstantQueries, "query-frontend.cache-instant-queries", false, "Cache instant query results. Requires -query-frontend.cache-results to be enabled.")
+	f.DurationVar(&cfg.InstantQueriesCacheStep, "query-frontend.instant-queries-cache-step", time.Minute, "Step the evaluation time of instant queries must be aligned to in order to be cached, unless -query-frontend.cache-unaligned-requests is enabled.")
+	f.DurationVar(&cfg.SplitMetadataQueriesByInterval, "query-frontend.split-metadata-queries-by-interval", 0, "Split label names, label values and series queries by an interval and execute in parallel. 0 to disable it.")
+	f.BoolVar(&cfg.CacheMetadataQueries, "query-frontend.cache-metadata-queries", false, "Cache label names, label values and series query results. Requires -query-frontend.cache-results to be enabled.")
+	f.DurationVar(&cfg.MetadataQueriesCacheTTL, "query-frontend.metadata-queries-cache-ttl", 24*time.Hour, "TTL of the cached label names, label values and series query results.")
+	f.BoolVar(&cfg.CacheFederatedQueriesPerTenant, "query-frontend.cache-federated-queries-per-tenant", false, "Execute the federated range and instant queries separately for each tenant, when the query doesn't aggregate or match the series of different tenants together, so that their results are cached per tenant. Requires -query-frontend.cache-results to be enabled.")
+	f.StringVar(&cfg.QueryResultResponseFormat, "query-frontend.query-result-response-format", formatJSON, fmt.Sprintf("Format to use when retrieving query results from queriers. Supported values: %s. Queriers not supporting the requested format reply with JSON.", strings.Join(allFormats, ", ")))
 	cfg.ResultsCacheConfig.RegisterFlags(f)
 }
 
@@ -64,6 +87,28 @@ func (cfg *Config) Validate() error {
 			return errors.Wrap(err, "invalid ResultsCache config")
 		}
 	}
+	if cfg.CacheInstantQueries {
+		if !cfg.CacheResults {
+			return errors.New("-query-frontend.cache-instant-queries may only be enabled in conjunction with -query-frontend.cache-results. Please set the latter")
+		}
+		if cfg.InstantQueriesCacheStep <= 0 {
+			return errors.New("-query-frontend.instant-queries-cache-step must be greater than 0 when instant queries results caching is enabled")
+		}
+	}
+	if cfg.CacheMetadataQueries {
+		if !cfg.CacheResults {
+			return errors.New("-query-frontend.cache-metadata-queries may only be enabled in conjunction with -query-frontend.cache-results. Please set the latter")
+		}
+		if cfg.MetadataQueriesCacheTTL <= 0 {
+			return errors.New("-query-frontend.metadata-queries-cache-ttl must be greater than 0 when metadata queries results caching is enabled")
+		}
+	}
+	if cfg.CacheFederatedQueriesPerTenant && !cfg.CacheResults {
+		return errors.New("-query-frontend.cache-federated-queries-per-tenant may only be enabled in conjunction with -query-frontend.cache-results. Please set the latter")
+	}
+	if !util.StringsContain(allFormats, cfg.QueryResultResponseFormat) {
+		return errors.Errorf("unknown query result response format '%s'. Supported values: %s", cfg.QueryResultResponseFormat, strings.Join(allFormats, ", "))
+	}
 	return nil
 }
 
@@ -158,34 +203,48 @@ func newQueryTripperware(
 	// Metric used to keep track of each middleware execution duration.
 	metrics := newInstrumentMiddlewareMetrics(registerer)
 
+	// Shared by the range and instant query middlewares, to only register its metrics once.
+	queryBlockerMiddleware := newQueryBlockerMiddleware(limits, log, registerer)
+
 	queryRangeMiddleware := []Middleware{
 		// Track query range statistics. Added first before any subsequent middleware modifies the request.
 		newQueryStatsMiddleware(registerer),
 		newLimitsMiddleware(limits, log),
+		queryBlockerMiddleware,
 	}
 	if cfg.AlignQueriesWithStep {
 		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("step_align", metrics, log), newStepAlignMiddleware())
 	}
 
-	// Inject the middleware to split requests by interval + results cache (if at least one of the two is enabled).
-	if cfg.SplitQueriesByInterval > 0 || cfg.CacheResults {
-		var c cache.Cache
+	// The cost of the queries is estimated once for the whole query, before the query is split and looked up
+	// in the results cache. The middleware is injected once the downstream is known.
+	queryRangeCostIndex := len(queryRangeMiddleware)
 
-		// Init the cache client.
-		if cfg.CacheResults {
-			var err error
+	// Init the cache client.
+	var c cache.Cache
+	if cfg.CacheResults {
+		var err error
 
-			c, err = newResultsCache(cfg.ResultsCacheConfig, log, registerer)
-			if err != nil {
-				return nil, err
-			}
-			c = cache.NewCompression(cfg.ResultsCacheConfig.Compression, c, log)
+		c, err = newResultsCache(cfg.ResultsCacheConfig, log, registerer)
+		if err != nil {
+			return nil, err
 		}
+		c = cache.NewCompression(cfg.ResultsCacheConfig.Compression, c, log)
+	}
 
-		shouldCache := func(r Request) bool {
-			return !r.GetOptions().CacheDisabled
-		}
+	shouldCache := func(r Request) bool {
+		return !r.GetOptions().CacheDisabled
+	}
 
+	// Inject the middleware to split federated queries by tenant, before the results cache (if enabled).
+	var splitByTenantMiddleware Middleware
+	if cfg.CacheResults && cfg.CacheFederatedQueriesPerTenant {
+		splitByTenantMiddleware = newSplitByTenantMiddleware(log, registerer)
+		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("split_by_tenant", metrics, log), splitByTenantMiddleware)
+	}
+
+	// Inject the middleware to split requests by interval + results cache (if at least one of the two is enabled).
+	if cfg.SplitQueriesByInterval > 0 || cfg.CacheResults {
 		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("split_by_interval_and_results_cache", metrics, log), newSplitAndCacheMiddleware(
 			cfg.SplitQueriesByInterval > 0,
 			cfg.CacheResults,
@@ -201,14 +260,44 @@ func newQueryTripperware(
 			registerer,
 		))
 	}
-	queryInstantMiddleware := []Middleware{newLimitsMiddleware(limits, log)}
+
+	queryInstantMiddleware := []Middleware{newLimitsMiddleware(limits, log), queryBlockerMiddleware}
+	queryInstantCostIndex := len(queryInstantMiddleware)
+	if splitByTenantMiddleware != nil {
+		queryInstantMiddleware = append(queryInstantMiddleware, newInstrumentMiddleware("split_by_tenant", metrics, log), splitByTenantMiddleware)
+	}
+
+	// Inject the middleware to cache instant queries results (if enabled). The evaluation time of instant
+	// queries is never changed, so only the queries whose evaluation time is aligned to the step are cached.
+	if cfg.CacheResults && cfg.CacheInstantQueries {
+		queryInstantMiddleware = append(queryInstantMiddleware, newInstrumentMiddleware("results_cache", metrics, log), newInstantQueryCacheMiddleware(
+			c,
+			cfg.InstantQueriesCacheStep,
+			cfg.CacheUnalignedRequests,
+			limits,
+			cacheExtractor,
+			shouldCache,
+			log,
+			registerer,
+		))
+	}
+
+	// The engine used to run the split and sharded queries. Disable concurrency limits for them.
+	engineOpts.ActiveQueryTracker = nil
+	engine := promql.NewEngine(engineOpts)
+
+	// Inject the middleware to split the range vector functions of instant queries by interval. The splitting
+	// interval is a per-tenant limit, so the middleware is always injected.
+	queryInstantMiddleware = append(
+		queryInstantMiddleware,
+		newInstrumentMiddleware("split_instant_by_interval", metrics, log),
+		newSplitInstantQueryByIntervalMiddleware(log, engine, limits, registerer),
+	)
 
 	if cfg.ShardedQueries {
-		// Disable concurrency limits for sharded queries.
-		engineOpts.ActiveQueryTracker = nil
 		queryshardingMiddleware := newQueryShardingMiddleware(
 			log,
-			promql.NewEngine(engineOpts),
+			engine,
 			limits,
 			registerer,
 		)
@@ -230,18 +319,36 @@ func newQueryTripperware(
 		queryInstantMiddleware = append(queryInstantMiddleware, newInstrumentMiddleware("retry", metrics, log), newRetryMiddleware(log, cfg.MaxRetries, retryMiddlewareMetrics))
 	}
 
+	// The results of the label names, label values and series queries are only cached if enabled.
+	var metadataCache cache.Cache
+	if cfg.CacheMetadataQueries {
+		metadataCache = c
+	}
+	metadataQueriesEnabled := cfg.SplitMetadataQueriesByInterval > 0 || metadataCache != nil
+	metadataQueriesMetrics := newMetadataQueryRoundTripperMetrics(registerer)
+	queryCostMetrics := newQueryCostMiddlewareMetrics(registerer)
+	seriesCounts := newSeriesCountCache(seriesCountCacheSize, seriesCountCacheTTL)
+
 	return func(next http.RoundTripper) http.RoundTripper {
-		queryrange := newLimitedParallelismRoundTripper(next, codec, limits, queryRangeMiddleware...)
+		queryCostMiddleware := []Middleware{newInstrumentMiddleware("query_cost", metrics, log), newQueryCostMiddleware(next, limits, log, queryCostMetrics, seriesCounts)}
+
+		queryrange := newLimitedParallelismRoundTripper(next, codec, limits, insertMiddlewares(queryRangeMiddleware, queryRangeCostIndex, queryCostMiddleware...)...)
 		instant := defaultInstantQueryParamsRoundTripper(
-			newLimitedParallelismRoundTripper(next, codec, limits, queryInstantMiddleware...),
+			newLimitedParallelismRoundTripper(next, codec, limits, insertMiddlewares(queryInstantMiddleware, queryInstantCostIndex, queryCostMiddleware...)...),
 			time.Now,
 		)
+		metadata := next
+		if metadataQueriesEnabled {
+			metadata = newMetadataQueryRoundTripper(next, cfg.SplitMetadataQueriesByInterval, metadataCache, cfg.MetadataQueriesCacheTTL, limits, log, metadataQueriesMetrics)
+		}
 		return RoundTripFunc(func(r *http.Request) (*http.Response, error) {
 			switch {
 			case isRangeQuery(r.URL.Path):
 				return queryrange.RoundTrip(r)
 			case isInstantQuery(r.URL.Path):
 				return instant.RoundTrip(r)
+			case isMetadataQuery(r.URL.Path) && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+				return metadata.RoundTrip(r)
 			default:
 				return next.RoundTrip(r)
 			}
@@ -249,6 +356,14 @@ func newQueryTripperware(
 	}, nil
 }
 
+// insertMiddlewares returns a copy of the middlewares with the inserted ones at the index i.
+func insertMiddlewares(middlewares []Middleware, i int, inserted ...Middleware) []Middleware {
+	res := make([]Middleware, 0, len(middlewares)+len(inserted))
+	res = append(res, middlewares[:i]...)
+	res = append(res, inserted...)
+	return append(res, middlewares[i:]...)
+}
+
 func newActiveUsersTripperware(logger log.Logger, registerer prometheus.Registerer) Tripperware {
 	// Per tenant query metrics.
 	queriesPerTenant := promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
@@ -18,6 +18,9 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,7 +32,11 @@ import (
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/user"
 
+	"github.com/grafana/mimir/pkg/frontend/transport"
+	frontendv1 "github.com/grafana/mimir/pkg/frontend/v1"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 func TestRangeTripperware(t *testing.T) {
@@ -269,3 +276,89 @@ func (s singleHostRoundTripper) RoundTrip(r *http.Request) (*http.Response, erro
 	r.URL.Host = s.host
 	return s.next.RoundTrip(r)
 }
+
+func TestTripperware_ShouldPropagateRequestHeadersToTheFrontendQueue(t *testing.T) {
+	const query = "/api/v1/query_range?end=1536716880&query=sum%28container_memory_rss%29+by+%28namespace%29&start=1536673680&step=120"
+
+	tests := map[string]struct {
+		headers          map[string]string
+		expectedPriority queue.Priority
+	}{
+		"no matching rule": {
+			headers:          map[string]string{"User-Agent": "grafana"},
+			expectedPriority: queue.PriorityNormal,
+		},
+		"User-Agent matching a rule": {
+			headers:          map[string]string{"User-Agent": "batch-job"},
+			expectedPriority: queue.PriorityLow,
+		},
+		"custom header matching a rule": {
+			headers:          map[string]string{"X-Dashboard": "ops"},
+			expectedPriority: queue.PriorityHigh,
+		},
+		"priority header lowering the priority": {
+			headers:          map[string]string{"X-Dashboard": "ops", queue.PriorityHeader: "low"},
+			expectedPriority: queue.PriorityLow,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The frontend has no querier connected, so the query stays in the queue.
+			reg := prometheus.NewPedanticRegistry()
+			cfg := frontendv1.Config{}
+			flagext.DefaultValues(&cfg)
+			frontend, err := frontendv1.New(cfg, queuePriorityLimits{
+				{Regex: "batch-.*", Priority: "low"},
+				{Header: "X-Dashboard", Regex: "ops", Priority: "high"},
+			}, log.NewNopLogger(), reg)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), frontend))
+			t.Cleanup(func() {
+				require.NoError(t, services.StopAndAwaitTerminated(context.Background(), frontend))
+			})
+
+			tw, err := NewTripperware(Config{}, log.NewNopLogger(), mockLimits{}, PrometheusCodec, nil, promql.EngineOpts{
+				Logger:     log.NewNopLogger(),
+				MaxSamples: 1000,
+				Timeout:    time.Minute,
+			}, nil)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(user.InjectOrgID(context.Background(), "user-1"))
+			req, err := http.NewRequestWithContext(ctx, "GET", query, http.NoBody)
+			require.NoError(t, err)
+			require.NoError(t, user.InjectOrgIDIntoHTTPRequest(ctx, req))
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_, _ = tw(transport.AdaptGrpcRoundTripperToHTTPRoundTripper(frontend)).RoundTrip(req)
+			}()
+
+			test.Poll(t, time.Second, nil, func() interface{} {
+				return testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+					# HELP cortex_query_frontend_queue_length Number of queries in the queue.
+					# TYPE cortex_query_frontend_queue_length gauge
+					cortex_query_frontend_queue_length{priority="%s",user="user-1"} 1
+				`, tc.expectedPriority)), "cortex_query_frontend_queue_length")
+			})
+
+			cancel()
+			<-done
+		})
+	}
+}
+
+type queuePriorityLimits []validation.QueryPriorityRule
+
+func (l queuePriorityLimits) MaxQueriersPerUser(string) int {
+	return 0
+}
+
+func (l queuePriorityLimits) QueryPriorityRules(string) []validation.QueryPriorityRule {
+	return l
+}
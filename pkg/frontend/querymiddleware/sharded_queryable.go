@@ -36,6 +36,7 @@ type shardedQueryable struct {
 	req             Request
 	handler         Handler
 	responseHeaders *responseHeadersTracker
+	results         *embeddedQueriesResults
 }
 
 // newShardedQueryable makes a new shardedQueryable. We expect a new queryable is created for each
@@ -46,12 +47,13 @@ func newShardedQueryable(req Request, next Handler) *shardedQueryable {
 		req:             req,
 		handler:         next,
 		responseHeaders: newResponseHeadersTracker(),
+		results:         newEmbeddedQueriesResults(),
 	}
 }
 
 // Querier implements storage.Queryable.
 func (q *shardedQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return &shardedQuerier{ctx: ctx, req: q.req, handler: q.handler, responseHeaders: q.responseHeaders}, nil
+	return &shardedQuerier{ctx: ctx, req: q.req, handler: q.handler, responseHeaders: q.responseHeaders, results: q.results}, nil
 }
 
 // getResponseHeaders returns the merged response headers received by the downstream
@@ -70,6 +72,10 @@ type shardedQuerier struct {
 
 	// Keep track of response headers received when running embedded queries.
 	responseHeaders *responseHeadersTracker
+
+	// Results of the embedded queries already run, so that an embedded query referenced
+	// multiple times by the same query is only run once.
+	results *embeddedQueriesResults
 }
 
 // Select implements storage.Querier.
@@ -110,18 +116,24 @@ func (q *shardedQuerier) handleEmbeddedQueries(queries []string, hints *storage.
 
 	// Concurrently run each query. It breaks and cancels each worker context on first error.
 	err := concurrency.ForEachJob(q.ctx, len(queries), len(queries), func(ctx context.Context, idx int) error {
-		resp, err := q.handler.Do(ctx, q.req.WithQuery(queries[idx]))
-		if err != nil {
-			return err
-		}
+		resStreams, err := q.results.getOrRun(ctx, queries[idx], func() ([]SampleStream, error) {
+			resp, err := q.handler.Do(ctx, q.req.WithQuery(queries[idx]))
+			if err != nil {
+				return nil, err
+			}
+
+			resStreams, err := responseToSamples(resp)
+			if err != nil {
+				return nil, err
+			}
 
-		resStreams, err := responseToSamples(resp)
+			q.responseHeaders.mergeHeaders(resp.(*PrometheusResponse).Headers)
+			return resStreams, nil
+		})
 		if err != nil {
 			return err
 		}
 		streams[idx] = resStreams // No mutex is needed since each job writes its own index. This is like writing separate variables.
-
-		q.responseHeaders.mergeHeaders(resp.(*PrometheusResponse).Headers)
 		return nil
 	})
 
@@ -147,6 +159,59 @@ func (q *shardedQuerier) Close() error {
 	return nil
 }
 
+// embeddedQueriesResults holds the results of the embedded queries run by a sharded query, by query.
+// The results are never modified once stored, so they can be shared by multiple series sets.
+type embeddedQueriesResults struct {
+	mx      sync.Mutex
+	results map[string]*embeddedQueryResult
+}
+
+type embeddedQueryResult struct {
+	done    chan struct{}
+	streams []SampleStream
+	err     error
+}
+
+func newEmbeddedQueriesResults() *embeddedQueriesResults {
+	return &embeddedQueriesResults{
+		results: make(map[string]*embeddedQueryResult),
+	}
+}
+
+// getOrRun returns the results of the given query, calling run only if the query hasn't already been
+// run (or is not running). A failed query is not cached, so that it's run again the next time.
+func (r *embeddedQueriesResults) getOrRun(ctx context.Context, query string, run func() ([]SampleStream, error)) ([]SampleStream, error) {
+	r.mx.Lock()
+	res, ok := r.results[query]
+	if !ok {
+		res = &embeddedQueryResult{done: make(chan struct{})}
+		r.results[query] = res
+	}
+	r.mx.Unlock()
+
+	if ok {
+		select {
+		case <-res.done:
+			if res.err == nil {
+				return res.streams, nil
+			}
+			// The query failed (e.g. because its context has been canceled), so we run it again.
+			return run()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	res.streams, res.err = run()
+	if res.err != nil {
+		r.mx.Lock()
+		delete(r.results, query)
+		r.mx.Unlock()
+	}
+	close(res.done)
+	return res.streams, res.err
+}
+
 type responseHeadersTracker struct {
 	headersMx sync.Mutex
 	headers   map[string][]string
@@ -18,6 +18,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware/astmapper"
 	"github.com/grafana/mimir/pkg/mimirpb"
@@ -247,6 +248,50 @@ func TestShardedQuerier_Select_ShouldConcurrentlyRunEmbeddedQueries(t *testing.T
 	require.Equal(t, len(embeddedQueries), actualSeries)
 }
 
+func TestShardedQuerier_Select_ShouldRunTheSameEmbeddedQueryOnlyOnce(t *testing.T) {
+	embeddedQueries := []string{
+		`count(metric{__query_shard__="0_of_2"})`,
+		`count(metric{__query_shard__="1_of_2"})`,
+	}
+
+	var calls atomic.Int64
+	querier := mkShardedQuerier(HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+		calls.Inc()
+
+		return &PrometheusResponse{
+			Data: &PrometheusData{
+				ResultType: string(parser.ValueTypeVector),
+				Result: []SampleStream{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "a", Value: "1"}},
+					Samples: []mimirpb.Sample{{Value: 1, TimestampMs: 1}},
+				}},
+			},
+		}, nil
+	}))
+
+	encodedQueries, err := astmapper.JSONCodec.Encode(embeddedQueries)
+	require.Nil(t, err)
+
+	// Select the same embedded queries multiple times, like a query referencing them multiple times does.
+	for i := 0; i < 3; i++ {
+		seriesSet := querier.Select(
+			false,
+			nil,
+			labels.MustNewMatcher(labels.MatchEqual, "__name__", astmapper.EmbeddedQueriesMetricName),
+			labels.MustNewMatcher(labels.MatchEqual, astmapper.EmbeddedQueriesLabelName, encodedQueries),
+		)
+
+		var actualSeries int
+		for seriesSet.Next() {
+			actualSeries++
+		}
+		require.NoError(t, seriesSet.Err())
+		require.Equal(t, len(embeddedQueries), actualSeries)
+	}
+
+	assert.Equal(t, int64(len(embeddedQueries)), calls.Load())
+}
+
 func TestShardedQueryable_GetResponseHeaders(t *testing.T) {
 	queryable := newShardedQueryable(&PrometheusRangeQueryRequest{}, nil)
 	assert.Empty(t, queryable.getResponseHeaders())
@@ -279,7 +324,7 @@ func TestShardedQueryable_GetResponseHeaders(t *testing.T) {
 }
 
 func mkShardedQuerier(handler Handler) *shardedQuerier {
-	return &shardedQuerier{ctx: context.Background(), req: &PrometheusRangeQueryRequest{}, handler: handler, responseHeaders: newResponseHeadersTracker()}
+	return &shardedQuerier{ctx: context.Background(), req: &PrometheusRangeQueryRequest{}, handler: handler, responseHeaders: newResponseHeadersTracker(), results: newEmbeddedQueriesResults()}
 }
 
 func TestNewSeriesSetFromEmbeddedQueriesResults(t *testing.T) {
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/grafana/dskit/tenant"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/frontend/querymiddleware/astmapper"
+	"github.com/grafana/mimir/pkg/storage/lazyquery"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type splitInstantQueryByInterval struct {
+	limits Limits
+
+	engine *promql.Engine
+	next   Handler
+	logger log.Logger
+
+	instantQuerySplittingMetrics
+}
+
+type instantQuerySplittingMetrics struct {
+	splittingAttempts    prometheus.Counter
+	splittingSuccesses   prometheus.Counter
+	splitQueries         prometheus.Counter
+	splitQueriesPerQuery prometheus.Histogram
+}
+
+// newSplitInstantQueryByIntervalMiddleware creates a middleware that splits the range vector functions of
+// instant queries by time. The query is rewritten so that each time partition of the splittable functions
+// is an embedded query, and the rewritten query is executed by the PromQL engine through shardedQueryable,
+// which sends the embedded queries to downstream in parallel.
+func newSplitInstantQueryByIntervalMiddleware(
+	logger log.Logger,
+	engine *promql.Engine,
+	limits Limits,
+	registerer prometheus.Registerer,
+) Middleware {
+	metrics := instantQuerySplittingMetrics{
+		splittingAttempts: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "frontend_instant_query_splitting_rewrites_attempted_total",
+			Help:      "Total number of instant queries the query-frontend attempted to split by interval.",
+		}),
+		splittingSuccesses: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "frontend_instant_query_splitting_rewrites_succeeded_total",
+			Help:      "Total number of instant queries the query-frontend successfully rewritten in a splittable way.",
+		}),
+		splitQueries: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "frontend_instant_query_split_queries_total",
+			Help:      "Total number of queries instant queries have been split into.",
+		}),
+		splitQueriesPerQuery: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+			Namespace: "cortex",
+			Name:      "frontend_instant_query_split_queries_per_query",
+			Help:      "Number of queries a single instant query has been split into.",
+			Buckets:   prometheus.ExponentialBuckets(2, 2, 10),
+		}),
+	}
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &splitInstantQueryByInterval{
+			next:                         next,
+			instantQuerySplittingMetrics: metrics,
+			engine:                       engine,
+			logger:                       logger,
+			limits:                       limits,
+		}
+	})
+}
+
+func (s *splitInstantQueryByInterval) Do(ctx context.Context, r Request) (Response, error) {
+	// Only instant queries are split, range queries are split by the split and cache middleware.
+	if _, ok := r.(*PrometheusInstantQueryRequest); !ok {
+		return s.next.Do(ctx, r)
+	}
+
+	log, ctx := spanlogger.NewWithLogger(ctx, s.logger, "splitInstantQueryByInterval.Do")
+	defer log.Span.Finish()
+
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	interval := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, s.limits.SplitInstantQueriesByInterval)
+	if interval <= 0 {
+		level.Debug(log).Log("msg", "instant queries splitting is disabled for this tenant")
+		return s.next.Do(ctx, r)
+	}
+
+	s.splittingAttempts.Inc()
+	splitQuery, splittingStats, err := s.splitQuery(r.GetQuery(), interval)
+
+	// If an error occurred while trying to rewrite the query or the query has not been split,
+	// then we should fallback to execute it as is.
+	if err != nil || splittingStats.GetSplitQueries() == 0 {
+		if err != nil {
+			level.Warn(log).Log("msg", "failed to rewrite the input query into a splittable query, falling back to try executing without splitting", "query", r.GetQuery(), "err", err)
+		} else {
+			level.Debug(log).Log("msg", "query is not supported for being rewritten into a splittable query", "query", r.GetQuery())
+		}
+
+		return s.next.Do(ctx, r)
+	}
+
+	level.Debug(log).Log("msg", "instant query has been split by interval", "original", r.GetQuery(), "rewritten", splitQuery, "split_queries", splittingStats.GetSplitQueries())
+
+	// Update metrics.
+	s.splittingSuccesses.Inc()
+	s.splitQueries.Add(float64(splittingStats.GetSplitQueries()))
+	s.splitQueriesPerQuery.Observe(float64(splittingStats.GetSplitQueries()))
+
+	r = r.WithQuery(splitQuery)
+	splitQueryable := newShardedQueryable(r, s.next)
+
+	qry, err := newQuery(r, s.engine, lazyquery.NewLazyQueryable(splitQueryable))
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	res := qry.Exec(ctx)
+	extracted, err := promqlResultToSamples(res)
+	if err != nil {
+		return nil, mapEngineError(err)
+	}
+	return &PrometheusResponse{
+		Status: statusSuccess,
+		Data: &PrometheusData{
+			ResultType: string(res.Value.Type()),
+			Result:     extracted,
+		},
+		Headers: splitQueryable.getResponseHeaders(),
+	}, nil
+}
+
+// splitQuery attempts to rewrite the input query in a splittable way. Returns the rewritten query
+// to be executed by PromQL engine with shardedQueryable.
+func (s *splitInstantQueryByInterval) splitQuery(query string, interval time.Duration) (string, *astmapper.MapperStats, error) {
+	mapper := astmapper.NewInstantQuerySplitter(interval, s.logger)
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	stats := astmapper.NewMapperStats()
+	splitQuery, err := mapper.Map(expr, stats)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return splitQuery.String(), stats, nil
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+func TestSplitInstantQueryByInterval_Correctness(t *testing.T) {
+	var (
+		seriesStart = time.Unix(0, 0)
+		seriesEnd   = seriesStart.Add(6 * time.Hour)
+		queryTime   = seriesEnd.Add(-30 * time.Minute)
+		series      []*promql.StorageSeries
+	)
+
+	for i := 0; i < 20; i++ {
+		series = append(series, newSeries(newTestCounterLabels(i), seriesStart, seriesEnd, 30*time.Second, factor(float64(i+1))))
+	}
+	queryable := storageSeriesQueryable(series)
+
+	tests := map[string]struct {
+		query               string
+		expectedSplit       int
+		approximatedResults bool
+	}{
+		"sum_over_time": {
+			query:         `sum_over_time(metric_counter[3h])`,
+			expectedSplit: 3,
+		},
+		"count_over_time with offset": {
+			query:         `count_over_time(metric_counter{group_1="0"}[150m] offset 1h)`,
+			expectedSplit: 3,
+		},
+		"max_over_time": {
+			query:         `max_over_time(metric_counter[2h])`,
+			expectedSplit: 2,
+		},
+		"min_over_time with @ modifier": {
+			query:         `min_over_time(metric_counter[2h] @ 7200)`,
+			expectedSplit: 2,
+		},
+		"aggregation of sum_over_time": {
+			query:         `sum by(group_2) (sum_over_time(metric_counter[3h]))`,
+			expectedSplit: 3,
+		},
+		"max_over_time of subquery": {
+			query:         `max_over_time(rate(metric_counter[5m])[3h:1m])`,
+			expectedSplit: 3,
+		},
+		"binary expression with not split leg": {
+			query:         `sum_over_time(metric_counter[3h]) / on(unique) metric_counter`,
+			expectedSplit: 3,
+		},
+		"rate": {
+			query:               `rate(metric_counter[3h])`,
+			expectedSplit:       3,
+			approximatedResults: true,
+		},
+		"increase": {
+			query:               `sum(increase(metric_counter[3h]))`,
+			expectedSplit:       3,
+			approximatedResults: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := &PrometheusInstantQueryRequest{
+				Path:  "/query",
+				Time:  util.TimeToMillis(queryTime),
+				Query: tc.query,
+			}
+			ctx := user.InjectOrgID(context.Background(), "test")
+			downstream := &downstreamHandler{engine: newEngine(), queryable: queryable}
+
+			expectedRes, err := downstream.Do(ctx, req)
+			require.NoError(t, err)
+			expected := expectedRes.(*PrometheusResponse)
+			requireValidSamples(t, expected.Data.Result)
+
+			reg := prometheus.NewPedanticRegistry()
+			splitter := newSplitInstantQueryByIntervalMiddleware(log.NewNopLogger(), newEngine(), mockLimits{splitInstantQueries: time.Hour}, reg)
+			actualRes, err := splitter.Wrap(downstream).Do(ctx, req)
+			require.NoError(t, err)
+			actual := actualRes.(*PrometheusResponse)
+
+			sort.Sort(byLabels(expected.Data.Result))
+			sort.Sort(byLabels(actual.Data.Result))
+
+			if tc.approximatedResults {
+				require.Equal(t, statusSuccess, actual.Status)
+				require.Len(t, actual.Data.Result, len(expected.Data.Result))
+				for i, stream := range expected.Data.Result {
+					require.Equal(t, stream.Labels, actual.Data.Result[i].Labels)
+					require.Len(t, actual.Data.Result[i].Samples, 1)
+					assert.InEpsilon(t, stream.Samples[0].Value, actual.Data.Result[i].Samples[0].Value, 0.01)
+				}
+			} else {
+				approximatelyEquals(t, expected, actual)
+			}
+
+			assert.Equal(t, float64(tc.expectedSplit), testutil.ToFloat64(splitter.Wrap(downstream).(*splitInstantQueryByInterval).splitQueries))
+		})
+	}
+}
+
+func TestSplitInstantQueryByInterval_ShouldNotSplit(t *testing.T) {
+	tests := map[string]struct {
+		req      Request
+		interval time.Duration
+	}{
+		"splitting disabled": {
+			req:      &PrometheusInstantQueryRequest{Path: "/query", Query: `sum_over_time(metric[3h])`},
+			interval: 0,
+		},
+		"range shorter than the interval": {
+			req:      &PrometheusInstantQueryRequest{Path: "/query", Query: `sum_over_time(metric[30m])`},
+			interval: time.Hour,
+		},
+		"invalid query": {
+			req:      &PrometheusInstantQueryRequest{Path: "/query", Query: `sum_over_time(metric[3h]`},
+			interval: time.Hour,
+		},
+		"range query": {
+			req:      &PrometheusRangeQueryRequest{Path: "/query_range", Query: `sum_over_time(metric[3h])`, Start: 0, End: 3600000, Step: 60000},
+			interval: time.Hour,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			downstream := &mockHandler{}
+			downstream.On("Do", mock.Anything, tc.req).Return(&PrometheusResponse{Status: statusSuccess}, nil)
+
+			splitter := newSplitInstantQueryByIntervalMiddleware(log.NewNopLogger(), newEngine(), mockLimits{splitInstantQueries: tc.interval}, nil)
+			res, err := splitter.Wrap(downstream).Do(user.InjectOrgID(context.Background(), "test"), tc.req)
+			require.NoError(t, err)
+			assert.Equal(t, statusSuccess, res.(*PrometheusResponse).GetStatus())
+			downstream.AssertNumberOfCalls(t, "Do", 1)
+		})
+	}
+}
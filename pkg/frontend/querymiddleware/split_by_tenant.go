@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/user"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/dskit/tenant"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+const (
+	// tenantLabel is the label added by the querier to the series of federated queries to identify the tenant.
+	tenantLabel = "__tenant_id__"
+	// retainedTenantLabel is the label the querier renames the tenantLabel of the series to, when they already have it.
+	retainedTenantLabel = "original_" + tenantLabel
+)
+
+var (
+	// notSplittableByTenantFuncs are the functions whose result depends on the series of all the tenants.
+	notSplittableByTenantFuncs = map[string]struct{}{
+		"absent":           {},
+		"absent_over_time": {},
+		"scalar":           {},
+		"sort":             {},
+		"sort_desc":        {},
+		"vector":           {},
+	}
+
+	errNotSplittableByTenant = errors.New("the query is not splittable by tenant")
+)
+
+type splitByTenant struct {
+	next   Handler
+	logger log.Logger
+
+	splittingAttempts  prometheus.Counter
+	splittingSuccesses prometheus.Counter
+}
+
+// newSplitByTenantMiddleware creates a middleware that executes federated queries separately for each tenant,
+// when the query doesn't aggregate or match the series of different tenants together. The results of each
+// tenant get the tenant label the querier would have added, and are cached per tenant by the next middlewares,
+// so that the cached results are reused by any federated query including the tenant.
+func newSplitByTenantMiddleware(logger log.Logger, registerer prometheus.Registerer) Middleware {
+	splittingAttempts := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "frontend_federated_query_splitting_attempted_total",
+		Help:      "Total number of federated queries the query-frontend attempted to split by tenant.",
+	})
+	splittingSuccesses := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "frontend_federated_query_splitting_succeeded_total",
+		Help:      "Total number of federated queries the query-frontend successfully split by tenant.",
+	})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &splitByTenant{
+			next:               next,
+			logger:             logger,
+			splittingAttempts:  splittingAttempts,
+			splittingSuccesses: splittingSuccesses,
+		}
+	})
+}
+
+func (s *splitByTenant) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	// Only federated queries are split.
+	if len(tenantIDs) <= 1 {
+		return s.next.Do(ctx, r)
+	}
+
+	log, ctx := spanlogger.NewWithLogger(ctx, s.logger, "splitByTenant.Do")
+	defer log.Span.Finish()
+
+	s.splittingAttempts.Inc()
+	if err := isSplittableByTenant(r.GetQuery()); err != nil {
+		level.Debug(log).Log("msg", "query is not supported for being split by tenant", "query", r.GetQuery(), "reason", err)
+		return s.next.Do(ctx, r)
+	}
+	s.splittingSuccesses.Inc()
+
+	level.Debug(log).Log("msg", "federated query has been split by tenant", "query", r.GetQuery(), "tenants", len(tenantIDs))
+
+	var (
+		g, gCtx   = errgroup.WithContext(ctx)
+		mtx       sync.Mutex
+		responses = make(map[string]*PrometheusResponse, len(tenantIDs))
+	)
+	for _, tenantID := range tenantIDs {
+		tenantID := tenantID
+
+		g.Go(func() error {
+			res, err := s.next.Do(user.InjectOrgID(gCtx, tenantID), r)
+			if err != nil {
+				return err
+			}
+
+			mtx.Lock()
+			responses[tenantID] = res.(*PrometheusResponse)
+			mtx.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return mergeTenantResponses(tenantIDs, responses)
+}
+
+// mergeTenantResponses merges the responses of the queries executed for each tenant, adding the
+// tenant label to their series and merging their headers.
+func mergeTenantResponses(tenantIDs []string, responses map[string]*PrometheusResponse) (*PrometheusResponse, error) {
+	var (
+		resultType string
+		result     []SampleStream
+		headers    = newResponseHeadersTracker()
+	)
+
+	for _, tenantID := range tenantIDs {
+		res := responses[tenantID]
+		if res.Status != statusSuccess || res.Data == nil {
+			return nil, apierror.Newf(apierror.TypeInternal, "can't merge an unsuccessful response")
+		}
+		if resultType == "" {
+			resultType = res.Data.ResultType
+		} else if resultType != res.Data.ResultType {
+			return nil, apierror.Newf(apierror.TypeInternal, "can't merge responses with different result types %q and %q", resultType, res.Data.ResultType)
+		}
+		headers.mergeHeaders(res.Headers)
+
+		for _, stream := range res.Data.Result {
+			result = append(result, SampleStream{
+				Labels:  withTenantLabel(stream.Labels, tenantID),
+				Samples: stream.Samples,
+			})
+		}
+	}
+
+	// The series of a matrix are sorted by labels.
+	if resultType == model.ValMatrix.String() {
+		sort.Slice(result, func(i, j int) bool {
+			return labels.Compare(mimirpb.FromLabelAdaptersToLabels(result[i].Labels), mimirpb.FromLabelAdaptersToLabels(result[j].Labels)) < 0
+		})
+	}
+
+	if result == nil {
+		result = []SampleStream{}
+	}
+
+	return &PrometheusResponse{
+		Status: statusSuccess,
+		Data: &PrometheusData{
+			ResultType: resultType,
+			Result:     result,
+		},
+		Headers: headers.getHeaders(),
+	}, nil
+}
+
+// withTenantLabel returns the series labels with the tenant label, retaining the existing tenant label
+// of the series the same way the querier does.
+func withTenantLabel(series []mimirpb.LabelAdapter, tenantID string) []mimirpb.LabelAdapter {
+	lbls := mimirpb.FromLabelAdaptersToLabels(series)
+	lb := labels.NewBuilder(lbls)
+	if existing := lbls.Get(tenantLabel); existing != "" {
+		lb.Set(retainedTenantLabel, existing)
+	}
+	lb.Set(tenantLabel, tenantID)
+
+	return mimirpb.FromLabelsToLabelAdapters(lb.Labels())
+}
+
+// isSplittableByTenant returns nil if executing the query separately for each tenant, and adding the tenant
+// label to the results, returns the same results of the federated query. This is the case when the query
+// never aggregates or matches the series of different tenants together, and doesn't filter the tenants.
+func isSplittableByTenant(query string) error {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return err
+	}
+
+	// The tenant label can only be added to series.
+	if t := expr.Type(); t != parser.ValueTypeVector && t != parser.ValueTypeMatrix {
+		return errNotSplittableByTenant
+	}
+
+	var notSplittable error
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if notSplittable != nil {
+			return notSplittable
+		}
+		notSplittable = checkSplittableByTenant(node)
+		return notSplittable
+	})
+	return notSplittable
+}
+
+// checkSplittableByTenant returns errNotSplittableByTenant if the node prevents a query from being split by tenant.
+func checkSplittableByTenant(node parser.Node) error {
+	switch n := node.(type) {
+	case *parser.VectorSelector:
+		for _, m := range n.LabelMatchers {
+			if m.Name == tenantLabel || m.Name == retainedTenantLabel {
+				return errNotSplittableByTenant
+			}
+		}
+
+	case *parser.AggregateExpr:
+		// The series of different tenants are aggregated together unless they're grouped by tenant.
+		if n.Without == util.StringsContain(n.Grouping, tenantLabel) {
+			return errNotSplittableByTenant
+		}
+
+	case *parser.BinaryExpr:
+		// The series of different tenants are matched together unless they're matched by tenant.
+		if n.LHS.Type() == parser.ValueTypeVector && n.RHS.Type() == parser.ValueTypeVector && n.VectorMatching != nil {
+			if n.VectorMatching.On != util.StringsContain(n.VectorMatching.MatchingLabels, tenantLabel) {
+				return errNotSplittableByTenant
+			}
+		}
+
+	case *parser.Call:
+		if _, ok := notSplittableByTenantFuncs[n.Func.Name]; ok {
+			return errNotSplittableByTenant
+		}
+
+	case *parser.StringLiteral:
+		// The tenant label can't be used by functions like label_replace() or count_values().
+		if n.Val == tenantLabel || n.Val == retainedTenantLabel {
+			return errNotSplittableByTenant
+		}
+	}
+	return nil
+}
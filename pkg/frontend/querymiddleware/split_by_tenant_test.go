@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/dskit/tenant"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+func TestIsSplittableByTenant(t *testing.T) {
+	tests := map[string]bool{
+		`metric`:           true,
+		`rate(metric[5m])`: true,
+		`sum by(__tenant_id__, job) (rate(metric[5m]))`: true,
+		`sum without(job) (rate(metric[5m]))`:           true,
+		`topk by(__tenant_id__) (5, metric)`:            true,
+		`metric / other`:                                true,
+		`metric / on(__tenant_id__, job) other`:         true,
+		`metric / ignoring(job) group_left() other`:     true,
+		`metric > 10`:                            true,
+		`max_over_time(rate(metric[5m])[1h:1m])`: true,
+		`metric and other`:                       true,
+		`histogram_quantile(0.9, sum by(__tenant_id__, le) (metric))`: true,
+
+		`sum(metric)`:                            false,
+		`sum by(job) (metric)`:                   false,
+		`sum without(__tenant_id__) (metric)`:    false,
+		`metric / on(job) other`:                 false,
+		`metric / ignoring(__tenant_id__) other`: false,
+		`metric or on() vector(0)`:               false,
+		`metric > scalar(other)`:                 false,
+		`absent(metric)`:                         false,
+		`sort(metric)`:                           false,
+		`metric{__tenant_id__="a"}`:              false,
+		`metric{original___tenant_id__="a"}`:     false,
+		`label_replace(metric, "__tenant_id__", "$1", "job", "(.*)")`: false,
+		`count_values by(__tenant_id__) ("__tenant_id__", metric)`:    false,
+		`1 + 1`:  false,
+		`time()`: false,
+	}
+
+	for query, expected := range tests {
+		t.Run(query, func(t *testing.T) {
+			err := isSplittableByTenant(query)
+			if expected {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errNotSplittableByTenant)
+			}
+		})
+	}
+}
+
+func TestSplitByTenant_Correctness(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	defer tenant.WithDefaultResolver(tenant.NewSingleResolver())
+
+	var (
+		seriesStart = time.Unix(0, 0)
+		seriesEnd   = seriesStart.Add(2 * time.Hour)
+		tenantIDs   = []string{"tenant-a", "tenant-b", "tenant-c"}
+
+		tenantSeries    = map[string][]*promql.StorageSeries{}
+		federatedSeries []*promql.StorageSeries
+	)
+
+	for t, tenantID := range tenantIDs {
+		for i := 0; i < 10+t; i++ {
+			lbls := newTestCounterLabels(i)
+			tenantSeries[tenantID] = append(tenantSeries[tenantID], newSeries(lbls, seriesStart, seriesEnd, 30*time.Second, factor(float64(i+t+1))))
+
+			federatedLabels := labels.NewBuilder(lbls).Set(tenantLabel, tenantID).Labels()
+			federatedSeries = append(federatedSeries, newSeries(federatedLabels, seriesStart, seriesEnd, 30*time.Second, factor(float64(i+t+1))))
+		}
+	}
+
+	tests := map[string]Request{
+		"range query of a selector": &PrometheusRangeQueryRequest{
+			Path:  "/api/v1/query_range",
+			Start: util.TimeToMillis(seriesStart),
+			End:   util.TimeToMillis(seriesEnd),
+			Step:  time.Minute.Milliseconds(),
+			Query: `metric_counter{group_1="0"}`,
+		},
+		"range query aggregated by tenant": &PrometheusRangeQueryRequest{
+			Path:  "/api/v1/query_range",
+			Start: util.TimeToMillis(seriesStart),
+			End:   util.TimeToMillis(seriesEnd),
+			Step:  time.Minute.Milliseconds(),
+			Query: `sum by(__tenant_id__, group_2) (rate(metric_counter[5m]))`,
+		},
+		"instant query with binary expression": &PrometheusInstantQueryRequest{
+			Path:  "/api/v1/query",
+			Time:  util.TimeToMillis(seriesEnd),
+			Query: `metric_counter / on(__tenant_id__, unique) (metric_counter * 2)`,
+		},
+		"instant query aggregated without labels": &PrometheusInstantQueryRequest{
+			Path:  "/api/v1/query",
+			Time:  util.TimeToMillis(seriesEnd),
+			Query: `max without(unique, group_1) (metric_counter)`,
+		},
+	}
+
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), tenant.JoinTenantIDs(tenantIDs))
+
+			federated := &downstreamHandler{engine: newEngine(), queryable: storageSeriesQueryable(federatedSeries)}
+			expectedRes, err := federated.Do(ctx, req)
+			require.NoError(t, err)
+			expected := expectedRes.(*PrometheusResponse)
+			require.NotEmpty(t, expected.Data.Result)
+
+			// The downstream runs the query on the series of the tenant in the context.
+			downstream := HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+				tenantID, err := user.ExtractOrgID(ctx)
+				require.NoError(t, err)
+				require.Contains(t, tenantSeries, tenantID)
+
+				return (&downstreamHandler{engine: newEngine(), queryable: storageSeriesQueryable(tenantSeries[tenantID])}).Do(ctx, r)
+			})
+
+			reg := prometheus.NewPedanticRegistry()
+			actualRes, err := newSplitByTenantMiddleware(log.NewNopLogger(), reg).Wrap(downstream).Do(ctx, req)
+			require.NoError(t, err)
+			actual := actualRes.(*PrometheusResponse)
+
+			sort.Sort(byLabels(expected.Data.Result))
+			sort.Sort(byLabels(actual.Data.Result))
+			approximatelyEquals(t, expected, actual)
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_frontend_federated_query_splitting_succeeded_total Total number of federated queries the query-frontend successfully split by tenant.
+				# TYPE cortex_frontend_federated_query_splitting_succeeded_total counter
+				cortex_frontend_federated_query_splitting_succeeded_total 1
+			`), "cortex_frontend_federated_query_splitting_succeeded_total"))
+		})
+	}
+}
+
+func TestSplitByTenant_ShouldNotSplit(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	defer tenant.WithDefaultResolver(tenant.NewSingleResolver())
+
+	tests := map[string]struct {
+		orgID string
+		query string
+	}{
+		"single tenant": {
+			orgID: "tenant-a",
+			query: `metric`,
+		},
+		"query aggregating the series of different tenants": {
+			orgID: "tenant-a|tenant-b",
+			query: `sum(metric)`,
+		},
+		"invalid query": {
+			orgID: "tenant-a|tenant-b",
+			query: `sum(metric`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := &PrometheusInstantQueryRequest{Path: "/api/v1/query", Query: tc.query}
+			ctx := user.InjectOrgID(context.Background(), tc.orgID)
+
+			downstream := &mockHandler{}
+			downstream.On("Do", mock.Anything, req).Return(&PrometheusResponse{Status: statusSuccess}, nil).Run(func(args mock.Arguments) {
+				orgID, err := user.ExtractOrgID(args.Get(0).(context.Context))
+				require.NoError(t, err)
+				assert.Equal(t, tc.orgID, orgID)
+			})
+
+			res, err := newSplitByTenantMiddleware(log.NewNopLogger(), nil).Wrap(downstream).Do(ctx, req)
+			require.NoError(t, err)
+			assert.Equal(t, statusSuccess, res.(*PrometheusResponse).GetStatus())
+			downstream.AssertNumberOfCalls(t, "Do", 1)
+		})
+	}
+}
+
+func TestSplitByTenant_ShouldMergeResponseHeaders(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	defer tenant.WithDefaultResolver(tenant.NewSingleResolver())
+
+	req := &PrometheusInstantQueryRequest{Path: "/api/v1/query", Query: `metric`}
+	ctx := user.InjectOrgID(context.Background(), "tenant-a|tenant-b")
+
+	downstream := HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+		orgID, err := user.ExtractOrgID(ctx)
+		require.NoError(t, err)
+
+		return &PrometheusResponse{
+			Status: statusSuccess,
+			Data:   &PrometheusData{ResultType: "vector", Result: []SampleStream{}},
+			Headers: []*PrometheusResponseHeader{
+				{Name: "Results-Cache-Gen-Number", Values: []string{"1"}},
+				{Name: "Tenant", Values: []string{orgID}},
+			},
+		}, nil
+	})
+
+	res, err := newSplitByTenantMiddleware(log.NewNopLogger(), nil).Wrap(downstream).Do(ctx, req)
+	require.NoError(t, err)
+
+	headers := map[string][]string{}
+	for _, h := range res.(*PrometheusResponse).GetHeaders() {
+		sort.Strings(h.Values)
+		headers[h.Name] = h.Values
+	}
+	assert.Equal(t, map[string][]string{
+		"Results-Cache-Gen-Number": {"1"},
+		"Tenant":                   {"tenant-a", "tenant-b"},
+	}, headers)
+}
+
+func TestWithTenantLabel(t *testing.T) {
+	tests := map[string]struct {
+		input    labels.Labels
+		expected labels.Labels
+	}{
+		"series without tenant label": {
+			input:    labels.FromStrings("__name__", "metric", "job", "test"),
+			expected: labels.FromStrings("__name__", "metric", "__tenant_id__", "tenant-a", "job", "test"),
+		},
+		"series with tenant label": {
+			input:    labels.FromStrings("__name__", "metric", "__tenant_id__", "other"),
+			expected: labels.FromStrings("__name__", "metric", "__tenant_id__", "tenant-a", "original___tenant_id__", "other"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := withTenantLabel(mimirpb.FromLabelsToLabelAdapters(tc.input), "tenant-a")
+			assert.Equal(t, tc.expected, mimirpb.FromLabelAdaptersToLabels(actual))
+		})
+	}
+}
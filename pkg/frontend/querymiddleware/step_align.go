@@ -7,6 +7,7 @@ package querymiddleware
 
 import (
 	"context"
+	"time"
 )
 
 // newStepAlignMiddleware creates a middleware that aligns the start and end of request to the step to
@@ -30,3 +31,13 @@ func isRequestStepAligned(req Request) bool {
 
 	return req.GetEnd()%req.GetStep() == 0 && req.GetStart()%req.GetStep() == 0
 }
+
+// isInstantQueryTimeAligned returns whether the evaluation time of the instant query Request
+// is aligned with the given step.
+func isInstantQueryTimeAligned(req Request, step time.Duration) bool {
+	if step <= 0 {
+		return true
+	}
+
+	return req.GetStart()%step.Milliseconds() == 0
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -87,3 +88,9 @@ func TestIsRequestStepAligned(t *testing.T) {
 		})
 	}
 }
+
+func TestIsInstantQueryTimeAligned(t *testing.T) {
+	require.True(t, isInstantQueryTimeAligned(&PrometheusInstantQueryRequest{Time: 60 * 1000}, time.Minute))
+	require.False(t, isInstantQueryTimeAligned(&PrometheusInstantQueryRequest{Time: 90 * 1000}, time.Minute))
+	require.True(t, isInstantQueryTimeAligned(&PrometheusInstantQueryRequest{Time: 90 * 1000}, 0))
+}
@@ -147,6 +147,9 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		writeError(w, err)
 		return
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
 	hs := w.Header()
 	for h, vs := range resp.Header {
@@ -158,8 +161,10 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(resp.StatusCode)
-	// we don't check for copy error as there is no much we can do at this point
-	_, _ = io.Copy(w, resp.Body)
+	// The response body may be encoded while being copied, so the time spent copying it is
+	// included in the response time of the query.
+	_, copyErr := io.Copy(w, resp.Body)
+	queryResponseTime = time.Since(startTime)
 
 	// Check whether we should parse the query string.
 	shouldReportSlowQuery := f.cfg.LogQueriesLongerThan > 0 && queryResponseTime > f.cfg.LogQueriesLongerThan
@@ -173,6 +178,13 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if f.cfg.QueryStatsEnabled {
 		f.reportQueryStats(r, queryString, queryResponseTime, stats)
 	}
+
+	if copyErr != nil {
+		// The status code has already been sent, so the response is aborted to make sure
+		// the client doesn't take the truncated response for a complete one.
+		level.Warn(util_log.WithContext(r.Context(), f.log)).Log("msg", "failed to write query response", "err", copyErr)
+		panic(http.ErrAbortHandler)
+	}
 }
 
 // reportSlowQuery reports slow queries.
@@ -219,6 +231,7 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 		"fetched_chunk_bytes", numBytes,
 		"fetched_chunks_count", numChunks,
 		"sharded_queries", stats.LoadShardedQueries(),
+		"estimated_query_cost", stats.LoadEstimatedQueryCost(),
 	}, formatQueryString(queryString)...)
 
 	level.Info(util_log.WithContext(r.Context(), f.log)).Log(logMessage...)
@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
@@ -97,3 +98,23 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_ServeHTTP_ShouldAbortResponseOnBodyReadError(t *testing.T) {
+	roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(io.MultiReader(strings.NewReader(`{"status":"success"`), iotest.ErrReader(errors.New("encoding failed")))),
+		}, nil
+	})
+
+	handler := NewHandler(HandlerConfig{}, roundTripper, log.NewNopLogger(), nil)
+
+	ctx := user.InjectOrgID(context.Background(), "12345")
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(ctx)
+	resp := httptest.NewRecorder()
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(resp, req)
+	})
+}
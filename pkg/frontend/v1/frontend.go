@@ -37,19 +37,24 @@ var (
 
 // Config for a Frontend.
 type Config struct {
-	MaxOutstandingPerTenant int           `yaml:"max_outstanding_per_tenant" category:"advanced"`
-	QuerierForgetDelay      time.Duration `yaml:"querier_forget_delay" category:"experimental"`
+	MaxOutstandingPerTenant     int           `yaml:"max_outstanding_per_tenant" category:"advanced"`
+	QuerierForgetDelay          time.Duration `yaml:"querier_forget_delay" category:"experimental"`
+	PriorityStarvationThreshold time.Duration `yaml:"priority_starvation_threshold" category:"experimental"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "querier.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per frontend; requests beyond this error with HTTP 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-frontend.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-frontend will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.DurationVar(&cfg.PriorityStarvationThreshold, "query-frontend.priority-starvation-threshold", 5*time.Second, "Lower priority queries waiting in the tenant's queue for longer than this threshold are dispatched before higher priority queries, so that they can't be starved. 0 to always dispatch higher priority queries first.")
 }
 
 type Limits interface {
 	// Returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// QueryPriorityRules returns the rules assigning a priority to the tenant's queries in the queue.
+	QueryPriorityRules(user string) []validation.QueryPriorityRule
 }
 
 // Frontend queues HTTP requests, dispatches them to backends, and handles retries
@@ -72,13 +77,14 @@ type Frontend struct {
 	queueLength       *prometheus.GaugeVec
 	discardedRequests *prometheus.CounterVec
 	numClients        prometheus.GaugeFunc
-	queueDuration     prometheus.Histogram
+	queueDuration     *prometheus.HistogramVec
 }
 
 type request struct {
 	enqueueTime time.Time
 	queueSpan   opentracing.Span
 	originalCtx context.Context
+	priority    queue.Priority
 
 	request  *httpgrpc.HTTPRequest
 	err      chan error
@@ -94,19 +100,19 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 		queueLength: promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "cortex_query_frontend_queue_length",
 			Help: "Number of queries in the queue.",
-		}, []string{"user"}),
+		}, []string{"user", "priority"}),
 		discardedRequests: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_query_frontend_discarded_requests_total",
 			Help: "Total number of query requests discarded.",
 		}, []string{"user"}),
-		queueDuration: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+		queueDuration: promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "cortex_query_frontend_queue_duration_seconds",
 			Help:    "Time spend by requests queued.",
 			Buckets: prometheus.DefBuckets,
-		}),
+		}, []string{"priority"}),
 	}
 
-	f.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, f.queueLength, f.discardedRequests)
+	f.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, cfg.PriorityStarvationThreshold, f.queueLength, f.discardedRequests)
 	f.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(f.cleanupInactiveUserMetrics)
 
 	var err error
@@ -151,7 +157,9 @@ func (f *Frontend) stopping(_ error) error {
 }
 
 func (f *Frontend) cleanupInactiveUserMetrics(user string) {
-	f.queueLength.DeleteLabelValues(user)
+	if err := util.DeleteMatchingLabels(f.queueLength, map[string]string{"user": user}); err != nil {
+		level.Warn(f.log).Log("msg", "failed to remove cortex_query_frontend_queue_length metric for user", "user", user, "err", err)
+	}
 	f.discardedRequests.DeleteLabelValues(user)
 }
 
@@ -215,7 +223,7 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 
 		req := reqWrapper.(*request)
 
-		f.queueDuration.Observe(time.Since(req.enqueueTime).Seconds())
+		f.queueDuration.WithLabelValues(req.priority.String()).Observe(time.Since(req.enqueueTime).Seconds())
 		req.queueSpan.Finish()
 
 		/*
@@ -326,10 +334,16 @@ func (f *Frontend) queueRequest(ctx context.Context, req *request) error {
 	// aggregate the max queriers limit in the case of a multi tenant query
 	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, f.limits.MaxQueriersPerUser)
 
+	var priorityRules []validation.QueryPriorityRule
+	for _, tenantID := range tenantIDs {
+		priorityRules = append(priorityRules, f.limits.QueryPriorityRules(tenantID)...)
+	}
+	req.priority = queue.RequestPriority(req.request, priorityRules)
+
 	joinedTenantID := tenant.JoinTenantIDs(tenantIDs)
 	f.activeUsers.UpdateUserTimestamp(joinedTenantID, now)
 
-	err = f.requestQueue.EnqueueRequest(joinedTenantID, req, maxQueriers, nil)
+	err = f.requestQueue.EnqueueRequest(joinedTenantID, req, req.priority, maxQueriers, nil)
 	if err == queue.ErrTooManyRequests {
 		return errTooManyRequest
 	}
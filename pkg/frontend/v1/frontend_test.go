@@ -38,6 +38,7 @@ import (
 	"github.com/grafana/mimir/pkg/frontend/v1/frontendv1pb"
 	querier_worker "github.com/grafana/mimir/pkg/querier/worker"
 	"github.com/grafana/mimir/pkg/scheduler/queue"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const (
@@ -131,8 +132,8 @@ func TestFrontendCheckReady(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			f := &Frontend{
 				log: log.NewNopLogger(),
-				requestQueue: queue.NewRequestQueue(5, 0,
-					prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+				requestQueue: queue.NewRequestQueue(5, 0, 0,
+					prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 					prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 				),
 			}
@@ -209,7 +210,7 @@ func TestFrontendMetricsCleanup(t *testing.T) {
 		require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
 				# HELP cortex_query_frontend_queue_length Number of queries in the queue.
 				# TYPE cortex_query_frontend_queue_length gauge
-				cortex_query_frontend_queue_length{user="1"} 0
+				cortex_query_frontend_queue_length{priority="normal",user="1"} 0
 			`), "cortex_query_frontend_queue_length"))
 
 		fr.cleanupInactiveUserMetrics("1")
@@ -298,3 +299,7 @@ type limits struct {
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
+
+func (l limits) QueryPriorityRules(_ string) []validation.QueryPriorityRule {
+	return nil
+}
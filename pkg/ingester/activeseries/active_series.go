@@ -25,6 +25,10 @@ type ActiveSeries struct {
 	matchers           *Matchers
 	lastMatchersUpdate time.Time
 
+	// Cost attribution of the series, identified by the values of the attribution labels.
+	attributionLabels []string
+	attribute         func(labels.Labels) string
+
 	// The duration after which series become inactive.
 	// Also used to determine if enough time has passed since configuration reload for valid results.
 	timeout time.Duration
@@ -32,7 +36,8 @@ type ActiveSeries struct {
 
 // seriesStripe holds a subset of the series timestamps for a single tenant.
 type seriesStripe struct {
-	matchers *Matchers
+	matchers  *Matchers
+	attribute func(labels.Labels) string
 
 	// Unix nanoseconds. Only used by purge. Zero = unknown.
 	// Updated in purge and when old timestamp is used when updating series (in this case, oldestEntryTs is updated
@@ -43,6 +48,8 @@ type seriesStripe struct {
 	refs           map[uint64][]seriesEntry
 	active         int   // Number of active entries in this stripe. Only decreased during purge or clear.
 	activeMatching []int // Number of active entries in this stripe matching each matcher of the configured Matchers.
+	// Number of active entries in this stripe by cost attribution, nil if cost attribution is disabled.
+	activeAttributed map[string]int
 }
 
 // seriesEntry holds a timestamp for single series.
@@ -50,6 +57,8 @@ type seriesEntry struct {
 	lbs     labels.Labels
 	nanos   *atomic.Int64 // Unix timestamp in nanoseconds. Needs to be a pointer because we don't store pointers to entries in the stripe.
 	matches []bool        // Which matchers of Matchers does this series match
+	// The cost attribution of the series.
+	attribution string
 }
 
 func NewActiveSeries(asm *Matchers, timeout time.Duration) *ActiveSeries {
@@ -57,7 +66,7 @@ func NewActiveSeries(asm *Matchers, timeout time.Duration) *ActiveSeries {
 
 	// Stripes are pre-allocated so that we only read on them and no lock is required.
 	for i := 0; i < numStripes; i++ {
-		c.stripes[i].reinitialize(asm)
+		c.stripes[i].reinitialize(asm, nil)
 	}
 
 	return c
@@ -74,12 +83,32 @@ func (c *ActiveSeries) ReloadMatchers(asm *Matchers, now time.Time) {
 	defer c.mu.Unlock()
 
 	for i := 0; i < numStripes; i++ {
-		c.stripes[i].reinitialize(asm)
+		c.stripes[i].reinitialize(asm, c.attribute)
 	}
 	c.matchers = asm
 	c.lastMatchersUpdate = now
 }
 
+// ReloadCostAttribution replaces the cost attribution labels and the function returning the cost
+// attribution of a series. Like ReloadMatchers, it resets the tracked series.
+func (c *ActiveSeries) ReloadCostAttribution(attributionLabels []string, attribute func(labels.Labels) string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < numStripes; i++ {
+		c.stripes[i].reinitialize(c.matchers, attribute)
+	}
+	c.attributionLabels = attributionLabels
+	c.attribute = attribute
+	c.lastMatchersUpdate = now
+}
+
+func (c *ActiveSeries) CurrentCostAttributionLabels() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.attributionLabels
+}
+
 func (c *ActiveSeries) CurrentConfig() CustomTrackersConfig {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -124,6 +153,31 @@ func (c *ActiveSeries) Active(now time.Time) (int, []int, bool) {
 	return total, totalMatching, true
 }
 
+// ActiveByAttribution returns the number of active series by cost attribution, as of the last call to Active.
+func (c *ActiveSeries) ActiveByAttribution() map[string]int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.attribute == nil {
+		return nil
+	}
+
+	total := map[string]int{}
+	for s := 0; s < numStripes; s++ {
+		c.stripes[s].updateAttributed(total)
+	}
+	return total
+}
+
+func (s *seriesStripe) updateAttributed(attributed map[string]int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for attribution, active := range s.activeAttributed {
+		attributed[attribution] += active
+	}
+}
+
 // getTotalAndUpdateMatching will return the total active series in the stripe and also update the slice provided
 // with each matcher's total.
 func (s *seriesStripe) getTotalAndUpdateMatching(matching []int) int {
@@ -204,6 +258,10 @@ func (s *seriesStripe) findOrCreateEntryForSeries(fingerprint uint64, series lab
 		nanos:   atomic.NewInt64(nowNanos),
 		matches: matches,
 	}
+	if s.attribute != nil {
+		e.attribution = s.attribute(series)
+		s.activeAttributed[e.attribution]++
+	}
 
 	s.refs[fingerprint] = append(s.refs[fingerprint], e)
 
@@ -221,10 +279,11 @@ func (s *seriesStripe) clear() {
 	for i := range s.activeMatching {
 		s.activeMatching[i] = 0
 	}
+	s.activeAttributed = resetAttributed(s.attribute)
 }
 
-// Reinitialize assigns new matchers and corresponding size activeMatching slices.
-func (s *seriesStripe) reinitialize(asm *Matchers) {
+// Reinitialize assigns new matchers and corresponding size activeMatching slices, and the cost attribution function.
+func (s *seriesStripe) reinitialize(asm *Matchers, attribute func(labels.Labels) string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -233,6 +292,8 @@ func (s *seriesStripe) reinitialize(asm *Matchers) {
 	s.active = 0
 	s.matchers = asm
 	s.activeMatching = resizeAndClear(len(asm.MatcherNames()), s.activeMatching)
+	s.attribute = attribute
+	s.activeAttributed = resetAttributed(attribute)
 }
 
 func (s *seriesStripe) purge(keepUntil time.Time) {
@@ -247,6 +308,7 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 
 	s.active = 0
 	s.activeMatching = resizeAndClear(len(s.activeMatching), s.activeMatching)
+	s.activeAttributed = resetAttributed(s.attribute)
 
 	oldest := int64(math.MaxInt64)
 	for fp, entries := range s.refs {
@@ -265,6 +327,9 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 					s.activeMatching[i]++
 				}
 			}
+			if s.activeAttributed != nil {
+				s.activeAttributed[entries[0].attribution]++
+			}
 			if ts < oldest {
 				oldest = ts
 			}
@@ -297,6 +362,9 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 						s.activeMatching[i]++
 					}
 				}
+				if s.activeAttributed != nil {
+					s.activeAttributed[entries[i].attribution]++
+				}
 			}
 
 			s.refs[fp] = entries
@@ -310,6 +378,13 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 	}
 }
 
+func resetAttributed(attribute func(labels.Labels) string) map[string]int {
+	if attribute == nil {
+		return nil
+	}
+	return map[string]int{}
+}
+
 func resizeAndClear(l int, prev []int) []int {
 	if cap(prev) < l {
 		if l == 0 {
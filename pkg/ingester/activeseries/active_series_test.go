@@ -484,3 +484,38 @@ func benchmarkPurge(b *testing.B, twice bool) {
 		}
 	}
 }
+
+func TestActiveSeries_ActiveByAttribution(t *testing.T) {
+	ls1 := []labels.Label{{Name: "a", Value: "1"}, {Name: "team", Value: "x"}}
+	ls2 := []labels.Label{{Name: "a", Value: "2"}, {Name: "team", Value: "x"}}
+	ls3 := []labels.Label{{Name: "a", Value: "3"}, {Name: "team", Value: "y"}}
+
+	c := NewActiveSeries(&Matchers{}, DefaultTimeout)
+	assert.Nil(t, c.ActiveByAttribution())
+
+	c.ReloadCostAttribution([]string{"team"}, func(l labels.Labels) string { return l.Get("team") }, time.Time{})
+	assert.Equal(t, []string{"team"}, c.CurrentCostAttributionLabels())
+
+	now := time.Now()
+	c.UpdateSeries(ls1, now, copyFn)
+	c.UpdateSeries(ls2, now, copyFn)
+	c.UpdateSeries(ls3, now.Add(-DefaultTimeout), copyFn)
+
+	allActive, _, valid := c.Active(now.Add(-DefaultTimeout))
+	assert.Equal(t, 3, allActive)
+	assert.True(t, valid)
+	assert.Equal(t, map[string]int{"x": 2, "y": 1}, c.ActiveByAttribution())
+
+	// The series of the attribution "y" become inactive.
+	allActive, _, valid = c.Active(now.Add(time.Second))
+	assert.Equal(t, 2, allActive)
+	assert.True(t, valid)
+	assert.Equal(t, map[string]int{"x": 2}, c.ActiveByAttribution())
+
+	// Reloading the cost attribution resets the tracked series.
+	c.ReloadCostAttribution(nil, nil, now)
+	allActive, _, valid = c.Active(now)
+	assert.Equal(t, 0, allActive)
+	assert.False(t, valid)
+	assert.Nil(t, c.ActiveByAttribution())
+}
@@ -218,6 +218,24 @@ func FromLabelMatchers(matchers []*LabelMatcher) ([]*labels.Matcher, error) {
 	return result, nil
 }
 
+// ShardByUser returns the token of the tenant in the ingesters ring.
+func ShardByUser(userID string) uint32 {
+	h := HashNew32()
+	h = HashAdd32(h, userID)
+	return h
+}
+
+// ShardByAllLabelAdapters returns the token of the series in the ingesters ring, which is used
+// to shard series across ingesters. It generates different values for different order of same labels.
+func ShardByAllLabelAdapters(userID string, labels []mimirpb.LabelAdapter) uint32 {
+	h := ShardByUser(userID)
+	for _, label := range labels {
+		h = HashAdd32(h, label.Name)
+		h = HashAdd32(h, label.Value)
+	}
+	return h
+}
+
 // FastFingerprint runs the same algorithm as Prometheus labelSetToFastFingerprint()
 func FastFingerprint(ls []mimirpb.LabelAdapter) model.Fingerprint {
 	if len(ls) == 0 {
@@ -1488,6 +1488,41 @@ func (m *MetricsMetadataResponse) GetMetadata() []*mimirpb.MetricMetadata {
 	return nil
 }
 
+type TransferTSDBHeadResponse struct {
+}
+
+func (m *TransferTSDBHeadResponse) Reset()      { *m = TransferTSDBHeadResponse{} }
+func (*TransferTSDBHeadResponse) ProtoMessage() {}
+func (*TransferTSDBHeadResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_60f6df4f3586b478, []int{28}
+}
+func (m *TransferTSDBHeadResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TransferTSDBHeadResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TransferTSDBHeadResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TransferTSDBHeadResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransferTSDBHeadResponse.Merge(m, src)
+}
+func (m *TransferTSDBHeadResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *TransferTSDBHeadResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransferTSDBHeadResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransferTSDBHeadResponse proto.InternalMessageInfo
+
 type TimeSeriesChunk struct {
 	FromIngesterId string                                              `protobuf:"bytes,1,opt,name=from_ingester_id,json=fromIngesterId,proto3" json:"from_ingester_id,omitempty"`
 	UserId         string                                              `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
@@ -1498,7 +1533,7 @@ type TimeSeriesChunk struct {
 func (m *TimeSeriesChunk) Reset()      { *m = TimeSeriesChunk{} }
 func (*TimeSeriesChunk) ProtoMessage() {}
 func (*TimeSeriesChunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{28}
+	return fileDescriptor_60f6df4f3586b478, []int{29}
 }
 func (m *TimeSeriesChunk) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1558,7 +1593,7 @@ type Chunk struct {
 func (m *Chunk) Reset()      { *m = Chunk{} }
 func (*Chunk) ProtoMessage() {}
 func (*Chunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{29}
+	return fileDescriptor_60f6df4f3586b478, []int{30}
 }
 func (m *Chunk) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1622,7 +1657,7 @@ type LabelMatchers struct {
 func (m *LabelMatchers) Reset()      { *m = LabelMatchers{} }
 func (*LabelMatchers) ProtoMessage() {}
 func (*LabelMatchers) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{30}
+	return fileDescriptor_60f6df4f3586b478, []int{31}
 }
 func (m *LabelMatchers) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1667,7 +1702,7 @@ type LabelMatcher struct {
 func (m *LabelMatcher) Reset()      { *m = LabelMatcher{} }
 func (*LabelMatcher) ProtoMessage() {}
 func (*LabelMatcher) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{31}
+	return fileDescriptor_60f6df4f3586b478, []int{32}
 }
 func (m *LabelMatcher) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1727,7 +1762,7 @@ type TimeSeriesFile struct {
 func (m *TimeSeriesFile) Reset()      { *m = TimeSeriesFile{} }
 func (*TimeSeriesFile) ProtoMessage() {}
 func (*TimeSeriesFile) Descriptor() ([]byte, []int) {
-	return fileDescriptor_60f6df4f3586b478, []int{32}
+	return fileDescriptor_60f6df4f3586b478, []int{33}
 }
 func (m *TimeSeriesFile) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1817,6 +1852,7 @@ func init() {
 	proto.RegisterType((*MetricsForLabelMatchersResponse)(nil), "cortex.MetricsForLabelMatchersResponse")
 	proto.RegisterType((*MetricsMetadataRequest)(nil), "cortex.MetricsMetadataRequest")
 	proto.RegisterType((*MetricsMetadataResponse)(nil), "cortex.MetricsMetadataResponse")
+	proto.RegisterType((*TransferTSDBHeadResponse)(nil), "cortex.TransferTSDBHeadResponse")
 	proto.RegisterType((*TimeSeriesChunk)(nil), "cortex.TimeSeriesChunk")
 	proto.RegisterType((*Chunk)(nil), "cortex.Chunk")
 	proto.RegisterType((*LabelMatchers)(nil), "cortex.LabelMatchers")
@@ -1827,110 +1863,112 @@ func init() {
 func init() { proto.RegisterFile("ingester.proto", fileDescriptor_60f6df4f3586b478) }
 
 var fileDescriptor_60f6df4f3586b478 = []byte{
-	// 1640 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0xcd, 0x6f, 0xdb, 0x46,
-	0x16, 0xd7, 0x48, 0xb2, 0x6c, 0x3d, 0xd9, 0x8a, 0x3c, 0x8a, 0x6d, 0x85, 0x59, 0xd3, 0x5a, 0x2e,
-	0x92, 0xd5, 0xee, 0x26, 0xf2, 0x47, 0xb2, 0x40, 0x12, 0x14, 0x08, 0x64, 0x5b, 0x89, 0x5d, 0x47,
-	0x72, 0x42, 0xd9, 0x8d, 0x51, 0xa0, 0x20, 0x28, 0x69, 0x6c, 0x13, 0x16, 0x29, 0x85, 0xa4, 0x0a,
-	0xfb, 0x56, 0xa0, 0xf7, 0xb6, 0xe8, 0xa9, 0xa7, 0x02, 0xbd, 0xf5, 0x58, 0x14, 0x28, 0x7a, 0xeb,
-	0x39, 0x97, 0x02, 0x39, 0x06, 0x3d, 0x04, 0x8d, 0x73, 0x69, 0x6f, 0xf9, 0x13, 0x0a, 0xce, 0x0c,
-	0x29, 0x92, 0xa2, 0x3f, 0x52, 0x24, 0x39, 0x49, 0xf3, 0xde, 0x6f, 0x7e, 0xf3, 0xbe, 0x38, 0xef,
-	0x91, 0x90, 0xd5, 0x8c, 0x3d, 0x62, 0xd9, 0xc4, 0x2c, 0xf7, 0xcc, 0xae, 0xdd, 0xc5, 0xa9, 0x56,
-	0xd7, 0xb4, 0xc9, 0xa1, 0x70, 0x7d, 0x4f, 0xb3, 0xf7, 0xfb, 0xcd, 0x72, 0xab, 0xab, 0xcf, 0xef,
-	0x75, 0xf7, 0xba, 0xf3, 0x54, 0xdd, 0xec, 0xef, 0xd2, 0x15, 0x5d, 0xd0, 0x7f, 0x6c, 0x9b, 0xb0,
-	0xe0, 0x87, 0x9b, 0xea, 0xae, 0x6a, 0xa8, 0xf3, 0xba, 0xa6, 0x6b, 0xe6, 0x7c, 0xef, 0x60, 0x8f,
-	0xfd, 0xeb, 0x35, 0xd9, 0x2f, 0xdb, 0x21, 0xd5, 0x41, 0x78, 0xa0, 0x36, 0x49, 0xa7, 0xae, 0xea,
-	0xc4, 0xaa, 0x18, 0xed, 0x8f, 0xd4, 0x4e, 0x9f, 0x58, 0x32, 0x79, 0xd2, 0x27, 0x96, 0x8d, 0x17,
-	0x60, 0x4c, 0x57, 0xed, 0xd6, 0x3e, 0x31, 0xad, 0x02, 0x2a, 0x26, 0x4a, 0x99, 0xa5, 0x8b, 0x65,
-	0x66, 0x59, 0x99, 0xee, 0xaa, 0x31, 0xa5, 0xec, 0xa1, 0xa4, 0x35, 0xb8, 0x1c, 0xc9, 0x67, 0xf5,
-	0xba, 0x86, 0x45, 0xf0, 0x7f, 0x60, 0x44, 0xb3, 0x89, 0xee, 0xb2, 0xe5, 0x03, 0x6c, 0x1c, 0xcb,
-	0x10, 0xd2, 0x2a, 0x64, 0x7c, 0x52, 0x3c, 0x0b, 0xd0, 0x71, 0x96, 0x8a, 0xa1, 0xea, 0xa4, 0x80,
-	0x8a, 0xa8, 0x94, 0x96, 0xd3, 0x1d, 0xf7, 0x28, 0x3c, 0x0d, 0xa9, 0x4f, 0x29, 0xb0, 0x10, 0x2f,
-	0x26, 0x4a, 0x69, 0x99, 0xaf, 0x24, 0x13, 0x66, 0x7d, 0x2c, 0x2b, 0xaa, 0xd9, 0xd6, 0x0c, 0xb5,
-	0xa3, 0xd9, 0x47, 0xae, 0x8b, 0x73, 0x90, 0x19, 0xf0, 0x32, 0xbb, 0xd2, 0x32, 0x78, 0xc4, 0x56,
-	0x20, 0x06, 0xf1, 0x73, 0xc5, 0x60, 0x1b, 0xc4, 0x93, 0xce, 0xe4, 0x61, 0xb8, 0x11, 0x0c, 0xc3,
-	0xec, 0x70, 0x18, 0x1a, 0xc4, 0xd4, 0x88, 0xb5, 0xd2, 0xed, 0x1b, 0xb6, 0x1b, 0x90, 0x17, 0x08,
-	0xa6, 0x22, 0x01, 0x67, 0xc5, 0x46, 0x05, 0xcc, 0xd4, 0x34, 0x26, 0x8a, 0x45, 0x77, 0x72, 0x5f,
-	0x6e, 0x9c, 0x7a, 0xf4, 0x90, 0xb4, 0x6a, 0xd8, 0xe6, 0x91, 0x9c, 0xeb, 0x84, 0xc4, 0xc2, 0xca,
-	0xb0, 0x69, 0x14, 0x8a, 0x73, 0x90, 0x38, 0x20, 0x47, 0xdc, 0x26, 0xe7, 0x2f, 0xbe, 0x08, 0x23,
-	0xd4, 0x8e, 0x42, 0xbc, 0x88, 0x4a, 0x49, 0x99, 0x2d, 0xee, 0xc4, 0x6f, 0x21, 0xe9, 0x57, 0x04,
-	0x19, 0x99, 0xa8, 0x6d, 0x37, 0x35, 0x65, 0x18, 0x7d, 0xd2, 0x67, 0xc6, 0x86, 0x8a, 0xef, 0x51,
-	0x9f, 0x98, 0x6e, 0x06, 0x65, 0x17, 0x84, 0x77, 0x60, 0x46, 0x6d, 0xb5, 0x48, 0xcf, 0x26, 0x6d,
-	0xc5, 0xe4, 0xa1, 0x56, 0xec, 0xa3, 0x1e, 0x77, 0x36, 0xbb, 0x54, 0x74, 0xf7, 0xfb, 0x4e, 0x29,
-	0xbb, 0x49, 0xd9, 0x3a, 0xea, 0x11, 0x79, 0xca, 0x25, 0xf0, 0x4b, 0x2d, 0xe9, 0x26, 0x8c, 0xfb,
-	0x05, 0x38, 0x03, 0xa3, 0x8d, 0x4a, 0xed, 0xe1, 0x83, 0x6a, 0x23, 0x17, 0xc3, 0x33, 0x90, 0x6f,
-	0x6c, 0xc9, 0xd5, 0x4a, 0xad, 0xba, 0xaa, 0xec, 0x6c, 0xca, 0xca, 0xca, 0xda, 0x76, 0x7d, 0xa3,
-	0x91, 0x43, 0xd2, 0x5d, 0x67, 0x97, 0xea, 0x51, 0xe1, 0x79, 0x18, 0x35, 0x89, 0xd5, 0xef, 0xd8,
-	0xae, 0x3f, 0x53, 0x21, 0x7f, 0x18, 0x4e, 0x76, 0x51, 0xd2, 0x11, 0xe0, 0x86, 0x6d, 0x12, 0x55,
-	0x0f, 0xd0, 0x2c, 0x43, 0xb6, 0xb5, 0xdf, 0x37, 0x0e, 0x48, 0xdb, 0x4d, 0x25, 0x63, 0xbb, 0xec,
-	0xb2, 0xb1, 0x3d, 0x2b, 0x0c, 0xc3, 0x92, 0x21, 0x4f, 0xb4, 0xfc, 0x4b, 0xa7, 0xea, 0x9d, 0xa8,
-	0x1d, 0x29, 0x9a, 0xd1, 0x26, 0x87, 0x34, 0x15, 0x09, 0x19, 0xa8, 0x68, 0xdd, 0x91, 0x48, 0x3f,
-	0x20, 0xc8, 0x47, 0xf0, 0xe0, 0x5d, 0x48, 0xd1, 0xe4, 0x87, 0x9f, 0xe0, 0x5e, 0x93, 0xd5, 0xca,
-	0x43, 0x55, 0x33, 0x97, 0x6f, 0x3f, 0x7d, 0x31, 0x17, 0xfb, 0xed, 0xc5, 0xdc, 0xe2, 0x79, 0xae,
-	0x23, 0xb6, 0xaf, 0xd2, 0x56, 0x7b, 0x36, 0x31, 0x65, 0xce, 0x8e, 0x17, 0x21, 0x45, 0x2d, 0x76,
-	0xeb, 0x34, 0x1f, 0xe1, 0xdc, 0x72, 0xd2, 0x39, 0x47, 0xe6, 0x40, 0xe9, 0x27, 0x04, 0x19, 0x9f,
-	0x16, 0x8b, 0x90, 0xd1, 0x35, 0x43, 0xb1, 0x35, 0x9d, 0x28, 0xf4, 0x51, 0x73, 0x7c, 0x4c, 0xeb,
-	0x9a, 0xb1, 0xa5, 0xe9, 0xa4, 0x66, 0x51, 0xbd, 0x7a, 0xe8, 0xe9, 0xe3, 0x5c, 0xaf, 0x1e, 0x72,
-	0xfd, 0x02, 0x24, 0x9d, 0xe2, 0x29, 0x24, 0x8a, 0xa8, 0x94, 0x5d, 0xfa, 0x47, 0x84, 0x01, 0xe5,
-	0xaa, 0xd1, 0xea, 0xb6, 0x35, 0x63, 0x4f, 0xa6, 0x48, 0x8c, 0x21, 0xd9, 0x56, 0x6d, 0xb5, 0x90,
-	0x2c, 0xa2, 0xd2, 0xb8, 0x4c, 0xff, 0x4b, 0x45, 0x18, 0x73, 0x51, 0x4e, 0xd9, 0x6c, 0xd7, 0x37,
-	0xea, 0x9b, 0x8f, 0xeb, 0xb9, 0x18, 0x1e, 0x85, 0xc4, 0xce, 0xa6, 0x9c, 0x43, 0xd2, 0x37, 0x08,
-	0xc6, 0xfd, 0x05, 0x8d, 0xaf, 0x01, 0xb6, 0x6c, 0xd5, 0xb4, 0xa9, 0x69, 0x96, 0xad, 0xea, 0xbd,
-	0x81, 0xfd, 0x39, 0xaa, 0xd9, 0x72, 0x15, 0x35, 0x0b, 0x97, 0x20, 0x47, 0x8c, 0x76, 0x10, 0xcb,
-	0x7c, 0xc9, 0x12, 0xa3, 0xed, 0x47, 0xfa, 0x6f, 0xb2, 0xc4, 0xb9, 0x6e, 0xb2, 0xef, 0x10, 0x5c,
-	0xac, 0x1e, 0x12, 0xbd, 0xd7, 0x51, 0xcd, 0xf7, 0x62, 0xe2, 0xe2, 0x90, 0x89, 0x53, 0x51, 0x26,
-	0x5a, 0x3e, 0x1b, 0x37, 0x60, 0x22, 0xf0, 0xf8, 0xe0, 0x3b, 0x00, 0xf4, 0xa4, 0xa8, 0x9b, 0xa3,
-	0xd7, 0x2c, 0x3b, 0xc7, 0xb1, 0x62, 0xe6, 0xf5, 0xe3, 0x43, 0x4b, 0x5f, 0x23, 0xc8, 0x53, 0x36,
-	0xf7, 0xb9, 0xe3, 0x9c, 0x77, 0x21, 0xc3, 0xaa, 0xcc, 0x4f, 0x3a, 0xe3, 0x9a, 0x36, 0xa0, 0xf4,
-	0xd7, 0xa5, 0x7f, 0x47, 0xc8, 0xa8, 0xf8, 0x1b, 0x19, 0xd5, 0x80, 0xa9, 0x50, 0x12, 0xde, 0x82,
-	0xa7, 0xbf, 0x20, 0xc0, 0xfe, 0xae, 0xcb, 0x13, 0x7b, 0x46, 0x2b, 0x89, 0xce, 0x7b, 0xfc, 0x0d,
-	0xf2, 0x9e, 0x38, 0x33, 0xef, 0xce, 0xd3, 0x73, 0x8e, 0xbc, 0xdf, 0x82, 0x7c, 0xc0, 0x7e, 0x1e,
-	0x93, 0x7f, 0xc2, 0xb8, 0xaf, 0xd9, 0xb9, 0x0d, 0x3d, 0x33, 0xe8, 0x58, 0x96, 0xf4, 0x2d, 0x82,
-	0xc9, 0xc1, 0x90, 0xf2, 0x7e, 0x4b, 0xfa, 0x5c, 0xae, 0xfd, 0x9f, 0xa7, 0x86, 0xdb, 0xc7, 0x3d,
-	0x3b, 0x6b, 0x52, 0x91, 0x30, 0xe4, 0xb6, 0x2d, 0x62, 0x36, 0x6c, 0xd5, 0x76, 0xbd, 0x92, 0x7e,
-	0x46, 0x30, 0xe9, 0x13, 0x72, 0xaa, 0x2b, 0xee, 0xc0, 0xa9, 0x75, 0x0d, 0xc5, 0x54, 0x6d, 0x96,
-	0x69, 0x24, 0x4f, 0x78, 0x52, 0x59, 0xb5, 0x89, 0x53, 0x0c, 0x46, 0x5f, 0x1f, 0x0c, 0x0c, 0x4e,
-	0xbf, 0x4e, 0x1b, 0x7d, 0x9d, 0xf7, 0x82, 0x6b, 0x80, 0xd5, 0x9e, 0xa6, 0x84, 0x98, 0x12, 0x94,
-	0x29, 0xa7, 0xf6, 0xb4, 0xf5, 0x00, 0x59, 0x19, 0xf2, 0x66, 0xbf, 0x43, 0xc2, 0xf0, 0x24, 0x85,
-	0x4f, 0x3a, 0xaa, 0x00, 0x5e, 0xfa, 0x04, 0xf2, 0x8e, 0xe1, 0xeb, 0xab, 0x41, 0xd3, 0x67, 0x60,
-	0xb4, 0x6f, 0x11, 0x53, 0xd1, 0xda, 0xbc, 0x3a, 0x53, 0xce, 0x72, 0xbd, 0x8d, 0xaf, 0xf3, 0xcb,
-	0x37, 0x4e, 0x63, 0x7c, 0xc9, 0x8d, 0xf1, 0x90, 0xf3, 0xfc, 0x5e, 0xbe, 0x0f, 0xd8, 0x51, 0x59,
-	0x41, 0xf6, 0x45, 0x18, 0xb1, 0x1c, 0x41, 0xb8, 0xa5, 0x46, 0x58, 0x22, 0x33, 0xa4, 0xf4, 0x23,
-	0x02, 0xb1, 0x46, 0x6c, 0x53, 0x6b, 0x59, 0xf7, 0xba, 0x66, 0x30, 0xa5, 0xef, 0xb8, 0xb4, 0x6e,
-	0xc1, 0xb8, 0x5b, 0x33, 0x8a, 0x45, 0xec, 0xd3, 0x6f, 0xcc, 0x8c, 0x0b, 0x6d, 0x10, 0x5b, 0xda,
-	0x80, 0xb9, 0x13, 0x6d, 0xe6, 0xa1, 0x28, 0x41, 0x4a, 0xa7, 0x10, 0x1e, 0x8b, 0xdc, 0xe0, 0x62,
-	0x61, 0x5b, 0x65, 0xae, 0x97, 0x0a, 0x30, 0xcd, 0xc9, 0x6a, 0xc4, 0x56, 0x9d, 0xe8, 0xba, 0xd5,
-	0xb7, 0x09, 0x33, 0x43, 0x1a, 0x4e, 0x7f, 0x13, 0xc6, 0x74, 0x2e, 0xe3, 0x07, 0x14, 0xc2, 0x07,
-	0x78, 0x7b, 0x3c, 0xa4, 0xf4, 0x27, 0x82, 0x0b, 0xa1, 0xdb, 0xd6, 0x89, 0xd7, 0xae, 0xd9, 0xd5,
-	0x15, 0xf7, 0x15, 0x6a, 0x50, 0x1a, 0x59, 0x47, 0xbe, 0xce, 0xc5, 0xeb, 0x6d, 0x7f, 0xed, 0xc4,
-	0x03, 0xb5, 0x33, 0x98, 0x6a, 0x12, 0xef, 0x74, 0xaa, 0xf9, 0x9f, 0x37, 0xd5, 0x24, 0xe9, 0x39,
-	0x13, 0x6e, 0xaa, 0xa2, 0xe6, 0x99, 0x2f, 0x11, 0x8c, 0x30, 0x0f, 0xdf, 0x55, 0xfd, 0x08, 0x30,
-	0x46, 0xf8, 0x6c, 0x42, 0x1f, 0xdb, 0x11, 0xd9, 0x5b, 0x47, 0xce, 0x32, 0x15, 0x98, 0x08, 0xd4,
-	0xca, 0xdf, 0x78, 0x3f, 0x54, 0x60, 0xdc, 0xaf, 0xc1, 0x57, 0xf8, 0x90, 0x85, 0xe8, 0x90, 0x35,
-	0xe9, 0xee, 0xa6, 0x6a, 0x3a, 0x91, 0x7b, 0x93, 0x15, 0x6d, 0x48, 0x2c, 0x6d, 0xf4, 0xff, 0xe0,
-	0x45, 0x22, 0x41, 0x85, 0x6c, 0x21, 0x7d, 0x8e, 0x20, 0x3b, 0xa8, 0x90, 0x7b, 0x5a, 0x87, 0xbc,
-	0x8d, 0x02, 0x11, 0x60, 0x6c, 0x57, 0xeb, 0x10, 0x6a, 0x03, 0x3b, 0xce, 0x5b, 0x47, 0x45, 0xea,
-	0xbf, 0x1f, 0x42, 0xda, 0x73, 0x01, 0xa7, 0x61, 0xa4, 0xfa, 0x68, 0xbb, 0xf2, 0x20, 0x17, 0xc3,
-	0x13, 0x90, 0xae, 0x6f, 0x6e, 0x29, 0x6c, 0x89, 0xf0, 0x05, 0xc8, 0xc8, 0xd5, 0xfb, 0xd5, 0x1d,
-	0xa5, 0x56, 0xd9, 0x5a, 0x59, 0xcb, 0xc5, 0x31, 0x86, 0x2c, 0x13, 0xd4, 0x37, 0xb9, 0x2c, 0xb1,
-	0xf4, 0xc5, 0x28, 0x8c, 0xb9, 0x36, 0xe2, 0xdb, 0x90, 0x7c, 0xd8, 0xb7, 0xf6, 0xf1, 0xf4, 0xa0,
-	0x42, 0x1f, 0x9b, 0x9a, 0x4d, 0xf8, 0x13, 0x27, 0xcc, 0x0c, 0xc9, 0xd9, 0xf3, 0x26, 0xc5, 0xf0,
-	0x2a, 0x64, 0x7c, 0xa3, 0x0d, 0x8e, 0x7c, 0x99, 0x12, 0x2e, 0x07, 0xa4, 0xc1, 0x29, 0x48, 0x8a,
-	0x2d, 0x20, 0xbc, 0x09, 0x59, 0xaa, 0x72, 0x27, 0x12, 0x0b, 0x7b, 0x93, 0x71, 0xd4, 0xa4, 0x28,
-	0xcc, 0x9e, 0xa0, 0xf5, 0xcc, 0x5a, 0x0b, 0xbe, 0xe7, 0x0b, 0x51, 0x9f, 0x04, 0xc2, 0xc6, 0x45,
-	0x34, 0x7e, 0x29, 0x86, 0xab, 0x00, 0x83, 0xb6, 0x89, 0x2f, 0x05, 0xc0, 0xfe, 0x56, 0x2f, 0x08,
-	0x51, 0x2a, 0x8f, 0x66, 0x19, 0xd2, 0x5e, 0xd3, 0xc0, 0x85, 0x88, 0x3e, 0xc2, 0x48, 0x4e, 0xee,
-	0x30, 0x52, 0x0c, 0xdf, 0x83, 0xf1, 0x4a, 0xa7, 0x73, 0x1e, 0x1a, 0xc1, 0xaf, 0xb1, 0xc2, 0x3c,
-	0x1d, 0xef, 0x02, 0x0d, 0xdf, 0xd3, 0xf8, 0xaa, 0xf7, 0xac, 0x9c, 0xda, 0x7c, 0x84, 0x7f, 0x9f,
-	0x89, 0xf3, 0x4e, 0xdb, 0x82, 0x0b, 0xa1, 0xeb, 0x1a, 0x8b, 0xa1, 0xdd, 0xa1, 0x1b, 0x5e, 0x98,
-	0x3b, 0x51, 0xef, 0xb1, 0x36, 0xf9, 0xa0, 0x16, 0xfc, 0x24, 0x84, 0xa5, 0xe1, 0x24, 0x84, 0xbf,
-	0x3f, 0x09, 0xff, 0x3a, 0x15, 0xe3, 0xab, 0xca, 0x03, 0x98, 0x8e, 0xfe, 0xe4, 0x82, 0xaf, 0x44,
-	0xd4, 0xcc, 0xf0, 0x67, 0x20, 0xe1, 0xea, 0x59, 0xb0, 0xc1, 0x61, 0xcb, 0x1f, 0x3c, 0x7b, 0x29,
-	0xc6, 0x9e, 0xbf, 0x14, 0x63, 0xaf, 0x5f, 0x8a, 0xe8, 0xb3, 0x63, 0x11, 0x7d, 0x7f, 0x2c, 0xa2,
-	0xa7, 0xc7, 0x22, 0x7a, 0x76, 0x2c, 0xa2, 0xdf, 0x8f, 0x45, 0xf4, 0xc7, 0xb1, 0x18, 0x7b, 0x7d,
-	0x2c, 0xa2, 0xaf, 0x5e, 0x89, 0xb1, 0x67, 0xaf, 0xc4, 0xd8, 0xf3, 0x57, 0x62, 0xec, 0xe3, 0x54,
-	0xab, 0xa3, 0x11, 0xc3, 0x6e, 0xa6, 0xe8, 0x87, 0xb7, 0x1b, 0x7f, 0x05, 0x00, 0x00, 0xff, 0xff,
-	0x2f, 0xe4, 0x86, 0xaf, 0xf3, 0x13, 0x00, 0x00,
+	// 1668 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0xcf, 0x6f, 0x1b, 0x4f,
+	0x15, 0xf7, 0xd8, 0x8e, 0x13, 0x3f, 0x3b, 0xae, 0x33, 0x6e, 0x12, 0x77, 0x4b, 0x36, 0x66, 0x51,
+	0x8b, 0x81, 0xd6, 0xf9, 0xd1, 0x22, 0xb5, 0x15, 0x52, 0xe5, 0x24, 0x6e, 0x13, 0x52, 0x3b, 0xed,
+	0xda, 0xa1, 0x11, 0x12, 0x5a, 0xad, 0xed, 0x49, 0xb2, 0x8a, 0x77, 0xed, 0xee, 0xae, 0x51, 0x72,
+	0x43, 0xe2, 0x0f, 0x00, 0x71, 0xe2, 0x84, 0xc4, 0x8d, 0x23, 0x42, 0x42, 0xdc, 0x38, 0xf7, 0x82,
+	0xd4, 0x63, 0xc5, 0xa1, 0x22, 0xe9, 0x05, 0x6e, 0xfd, 0x13, 0xd0, 0xce, 0xcc, 0xae, 0x77, 0xd7,
+	0xeb, 0x24, 0xfd, 0xaa, 0xed, 0xc9, 0x9e, 0xf7, 0xde, 0x7c, 0xde, 0xcf, 0x99, 0xf7, 0x76, 0x20,
+	0xa7, 0x19, 0x47, 0xc4, 0xb2, 0x89, 0x59, 0x19, 0x98, 0x7d, 0xbb, 0x8f, 0x53, 0x9d, 0xbe, 0x69,
+	0x93, 0x53, 0xe1, 0xfe, 0x91, 0x66, 0x1f, 0x0f, 0xdb, 0x95, 0x4e, 0x5f, 0x5f, 0x39, 0xea, 0x1f,
+	0xf5, 0x57, 0x28, 0xbb, 0x3d, 0x3c, 0xa4, 0x2b, 0xba, 0xa0, 0xff, 0xd8, 0x36, 0x61, 0xd5, 0x2f,
+	0x6e, 0xaa, 0x87, 0xaa, 0xa1, 0xae, 0xe8, 0x9a, 0xae, 0x99, 0x2b, 0x83, 0x93, 0x23, 0xf6, 0x6f,
+	0xd0, 0x66, 0xbf, 0x6c, 0x87, 0xd4, 0x00, 0xe1, 0x85, 0xda, 0x26, 0xbd, 0x86, 0xaa, 0x13, 0xab,
+	0x6a, 0x74, 0x7f, 0xa1, 0xf6, 0x86, 0xc4, 0x92, 0xc9, 0x9b, 0x21, 0xb1, 0x6c, 0xbc, 0x0a, 0x33,
+	0xba, 0x6a, 0x77, 0x8e, 0x89, 0x69, 0x15, 0x51, 0x29, 0x51, 0xce, 0xac, 0xdf, 0xac, 0x30, 0xcb,
+	0x2a, 0x74, 0x57, 0x9d, 0x31, 0x65, 0x4f, 0x4a, 0xda, 0x86, 0xdb, 0x91, 0x78, 0xd6, 0xa0, 0x6f,
+	0x58, 0x04, 0xff, 0x08, 0xa6, 0x34, 0x9b, 0xe8, 0x2e, 0x5a, 0x21, 0x80, 0xc6, 0x65, 0x99, 0x84,
+	0xb4, 0x05, 0x19, 0x1f, 0x15, 0x2f, 0x01, 0xf4, 0x9c, 0xa5, 0x62, 0xa8, 0x3a, 0x29, 0xa2, 0x12,
+	0x2a, 0xa7, 0xe5, 0x74, 0xcf, 0x55, 0x85, 0x17, 0x20, 0xf5, 0x6b, 0x2a, 0x58, 0x8c, 0x97, 0x12,
+	0xe5, 0xb4, 0xcc, 0x57, 0x92, 0x09, 0x4b, 0x3e, 0x94, 0x4d, 0xd5, 0xec, 0x6a, 0x86, 0xda, 0xd3,
+	0xec, 0x33, 0xd7, 0xc5, 0x65, 0xc8, 0x8c, 0x70, 0x99, 0x5d, 0x69, 0x19, 0x3c, 0x60, 0x2b, 0x10,
+	0x83, 0xf8, 0xb5, 0x62, 0xb0, 0x0f, 0xe2, 0x24, 0x9d, 0x3c, 0x0c, 0x0f, 0x82, 0x61, 0x58, 0x1a,
+	0x0f, 0x43, 0x93, 0x98, 0x1a, 0xb1, 0x36, 0xfb, 0x43, 0xc3, 0x76, 0x03, 0xf2, 0x01, 0xc1, 0x7c,
+	0xa4, 0xc0, 0x55, 0xb1, 0x51, 0x01, 0x33, 0x36, 0x8d, 0x89, 0x62, 0xd1, 0x9d, 0xdc, 0x97, 0x07,
+	0x97, 0xaa, 0x1e, 0xa3, 0xd6, 0x0c, 0xdb, 0x3c, 0x93, 0xf3, 0xbd, 0x10, 0x59, 0xd8, 0x84, 0xf9,
+	0x48, 0x51, 0x9c, 0x87, 0xc4, 0x09, 0x39, 0xe3, 0x36, 0x39, 0x7f, 0xf1, 0x4d, 0x98, 0xa2, 0x76,
+	0x14, 0xe3, 0x25, 0x54, 0x4e, 0xca, 0x6c, 0xf1, 0x24, 0xfe, 0x08, 0x49, 0xff, 0x42, 0x90, 0x91,
+	0x89, 0xda, 0x75, 0x53, 0x53, 0x81, 0xe9, 0x37, 0x43, 0x66, 0x6c, 0xa8, 0xf8, 0x5e, 0x0d, 0x89,
+	0xe9, 0x66, 0x50, 0x76, 0x85, 0xf0, 0x01, 0x2c, 0xaa, 0x9d, 0x0e, 0x19, 0xd8, 0xa4, 0xab, 0x98,
+	0x3c, 0xd4, 0x8a, 0x7d, 0x36, 0xe0, 0xce, 0xe6, 0xd6, 0x4b, 0xee, 0x7e, 0x9f, 0x96, 0x8a, 0x9b,
+	0x94, 0xd6, 0xd9, 0x80, 0xc8, 0xf3, 0x2e, 0x80, 0x9f, 0x6a, 0x49, 0x0f, 0x21, 0xeb, 0x27, 0xe0,
+	0x0c, 0x4c, 0x37, 0xab, 0xf5, 0x97, 0x2f, 0x6a, 0xcd, 0x7c, 0x0c, 0x2f, 0x42, 0xa1, 0xd9, 0x92,
+	0x6b, 0xd5, 0x7a, 0x6d, 0x4b, 0x39, 0xd8, 0x93, 0x95, 0xcd, 0xed, 0xfd, 0xc6, 0x6e, 0x33, 0x8f,
+	0xa4, 0xa7, 0x90, 0x65, 0x8a, 0x78, 0xd6, 0x57, 0x60, 0xda, 0x24, 0xd6, 0xb0, 0x67, 0xbb, 0xfe,
+	0xcc, 0x87, 0xfc, 0x61, 0x72, 0xb2, 0x2b, 0x25, 0x9d, 0x01, 0x6e, 0xda, 0x26, 0x51, 0xf5, 0x00,
+	0xcc, 0x06, 0xe4, 0x3a, 0xc7, 0x43, 0xe3, 0x84, 0x74, 0xdd, 0x54, 0x32, 0xb4, 0xdb, 0x2e, 0x1a,
+	0xdb, 0xb3, 0xc9, 0x64, 0x58, 0x32, 0xe4, 0xd9, 0x8e, 0x7f, 0xe9, 0x54, 0xbd, 0x13, 0xb5, 0x33,
+	0x45, 0x33, 0xba, 0xe4, 0x94, 0xa6, 0x22, 0x21, 0x03, 0x25, 0xed, 0x38, 0x14, 0xe9, 0xaf, 0x08,
+	0x0a, 0x11, 0x38, 0xf8, 0x10, 0x52, 0x34, 0xf9, 0xe1, 0x13, 0x3c, 0x68, 0xb3, 0x5a, 0x79, 0xa9,
+	0x6a, 0xe6, 0xc6, 0xe3, 0xb7, 0x1f, 0x96, 0x63, 0xff, 0xfe, 0xb0, 0xbc, 0x76, 0x9d, 0xeb, 0x88,
+	0xed, 0xab, 0x76, 0xd5, 0x81, 0x4d, 0x4c, 0x99, 0xa3, 0xe3, 0x35, 0x48, 0x51, 0x8b, 0xdd, 0x3a,
+	0x2d, 0x44, 0x38, 0xb7, 0x91, 0x74, 0xf4, 0xc8, 0x5c, 0x50, 0xfa, 0x3b, 0x82, 0x8c, 0x8f, 0x8b,
+	0x45, 0xc8, 0xe8, 0x9a, 0xa1, 0xd8, 0x9a, 0x4e, 0x14, 0x7a, 0xd4, 0x1c, 0x1f, 0xd3, 0xba, 0x66,
+	0xb4, 0x34, 0x9d, 0xd4, 0x2d, 0xca, 0x57, 0x4f, 0x3d, 0x7e, 0x9c, 0xf3, 0xd5, 0x53, 0xce, 0x5f,
+	0x85, 0xa4, 0x53, 0x3c, 0xc5, 0x44, 0x09, 0x95, 0x73, 0xeb, 0xdf, 0x8b, 0x30, 0xa0, 0x52, 0x33,
+	0x3a, 0xfd, 0xae, 0x66, 0x1c, 0xc9, 0x54, 0x12, 0x63, 0x48, 0x76, 0x55, 0x5b, 0x2d, 0x26, 0x4b,
+	0xa8, 0x9c, 0x95, 0xe9, 0x7f, 0xa9, 0x04, 0x33, 0xae, 0x94, 0x53, 0x36, 0xfb, 0x8d, 0xdd, 0xc6,
+	0xde, 0xeb, 0x46, 0x3e, 0x86, 0xa7, 0x21, 0x71, 0xb0, 0x27, 0xe7, 0x91, 0xf4, 0x47, 0x04, 0x59,
+	0x7f, 0x41, 0xe3, 0x7b, 0x80, 0x2d, 0x5b, 0x35, 0x6d, 0x6a, 0x9a, 0x65, 0xab, 0xfa, 0x60, 0x64,
+	0x7f, 0x9e, 0x72, 0x5a, 0x2e, 0xa3, 0x6e, 0xe1, 0x32, 0xe4, 0x89, 0xd1, 0x0d, 0xca, 0x32, 0x5f,
+	0x72, 0xc4, 0xe8, 0xfa, 0x25, 0xfd, 0x37, 0x59, 0xe2, 0x5a, 0x37, 0xd9, 0x9f, 0x11, 0xdc, 0xac,
+	0x9d, 0x12, 0x7d, 0xd0, 0x53, 0xcd, 0x6f, 0x62, 0xe2, 0xda, 0x98, 0x89, 0xf3, 0x51, 0x26, 0x5a,
+	0x3e, 0x1b, 0x77, 0x61, 0x36, 0x70, 0x7c, 0xf0, 0x13, 0x00, 0xaa, 0x29, 0xea, 0xe6, 0x18, 0xb4,
+	0x2b, 0x8e, 0x3a, 0x56, 0xcc, 0xbc, 0x7e, 0x7c, 0xd2, 0xd2, 0x1f, 0x10, 0x14, 0x28, 0x9a, 0x7b,
+	0xee, 0x38, 0xe6, 0x53, 0xc8, 0xb0, 0x2a, 0xf3, 0x83, 0x2e, 0xba, 0xa6, 0x8d, 0x20, 0xfd, 0x75,
+	0xe9, 0xdf, 0x11, 0x32, 0x2a, 0xfe, 0x59, 0x46, 0x35, 0x61, 0x3e, 0x94, 0x84, 0x2f, 0xe0, 0xe9,
+	0x3f, 0x11, 0x60, 0x7f, 0xd7, 0xe5, 0x89, 0xbd, 0xa2, 0x95, 0x44, 0xe7, 0x3d, 0xfe, 0x19, 0x79,
+	0x4f, 0x5c, 0x99, 0x77, 0xe7, 0xf4, 0x5c, 0x23, 0xef, 0x8f, 0xa0, 0x10, 0xb0, 0x9f, 0xc7, 0xe4,
+	0xfb, 0x90, 0xf5, 0x35, 0x3b, 0xb7, 0xa1, 0x67, 0x46, 0x1d, 0xcb, 0x92, 0xfe, 0x84, 0x60, 0x6e,
+	0x34, 0xa4, 0x7c, 0xdb, 0x92, 0xbe, 0x96, 0x6b, 0x3f, 0x05, 0xec, 0xb7, 0x8f, 0x7b, 0x76, 0xd5,
+	0xa4, 0x22, 0x61, 0xc8, 0xef, 0x5b, 0xc4, 0x6c, 0xda, 0xaa, 0xed, 0x7a, 0x25, 0xfd, 0x03, 0xc1,
+	0x9c, 0x8f, 0xc8, 0xa1, 0xee, 0xb8, 0x03, 0xa7, 0xd6, 0x37, 0x14, 0x53, 0xb5, 0x59, 0xa6, 0x91,
+	0x3c, 0xeb, 0x51, 0x65, 0xd5, 0x26, 0x4e, 0x31, 0x18, 0x43, 0x7d, 0x34, 0x30, 0x38, 0xfd, 0x3a,
+	0x6d, 0x0c, 0x75, 0xde, 0x0b, 0xee, 0x01, 0x56, 0x07, 0x9a, 0x12, 0x42, 0x4a, 0x50, 0xa4, 0xbc,
+	0x3a, 0xd0, 0x76, 0x02, 0x60, 0x15, 0x28, 0x98, 0xc3, 0x1e, 0x09, 0x8b, 0x27, 0xa9, 0xf8, 0x9c,
+	0xc3, 0x0a, 0xc8, 0x4b, 0xbf, 0x82, 0x82, 0x63, 0xf8, 0xce, 0x56, 0xd0, 0xf4, 0x45, 0x98, 0x1e,
+	0x5a, 0xc4, 0x54, 0xb4, 0x2e, 0xaf, 0xce, 0x94, 0xb3, 0xdc, 0xe9, 0xe2, 0xfb, 0xfc, 0xf2, 0x8d,
+	0xd3, 0x18, 0xdf, 0x72, 0x63, 0x3c, 0xe6, 0x3c, 0xbf, 0x97, 0x9f, 0x03, 0x76, 0x58, 0x56, 0x10,
+	0x7d, 0x0d, 0xa6, 0x2c, 0x87, 0x10, 0x6e, 0xa9, 0x11, 0x96, 0xc8, 0x4c, 0x52, 0xfa, 0x1b, 0x02,
+	0xb1, 0x4e, 0x6c, 0x53, 0xeb, 0x58, 0xcf, 0xfa, 0x66, 0x30, 0xa5, 0x5f, 0xb9, 0xb4, 0x1e, 0x41,
+	0xd6, 0xad, 0x19, 0xc5, 0x22, 0xf6, 0xe5, 0x37, 0x66, 0xc6, 0x15, 0x6d, 0x12, 0x5b, 0xda, 0x85,
+	0xe5, 0x89, 0x36, 0xf3, 0x50, 0x94, 0x21, 0xa5, 0x53, 0x11, 0x1e, 0x8b, 0xfc, 0xe8, 0x62, 0x61,
+	0x5b, 0x65, 0xce, 0x97, 0x8a, 0xb0, 0xc0, 0xc1, 0xea, 0xc4, 0x56, 0x9d, 0xe8, 0xba, 0xd5, 0xb7,
+	0x07, 0x8b, 0x63, 0x1c, 0x0e, 0xff, 0x10, 0x66, 0x74, 0x4e, 0xe3, 0x0a, 0x8a, 0x61, 0x05, 0xde,
+	0x1e, 0x4f, 0x52, 0x12, 0xa0, 0xd8, 0x32, 0x55, 0xc3, 0x3a, 0x24, 0x66, 0xab, 0xb9, 0xb5, 0xb1,
+	0xed, 0x9b, 0x8b, 0xa4, 0xff, 0x21, 0xb8, 0x11, 0xba, 0x89, 0x9d, 0x58, 0x1e, 0x9a, 0x7d, 0x5d,
+	0x71, 0x3f, 0xaf, 0x46, 0x65, 0x93, 0x73, 0xe8, 0x3b, 0x9c, 0xbc, 0xd3, 0xf5, 0xd7, 0x55, 0x3c,
+	0x50, 0x57, 0xa3, 0x89, 0x27, 0xf1, 0x55, 0x27, 0x9e, 0x9f, 0x78, 0x13, 0x4f, 0x92, 0xea, 0x99,
+	0x75, 0xd3, 0x18, 0x35, 0xeb, 0xfc, 0x0e, 0xc1, 0x14, 0xf3, 0xf0, 0x6b, 0xd5, 0x96, 0x00, 0x33,
+	0x84, 0xcf, 0x2d, 0xf4, 0x48, 0x4f, 0xc9, 0xde, 0x3a, 0x72, 0xce, 0xa9, 0xc2, 0x6c, 0xa0, 0x8e,
+	0xbe, 0xc3, 0xb7, 0xa3, 0x02, 0x59, 0x3f, 0x07, 0xdf, 0xe1, 0x03, 0x18, 0xa2, 0x03, 0xd8, 0x9c,
+	0xbb, 0x9b, 0xb2, 0xe9, 0xb4, 0xee, 0x4d, 0x5d, 0xb4, 0x59, 0xb1, 0xb4, 0xd1, 0xff, 0xa3, 0x8f,
+	0x8c, 0x04, 0x25, 0xb2, 0x85, 0xf4, 0x5b, 0x04, 0xb9, 0x51, 0x85, 0x3c, 0xd3, 0x7a, 0xe4, 0x4b,
+	0x14, 0x88, 0x00, 0x33, 0x87, 0x5a, 0x8f, 0x50, 0x1b, 0x98, 0x3a, 0x6f, 0x1d, 0x15, 0xa9, 0x1f,
+	0xff, 0x1c, 0xd2, 0x9e, 0x0b, 0x38, 0x0d, 0x53, 0xb5, 0x57, 0xfb, 0xd5, 0x17, 0xf9, 0x18, 0x9e,
+	0x85, 0x74, 0x63, 0xaf, 0xa5, 0xb0, 0x25, 0xc2, 0x37, 0x20, 0x23, 0xd7, 0x9e, 0xd7, 0x0e, 0x94,
+	0x7a, 0xb5, 0xb5, 0xb9, 0x9d, 0x8f, 0x63, 0x0c, 0x39, 0x46, 0x68, 0xec, 0x71, 0x5a, 0x62, 0xfd,
+	0x7c, 0x1a, 0x66, 0x5c, 0x1b, 0xf1, 0x63, 0x48, 0xbe, 0x1c, 0x5a, 0xc7, 0x78, 0x61, 0x54, 0xa1,
+	0xaf, 0x4d, 0xcd, 0x26, 0xfc, 0x34, 0x0a, 0x8b, 0x63, 0x74, 0x7e, 0x72, 0x62, 0x78, 0x0b, 0x32,
+	0xbe, 0xb1, 0x07, 0x47, 0x7e, 0x68, 0x09, 0xb7, 0x03, 0xd4, 0xe0, 0x84, 0x24, 0xc5, 0x56, 0x11,
+	0xde, 0x83, 0x1c, 0x65, 0xb9, 0xd3, 0x8a, 0x85, 0xbd, 0xa9, 0x39, 0x6a, 0x8a, 0x14, 0x96, 0x26,
+	0x70, 0x3d, 0xb3, 0xb6, 0x83, 0x6f, 0x00, 0x42, 0xd4, 0x73, 0x41, 0xd8, 0xb8, 0x88, 0xa1, 0x40,
+	0x8a, 0xe1, 0x1a, 0xc0, 0xa8, 0xa5, 0xe2, 0x5b, 0x01, 0x61, 0xff, 0x18, 0x20, 0x08, 0x51, 0x2c,
+	0x0f, 0x66, 0x03, 0xd2, 0x5e, 0x43, 0xc1, 0xc5, 0x88, 0x1e, 0xc3, 0x40, 0x26, 0x77, 0x1f, 0x29,
+	0x86, 0x9f, 0x41, 0xb6, 0xda, 0xeb, 0x5d, 0x07, 0x46, 0xf0, 0x73, 0xac, 0x30, 0x4e, 0x0f, 0x16,
+	0x27, 0xdc, 0xe1, 0xf8, 0xae, 0x77, 0x56, 0x2e, 0x6d, 0x4c, 0xc2, 0x0f, 0xaf, 0x94, 0xf3, 0xb4,
+	0xb5, 0xe0, 0x46, 0xe8, 0x2a, 0xc7, 0x62, 0x68, 0x77, 0xe8, 0xf6, 0x17, 0x96, 0x27, 0xf2, 0x3d,
+	0xd4, 0x36, 0x14, 0x46, 0x71, 0xf6, 0x9e, 0x8b, 0xb0, 0x34, 0x9e, 0x84, 0xf0, 0xdb, 0x94, 0xf0,
+	0x83, 0x4b, 0x65, 0x7c, 0x55, 0x79, 0x02, 0x0b, 0xd1, 0xcf, 0x31, 0xf8, 0x4e, 0x44, 0xcd, 0x8c,
+	0x3f, 0x11, 0x09, 0x77, 0xaf, 0x12, 0xf3, 0x29, 0x7b, 0x05, 0xf9, 0x70, 0x83, 0xc2, 0x93, 0xbe,
+	0x13, 0x04, 0xef, 0x3d, 0x62, 0x62, 0x4f, 0x8b, 0x95, 0xd1, 0xc6, 0xcf, 0xde, 0x9d, 0x8b, 0xb1,
+	0xf7, 0xe7, 0x62, 0xec, 0xd3, 0xb9, 0x88, 0x7e, 0x73, 0x21, 0xa2, 0xbf, 0x5c, 0x88, 0xe8, 0xed,
+	0x85, 0x88, 0xde, 0x5d, 0x88, 0xe8, 0x3f, 0x17, 0x22, 0xfa, 0xef, 0x85, 0x18, 0xfb, 0x74, 0x21,
+	0xa2, 0xdf, 0x7f, 0x14, 0x63, 0xef, 0x3e, 0x8a, 0xb1, 0xf7, 0x1f, 0xc5, 0xd8, 0x2f, 0x53, 0x9d,
+	0x9e, 0x46, 0x0c, 0xbb, 0x9d, 0xa2, 0xef, 0x7c, 0x0f, 0xfe, 0x3f, 0x00, 0xe1, 0x48, 0x80, 0xc0,
+	0x62, 0x14, 0x00, 0x00,
 }
 
 func (x MatchType) String() string {
@@ -2820,6 +2858,27 @@ func (this *MetricsMetadataResponse) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *TransferTSDBHeadResponse) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*TransferTSDBHeadResponse)
+	if !ok {
+		that2, ok := that.(TransferTSDBHeadResponse)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	return true
+}
 func (this *TimeSeriesChunk) Equal(that interface{}) bool {
 	if that == nil {
 		return this == nil
@@ -3365,6 +3424,15 @@ func (this *MetricsMetadataResponse) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *TransferTSDBHeadResponse) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 4)
+	s = append(s, "&client.TransferTSDBHeadResponse{")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func (this *TimeSeriesChunk) GoString() string {
 	if this == nil {
 		return "nil"
@@ -3471,6 +3539,9 @@ type IngesterClient interface {
 	// that match the matchers.
 	// The listing order of the labels is not guaranteed.
 	LabelValuesCardinality(ctx context.Context, in *LabelValuesCardinalityRequest, opts ...grpc.CallOption) (Ingester_LabelValuesCardinalityClient, error)
+	// TransferTSDBHead receives the in-memory series of an ingester leaving the ring, which hands them off
+	// to the ingesters taking over its tokens.
+	TransferTSDBHead(ctx context.Context, opts ...grpc.CallOption) (Ingester_TransferTSDBHeadClient, error)
 }
 
 type ingesterClient struct {
@@ -3649,6 +3720,40 @@ func (x *ingesterLabelValuesCardinalityClient) Recv() (*LabelValuesCardinalityRe
 	return m, nil
 }
 
+func (c *ingesterClient) TransferTSDBHead(ctx context.Context, opts ...grpc.CallOption) (Ingester_TransferTSDBHeadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Ingester_serviceDesc.Streams[3], "/cortex.Ingester/TransferTSDBHead", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingesterTransferTSDBHeadClient{stream}
+	return x, nil
+}
+
+type Ingester_TransferTSDBHeadClient interface {
+	Send(*TimeSeriesChunk) error
+	CloseAndRecv() (*TransferTSDBHeadResponse, error)
+	grpc.ClientStream
+}
+
+type ingesterTransferTSDBHeadClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingesterTransferTSDBHeadClient) Send(m *TimeSeriesChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingesterTransferTSDBHeadClient) CloseAndRecv() (*TransferTSDBHeadResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(TransferTSDBHeadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // IngesterServer is the server API for Ingester service.
 type IngesterServer interface {
 	Push(context.Context, *mimirpb.WriteRequest) (*mimirpb.WriteResponse, error)
@@ -3667,6 +3772,9 @@ type IngesterServer interface {
 	// that match the matchers.
 	// The listing order of the labels is not guaranteed.
 	LabelValuesCardinality(*LabelValuesCardinalityRequest, Ingester_LabelValuesCardinalityServer) error
+	// TransferTSDBHead receives the in-memory series of an ingester leaving the ring, which hands them off
+	// to the ingesters taking over its tokens.
+	TransferTSDBHead(Ingester_TransferTSDBHeadServer) error
 }
 
 // UnimplementedIngesterServer can be embedded to have forward compatible implementations.
@@ -3706,6 +3814,9 @@ func (*UnimplementedIngesterServer) LabelNamesAndValues(req *LabelNamesAndValues
 func (*UnimplementedIngesterServer) LabelValuesCardinality(req *LabelValuesCardinalityRequest, srv Ingester_LabelValuesCardinalityServer) error {
 	return status.Errorf(codes.Unimplemented, "method LabelValuesCardinality not implemented")
 }
+func (*UnimplementedIngesterServer) TransferTSDBHead(srv Ingester_TransferTSDBHeadServer) error {
+	return status.Errorf(codes.Unimplemented, "method TransferTSDBHead not implemented")
+}
 
 func RegisterIngesterServer(s *grpc.Server, srv IngesterServer) {
 	s.RegisterService(&_Ingester_serviceDesc, srv)
@@ -3918,6 +4029,32 @@ func (x *ingesterLabelValuesCardinalityServer) Send(m *LabelValuesCardinalityRes
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Ingester_TransferTSDBHead_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngesterServer).TransferTSDBHead(&ingesterTransferTSDBHeadServer{stream})
+}
+
+type Ingester_TransferTSDBHeadServer interface {
+	SendAndClose(*TransferTSDBHeadResponse) error
+	Recv() (*TimeSeriesChunk, error)
+	grpc.ServerStream
+}
+
+type ingesterTransferTSDBHeadServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingesterTransferTSDBHeadServer) SendAndClose(m *TransferTSDBHeadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingesterTransferTSDBHeadServer) Recv() (*TimeSeriesChunk, error) {
+	m := new(TimeSeriesChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Ingester_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "cortex.Ingester",
 	HandlerType: (*IngesterServer)(nil),
@@ -3971,6 +4108,11 @@ var _Ingester_serviceDesc = grpc.ServiceDesc{
 			Handler:       _Ingester_LabelValuesCardinality_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "TransferTSDBHead",
+			Handler:       _Ingester_TransferTSDBHead_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "ingester.proto",
 }
@@ -5120,6 +5262,29 @@ func (m *MetricsMetadataResponse) MarshalToSizedBuffer(dAtA []byte) (int, error)
 	return len(dAtA) - i, nil
 }
 
+func (m *TransferTSDBHeadResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TransferTSDBHeadResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TransferTSDBHeadResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	return len(dAtA) - i, nil
+}
+
 func (m *TimeSeriesChunk) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -5862,6 +6027,15 @@ func (m *MetricsMetadataResponse) Size() (n int) {
 	return n
 }
 
+func (m *TransferTSDBHeadResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	return n
+}
+
 func (m *TimeSeriesChunk) Size() (n int) {
 	if m == nil {
 		return 0
@@ -6382,6 +6556,15 @@ func (this *MetricsMetadataResponse) String() string {
 	}, "")
 	return s
 }
+func (this *TransferTSDBHeadResponse) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&TransferTSDBHeadResponse{`,
+		`}`,
+	}, "")
+	return s
+}
 func (this *TimeSeriesChunk) String() string {
 	if this == nil {
 		return "nil"
@@ -9489,6 +9672,59 @@ func (m *MetricsMetadataResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *TransferTSDBHeadResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIngester
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TransferTSDBHeadResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TransferTSDBHeadResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIngester(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIngester
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *TimeSeriesChunk) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -76,3 +76,8 @@ func (m *IngesterServerMock) LabelValuesCardinality(req *LabelValuesCardinalityR
 	args := m.Called(req, srv)
 	return args.Error(0)
 }
+
+func (m *IngesterServerMock) TransferTSDBHead(srv Ingester_TransferTSDBHeadServer) error {
+	args := m.Called(srv)
+	return args.Error(0)
+}
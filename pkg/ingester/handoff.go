@@ -0,0 +1,442 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/ingester/client"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/chunk"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// handoffReplicaSetOp is the operation used to find the replica set of a series while this
+// ingester is leaving the ring, which is the replica set the series was written to so far with WriteOp.
+var handoffReplicaSetOp = ring.NewOp([]ring.InstanceState{ring.ACTIVE, ring.LEAVING}, func(s ring.InstanceState) bool {
+	return s == ring.PENDING
+})
+
+// handoffReplicationStrategy is the ring.ReplicationStrategy used to find the ingesters to hand off
+// the series to. Unlike the default strategy, it doesn't require a quorum of healthy instances, because
+// the replica set of the write operation includes this ingester while it's leaving the ring.
+type handoffReplicationStrategy struct{}
+
+// Filter implements ring.ReplicationStrategy.
+func (handoffReplicationStrategy) Filter(instances []ring.InstanceDesc, op ring.Operation, _ int, heartbeatTimeout time.Duration, _ bool) ([]ring.InstanceDesc, int, error) {
+	now := time.Now()
+
+	healthy := instances[:0]
+	for _, instance := range instances {
+		if instance.IsHealthy(op, heartbeatTimeout, now) {
+			healthy = append(healthy, instance)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return nil, 0, errors.New("no healthy ingester in the replica set")
+	}
+	return healthy, 0, nil
+}
+
+// handoff sends the in-memory series of all tenants to the ingesters which take over the tokens of
+// this ingester once it leaves the ring, so that series don't have to be flushed to small blocks
+// on shutdown, and queries don't miss them until the next ingesters compact their own head.
+// Each series is sent only to the ingesters which are added to its replica set when this
+// ingester leaves the ring, because the other replicas already have it.
+//
+// Once the handoff succeeds, the blocks compacted but not shipped yet are shipped.
+func (i *Ingester) handoff(ctx context.Context) error {
+	level.Info(i.logger).Log("msg", "starting to hand off in-memory series to other ingesters")
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, i.cfg.HandoffTimeout)
+	defer cancel()
+
+	r, err := ring.NewWithStoreClientAndStrategy(i.cfg.IngesterRing.ToRingConfig(), "ingester", IngesterRingKey, readOnlyRingKVClient{i.lifecycler.KVStore}, handoffReplicationStrategy{}, nil, i.logger)
+	if err != nil {
+		return errors.Wrap(err, "create ingesters ring client")
+	}
+	if err := services.StartAndAwaitRunning(ctx, r); err != nil {
+		return errors.Wrap(err, "start ingesters ring client")
+	}
+	defer func() {
+		if err := services.StopAndAwaitTerminated(context.Background(), r); err != nil {
+			level.Warn(i.logger).Log("msg", "failed to stop ingesters ring client", "err", err)
+		}
+	}()
+
+	clients := newHandoffClients(i.cfg.IngesterClientConfig, i.cfg.ingesterClientFactory)
+	defer clients.close()
+
+	err = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.ShipConcurrency, func(ctx context.Context, userID string) error {
+		numSeries, err := i.handoffUser(ctx, r, clients, userID)
+		if err != nil {
+			return errors.Wrapf(err, "hand off in-memory series of user %s", userID)
+		}
+
+		level.Info(i.logger).Log("msg", "handed off in-memory series", "user", userID, "series", numSeries)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
+		i.shipBlocks(ctx, nil)
+	}
+
+	level.Info(i.logger).Log("msg", "finished handing off in-memory series to other ingesters", "duration", time.Since(start))
+	return nil
+}
+
+// handoffUser sends the in-memory series of the tenant, returning the number of series sent.
+func (i *Ingester) handoffUser(ctx context.Context, r ring.ReadRing, clients *handoffClients, userID string) (numSeries int, _ error) {
+	db := i.getTSDB(userID)
+	if db == nil {
+		return 0, nil
+	}
+
+	q, err := db.inMemoryChunkQuerier()
+	if err != nil {
+		return 0, err
+	}
+	defer q.Close()
+
+	// Streams are canceled on error, to stop the receiving ingesters. The series received before the
+	// error are kept by the receiving ingesters, because each series is committed as it arrives. That's
+	// safe because ingesting a series handed off is idempotent, so the series can be handed off again,
+	// and if they're flushed instead the samples stored by both ingesters are identical, so they're
+	// deduplicated by the queriers and the compactor.
+	ctx, cancel := context.WithCancel(user.InjectOrgID(ctx, userID))
+	defer cancel()
+
+	streams := map[string]client.Ingester_TransferTSDBHeadClient{}
+	subring := r.ShuffleShard(userID, i.limits.IngestionTenantShardSize(userID))
+	bufs := newHandoffBuffers()
+
+	hints := configSelectHintsWithDisabledTrimming(initSelectHints(math.MinInt64, math.MaxInt64))
+	ss := q.Select(false, hints, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".*"))
+	for ss.Next() {
+		series := ss.At()
+
+		ts := &client.TimeSeriesChunk{
+			FromIngesterId: i.lifecycler.ID,
+			UserId:         userID,
+			Labels:         mimirpb.FromLabelsToLabelAdapters(series.Labels()),
+		}
+
+		it := series.Iterator()
+		for it.Next() {
+			meta := it.At()
+			if meta.Chunk == nil {
+				return 0, errors.Errorf("unfilled chunk returned from TSDB chunk querier")
+			}
+			if meta.Chunk.Encoding() != chunkenc.EncXOR {
+				return 0, errors.Errorf("unknown chunk encoding from TSDB chunk querier: %v", meta.Chunk.Encoding())
+			}
+
+			ts.Chunks = append(ts.Chunks, client.Chunk{
+				StartTimestampMs: meta.MinTime,
+				EndTimestampMs:   meta.MaxTime,
+				Encoding:         int32(chunk.PrometheusXorChunk),
+				Data:             meta.Chunk.Bytes(),
+			})
+		}
+		if err := it.Err(); err != nil {
+			return 0, err
+		}
+
+		targets, err := handoffTargets(subring, client.ShardByAllLabelAdapters(userID, ts.Labels), bufs)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, addr := range targets {
+			stream, ok := streams[addr]
+			if !ok {
+				c, err := clients.get(addr)
+				if err != nil {
+					return 0, err
+				}
+				if stream, err = c.TransferTSDBHead(ctx); err != nil {
+					return 0, errors.Wrapf(err, "open handoff stream to %s", addr)
+				}
+				streams[addr] = stream
+			}
+
+			if err := stream.Send(ts); err != nil {
+				return 0, errors.Wrapf(err, "send series to %s", addr)
+			}
+			i.metrics.handoffSentSeries.Inc()
+		}
+		numSeries++
+	}
+	if err := ss.Err(); err != nil {
+		return 0, err
+	}
+
+	for addr, stream := range streams {
+		if _, err := stream.CloseAndRecv(); err != nil {
+			return 0, errors.Wrapf(err, "complete handoff to %s", addr)
+		}
+	}
+	return numSeries, nil
+}
+
+type handoffBuffers struct {
+	descs               []ring.InstanceDesc
+	hosts, zones        []string
+	currentAddrs, addrs []string
+}
+
+func newHandoffBuffers() *handoffBuffers {
+	descs, hosts, zones := ring.MakeBuffersForGet()
+	return &handoffBuffers{descs: descs, hosts: hosts, zones: zones}
+}
+
+// handoffTargets returns the addresses of the ingesters the series with the input token must be sent to,
+// which are the ones in the write replica set which are not in the current one. The returned slice is
+// only valid until the next call.
+func handoffTargets(r ring.ReadRing, token uint32, bufs *handoffBuffers) ([]string, error) {
+	current, err := r.Get(token, handoffReplicaSetOp, bufs.descs, bufs.hosts, bufs.zones)
+	if err != nil {
+		return nil, err
+	}
+
+	// The instances of the replica set are copied because the buffers are reused by the next call.
+	bufs.currentAddrs = bufs.currentAddrs[:0]
+	for _, instance := range current.Instances {
+		bufs.currentAddrs = append(bufs.currentAddrs, instance.Addr)
+	}
+
+	next, err := r.Get(token, ring.Write, bufs.descs, bufs.hosts, bufs.zones)
+	if err != nil {
+		return nil, err
+	}
+
+	bufs.addrs = bufs.addrs[:0]
+	for _, instance := range next.Instances {
+		if !stringsContain(bufs.currentAddrs, instance.Addr) {
+			bufs.addrs = append(bufs.addrs, instance.Addr)
+		}
+	}
+	return bufs.addrs, nil
+}
+
+func stringsContain(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// handoffClients keeps a client for each ingester the series are handed off to.
+type handoffClients struct {
+	cfg     client.Config
+	factory func(addr string, cfg client.Config) (client.HealthAndIngesterClient, error)
+
+	mtx     sync.Mutex
+	clients map[string]client.HealthAndIngesterClient
+}
+
+func newHandoffClients(cfg client.Config, factory func(addr string, cfg client.Config) (client.HealthAndIngesterClient, error)) *handoffClients {
+	return &handoffClients{
+		cfg:     cfg,
+		factory: factory,
+		clients: map[string]client.HealthAndIngesterClient{},
+	}
+}
+
+func (c *handoffClients) get(addr string) (client.HealthAndIngesterClient, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if ic, ok := c.clients[addr]; ok {
+		return ic, nil
+	}
+
+	ic, err := c.factory(addr, c.cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create client for ingester %s", addr)
+	}
+	c.clients[addr] = ic
+	return ic, nil
+}
+
+func (c *handoffClients) close() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, ic := range c.clients {
+		_ = ic.Close()
+	}
+	c.clients = nil
+}
+
+// TransferTSDBHead implements client.IngesterServer. It ingests the in-memory series handed off by
+// an ingester leaving the ring. Samples older than the ones in the TSDB head are ingested as
+// out-of-order samples, regardless of the tenant's out-of-order time window, if the TSDB allows
+// querying overlapping blocks.
+func (i *Ingester) TransferTSDBHead(stream client.Ingester_TransferTSDBHeadServer) error {
+	if err := i.checkRunning(); err != nil {
+		return err
+	}
+	if err := i.checkWritable(); err != nil {
+		return err
+	}
+
+	userID, err := tenant.TenantID(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	db, err := i.getOrCreateTSDB(userID, false)
+	if err != nil {
+		return wrapWithUser(err, userID)
+	}
+
+	numSeries, numSamples := 0, 0
+	fromIngesterID := ""
+	for {
+		series, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "handoff of in-memory series interrupted, keeping the series received so far", "user", userID, "from_ingester", fromIngesterID, "series", numSeries, "samples", numSamples, "err", err)
+			return err
+		}
+
+		appended, err := i.appendHandedOffSeries(stream.Context(), userID, db, series)
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "failed to ingest in-memory series handed off, keeping the series received so far", "user", userID, "from_ingester", series.FromIngesterId, "series", numSeries, "samples", numSamples, "err", err)
+			return wrapWithUser(err, userID)
+		}
+
+		fromIngesterID = series.FromIngesterId
+		numSeries++
+		numSamples += appended
+	}
+
+	level.Info(i.logger).Log("msg", "received in-memory series handed off", "user", userID, "from_ingester", fromIngesterID, "series", numSeries, "samples", numSamples)
+	return stream.SendAndClose(&client.TransferTSDBHeadResponse{})
+}
+
+// appendHandedOffSeries appends the samples of the series to the TSDB, returning the number of samples appended.
+func (i *Ingester) appendHandedOffSeries(ctx context.Context, userID string, db *userTSDB, series *client.TimeSeriesChunk) (int, error) {
+	if err := db.acquireAppendLock(); err != nil {
+		return 0, err
+	}
+	defer db.releaseAppendLock()
+
+	var (
+		now          = time.Now()
+		lset         = mimirpb.FromLabelAdaptersToLabelsWithCopy(series.Labels)
+		app          = db.Appender(ctx)
+		ref          storage.SeriesRef
+		appended     = 0
+		headAppended = 0
+		outOfOrder   []mimirpb.Sample
+		discarded    = map[string]int{}
+	)
+
+	for _, c := range series.Chunks {
+		if c.Encoding != int32(chunk.PrometheusXorChunk) {
+			_ = app.Rollback()
+			return 0, errors.Errorf("unknown chunk encoding: %d", c.Encoding)
+		}
+
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+		if err != nil {
+			_ = app.Rollback()
+			return 0, err
+		}
+
+		it := chk.Iterator(nil)
+		for it.Next() {
+			t, v := it.At()
+
+			var err error
+			if ref, err = app.Append(ref, lset, t, v); err == nil {
+				headAppended++
+				continue
+			}
+
+			switch errors.Cause(err) {
+			case storage.ErrOutOfBounds, storage.ErrOutOfOrderSample:
+				// Samples older than the in-memory series are ingested as out-of-order samples, whatever
+				// the tenant's out-of-order time window, unless the TSDB doesn't allow the overlapping
+				// blocks they're flushed to.
+				if !db.allowOverlappingQueries {
+					discarded[sampleOutOfOrder]++
+					continue
+				}
+				outOfOrder = append(outOfOrder, mimirpb.Sample{TimestampMs: t, Value: v})
+			case storage.ErrDuplicateSampleForTimestamp:
+				discarded[newValueForTimestamp]++
+			case errMaxSeriesPerUserLimitExceeded:
+				discarded[perUserSeriesLimit]++
+			case errMaxSeriesPerMetricLimitExceeded:
+				discarded[perMetricSeriesLimit]++
+			default:
+				if rollbackErr := app.Rollback(); rollbackErr != nil {
+					level.Warn(i.logger).Log("msg", "failed to rollback on error", "user", userID, "err", rollbackErr)
+				}
+				return 0, err
+			}
+		}
+		if err := it.Err(); err != nil {
+			_ = app.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := app.Commit(); err != nil {
+		return 0, err
+	}
+	appended += headAppended
+
+	if len(outOfOrder) > 0 {
+		oooAppended, duplicates, err := db.oooHead.append(lset, outOfOrder)
+		if err != nil {
+			return 0, err
+		}
+		appended += oooAppended
+		discarded[newValueForTimestamp] += len(duplicates)
+		i.metrics.ingestedOutOfOrderSamples.WithLabelValues(userID).Add(float64(oooAppended))
+	}
+
+	for reason, count := range discarded {
+		if count > 0 {
+			validation.DiscardedSamples.WithLabelValues(reason, userID).Add(float64(count))
+		}
+	}
+
+	if appended > 0 {
+		db.setLastUpdate(now)
+		i.metrics.handoffReceivedSamples.Add(float64(appended))
+	}
+	if i.cfg.ActiveSeriesMetricsEnabled && headAppended > 0 {
+		db.activeSeries.UpdateSeries(lset, now, func(l labels.Labels) labels.Labels { return l })
+	}
+
+	return appended, nil
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"math"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/middleware"
+	"github.com/weaveworks/common/user"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/mimir/pkg/ingester/client"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/chunk"
+)
+
+func TestIngester_HandoffOnShutdown(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), userID)
+	kvCfg := defaultIngesterTestConfig(t).IngesterRing.KVStore
+
+	// Start the ingester receiving the series, exposing it through a gRPC server.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// The handoff doesn't need to be enabled on the receiver to accept the series handed off.
+	receiverCfg := defaultIngesterTestConfig(t)
+	receiverCfg.IngesterRing.KVStore = kvCfg
+	receiverCfg.IngesterRing.ReplicationFactor = 1
+	receiverCfg.IngesterRing.InstanceID = "receiver"
+	receiverCfg.BlocksStorageConfig.TSDB.AllowOverlappingQueries = true
+	receiverCfg.IngesterRing.InstanceAddr = "127.0.0.1"
+	receiverCfg.IngesterRing.ListenPort = listener.Addr().(*net.TCPAddr).Port
+	receiverCfg.IngesterRing.TokensFilePath = filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, ring.Tokens{1}.StoreToFile(receiverCfg.IngesterRing.TokensFilePath))
+
+	receiverReg := prometheus.NewPedanticRegistry()
+	receiver, err := prepareIngesterWithBlocksStorage(t, receiverCfg, receiverReg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), receiver))
+	defer services.StopAndAwaitTerminated(context.Background(), receiver) //nolint:errcheck
+
+	serv := grpc.NewServer(grpc.StreamInterceptor(middleware.StreamServerUserHeaderInterceptor))
+	defer serv.GracefulStop()
+	client.RegisterIngesterServer(serv, receiver)
+	go func() {
+		require.NoError(t, serv.Serve(listener))
+	}()
+
+	// Start the ingester leaving the ring, owning almost all the tokens.
+	senderCfg := defaultIngesterTestConfig(t)
+	senderCfg.HandoffOnShutdownEnabled = true
+	senderCfg.IngesterClientConfig = defaultClientTestConfig()
+	senderCfg.IngesterRing.KVStore = kvCfg
+	senderCfg.IngesterRing.ReplicationFactor = 1
+	senderCfg.IngesterRing.InstanceID = "sender"
+	senderCfg.IngesterRing.InstanceAddr = "127.0.0.2"
+	senderCfg.IngesterRing.TokensFilePath = filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, ring.Tokens{math.MaxUint32 - 1}.StoreToFile(senderCfg.IngesterRing.TokensFilePath))
+
+	senderReg := prometheus.NewPedanticRegistry()
+	sender, err := prepareIngesterWithBlocksStorage(t, senderCfg, senderReg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), sender))
+
+	test.Poll(t, time.Second, 2, func() interface{} {
+		return numActiveInstances(kvCfg.Mock)
+	})
+
+	// The receiver already has recent samples of the tenant, so the older samples
+	// handed off are ingested as out-of-order samples.
+	const recentTs = int64(10 * time.Hour / time.Millisecond)
+	req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "recent"), 1, recentTs)
+	_, err = receiver.Push(ctx, req)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "old", "series", strconv.Itoa(i%2)), float64(i), int64(i)*time.Minute.Milliseconds())
+		_, err = sender.Push(ctx, req)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "new"), float64(i), recentTs+int64(i)*time.Minute.Milliseconds())
+		_, err = sender.Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), sender))
+
+	res, _, err := runTestQuery(ctx, t, receiver, labels.MatchRegexp, labels.MetricName, ".+")
+	require.NoError(t, err)
+	numSamples := map[string]int{}
+	for _, series := range res {
+		numSamples[series.Metric.String()] = len(series.Values)
+	}
+	assert.Equal(t, map[string]int{
+		`new`:             10,
+		`old{series="0"}`: 5,
+		`old{series="1"}`: 5,
+		`recent`:          1,
+	}, numSamples)
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(sender.metrics.handoffSentSeries))
+	assert.Equal(t, float64(20), testutil.ToFloat64(receiver.metrics.handoffReceivedSamples))
+	assert.Equal(t, float64(10), testutil.ToFloat64(receiver.metrics.ingestedOutOfOrderSamples.WithLabelValues(userID)))
+}
+
+func TestIngester_TransferTSDBHeadShouldBeIdempotent(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.AllowOverlappingQueries = true
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// The ingester already has recent samples of the tenant, so the samples handed off are out-of-order.
+	const recentTs = int64(10 * time.Hour / time.Millisecond)
+	req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "recent"), 1, recentTs)
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+
+	chk := chunkenc.NewXORChunk()
+	app, err := chk.Appender()
+	require.NoError(t, err)
+	for ts := int64(0); ts < 10; ts++ {
+		app.Append(ts*time.Minute.Milliseconds(), float64(ts))
+	}
+	series := &client.TimeSeriesChunk{
+		FromIngesterId: "sender",
+		UserId:         userID,
+		Labels:         mimirpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, "old")),
+		Chunks:         []client.Chunk{{Encoding: int32(chunk.PrometheusXorChunk), Data: chk.Bytes()}},
+	}
+
+	db := i.getTSDB(userID)
+	require.NotNil(t, db)
+
+	// A series handed off again, after a failed handoff, mustn't be ingested twice.
+	for n := 0; n < 2; n++ {
+		_, err := i.appendHandedOffSeries(ctx, userID, db, series)
+		require.NoError(t, err)
+	}
+
+	res, _, err := runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "old")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Len(t, res[0].Values, 10)
+}
+
+func TestHandoffTargets(t *testing.T) {
+	tests := map[string]struct {
+		replicationFactor int
+		expected          []string
+	}{
+		"replication factor 1": {
+			replicationFactor: 1,
+			expected:          []string{"ingester-2"},
+		},
+		"replication factor 2": {
+			// The series already is in ingester-2.
+			replicationFactor: 2,
+			expected:          []string{"ingester-3"},
+		},
+		"replication factor 3": {
+			// The ring has no other ingester to extend the replica set to.
+			replicationFactor: 3,
+			expected:          nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultIngesterTestConfig(t)
+			cfg.IngesterRing.ReplicationFactor = tc.replicationFactor
+
+			now := time.Now()
+			desc := ring.NewDesc()
+			desc.AddIngester("ingester-1", "ingester-1", "", []uint32{100}, ring.LEAVING, now)
+			desc.AddIngester("ingester-2", "ingester-2", "", []uint32{200}, ring.ACTIVE, now)
+			desc.AddIngester("ingester-3", "ingester-3", "", []uint32{300}, ring.ACTIVE, now)
+			require.NoError(t, cfg.IngesterRing.KVStore.Mock.CAS(context.Background(), IngesterRingKey, func(interface{}) (interface{}, bool, error) {
+				return desc, true, nil
+			}))
+
+			r, err := ring.NewWithStoreClientAndStrategy(cfg.IngesterRing.ToRingConfig(), "ingester", IngesterRingKey, cfg.IngesterRing.KVStore.Mock, handoffReplicationStrategy{}, nil, log.NewNopLogger())
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+			defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+			targets, err := handoffTargets(r, 50, newHandoffBuffers())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, targets)
+		})
+	}
+}
+
+func numActiveInstances(c kv.Client) int {
+	desc, err := c.Get(context.Background(), IngesterRingKey)
+	if desc == nil || err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, instance := range desc.(*ring.Desc).Ingesters {
+		if instance.State == ring.ACTIVE {
+			count++
+		}
+	}
+	return count
+}
@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -56,6 +57,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/costattribution"
 	"github.com/grafana/mimir/pkg/util/globalerror"
 	util_log "github.com/grafana/mimir/pkg/util/log"
 	util_math "github.com/grafana/mimir/pkg/util/math"
@@ -78,6 +80,7 @@ const (
 	IngesterRingKey = "ring"
 
 	errTSDBCreateIncompatibleState = "cannot create a new TSDB while the ingester is not in active state (current state: %s)"
+	errReadOnly                    = "the ingester is in read-only mode"
 
 	// Jitter applied to the idle timeout to prevent compaction in all ingesters concurrently.
 	compactionIdleTimeoutJitter = 0.25
@@ -134,6 +137,12 @@ type Config struct {
 
 	IgnoreSeriesLimitForMetricNames string `yaml:"ignore_series_limit_for_metric_names" category:"advanced"`
 
+	HandoffOnShutdownEnabled bool          `yaml:"handoff_on_shutdown_enabled" category:"experimental"`
+	HandoffTimeout           time.Duration `yaml:"handoff_timeout" category:"experimental"`
+
+	// Used to hand off the in-memory series to other ingesters.
+	IngesterClientConfig client.Config `yaml:"-"`
+
 	// For testing, you can override the address and ID of this ingester.
 	ingesterClientFactory func(addr string, cfg client.Config) (client.HealthAndIngesterClient, error)
 }
@@ -155,6 +164,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.DefaultLimits.RegisterFlags(f)
 
 	f.StringVar(&cfg.IgnoreSeriesLimitForMetricNames, "ingester.ignore-series-limit-for-metric-names", "", "Comma-separated list of metric names, for which the -ingester.max-global-series-per-metric limit will be ignored. Does not affect the -ingester.max-global-series-per-user limit.")
+
+	f.BoolVar(&cfg.HandoffOnShutdownEnabled, "ingester.handoff-on-shutdown-enabled", false, "When enabled, the ingester hands its in-memory series off to the ingesters taking over its tokens when it leaves the ring on shutdown, instead of flushing them to the long-term storage. If the handoff fails, the in-memory series are flushed if -blocks-storage.tsdb.flush-blocks-on-shutdown is enabled. Ingesters receiving the series ingest the samples older than their own in-memory series as out-of-order samples, whether this option is enabled on them or not, if the TSDB of the tenant allows querying overlapping blocks.")
+	f.DurationVar(&cfg.HandoffTimeout, "ingester.handoff-timeout", 5*time.Minute, "Maximum time the ingester waits for the handoff of the in-memory series to complete on shutdown.")
 }
 
 func (cfg *Config) getIgnoreSeriesLimitForMetricNamesMap() map[string]struct{} {
@@ -189,6 +201,7 @@ type Ingester struct {
 	logger  log.Logger
 
 	lifecycler         *ring.Lifecycler
+	readOnly           atomic.Bool
 	limits             *validation.Overrides
 	limiter            *Limiter
 	subservicesWatcher *services.FailureWatcher
@@ -225,6 +238,9 @@ type Ingester struct {
 	// Rate of pushed samples. Used to limit global samples push rate.
 	ingestionRate        *util_math.EwmaRate
 	inflightPushRequests atomic.Int64
+
+	// Tracks the ingested and discarded samples and the active series by cost attribution.
+	costAttribution *costattribution.Tracker
 }
 
 func newIngester(cfg Config, limits *validation.Overrides, registerer prometheus.Registerer, logger log.Logger) (*Ingester, error) {
@@ -249,6 +265,7 @@ func newIngester(cfg Config, limits *validation.Overrides, registerer prometheus
 		forceCompactTrigger: make(chan requestWithUsersAndCallback),
 		shipTrigger:         make(chan requestWithUsersAndCallback),
 		seriesHashCache:     hashcache.NewSeriesHashCache(cfg.BlocksStorageConfig.TSDB.SeriesHashCacheMaxBytes),
+		costAttribution:     costattribution.NewTracker("ingester", limits),
 	}, nil
 }
 
@@ -279,6 +296,8 @@ func New(cfg Config, limits *validation.Overrides, registerer prometheus.Registe
 			Name: "cortex_ingester_oldest_unshipped_block_timestamp_seconds",
 			Help: "Unix timestamp of the oldest TSDB block not shipped to the storage yet. 0 if ingester has no blocks or all blocks have been shipped.",
 		}, i.getOldestUnshippedBlockMetric)
+
+		registerer.MustRegister(i.costAttribution)
 	}
 
 	i.lifecycler, err = ring.NewLifecycler(cfg.IngesterRing.ToLifecyclerConfig(), i, "ingester", IngesterRingKey, cfg.BlocksStorageConfig.TSDB.FlushBlocksOnShutdown, logger, prometheus.WrapRegistererWithPrefix("cortex_", registerer))
@@ -351,6 +370,13 @@ func (i *Ingester) starting(ctx context.Context) error {
 		return errors.Wrap(err, "failed to start lifecycler")
 	}
 
+	// The read-only mode is kept across restarts.
+	readOnly, err := i.getReadOnlyRegistration(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the read-only mode of the ingester")
+	}
+	i.readOnly.Store(readOnly)
+
 	// let's start the rest of subservices via manager
 	servs := []services.Service(nil)
 
@@ -371,7 +397,6 @@ func (i *Ingester) starting(ctx context.Context) error {
 		servs = append(servs, closeIdleService)
 	}
 
-	var err error
 	i.subservices, err = services.NewManager(servs...)
 	if err == nil {
 		err = services.StartManagerAndAwaitHealthy(ctx, i.subservices)
@@ -400,6 +425,12 @@ func (i *Ingester) stopping(_ error) error {
 		level.Warn(i.logger).Log("msg", "failed to stop ingester lifecycler", "err", err)
 	}
 
+	if i.readOnly.Load() && i.lifecycler.ShouldUnregisterOnShutdown() {
+		if err := i.setReadOnlyRegistration(context.Background(), false); err != nil {
+			level.Warn(i.logger).Log("msg", "failed to unregister the ingester from the read-only ingesters", "err", err)
+		}
+	}
+
 	if !i.cfg.BlocksStorageConfig.TSDB.KeepUserTSDBOpenOnShutdown {
 		i.closeAllTSDB()
 	}
@@ -471,6 +502,9 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 		if newMatchersConfig.String() != userDB.activeSeries.CurrentConfig().String() {
 			i.replaceMatchers(activeseries.NewMatchers(newMatchersConfig), userDB, now)
 		}
+		if newAttributionLabels := i.limits.CostAttributionLabels(userID); strings.Join(newAttributionLabels, ",") != strings.Join(userDB.activeSeries.CurrentCostAttributionLabels(), ",") {
+			i.reloadCostAttribution(userID, userDB, newAttributionLabels, now)
+		}
 		allActive, activeMatching, valid := userDB.activeSeries.Active(now)
 		if !valid {
 			// Active series config has been reloaded, exposing loading metric until MetricsIdleTimeout passes.
@@ -491,8 +525,24 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 					i.metrics.activeSeriesCustomTrackersPerUser.DeleteLabelValues(userID, name)
 				}
 			}
+
+			i.costAttribution.SetActiveSeries(userID, userDB.activeSeries.ActiveByAttribution(), now)
+		}
+	}
+
+	// The attributions are retained while they have active series.
+	i.costAttribution.Purge(now.Add(-i.cfg.ActiveSeriesMetricsIdleTimeout))
+}
+
+// reloadCostAttribution configures the active series of the tenant to be tracked by the given cost attribution labels.
+func (i *Ingester) reloadCostAttribution(userID string, userDB *userTSDB, attributionLabels []string, now time.Time) {
+	var attribute func(labels.Labels) string
+	if len(attributionLabels) > 0 {
+		attribute = func(series labels.Labels) string {
+			return i.costAttribution.Attribution(userID, series, time.Now())
 		}
 	}
+	userDB.activeSeries.ReloadCostAttribution(attributionLabels, attribute, now)
 }
 
 // Go through all tenants and apply the current max-exemplars setting.
@@ -539,6 +589,9 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 	if err := i.checkRunning(); err != nil {
 		return nil, err
 	}
+	if err := i.checkWritable(); err != nil {
+		return nil, err
+	}
 
 	// We will report *this* request in the error too.
 	inflight := i.inflightPushRequests.Inc()
@@ -605,11 +658,27 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 
 		minAppendTime, minAppendTimeAvailable = db.Head().AppendableMinValidTime()
 
+		// Samples rejected by the head are ingested as out-of-order samples if not older than this time.
+		oooMinValidTime, oooEnabled = db.outOfOrderMinValidTime(i.limits.OutOfOrderTimeWindow(userID))
+		outOfOrderSeries            []oooSeriesSamples
+		outOfOrderSamplesCount      = 0
+
+		// Samples from HA replicas with the same timestamp as a sample already ingested are discarded as duplicates.
+		haDedupEnabled        = i.limits.HASampleDeduplicationEnabled(userID)
+		haDedupedSamplesCount = 0
+
 		updateFirstPartial = func(errFn func() error) {
 			if firstPartialErr == nil {
 				firstPartialErr = errFn()
 			}
 		}
+
+		attributeCost      = i.costAttribution.Enabled(userID)
+		attributeDiscarded = func(series []mimirpb.LabelAdapter, reason string, samples int) {
+			if attributeCost {
+				i.costAttribution.IncrementDiscardedSamples(userID, mimirpb.FromLabelAdaptersToLabels(series), reason, samples, startAppend)
+			}
+		}
 	)
 
 	// Walk the samples, appending them to the users database
@@ -625,9 +694,11 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 		// has sorted labels once hit the ingester).
 
 		// Fast path in case we only have samples and they are all out of bounds.
-		if minAppendTimeAvailable && len(ts.Samples) > 0 && len(ts.Exemplars) == 0 && allOutOfBounds(ts.Samples, minAppendTime) {
+		if minAppendTimeAvailable && len(ts.Samples) > 0 && len(ts.Exemplars) == 0 && allOutOfBounds(ts.Samples, minAppendTime) &&
+			(!oooEnabled || allOutOfBounds(ts.Samples, oooMinValidTime)) {
 			failedSamplesCount += len(ts.Samples)
 			sampleOutOfBoundsCount += len(ts.Samples)
+			attributeDiscarded(ts.Labels, sampleOutOfBounds, len(ts.Samples))
 
 			updateFirstPartial(func() error {
 				return newIngestErrSampleTimestampTooOld(model.Time(ts.Samples[0].TimestampMs), ts.Labels)
@@ -641,6 +712,9 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 		// To find out if any sample was added to this series, we keep old value.
 		oldSucceededSamplesCount := succeededSamplesCount
 
+		// Samples of this series to ingest as out-of-order samples.
+		var outOfOrderSamples []mimirpb.Sample
+
 		for _, s := range ts.Samples {
 			var err error
 
@@ -661,6 +735,18 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 				}
 			}
 
+			// The TSDB head only rejects a sample with the same timestamp as the last committed sample of the series
+			// if its value is different, so the sample has been received from another HA replica.
+			if haDedupEnabled && errors.Cause(err) == storage.ErrDuplicateSampleForTimestamp {
+				haDedupedSamplesCount++
+				continue
+			}
+
+			if cause := errors.Cause(err); oooEnabled && s.TimestampMs >= oooMinValidTime && (cause == storage.ErrOutOfBounds || cause == storage.ErrOutOfOrderSample) {
+				outOfOrderSamples = append(outOfOrderSamples, s)
+				continue
+			}
+
 			failedSamplesCount++
 
 			// Check if the error is a soft error we can proceed on. If so, we keep track
@@ -670,16 +756,19 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 			switch cause := errors.Cause(err); cause {
 			case storage.ErrOutOfBounds:
 				sampleOutOfBoundsCount++
+				attributeDiscarded(ts.Labels, sampleOutOfBounds, 1)
 				updateFirstPartial(func() error { return newIngestErrSampleTimestampTooOld(model.Time(s.TimestampMs), ts.Labels) })
 				continue
 
 			case storage.ErrOutOfOrderSample:
 				sampleOutOfOrderCount++
+				attributeDiscarded(ts.Labels, sampleOutOfOrder, 1)
 				updateFirstPartial(func() error { return newIngestErrSampleOutOfOrder(model.Time(s.TimestampMs), ts.Labels) })
 				continue
 
 			case storage.ErrDuplicateSampleForTimestamp:
 				newValueForTimestampCount++
+				attributeDiscarded(ts.Labels, newValueForTimestamp, 1)
 				updateFirstPartial(func() error {
 					return newIngestErrSampleDuplicateTimestamp(model.Time(s.TimestampMs), ts.Labels)
 				})
@@ -687,11 +776,13 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 
 			case errMaxSeriesPerUserLimitExceeded:
 				perUserSeriesLimitCount++
+				attributeDiscarded(ts.Labels, perUserSeriesLimit, 1)
 				updateFirstPartial(func() error { return makeLimitError(perUserSeriesLimit, i.limiter.FormatError(userID, cause)) })
 				continue
 
 			case errMaxSeriesPerMetricLimitExceeded:
 				perMetricSeriesLimitCount++
+				attributeDiscarded(ts.Labels, perMetricSeriesLimit, 1)
 				updateFirstPartial(func() error {
 					return makeMetricLimitError(perMetricSeriesLimit, copiedLabels, i.limiter.FormatError(userID, cause))
 				})
@@ -706,6 +797,18 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 			return nil, wrapWithUser(err, userID)
 		}
 
+		if len(outOfOrderSamples) > 0 {
+			// Labels are copied because the request is reused once the push completes, while the out-of-order head retains them.
+			outOfOrderSeries = append(outOfOrderSeries, oooSeriesSamples{
+				lset:    mimirpb.FromLabelAdaptersToLabelsWithCopy(ts.Labels),
+				samples: outOfOrderSamples,
+			})
+		}
+
+		if attributeCost {
+			i.costAttribution.IncrementReceivedSamples(userID, mimirpb.FromLabelAdaptersToLabels(ts.Labels), succeededSamplesCount-oldSucceededSamplesCount, startAppend)
+		}
+
 		if i.cfg.ActiveSeriesMetricsEnabled && succeededSamplesCount > oldSucceededSamplesCount {
 			db.activeSeries.UpdateSeries(mimirpb.FromLabelAdaptersToLabels(ts.Labels), startAppend, func(l labels.Labels) labels.Labels {
 				// we must already have copied the labels if succeededSamplesCount has been incremented.
@@ -762,6 +865,32 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 	}
 	i.metrics.appenderCommitDuration.Observe(time.Since(startCommit).Seconds())
 
+	for _, series := range outOfOrderSeries {
+		appended, duplicates, err := db.oooHead.append(series.lset, series.samples)
+		if err != nil {
+			return nil, wrapWithUser(err, userID)
+		}
+
+		succeededSamplesCount += appended
+		outOfOrderSamplesCount += appended
+		if attributeCost {
+			i.costAttribution.IncrementReceivedSamples(userID, series.lset, appended, startAppend)
+		}
+
+		if len(duplicates) > 0 && haDedupEnabled {
+			haDedupedSamplesCount += len(duplicates)
+		} else if len(duplicates) > 0 {
+			failedSamplesCount += len(duplicates)
+			newValueForTimestampCount += len(duplicates)
+			if attributeCost {
+				i.costAttribution.IncrementDiscardedSamples(userID, series.lset, newValueForTimestamp, len(duplicates), startAppend)
+			}
+			updateFirstPartial(func() error {
+				return newIngestErrSampleDuplicateTimestamp(model.Time(duplicates[0].TimestampMs), mimirpb.FromLabelsToLabelAdapters(series.lset))
+			})
+		}
+	}
+
 	// If only invalid samples are pushed, don't change "last update", as TSDB was not modified.
 	if succeededSamplesCount > 0 {
 		db.setLastUpdate(time.Now())
@@ -772,6 +901,12 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 	// which will be converted into an HTTP 5xx and the client should/will retry.
 	i.metrics.ingestedSamples.WithLabelValues(userID).Add(float64(succeededSamplesCount))
 	i.metrics.ingestedSamplesFail.WithLabelValues(userID).Add(float64(failedSamplesCount))
+	if outOfOrderSamplesCount > 0 {
+		i.metrics.ingestedOutOfOrderSamples.WithLabelValues(userID).Add(float64(outOfOrderSamplesCount))
+	}
+	if haDedupedSamplesCount > 0 {
+		i.metrics.haDedupedSamples.WithLabelValues(userID).Add(float64(haDedupedSamplesCount))
+	}
 	i.metrics.ingestedExemplars.Add(float64(succeededExemplarsCount))
 	i.metrics.ingestedExemplarsFail.Add(float64(failedExemplarsCount))
 
@@ -1451,8 +1586,18 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 		instanceLimitsFn:    i.getInstanceLimits,
 		instanceSeriesCount: &i.seriesCount,
 	}
+	// The cost attribution is configured before any series is tracked, so there's no need to wait for
+	// the active series to be reloaded.
+	if attributionLabels := i.limits.CostAttributionLabels(userID); len(attributionLabels) > 0 {
+		i.reloadCostAttribution(userID, userDB, attributionLabels, time.Time{})
+	}
 
 	maxExemplars := i.limiter.convertGlobalToLocalLimit(userID, i.limits.MaxGlobalExemplarsPerUser(userID))
+
+	// Out-of-order samples are flushed to blocks overlapping with the other ones, so overlapping queries
+	// must be allowed if the tenant can ingest out-of-order samples, or has ingested them in the past.
+	userDB.allowOverlappingQueries = i.cfg.BlocksStorageConfig.TSDB.AllowOverlappingQueries || i.limits.OutOfOrderTimeWindow(userID) > 0 || hasOOOWAL(udir)
+
 	// Create a new user database
 	db, err := tsdb.Open(udir, userLogger, tsdbPromReg, &tsdb.Options{
 		RetentionDuration:              i.cfg.BlocksStorageConfig.TSDB.Retention.Milliseconds(),
@@ -1473,7 +1618,7 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 		IsolationDisabled:              !i.cfg.BlocksStorageConfig.TSDB.IsolationEnabled,
 		HeadChunksWriteQueueSize:       i.cfg.BlocksStorageConfig.TSDB.HeadChunksWriteQueueSize,
 		NewChunkDiskMapper:             i.cfg.BlocksStorageConfig.TSDB.NewChunkDiskMapper,
-		AllowOverlappingQueries:        i.cfg.BlocksStorageConfig.TSDB.AllowOverlappingQueries,
+		AllowOverlappingQueries:        userDB.allowOverlappingQueries,
 		AllowOverlappingCompaction:     false, // always false since Mimir only uploads lvl 1 compacted blocks
 	}, nil)
 	if err != nil {
@@ -1490,6 +1635,13 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 		return nil, errors.Wrapf(err, "failed to compact TSDB: %s", udir)
 	}
 
+	// The out-of-order head is always opened, because the out-of-order time window can be changed at runtime.
+	userDB.oooHead, err = openOOOHead(userLogger, udir, i.cfg.BlocksStorageConfig.TSDB.WALSegmentSizeBytes, i.cfg.BlocksStorageConfig.TSDB.WALCompressionEnabled)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "failed to open out-of-order head: %s", udir)
+	}
+
 	userDB.db = db
 	// We set the limiter here because we don't want to limit
 	// series during WAL replay.
@@ -1553,6 +1705,7 @@ func (i *Ingester) closeAllTSDB() {
 
 			i.metrics.memUsers.Dec()
 			i.metrics.deletePerUserCustomTrackerMetrics(userID, db.activeSeries.CurrentMatcherNames())
+			i.costAttribution.RemoveUser(userID)
 		}(userDB)
 	}
 
@@ -1824,6 +1977,11 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 		}
 	}
 
+	var earlyCompactionUsers map[string]bool
+	if !force {
+		earlyCompactionUsers = i.earlyCompactionUsers(time.Now())
+	}
+
 	_ = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.HeadCompactionConcurrency, func(ctx context.Context, userID string) error {
 		if !allowed.IsAllowed(userID) {
 			return nil
@@ -1836,7 +1994,8 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 
 		// Don't do anything, if there is nothing to compact.
 		h := userDB.Head()
-		if h.NumSeries() == 0 {
+		hasOutOfOrderSamples := userDB.oooHead != nil && !userDB.oooHead.empty()
+		if h.NumSeries() == 0 && !hasOutOfOrderSamples {
 			return nil
 		}
 
@@ -1846,6 +2005,9 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 
 		reason := ""
 		switch {
+		case h.NumSeries() == 0:
+			reason = "out-of-order"
+
 		case force:
 			reason = "forced"
 			err = userDB.compactHead(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
@@ -1855,11 +2017,24 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 			level.Info(i.logger).Log("msg", "TSDB is idle, forcing compaction", "user", userID)
 			err = userDB.compactHead(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
 
+		case earlyCompactionUsers[userID]:
+			reason = "early"
+			err = i.compactHeadEarly(userID, userDB, time.Now())
+
 		default:
 			reason = "regular"
 			err = userDB.Compact()
 		}
 
+		// Out-of-order samples are flushed once the head can't accept samples in their time range anymore.
+		if err == nil && hasOutOfOrderSamples {
+			var flushed int
+			flushed, err = userDB.flushOutOfOrderSamples(ctx, i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
+			if flushed > 0 {
+				level.Info(i.logger).Log("msg", "flushed out-of-order samples to blocks", "user", userID, "samples", flushed)
+			}
+		}
+
 		if err != nil {
 			i.metrics.compactionsFailed.Inc()
 			level.Warn(i.logger).Log("msg", "TSDB blocks compaction for user has failed", "user", userID, "err", err, "compactReason", reason)
@@ -1871,6 +2046,97 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 	})
 }
 
+// earlyCompactionUsers returns the users whose TSDB head should be compacted early, because their in-memory
+// series or estimated head size exceed the per-tenant thresholds, or because the ones of the ingester exceed
+// the per-instance thresholds. In the latter case, the users with the biggest heads are picked, until their
+// heads add up to the excess over the per-instance thresholds. Users compacted early within the cooldown
+// period are not picked.
+func (i *Ingester) earlyCompactionUsers(now time.Time) map[string]bool {
+	cfg := i.cfg.BlocksStorageConfig.TSDB
+
+	type candidate struct {
+		userID string
+		series int64
+		bytes  int64
+	}
+
+	var (
+		users                         = map[string]bool{}
+		candidates                    []candidate
+		totalSeries, totalBytes       int64
+		selectedSeries, selectedBytes int64
+	)
+
+	for _, userID := range i.getTSDBUsers() {
+		userDB := i.getTSDB(userID)
+		if userDB == nil {
+			continue
+		}
+
+		c := candidate{userID: userID, series: int64(userDB.Head().NumSeries()), bytes: userDB.estimatedHeadBytes()}
+		totalSeries += c.series
+		totalBytes += c.bytes
+
+		if c.series == 0 || !userDB.canEarlyCompact(now, cfg.EarlyHeadCompactionCooldown) {
+			continue
+		}
+
+		minSeries, minBytes := int64(i.limits.EarlyHeadCompactionMinInMemorySeries(userID)), int64(i.limits.EarlyHeadCompactionMinEstimatedHeadBytes(userID))
+		if (minSeries > 0 && c.series > minSeries) || (minBytes > 0 && c.bytes > minBytes) {
+			users[userID] = true
+			selectedSeries += c.series
+			selectedBytes += c.bytes
+			continue
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	var excessSeries, excessBytes int64
+	if cfg.EarlyHeadCompactionMinInMemorySeries > 0 {
+		excessSeries = totalSeries - cfg.EarlyHeadCompactionMinInMemorySeries - selectedSeries
+	}
+	if cfg.EarlyHeadCompactionMinEstimatedHeadBytes > 0 {
+		excessBytes = totalBytes - cfg.EarlyHeadCompactionMinEstimatedHeadBytes - selectedBytes
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].bytes > candidates[j].bytes
+	})
+	for _, c := range candidates {
+		if excessSeries <= 0 && excessBytes <= 0 {
+			break
+		}
+
+		users[c.userID] = true
+		excessSeries -= c.series
+		excessBytes -= c.bytes
+	}
+
+	return users
+}
+
+// compactHeadEarly compacts the samples of the user's TSDB head older than the configured age into a block,
+// removing from memory the series without more recent samples.
+func (i *Ingester) compactHeadEarly(userID string, userDB *userTSDB, now time.Time) error {
+	// The cooldown starts even if the compaction fails, so that a failing compaction isn't retried continuously.
+	userDB.lastEarlyCompaction.Store(now.Unix())
+	i.metrics.earlyCompactions.Inc()
+
+	until := now.Add(-i.cfg.BlocksStorageConfig.TSDB.EarlyHeadCompactionOlderThan).UnixMilli()
+	seriesBefore := userDB.Head().NumSeries()
+
+	level.Info(i.logger).Log("msg", "TSDB head exceeds the early compaction thresholds, compacting samples older than the configured age", "user", userID, "series", seriesBefore, "until", util.TimeFromMillis(until))
+	if err := userDB.compactHeadUntil(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds(), until); err != nil {
+		return err
+	}
+
+	if seriesAfter := userDB.Head().NumSeries(); seriesAfter < seriesBefore {
+		i.metrics.earlyCompactionSeries.Add(float64(seriesBefore - seriesAfter))
+	}
+	return nil
+}
+
 func (i *Ingester) closeAndDeleteIdleUserTSDBs(ctx context.Context) error {
 	for _, userID := range i.getTSDBUsers() {
 		if ctx.Err() != nil {
@@ -1950,6 +2216,7 @@ func (i *Ingester) closeAndDeleteUserTSDBIfIdle(userID string) tsdbCloseCheckRes
 	i.deleteUserMetadata(userID)
 	i.metrics.deletePerUserMetrics(userID)
 	i.metrics.deletePerUserCustomTrackerMetrics(userID, userDB.activeSeries.CurrentMatcherNames())
+	i.costAttribution.RemoveUser(userID)
 
 	validation.DeletePerUserValidationMetrics(userID, i.logger)
 
@@ -1968,9 +2235,13 @@ func (i *Ingester) closeAndDeleteUserTSDBIfIdle(userID string) tsdbCloseCheckRes
 	return tsdbIdleClosed
 }
 
-// TransferOut implements ring.FlushTransferer.
-func (i *Ingester) TransferOut(_ context.Context) error {
-	return ring.ErrTransferDisabled
+// TransferOut implements ring.FlushTransferer. When enabled, it hands the in-memory series off to the
+// ingesters taking over the tokens of this ingester, if it's unregistering from the ring.
+func (i *Ingester) TransferOut(ctx context.Context) error {
+	if !i.cfg.HandoffOnShutdownEnabled || !i.lifecycler.ShouldUnregisterOnShutdown() {
+		return ring.ErrTransferDisabled
+	}
+	return i.handoff(ctx)
 }
 
 // This method will flush all data. It is called as part of Lifecycler's shutdown (if flush on shutdown is configured), or from the flusher.
@@ -2146,6 +2417,89 @@ func (i *Ingester) ShutdownHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// PrepareReadOnlyHandler switches the ingester to read-only mode on POST requests, switches it back to
+// read-write mode on DELETE requests, and returns whether the ingester is in read-only mode. A read-only
+// ingester stays ACTIVE in the ring, but it's registered in the read-only ingesters of the KV store, so that
+// distributors don't send it writes anymore, while queriers keep querying it. The read-only mode is kept
+// across restarts.
+func (i *Ingester) PrepareReadOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := i.checkRunning(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && !i.readOnly.Load():
+		if state := i.lifecycler.GetState(); state != ring.ACTIVE {
+			http.Error(w, fmt.Sprintf("the ingester can't be switched to read-only mode in the %s state", state), http.StatusConflict)
+			return
+		}
+
+		if err := i.setReadOnlyRegistration(r.Context(), true); err != nil {
+			level.Error(i.logger).Log("msg", "failed to switch the ingester to read-only mode", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i.readOnly.Store(true)
+		level.Info(i.logger).Log("msg", "switched the ingester to read-only mode")
+
+	case r.Method == http.MethodDelete && i.readOnly.Load():
+		if err := i.setReadOnlyRegistration(r.Context(), false); err != nil {
+			level.Error(i.logger).Log("msg", "failed to switch the ingester to read-write mode", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i.readOnly.Store(false)
+		level.Info(i.logger).Log("msg", "switched the ingester to read-write mode")
+	}
+
+	util.WriteJSONResponse(w, map[string]bool{"read_only": i.readOnly.Load()})
+}
+
+// getReadOnlyRegistration returns whether the ingester is registered in the read-only ingesters of the KV store.
+func (i *Ingester) getReadOnlyRegistration(ctx context.Context) (bool, error) {
+	value, err := i.lifecycler.KVStore.Get(ctx, ReadOnlyRingKey)
+	if err != nil {
+		return false, err
+	}
+
+	desc, ok := value.(*ring.Desc)
+	return ok && isReadOnlyIngester(desc, i.lifecycler.ID), nil
+}
+
+// setReadOnlyRegistration registers the ingester in, or unregisters it from, the read-only ingesters of the KV store.
+func (i *Ingester) setReadOnlyRegistration(ctx context.Context, readOnly bool) error {
+	return i.lifecycler.KVStore.CAS(ctx, ReadOnlyRingKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		desc, ok := in.(*ring.Desc)
+		if !ok || desc == nil {
+			desc = ring.NewDesc()
+		}
+
+		if readOnly == isReadOnlyIngester(desc, i.lifecycler.ID) {
+			return nil, false, nil
+		}
+		if readOnly {
+			desc.AddIngester(i.lifecycler.ID, i.lifecycler.Addr, i.lifecycler.Zone, nil, ring.ACTIVE, time.Now())
+		} else {
+			desc.RemoveIngester(i.lifecycler.ID)
+		}
+		return desc, true, nil
+	})
+}
+
+// checkWritable returns an error if the ingester doesn't accept writes because it's in read-only mode.
+func (i *Ingester) checkWritable() error {
+	if i.readOnly.Load() {
+		return status.Error(codes.Unavailable, errReadOnly)
+	}
+	return nil
+}
+
+// CostAttributionHandler returns the samples ingested and discarded and the active series of the ingester, by cost attribution.
+func (i *Ingester) CostAttributionHandler(w http.ResponseWriter, r *http.Request) {
+	i.costAttribution.ServeHTTP(w, r)
+}
+
 // Using block store, the ingester is only available when it is in a Running state. The ingester is not available
 // when stopping to prevent any read or writes to the TSDB after the ingester has closed them.
 func (i *Ingester) checkRunning() error {
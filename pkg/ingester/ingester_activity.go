@@ -129,6 +129,15 @@ func (i *ActivityTrackerWrapper) LabelValuesCardinality(request *client.LabelVal
 	return i.ing.LabelValuesCardinality(request, server)
 }
 
+func (i *ActivityTrackerWrapper) TransferTSDBHead(stream client.Ingester_TransferTSDBHeadServer) error {
+	ix := i.tracker.Insert(func() string {
+		return requestActivity(stream.Context(), "Ingester/TransferTSDBHead", nil)
+	})
+	defer i.tracker.Delete(ix)
+
+	return i.ing.TransferTSDBHead(stream)
+}
+
 func (i *ActivityTrackerWrapper) FlushHandler(w http.ResponseWriter, r *http.Request) {
 	ix := i.tracker.Insert(func() string {
 		return requestActivity(r.Context(), "Ingester/FlushHandler", nil)
@@ -147,6 +156,24 @@ func (i *ActivityTrackerWrapper) ShutdownHandler(w http.ResponseWriter, r *http.
 	i.ing.ShutdownHandler(w, r)
 }
 
+func (i *ActivityTrackerWrapper) PrepareReadOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	ix := i.tracker.Insert(func() string {
+		return requestActivity(r.Context(), "Ingester/PrepareReadOnlyHandler", nil)
+	})
+	defer i.tracker.Delete(ix)
+
+	i.ing.PrepareReadOnlyHandler(w, r)
+}
+
+func (i *ActivityTrackerWrapper) CostAttributionHandler(w http.ResponseWriter, r *http.Request) {
+	ix := i.tracker.Insert(func() string {
+		return requestActivity(r.Context(), "Ingester/CostAttributionHandler", nil)
+	})
+	defer i.tracker.Delete(ix)
+
+	i.ing.CostAttributionHandler(w, r)
+}
+
 func requestActivity(ctx context.Context, name string, req interface{}) string {
 	userID, _ := tenant.TenantID(ctx)
 	traceID, _ := tracing.ExtractSampledTraceID(ctx)
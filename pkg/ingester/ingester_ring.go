@@ -3,8 +3,10 @@
 package ingester
 
 import (
+	"context"
 	"flag"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -13,14 +15,26 @@ import (
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/netutil"
 	"github.com/grafana/dskit/ring"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	// sharedOptionWithRingClient is a message appended to all config options that should be also
 	// set on the components running the ingester ring client.
 	sharedOptionWithRingClient = " This option needs be set on ingesters, distributors, queriers and rulers when running in microservices mode."
+
+	// ReadOnlyRingKey is the key, in the KV store of the ingesters ring, of the ingesters in read-only mode.
+	ReadOnlyRingKey = "ingester-read-only"
 )
 
+// WriteOp is the ring operation to write to ingesters. The read-only ingesters, which the rings created
+// with NewRing report in the PENDING state, don't receive writes and the replica set is extended to the
+// next ingester, so that the write replication isn't lowered, while ring.Read still includes them.
+// Unlike ring.Write, the replica set isn't extended for ingesters LEAVING the ring, which are restarting.
+var WriteOp = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, func(s ring.InstanceState) bool {
+	return s == ring.PENDING
+})
+
 type RingConfig struct {
 	KVStore              kv.Config              `yaml:"kvstore" doc:"description=The key-value store used to share the hash ring across multiple instances. This option needs be set on ingesters, distributors, queriers and rulers when running in microservices mode."`
 	HeartbeatPeriod      time.Duration          `yaml:"heartbeat_period" category:"advanced"`
@@ -141,3 +155,114 @@ func (cfg *RingConfig) ToLifecyclerConfig() ring.LifecyclerConfig {
 
 	return lc
 }
+
+// NewRing returns a client of the ingesters ring which reports the ACTIVE ingesters in read-only mode
+// in the PENDING state, to be used with WriteOp.
+func NewRing(cfg RingConfig, logger log.Logger, reg prometheus.Registerer) (*ring.Ring, error) {
+	store, err := kv.NewClient(cfg.KVStore, ring.GetCodec(), kv.RegistererWithKVName(reg, "ingester-ring"), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return ring.NewWithStoreClientAndStrategy(cfg.ToRingConfig(), "ingester", IngesterRingKey, readOnlyRingKVClient{store}, ring.NewDefaultReplicationStrategy(), reg, logger)
+}
+
+// readOnlyRingKVClient is a kv.Client which merges the ingesters in read-only mode into the ingesters ring.
+type readOnlyRingKVClient struct {
+	kv.Client
+}
+
+// Get implements kv.Client.
+func (c readOnlyRingKVClient) Get(ctx context.Context, key string) (interface{}, error) {
+	value, err := c.Client.Get(ctx, key)
+	if err != nil || key != IngesterRingKey {
+		return value, err
+	}
+
+	readOnly, err := c.Client.Get(ctx, ReadOnlyRingKey)
+	if err != nil {
+		return nil, err
+	}
+	return withReadOnlyIngesters(value, readOnly), nil
+}
+
+// WatchKey implements kv.Client. Changes to the ingesters in read-only mode are notified as changes to the ring.
+func (c readOnlyRingKVClient) WatchKey(ctx context.Context, key string, f func(interface{}) bool) {
+	if key != IngesterRingKey {
+		c.Client.WatchKey(ctx, key, f)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mtx       sync.Mutex
+		ringValue interface{}
+		readOnly  interface{}
+	)
+	update := func(set func()) bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		set()
+		if ringValue == nil {
+			return true
+		}
+		if !f(withReadOnlyIngesters(ringValue, readOnly)) {
+			cancel()
+			return false
+		}
+		return true
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.Client.WatchKey(ctx, ReadOnlyRingKey, func(value interface{}) bool {
+			return update(func() { readOnly = value })
+		})
+	}()
+
+	c.Client.WatchKey(ctx, key, func(value interface{}) bool {
+		return update(func() { ringValue = value })
+	})
+
+	cancel()
+	wg.Wait()
+}
+
+// withReadOnlyIngesters returns a copy of the ring where the ACTIVE ingesters in read-only mode are in the PENDING state.
+func withReadOnlyIngesters(value, readOnlyValue interface{}) interface{} {
+	desc, _ := value.(*ring.Desc)
+	readOnly, _ := readOnlyValue.(*ring.Desc)
+	if desc == nil || readOnly == nil {
+		return value
+	}
+
+	var merged *ring.Desc
+	for id, instance := range desc.Ingesters {
+		if instance.State != ring.ACTIVE || !isReadOnlyIngester(readOnly, id) {
+			continue
+		}
+
+		if merged == nil {
+			merged = desc.Clone().(*ring.Desc)
+		}
+		instance.State = ring.PENDING
+		merged.Ingesters[id] = instance
+	}
+
+	if merged == nil {
+		return value
+	}
+	return merged
+}
+
+// isReadOnlyIngester returns whether the ingester is registered in read-only mode. Ingesters which left
+// the read-only mode may be kept in the LEFT state by the memberlist KV store.
+func isReadOnlyIngester(readOnly *ring.Desc, id string) bool {
+	instance, ok := readOnly.Ingesters[id]
+	return ok && instance.State == ring.ACTIVE
+}
@@ -3,12 +3,19 @@
 package ingester
 
 import (
+	"context"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/kv/consul"
 	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRingConfig_DefaultConfigToLifecyclerConfig(t *testing.T) {
@@ -86,3 +93,56 @@ func TestRingConfig_CustomConfigToLifecyclerConfig(t *testing.T) {
 
 	assert.Equal(t, expected, cfg.ToLifecyclerConfig())
 }
+
+func TestNewRing_ReadOnlyIngesters(t *testing.T) {
+	ctx := context.Background()
+	store, closer := consul.NewInMemoryClient(ring.GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	desc := ring.NewDesc()
+	for id, token := range map[string]uint32{"ingester-1": 10, "ingester-2": 20, "ingester-3": 30, "ingester-4": 40} {
+		desc.AddIngester(id, id, "", []uint32{token}, ring.ACTIVE, time.Now())
+	}
+	require.NoError(t, store.CAS(ctx, IngesterRingKey, func(interface{}) (interface{}, bool, error) {
+		return desc, true, nil
+	}))
+
+	readOnly := ring.NewDesc()
+	readOnly.AddIngester("ingester-1", "ingester-1", "", nil, ring.ACTIVE, time.Now())
+	require.NoError(t, store.CAS(ctx, ReadOnlyRingKey, func(interface{}) (interface{}, bool, error) {
+		return readOnly, true, nil
+	}))
+
+	cfg := RingConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.ReplicationFactor = 3
+	cfg.KVStore.Mock = store
+
+	r, err := NewRing(cfg, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, r))
+	t.Cleanup(func() { assert.NoError(t, services.StopAndAwaitTerminated(ctx, r)) })
+
+	instances := func(op ring.Operation) []string {
+		set, err := r.Get(5, op, nil, nil, nil)
+		require.NoError(t, err)
+
+		addrs := set.GetAddresses()
+		sort.Strings(addrs)
+		return addrs
+	}
+
+	// The read-only ingester doesn't receive writes, and the replica set is extended to the next ingester.
+	assert.Equal(t, []string{"ingester-2", "ingester-3", "ingester-4"}, instances(WriteOp))
+	assert.Equal(t, []string{"ingester-1", "ingester-2", "ingester-3", "ingester-4"}, instances(ring.Read))
+
+	// Once the ingester leaves the read-only mode, it receives writes again.
+	require.NoError(t, store.CAS(ctx, ReadOnlyRingKey, func(in interface{}) (interface{}, bool, error) {
+		desc := in.(*ring.Desc)
+		desc.RemoveIngester("ingester-1")
+		return desc, true, nil
+	}))
+	test.Poll(t, time.Second, []string{"ingester-1", "ingester-2", "ingester-3"}, func() interface{} {
+		return instances(WriteOp)
+	})
+}
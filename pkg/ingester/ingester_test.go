@@ -3710,6 +3710,222 @@ func TestIngester_ForFlush(t *testing.T) {
 	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
 }
 
+func TestIngester_PushOutOfOrderSamples(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	limits := defaultLimitsTestConfig()
+	limits.OutOfOrderTimeWindow = model.Duration(time.Minute)
+
+	reg := prometheus.NewPedanticRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// Wait until it's healthy
+	test.Poll(t, 1*time.Second, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	metricLabels := labels.FromStrings(labels.MetricName, "test")
+	metricLabelAdapters := mimirpb.FromLabelsToLabelAdapters(metricLabels)
+	now := time.Now().UnixMilli()
+
+	push := func(value float64, ts int64) error {
+		_, err := i.Push(ctx, mimirpb.ToWriteRequest([]labels.Labels{metricLabels}, []mimirpb.Sample{{Value: value, TimestampMs: ts}}, nil, nil, mimirpb.API))
+		return err
+	}
+
+	require.NoError(t, push(1, now))
+
+	// Out-of-order sample within the window.
+	require.NoError(t, push(2, now-30000))
+
+	// Same out-of-order sample with a different value.
+	assert.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(newIngestErrSampleDuplicateTimestamp(model.Time(now-30000), metricLabelAdapters), userID).Error()), push(3, now-30000))
+
+	// Out-of-order sample outside the window.
+	assert.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(newIngestErrSampleOutOfOrder(model.Time(now-120000), metricLabelAdapters), userID).Error()), push(4, now-120000))
+
+	expected := model.Matrix{&model.SampleStream{
+		Metric: util.LabelsToMetric(metricLabels),
+		Values: []model.SamplePair{{Value: 2, Timestamp: model.Time(now - 30000)}, {Value: 1, Timestamp: model.Time(now)}},
+	}}
+
+	res, _, err := runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "test")
+	require.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	// Out-of-order samples should be flushed to a block, and still be queryable, after the head compaction.
+	i.compactBlocks(context.Background(), true, nil)
+
+	db := i.getTSDB(userID)
+	require.NotNil(t, db)
+	assert.Equal(t, uint64(0), db.Head().NumSeries())
+	assert.Equal(t, 0, db.oooHead.numSamples)
+
+	res, _, err = runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "test")
+	require.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ingester_ingested_out_of_order_samples_total The total number of out-of-order samples ingested successfully per user.
+		# TYPE cortex_ingester_ingested_out_of_order_samples_total counter
+		cortex_ingester_ingested_out_of_order_samples_total{user="1"} 1
+		# HELP cortex_ingester_ingested_samples_total The total number of samples ingested per user.
+		# TYPE cortex_ingester_ingested_samples_total counter
+		cortex_ingester_ingested_samples_total{user="1"} 2
+		# HELP cortex_ingester_ingested_samples_failures_total The total number of samples that errored on ingestion per user.
+		# TYPE cortex_ingester_ingested_samples_failures_total counter
+		cortex_ingester_ingested_samples_failures_total{user="1"} 2
+	`), "cortex_ingester_ingested_out_of_order_samples_total", "cortex_ingester_ingested_samples_total", "cortex_ingester_ingested_samples_failures_total"))
+}
+
+func TestIngester_PushOutOfOrderSamplesWithWindowChangedAtRuntime(t *testing.T) {
+	for _, allowOverlappingQueries := range []bool{true, false} {
+		t.Run(fmt.Sprintf("allow overlapping queries: %t", allowOverlappingQueries), func(t *testing.T) {
+			testIngesterPushOutOfOrderSamplesWithWindowChangedAtRuntime(t, allowOverlappingQueries)
+		})
+	}
+}
+
+func testIngesterPushOutOfOrderSamplesWithWindowChangedAtRuntime(t *testing.T, allowOverlappingQueries bool) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.AllowOverlappingQueries = allowOverlappingQueries
+	limits := defaultLimitsTestConfig()
+	tenantLimits := defaultLimitsTestConfig()
+
+	tenantLimitsMock := new(TenantLimitsMock)
+	tenantLimitsMock.On("ByUserID", userID).Return(&tenantLimits)
+	overrides, err := validation.NewOverrides(limits, tenantLimitsMock)
+	require.NoError(t, err)
+
+	i, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// Wait until it's healthy
+	test.Poll(t, 1*time.Second, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	metricLabels := labels.FromStrings(labels.MetricName, "test")
+	metricLabelAdapters := mimirpb.FromLabelsToLabelAdapters(metricLabels)
+	now := time.Now().UnixMilli()
+
+	push := func(value float64, ts int64) error {
+		_, err := i.Push(ctx, mimirpb.ToWriteRequest([]labels.Labels{metricLabels}, []mimirpb.Sample{{Value: value, TimestampMs: ts}}, nil, nil, mimirpb.API))
+		return err
+	}
+
+	// The TSDB is created while the out-of-order ingestion is disabled.
+	require.NoError(t, push(1, now))
+	assert.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(newIngestErrSampleOutOfOrder(model.Time(now-30000), metricLabelAdapters), userID).Error()), push(2, now-30000))
+
+	// Enabling the out-of-order ingestion should take effect without recreating the TSDB, but only
+	// if the TSDB allows the overlapping blocks the out-of-order samples are flushed to.
+	tenantLimits.OutOfOrderTimeWindow = model.Duration(time.Minute)
+	if !allowOverlappingQueries {
+		assert.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(newIngestErrSampleOutOfOrder(model.Time(now-30000), metricLabelAdapters), userID).Error()), push(2, now-30000))
+		return
+	}
+	require.NoError(t, push(2, now-30000))
+
+	// Disabling it again should reject out-of-order samples.
+	tenantLimits.OutOfOrderTimeWindow = 0
+	assert.Equal(t, httpgrpc.Errorf(http.StatusBadRequest, wrapWithUser(newIngestErrSampleOutOfOrder(model.Time(now-20000), metricLabelAdapters), userID).Error()), push(3, now-20000))
+
+	expected := model.Matrix{&model.SampleStream{
+		Metric: util.LabelsToMetric(metricLabels),
+		Values: []model.SamplePair{{Value: 2, Timestamp: model.Time(now - 30000)}, {Value: 1, Timestamp: model.Time(now)}},
+	}}
+
+	res, _, err := runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "test")
+	require.NoError(t, err)
+	assert.Equal(t, expected, res)
+}
+
+func TestIngester_PushHASampleDeduplication(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	limits := defaultLimitsTestConfig()
+	limits.HASampleDeduplicationEnabled = true
+	limits.OutOfOrderTimeWindow = model.Duration(time.Minute)
+
+	reg := prometheus.NewPedanticRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// Wait until it's healthy
+	test.Poll(t, 1*time.Second, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	metricLabels := labels.FromStrings(labels.MetricName, "test")
+	now := time.Now().Truncate(time.Minute).UnixMilli()
+
+	push := func(value float64, ts int64) {
+		_, err := i.Push(ctx, mimirpb.ToWriteRequest([]labels.Labels{metricLabels}, []mimirpb.Sample{{Value: value, TimestampMs: ts}}, nil, nil, mimirpb.API))
+		require.NoError(t, err)
+	}
+
+	// Two replicas scrape every 15s with the same timestamps. The first replica misses the scrape at 45s.
+	push(1, now)       // First replica.
+	push(2, now)       // Second replica, duplicate.
+	push(1, now+15000) // First replica.
+	push(2, now+15000) // Second replica, duplicate.
+	push(1, now+30000) // First replica.
+	push(2, now+30000) // Second replica, duplicate.
+	push(2, now+45000) // Second replica, filling the gap of the first replica.
+	push(1, now+60000) // First replica.
+	push(2, now+60000) // Second replica, duplicate.
+	push(3, now+65000) // Different timestamp, ingested.
+	push(3, now+50000) // Out-of-order sample, ingested.
+	push(4, now+50000) // Same timestamp as the out-of-order sample, duplicate.
+
+	expected := model.Matrix{&model.SampleStream{
+		Metric: util.LabelsToMetric(metricLabels),
+		Values: []model.SamplePair{
+			{Value: 1, Timestamp: model.Time(now)},
+			{Value: 1, Timestamp: model.Time(now + 15000)},
+			{Value: 1, Timestamp: model.Time(now + 30000)},
+			{Value: 2, Timestamp: model.Time(now + 45000)},
+			{Value: 3, Timestamp: model.Time(now + 50000)},
+			{Value: 1, Timestamp: model.Time(now + 60000)},
+			{Value: 3, Timestamp: model.Time(now + 65000)},
+		},
+	}}
+
+	res, _, err := runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "test")
+	require.NoError(t, err)
+	assert.Equal(t, expected, res)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ingester_ha_deduplicated_samples_total The total number of samples received from HA replicas discarded as duplicates per user.
+		# TYPE cortex_ingester_ha_deduplicated_samples_total counter
+		cortex_ingester_ha_deduplicated_samples_total{user="1"} 5
+		# HELP cortex_ingester_ingested_out_of_order_samples_total The total number of out-of-order samples ingested successfully per user.
+		# TYPE cortex_ingester_ingested_out_of_order_samples_total counter
+		cortex_ingester_ingested_out_of_order_samples_total{user="1"} 1
+		# HELP cortex_ingester_ingested_samples_total The total number of samples ingested per user.
+		# TYPE cortex_ingester_ingested_samples_total counter
+		cortex_ingester_ingested_samples_total{user="1"} 7
+		# HELP cortex_ingester_ingested_samples_failures_total The total number of samples that errored on ingestion per user.
+		# TYPE cortex_ingester_ingested_samples_failures_total counter
+		cortex_ingester_ingested_samples_failures_total{user="1"} 0
+	`), "cortex_ingester_ha_deduplicated_samples_total", "cortex_ingester_ingested_out_of_order_samples_total", "cortex_ingester_ingested_samples_total", "cortex_ingester_ingested_samples_failures_total"))
+}
+
 func mockUserShipper(t *testing.T, i *Ingester) *uploaderMock {
 	m := &uploaderMock{}
 	userDB, err := i.getOrCreateTSDB(userID, false)
@@ -4029,6 +4245,111 @@ func TestIngesterCompactAndCloseIdleTSDB(t *testing.T) {
     `), metricsToCheck...))
 }
 
+func TestIngesterCompactHeadEarly(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.HeadCompactionInterval = 1 * time.Hour // Long enough to not be reached during the test.
+	cfg.BlocksStorageConfig.TSDB.EarlyHeadCompactionOlderThan = 10 * time.Minute
+	cfg.BlocksStorageConfig.TSDB.EarlyHeadCompactionCooldown = 1 * time.Hour
+
+	limits := defaultLimitsTestConfig()
+	limits.EarlyHeadCompactionMinInMemorySeries = 2
+
+	r := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", r)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	test.Poll(t, 1*time.Second, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	now := time.Now()
+	push := func(name string, ts time.Time) {
+		req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, name), 1, util.TimeToMillis(ts))
+		_, err := i.Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	push("inactive", now.Add(-30*time.Minute))
+	push("active", now.Add(-30*time.Minute))
+	push("active", now)
+	push("new", now)
+
+	// The tenant exceeds the in-memory series threshold, so the head is compacted early and
+	// the series without samples in the last 10 minutes are removed from memory.
+	i.compactBlocks(context.Background(), false, nil)
+
+	db := i.getTSDB(userID)
+	require.NotNil(t, db)
+	assert.Equal(t, uint64(2), db.Head().NumSeries())
+	assert.Len(t, db.Blocks(), 1)
+
+	// The compacted samples are still queried.
+	res, _, err := runTestQuery(ctx, t, i, labels.MatchRegexp, labels.MetricName, ".+")
+	require.NoError(t, err)
+	numSamples := map[string]int{}
+	for _, series := range res {
+		numSamples[series.Metric.String()] = len(series.Values)
+	}
+	assert.Equal(t, map[string]int{"inactive": 1, "active": 2, "new": 1}, numSamples)
+
+	// The tenant exceeds the threshold again, but it was compacted early during the cooldown period.
+	push("another", now)
+	i.compactBlocks(context.Background(), false, nil)
+	assert.Equal(t, uint64(3), db.Head().NumSeries())
+
+	require.NoError(t, testutil.GatherAndCompare(r, strings.NewReader(`
+		# HELP cortex_ingester_tsdb_early_compactions_total Total number of TSDB head compactions triggered early because of the number of in-memory series or the estimated head size.
+		# TYPE cortex_ingester_tsdb_early_compactions_total counter
+		cortex_ingester_tsdb_early_compactions_total 1
+
+		# HELP cortex_ingester_tsdb_early_compaction_removed_series_total Total number of in-memory series removed from the TSDB head by early compactions.
+		# TYPE cortex_ingester_tsdb_early_compaction_removed_series_total counter
+		cortex_ingester_tsdb_early_compaction_removed_series_total 1
+	`), "cortex_ingester_tsdb_early_compactions_total", "cortex_ingester_tsdb_early_compaction_removed_series_total"))
+}
+
+func TestIngester_EarlyCompactionUsers(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.HeadCompactionInterval = 1 * time.Hour // Long enough to not be reached during the test.
+	cfg.BlocksStorageConfig.TSDB.EarlyHeadCompactionMinInMemorySeries = 4
+	cfg.BlocksStorageConfig.TSDB.EarlyHeadCompactionCooldown = 1 * time.Hour
+
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	now := time.Now()
+	for _, tenant := range []struct {
+		userID string
+		series int
+	}{{"small", 1}, {"medium", 2}, {"large", 3}} {
+		ctx := user.InjectOrgID(context.Background(), tenant.userID)
+		for s := 0; s < tenant.series; s++ {
+			req, _, _, _ := mockWriteRequest(t, labels.FromStrings(labels.MetricName, "test", "series", strconv.Itoa(s)), 1, util.TimeToMillis(now))
+			_, err := i.Push(ctx, req)
+			require.NoError(t, err)
+		}
+	}
+
+	// The ingester exceeds the threshold by 2 series, so only the biggest tenant is picked.
+	assert.Equal(t, map[string]bool{"large": true}, i.earlyCompactionUsers(now))
+
+	// The biggest tenant has been compacted early recently, so the next biggest one is picked.
+	i.getTSDB("large").lastEarlyCompaction.Store(now.Unix())
+	assert.Equal(t, map[string]bool{"medium": true}, i.earlyCompactionUsers(now))
+
+	// Once the cooldown is over, the biggest tenant is picked again.
+	assert.Equal(t, map[string]bool{"large": true}, i.earlyCompactionUsers(now.Add(time.Hour)))
+}
+
 func verifyCompactedHead(t *testing.T, i *Ingester, expected bool) {
 	db := i.getTSDB(userID)
 	require.NotNil(t, db)
@@ -14,14 +14,18 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/status"
 	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/kv/consul"
 	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/services"
 	"github.com/grafana/dskit/test"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"google.golang.org/grpc/codes"
 
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -130,6 +134,102 @@ func TestIngester_ShutdownHandler(t *testing.T) {
 	}
 }
 
+func TestIngester_PrepareReadOnlyHandler(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	ing, err := prepareIngesterWithBlocksStorage(t, cfg, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	test.Poll(t, time.Second, ring.ACTIVE, func() interface{} {
+		return ing.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	series := labels.FromStrings(labels.MetricName, "test")
+	req, _, _, _ := mockWriteRequest(t, series, 1, 1000)
+	_, err = ing.Push(ctx, req)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	ing.PrepareReadOnlyHandler(recorder, httptest.NewRequest(http.MethodGet, "/ingester/prepare-read-only", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"read_only": false}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	ing.PrepareReadOnlyHandler(recorder, httptest.NewRequest(http.MethodPost, "/ingester/prepare-read-only", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"read_only": true}`, recorder.Body.String())
+
+	// The ingester stays ACTIVE in the ring, and it's registered in the read-only ingesters, so that
+	// distributors stop sending it writes.
+	desc, err := cfg.IngesterRing.KVStore.Mock.Get(context.Background(), IngesterRingKey)
+	require.NoError(t, err)
+	assert.Equal(t, ring.ACTIVE, desc.(*ring.Desc).Ingesters["localhost"].State)
+
+	desc, err = readOnlyRingKVClient{cfg.IngesterRing.KVStore.Mock}.Get(context.Background(), IngesterRingKey)
+	require.NoError(t, err)
+	assert.Equal(t, ring.PENDING, desc.(*ring.Desc).Ingesters["localhost"].State)
+
+	// Writes are rejected, while the ingester can still be queried.
+	req, _, _, _ = mockWriteRequest(t, series, 2, 2000)
+	_, err = ing.Push(ctx, req)
+	require.Error(t, err)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	res, _, err := runTestQuery(ctx, t, ing, labels.MatchEqual, labels.MetricName, "test")
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Len(t, res[0].Values, 1)
+
+	// Switching to read-only mode again is a no-op.
+	recorder = httptest.NewRecorder()
+	ing.PrepareReadOnlyHandler(recorder, httptest.NewRequest(http.MethodPost, "/ingester/prepare-read-only", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"read_only": true}`, recorder.Body.String())
+
+	// Switching back to read-write mode accepts writes again.
+	recorder = httptest.NewRecorder()
+	ing.PrepareReadOnlyHandler(recorder, httptest.NewRequest(http.MethodDelete, "/ingester/prepare-read-only", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"read_only": false}`, recorder.Body.String())
+
+	desc, err = readOnlyRingKVClient{cfg.IngesterRing.KVStore.Mock}.Get(context.Background(), IngesterRingKey)
+	require.NoError(t, err)
+	assert.Equal(t, ring.ACTIVE, desc.(*ring.Desc).Ingesters["localhost"].State)
+
+	_, err = ing.Push(ctx, req)
+	require.NoError(t, err)
+}
+
+func TestIngester_ReadOnlyModeIsKeptAcrossRestarts(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.IngesterRing.UnregisterOnShutdown = false
+
+	ing, err := prepareIngesterWithBlocksStorage(t, cfg, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+
+	test.Poll(t, time.Second, ring.ACTIVE, func() interface{} {
+		return ing.lifecycler.GetState()
+	})
+
+	recorder := httptest.NewRecorder()
+	ing.PrepareReadOnlyHandler(recorder, httptest.NewRequest(http.MethodPost, "/ingester/prepare-read-only", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), ing))
+
+	ing, err = prepareIngesterWithBlocksStorage(t, cfg, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	recorder = httptest.NewRecorder()
+	ing.PrepareReadOnlyHandler(recorder, httptest.NewRequest(http.MethodGet, "/ingester/prepare-read-only", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"read_only": true}`, recorder.Body.String())
+}
+
 // numTokens determines the number of tokens owned by the specified
 // address
 func numTokens(c kv.Client, name, ringKey string) int {
@@ -15,20 +15,22 @@ import (
 )
 
 type ingesterMetrics struct {
-	ingestedSamples         *prometheus.CounterVec
-	ingestedExemplars       prometheus.Counter
-	ingestedMetadata        prometheus.Counter
-	ingestedSamplesFail     *prometheus.CounterVec
-	ingestedExemplarsFail   prometheus.Counter
-	ingestedMetadataFail    prometheus.Counter
-	queries                 prometheus.Counter
-	queriedSamples          prometheus.Histogram
-	queriedExemplars        prometheus.Histogram
-	queriedSeries           prometheus.Histogram
-	memMetadata             prometheus.Gauge
-	memUsers                prometheus.Gauge
-	memMetadataCreatedTotal *prometheus.CounterVec
-	memMetadataRemovedTotal *prometheus.CounterVec
+	ingestedSamples           *prometheus.CounterVec
+	ingestedExemplars         prometheus.Counter
+	ingestedMetadata          prometheus.Counter
+	ingestedSamplesFail       *prometheus.CounterVec
+	ingestedOutOfOrderSamples *prometheus.CounterVec
+	haDedupedSamples          *prometheus.CounterVec
+	ingestedExemplarsFail     prometheus.Counter
+	ingestedMetadataFail      prometheus.Counter
+	queries                   prometheus.Counter
+	queriedSamples            prometheus.Histogram
+	queriedExemplars          prometheus.Histogram
+	queriedSeries             prometheus.Histogram
+	memMetadata               prometheus.Gauge
+	memUsers                  prometheus.Gauge
+	memMetadataCreatedTotal   *prometheus.CounterVec
+	memMetadataRemovedTotal   *prometheus.CounterVec
 
 	activeSeriesLoading               *prometheus.GaugeVec
 	activeSeriesPerUser               *prometheus.GaugeVec
@@ -45,10 +47,16 @@ type ingesterMetrics struct {
 	// Head compactions metrics.
 	compactionsTriggered   prometheus.Counter
 	compactionsFailed      prometheus.Counter
+	earlyCompactions       prometheus.Counter
+	earlyCompactionSeries  prometheus.Counter
 	walReplayTime          prometheus.Histogram
 	appenderAddDuration    prometheus.Histogram
 	appenderCommitDuration prometheus.Histogram
 	idleTsdbChecks         *prometheus.CounterVec
+
+	// Handoff metrics.
+	handoffSentSeries      prometheus.Counter
+	handoffReceivedSamples prometheus.Counter
 }
 
 func newIngesterMetrics(
@@ -97,6 +105,14 @@ func newIngesterMetrics(
 			Name: "cortex_ingester_ingested_samples_failures_total",
 			Help: "The total number of samples that errored on ingestion per user.",
 		}, []string{"user"}),
+		ingestedOutOfOrderSamples: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_ingested_out_of_order_samples_total",
+			Help: "The total number of out-of-order samples ingested successfully per user.",
+		}, []string{"user"}),
+		haDedupedSamples: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_ha_deduplicated_samples_total",
+			Help: "The total number of samples received from HA replicas discarded as duplicates per user.",
+		}, []string{"user"}),
 		ingestedExemplarsFail: promauto.With(r).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_ingester_ingested_exemplars_failures_total",
 			Help: "The total number of exemplars that errored on ingestion.",
@@ -235,6 +251,14 @@ func newIngesterMetrics(
 			Name: "cortex_ingester_tsdb_compactions_failed_total",
 			Help: "Total number of compactions that failed.",
 		}),
+		earlyCompactions: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_tsdb_early_compactions_total",
+			Help: "Total number of TSDB head compactions triggered early because of the number of in-memory series or the estimated head size.",
+		}),
+		earlyCompactionSeries: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_tsdb_early_compaction_removed_series_total",
+			Help: "Total number of in-memory series removed from the TSDB head by early compactions.",
+		}),
 		walReplayTime: promauto.With(r).NewHistogram(prometheus.HistogramOpts{
 			Name:    "cortex_ingester_tsdb_wal_replay_duration_seconds",
 			Help:    "The total time it takes to open and replay a TSDB WAL.",
@@ -252,6 +276,15 @@ func newIngesterMetrics(
 		}),
 
 		idleTsdbChecks: idleTsdbChecks,
+
+		handoffSentSeries: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_handoff_sent_series_total",
+			Help: "The total number of in-memory series sent to other ingesters on shutdown. A series sent to multiple ingesters is counted once per ingester.",
+		}),
+		handoffReceivedSamples: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_handoff_received_samples_total",
+			Help: "The total number of samples ingested from the in-memory series received from ingesters leaving the ring.",
+		}),
 	}
 
 	if activeSeriesEnabled && r != nil {
@@ -266,6 +299,8 @@ func newIngesterMetrics(
 func (m *ingesterMetrics) deletePerUserMetrics(userID string) {
 	m.ingestedSamples.DeleteLabelValues(userID)
 	m.ingestedSamplesFail.DeleteLabelValues(userID)
+	m.ingestedOutOfOrderSamples.DeleteLabelValues(userID)
+	m.haDedupedSamples.DeleteLabelValues(userID)
 	m.memMetadataCreatedTotal.DeleteLabelValues(userID)
 	m.memMetadataRemovedTotal.DeleteLabelValues(userID)
 }
@@ -0,0 +1,805 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/prometheus/prometheus/tsdb/wal"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// oooWALDirName is the name of the directory, inside the tenant's TSDB directory,
+// where the WAL of the out-of-order head is stored.
+const oooWALDirName = "ooo_wal"
+
+// oooHead keeps in memory the samples which have been rejected by the TSDB head because
+// out-of-order or too old, but that are within the tenant's out-of-order time window.
+// Samples are persisted in a dedicated WAL, created when the first sample is appended, and they're
+// periodically flushed to blocks in the tenant's TSDB directory once the TSDB head can't accept samples
+// in their time range anymore. Flushed blocks are then shipped like any other block.
+type oooHead struct {
+	dir            string
+	logger         log.Logger
+	walSegmentSize int
+	walCompression bool
+
+	mtx        sync.RWMutex
+	wal        *wal.WAL                // Nil until the first sample is appended, unless the WAL already exists.
+	series     map[uint64][]*oooSeries // Series by labels hash.
+	postings   oooPostings
+	lastRef    chunks.HeadSeriesRef
+	numSamples int
+
+	// Blocks which have been flushed but not loaded by the TSDB yet. They're queried
+	// together with the in-memory samples, until released.
+	pendingBlocks []*tsdb.Block
+
+	// Function used to write flushed samples to a block. Used only for testing.
+	writeBlockFn func(ctx context.Context, blockRange int64, series []oooBlockSeries) (*tsdb.Block, error)
+}
+
+type oooSeries struct {
+	ref     chunks.HeadSeriesRef
+	hash    uint64
+	lset    labels.Labels
+	samples []oooSample // Sorted by timestamp.
+}
+
+// oooSeriesSamples holds out-of-order samples to append to a series.
+type oooSeriesSamples struct {
+	lset    labels.Labels
+	samples []mimirpb.Sample
+}
+
+// oooBlockSeries holds the samples of a series to write to a block.
+type oooBlockSeries struct {
+	lset    labels.Labels
+	samples []oooSample
+}
+
+type oooSample struct {
+	t int64
+	v float64
+}
+
+func (s oooSample) T() int64   { return s.t }
+func (s oooSample) V() float64 { return s.v }
+
+// openOOOHead opens the out-of-order head for the TSDB stored in dir, replaying its WAL if any.
+func openOOOHead(logger log.Logger, dir string, walSegmentSize int, walCompression bool) (*oooHead, error) {
+	h := &oooHead{
+		dir:            dir,
+		logger:         logger,
+		walSegmentSize: walSegmentSize,
+		walCompression: walCompression,
+		series:         map[uint64][]*oooSeries{},
+		postings:       oooPostings{},
+	}
+	h.writeBlockFn = h.writeBlock
+
+	// The WAL is only opened if it exists, so that no WAL is created for tenants which
+	// never ingest out-of-order samples.
+	if !hasOOOWAL(dir) {
+		return h, nil
+	}
+	if err := h.openWAL(); err != nil {
+		return nil, err
+	}
+
+	if err := h.replayWAL(); err != nil {
+		var cerr *wal.CorruptionErr
+		if !errors.As(err, &cerr) {
+			_ = h.wal.Close()
+			return nil, errors.Wrap(err, "replay out-of-order WAL")
+		}
+
+		level.Warn(logger).Log("msg", "out-of-order WAL is corrupted, repairing it", "err", err)
+		if err := h.wal.Repair(err); err != nil {
+			_ = h.wal.Close()
+			return nil, errors.Wrap(err, "repair out-of-order WAL")
+		}
+	}
+
+	return h, nil
+}
+
+// openWAL opens the WAL, creating it if it doesn't exist.
+func (h *oooHead) openWAL() error {
+	// The WAL metrics are not registered because they would clash with the TSDB ones.
+	w, err := wal.NewSize(h.logger, nil, filepath.Join(h.dir, oooWALDirName), h.walSegmentSize, h.walCompression)
+	if err != nil {
+		return errors.Wrap(err, "open out-of-order WAL")
+	}
+	h.wal = w
+	return nil
+}
+
+// hasOOOWAL returns whether the TSDB stored in dir has an out-of-order WAL.
+func hasOOOWAL(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, oooWALDirName))
+	return err == nil
+}
+
+func (h *oooHead) replayWAL() error {
+	sr, err := wal.NewSegmentsReader(h.wal.Dir())
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	var (
+		r       = wal.NewReader(sr)
+		dec     record.Decoder
+		series  []record.RefSeries
+		samples []record.RefSample
+		refs    = map[chunks.HeadSeriesRef]*oooSeries{}
+	)
+
+	for r.Next() {
+		rec := r.Record()
+
+		switch dec.Type(rec) {
+		case record.Series:
+			series, err = dec.Series(rec, series[:0])
+			if err != nil {
+				return &wal.CorruptionErr{Err: err, Segment: r.Segment(), Offset: r.Offset()}
+			}
+			for _, s := range series {
+				refs[s.Ref] = h.getOrCreateSeries(s.Ref, s.Labels)
+			}
+
+		case record.Samples:
+			samples, err = dec.Samples(rec, samples[:0])
+			if err != nil {
+				return &wal.CorruptionErr{Err: err, Segment: r.Segment(), Offset: r.Offset()}
+			}
+			for _, s := range samples {
+				series, ok := refs[s.Ref]
+				if !ok {
+					continue
+				}
+				if series.insert(s.T, s.V) {
+					h.numSamples++
+				}
+			}
+		}
+	}
+
+	return r.Err()
+}
+
+// getOrCreateSeries returns the series for the input labels, creating it with the input reference
+// if it doesn't exist. The input labels are retained. Must be called with the lock held.
+func (h *oooHead) getOrCreateSeries(ref chunks.HeadSeriesRef, lset labels.Labels) *oooSeries {
+	if s := h.getSeries(lset); s != nil {
+		return s
+	}
+
+	if ref > h.lastRef {
+		h.lastRef = ref
+	}
+	s := &oooSeries{ref: ref, hash: lset.Hash(), lset: lset}
+	h.addSeries(s)
+	return s
+}
+
+// addSeries adds the series to the head and indexes it. Must be called with the lock held.
+func (h *oooHead) addSeries(s *oooSeries) {
+	h.series[s.hash] = append(h.series[s.hash], s)
+	h.postings.add(s)
+}
+
+// getSeries returns the series for the input labels, or nil if it doesn't exist.
+// Must be called with the lock held.
+func (h *oooHead) getSeries(lset labels.Labels) *oooSeries {
+	for _, s := range h.series[lset.Hash()] {
+		if labels.Equal(s.lset, lset) {
+			return s
+		}
+	}
+	return nil
+}
+
+// find returns the position where a sample with timestamp t is, or should be inserted,
+// and whether a sample with such timestamp already exists.
+func (s *oooSeries) find(t int64) (int, bool) {
+	idx := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].t >= t })
+	return idx, idx < len(s.samples) && s.samples[idx].t == t
+}
+
+// insert adds the sample to the series, and returns whether it has been added.
+// If a sample with the same timestamp already exists, the input sample is discarded.
+func (s *oooSeries) insert(t int64, v float64) bool {
+	idx, exists := s.find(t)
+	if exists {
+		return false
+	}
+
+	s.samples = append(s.samples, oooSample{})
+	copy(s.samples[idx+1:], s.samples[idx:])
+	s.samples[idx] = oooSample{t: t, v: v}
+	return true
+}
+
+// append adds the input samples to the series with the input labels. The labels are retained,
+// so the caller should not modify them. Samples whose timestamp already exists in the series with
+// the same value are ignored, while samples whose timestamp already exists with a different value
+// are not added and returned as duplicates.
+func (h *oooHead) append(lset labels.Labels, samples []mimirpb.Sample) (appended int, duplicates []mimirpb.Sample, _ error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	series := h.getSeries(lset)
+	isNew := series == nil
+	if isNew {
+		series = &oooSeries{ref: h.lastRef + 1, hash: lset.Hash(), lset: lset}
+	}
+
+	toAppend := make([]record.RefSample, 0, len(samples))
+	for _, s := range samples {
+		if idx, exists := series.find(s.TimestampMs); exists {
+			if math.Float64bits(series.samples[idx].v) != math.Float64bits(s.Value) {
+				duplicates = append(duplicates, s)
+			}
+			continue
+		}
+		toAppend = append(toAppend, record.RefSample{Ref: series.ref, T: s.TimestampMs, V: s.Value})
+	}
+
+	if len(toAppend) == 0 {
+		return 0, duplicates, nil
+	}
+
+	if h.wal == nil {
+		if err := h.openWAL(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// Samples are logged to the WAL before being added in memory, so that samples
+	// which are not persisted are never returned by queries.
+	var enc record.Encoder
+	var recs [][]byte
+	if isNew {
+		recs = append(recs, enc.Series([]record.RefSeries{{Ref: series.ref, Labels: lset}}, nil))
+	}
+	recs = append(recs, enc.Samples(toAppend, nil))
+	if err := h.wal.Log(recs...); err != nil {
+		return 0, nil, errors.Wrap(err, "write to out-of-order WAL")
+	}
+
+	if isNew {
+		h.lastRef = series.ref
+		h.addSeries(series)
+	}
+	for _, s := range toAppend {
+		if series.insert(s.T, s.V) {
+			appended++
+		}
+	}
+	h.numSamples += appended
+
+	return appended, duplicates, nil
+}
+
+// empty returns whether the out-of-order head has no samples in memory and no pending blocks.
+func (h *oooHead) empty() bool {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	return h.numSamples == 0 && len(h.pendingBlocks) == 0
+}
+
+// inMemorySamples returns the number of samples in memory.
+func (h *oooHead) inMemorySamples() int {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	return h.numSamples
+}
+
+// flush writes to blocks all the samples with timestamp lower than before, grouping them by
+// blockRange, and removes them from memory and from the WAL. Returns the number of flushed samples.
+func (h *oooHead) flush(ctx context.Context, before, blockRange int64) (int, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	// Group the samples to flush by block range.
+	ranges := map[int64][]oooBlockSeries{}
+
+	for _, seriesWithSameHash := range h.series {
+		for _, s := range seriesWithSameHash {
+			end, _ := s.find(before)
+
+			for start := 0; start < end; {
+				rangeStart := rangeForTimestamp(s.samples[start].t, blockRange)
+				rangeEnd := start + sort.Search(end-start, func(i int) bool {
+					return rangeForTimestamp(s.samples[start+i].t, blockRange) != rangeStart
+				})
+
+				ranges[rangeStart] = append(ranges[rangeStart], oooBlockSeries{lset: s.lset, samples: s.samples[start:rangeEnd]})
+				start = rangeEnd
+			}
+		}
+	}
+
+	if len(ranges) == 0 {
+		return 0, nil
+	}
+
+	// Samples are removed from memory only once all the blocks have been written, so if a block
+	// can't be written the blocks already written are deleted, otherwise their samples would be
+	// written again by the next flush.
+	flushed := 0
+	var written []*tsdb.Block
+	for _, series := range ranges {
+		block, err := h.writeBlockFn(ctx, blockRange, series)
+		if err != nil {
+			h.deleteBlocks(written)
+			return 0, err
+		}
+
+		written = append(written, block)
+		for _, s := range series {
+			flushed += len(s.samples)
+		}
+	}
+	h.pendingBlocks = append(h.pendingBlocks, written...)
+
+	// Remove the flushed samples from memory.
+	for hash, seriesWithSameHash := range h.series {
+		kept := seriesWithSameHash[:0]
+		for _, s := range seriesWithSameHash {
+			end, _ := s.find(before)
+			s.samples = append(s.samples[:0], s.samples[end:]...)
+			if len(s.samples) > 0 {
+				kept = append(kept, s)
+			} else {
+				h.postings.delete(s)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(h.series, hash)
+		} else {
+			h.series[hash] = kept
+		}
+	}
+	h.numSamples -= flushed
+
+	if err := h.checkpointWAL(); err != nil {
+		return flushed, err
+	}
+
+	return flushed, nil
+}
+
+// deleteBlocks closes the input blocks and removes them from disk.
+func (h *oooHead) deleteBlocks(blocks []*tsdb.Block) {
+	for _, b := range blocks {
+		if err := b.Close(); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to close out-of-order block", "block", b.Meta().ULID.String(), "err", err)
+		}
+		if err := os.RemoveAll(b.Dir()); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to delete out-of-order block", "block", b.Meta().ULID.String(), "err", err)
+		}
+	}
+}
+
+// writeBlock writes the input series to a new block in the TSDB directory, and returns the opened block.
+func (h *oooHead) writeBlock(ctx context.Context, blockRange int64, series []oooBlockSeries) (*tsdb.Block, error) {
+	w, err := tsdb.NewBlockWriter(h.logger, h.dir, blockRange)
+	if err != nil {
+		return nil, errors.Wrap(err, "create out-of-order block writer")
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to close out-of-order block writer", "err", err)
+		}
+	}()
+
+	// The block writer rejects samples older than half of the block range from the most recent
+	// sample appended, so samples of all series are appended in timestamp order.
+	type seriesSample struct {
+		lset labels.Labels
+		oooSample
+	}
+	var samples []seriesSample
+	for _, s := range series {
+		for _, sample := range s.samples {
+			samples = append(samples, seriesSample{lset: s.lset, oooSample: sample})
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].t < samples[j].t })
+
+	app := w.Appender(ctx)
+	for _, s := range samples {
+		if _, err := app.Append(0, s.lset, s.t, s.v); err != nil {
+			_ = app.Rollback()
+			return nil, errors.Wrap(err, "append to out-of-order block writer")
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return nil, errors.Wrap(err, "commit to out-of-order block writer")
+	}
+
+	id, err := w.Flush(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "flush out-of-order block")
+	}
+
+	level.Info(h.logger).Log("msg", "flushed out-of-order samples to block", "block", id.String(), "samples", len(samples))
+
+	block, err := tsdb.OpenBlock(h.logger, filepath.Join(h.dir, id.String()), nil)
+	return block, errors.Wrap(err, "open out-of-order block")
+}
+
+// checkpointWAL rewrites the samples still in memory to a new WAL segment, and deletes the previous ones.
+// Must be called with the lock held.
+func (h *oooHead) checkpointWAL() error {
+	if err := h.wal.NextSegment(); err != nil {
+		return errors.Wrap(err, "create out-of-order WAL segment")
+	}
+	segment, _, err := h.wal.LastSegmentAndOffset()
+	if err != nil {
+		return errors.Wrap(err, "get last out-of-order WAL segment")
+	}
+
+	var enc record.Encoder
+	for _, seriesWithSameHash := range h.series {
+		for _, s := range seriesWithSameHash {
+			samples := make([]record.RefSample, 0, len(s.samples))
+			for _, sample := range s.samples {
+				samples = append(samples, record.RefSample{Ref: s.ref, T: sample.t, V: sample.v})
+			}
+
+			if err := h.wal.Log(enc.Series([]record.RefSeries{{Ref: s.ref, Labels: s.lset}}, nil), enc.Samples(samples, nil)); err != nil {
+				return errors.Wrap(err, "write to out-of-order WAL")
+			}
+		}
+	}
+
+	return errors.Wrap(h.wal.Truncate(segment), "truncate out-of-order WAL")
+}
+
+// releaseLoadedBlocks closes the pending blocks which have been loaded by the TSDB.
+func (h *oooHead) releaseLoadedBlocks(loaded []*tsdb.Block) {
+	ids := make(map[string]struct{}, len(loaded))
+	for _, b := range loaded {
+		ids[b.Meta().ULID.String()] = struct{}{}
+	}
+
+	h.mtx.Lock()
+	var released []*tsdb.Block
+	pending := h.pendingBlocks[:0]
+	for _, b := range h.pendingBlocks {
+		if _, ok := ids[b.Meta().ULID.String()]; ok {
+			released = append(released, b)
+		} else {
+			pending = append(pending, b)
+		}
+	}
+	h.pendingBlocks = pending
+	h.mtx.Unlock()
+
+	// Closing a block waits for in-flight queries to complete, so it's done without holding the lock.
+	for _, b := range released {
+		if err := b.Close(); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to close out-of-order block", "block", b.Meta().ULID.String(), "err", err)
+		}
+	}
+}
+
+// close closes the WAL and the pending blocks.
+func (h *oooHead) close() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, b := range h.pendingBlocks {
+		if err := b.Close(); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to close out-of-order block", "block", b.Meta().ULID.String(), "err", err)
+		}
+	}
+	h.pendingBlocks = nil
+
+	if h.wal == nil {
+		return nil
+	}
+	return h.wal.Close()
+}
+
+// queriers returns the queriers for the in-memory samples and the pending blocks.
+// Returns no querier if the out-of-order head is empty.
+func (h *oooHead) queriers(mint, maxt int64) ([]storage.Querier, error) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	var queriers []storage.Querier
+	if h.numSamples > 0 {
+		queriers = append(queriers, &oooHeadQuerier{head: h, mint: mint, maxt: maxt})
+	}
+	for _, b := range h.pendingBlocks {
+		q, err := tsdb.NewBlockQuerier(b, mint, maxt)
+		if err != nil {
+			closeQueriers(queriers)
+			return nil, err
+		}
+		queriers = append(queriers, q)
+	}
+	return queriers, nil
+}
+
+// chunkQueriers is like queriers, but returns chunk queriers.
+func (h *oooHead) chunkQueriers(mint, maxt int64) ([]storage.ChunkQuerier, error) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	var queriers []storage.ChunkQuerier
+	if h.numSamples > 0 {
+		queriers = append(queriers, &oooHeadChunkQuerier{oooHeadQuerier{head: h, mint: mint, maxt: maxt}})
+	}
+	for _, b := range h.pendingBlocks {
+		q, err := tsdb.NewBlockChunkQuerier(b, mint, maxt)
+		if err != nil {
+			for _, q := range queriers {
+				_ = q.Close()
+			}
+			return nil, err
+		}
+		queriers = append(queriers, q)
+	}
+	return queriers, nil
+}
+
+// inMemoryChunkQuerier returns the chunk querier for the in-memory samples only,
+// or nil if there are no samples in memory.
+func (h *oooHead) inMemoryChunkQuerier(mint, maxt int64) storage.ChunkQuerier {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if h.numSamples == 0 {
+		return nil
+	}
+	return &oooHeadChunkQuerier{oooHeadQuerier{head: h, mint: mint, maxt: maxt}}
+}
+
+func closeQueriers(queriers []storage.Querier) {
+	for _, q := range queriers {
+		_ = q.Close()
+	}
+}
+
+// oooHeadQuerier queries the in-memory samples of the out-of-order head.
+type oooHeadQuerier struct {
+	head       *oooHead
+	mint, maxt int64
+}
+
+// Select implements storage.Querier. Returned series are always sorted.
+func (q *oooHeadQuerier) Select(_ bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	q.head.mtx.RLock()
+	defer q.head.mtx.RUnlock()
+
+	var result []storage.Series
+	q.forEachMatchingSeries(hints, matchers, func(s *oooSeries) {
+		start, _ := s.find(q.mint)
+		end := start + sort.Search(len(s.samples)-start, func(i int) bool { return s.samples[start+i].t > q.maxt })
+		if start == end {
+			return
+		}
+
+		// Samples are copied because the series could be modified once the lock is released.
+		samples := make([]tsdbutil.Sample, 0, end-start)
+		for _, sample := range s.samples[start:end] {
+			samples = append(samples, sample)
+		}
+		result = append(result, storage.NewListSeries(s.lset, samples))
+	})
+
+	sort.Slice(result, func(i, j int) bool { return labels.Compare(result[i].Labels(), result[j].Labels()) < 0 })
+	return &seriesSet{series: result}
+}
+
+// LabelValues implements storage.Querier.
+func (q *oooHeadQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	q.head.mtx.RLock()
+	defer q.head.mtx.RUnlock()
+
+	values := map[string]struct{}{}
+	q.forEachMatchingSeries(nil, matchers, func(s *oooSeries) {
+		if v := s.lset.Get(name); v != "" && q.hasSamplesInRange(s) {
+			values[v] = struct{}{}
+		}
+	})
+	return sortedKeys(values), nil, nil
+}
+
+// LabelNames implements storage.Querier.
+func (q *oooHeadQuerier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	q.head.mtx.RLock()
+	defer q.head.mtx.RUnlock()
+
+	names := map[string]struct{}{}
+	q.forEachMatchingSeries(nil, matchers, func(s *oooSeries) {
+		if !q.hasSamplesInRange(s) {
+			return
+		}
+		for _, l := range s.lset {
+			names[l.Name] = struct{}{}
+		}
+	})
+	return sortedKeys(names), nil, nil
+}
+
+// Close implements storage.Querier.
+func (q *oooHeadQuerier) Close() error {
+	return nil
+}
+
+func (q *oooHeadQuerier) hasSamplesInRange(s *oooSeries) bool {
+	start, _ := s.find(q.mint)
+	return start < len(s.samples) && s.samples[start].t <= q.maxt
+}
+
+// forEachMatchingSeries calls fn for each series matching the input matchers and the shard, if any.
+// Must be called with the read lock held.
+func (q *oooHeadQuerier) forEachMatchingSeries(hints *storage.SelectHints, matchers []*labels.Matcher, fn func(s *oooSeries)) {
+	match := func(s *oooSeries) {
+		if hints != nil && hints.ShardCount > 0 && s.hash%hints.ShardCount != hints.ShardIndex {
+			return
+		}
+		for _, m := range matchers {
+			if !m.Matches(s.lset.Get(m.Name)) {
+				return
+			}
+		}
+		fn(s)
+	}
+
+	if candidates, ok := q.head.postings.candidates(matchers); ok {
+		for s := range candidates {
+			match(s)
+		}
+		return
+	}
+
+	// None of the matchers can be looked up in the index, so all series are scanned.
+	for _, seriesWithSameHash := range q.head.series {
+		for _, s := range seriesWithSameHash {
+			match(s)
+		}
+	}
+}
+
+// oooPostings indexes the series of the out-of-order head by label name and value.
+type oooPostings map[string]map[string]map[*oooSeries]struct{}
+
+func (p oooPostings) add(s *oooSeries) {
+	for _, l := range s.lset {
+		values, ok := p[l.Name]
+		if !ok {
+			values = map[string]map[*oooSeries]struct{}{}
+			p[l.Name] = values
+		}
+		series, ok := values[l.Value]
+		if !ok {
+			series = map[*oooSeries]struct{}{}
+			values[l.Value] = series
+		}
+		series[s] = struct{}{}
+	}
+}
+
+func (p oooPostings) delete(s *oooSeries) {
+	for _, l := range s.lset {
+		values := p[l.Name]
+		delete(values[l.Value], s)
+		if len(values[l.Value]) == 0 {
+			delete(values, l.Value)
+		}
+		if len(values) == 0 {
+			delete(p, l.Name)
+		}
+	}
+}
+
+// candidates returns a superset of the series matching the input matchers, looking up in the index
+// the matchers which don't match the empty label value, or false if there are no such matchers.
+func (p oooPostings) candidates(matchers []*labels.Matcher) (map[*oooSeries]struct{}, bool) {
+	var result map[*oooSeries]struct{}
+	for _, m := range matchers {
+		// A matcher matching the empty value also matches the series without the label,
+		// which are not indexed by the label name.
+		if m.Matches("") {
+			continue
+		}
+
+		matching := map[*oooSeries]struct{}{}
+		if m.Type == labels.MatchEqual {
+			for s := range p[m.Name][m.Value] {
+				matching[s] = struct{}{}
+			}
+		} else {
+			for value, series := range p[m.Name] {
+				if !m.Matches(value) {
+					continue
+				}
+				for s := range series {
+					matching[s] = struct{}{}
+				}
+			}
+		}
+
+		if result == nil {
+			result = matching
+			continue
+		}
+		for s := range result {
+			if _, ok := matching[s]; !ok {
+				delete(result, s)
+			}
+		}
+	}
+	return result, result != nil
+}
+
+// oooHeadChunkQuerier queries the in-memory samples of the out-of-order head, encoding them into chunks.
+type oooHeadChunkQuerier struct {
+	oooHeadQuerier
+}
+
+// Select implements storage.ChunkQuerier.
+func (q *oooHeadChunkQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.ChunkSeriesSet {
+	return storage.NewSeriesSetToChunkSet(q.oooHeadQuerier.Select(sortSeries, hints, matchers...))
+}
+
+// seriesSet is a storage.SeriesSet over a list of series.
+type seriesSet struct {
+	series []storage.Series
+	curr   storage.Series
+}
+
+func (s *seriesSet) Next() bool {
+	if len(s.series) == 0 {
+		return false
+	}
+	s.curr, s.series = s.series[0], s.series[1:]
+	return true
+}
+
+func (s *seriesSet) At() storage.Series         { return s.curr }
+func (s *seriesSet) Err() error                 { return nil }
+func (s *seriesSet) Warnings() storage.Warnings { return nil }
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rangeForTimestamp returns the start of the block range containing t.
+func rangeForTimestamp(t, blockRange int64) int64 {
+	if t < 0 {
+		return ((t - blockRange + 1) / blockRange) * blockRange
+	}
+	return (t / blockRange) * blockRange
+}
@@ -0,0 +1,326 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestOOOHead_AppendAndQuery(t *testing.T) {
+	h, err := openOOOHead(log.NewNopLogger(), t.TempDir(), 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.close()) })
+
+	series1 := labels.FromStrings("__name__", "metric", "series", "1")
+	series2 := labels.FromStrings("__name__", "metric", "series", "2")
+
+	appended, duplicates, err := h.append(series1, []mimirpb.Sample{{TimestampMs: 30, Value: 3}, {TimestampMs: 10, Value: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, appended)
+	assert.Empty(t, duplicates)
+
+	appended, duplicates, err = h.append(series2, []mimirpb.Sample{{TimestampMs: 20, Value: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, appended)
+	assert.Empty(t, duplicates)
+
+	// Same timestamp and value is a no-op, while a different value is a duplicate.
+	appended, duplicates, err = h.append(series1.Copy(), []mimirpb.Sample{{TimestampMs: 10, Value: 1}, {TimestampMs: 30, Value: 4}, {TimestampMs: 20, Value: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, appended)
+	assert.Equal(t, []mimirpb.Sample{{TimestampMs: 30, Value: 4}}, duplicates)
+
+	expected := map[string][]oooSample{
+		series1.String(): {{t: 10, v: 1}, {t: 20, v: 2}, {t: 30, v: 3}},
+		series2.String(): {{t: 20, v: 2}},
+	}
+	assert.Equal(t, expected, queryOOOHead(t, h, 0, 100))
+
+	// Query a subset of the time range.
+	assert.Equal(t, map[string][]oooSample{
+		series1.String(): {{t: 20, v: 2}},
+		series2.String(): {{t: 20, v: 2}},
+	}, queryOOOHead(t, h, 15, 25))
+
+	// Label names and values only account for series with samples in the time range.
+	queriers, err := h.queriers(25, 100)
+	require.NoError(t, err)
+	require.Len(t, queriers, 1)
+	values, _, err := queriers[0].LabelValues("series")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, values)
+	names, _, err := queriers[0].LabelNames(labels.MustNewMatcher(labels.MatchEqual, "series", "2"))
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	// Samples should be replayed from the WAL.
+	require.NoError(t, h.close())
+	h, err = openOOOHead(log.NewNopLogger(), h.dir, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, expected, queryOOOHead(t, h, math.MinInt64, math.MaxInt64))
+}
+
+func TestOOOHead_Flush(t *testing.T) {
+	const blockRange = 100
+
+	dir := t.TempDir()
+	h, err := openOOOHead(log.NewNopLogger(), dir, 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.close()) })
+
+	series1 := labels.FromStrings("__name__", "metric", "series", "1")
+	series2 := labels.FromStrings("__name__", "metric", "series", "2")
+
+	_, _, err = h.append(series1, []mimirpb.Sample{{TimestampMs: 10, Value: 1}, {TimestampMs: 90, Value: 2}, {TimestampMs: 150, Value: 3}, {TimestampMs: 250, Value: 4}})
+	require.NoError(t, err)
+	_, _, err = h.append(series2, []mimirpb.Sample{{TimestampMs: 20, Value: 5}})
+	require.NoError(t, err)
+
+	flushed, err := h.flush(context.Background(), 200, blockRange)
+	require.NoError(t, err)
+	assert.Equal(t, 4, flushed)
+
+	// Samples should have been written to one block per block range.
+	require.Len(t, h.pendingBlocks, 2)
+	blocks := map[int64]tsdb.BlockMeta{}
+	for _, b := range h.pendingBlocks {
+		blocks[b.MinTime()] = b.Meta()
+	}
+	assert.Equal(t, int64(91), blocks[10].MaxTime)
+	assert.Equal(t, uint64(3), blocks[10].Stats.NumSamples)
+	assert.Equal(t, int64(151), blocks[150].MaxTime)
+	assert.Equal(t, uint64(1), blocks[150].Stats.NumSamples)
+
+	// Flushed samples should still be queryable from the pending blocks.
+	expected := map[string][]oooSample{
+		series1.String(): {{t: 10, v: 1}, {t: 90, v: 2}, {t: 150, v: 3}, {t: 250, v: 4}},
+		series2.String(): {{t: 20, v: 5}},
+	}
+	assert.Equal(t, expected, queryOOOHead(t, h, 0, 300))
+	assert.False(t, h.empty())
+
+	// Only non-flushed samples should be replayed from the WAL.
+	require.NoError(t, h.close())
+	h, err = openOOOHead(log.NewNopLogger(), dir, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, h.numSamples)
+	assert.Equal(t, map[string][]oooSample{series1.String(): {{t: 250, v: 4}}}, queryOOOHead(t, h, 0, 300))
+
+	// Flushed blocks should be stored in the TSDB directory.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var blockDirs []string
+	for _, e := range entries {
+		if e.Name() != oooWALDirName {
+			blockDirs = append(blockDirs, e.Name())
+		}
+	}
+	assert.Len(t, blockDirs, 2)
+
+	// Pending blocks should be released once loaded by the TSDB.
+	_, err = h.flush(context.Background(), 300, blockRange)
+	require.NoError(t, err)
+	require.Len(t, h.pendingBlocks, 1)
+	loaded, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, h.pendingBlocks[0].Meta().ULID.String()), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, loaded.Close()) })
+
+	h.releaseLoadedBlocks([]*tsdb.Block{loaded})
+	assert.Empty(t, h.pendingBlocks)
+	assert.True(t, h.empty())
+}
+
+func TestOOOHead_FlushShouldNotDuplicateSamplesWhenAnyBlockFails(t *testing.T) {
+	const blockRange = 100
+
+	dir := t.TempDir()
+	h, err := openOOOHead(log.NewNopLogger(), dir, 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.close()) })
+
+	series := labels.FromStrings("__name__", "metric", "series", "1")
+	_, _, err = h.append(series, []mimirpb.Sample{{TimestampMs: 10, Value: 1}, {TimestampMs: 150, Value: 2}})
+	require.NoError(t, err)
+
+	// Fail writing the second block.
+	calls := 0
+	h.writeBlockFn = func(ctx context.Context, blockRange int64, series []oooBlockSeries) (*tsdb.Block, error) {
+		if calls++; calls > 1 {
+			return nil, errors.New("write failed")
+		}
+		return h.writeBlock(ctx, blockRange, series)
+	}
+
+	_, err = h.flush(context.Background(), 200, blockRange)
+	require.Error(t, err)
+
+	// The block written before the failure should have been deleted, while the samples are still in memory.
+	assert.Empty(t, h.pendingBlocks)
+	assert.Equal(t, []string{oooWALDirName}, listDir(t, dir))
+	assert.Equal(t, map[string][]oooSample{series.String(): {{t: 10, v: 1}, {t: 150, v: 2}}}, queryOOOHead(t, h, 0, 200))
+
+	// Retrying the flush should write each sample once.
+	h.writeBlockFn = h.writeBlock
+	flushed, err := h.flush(context.Background(), 200, blockRange)
+	require.NoError(t, err)
+	assert.Equal(t, 2, flushed)
+	require.Len(t, h.pendingBlocks, 2)
+	for _, b := range h.pendingBlocks {
+		assert.Equal(t, uint64(1), b.Meta().Stats.NumSamples)
+	}
+	assert.Len(t, listDir(t, dir), 3)
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestOOOHead_QueryWithShard(t *testing.T) {
+	h, err := openOOOHead(log.NewNopLogger(), t.TempDir(), 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.close()) })
+
+	const numSeries = 10
+	for i := 0; i < numSeries; i++ {
+		_, _, err = h.append(labels.FromStrings("series", string(rune('a'+i))), []mimirpb.Sample{{TimestampMs: 10, Value: 1}})
+		require.NoError(t, err)
+	}
+
+	queriers, err := h.queriers(0, 100)
+	require.NoError(t, err)
+	require.Len(t, queriers, 1)
+
+	const shardCount = 3
+	total := 0
+	for shardIndex := uint64(0); shardIndex < shardCount; shardIndex++ {
+		set := queriers[0].Select(false, &storage.SelectHints{ShardIndex: shardIndex, ShardCount: shardCount})
+		for set.Next() {
+			assert.Equal(t, shardIndex, set.At().Labels().Hash()%shardCount)
+			total++
+		}
+		require.NoError(t, set.Err())
+	}
+	assert.Equal(t, numSeries, total)
+}
+
+func queryOOOHead(t *testing.T, h *oooHead, mint, maxt int64) map[string][]oooSample {
+	queriers, err := h.queriers(mint, maxt)
+	require.NoError(t, err)
+
+	q := storage.NewMergeQuerier(queriers, nil, storage.ChainedSeriesMerge)
+	defer q.Close()
+
+	result := map[string][]oooSample{}
+	set := q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "series", ".+"))
+	for set.Next() {
+		var samples []oooSample
+		it := set.At().Iterator()
+		for it.Next() {
+			ts, v := it.At()
+			samples = append(samples, oooSample{t: ts, v: v})
+		}
+		require.NoError(t, it.Err())
+		result[set.At().Labels().String()] = samples
+	}
+	require.NoError(t, set.Err())
+	return result
+}
+
+func TestOOOHead_QueryWithMatchers(t *testing.T) {
+	dir := t.TempDir()
+	h, err := openOOOHead(log.NewNopLogger(), dir, 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.close()) })
+
+	// The WAL should only be created once the first sample is appended.
+	assert.False(t, hasOOOWAL(dir))
+
+	series1 := labels.FromStrings("__name__", "metric", "series", "1")
+	series2 := labels.FromStrings("__name__", "metric", "series", "2", "extra", "a")
+	series3 := labels.FromStrings("__name__", "other", "series", "3")
+	for i, lset := range []labels.Labels{series1, series2, series3} {
+		_, _, err = h.append(lset, []mimirpb.Sample{{TimestampMs: int64(10 * (i + 1)), Value: 1}})
+		require.NoError(t, err)
+	}
+	assert.True(t, hasOOOWAL(dir))
+
+	selectSeries := func(matchers ...*labels.Matcher) []string {
+		// Only the in-memory samples are queried.
+		q := &oooHeadQuerier{head: h, mint: 0, maxt: 100}
+
+		var result []string
+		set := q.Select(true, nil, matchers...)
+		for set.Next() {
+			result = append(result, set.At().Labels().String())
+		}
+		require.NoError(t, set.Err())
+		return result
+	}
+
+	for name, tc := range map[string]struct {
+		matchers []*labels.Matcher
+		expected []string
+	}{
+		"equal": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "metric")},
+			expected: []string{series2.String(), series1.String()},
+		},
+		"equal on multiple labels": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "__name__", "metric"),
+				labels.MustNewMatcher(labels.MatchEqual, "series", "2"),
+			},
+			expected: []string{series2.String()},
+		},
+		"regexp": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "series", "1|3")},
+			expected: []string{series1.String(), series3.String()},
+		},
+		"not equal matching the empty value": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "extra", "a")},
+			expected: []string{series1.String(), series3.String()},
+		},
+		"equal and not equal": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "__name__", "metric"),
+				labels.MustNewMatcher(labels.MatchNotEqual, "series", "1"),
+			},
+			expected: []string{series2.String()},
+		},
+		"no matching value": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "unknown")},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, selectSeries(tc.matchers...))
+		})
+	}
+
+	// Series whose samples have all been flushed should be removed from the index.
+	_, err = h.flush(context.Background(), 25, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{series3.String()}, selectSeries(labels.MustNewMatcher(labels.MatchRegexp, "series", ".+")))
+	assert.NotContains(t, h.postings["series"], "1")
+	assert.NotContains(t, h.postings, "extra")
+}
@@ -7,6 +7,7 @@ package ingester
 
 import (
 	"context"
+	"math"
 	"sync"
 	"time"
 
@@ -22,6 +23,15 @@ import (
 	util_math "github.com/grafana/mimir/pkg/util/math"
 )
 
+const (
+	// Rough estimate of the memory used by each in-memory series of the TSDB head, including
+	// its labels, index postings and the head chunk which hasn't been mmapped yet.
+	estimatedInMemorySeriesBytes = 4 * 1024
+
+	// Size of the samples kept in memory by the out-of-order head.
+	estimatedOutOfOrderSampleBytes = 16
+)
+
 type tsdbState int
 
 const (
@@ -87,6 +97,16 @@ type userTSDB struct {
 	// Cached shipped blocks.
 	shippedBlocksMtx sync.Mutex
 	shippedBlocks    map[ulid.ULID]struct{}
+
+	// Samples ingested out-of-order.
+	oooHead *oooHead
+
+	// Whether the TSDB has been opened with querying overlapping blocks enabled, which is
+	// required to flush out-of-order samples to blocks.
+	allowOverlappingQueries bool
+
+	// Unix timestamp of last early head compaction.
+	lastEarlyCompaction atomic.Int64
 }
 
 // Explicitly wrapping the tsdb.DB functions that we use.
@@ -96,11 +116,52 @@ func (u *userTSDB) Appender(ctx context.Context) storage.Appender {
 }
 
 func (u *userTSDB) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return u.db.Querier(ctx, mint, maxt)
+	q, err := u.db.Querier(ctx, mint, maxt)
+	if err != nil || u.oooHead == nil {
+		return q, err
+	}
+
+	oooQueriers, err := u.oooHead.queriers(mint, maxt)
+	if err != nil {
+		_ = q.Close()
+		return nil, err
+	}
+	if len(oooQueriers) == 0 {
+		return q, nil
+	}
+	return storage.NewMergeQuerier(append([]storage.Querier{q}, oooQueriers...), nil, storage.ChainedSeriesMerge), nil
 }
 
 func (u *userTSDB) ChunkQuerier(ctx context.Context, mint, maxt int64) (storage.ChunkQuerier, error) {
-	return u.db.ChunkQuerier(ctx, mint, maxt)
+	q, err := u.db.ChunkQuerier(ctx, mint, maxt)
+	if err != nil || u.oooHead == nil {
+		return q, err
+	}
+
+	oooQueriers, err := u.oooHead.chunkQueriers(mint, maxt)
+	if err != nil {
+		_ = q.Close()
+		return nil, err
+	}
+	if len(oooQueriers) == 0 {
+		return q, nil
+	}
+	return storage.NewMergeChunkQuerier(append([]storage.ChunkQuerier{q}, oooQueriers...), nil, storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge)), nil
+}
+
+// inMemoryChunkQuerier returns a chunk querier for the series in memory only, including the
+// out-of-order ones, while the series in blocks are not queried.
+func (u *userTSDB) inMemoryChunkQuerier() (storage.ChunkQuerier, error) {
+	q, err := tsdb.NewBlockChunkQuerier(tsdb.NewRangeHead(u.Head(), math.MinInt64, math.MaxInt64), math.MinInt64, math.MaxInt64)
+	if err != nil || u.oooHead == nil {
+		return q, err
+	}
+
+	oooQuerier := u.oooHead.inMemoryChunkQuerier(math.MinInt64, math.MaxInt64)
+	if oooQuerier == nil {
+		return q, nil
+	}
+	return storage.NewMergeChunkQuerier([]storage.ChunkQuerier{q, oooQuerier}, nil, storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge)), nil
 }
 
 func (u *userTSDB) ExemplarQuerier(ctx context.Context) (storage.ExemplarQuerier, error) {
@@ -116,6 +177,12 @@ func (u *userTSDB) Blocks() []*tsdb.Block {
 }
 
 func (u *userTSDB) Close() error {
+	if u.oooHead != nil {
+		if err := u.oooHead.close(); err != nil {
+			_ = u.db.Close()
+			return errors.Wrap(err, "close out-of-order head")
+		}
+	}
 	return u.db.Close()
 }
 
@@ -140,6 +207,12 @@ func (u *userTSDB) casState(from, to tsdbState) bool {
 
 // compactHead compacts the Head block at specified block durations avoiding a single huge block.
 func (u *userTSDB) compactHead(blockDuration int64) error {
+	return u.compactHeadUntil(blockDuration, math.MaxInt64)
+}
+
+// compactHeadUntil compacts the samples of the Head block with timestamp lower than or equal to until, at specified
+// block durations avoiding a single huge block. Series without samples newer than until are removed from the Head.
+func (u *userTSDB) compactHeadUntil(blockDuration, until int64) error {
 	if !u.casState(active, forceCompacting) {
 		return errors.New("TSDB head cannot be compacted because it is not in active state (possibly being closed or blocks shipping in progress)")
 	}
@@ -153,7 +226,11 @@ func (u *userTSDB) compactHead(blockDuration int64) error {
 
 	h := u.Head()
 
-	minTime, maxTime := h.MinTime(), h.MaxTime()
+	minTime, maxTime := h.MinTime(), util_math.Min64(h.MaxTime(), until)
+	if minTime > maxTime {
+		// Nothing to compact.
+		return nil
+	}
 
 	for (minTime/blockDuration)*blockDuration != (maxTime/blockDuration)*blockDuration {
 		// Data in Head spans across multiple block ranges, so we break it into blocks here.
@@ -164,12 +241,80 @@ func (u *userTSDB) compactHead(blockDuration int64) error {
 		}
 
 		// Get current min/max times after compaction.
-		minTime, maxTime = h.MinTime(), h.MaxTime()
+		minTime, maxTime = h.MinTime(), util_math.Min64(h.MaxTime(), until)
 	}
 
 	return u.db.CompactHead(tsdb.NewRangeHead(h, minTime, maxTime))
 }
 
+// estimatedHeadBytes returns an estimate of the memory used by the in-memory series of the TSDB head,
+// and by the samples of the out-of-order head.
+func (u *userTSDB) estimatedHeadBytes() int64 {
+	bytes := int64(u.Head().NumSeries()) * estimatedInMemorySeriesBytes
+	if u.oooHead != nil {
+		bytes += int64(u.oooHead.inMemorySamples()) * estimatedOutOfOrderSampleBytes
+	}
+	return bytes
+}
+
+// canEarlyCompact returns whether the TSDB head can be compacted early, because the cooldown since the
+// previous early compaction has elapsed.
+func (u *userTSDB) canEarlyCompact(now time.Time, cooldown time.Duration) bool {
+	last := u.lastEarlyCompaction.Load()
+	return last == 0 || now.Sub(time.Unix(last, 0)) >= cooldown
+}
+
+// outOfOrderMinValidTime returns the minimum timestamp of out-of-order samples which can be ingested
+// for the input out-of-order time window, and false if out-of-order samples can't be ingested. Out-of-order
+// samples can't be ingested if the TSDB has been opened with querying overlapping blocks disabled, because
+// they're flushed to blocks overlapping with the other ones.
+func (u *userTSDB) outOfOrderMinValidTime(window time.Duration) (int64, bool) {
+	if u.oooHead == nil || !u.allowOverlappingQueries || window <= 0 {
+		return 0, false
+	}
+
+	maxTime := u.Head().MaxTime()
+	if maxTime == math.MinInt64 {
+		// The head is empty, so we use the max time of the last block.
+		blocks := u.Blocks()
+		if len(blocks) == 0 {
+			return 0, false
+		}
+		maxTime = blocks[len(blocks)-1].MaxTime()
+	}
+
+	return maxTime - window.Milliseconds(), true
+}
+
+// flushOutOfOrderSamples writes to blocks the out-of-order samples which can't overlap with
+// samples in the TSDB head, or appended to it in the future.
+func (u *userTSDB) flushOutOfOrderSamples(ctx context.Context, blockDuration int64) (int, error) {
+	if u.oooHead == nil {
+		return 0, nil
+	}
+
+	// Release the blocks flushed previously, if the TSDB has loaded them in the meanwhile.
+	u.oooHead.releaseLoadedBlocks(u.Blocks())
+
+	// Samples can be flushed if older than both the samples in the head and the minimum
+	// time of samples which can be appended to the head in the future.
+	h := u.Head()
+	before, ok := h.AppendableMinValidTime()
+	if !ok {
+		// The head is empty, so the TSDB only accepts samples newer than the max time of
+		// the last block (sorted by min time), like it does when it's opened.
+		blocks := u.Blocks()
+		if len(blocks) == 0 {
+			return 0, nil
+		}
+		before = blocks[len(blocks)-1].MaxTime()
+	} else if minTime := h.MinTime(); minTime < before {
+		before = minTime
+	}
+
+	return u.oooHead.flush(ctx, before, blockDuration)
+}
+
 // PreCreation implements SeriesLifecycleCallback interface.
 func (u *userTSDB) PreCreation(metric labels.Labels) error {
 	if u.limiter == nil {
@@ -316,6 +461,11 @@ func (u *userTSDB) shouldCloseTSDB(idleTimeout time.Duration) tsdbCloseCheckResu
 		return tsdbNotCompacted
 	}
 
+	// Same for out-of-order samples not flushed to blocks, or flushed to blocks not loaded by the TSDB yet.
+	if u.oooHead != nil && !u.oooHead.empty() {
+		return tsdbNotCompacted
+	}
+
 	// Ensure that all blocks have been shipped.
 	if oldest := u.getOldestUnshippedBlockTime(); oldest > 0 {
 		return tsdbNotShipped
@@ -191,6 +191,9 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.Worker.Validate(log); err != nil {
 		return errors.Wrap(err, "invalid frontend_worker config")
 	}
+	if err := c.LimitsConfig.Validate(); err != nil {
+		return errors.Wrap(err, "invalid limits config")
+	}
 	if err := c.Frontend.QueryMiddleware.Validate(); err != nil {
 		return errors.Wrap(err, "invalid query-frontend middleware config")
 	}
@@ -368,6 +371,9 @@ type Mimir struct {
 
 	// Queryables that the querier should use to query the long term storage.
 	StoreQueryables []querier.QueryableWithFilter
+
+	// Series deletion requests applied by the querier to the query results.
+	SeriesTombstones *tsdb.TombstonesLoader
 }
 
 // New makes a new Mimir.
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimirpb
+
+// IsFloatHistogram returns true if the histogram stores float counts, false if it stores integer counts.
+func (h *Histogram) IsFloatHistogram() bool {
+	_, ok := h.GetCount().(*Histogram_CountFloat)
+	return ok
+}
+
+// GetCountValue returns the count of observations in the histogram, regardless of whether it's
+// an integer or float histogram.
+func (h *Histogram) GetCountValue() float64 {
+	if h.IsFloatHistogram() {
+		return h.GetCountFloat()
+	}
+	return float64(h.GetCountInt())
+}
+
+// GetZeroCountValue returns the count of observations in the zero bucket, regardless of whether it's
+// an integer or float histogram.
+func (h *Histogram) GetZeroCountValue() float64 {
+	if h.IsFloatHistogram() {
+		return h.GetZeroCountFloat()
+	}
+	return float64(h.GetZeroCountInt())
+}
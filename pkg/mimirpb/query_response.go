@@ -0,0 +1,6 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimirpb
+
+// QueryResponseMediaType is the media type of the query results encoded as a QueryResponse.
+const QueryResponseMediaType = "application/vnd.mimir.queryresponse+protobuf"
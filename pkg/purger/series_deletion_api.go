@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package purger
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/grafana/dskit/tenant"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// SeriesDeletionAPI implements the Prometheus-compatible API to delete the samples of the series matching
+// the selectors, in a time range. The requests are stored in the bucket as tombstones: the queriers and
+// store-gateways filter the deleted samples out at query time, until the compactor rewrites the blocks.
+type SeriesDeletionAPI struct {
+	bucketClient objstore.Bucket
+	logger       log.Logger
+	cfgProvider  bucket.TenantConfigProvider
+}
+
+func NewSeriesDeletionAPI(storageCfg mimir_tsdb.BlocksStorageConfig, cfgProvider bucket.TenantConfigProvider, logger log.Logger, reg prometheus.Registerer) (*SeriesDeletionAPI, error) {
+	bucketClient, err := createBucketClient(storageCfg, "purger-series-deletion", logger, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSeriesDeletionAPI(bucketClient, cfgProvider, logger), nil
+}
+
+func newSeriesDeletionAPI(bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, logger log.Logger) *SeriesDeletionAPI {
+	return &SeriesDeletionAPI{
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+		logger:       logger,
+	}
+}
+
+// DeleteSeries creates a series deletion request for the match[] selectors, between the optional start and end
+// times. The start time defaults to the Unix epoch and the end time to the current time, which is also the maximum.
+func (api *SeriesDeletionAPI) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	startTime := int64(0)
+	endTime := util.TimeToMillis(now)
+
+	if s := r.FormValue("start"); s != "" {
+		if startTime, err = util.ParseTime(s); err != nil {
+			http.Error(w, "invalid start time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if s := r.FormValue("end"); s != "" {
+		if endTime, err = util.ParseTime(s); err != nil {
+			http.Error(w, "invalid end time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if endTime > util.TimeToMillis(now) {
+			http.Error(w, "the end time can't be in the future", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tombstone, err := mimir_tsdb.NewTombstone(startTime, endTime, r.Form["match[]"], now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The same request is only stored once, unless it's sent again after being processed
+	// in which case it's processed again to delete the samples written in the meanwhile.
+	existing, err := mimir_tsdb.ReadTombstones(ctx, api.bucketClient, userID)
+	if err != nil {
+		level.Error(api.logger).Log("msg", "failed to read series deletion requests", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, t := range existing {
+		if t.RequestID == tombstone.RequestID && t.State == mimir_tsdb.TombstonePending {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if err := mimir_tsdb.WriteTombstone(ctx, api.bucketClient, userID, api.cfgProvider, tombstone); err != nil {
+		level.Error(api.logger).Log("msg", "failed to write series deletion request", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(api.logger).Log("msg", "series deletion request created", "user", userID, "request_id", tombstone.RequestID, "selectors", r.Form["match[]"], "start", startTime, "end", endTime)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSeriesDeletionRequests returns the series deletion requests of the tenant, either pending or processed.
+func (api *SeriesDeletionAPI) GetSeriesDeletionRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tombstones, err := mimir_tsdb.ReadTombstones(ctx, api.bucketClient, userID)
+	if err != nil {
+		level.Error(api.logger).Log("msg", "failed to read series deletion requests", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if tombstones == nil {
+		tombstones = mimir_tsdb.Tombstones{}
+	}
+
+	util.WriteJSONResponse(w, tombstones)
+}
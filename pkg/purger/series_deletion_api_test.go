@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package purger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+func TestDeleteSeries(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+
+	for name, tc := range map[string]struct {
+		form           url.Values
+		expectedStatus int
+		expectedStart  int64
+		expectedEnd    int64
+	}{
+		"no selector": {
+			form:           url.Values{"start": {"10"}, "end": {"20"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid selector": {
+			form:           url.Values{"match[]": {`{job=`}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid start time": {
+			form:           url.Values{"match[]": {`{job="a"}`}, "start": {"xxx"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"end time in the future": {
+			form:           url.Values{"match[]": {`{job="a"}`}, "end": {strconv.FormatInt(future, 10)}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"start time after end time": {
+			form:           url.Values{"match[]": {`{job="a"}`}, "start": {"20"}, "end": {"10"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"valid request": {
+			form:           url.Values{"match[]": {`{job="a"}`, `{job="b"}`}, "start": {"10"}, "end": {"2022-01-01T00:00:00Z"}},
+			expectedStatus: http.StatusNoContent,
+			expectedStart:  10000,
+			expectedEnd:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			api := newSeriesDeletionAPI(bkt, nil, log.NewNopLogger())
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/tsdb/delete_series", strings.NewReader(tc.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(user.InjectOrgID(context.Background(), "user"))
+
+			resp := httptest.NewRecorder()
+			api.DeleteSeries(resp, req)
+			require.Equal(t, tc.expectedStatus, resp.Code, resp.Body.String())
+
+			tombstones, err := tsdb.ReadTombstones(context.Background(), bkt, "user")
+			require.NoError(t, err)
+
+			if tc.expectedStatus != http.StatusNoContent {
+				assert.Empty(t, tombstones)
+				return
+			}
+
+			require.Len(t, tombstones, 1)
+			assert.Equal(t, tc.expectedStart, tombstones[0].StartTime)
+			assert.Equal(t, tc.expectedEnd, tombstones[0].EndTime)
+			assert.Equal(t, tc.form["match[]"], tombstones[0].Selectors)
+			assert.Equal(t, tsdb.TombstonePending, tombstones[0].State)
+		})
+	}
+}
+
+func TestDeleteSeries_ShouldNotDuplicatePendingRequests(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	api := newSeriesDeletionAPI(bkt, nil, log.NewNopLogger())
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	deleteSeries := func() {
+		req := httptest.NewRequest(http.MethodPost, `/api/v1/admin/tsdb/delete_series?match[]={job="a"}&start=10&end=20`, nil)
+		resp := httptest.NewRecorder()
+		api.DeleteSeries(resp, req.WithContext(ctx))
+		require.Equal(t, http.StatusNoContent, resp.Code)
+	}
+
+	deleteSeries()
+	tombstones, err := tsdb.ReadTombstones(ctx, bkt, "user")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 1)
+	original := tombstones[0]
+
+	// Sending the same request again while pending keeps the original request.
+	deleteSeries()
+	tombstones, err = tsdb.ReadTombstones(ctx, bkt, "user")
+	require.NoError(t, err)
+	assert.Equal(t, tsdb.Tombstones{original}, tombstones)
+
+	// Sending the same request again once processed makes it pending again.
+	original.State = tsdb.TombstoneProcessed
+	require.NoError(t, tsdb.WriteTombstone(ctx, bkt, "user", nil, original))
+
+	deleteSeries()
+	tombstones, err = tsdb.ReadTombstones(ctx, bkt, "user")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 1)
+	assert.Equal(t, original.RequestID, tombstones[0].RequestID)
+	assert.Equal(t, tsdb.TombstonePending, tombstones[0].State)
+}
+
+func TestGetSeriesDeletionRequests(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	api := newSeriesDeletionAPI(bkt, nil, log.NewNopLogger())
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	{
+		resp := httptest.NewRecorder()
+		api.GetSeriesDeletionRequests(resp, &http.Request{})
+		require.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+
+	{
+		resp := httptest.NewRecorder()
+		api.GetSeriesDeletionRequests(resp, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `[]`, resp.Body.String())
+	}
+
+	tombstone, err := tsdb.NewTombstone(10, 20, []string{`{job="a"}`}, time.UnixMilli(1000))
+	require.NoError(t, err)
+	require.NoError(t, tsdb.WriteTombstone(ctx, bkt, "user", nil, tombstone))
+
+	{
+		resp := httptest.NewRecorder()
+		api.GetSeriesDeletionRequests(resp, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `[{
+			"request_id": "`+tombstone.RequestID+`",
+			"start_time": 10,
+			"end_time": 20,
+			"selectors": ["{job=\"a\"}"],
+			"request_created_at": 1000,
+			"state_created_at": 1000,
+			"state": "pending"
+		}]`, resp.Body.String())
+	}
+}
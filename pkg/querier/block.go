@@ -8,11 +8,13 @@ package querier
 import (
 	"math"
 	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 
@@ -43,11 +45,37 @@ func convertMatchersToLabelMatcher(matchers []*labels.Matcher) []storepb.LabelMa
 	return converted
 }
 
+// aggrsFromFunc returns the aggregates of the downsampled chunks to read, based on the function
+// wrapping the series selector.
+func aggrsFromFunc(f string) []storepb.Aggr {
+	if f == "min" || strings.HasPrefix(f, "min_") {
+		return []storepb.Aggr{storepb.Aggr_MIN}
+	}
+	if f == "max" || strings.HasPrefix(f, "max_") {
+		return []storepb.Aggr{storepb.Aggr_MAX}
+	}
+	if f == "count" || strings.HasPrefix(f, "count_") {
+		return []storepb.Aggr{storepb.Aggr_COUNT}
+	}
+	// The "sum" function falls through here because it needs the actual samples.
+	if strings.HasPrefix(f, "sum_") {
+		return []storepb.Aggr{storepb.Aggr_SUM}
+	}
+	if f == "increase" || f == "rate" || f == "irate" || f == "resets" {
+		return []storepb.Aggr{storepb.Aggr_COUNTER}
+	}
+	// In all the other cases, the samples are the average computed from the count and sum.
+	return []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}
+}
+
 // Implementation of storage.SeriesSet, based on individual responses from store client.
 type blockQuerierSeriesSet struct {
 	series   []*storepb.Series
 	warnings storage.Warnings
 
+	// The aggregates of the downsampled chunks, if any.
+	aggrs []storepb.Aggr
+
 	// next response to process
 	next int
 
@@ -74,7 +102,9 @@ func (bqss *blockQuerierSeriesSet) Next() bool {
 		bqss.next++
 	}
 
-	bqss.currSeries = newBlockQuerierSeries(currLabels, currChunks)
+	series := newBlockQuerierSeries(currLabels, currChunks)
+	series.aggrs = bqss.aggrs
+	bqss.currSeries = series
 	return true
 }
 
@@ -102,6 +132,7 @@ func newBlockQuerierSeries(lbls []labels.Label, chunks []storepb.AggrChunk) *blo
 type blockQuerierSeries struct {
 	labels labels.Labels
 	chunks []storepb.AggrChunk
+	aggrs  []storepb.Aggr
 }
 
 func (bqs *blockQuerierSeries) Labels() labels.Labels {
@@ -115,8 +146,20 @@ func (bqs *blockQuerierSeries) Iterator() chunkenc.Iterator {
 	}
 
 	its := make([]iteratorWithMaxTime, 0, len(bqs.chunks))
+	downsampled := false
 
 	for _, c := range bqs.chunks {
+		if c.Raw == nil {
+			it, err := newAggrChunkIterator(c, bqs.aggrs)
+			if err != nil {
+				return series.NewErrIterator(errors.Wrapf(err, "failed to initialize downsampled chunk (series: %v min time: %d max time: %d)", bqs.Labels(), c.MinTime, c.MaxTime))
+			}
+
+			its = append(its, iteratorWithMaxTime{it, c.MaxTime})
+			downsampled = true
+			continue
+		}
+
 		ch, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
 		if err != nil {
 			return series.NewErrIterator(errors.Wrapf(err, "failed to initialize chunk from XOR encoded raw data (series: %v min time: %d max time: %d)", bqs.Labels(), c.MinTime, c.MaxTime))
@@ -126,9 +169,85 @@ func (bqs *blockQuerierSeries) Iterator() chunkenc.Iterator {
 		its = append(its, iteratorWithMaxTime{it, c.MaxTime})
 	}
 
+	// The counter aggregate of the downsampled chunks doesn't include the counter resets across chunks,
+	// so they have to be applied while iterating the whole series.
+	if downsampled && len(bqs.aggrs) == 1 && bqs.aggrs[0] == storepb.Aggr_COUNTER {
+		chks := make([]chunkenc.Iterator, 0, len(its))
+		for _, it := range its {
+			chks = append(chks, it.Iterator)
+		}
+		return downsample.NewApplyCounterResetsIterator(chks...)
+	}
+
 	return newBlockQuerierSeriesIterator(bqs.Labels(), its)
 }
 
+// newAggrChunkIterator returns an iterator on the aggregates of the downsampled chunk.
+func newAggrChunkIterator(c storepb.AggrChunk, aggrs []storepb.Aggr) (chunkenc.Iterator, error) {
+	get := func(aggr storepb.Aggr) (chunkenc.Iterator, error) {
+		var x *storepb.Chunk
+		switch aggr {
+		case storepb.Aggr_COUNT:
+			x = c.Count
+		case storepb.Aggr_SUM:
+			x = c.Sum
+		case storepb.Aggr_MIN:
+			x = c.Min
+		case storepb.Aggr_MAX:
+			x = c.Max
+		case storepb.Aggr_COUNTER:
+			x = c.Counter
+		}
+		if x == nil {
+			return nil, errors.Errorf("aggregate %s not found", aggr)
+		}
+
+		ch, err := chunkenc.FromData(chunkenc.EncXOR, x.Data)
+		if err != nil {
+			return nil, err
+		}
+		return ch.Iterator(nil), nil
+	}
+
+	switch {
+	case len(aggrs) == 1:
+		return get(aggrs[0])
+
+	case len(aggrs) == 2 && ((aggrs[0] == storepb.Aggr_COUNT && aggrs[1] == storepb.Aggr_SUM) || (aggrs[0] == storepb.Aggr_SUM && aggrs[1] == storepb.Aggr_COUNT)):
+		cnt, err := get(storepb.Aggr_COUNT)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := get(storepb.Aggr_SUM)
+		if err != nil {
+			return nil, err
+		}
+		return newAverageChunkIterator(cnt, sum)
+
+	default:
+		return nil, errors.Errorf("unexpected aggregates %v", aggrs)
+	}
+}
+
+// newAverageChunkIterator returns an iterator over the averages of the count and sum aggregates. The averages
+// are encoded in a new chunk, because downsample.AverageChunkIterator doesn't support seeking.
+func newAverageChunkIterator(cnt, sum chunkenc.Iterator) (chunkenc.Iterator, error) {
+	chk := chunkenc.NewXORChunk()
+	app, err := chk.Appender()
+	if err != nil {
+		return nil, err
+	}
+
+	it := downsample.NewAverageChunkIterator(cnt, sum)
+	for it.Next() {
+		app.Append(it.At())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return chk.Iterator(nil), nil
+}
+
 func newBlockQuerierSeriesIterator(labels labels.Labels, its []iteratorWithMaxTime) *blockQuerierSeriesIterator {
 	return &blockQuerierSeriesIterator{labels: labels, iterators: its, lastT: math.MinInt64}
 }
@@ -103,6 +103,73 @@ func TestBlockQuerierSeries(t *testing.T) {
 	}
 }
 
+func TestBlockQuerierSeries_Downsampled(t *testing.T) {
+	t.Parallel()
+
+	xorChunk := func(samples ...promql.Point) *storepb.Chunk {
+		chunk := chunkenc.NewXORChunk()
+		appender, err := chunk.Appender()
+		require.NoError(t, err)
+		for _, s := range samples {
+			appender.Append(s.T, s.V)
+		}
+		return &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chunk.Bytes()}
+	}
+
+	chunks := []storepb.AggrChunk{
+		{MinTime: 1000, MaxTime: 2000, Raw: xorChunk(promql.Point{T: 1000, V: 1}, promql.Point{T: 2000, V: 2})},
+		{
+			MinTime: 300000,
+			MaxTime: 600000,
+			Count:   xorChunk(promql.Point{T: 300000, V: 2}, promql.Point{T: 600000, V: 4}),
+			Sum:     xorChunk(promql.Point{T: 300000, V: 10}, promql.Point{T: 600000, V: 40}),
+			Min:     xorChunk(promql.Point{T: 300000, V: 3}, promql.Point{T: 600000, V: 5}),
+		},
+	}
+
+	tests := map[string]struct {
+		aggrs           []storepb.Aggr
+		expectedSamples []promql.Point
+		expectedErr     string
+	}{
+		"min aggregate": {
+			aggrs:           []storepb.Aggr{storepb.Aggr_MIN},
+			expectedSamples: []promql.Point{{T: 1000, V: 1}, {T: 2000, V: 2}, {T: 300000, V: 3}, {T: 600000, V: 5}},
+		},
+		"average from count and sum aggregates": {
+			aggrs:           []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM},
+			expectedSamples: []promql.Point{{T: 1000, V: 1}, {T: 2000, V: 2}, {T: 300000, V: 5}, {T: 600000, V: 10}},
+		},
+		"missing aggregate": {
+			aggrs:       []storepb.Aggr{storepb.Aggr_MAX},
+			expectedErr: "failed to initialize downsampled chunk (series: {foo=\"bar\"} min time: 300000 max time: 600000): aggregate MAX not found",
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			series := newBlockQuerierSeries(mkLabels("foo", "bar"), append([]storepb.AggrChunk(nil), chunks...))
+			series.aggrs = testData.aggrs
+
+			var actual []promql.Point
+			it := series.Iterator()
+			for it.Next() {
+				ts, val := it.At()
+				actual = append(actual, promql.Point{T: ts, V: val})
+			}
+
+			if testData.expectedErr != "" {
+				require.EqualError(t, it.Err(), testData.expectedErr)
+				return
+			}
+			require.NoError(t, it.Err())
+			assert.Equal(t, testData.expectedSamples, actual)
+		})
+	}
+}
+
 func mockTSDBChunkData() []byte {
 	chunk := chunkenc.NewXORChunk()
 	appender, err := chunk.Appender()
@@ -28,6 +28,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -377,7 +378,7 @@ func (q *blocksStoreQuerier) LabelNames(matchers ...*labels.Matcher) ([]string,
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc)
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, downsample.ResLevel0, nil, queryFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -418,7 +419,7 @@ func (q *blocksStoreQuerier) LabelValues(name string, matchers ...*labels.Matche
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc)
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, downsample.ResLevel0, nil, queryFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -435,6 +436,7 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 	defer spanLog.Span.Finish()
 
 	minT, maxT := sp.Start, sp.End
+	maxResolution := maxResolutionFromHints(sp)
 
 	var (
 		convertedMatchers = convertMatchersToLabelMatcher(matchers)
@@ -451,7 +453,7 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 	}
 
 	queryFunc := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error) {
-		seriesSets, queriedBlocks, warnings, numChunks, err := q.fetchSeriesFromStores(spanCtx, sp, clients, minT, maxT, matchers, convertedMatchers, maxChunksLimit, leftChunksLimit)
+		seriesSets, queriedBlocks, warnings, numChunks, err := q.fetchSeriesFromStores(spanCtx, sp, clients, minT, maxT, maxResolution, matchers, convertedMatchers, maxChunksLimit, leftChunksLimit)
 		if err != nil {
 			return nil, err
 		}
@@ -468,7 +470,7 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		return queriedBlocks, nil
 	}
 
-	err = q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, shard, queryFunc)
+	err = q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, maxResolution, shard, queryFunc)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
 	}
@@ -482,7 +484,7 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		resWarnings)
 }
 
-func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT int64, shard *sharding.ShardSelector,
+func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT, maxResolution int64, shard *sharding.ShardSelector,
 	queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error)) error {
 	// If queryStoreAfter is enabled, we do manipulate the query maxt to query samples up until
 	// now - queryStoreAfter, because the most recent time range is covered by ingesters. This
@@ -518,6 +520,10 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 
 	q.metrics.blocksFound.Add(float64(len(knownBlocks)))
 
+	// Only query the blocks with the coarsest resolution compatible with the query. The store-gateway picks
+	// the blocks to query among the requested ones in the same way, given the same max resolution.
+	knownBlocks = filterBlocksByResolution(knownBlocks, minT, maxT, maxResolution)
+
 	if shard != nil && shard.ShardCount > 0 {
 		level.Debug(logger).Log("msg", "filtering blocks due to sharding", "blocksBeforeFiltering", knownBlocks.String(), "shardID", shard.LabelValue())
 
@@ -670,12 +676,91 @@ func canBlockWithCompactorShardIndexContainQueryShard(queryShardIndex, queryShar
 	return true, false
 }
 
+// downsampledSamplesPerStep is the min number of downsampled samples which must be covered by the step and
+// the range selectors of a query to run it on downsampled blocks.
+const downsampledSamplesPerStep = 5
+
+// maxResolutionFromHints returns the coarsest resolution of the blocks which can be used to run a query with the
+// given hints. Instant queries, and queries whose step or range selectors are smaller than a few downsampled
+// samples, only run on raw blocks.
+func maxResolutionFromHints(sp *storage.SelectHints) int64 {
+	if sp == nil || sp.Step <= 0 || sp.Func == "series" {
+		return downsample.ResLevel0
+	}
+
+	window := sp.Step
+	if sp.Range > 0 && sp.Range < window {
+		window = sp.Range
+	}
+	return window / downsampledSamplesPerStep
+}
+
+// filterBlocksByResolution returns the blocks with the coarsest resolution not higher than maxResolution, filling
+// the time ranges not covered by them with the blocks of the next finer resolutions. This is the same logic used by
+// the store-gateway to pick the blocks to query.
+//
+// This function returns the input slice if there are no downsampled blocks.
+func filterBlocksByResolution(blocks bucketindex.Blocks, minT, maxT, maxResolution int64) bucketindex.Blocks {
+	byResolution := map[int64]bucketindex.Blocks{}
+	for _, b := range blocks {
+		byResolution[b.Resolution] = append(byResolution[b.Resolution], b)
+	}
+	if len(byResolution[downsample.ResLevel0]) == len(blocks) {
+		return blocks
+	}
+
+	for _, res := range byResolution {
+		sort.Slice(res, func(i, j int) bool {
+			return res[i].MinTime < res[j].MinTime
+		})
+	}
+
+	// Find the coarsest resolution not higher than the max one.
+	resolutions := []int64{downsample.ResLevel2, downsample.ResLevel1, downsample.ResLevel0}
+	for len(resolutions) > 1 && resolutions[0] > maxResolution {
+		resolutions = resolutions[1:]
+	}
+
+	return getBlocksForResolutions(byResolution, resolutions, minT, maxT)
+}
+
+func getBlocksForResolutions(byResolution map[int64]bucketindex.Blocks, resolutions []int64, minT, maxT int64) (res bucketindex.Blocks) {
+	if minT > maxT {
+		return nil
+	}
+
+	// The blocks of the current resolution may not cover the whole time range,
+	// so the gaps are filled with the blocks of the next finer resolution.
+	start := minT
+	for _, b := range byResolution[resolutions[0]] {
+		// NOTE: Block intervals are half-open: [MinTime, MaxTime).
+		if b.MaxTime <= minT {
+			continue
+		}
+		if b.MinTime > maxT {
+			break
+		}
+
+		if len(resolutions) > 1 {
+			res = append(res, getBlocksForResolutions(byResolution, resolutions[1:], start, b.MinTime-1)...)
+		}
+		res = append(res, b)
+		start = b.MaxTime
+	}
+
+	if len(resolutions) > 1 {
+		res = append(res, getBlocksForResolutions(byResolution, resolutions[1:], start, maxT)...)
+	}
+	return res
+}
+
 func (q *blocksStoreQuerier) fetchSeriesFromStores(
 	ctx context.Context,
 	sp *storage.SelectHints,
 	clients map[BlocksStoreClient][]ulid.ULID,
 	minT int64,
 	maxT int64,
+	maxResolution int64,
 	matchers []*labels.Matcher,
 	convertedMatchers []storepb.LabelMatcher,
 	maxChunksLimit int,
@@ -707,7 +792,13 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 			// But this is an acceptable workaround for now.
 			skipChunks := sp != nil && sp.Func == "series"
 
-			req, err := createSeriesRequest(minT, maxT, convertedMatchers, skipChunks, blockIDs)
+			// The aggregates of the downsampled chunks are only needed if downsampled blocks can be queried.
+			var aggrs []storepb.Aggr
+			if maxResolution > downsample.ResLevel0 {
+				aggrs = aggrsFromFunc(sp.Func)
+			}
+
+			req, err := createSeriesRequest(minT, maxT, maxResolution, aggrs, convertedMatchers, skipChunks, blockIDs)
 			if err != nil {
 				return errors.Wrapf(err, "failed to create series request")
 			}
@@ -801,7 +892,7 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 
 			// Store the result.
 			mtx.Lock()
-			seriesSets = append(seriesSets, &blockQuerierSeriesSet{series: mySeries})
+			seriesSets = append(seriesSets, &blockQuerierSeriesSet{series: mySeries, aggrs: req.Aggregates})
 			warnings = append(warnings, myWarnings...)
 			queriedBlocks = append(queriedBlocks, myQueriedBlocks...)
 			mtx.Unlock()
@@ -976,7 +1067,7 @@ func (q *blocksStoreQuerier) fetchLabelValuesFromStore(
 	return valueSets, warnings, queriedBlocks, nil
 }
 
-func createSeriesRequest(minT, maxT int64, matchers []storepb.LabelMatcher, skipChunks bool, blockIDs []ulid.ULID) (*storepb.SeriesRequest, error) {
+func createSeriesRequest(minT, maxT, maxResolution int64, aggrs []storepb.Aggr, matchers []storepb.LabelMatcher, skipChunks bool, blockIDs []ulid.ULID) (*storepb.SeriesRequest, error) {
 	// Selectively query only specific blocks.
 	hints := &hintspb.SeriesRequestHints{
 		BlockMatchers: []storepb.LabelMatcher{
@@ -1000,6 +1091,8 @@ func createSeriesRequest(minT, maxT int64, matchers []storepb.LabelMatcher, skip
 		PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT,
 		Hints:                   anyHints,
 		SkipChunks:              skipChunks,
+		MaxResolutionWindow:     maxResolution,
+		Aggregates:              aggrs,
 	}, nil
 }
 
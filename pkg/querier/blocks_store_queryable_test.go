@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -1795,6 +1796,92 @@ func TestFilterBlocksByShard(t *testing.T) {
 	}
 }
 
+func TestMaxResolutionFromHints(t *testing.T) {
+	for name, tc := range map[string]struct {
+		hints    *storage.SelectHints
+		expected int64
+	}{
+		"no hints": {
+			hints:    nil,
+			expected: downsample.ResLevel0,
+		},
+		"instant query": {
+			hints:    &storage.SelectHints{Start: 0, End: 1000},
+			expected: downsample.ResLevel0,
+		},
+		"series query": {
+			hints:    &storage.SelectHints{Start: 0, End: 1000, Step: time.Hour.Milliseconds(), Func: "series"},
+			expected: downsample.ResLevel0,
+		},
+		"range query": {
+			hints:    &storage.SelectHints{Start: 0, End: 1000, Step: time.Hour.Milliseconds()},
+			expected: 12 * time.Minute.Milliseconds(),
+		},
+		"range query with range selector smaller than the step": {
+			hints:    &storage.SelectHints{Start: 0, End: 1000, Step: time.Hour.Milliseconds(), Range: 5 * time.Minute.Milliseconds(), Func: "rate"},
+			expected: time.Minute.Milliseconds(),
+		},
+		"range query with range selector larger than the step": {
+			hints:    &storage.SelectHints{Start: 0, End: 1000, Step: time.Hour.Milliseconds(), Range: 24 * time.Hour.Milliseconds(), Func: "rate"},
+			expected: 12 * time.Minute.Milliseconds(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, maxResolutionFromHints(tc.hints))
+		})
+	}
+}
+
+func TestFilterBlocksByResolution(t *testing.T) {
+	raw1 := &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: 0, MaxTime: 100}
+	raw2 := &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: 100, MaxTime: 200}
+	raw3 := &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: 200, MaxTime: 300}
+	res5m1 := &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: 0, MaxTime: 100, Resolution: downsample.ResLevel1}
+	res5m2 := &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: 100, MaxTime: 200, Resolution: downsample.ResLevel1}
+	res1h1 := &bucketindex.Block{ID: ulid.MustNew(ulid.Now(), crand.Reader), MinTime: 0, MaxTime: 100, Resolution: downsample.ResLevel2}
+
+	for name, tc := range map[string]struct {
+		blocks        bucketindex.Blocks
+		maxResolution int64
+		expected      bucketindex.Blocks
+	}{
+		"only raw blocks": {
+			blocks:        bucketindex.Blocks{raw2, raw1, raw3},
+			maxResolution: downsample.ResLevel2,
+			expected:      bucketindex.Blocks{raw2, raw1, raw3},
+		},
+		"raw resolution": {
+			blocks:        bucketindex.Blocks{raw1, raw2, raw3, res5m1, res5m2, res1h1},
+			maxResolution: downsample.ResLevel0,
+			expected:      bucketindex.Blocks{raw1, raw2, raw3},
+		},
+		"max resolution between raw and 5m": {
+			blocks:        bucketindex.Blocks{raw1, raw2, raw3, res5m1, res5m2, res1h1},
+			maxResolution: time.Minute.Milliseconds(),
+			expected:      bucketindex.Blocks{raw1, raw2, raw3},
+		},
+		"5m resolution": {
+			blocks:        bucketindex.Blocks{raw1, raw2, raw3, res5m1, res5m2, res1h1},
+			maxResolution: downsample.ResLevel1,
+			expected:      bucketindex.Blocks{res5m1, res5m2, raw3},
+		},
+		"1h resolution": {
+			blocks:        bucketindex.Blocks{raw1, raw2, raw3, res5m1, res5m2, res1h1},
+			maxResolution: downsample.ResLevel2,
+			expected:      bucketindex.Blocks{res1h1, res5m2, raw3},
+		},
+		"1h resolution without 5m blocks": {
+			blocks:        bucketindex.Blocks{raw1, raw2, raw3, res1h1},
+			maxResolution: downsample.ResLevel2,
+			expected:      bucketindex.Blocks{res1h1, raw2, raw3},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, filterBlocksByResolution(tc.blocks, 0, 299, tc.maxResolution))
+		})
+	}
+}
+
 type blocksStoreSetMock struct {
 	services.Service
 
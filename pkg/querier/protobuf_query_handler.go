@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gogo/status"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/httputil"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// QueryEngine is the PromQL engine used to run the queries.
+type QueryEngine interface {
+	NewInstantQuery(q storage.Queryable, opts *promql.QueryOpts, qs string, ts time.Time) (promql.Query, error)
+	NewRangeQuery(q storage.Queryable, opts *promql.QueryOpts, qs string, start, end time.Time, interval time.Duration) (promql.Query, error)
+}
+
+type protobufQueryHandler struct {
+	engine    QueryEngine
+	queryable storage.Queryable
+	next      http.Handler
+	logger    log.Logger
+}
+
+// NewProtobufQueryHandler returns the handler of the range and instant queries whose results are requested
+// in the protobuf format with the Accept header, which are encoded as a mimirpb.QueryResponse instead of JSON.
+// The requests are handled like the Prometheus API does, including the timeout parameter and the warnings
+// of the query. The requests not accepting protobuf, and the ones requesting the query statistics with the
+// stats parameter, are passed to next, which is the Prometheus API.
+func NewProtobufQueryHandler(engine QueryEngine, queryable storage.Queryable, next http.Handler, logger log.Logger) http.Handler {
+	return &protobufQueryHandler{
+		engine:    engine,
+		queryable: queryable,
+		next:      next,
+		logger:    logger,
+	}
+}
+
+func (h *protobufQueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !acceptsProtobufQueryResponse(r) || r.FormValue("stats") != "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	log, ctx := spanlogger.NewWithLogger(r.Context(), h.logger, "protobufQueryHandler.ServeHTTP")
+	defer log.Finish()
+
+	qry, timeout, err := h.newQuery(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	// The samples of the result may be reused by the engine once the query has been closed,
+	// so it can only be closed after the response has been written.
+	defer qry.Close()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	res := qry.Exec(httputil.ContextFromRequest(ctx, r))
+	if res.Err != nil {
+		h.writeError(w, queryExecutionError(res.Err))
+		return
+	}
+
+	resp := &mimirpb.QueryResponse{ResultType: string(res.Value.Type())}
+	if resp.Result, err = queryResponseSeries(res.Value); err != nil {
+		h.writeError(w, apierror.New(apierror.TypeInternal, err.Error()))
+		return
+	}
+	for _, warning := range res.Warnings {
+		resp.Warnings = append(resp.Warnings, warning.Error())
+	}
+
+	b, err := resp.Marshal()
+	if err != nil {
+		h.writeError(w, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", mimirpb.QueryResponseMediaType)
+	w.WriteHeader(http.StatusOK)
+	if n, err := w.Write(b); err != nil {
+		level.Error(log).Log("msg", "error writing response", "bytes_written", n, "err", err)
+	}
+}
+
+// newQuery parses the parameters of the range or instant query like the Prometheus API does, and
+// returns the query and its timeout, which is 0 if the timeout parameter isn't set.
+func (h *protobufQueryHandler) newQuery(r *http.Request) (promql.Query, time.Duration, error) {
+	if !strings.HasSuffix(r.URL.Path, "/query_range") {
+		ts := time.Now()
+		if t := r.FormValue("time"); t != "" {
+			var err error
+			if ts, err = parseTime(t); err != nil {
+				return nil, 0, invalidParamError(errors.Wrap(err, "Invalid time value for 'time'"), "time")
+			}
+		}
+		timeout, err := parseTimeout(r)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		qry, err := h.engine.NewInstantQuery(h.queryable, nil, r.FormValue("query"), ts)
+		if err != nil {
+			return nil, 0, invalidParamError(err, "query")
+		}
+		return qry, timeout, nil
+	}
+
+	start, err := parseTime(r.FormValue("start"))
+	if err != nil {
+		return nil, 0, invalidParamError(err, "start")
+	}
+	end, err := parseTime(r.FormValue("end"))
+	if err != nil {
+		return nil, 0, invalidParamError(err, "end")
+	}
+	if end.Before(start) {
+		return nil, 0, invalidParamError(errors.New("end timestamp must not be before start time"), "end")
+	}
+
+	step, err := parseDuration(r.FormValue("step"))
+	if err != nil {
+		return nil, 0, invalidParamError(err, "step")
+	}
+	if step <= 0 {
+		return nil, 0, invalidParamError(errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer"), "step")
+	}
+	if end.Sub(start)/step > util.MaxQueryResolutionPoints {
+		return nil, 0, apierror.New(apierror.TypeBadData, "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")
+	}
+	timeout, err := parseTimeout(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	qry, err := h.engine.NewRangeQuery(h.queryable, nil, r.FormValue("query"), start, end, step)
+	if err != nil {
+		return nil, 0, invalidParamError(err, "query")
+	}
+	return qry, timeout, nil
+}
+
+// writeError writes the error in the JSON format, like the Prometheus API does, which is
+// decoded by the query-frontend whatever the requested format is.
+func (h *protobufQueryHandler) writeError(w http.ResponseWriter, err error) {
+	res, ok := apierror.HTTPResponseFromError(err)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, header := range res.Headers {
+		w.Header()[header.Key] = header.Values
+	}
+	w.WriteHeader(int(res.Code))
+	if n, err := w.Write(res.Body); err != nil {
+		level.Error(h.logger).Log("msg", "error writing response", "bytes_written", n, "err", err)
+	}
+}
+
+// queryResponseSeries converts the result of a query to the series of a mimirpb.QueryResponse.
+func queryResponseSeries(v parser.Value) ([]mimirpb.QueryResponseSeries, error) {
+	switch v := v.(type) {
+	case promql.String:
+		return []mimirpb.QueryResponseSeries{{
+			Labels:  []mimirpb.LabelAdapter{{Name: "value", Value: v.V}},
+			Samples: []mimirpb.Sample{{TimestampMs: v.T}},
+		}}, nil
+
+	case promql.Scalar:
+		return []mimirpb.QueryResponseSeries{{
+			Samples: []mimirpb.Sample{{TimestampMs: v.T, Value: v.V}},
+		}}, nil
+
+	case promql.Vector:
+		res := make([]mimirpb.QueryResponseSeries, 0, len(v))
+		for _, sample := range v {
+			res = append(res, mimirpb.QueryResponseSeries{
+				Labels:  mimirpb.FromLabelsToLabelAdapters(sample.Metric),
+				Samples: []mimirpb.Sample{{TimestampMs: sample.Point.T, Value: sample.Point.V}},
+			})
+		}
+		return res, nil
+
+	case promql.Matrix:
+		res := make([]mimirpb.QueryResponseSeries, 0, len(v))
+		for _, series := range v {
+			res = append(res, mimirpb.QueryResponseSeries{
+				Labels:  mimirpb.FromLabelsToLabelAdapters(series.Metric),
+				Samples: mimirpb.FromPointsToSamples(series.Points),
+			})
+		}
+		return res, nil
+	}
+
+	return nil, errors.Errorf("unexpected value type: %s", v.Type())
+}
+
+// queryExecutionError maps the error of a query execution to the API error returned by the Prometheus API.
+func queryExecutionError(err error) error {
+	cause := errors.Unwrap(err)
+	if cause == nil {
+		cause = err
+	}
+
+	switch cause.(type) {
+	case promql.ErrQueryCanceled:
+		return apierror.New(apierror.TypeCanceled, err.Error())
+	case promql.ErrQueryTimeout:
+		return apierror.New(apierror.TypeTimeout, err.Error())
+	case promql.ErrStorage:
+		return apierror.New(apierror.TypeInternal, err.Error())
+	}
+	return apierror.New(apierror.TypeExec, err.Error())
+}
+
+func invalidParamError(err error, parameter string) error {
+	return apierror.Newf(apierror.TypeBadData, "invalid parameter %q: %v", parameter, err)
+}
+
+func parseTimeout(r *http.Request) (time.Duration, error) {
+	to := r.FormValue("timeout")
+	if to == "" {
+		return 0, nil
+	}
+
+	timeout, err := parseDuration(to)
+	if err != nil {
+		return 0, invalidParamError(err, "timeout")
+	}
+	return timeout, nil
+}
+
+// parseTime parses the timestamp with the same parser of the query-frontend, so that the
+// requests accepted by the query-frontend are accepted by the queriers too. The parser returns
+// gRPC errors, which are converted to plain errors to only return their message like Prometheus.
+func parseTime(s string) (time.Time, error) {
+	ms, err := util.ParseTime(s)
+	if err != nil {
+		return time.Time{}, errors.New(status.Convert(err).Message())
+	}
+	return util.TimeFromMillis(ms), nil
+}
+
+// parseDuration parses the duration with the same parser of the query-frontend.
+func parseDuration(s string) (time.Duration, error) {
+	ms, err := util.ParseDurationMs(s)
+	if err != nil {
+		return 0, errors.New(status.Convert(err).Message())
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// acceptsProtobufQueryResponse returns whether the protobuf format is the preferred format of the
+// query results accepted by the client, which is the first one listed in the Accept header
+// between JSON and protobuf.
+func acceptsProtobufQueryResponse(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, accepted := range strings.Split(value, ",") {
+			mediaType, _, err := mime.ParseMediaType(accepted)
+			if err != nil {
+				continue
+			}
+
+			switch mediaType {
+			case mimirpb.QueryResponseMediaType:
+				return true
+			case "application/json":
+				return false
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestProtobufQueryHandler(t *testing.T) {
+	db := teststorage.New(t)
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+	app := db.Appender(context.Background())
+	for _, series := range []labels.Labels{labels.FromStrings("__name__", "metric", "a", "1"), labels.FromStrings("__name__", "metric", "a", "2")} {
+		for ts := int64(0); ts <= 60; ts += 30 {
+			_, err := app.Append(0, series, ts*1000, float64(ts/30))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, app.Commit())
+
+	tests := map[string]struct {
+		path     string
+		params   url.Values
+		expected *mimirpb.QueryResponse
+	}{
+		"range query": {
+			path:   "/api/v1/query_range",
+			params: url.Values{"query": {`metric{a="1"}`}, "start": {"0"}, "end": {"60"}, "step": {"30s"}},
+			expected: &mimirpb.QueryResponse{
+				ResultType: model.ValMatrix.String(),
+				Result: []mimirpb.QueryResponseSeries{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "a", Value: "1"}},
+					Samples: []mimirpb.Sample{{TimestampMs: 0, Value: 0}, {TimestampMs: 30_000, Value: 1}, {TimestampMs: 60_000, Value: 2}},
+				}},
+			},
+		},
+		"instant query returning a vector": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`sum(metric)`}, "time": {"30"}},
+			expected: &mimirpb.QueryResponse{
+				ResultType: model.ValVector.String(),
+				Result:     []mimirpb.QueryResponseSeries{{Samples: []mimirpb.Sample{{TimestampMs: 30_000, Value: 2}}}},
+			},
+		},
+		"instant query returning a scalar": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`scalar(sum(metric))`}, "time": {"60"}},
+			expected: &mimirpb.QueryResponse{
+				ResultType: model.ValScalar.String(),
+				Result:     []mimirpb.QueryResponseSeries{{Samples: []mimirpb.Sample{{TimestampMs: 60_000, Value: 4}}}},
+			},
+		},
+		"instant query returning a string": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`"foo"`}, "time": {"60"}},
+			expected: &mimirpb.QueryResponse{
+				ResultType: model.ValString.String(),
+				Result: []mimirpb.QueryResponseSeries{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "value", Value: "foo"}},
+					Samples: []mimirpb.Sample{{TimestampMs: 60_000}},
+				}},
+			},
+		},
+		"query with warnings": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`metric{a="2"}`}, "time": {"60"}},
+			expected: &mimirpb.QueryResponse{
+				ResultType: model.ValVector.String(),
+				Result: []mimirpb.QueryResponseSeries{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "a", Value: "2"}},
+					Samples: []mimirpb.Sample{{TimestampMs: 60_000, Value: 2}},
+				}},
+				Warnings: []string{"partial result"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var queryable storage.Queryable = db
+			if len(tc.expected.Warnings) > 0 {
+				queryable = warningsQueryable{Queryable: db, warnings: tc.expected.Warnings}
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Fail(t, "the request should not be passed to the next handler")
+			})
+			handler := NewProtobufQueryHandler(newProtobufQueryHandlerTestEngine(), queryable, next, log.NewNopLogger())
+
+			req := httptest.NewRequest(http.MethodGet, tc.path+"?"+tc.params.Encode(), nil)
+			req.Header.Set("Accept", mimirpb.QueryResponseMediaType+", application/json")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.Equal(t, mimirpb.QueryResponseMediaType, recorder.Header().Get("Content-Type"))
+
+			actual := &mimirpb.QueryResponse{}
+			require.NoError(t, actual.Unmarshal(recorder.Body.Bytes()))
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestProtobufQueryHandler_ShouldReturnErrorsLikeThePrometheusAPI(t *testing.T) {
+	tests := map[string]struct {
+		path   string
+		params url.Values
+		err    error
+	}{
+		"invalid query": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`sum(`}},
+		},
+		"invalid time": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`up`}, "time": {"foo"}},
+		},
+		"invalid timeout": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`up`}, "timeout": {"foo"}},
+		},
+		"invalid start": {
+			path:   "/api/v1/query_range",
+			params: url.Values{"query": {`up`}, "start": {"foo"}, "end": {"60"}, "step": {"1"}},
+		},
+		"end before start": {
+			path:   "/api/v1/query_range",
+			params: url.Values{"query": {`up`}, "start": {"60"}, "end": {"0"}, "step": {"1"}},
+		},
+		"negative step": {
+			path:   "/api/v1/query_range",
+			params: url.Values{"query": {`up`}, "start": {"0"}, "end": {"60"}, "step": {"-1"}},
+		},
+		"too many points": {
+			path:   "/api/v1/query_range",
+			params: url.Values{"query": {`up`}, "start": {"0"}, "end": {"86400"}, "step": {"1"}},
+		},
+		"query timeout": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`up`}, "timeout": {"1ns"}},
+		},
+		"storage error": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`up`}},
+			err:    promql.ErrStorage{Err: errors.New("storage error")},
+		},
+		"execution error": {
+			path:   "/api/v1/query",
+			params: url.Values{"query": {`up`}},
+			err:    errors.New("execution error"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			queryable := errorTestQueryable{q: errorTestQuerier{s: storage.EmptySeriesSet()}}
+			if tc.err != nil {
+				queryable = errorTestQueryable{err: tc.err}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tc.path+"?"+tc.params.Encode(), nil)
+			expected := httptest.NewRecorder()
+			createPrometheusAPI(queryable).ServeHTTP(expected, req)
+
+			req = httptest.NewRequest(http.MethodGet, tc.path+"?"+tc.params.Encode(), nil)
+			req.Header.Set("Accept", mimirpb.QueryResponseMediaType)
+			actual := httptest.NewRecorder()
+			NewProtobufQueryHandler(newProtobufQueryHandlerTestEngine(), queryable, http.NotFoundHandler(), log.NewNopLogger()).ServeHTTP(actual, req)
+
+			require.NotEqual(t, http.StatusOK, expected.Code)
+			assert.Equal(t, expected.Code, actual.Code)
+			assert.Equal(t, "application/json", actual.Header().Get("Content-Type"))
+			assert.JSONEq(t, expected.Body.String(), actual.Body.String())
+		})
+	}
+}
+
+func TestProtobufQueryHandler_ShouldPassRequestsToNext(t *testing.T) {
+	tests := map[string]struct {
+		accept []string
+		params url.Values
+	}{
+		"no Accept header": {
+			params: url.Values{"query": {"up"}},
+		},
+		"JSON preferred to protobuf": {
+			accept: []string{"application/json, " + mimirpb.QueryResponseMediaType},
+			params: url.Values{"query": {"up"}},
+		},
+		"query statistics requested": {
+			accept: []string{mimirpb.QueryResponseMediaType},
+			params: url.Values{"query": {"up"}, "stats": {"all"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			nextCalled := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+			})
+			handler := NewProtobufQueryHandler(newProtobufQueryHandlerTestEngine(), errorTestQueryable{}, next, log.NewNopLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/query?"+tc.params.Encode(), nil)
+			req.Header["Accept"] = tc.accept
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.True(t, nextCalled)
+		})
+	}
+}
+
+func TestAcceptsProtobufQueryResponse(t *testing.T) {
+	tests := map[string]struct {
+		accept   []string
+		expected bool
+	}{
+		"no Accept header": {
+			expected: false,
+		},
+		"protobuf only": {
+			accept:   []string{mimirpb.QueryResponseMediaType},
+			expected: true,
+		},
+		"protobuf preferred to JSON": {
+			accept:   []string{mimirpb.QueryResponseMediaType + ", application/json"},
+			expected: true,
+		},
+		"protobuf preferred to JSON in different headers": {
+			accept:   []string{mimirpb.QueryResponseMediaType, "application/json"},
+			expected: true,
+		},
+		"JSON preferred to protobuf": {
+			accept:   []string{"text/plain, application/json;q=0.9, " + mimirpb.QueryResponseMediaType},
+			expected: false,
+		},
+		"any media type": {
+			accept:   []string{"*/*"},
+			expected: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/query", nil)
+			req.Header["Accept"] = tc.accept
+			assert.Equal(t, tc.expected, acceptsProtobufQueryResponse(req))
+		})
+	}
+}
+
+func newProtobufQueryHandlerTestEngine() *promql.Engine {
+	return promql.NewEngine(promql.EngineOpts{
+		Logger:     log.NewNopLogger(),
+		MaxSamples: 100,
+		Timeout:    5 * time.Second,
+	})
+}
+
+// warningsQueryable is a storage.Queryable whose series sets return the input warnings.
+type warningsQueryable struct {
+	storage.Queryable
+	warnings []string
+}
+
+func (q warningsQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	querier, err := q.Queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return warningsQuerier{Querier: querier, warnings: q.warnings}, nil
+}
+
+type warningsQuerier struct {
+	storage.Querier
+	warnings []string
+}
+
+func (q warningsQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	return warningsSeriesSet{SeriesSet: q.Querier.Select(sortSeries, hints, matchers...), warnings: q.warnings}
+}
+
+type warningsSeriesSet struct {
+	storage.SeriesSet
+	warnings []string
+}
+
+func (s warningsSeriesSet) Warnings() storage.Warnings {
+	var warnings storage.Warnings
+	for _, warning := range s.warnings {
+		warnings = append(warnings, errors.New(warning))
+	}
+	return warnings
+}
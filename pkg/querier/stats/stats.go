@@ -123,6 +123,22 @@ func (s *Stats) LoadShardedQueries() uint32 {
 	return atomic.LoadUint32(&s.ShardedQueries)
 }
 
+func (s *Stats) AddEstimatedQueryCost(cost uint64) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddUint64(&s.EstimatedQueryCost, cost)
+}
+
+func (s *Stats) LoadEstimatedQueryCost() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&s.EstimatedQueryCost)
+}
+
 // Merge the provided Stats into this one.
 func (s *Stats) Merge(other *Stats) {
 	if s == nil || other == nil {
@@ -134,6 +150,7 @@ func (s *Stats) Merge(other *Stats) {
 	s.AddFetchedChunkBytes(other.LoadFetchedChunkBytes())
 	s.AddFetchedChunks(other.LoadFetchedChunks())
 	s.AddShardedQueries(other.LoadShardedQueries())
+	s.AddEstimatedQueryCost(other.LoadEstimatedQueryCost())
 }
 
 func ShouldTrackHTTPGRPCResponse(r *httpgrpc.HTTPResponse) bool {
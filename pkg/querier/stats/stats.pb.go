@@ -40,6 +40,9 @@ type Stats struct {
 	FetchedChunksCount uint64 `protobuf:"varint,4,opt,name=fetched_chunks_count,json=fetchedChunksCount,proto3" json:"fetched_chunks_count,omitempty"`
 	// The number of sharded queries executed. 0 if sharding is disabled or the query can't be sharded.
 	ShardedQueries uint32 `protobuf:"varint,5,opt,name=sharded_queries,json=shardedQueries,proto3" json:"sharded_queries,omitempty"`
+	// The cost of the query estimated by the query-frontend before its execution, as the number of
+	// series matching the query selectors multiplied by the number of steps. 0 if not estimated.
+	EstimatedQueryCost uint64 `protobuf:"varint,6,opt,name=estimated_query_cost,json=estimatedQueryCost,proto3" json:"estimated_query_cost,omitempty"`
 }
 
 func (m *Stats) Reset()      { *m = Stats{} }
@@ -109,6 +112,13 @@ func (m *Stats) GetShardedQueries() uint32 {
 	return 0
 }
 
+func (m *Stats) GetEstimatedQueryCost() uint64 {
+	if m != nil {
+		return m.EstimatedQueryCost
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Stats)(nil), "stats.Stats")
 }
@@ -116,27 +126,29 @@ func init() {
 func init() { proto.RegisterFile("stats.proto", fileDescriptor_b4756a0aec8b9d44) }
 
 var fileDescriptor_b4756a0aec8b9d44 = []byte{
-	// 320 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x91, 0xbd, 0x4e, 0xc3, 0x30,
-	0x14, 0x85, 0x7d, 0x4b, 0x8b, 0x4a, 0x2a, 0x40, 0x04, 0x86, 0xd0, 0xe1, 0xb6, 0x62, 0xa1, 0x0b,
-	0x2e, 0x82, 0x91, 0x05, 0xb5, 0xbc, 0x00, 0x2d, 0x13, 0x4b, 0x94, 0x1f, 0x37, 0x89, 0x68, 0x6b,
-	0x88, 0x6d, 0x21, 0x36, 0x26, 0x66, 0x46, 0x1e, 0x81, 0x47, 0xe9, 0xd8, 0xb1, 0x13, 0x50, 0x77,
-	0x61, 0xec, 0x23, 0xa0, 0x38, 0x89, 0x80, 0xcd, 0xe7, 0x7e, 0xf7, 0xf3, 0x91, 0x6c, 0xab, 0x21,
-	0xa4, 0x27, 0x05, 0xbd, 0x4f, 0xb9, 0xe4, 0x76, 0xcd, 0x84, 0xe6, 0x49, 0x94, 0xc8, 0x58, 0xf9,
-	0x34, 0xe0, 0x93, 0x6e, 0xc4, 0x23, 0xde, 0x35, 0xd4, 0x57, 0x23, 0x93, 0x4c, 0x30, 0xa7, 0xdc,
-	0x6a, 0x62, 0xc4, 0x79, 0x34, 0x66, 0xbf, 0x5b, 0xa1, 0x4a, 0x3d, 0x99, 0xf0, 0x69, 0xce, 0x8f,
-	0x5e, 0x2a, 0x56, 0x6d, 0x98, 0x5d, 0x6c, 0x5f, 0x5a, 0x5b, 0x8f, 0xde, 0x78, 0xec, 0xca, 0x64,
-	0xc2, 0x1c, 0x68, 0x43, 0xa7, 0x71, 0x76, 0x48, 0x73, 0x9b, 0x96, 0x36, 0xbd, 0x2a, 0xec, 0x5e,
-	0x7d, 0xf6, 0xd1, 0x22, 0x6f, 0x9f, 0x2d, 0x18, 0xd4, 0x33, 0xeb, 0x26, 0x99, 0x30, 0xfb, 0xd4,
-	0x3a, 0x18, 0x31, 0x19, 0xc4, 0x2c, 0x74, 0x05, 0x4b, 0x13, 0x26, 0xdc, 0x80, 0xab, 0xa9, 0x74,
-	0x2a, 0x6d, 0xe8, 0x54, 0x07, 0x76, 0xc1, 0x86, 0x06, 0xf5, 0x33, 0x62, 0x53, 0x6b, 0xbf, 0x34,
-	0x82, 0x58, 0x4d, 0xef, 0x5c, 0xff, 0x49, 0x32, 0xe1, 0x6c, 0x18, 0x61, 0xaf, 0x40, 0xfd, 0x8c,
-	0xf4, 0x32, 0xf0, 0xb7, 0xc1, 0xec, 0x97, 0x0d, 0xd5, 0x7f, 0x0d, 0x46, 0x28, 0x1a, 0x8e, 0xad,
-	0x5d, 0x11, 0x7b, 0x69, 0xc8, 0x42, 0xf7, 0x41, 0x99, 0x66, 0xa7, 0xd6, 0x86, 0xce, 0xf6, 0x60,
-	0xa7, 0x18, 0x5f, 0xe7, 0xd3, 0xde, 0xc5, 0x7c, 0x89, 0x64, 0xb1, 0x44, 0xb2, 0x5e, 0x22, 0x3c,
-	0x6b, 0x84, 0x77, 0x8d, 0x30, 0xd3, 0x08, 0x73, 0x8d, 0xf0, 0xa5, 0x11, 0xbe, 0x35, 0x92, 0xb5,
-	0x46, 0x78, 0x5d, 0x21, 0x99, 0xaf, 0x90, 0x2c, 0x56, 0x48, 0x6e, 0xf3, 0x4f, 0xf1, 0x37, 0xcd,
-	0x03, 0x9d, 0xff, 0x04, 0x00, 0x00, 0xff, 0xff, 0x28, 0xab, 0xfa, 0xea, 0xb1, 0x01, 0x00, 0x00,
+	// 343 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x91, 0xbd, 0x52, 0xf2, 0x40,
+	0x14, 0x86, 0x77, 0xf9, 0x80, 0xe1, 0x0b, 0xa3, 0x8e, 0xd1, 0x22, 0x52, 0x1c, 0x18, 0x1b, 0x69,
+	0x0c, 0x8e, 0x96, 0x36, 0x0e, 0x78, 0x03, 0x82, 0x95, 0x4d, 0x26, 0x3f, 0x4b, 0x92, 0x91, 0xb0,
+	0x9a, 0x3d, 0x19, 0x87, 0xce, 0x4b, 0xb0, 0xf4, 0x12, 0xbc, 0x04, 0x2f, 0x81, 0x92, 0x92, 0x4a,
+	0x65, 0x69, 0x2c, 0xb9, 0x04, 0x67, 0x37, 0x89, 0x3f, 0x5d, 0xce, 0x79, 0xde, 0xe7, 0xbc, 0x33,
+	0x59, 0xa3, 0x29, 0xd0, 0x45, 0x61, 0xdf, 0xa5, 0x1c, 0xb9, 0x59, 0xd3, 0x43, 0xeb, 0x38, 0x8c,
+	0x31, 0xca, 0x3c, 0xdb, 0xe7, 0x49, 0x2f, 0xe4, 0x21, 0xef, 0x69, 0xea, 0x65, 0x63, 0x3d, 0xe9,
+	0x41, 0x7f, 0xe5, 0x56, 0x0b, 0x42, 0xce, 0xc3, 0x09, 0xfb, 0x49, 0x05, 0x59, 0xea, 0x62, 0xcc,
+	0xa7, 0x39, 0x3f, 0x7c, 0xad, 0x18, 0xb5, 0x91, 0x3a, 0x6c, 0x5e, 0x18, 0xff, 0x1f, 0xdc, 0xc9,
+	0xc4, 0xc1, 0x38, 0x61, 0x16, 0xed, 0xd0, 0x6e, 0xf3, 0xf4, 0xc0, 0xce, 0x6d, 0xbb, 0xb4, 0xed,
+	0xcb, 0xc2, 0xee, 0x37, 0xe6, 0x6f, 0x6d, 0xf2, 0xfc, 0xde, 0xa6, 0xc3, 0x86, 0xb2, 0xae, 0xe3,
+	0x84, 0x99, 0x27, 0xc6, 0xfe, 0x98, 0xa1, 0x1f, 0xb1, 0xc0, 0x11, 0x2c, 0x8d, 0x99, 0x70, 0x7c,
+	0x9e, 0x4d, 0xd1, 0xaa, 0x74, 0x68, 0xb7, 0x3a, 0x34, 0x0b, 0x36, 0xd2, 0x68, 0xa0, 0x88, 0x69,
+	0x1b, 0x7b, 0xa5, 0xe1, 0x47, 0xd9, 0xf4, 0xd6, 0xf1, 0x66, 0xc8, 0x84, 0xf5, 0x4f, 0x0b, 0xbb,
+	0x05, 0x1a, 0x28, 0xd2, 0x57, 0xe0, 0x77, 0x83, 0xce, 0x97, 0x0d, 0xd5, 0x3f, 0x0d, 0x5a, 0x28,
+	0x1a, 0x8e, 0x8c, 0x1d, 0x11, 0xb9, 0x69, 0xc0, 0x02, 0xe7, 0x3e, 0xd3, 0xcd, 0x56, 0xad, 0x43,
+	0xbb, 0x5b, 0xc3, 0xed, 0x62, 0x7d, 0x95, 0x6f, 0xd5, 0x69, 0x26, 0x30, 0x4e, 0x5c, 0x2c, 0xa2,
+	0x33, 0xc7, 0xe7, 0x02, 0xad, 0x7a, 0x7e, 0xfa, 0x9b, 0xa9, 0xfc, 0x6c, 0xc0, 0x05, 0xf6, 0xcf,
+	0x17, 0x2b, 0x20, 0xcb, 0x15, 0x90, 0xcd, 0x0a, 0xe8, 0xa3, 0x04, 0xfa, 0x22, 0x81, 0xce, 0x25,
+	0xd0, 0x85, 0x04, 0xfa, 0x21, 0x81, 0x7e, 0x4a, 0x20, 0x1b, 0x09, 0xf4, 0x69, 0x0d, 0x64, 0xb1,
+	0x06, 0xb2, 0x5c, 0x03, 0xb9, 0xc9, 0x9f, 0xd1, 0xab, 0xeb, 0x5f, 0x7a, 0xf6, 0x35, 0x00, 0x00,
+	0xd0, 0xbb, 0xad, 0xe3, 0x01, 0x00, 0x00,
 }
 
 func (this *Stats) Equal(that interface{}) bool {
@@ -173,19 +185,23 @@ func (this *Stats) Equal(that interface{}) bool {
 	if this.ShardedQueries != that1.ShardedQueries {
 		return false
 	}
+	if this.EstimatedQueryCost != that1.EstimatedQueryCost {
+		return false
+	}
 	return true
 }
 func (this *Stats) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 9)
+	s := make([]string, 0, 10)
 	s = append(s, "&stats.Stats{")
 	s = append(s, "WallTime: "+fmt.Sprintf("%#v", this.WallTime)+",\n")
 	s = append(s, "FetchedSeriesCount: "+fmt.Sprintf("%#v", this.FetchedSeriesCount)+",\n")
 	s = append(s, "FetchedChunkBytes: "+fmt.Sprintf("%#v", this.FetchedChunkBytes)+",\n")
 	s = append(s, "FetchedChunksCount: "+fmt.Sprintf("%#v", this.FetchedChunksCount)+",\n")
 	s = append(s, "ShardedQueries: "+fmt.Sprintf("%#v", this.ShardedQueries)+",\n")
+	s = append(s, "EstimatedQueryCost: "+fmt.Sprintf("%#v", this.EstimatedQueryCost)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -217,6 +233,11 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.EstimatedQueryCost != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.EstimatedQueryCost))
+		i--
+		dAtA[i] = 0x30
+	}
 	if m.ShardedQueries != 0 {
 		i = encodeVarintStats(dAtA, i, uint64(m.ShardedQueries))
 		i--
@@ -279,6 +300,9 @@ func (m *Stats) Size() (n int) {
 	if m.ShardedQueries != 0 {
 		n += 1 + sovStats(uint64(m.ShardedQueries))
 	}
+	if m.EstimatedQueryCost != 0 {
+		n += 1 + sovStats(uint64(m.EstimatedQueryCost))
+	}
 	return n
 }
 
@@ -293,11 +317,12 @@ func (this *Stats) String() string {
 		return "nil"
 	}
 	s := strings.Join([]string{`&Stats{`,
-		`WallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.WallTime), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`WallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.WallTime), "Duration", "durationpb.Duration", 1), `&`, ``, 1) + `,`,
 		`FetchedSeriesCount:` + fmt.Sprintf("%v", this.FetchedSeriesCount) + `,`,
 		`FetchedChunkBytes:` + fmt.Sprintf("%v", this.FetchedChunkBytes) + `,`,
 		`FetchedChunksCount:` + fmt.Sprintf("%v", this.FetchedChunksCount) + `,`,
 		`ShardedQueries:` + fmt.Sprintf("%v", this.ShardedQueries) + `,`,
+		`EstimatedQueryCost:` + fmt.Sprintf("%v", this.EstimatedQueryCost) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -448,6 +473,25 @@ func (m *Stats) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EstimatedQueryCost", wireType)
+			}
+			m.EstimatedQueryCost = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.EstimatedQueryCost |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStats(dAtA[iNdEx:])
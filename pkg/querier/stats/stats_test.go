@@ -98,6 +98,23 @@ func TestStats_AddShardedQueries(t *testing.T) {
 	})
 }
 
+func TestStats_AddEstimatedQueryCost(t *testing.T) {
+	t.Run("add and load estimated query cost", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.AddEstimatedQueryCost(100)
+		stats.AddEstimatedQueryCost(23)
+
+		assert.Equal(t, uint64(123), stats.LoadEstimatedQueryCost())
+	})
+
+	t.Run("add and load estimated query cost nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.AddEstimatedQueryCost(3)
+
+		assert.Equal(t, uint64(0), stats.LoadEstimatedQueryCost())
+	})
+}
+
 func TestStats_Merge(t *testing.T) {
 	t.Run("merge two stats objects", func(t *testing.T) {
 		stats1 := &Stats{}
@@ -106,6 +123,7 @@ func TestStats_Merge(t *testing.T) {
 		stats1.AddFetchedChunkBytes(42)
 		stats1.AddFetchedChunks(10)
 		stats1.AddShardedQueries(20)
+		stats1.AddEstimatedQueryCost(1000)
 
 		stats2 := &Stats{}
 		stats2.AddWallTime(time.Second)
@@ -113,6 +131,7 @@ func TestStats_Merge(t *testing.T) {
 		stats2.AddFetchedChunkBytes(100)
 		stats2.AddFetchedChunks(11)
 		stats2.AddShardedQueries(21)
+		stats2.AddEstimatedQueryCost(500)
 
 		stats1.Merge(stats2)
 
@@ -121,6 +140,7 @@ func TestStats_Merge(t *testing.T) {
 		assert.Equal(t, uint64(142), stats1.LoadFetchedChunkBytes())
 		assert.Equal(t, uint64(21), stats1.LoadFetchedChunks())
 		assert.Equal(t, uint32(41), stats1.LoadShardedQueries())
+		assert.Equal(t, uint64(1500), stats1.LoadEstimatedQueryCost())
 	})
 
 	t.Run("merge two nil stats objects", func(t *testing.T) {
@@ -134,5 +154,6 @@ func TestStats_Merge(t *testing.T) {
 		assert.Equal(t, uint64(0), stats1.LoadFetchedChunkBytes())
 		assert.Equal(t, uint64(0), stats1.LoadFetchedChunks())
 		assert.Equal(t, uint32(0), stats1.LoadShardedQueries())
+		assert.Equal(t, uint64(0), stats1.LoadEstimatedQueryCost())
 	})
 }
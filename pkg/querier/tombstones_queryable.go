@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+
+	"github.com/grafana/dskit/tenant"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// seriesRetentionLimits is the subset of the limits used to hide the samples expired by the series retention rules.
+type seriesRetentionLimits interface {
+	SeriesRetentionRules(userID string) []validation.SeriesRetentionRule
+}
+
+// newTombstonesQueryable returns a queryable filtering out the samples deleted by the series deletion
+// requests of the tenant, and the samples older than the retention period of the series retention rules.
+// The samples are filtered whatever their source is, because the ingesters may still hold them too, and
+// so are the samples of processed requests, because the blocks replaced by the ones rewritten by the
+// compactor are still queried until their deletion, after which the requests are done.
+func newTombstonesQueryable(next storage.Queryable, tombstones *mimir_tsdb.TombstonesLoader, limits seriesRetentionLimits) storage.Queryable {
+	return storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		q, err := next.Querier(ctx, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tombstonesQuerier{
+			Querier:    q,
+			ctx:        ctx,
+			mint:       mint,
+			maxt:       maxt,
+			tombstones: tombstones,
+			limits:     limits,
+		}, nil
+	})
+}
+
+type tombstonesQuerier struct {
+	storage.Querier
+
+	ctx        context.Context
+	mint, maxt int64
+	tombstones *mimir_tsdb.TombstonesLoader
+	limits     seriesRetentionLimits
+}
+
+// Select implements storage.Querier. The label names and values are not filtered, like Prometheus does.
+func (q *tombstonesQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	userID, err := tenant.TenantID(q.ctx)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	ts, err := q.tombstones.GetTombstones(q.ctx, userID)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	// The retention rules are applied as tombstones deleting the expired samples. The slice returned
+	// by the loader is shared, so it's copied before appending to it.
+	if rules := q.limits.SeriesRetentionRules(userID); len(rules) > 0 {
+		ts = append(mimir_tsdb.Tombstones(nil), ts...)
+		now := time.Now()
+		for _, rule := range rules {
+			t, err := mimir_tsdb.NewSeriesRetentionTombstone(rule.Matchers, time.Duration(rule.Retention), now)
+			if err != nil {
+				return storage.ErrSeriesSet(err)
+			}
+			ts = append(ts, t)
+		}
+	}
+
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = hints.Start, hints.End
+	}
+
+	set := q.Querier.Select(sortSeries, hints, matchers...)
+	if ts = ts.Overlapping(mint, maxt); len(ts) == 0 {
+		return set
+	}
+
+	return &tombstonesSeriesSet{SeriesSet: set, tombstones: ts, mint: mint, maxt: maxt}
+}
+
+// tombstonesSeriesSet filters out the deleted samples of the series, and the series whose
+// samples have all been deleted in the queried time range.
+type tombstonesSeriesSet struct {
+	storage.SeriesSet
+
+	tombstones mimir_tsdb.Tombstones
+	mint, maxt int64
+	curr       storage.Series
+}
+
+func (s *tombstonesSeriesSet) Next() bool {
+	for s.SeriesSet.Next() {
+		series := s.SeriesSet.At()
+
+		intervals := s.tombstones.DeletedIntervals(series.Labels())
+		if len(intervals) == 0 {
+			s.curr = series
+			return true
+		}
+
+		if isFullyDeleted(intervals, s.mint, s.maxt) {
+			continue
+		}
+
+		s.curr = &tombstonesSeries{Series: series, intervals: intervals}
+		return true
+	}
+	return false
+}
+
+func (s *tombstonesSeriesSet) At() storage.Series {
+	return s.curr
+}
+
+// isFullyDeleted returns whether the merged intervals include the whole [mint, maxt] range.
+func isFullyDeleted(intervals tombstones.Intervals, mint, maxt int64) bool {
+	for _, interval := range intervals {
+		if interval.Mint <= mint && interval.Maxt >= maxt {
+			return true
+		}
+	}
+	return false
+}
+
+type tombstonesSeries struct {
+	storage.Series
+
+	intervals tombstones.Intervals
+}
+
+func (s *tombstonesSeries) Iterator() chunkenc.Iterator {
+	// The iterator consumes the intervals, so it gets its own copy.
+	return &tsdb.DeletedIterator{
+		Iter:      s.Series.Iterator(),
+		Intervals: append(tombstones.Intervals(nil), s.intervals...),
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/weaveworks/common/user"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestTombstonesQueryable(t *testing.T) {
+	const userID = "user"
+
+	samples := func(timestamps ...int64) []model.SamplePair {
+		res := make([]model.SamplePair, 0, len(timestamps))
+		for _, ts := range timestamps {
+			res = append(res, model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(ts)})
+		}
+		return res
+	}
+
+	next := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{matrix: model.Matrix{
+			{Metric: model.Metric{"job": "a"}, Values: samples(0, 1000, 2000, 3000, 4000, 5000)},
+			{Metric: model.Metric{"job": "b"}, Values: samples(0, 1000, 2000, 3000, 4000, 5000)},
+			{Metric: model.Metric{"job": "c"}, Values: samples(0, 1000, 2000, 3000, 4000, 5000)},
+		}}, nil
+	})
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	for _, req := range []struct {
+		start, end int64
+		selector   string
+	}{
+		{start: 1000, end: 2000, selector: `{job="a"}`},
+		{start: 1500, end: 3000, selector: `{job=~"a|x"}`},
+		{start: 0, end: 10000, selector: `{job="b"}`},
+	} {
+		tombstone, err := mimir_tsdb.NewTombstone(req.start, req.end, []string{req.selector}, time.Now())
+		require.NoError(t, err)
+		require.NoError(t, mimir_tsdb.WriteTombstone(ctx, bkt, userID, nil, tombstone))
+	}
+
+	tests := map[string]struct {
+		userID   string
+		expected map[string][]model.SamplePair
+	}{
+		"tenant with series deletion requests": {
+			userID: userID,
+			expected: map[string][]model.SamplePair{
+				"a": samples(0, 4000, 5000),
+				"c": samples(0, 1000, 2000, 3000, 4000, 5000),
+			},
+		},
+		"tenant without series deletion requests": {
+			userID: "other",
+			expected: map[string][]model.SamplePair{
+				"a": samples(0, 1000, 2000, 3000, 4000, 5000),
+				"b": samples(0, 1000, 2000, 3000, 4000, 5000),
+				"c": samples(0, 1000, 2000, 3000, 4000, 5000),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			queryable := newTombstonesQueryable(next, mimir_tsdb.NewTombstonesLoader(bkt, time.Minute), mockSeriesRetentionLimits{})
+
+			q, err := queryable.Querier(user.InjectOrgID(ctx, tc.userID), 0, 5000)
+			require.NoError(t, err)
+
+			set := q.Select(true, &storage.SelectHints{Start: 0, End: 5000})
+			actual := map[string][]model.SamplePair{}
+			for set.Next() {
+				series := set.At()
+
+				var values []model.SamplePair
+				it := series.Iterator()
+				for it.Next() {
+					ts, v := it.At()
+					values = append(values, model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(v)})
+				}
+				require.NoError(t, it.Err())
+
+				actual[series.Labels().Get("job")] = values
+			}
+			require.NoError(t, set.Err())
+
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestTombstonesQueryable_SeriesRetentionRules(t *testing.T) {
+	const userID = "user"
+
+	now := time.Now()
+	samples := func(timestamps ...time.Time) []model.SamplePair {
+		res := make([]model.SamplePair, 0, len(timestamps))
+		for _, ts := range timestamps {
+			res = append(res, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: 1})
+		}
+		return res
+	}
+	allSamples := samples(now.Add(-3*time.Hour), now.Add(-90*time.Minute), now.Add(-30*time.Minute), now)
+
+	next := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{matrix: model.Matrix{
+			{Metric: model.Metric{"job": "debug"}, Values: allSamples},
+			{Metric: model.Metric{"job": "slo"}, Values: allSamples},
+			{Metric: model.Metric{"job": "other"}, Values: allSamples},
+		}}, nil
+	})
+
+	limits := mockSeriesRetentionLimits{userID: {
+		{Matchers: `{job="debug"}`, Retention: model.Duration(time.Hour)},
+		{Matchers: `{job=~"debug|slo"}`, Retention: model.Duration(2 * time.Hour)},
+	}}
+
+	// A tombstone loader isn't required to apply the series retention rules.
+	queryable := newTombstonesQueryable(next, nil, limits)
+
+	mint, maxt := now.Add(-4*time.Hour).UnixMilli(), now.UnixMilli()
+	q, err := queryable.Querier(user.InjectOrgID(context.Background(), userID), mint, maxt)
+	require.NoError(t, err)
+
+	set := q.Select(true, &storage.SelectHints{Start: mint, End: maxt})
+	actual := map[string][]model.SamplePair{}
+	for set.Next() {
+		series := set.At()
+
+		var values []model.SamplePair
+		it := series.Iterator()
+		for it.Next() {
+			ts, v := it.At()
+			values = append(values, model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(v)})
+		}
+		require.NoError(t, it.Err())
+
+		actual[series.Labels().Get("job")] = values
+	}
+	require.NoError(t, set.Err())
+
+	// The shortest retention period applies to the series matching more than one rule.
+	assert.Equal(t, map[string][]model.SamplePair{
+		"debug": allSamples[2:],
+		"slo":   allSamples[1:],
+		"other": allSamples,
+	}, actual)
+}
+
+type mockSeriesRetentionLimits map[string][]validation.SeriesRetentionRule
+
+func (m mockSeriesRetentionLimits) SeriesRetentionRules(userID string) []validation.SeriesRetentionRule {
+	return m[userID]
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// PriorityHeader is the HTTP header clients can set to choose the priority of their queries.
+const PriorityHeader = "X-Query-Priority"
+
+// Priority of a request in the tenant queue. Requests with a higher priority are dequeued first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+var priorityNames = [numPriorities]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	if p < 0 || int(p) >= numPriorities {
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority returns the Priority whose name is s.
+func ParsePriority(s string) (Priority, error) {
+	for p, name := range priorityNames {
+		if name == s {
+			return Priority(p), nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q", s)
+}
+
+// RequestPriority returns the priority of the HTTP request, which is the priority of the first rule matching
+// the request headers, or normal if no rule matches. The priority set in the PriorityHeader is only honoured
+// if valid and lower than the one of the rules, so that clients can't override the priorities set for the tenant.
+func RequestPriority(req *httpgrpc.HTTPRequest, rules []validation.QueryPriorityRule) Priority {
+	headers := http.Header{}
+	for _, h := range req.GetHeaders() {
+		for _, v := range h.Values {
+			headers.Add(h.Key, v)
+		}
+	}
+
+	priority := rulesPriority(headers, rules)
+	if p, err := ParsePriority(headers.Get(PriorityHeader)); err == nil && p < priority {
+		return p
+	}
+	return priority
+}
+
+// rulesPriority returns the priority of the first rule matching the headers, or normal if no rule matches.
+func rulesPriority(headers http.Header, rules []validation.QueryPriorityRule) Priority {
+	for _, rule := range rules {
+		header := rule.Header
+		if header == "" {
+			header = "User-Agent"
+		}
+
+		if !rule.MatchString(headers.Get(header)) {
+			continue
+		}
+		// The priorities are validated when loading the limits, so this should never fail.
+		if p, err := ParsePriority(rule.Priority); err == nil {
+			return p
+		}
+	}
+
+	return PriorityNormal
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestParsePriority(t *testing.T) {
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		parsed, err := ParsePriority(p.String())
+		require.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+
+	_, err := ParsePriority("urgent")
+	assert.Error(t, err)
+}
+
+func TestRequestPriority(t *testing.T) {
+	rules := []validation.QueryPriorityRule{
+		{Regex: "mimir/.*", Priority: "high"},
+		{Header: "X-Dashboard-Uid", Regex: ".+", Priority: "normal"},
+		{Regex: "curl/.*", Priority: "low"},
+	}
+
+	tests := map[string]struct {
+		headers  []*httpgrpc.Header
+		rules    []validation.QueryPriorityRule
+		expected Priority
+	}{
+		"no headers and no rules": {
+			expected: PriorityNormal,
+		},
+		"priority header": {
+			headers:  []*httpgrpc.Header{{Key: "X-Query-Priority", Values: []string{"low"}}},
+			expected: PriorityLow,
+		},
+		"priority header can lower the priority of the rules": {
+			headers: []*httpgrpc.Header{
+				{Key: "User-Agent", Values: []string{"mimir/2.0.0"}},
+				{Key: "X-Query-Priority", Values: []string{"low"}},
+			},
+			rules:    rules,
+			expected: PriorityLow,
+		},
+		"priority header can't raise the priority of the rules": {
+			headers: []*httpgrpc.Header{
+				{Key: "User-Agent", Values: []string{"curl/7.0"}},
+				{Key: "X-Query-Priority", Values: []string{"high"}},
+			},
+			rules:    rules,
+			expected: PriorityLow,
+		},
+		"priority header can't raise the default priority": {
+			headers:  []*httpgrpc.Header{{Key: "X-Query-Priority", Values: []string{"high"}}},
+			expected: PriorityNormal,
+		},
+		"invalid priority header is ignored": {
+			headers: []*httpgrpc.Header{
+				{Key: "User-Agent", Values: []string{"curl/7.0"}},
+				{Key: "X-Query-Priority", Values: []string{"urgent"}},
+			},
+			rules:    rules,
+			expected: PriorityLow,
+		},
+		"rule matching the user agent": {
+			headers:  []*httpgrpc.Header{{Key: "User-Agent", Values: []string{"mimir/2.0.0"}}},
+			rules:    rules,
+			expected: PriorityHigh,
+		},
+		"rule matching another header": {
+			headers: []*httpgrpc.Header{
+				{Key: "User-Agent", Values: []string{"curl/7.0"}},
+				{Key: "X-Dashboard-Uid", Values: []string{"abc"}},
+			},
+			rules:    rules,
+			expected: PriorityNormal,
+		},
+		"rule regular expression is anchored": {
+			headers:  []*httpgrpc.Header{{Key: "User-Agent", Values: []string{"Grafana mimir/2.0.0"}}},
+			rules:    rules[:1],
+			expected: PriorityNormal,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, RequestPriority(&httpgrpc.HTTPRequest{Headers: tc.headers}, tc.rules))
+		})
+	}
+}
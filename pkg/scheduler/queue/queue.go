@@ -61,14 +61,18 @@ type RequestQueue struct {
 	queues  *queues
 	stopped bool
 
-	queueLength       *prometheus.GaugeVec   // Per user and reason.
+	// Lower priority requests waiting for longer than this are dequeued before higher priority ones. 0 to disable.
+	starvationThreshold time.Duration
+
+	queueLength       *prometheus.GaugeVec   // Per user and priority.
 	discardedRequests *prometheus.CounterVec // Per user.
 }
 
-func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, queueLength *prometheus.GaugeVec, discardedRequests *prometheus.CounterVec) *RequestQueue {
+func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay, starvationThreshold time.Duration, queueLength *prometheus.GaugeVec, discardedRequests *prometheus.CounterVec) *RequestQueue {
 	q := &RequestQueue{
 		queues:                  newUserQueues(maxOutstandingPerTenant, forgetDelay),
 		connectedQuerierWorkers: atomic.NewInt32(0),
+		starvationThreshold:     starvationThreshold,
 		queueLength:             queueLength,
 		discardedRequests:       discardedRequests,
 	}
@@ -79,12 +83,13 @@ func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, que
 	return q
 }
 
-// EnqueueRequest puts the request into the queue. MaxQueries is user-specific value that specifies how many queriers can
+// EnqueueRequest puts the request into the queue. Requests with a higher priority are dequeued before the other
+// requests of the same user. MaxQueries is user-specific value that specifies how many queriers can
 // this user use (zero or negative = all queriers). It is passed to each EnqueueRequest, because it can change
 // between calls.
 //
 // If request is successfully enqueued, successFn is called with the lock held, before any querier can receive the request.
-func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers int, successFn func()) error {
+func (q *RequestQueue) EnqueueRequest(userID string, req Request, priority Priority, maxQueriers int, successFn func()) error {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
@@ -98,19 +103,26 @@ func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers in
 		return errors.New("no queue found")
 	}
 
-	select {
-	case queue <- req:
-		q.queueLength.WithLabelValues(userID).Inc()
-		q.cond.Broadcast()
-		// Call this function while holding a lock. This guarantees that no querier can fetch the request before function returns.
-		if successFn != nil {
-			successFn()
+	if priority < 0 || int(priority) >= numPriorities {
+		priority = PriorityNormal
+	}
+
+	if queue.len() >= q.queues.maxUserQueueSize {
+		if queue.len() == 0 {
+			q.queues.deleteQueue(userID)
 		}
-		return nil
-	default:
 		q.discardedRequests.WithLabelValues(userID).Inc()
 		return ErrTooManyRequests
 	}
+
+	queue.enqueue(queuedRequest{req: req, priority: priority, enqueuedAt: time.Now()})
+	q.queueLength.WithLabelValues(userID, priority.String()).Inc()
+	q.cond.Broadcast()
+	// Call this function while holding a lock. This guarantees that no querier can fetch the request before function returns.
+	if successFn != nil {
+		successFn()
+	}
+	return nil
 }
 
 // GetNextRequestForQuerier find next user queue and takes the next request off of it. Will block if there are no requests.
@@ -145,19 +157,17 @@ FindQueue:
 		}
 
 		// Pick next request from the queue.
-		for {
-			request := <-queue
-			if len(queue) == 0 {
-				q.queues.deleteQueue(userID)
-			}
+		request := queue.dequeue(time.Now(), q.starvationThreshold)
+		if queue.len() == 0 {
+			q.queues.deleteQueue(userID)
+		}
 
-			q.queueLength.WithLabelValues(userID).Dec()
+		q.queueLength.WithLabelValues(userID, request.priority.String()).Dec()
 
-			// Tell close() we've processed a request.
-			q.cond.Broadcast()
+		// Tell close() we've processed a request.
+		q.cond.Broadcast()
 
-			return request, last, nil
-		}
+		return request.req, last, nil
 	}
 
 	// There are no unexpired requests, so we can get back
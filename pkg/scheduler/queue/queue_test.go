@@ -15,6 +15,7 @@ import (
 
 	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,8 +28,8 @@ func BenchmarkGetNextRequest(b *testing.B) {
 	queues := make([]*RequestQueue, 0, b.N)
 
 	for n := 0; n < b.N; n++ {
-		queue := NewRequestQueue(maxOutstandingPerTenant, 0,
-			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		queue := NewRequestQueue(maxOutstandingPerTenant, 0, 0,
+			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 			prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 		)
 		queues = append(queues, queue)
@@ -41,7 +42,7 @@ func BenchmarkGetNextRequest(b *testing.B) {
 			for j := 0; j < numTenants; j++ {
 				userID := strconv.Itoa(j)
 
-				err := queue.EnqueueRequest(userID, "request", 0, nil)
+				err := queue.EnqueueRequest(userID, "request", PriorityNormal, 0, nil)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -84,8 +85,8 @@ func BenchmarkQueueRequest(b *testing.B) {
 	requests := make([]string, 0, numTenants)
 
 	for n := 0; n < b.N; n++ {
-		q := NewRequestQueue(maxOutstandingPerTenant, 0,
-			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		q := NewRequestQueue(maxOutstandingPerTenant, 0, 0,
+			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 			prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
 		)
 
@@ -105,7 +106,7 @@ func BenchmarkQueueRequest(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for i := 0; i < maxOutstandingPerTenant; i++ {
 			for j := 0; j < numTenants; j++ {
-				err := queues[n].EnqueueRequest(users[j], requests[j], 0, nil)
+				err := queues[n].EnqueueRequest(users[j], requests[j], PriorityNormal, 0, nil)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -117,8 +118,8 @@ func BenchmarkQueueRequest(b *testing.B) {
 func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBecauseQuerierHasBeenForgotten(t *testing.T) {
 	const forgetDelay = 3 * time.Second
 
-	queue := NewRequestQueue(1, forgetDelay,
-		prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+	queue := NewRequestQueue(1, forgetDelay, 0,
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
 		prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}))
 
 	// Start the queue service.
@@ -146,7 +147,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 
 	// Enqueue a request from an user which would be assigned to querier-1.
 	// NOTE: "user-1" hash falls in the querier-1 shard.
-	require.NoError(t, queue.EnqueueRequest("user-1", "request", 1, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "request", PriorityNormal, 1, nil))
 
 	startTime := time.Now()
 	querier2wg.Wait()
@@ -156,6 +157,49 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 	assert.GreaterOrEqual(t, waitTime.Milliseconds(), forgetDelay.Milliseconds())
 }
 
+func TestRequestQueue_GetNextRequestForQuerier_ShouldReturnHigherPriorityRequestsFirst(t *testing.T) {
+	queueLength := prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"})
+	queue := NewRequestQueue(10, 0, 0, queueLength, prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}))
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	require.NoError(t, queue.EnqueueRequest("user-1", "low", PriorityLow, 0, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "normal", PriorityNormal, 0, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "high", PriorityHigh, 0, nil))
+	assert.Equal(t, float64(1), promtest.ToFloat64(queueLength.WithLabelValues("user-1", "low")))
+	assert.Equal(t, float64(1), promtest.ToFloat64(queueLength.WithLabelValues("user-1", "high")))
+
+	last := FirstUser()
+	for _, expected := range []string{"high", "normal", "low"} {
+		req, idx, err := queue.GetNextRequestForQuerier(ctx, last, "querier-1")
+		require.NoError(t, err)
+		assert.Equal(t, expected, req)
+		last = idx
+	}
+
+	assert.Equal(t, float64(0), promtest.ToFloat64(queueLength.WithLabelValues("user-1", "low")))
+	assert.Equal(t, float64(0), promtest.ToFloat64(queueLength.WithLabelValues("user-1", "high")))
+}
+
+func TestRequestQueue_EnqueueRequest_ShouldLimitTheOutstandingRequestsAcrossPriorities(t *testing.T) {
+	queue := NewRequestQueue(2, 0, 0,
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user", "priority"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}))
+
+	require.NoError(t, queue.EnqueueRequest("user-1", "low", PriorityLow, 0, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "high", PriorityHigh, 0, nil))
+	assert.Equal(t, ErrTooManyRequests, queue.EnqueueRequest("user-1", "normal", PriorityNormal, 0, nil))
+}
+
 func TestContextCond(t *testing.T) {
 	t.Run("wait until broadcast", func(t *testing.T) {
 		t.Parallel()
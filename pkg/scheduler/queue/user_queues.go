@@ -49,7 +49,9 @@ type queues struct {
 }
 
 type userQueue struct {
-	ch chan Request
+	// Pending requests, in FIFO order, for each priority.
+	requests [numPriorities][]queuedRequest
+	length   int
 
 	// If not nil, only these queriers can handle user requests. If nil, all queriers can.
 	// We set this to nil if number of available queriers <= maxQueriers.
@@ -64,6 +66,54 @@ type userQueue struct {
 	index int
 }
 
+// queuedRequest is a request waiting in a userQueue.
+type queuedRequest struct {
+	req        Request
+	priority   Priority
+	enqueuedAt time.Time
+}
+
+func (uq *userQueue) len() int {
+	return uq.length
+}
+
+func (uq *userQueue) enqueue(r queuedRequest) {
+	uq.requests[r.priority] = append(uq.requests[r.priority], r)
+	uq.length++
+}
+
+// dequeue removes and returns the next request from the queue, which must not be empty. The oldest request of the highest
+// priority is returned, unless a lower priority request has been waiting for longer than the starvation threshold:
+// in that case the request waiting for the longest time is returned, so that lower priority requests can't starve.
+func (uq *userQueue) dequeue(now time.Time, starvationThreshold time.Duration) queuedRequest {
+	next := -1
+	for p := numPriorities - 1; p >= 0; p-- {
+		if len(uq.requests[p]) > 0 {
+			next = p
+			break
+		}
+	}
+
+	if starvationThreshold > 0 {
+		for p := next - 1; p >= 0; p-- {
+			if len(uq.requests[p]) == 0 {
+				continue
+			}
+
+			// The heads are the oldest request of each priority.
+			if waited := uq.requests[p][0].enqueuedAt; now.Sub(waited) >= starvationThreshold && waited.Before(uq.requests[next][0].enqueuedAt) {
+				next = p
+			}
+		}
+	}
+
+	r := uq.requests[next][0]
+	uq.requests[next][0] = queuedRequest{} // Release the reference to the request.
+	uq.requests[next] = uq.requests[next][1:]
+	uq.length--
+	return r
+}
+
 func newUserQueues(maxUserQueueSize int, forgetDelay time.Duration) *queues {
 	return &queues{
 		userQueues:       map[string]*userQueue{},
@@ -98,7 +148,7 @@ func (q *queues) deleteQueue(userID string) {
 // MaxQueriers is used to compute which queriers should handle requests for this user.
 // If maxQueriers is <= 0, all queriers can handle this user's requests.
 // If maxQueriers has changed since the last call, queriers for this are recomputed.
-func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
+func (q *queues) getOrAddQueue(userID string, maxQueriers int) *userQueue {
 	// Empty user is not allowed, as that would break our users list ("" is used for free spot).
 	if userID == "" {
 		return nil
@@ -112,7 +162,6 @@ func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
 
 	if uq == nil {
 		uq = &userQueue{
-			ch:    make(chan Request, q.maxUserQueueSize),
 			seed:  util.ShuffleShardSeed(userID, ""),
 			index: -1,
 		}
@@ -139,13 +188,13 @@ func (q *queues) getOrAddQueue(userID string, maxQueriers int) chan Request {
 		uq.queriers = shuffleQueriersForUser(uq.seed, maxQueriers, q.sortedQueriers, nil)
 	}
 
-	return uq.ch
+	return uq
 }
 
 // Finds next queue for the querier. To support fair scheduling between users, client is expected
 // to pass last user index returned by this function as argument. Is there was no previous
 // last user index, use -1.
-func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string) (chan Request, string, int) {
+func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string) (*userQueue, string, int) {
 	uid := lastUserIndex
 
 	// Ensure the querier is not shutting down. If the querier is shutting down, we shouldn't forward
@@ -177,7 +226,7 @@ func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string) (ch
 			}
 		}
 
-		return q.ch, u, uid
+		return q, u, uid
 	}
 	return nil, "", uid
 }
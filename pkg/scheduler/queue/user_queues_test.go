@@ -397,7 +397,7 @@ func generateQuerier(r *rand.Rand) string {
 	return fmt.Sprint("querier-", r.Int()%5)
 }
 
-func getOrAdd(t *testing.T, uq *queues, tenant string, maxQueriers int) chan Request {
+func getOrAdd(t *testing.T, uq *queues, tenant string, maxQueriers int) *userQueue {
 	q := uq.getOrAddQueue(tenant, maxQueriers)
 	assert.NotNil(t, q)
 	assert.NoError(t, isConsistent(uq))
@@ -405,8 +405,8 @@ func getOrAdd(t *testing.T, uq *queues, tenant string, maxQueriers int) chan Req
 	return q
 }
 
-func confirmOrderForQuerier(t *testing.T, uq *queues, querier string, lastUserIndex int, qs ...chan Request) int {
-	var n chan Request
+func confirmOrderForQuerier(t *testing.T, uq *queues, querier string, lastUserIndex int, qs ...*userQueue) int {
+	var n *userQueue
 	for _, q := range qs {
 		n, _, lastUserIndex = uq.getNextQueueForQuerier(lastUserIndex, querier)
 		assert.Equal(t, q, n)
@@ -522,3 +522,41 @@ func TestShuffleQueriersCorrectness(t *testing.T) {
 		}
 	}
 }
+
+func TestUserQueue_ShouldDequeueHigherPriorityRequestsFirst(t *testing.T) {
+	now := time.Now()
+
+	uq := &userQueue{}
+	uq.enqueue(queuedRequest{req: "low-1", priority: PriorityLow, enqueuedAt: now.Add(-4 * time.Second)})
+	uq.enqueue(queuedRequest{req: "normal-1", priority: PriorityNormal, enqueuedAt: now.Add(-3 * time.Second)})
+	uq.enqueue(queuedRequest{req: "high-1", priority: PriorityHigh, enqueuedAt: now.Add(-2 * time.Second)})
+	uq.enqueue(queuedRequest{req: "normal-2", priority: PriorityNormal, enqueuedAt: now.Add(-time.Second)})
+	uq.enqueue(queuedRequest{req: "high-2", priority: PriorityHigh, enqueuedAt: now})
+	require.Equal(t, 5, uq.len())
+
+	var actual []Request
+	for uq.len() > 0 {
+		actual = append(actual, uq.dequeue(now, 0).req)
+	}
+	assert.Equal(t, []Request{"high-1", "high-2", "normal-1", "normal-2", "low-1"}, actual)
+}
+
+func TestUserQueue_ShouldNotStarveLowerPriorityRequests(t *testing.T) {
+	const starvationThreshold = 10 * time.Second
+	now := time.Now()
+
+	uq := &userQueue{}
+	uq.enqueue(queuedRequest{req: "low-1", priority: PriorityLow, enqueuedAt: now.Add(-20 * time.Second)})
+	uq.enqueue(queuedRequest{req: "normal-1", priority: PriorityNormal, enqueuedAt: now.Add(-15 * time.Second)})
+	uq.enqueue(queuedRequest{req: "low-2", priority: PriorityLow, enqueuedAt: now.Add(-5 * time.Second)})
+	uq.enqueue(queuedRequest{req: "high-1", priority: PriorityHigh, enqueuedAt: now.Add(-time.Second)})
+	uq.enqueue(queuedRequest{req: "high-2", priority: PriorityHigh, enqueuedAt: now})
+
+	var actual []Request
+	for uq.len() > 0 {
+		actual = append(actual, uq.dequeue(now, starvationThreshold).req)
+	}
+
+	// The requests waiting for longer than the threshold are dequeued first, from the oldest.
+	assert.Equal(t, []Request{"low-1", "normal-1", "high-1", "high-2", "low-2"}, actual)
+}
@@ -68,7 +68,7 @@ type Scheduler struct {
 	discardedRequests        *prometheus.CounterVec
 	connectedQuerierClients  prometheus.GaugeFunc
 	connectedFrontendClients prometheus.GaugeFunc
-	queueDuration            prometheus.Histogram
+	queueDuration            *prometheus.HistogramVec
 	inflightRequests         prometheus.Summary
 }
 
@@ -87,14 +87,16 @@ type connectedFrontend struct {
 }
 
 type Config struct {
-	MaxOutstandingPerTenant int               `yaml:"max_outstanding_requests_per_tenant"`
-	QuerierForgetDelay      time.Duration     `yaml:"querier_forget_delay" category:"experimental"`
-	GRPCClientConfig        grpcclient.Config `yaml:"grpc_client_config" doc:"description=This configures the gRPC client used to report errors back to the query-frontend."`
+	MaxOutstandingPerTenant     int               `yaml:"max_outstanding_requests_per_tenant"`
+	QuerierForgetDelay          time.Duration     `yaml:"querier_forget_delay" category:"experimental"`
+	PriorityStarvationThreshold time.Duration     `yaml:"priority_starvation_threshold" category:"experimental"`
+	GRPCClientConfig            grpcclient.Config `yaml:"grpc_client_config" doc:"description=This configures the gRPC client used to report errors back to the query-frontend."`
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "query-scheduler.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per query-scheduler. In-flight requests above this limit will fail with HTTP response status code 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-scheduler.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-scheduler will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.DurationVar(&cfg.PriorityStarvationThreshold, "query-scheduler.priority-starvation-threshold", 5*time.Second, "Lower priority queries waiting in the tenant's queue for longer than this threshold are dispatched before higher priority queries, so that they can't be starved. 0 to always dispatch higher priority queries first.")
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("query-scheduler.grpc-client-config", f)
 }
 
@@ -112,19 +114,19 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 	s.queueLength = promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
 		Name: "cortex_query_scheduler_queue_length",
 		Help: "Number of queries in the queue.",
-	}, []string{"user"})
+	}, []string{"user", "priority"})
 
 	s.discardedRequests = promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_query_scheduler_discarded_requests_total",
 		Help: "Total number of query requests discarded.",
 	}, []string{"user"})
-	s.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, s.queueLength, s.discardedRequests)
+	s.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, cfg.PriorityStarvationThreshold, s.queueLength, s.discardedRequests)
 
-	s.queueDuration = promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+	s.queueDuration = promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "cortex_query_scheduler_queue_duration_seconds",
 		Help:    "Time spend by requests in queue before getting picked up by a querier.",
 		Buckets: prometheus.DefBuckets,
-	})
+	}, []string{"priority"})
 	s.connectedQuerierClients = promauto.With(registerer).NewGaugeFunc(prometheus.GaugeOpts{
 		Name: "cortex_query_scheduler_connected_querier_clients",
 		Help: "Number of querier worker clients currently connected to the query-scheduler.",
@@ -158,6 +160,9 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 type Limits interface {
 	// MaxQueriersPerUser returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// QueryPriorityRules returns the rules assigning a priority to the tenant's queries in the queue.
+	QueryPriorityRules(user string) []validation.QueryPriorityRule
 }
 
 type schedulerRequest struct {
@@ -166,6 +171,7 @@ type schedulerRequest struct {
 	queryID         uint64
 	request         *httpgrpc.HTTPRequest
 	statsEnabled    bool
+	priority        queue.Priority
 
 	enqueueTime time.Time
 
@@ -321,8 +327,14 @@ func (s *Scheduler) enqueueRequest(frontendContext context.Context, frontendAddr
 	}
 	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.MaxQueriersPerUser)
 
+	var priorityRules []validation.QueryPriorityRule
+	for _, tenantID := range tenantIDs {
+		priorityRules = append(priorityRules, s.limits.QueryPriorityRules(tenantID)...)
+	}
+	req.priority = queue.RequestPriority(msg.HttpRequest, priorityRules)
+
 	s.activeUsers.UpdateUserTimestamp(userID, now)
-	return s.requestQueue.EnqueueRequest(userID, req, maxQueriers, func() {
+	return s.requestQueue.EnqueueRequest(userID, req, req.priority, maxQueriers, func() {
 		shouldCancel = false
 
 		s.pendingRequestsMu.Lock()
@@ -369,7 +381,7 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 
 		r := req.(*schedulerRequest)
 
-		s.queueDuration.Observe(time.Since(r.enqueueTime).Seconds())
+		s.queueDuration.WithLabelValues(r.priority.String()).Observe(time.Since(r.enqueueTime).Seconds())
 		r.queueSpan.Finish()
 
 		/*
@@ -532,7 +544,9 @@ func (s *Scheduler) stopping(_ error) error {
 }
 
 func (s *Scheduler) cleanupMetricsForInactiveUser(user string) {
-	s.queueLength.DeleteLabelValues(user)
+	if err := util.DeleteMatchingLabels(s.queueLength, map[string]string{"user": user}); err != nil {
+		level.Warn(s.log).Log("msg", "failed to remove cortex_query_scheduler_queue_length metric for user", "user", user, "err", err)
+	}
 	s.discardedRequests.DeleteLabelValues(user)
 }
 
@@ -31,6 +31,7 @@ import (
 	"github.com/grafana/mimir/pkg/frontend/v2/frontendv2pb"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerpb"
 	"github.com/grafana/mimir/pkg/util/httpgrpcutil"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const testMaxOutstandingPerTenant = 5
@@ -433,8 +434,8 @@ func TestSchedulerMetrics(t *testing.T) {
 	require.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
 		# HELP cortex_query_scheduler_queue_length Number of queries in the queue.
 		# TYPE cortex_query_scheduler_queue_length gauge
-		cortex_query_scheduler_queue_length{user="another"} 1
-		cortex_query_scheduler_queue_length{user="test"} 1
+		cortex_query_scheduler_queue_length{priority="normal",user="another"} 1
+		cortex_query_scheduler_queue_length{priority="normal",user="test"} 1
 	`), "cortex_query_scheduler_queue_length"))
 
 	scheduler.cleanupMetricsForInactiveUser("test")
@@ -442,7 +443,7 @@ func TestSchedulerMetrics(t *testing.T) {
 	require.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
 		# HELP cortex_query_scheduler_queue_length Number of queries in the queue.
 		# TYPE cortex_query_scheduler_queue_length gauge
-		cortex_query_scheduler_queue_length{user="another"} 1
+		cortex_query_scheduler_queue_length{priority="normal",user="another"} 1
 	`), "cortex_query_scheduler_queue_length"))
 }
 
@@ -500,13 +501,18 @@ func verifyNoPendingRequestsLeft(t *testing.T, scheduler *Scheduler) {
 }
 
 type limits struct {
-	queriers int
+	queriers      int
+	priorityRules []validation.QueryPriorityRule
 }
 
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
 
+func (l limits) QueryPriorityRules(_ string) []validation.QueryPriorityRule {
+	return l.priorityRules
+}
+
 type frontendMock struct {
 	mu   sync.Mutex
 	resp map[uint64]*httpgrpc.HTTPResponse
@@ -25,6 +25,7 @@ const (
 	IndexCompressedFilename = IndexFilename + ".gz"
 	IndexVersion1           = 1
 	IndexVersion2           = 2 // Added CompactorShardID field.
+	IndexVersion3           = 3 // Added Resolution field.
 	SegmentsFormatUnknown   = ""
 
 	// SegmentsFormat1Based6Digits defined segments numbered with 6 digits numbers in a sequence starting from number 1
@@ -91,6 +92,9 @@ type Block struct {
 
 	// Block's compactor shard ID, copied from tsdb.CompactorShardIDExternalLabel label.
 	CompactorShardID string `json:"compactor_shard_id,omitempty"`
+
+	// Block's downsampling resolution (millis precision), 0 for raw blocks.
+	Resolution int64 `json:"resolution,omitempty"`
 }
 
 // Within returns whether the block contains samples within the provided range.
@@ -117,6 +121,7 @@ func (m *Block) ThanosMeta() *metadata.Meta {
 		},
 		Thanos: metadata.Thanos{
 			Version:      metadata.ThanosVersion1,
+			Downsample:   metadata.ThanosDownsample{Resolution: m.Resolution},
 			SegmentFiles: m.thanosMetaSegmentFiles(),
 		},
 	}
@@ -154,6 +159,7 @@ func BlockFromThanosMeta(meta metadata.Meta) *Block {
 		SegmentsFormat:   segmentsFormat,
 		SegmentsNum:      segmentsNum,
 		CompactorShardID: meta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel],
+		Resolution:       meta.Thanos.Downsample.Resolution,
 	}
 }
 
@@ -272,6 +272,24 @@ func TestBlockFromThanosMeta(t *testing.T) {
 				CompactorShardID: "some weird value",
 			},
 		},
+		"meta.json of a downsampled block": {
+			meta: metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+				},
+				Thanos: metadata.Thanos{
+					Downsample: metadata.ThanosDownsample{Resolution: 300000},
+				},
+			},
+			expected: Block{
+				ID:         blockID,
+				MinTime:    10,
+				MaxTime:    20,
+				Resolution: 300000,
+			},
+		},
 	}
 
 	for testName, testData := range tests {
@@ -378,6 +396,26 @@ func TestBlock_ThanosMeta(t *testing.T) {
 				},
 			},
 		},
+		"downsampled block": {
+			block: Block{
+				ID:         blockID,
+				MinTime:    10,
+				MaxTime:    20,
+				Resolution: 300000,
+			},
+			expected: &metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+					Version: metadata.TSDBVersion1,
+				},
+				Thanos: metadata.Thanos{
+					Version:    metadata.ThanosVersion1,
+					Downsample: metadata.ThanosDownsample{Resolution: 300000},
+				},
+			},
+		},
 	}
 
 	for testName, testData := range tests {
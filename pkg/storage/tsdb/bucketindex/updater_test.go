@@ -168,7 +168,7 @@ func TestUpdater_UpdateIndex_NoTenantInTheBucket(t *testing.T) {
 		idx, partials, err := w.UpdateIndex(ctx, oldIdx)
 
 		require.NoError(t, err)
-		assert.Equal(t, IndexVersion2, idx.Version)
+		assert.Equal(t, IndexVersion3, idx.Version)
 		assert.InDelta(t, time.Now().Unix(), idx.UpdatedAt, 2)
 		assert.Len(t, idx.Blocks, 0)
 		assert.Len(t, idx.BlockDeletionMarks, 0)
@@ -239,7 +239,7 @@ func getBlockUploadedAt(t testing.TB, bkt objstore.Bucket, userID string, blockI
 }
 
 func assertBucketIndexEqual(t testing.TB, idx *Index, bkt objstore.Bucket, userID string, expectedBlocks []metadata.Meta, expectedDeletionMarks []*metadata.DeletionMark) {
-	assert.Equal(t, IndexVersion2, idx.Version)
+	assert.Equal(t, IndexVersion3, idx.Version)
 	assert.InDelta(t, time.Now().Unix(), idx.UpdatedAt, 2)
 
 	// Build the list of expected block index entries.
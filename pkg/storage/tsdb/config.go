@@ -72,12 +72,15 @@ var (
 	errInvalidOpeningConcurrency    = errors.New("invalid TSDB opening concurrency")
 	errInvalidCompactionInterval    = errors.New("invalid TSDB compaction interval")
 	errInvalidCompactionConcurrency = errors.New("invalid TSDB compaction concurrency")
+	errInvalidEarlyHeadCompaction   = errors.New("invalid TSDB early head compaction age or cooldown")
 	errInvalidWALSegmentSizeBytes   = errors.New("invalid TSDB WAL segment size bytes")
 	errInvalidStripeSize            = errors.New("invalid TSDB stripe size")
 	errEmptyBlockranges             = errors.New("empty block ranges for TSDB")
+	errInvalidSeriesBatchSize       = errors.New("invalid bucket store series batch size")
 )
 
 // BlocksStorageConfig holds the config information for the blocks storage.
+//
 //nolint:golint
 type BlocksStorageConfig struct {
 	Bucket      bucket.Config     `yaml:",inline"`
@@ -143,6 +146,7 @@ func (cfg *BlocksStorageConfig) Validate() error {
 }
 
 // TSDBConfig holds the config for TSDB opened in the ingesters.
+//
 //nolint:golint
 type TSDBConfig struct {
 	Dir                       string        `yaml:"dir"`
@@ -153,6 +157,12 @@ type TSDBConfig struct {
 	HeadCompactionInterval    time.Duration `yaml:"head_compaction_interval" category:"advanced"`
 	HeadCompactionConcurrency int           `yaml:"head_compaction_concurrency" category:"advanced"`
 	HeadCompactionIdleTimeout time.Duration `yaml:"head_compaction_idle_timeout" category:"advanced"`
+
+	EarlyHeadCompactionMinInMemorySeries     int64         `yaml:"early_head_compaction_min_in_memory_series" category:"experimental"`
+	EarlyHeadCompactionMinEstimatedHeadBytes int64         `yaml:"early_head_compaction_min_estimated_head_bytes" category:"experimental"`
+	EarlyHeadCompactionOlderThan             time.Duration `yaml:"early_head_compaction_older_than" category:"experimental"`
+	EarlyHeadCompactionCooldown              time.Duration `yaml:"early_head_compaction_cooldown" category:"experimental"`
+
 	HeadChunksWriteBufferSize int           `yaml:"head_chunks_write_buffer_size_bytes" category:"advanced"`
 	HeadChunksEndTimeVariance float64       `yaml:"head_chunks_end_time_variance" category:"experimental"`
 	StripeSize                int           `yaml:"stripe_size" category:"advanced"`
@@ -196,6 +206,10 @@ func (cfg *TSDBConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.HeadCompactionInterval, "blocks-storage.tsdb.head-compaction-interval", 1*time.Minute, "How frequently ingesters try to compact TSDB head. Block is only created if data covers smallest block range. Must be greater than 0 and max 5 minutes.")
 	f.IntVar(&cfg.HeadCompactionConcurrency, "blocks-storage.tsdb.head-compaction-concurrency", 5, "Maximum number of tenants concurrently compacting TSDB head into a new block")
 	f.DurationVar(&cfg.HeadCompactionIdleTimeout, "blocks-storage.tsdb.head-compaction-idle-timeout", 1*time.Hour, "If TSDB head is idle for this duration, it is compacted. Note that up to 25% jitter is added to the value to avoid ingesters compacting concurrently. 0 means disabled.")
+	f.Int64Var(&cfg.EarlyHeadCompactionMinInMemorySeries, "blocks-storage.tsdb.early-head-compaction-min-in-memory-series", 0, "When the number of in-memory series in the ingester exceeds this setting, the TSDB head of the tenants with most in-memory series is compacted early, without waiting for the head to cover the smallest block range, to release the memory used by inactive series. This setting applies in addition to the per-tenant early head compaction thresholds. 0 to disable.")
+	f.Int64Var(&cfg.EarlyHeadCompactionMinEstimatedHeadBytes, "blocks-storage.tsdb.early-head-compaction-min-estimated-head-bytes", 0, "When the estimated memory used by the TSDB heads in the ingester exceeds this setting, the TSDB head of the tenants with most in-memory series is compacted early, without waiting for the head to cover the smallest block range. This setting applies in addition to the per-tenant early head compaction thresholds. 0 to disable.")
+	f.DurationVar(&cfg.EarlyHeadCompactionOlderThan, "blocks-storage.tsdb.early-head-compaction-older-than", 30*time.Minute, "When the TSDB head of a tenant is compacted early, samples older than this duration are compacted into a block and series without more recent samples are removed from memory. Samples older than this duration can't be ingested into the TSDB head anymore after an early head compaction.")
+	f.DurationVar(&cfg.EarlyHeadCompactionCooldown, "blocks-storage.tsdb.early-head-compaction-cooldown", 30*time.Minute, "Minimum time between two early compactions of the TSDB head of the same tenant.")
 	f.IntVar(&cfg.HeadChunksWriteBufferSize, "blocks-storage.tsdb.head-chunks-write-buffer-size-bytes", chunks.DefaultWriteBufferSize, "The write buffer size used by the head chunks mapper. Lower values reduce memory utilisation on clusters with a large number of tenants at the cost of increased disk I/O operations.")
 	f.Float64Var(&cfg.HeadChunksEndTimeVariance, "blocks-storage.tsdb.head-chunks-end-time-variance", 0, "How much variance (as percentage between 0 and 1) should be applied to the chunk end time, to spread chunks writing across time. Doesn't apply to the last chunk of the chunk range. 0 means no variance.")
 	f.IntVar(&cfg.StripeSize, "blocks-storage.tsdb.stripe-size", 16384, "The number of shards of series to use in TSDB (must be a power of 2). Reducing this will decrease memory footprint, but can negatively impact performance.")
@@ -207,7 +221,7 @@ func (cfg *TSDBConfig) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.HeadChunksWriteQueueSize, "blocks-storage.tsdb.head-chunks-write-queue-size", 0, "The size of the write queue used by the head chunks mapper. Lower values reduce memory utilisation at the cost of potentially higher ingest latency. Value of 0 switches chunks mapper to implementation without a queue. This flag is only used if the new chunk disk mapper is enabled with -blocks-storage.tsdb.new-chunk-disk-mapper.")
 	f.BoolVar(&cfg.NewChunkDiskMapper, "blocks-storage.tsdb.new-chunk-disk-mapper", false, "Temporary flag to select whether to use the new (used in upstream Prometheus) or the old (legacy) chunk disk mapper.")
 	f.BoolVar(&cfg.IsolationEnabled, "blocks-storage.tsdb.isolation-enabled", false, "[Deprecated] Enables TSDB isolation feature. Disabling may improve performance.")
-	f.BoolVar(&cfg.AllowOverlappingQueries, "blocks-storage.tsdb.allow-overlapping-queries", false, "Enable querying overlapping blocks. If there are going to be overlapping blocks in the ingesters this should be enabled.")
+	f.BoolVar(&cfg.AllowOverlappingQueries, "blocks-storage.tsdb.allow-overlapping-queries", false, "Enable querying overlapping blocks. If there are going to be overlapping blocks in the ingesters this should be enabled. Querying overlapping blocks is always enabled for the tenants with a non-zero out-of-order time window, or which have ingested out-of-order samples, when their TSDB is opened.")
 }
 
 // Validate the config.
@@ -228,6 +242,10 @@ func (cfg *TSDBConfig) Validate() error {
 		return errInvalidCompactionConcurrency
 	}
 
+	if cfg.EarlyHeadCompactionOlderThan < 0 || cfg.EarlyHeadCompactionCooldown < 0 {
+		return errInvalidEarlyHeadCompaction
+	}
+
 	if cfg.HeadChunksWriteBufferSize < chunks.MinWriteBufferSize || cfg.HeadChunksWriteBufferSize > chunks.MaxWriteBufferSize || cfg.HeadChunksWriteBufferSize%1024 != 0 {
 		return errors.Errorf("head chunks write buffer size must be a multiple of 1024 between %d and %d", chunks.MinWriteBufferSize, chunks.MaxWriteBufferSize)
 	}
@@ -273,6 +291,8 @@ type BucketStoreConfig struct {
 	IgnoreDeletionMarksDelay time.Duration       `yaml:"ignore_deletion_mark_delay" category:"advanced"`
 	BucketIndex              BucketIndexConfig   `yaml:"bucket_index"`
 	IgnoreBlocksWithin       time.Duration       `yaml:"ignore_blocks_within" category:"advanced"`
+	TombstonesCacheTTL       time.Duration       `yaml:"tombstones_cache_ttl" category:"experimental"`
+	SeriesBatchSize          int                 `yaml:"series_batch_size" category:"experimental"`
 
 	// Chunk pool.
 	MaxChunkPoolBytes           uint64 `yaml:"max_chunk_pool_bytes" category:"advanced"`
@@ -322,6 +342,8 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.IgnoreDeletionMarksDelay, "blocks-storage.bucket-store.ignore-deletion-marks-delay", time.Hour*1, "Duration after which the blocks marked for deletion will be filtered out while fetching blocks. "+
 		"The idea of ignore-deletion-marks-delay is to ignore blocks that are marked for deletion with some delay. This ensures store can still serve blocks that are meant to be deleted but do not have a replacement yet.")
 	f.DurationVar(&cfg.IgnoreBlocksWithin, "blocks-storage.bucket-store.ignore-blocks-within", 10*time.Hour, "Blocks with minimum time within this duration are ignored, and not loaded by store-gateway. Useful when used together with -querier.query-store-after to prevent loading young blocks, because there are usually many of them (depending on number of ingesters) and they are not yet compacted. Negative values or 0 disable the filter.")
+	f.DurationVar(&cfg.TombstonesCacheTTL, "blocks-storage.bucket-store.tombstones-cache-ttl", time.Minute, "How long the series deletion requests of a tenant are cached by queriers and store-gateways before being read again from the bucket. The samples of the deleted series are returned by queries until the series deletion request is read.")
+	f.IntVar(&cfg.SeriesBatchSize, "blocks-storage.bucket-store.series-batch-size", 0, "If greater than 0, the store-gateway loads the series and chunks matching a Series() request from each block in batches of this number of series, and sends them to the querier progressively, bounding the memory used by each request. 0 to load all matching series of a block at once.")
 	f.IntVar(&cfg.PostingOffsetsInMemSampling, "blocks-storage.bucket-store.posting-offsets-in-mem-sampling", DefaultPostingOffsetInMemorySampling, "Controls what is the ratio of postings offsets that the store will hold in memory.")
 	f.BoolVar(&cfg.IndexHeaderLazyLoadingEnabled, "blocks-storage.bucket-store.index-header-lazy-loading-enabled", true, "If enabled, store-gateway will lazy load an index-header only once required by a query.")
 	f.DurationVar(&cfg.IndexHeaderLazyLoadingIdleTimeout, "blocks-storage.bucket-store.index-header-lazy-loading-idle-timeout", 60*time.Minute, "If index-header lazy loading is enabled and this setting is > 0, the store-gateway will offload unused index-headers after 'idle timeout' inactivity.")
@@ -342,6 +364,9 @@ func (cfg *BucketStoreConfig) Validate() error {
 	if err != nil {
 		return errors.Wrap(err, "metadata-cache configuration")
 	}
+	if cfg.SeriesBatchSize < 0 {
+		return errInvalidSeriesBatchSize
+	}
 	return nil
 }
 
@@ -120,6 +120,12 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errInvalidWALSegmentSizeBytes,
 		},
+		"should fail on negative bucket store series batch size": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.SeriesBatchSize = -1
+			},
+			expectedErr: errInvalidSeriesBatchSize,
+		},
 	}
 
 	for testName, testData := range tests {
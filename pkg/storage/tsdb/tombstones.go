@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tsdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+)
+
+// Relative to user-specific prefix.
+const TombstonesPath = "tombstones"
+
+// SeriesRetentionRequestIDPrefix is the prefix of the request ID of the tombstones created from the series retention rules.
+const SeriesRetentionRequestIDPrefix = "series-retention-"
+
+// TombstoneState is the state of a series deletion request.
+type TombstoneState string
+
+const (
+	// TombstonePending is the state of a series deletion request whose samples haven't been
+	// removed from the blocks yet. The samples are filtered out at query time.
+	TombstonePending TombstoneState = "pending"
+	// TombstoneProcessed is the state of a series deletion request whose samples have been
+	// removed from the blocks by the compactor. The samples are still filtered out at query
+	// time, because the blocks replaced by the rewritten ones may still be queried.
+	TombstoneProcessed TombstoneState = "processed"
+	// TombstoneDone is the state of a processed series deletion request whose replaced blocks
+	// have been deleted. The request is not applied at query time anymore.
+	TombstoneDone TombstoneState = "done"
+)
+
+// Tombstone is a series deletion request, stored in the bucket.
+type Tombstone struct {
+	RequestID string `json:"request_id"`
+
+	// Time range of the samples to delete, in milliseconds, inclusive.
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+
+	// Series selectors of the series to delete. A series is deleted if it matches any of them.
+	Selectors []string `json:"selectors"`
+
+	// Unix timestamp in milliseconds when the request was created.
+	RequestCreatedAt int64 `json:"request_created_at"`
+
+	// Unix timestamp in milliseconds when the state was last changed.
+	StateCreatedAt int64          `json:"state_created_at"`
+	State          TombstoneState `json:"state"`
+
+	// Parsed Selectors.
+	matchers [][]*labels.Matcher
+}
+
+// NewTombstone creates a pending series deletion request. The request ID only depends on the time range
+// and selectors, so that the same request sent more than once is stored once.
+func NewTombstone(startTime, endTime int64, selectors []string, createdAt time.Time) (*Tombstone, error) {
+	if len(selectors) == 0 {
+		return nil, errors.New("at least one series selector must be provided")
+	}
+	if startTime > endTime {
+		return nil, errors.New("the start time must not be after the end time")
+	}
+
+	t := &Tombstone{
+		RequestID:        tombstoneRequestID(startTime, endTime, selectors),
+		StartTime:        startTime,
+		EndTime:          endTime,
+		Selectors:        selectors,
+		RequestCreatedAt: createdAt.UnixMilli(),
+		StateCreatedAt:   createdAt.UnixMilli(),
+		State:            TombstonePending,
+	}
+	if err := t.parseSelectors(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// NewSeriesRetentionTombstone creates a tombstone deleting the samples of the series matching the selector
+// older than the retention period at the given time. Its request ID only depends on the selector and the
+// retention period, so that it identifies the retention rule whatever the time is.
+func NewSeriesRetentionTombstone(selector string, retention time.Duration, now time.Time) (*Tombstone, error) {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s,%s", selector, retention)))
+
+	t := &Tombstone{
+		RequestID:        SeriesRetentionRequestIDPrefix + hex.EncodeToString(h[:16]),
+		StartTime:        math.MinInt64,
+		EndTime:          now.Add(-retention).UnixMilli() - 1,
+		Selectors:        []string{selector},
+		RequestCreatedAt: now.UnixMilli(),
+		StateCreatedAt:   now.UnixMilli(),
+		State:            TombstonePending,
+	}
+	if err := t.parseSelectors(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func tombstoneRequestID(startTime, endTime int64, selectors []string) string {
+	sorted := append([]string(nil), selectors...)
+	sort.Strings(sorted)
+
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d,%d,%s", startTime, endTime, strings.Join(sorted, ","))))
+	return hex.EncodeToString(h[:16])
+}
+
+func (t *Tombstone) parseSelectors() error {
+	t.matchers = make([][]*labels.Matcher, 0, len(t.Selectors))
+	for _, selector := range t.Selectors {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return errors.Wrapf(err, "invalid series selector %q", selector)
+		}
+		t.matchers = append(t.matchers, matchers)
+	}
+	return nil
+}
+
+// Matchers returns the label matchers of each series selector.
+func (t *Tombstone) Matchers() [][]*labels.Matcher {
+	return t.matchers
+}
+
+// Matches returns whether the series with the input labels is deleted by the request.
+func (t *Tombstone) Matches(lset labels.Labels) bool {
+	for _, matchers := range t.matchers {
+		if matchesAll(matchers, lset) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps returns whether the request deletes samples in the closed interval [mint, maxt].
+func (t *Tombstone) Overlaps(mint, maxt int64) bool {
+	return t.StartTime <= maxt && t.EndTime >= mint
+}
+
+func (t *Tombstone) path() string {
+	return path.Join(TombstonesPath, t.RequestID+".json")
+}
+
+func matchesAll(matchers []*labels.Matcher, lset labels.Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tombstones is a list of series deletion requests.
+type Tombstones []*Tombstone
+
+// Overlapping returns the requests deleting samples in the closed interval [mint, maxt].
+func (ts Tombstones) Overlapping(mint, maxt int64) Tombstones {
+	var res Tombstones
+	for _, t := range ts {
+		if t.Overlaps(mint, maxt) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// DeletedIntervals returns the time intervals deleted by the requests for the series with the input labels.
+func (ts Tombstones) DeletedIntervals(lset labels.Labels) tombstones.Intervals {
+	var intervals tombstones.Intervals
+	for _, t := range ts {
+		if t.Matches(lset) {
+			intervals = intervals.Add(tombstones.Interval{Mint: t.StartTime, Maxt: t.EndTime})
+		}
+	}
+	return intervals
+}
+
+// WriteTombstone uploads the series deletion request to the tenant location in the bucket,
+// overwriting the existing request with the same ID.
+func WriteTombstone(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, t *Tombstone) error {
+	bkt = bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return errors.Wrap(err, "serialize tombstone")
+	}
+
+	return errors.Wrap(bkt.Upload(ctx, t.path(), bytes.NewReader(data)), "upload tombstone")
+}
+
+// ReadTombstones returns all the series deletion requests of the tenant, sorted by creation time.
+func ReadTombstones(ctx context.Context, bkt objstore.BucketReader, userID string) (Tombstones, error) {
+	var ts Tombstones
+
+	err := bkt.Iter(ctx, path.Join(userID, TombstonesPath)+"/", func(name string) error {
+		if !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+
+		t, err := readTombstone(ctx, bkt, name)
+		if err != nil {
+			return err
+		}
+		// The request may have been deleted while iterating.
+		if t != nil {
+			ts = append(ts, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].RequestCreatedAt != ts[j].RequestCreatedAt {
+			return ts[i].RequestCreatedAt < ts[j].RequestCreatedAt
+		}
+		return ts[i].RequestID < ts[j].RequestID
+	})
+
+	return ts, nil
+}
+
+func readTombstone(ctx context.Context, bkt objstore.BucketReader, name string) (*Tombstone, error) {
+	r, err := bkt.Get(ctx, name)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrapf(err, "failed to read tombstone object: %s", name)
+	}
+
+	t := &Tombstone{}
+	err = json.NewDecoder(r).Decode(t)
+
+	// Close reader before dealing with decode error.
+	if closeErr := r.Close(); closeErr != nil {
+		level.Warn(util_log.Logger).Log("msg", "failed to close bucket reader", "err", closeErr)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode tombstone object: %s", name)
+	}
+
+	if err := t.parseSelectors(); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse tombstone object: %s", name)
+	}
+
+	return t, nil
+}
+
+// TombstonesLoader loads the series deletion requests of the tenants from the bucket, caching them
+// for the configured TTL to avoid listing the bucket for each query. A nil loader returns no requests.
+type TombstonesLoader struct {
+	bkt      objstore.BucketReader
+	cacheTTL time.Duration
+
+	mtx   sync.Mutex
+	cache map[string]cachedTombstones
+}
+
+type cachedTombstones struct {
+	tombstones Tombstones
+	fetchedAt  time.Time
+}
+
+func NewTombstonesLoader(bkt objstore.BucketReader, cacheTTL time.Duration) *TombstonesLoader {
+	return &TombstonesLoader{
+		bkt:      bkt,
+		cacheTTL: cacheTTL,
+		cache:    map[string]cachedTombstones{},
+	}
+}
+
+// GetTombstones returns the series deletion requests of the tenant which need to be applied at query time,
+// either pending or processed. If the requests can't be read from the bucket, the previously cached ones
+// are returned, and cached for another TTL.
+func (l *TombstonesLoader) GetTombstones(ctx context.Context, userID string) (Tombstones, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	l.mtx.Lock()
+	cached, ok := l.cache[userID]
+	l.mtx.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < l.cacheTTL {
+		return cached.tombstones, nil
+	}
+
+	ts, err := ReadTombstones(ctx, l.bkt, userID)
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+
+		level.Warn(util_log.Logger).Log("msg", "failed to read series deletion requests, using the cached ones", "user", userID, "err", err)
+		ts = cached.tombstones
+	} else {
+		ts = ts.notDone()
+	}
+
+	l.mtx.Lock()
+	l.cache[userID] = cachedTombstones{tombstones: ts, fetchedAt: time.Now()}
+	l.mtx.Unlock()
+
+	return ts, nil
+}
+
+// notDone returns the requests which are not done, modifying the input slice.
+func (ts Tombstones) notDone() Tombstones {
+	res := ts[:0]
+	for _, t := range ts {
+		if t.State != TombstoneDone {
+			res = append(res, t)
+		}
+	}
+	return res
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tsdb
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+func TestNewTombstone(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should return the same request ID for the same request", func(t *testing.T) {
+		first, err := NewTombstone(10, 20, []string{`{job="a"}`, `{job="b"}`}, now)
+		require.NoError(t, err)
+		second, err := NewTombstone(10, 20, []string{`{job="b"}`, `{job="a"}`}, now.Add(time.Minute))
+		require.NoError(t, err)
+		other, err := NewTombstone(10, 21, []string{`{job="a"}`, `{job="b"}`}, now)
+		require.NoError(t, err)
+
+		assert.Equal(t, first.RequestID, second.RequestID)
+		assert.NotEqual(t, first.RequestID, other.RequestID)
+		assert.Equal(t, TombstonePending, first.State)
+	})
+
+	t.Run("should fail on invalid requests", func(t *testing.T) {
+		_, err := NewTombstone(10, 20, nil, now)
+		assert.Error(t, err)
+		_, err = NewTombstone(20, 10, []string{`{job="a"}`}, now)
+		assert.Error(t, err)
+		_, err = NewTombstone(10, 20, []string{`{job=`}, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestNewSeriesRetentionTombstone(t *testing.T) {
+	now := time.Now()
+
+	first, err := NewSeriesRetentionTombstone(`{job="debug"}`, 14*24*time.Hour, now)
+	require.NoError(t, err)
+	second, err := NewSeriesRetentionTombstone(`{job="debug"}`, 14*24*time.Hour, now.Add(time.Hour))
+	require.NoError(t, err)
+	other, err := NewSeriesRetentionTombstone(`{job="debug"}`, 7*24*time.Hour, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.RequestID, second.RequestID)
+	assert.NotEqual(t, first.RequestID, other.RequestID)
+	assert.True(t, strings.HasPrefix(first.RequestID, SeriesRetentionRequestIDPrefix))
+
+	// The samples older than the retention period are deleted.
+	cutoff := now.Add(-14 * 24 * time.Hour).UnixMilli()
+	assert.Equal(t, tombstones.Intervals{{Mint: math.MinInt64, Maxt: cutoff - 1}}, Tombstones{first}.DeletedIntervals(labels.FromStrings("job", "debug")))
+	assert.Empty(t, Tombstones{first}.DeletedIntervals(labels.FromStrings("job", "slo")))
+
+	_, err = NewSeriesRetentionTombstone(`{job=`, time.Hour, now)
+	assert.Error(t, err)
+}
+
+func TestTombstones_DeletedIntervals(t *testing.T) {
+	newTombstone := func(start, end int64, selectors ...string) *Tombstone {
+		ts, err := NewTombstone(start, end, selectors, time.Now())
+		require.NoError(t, err)
+		return ts
+	}
+
+	ts := Tombstones{
+		newTombstone(10, 20, `{job="a"}`),
+		newTombstone(15, 30, `{job="a", instance="1"}`, `{job="b"}`),
+		newTombstone(50, 60, `{job=~"a|b"}`),
+	}
+
+	assert.Equal(t, tombstones.Intervals{{Mint: 10, Maxt: 20}, {Mint: 50, Maxt: 60}}, ts.DeletedIntervals(labels.FromStrings("job", "a", "instance", "2")))
+	assert.Equal(t, tombstones.Intervals{{Mint: 10, Maxt: 30}, {Mint: 50, Maxt: 60}}, ts.DeletedIntervals(labels.FromStrings("job", "a", "instance", "1")))
+	assert.Equal(t, tombstones.Intervals{{Mint: 15, Maxt: 30}, {Mint: 50, Maxt: 60}}, ts.DeletedIntervals(labels.FromStrings("job", "b")))
+	assert.Empty(t, ts.DeletedIntervals(labels.FromStrings("job", "c")))
+
+	assert.Len(t, ts.Overlapping(0, 9), 0)
+	assert.Len(t, ts.Overlapping(20, 40), 2)
+	assert.Len(t, ts.Overlapping(60, 70), 1)
+}
+
+func TestWriteAndReadTombstones(t *testing.T) {
+	const userID = "user"
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	first, err := NewTombstone(10, 20, []string{`{job="a"}`}, time.UnixMilli(1000))
+	require.NoError(t, err)
+	second, err := NewTombstone(30, 40, []string{`{job="b"}`}, time.UnixMilli(2000))
+	require.NoError(t, err)
+
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, second))
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, first))
+
+	ts, err := ReadTombstones(ctx, bkt, userID)
+	require.NoError(t, err)
+	assert.Equal(t, Tombstones{first, second}, ts)
+
+	// Overwriting the request updates its state.
+	second.State = TombstoneProcessed
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, second))
+
+	ts, err = ReadTombstones(ctx, bkt, userID)
+	require.NoError(t, err)
+	require.Len(t, ts, 2)
+	assert.Equal(t, TombstoneProcessed, ts[1].State)
+
+	// Other tenants have no requests.
+	ts, err = ReadTombstones(ctx, bkt, "other")
+	require.NoError(t, err)
+	assert.Empty(t, ts)
+}
+
+func TestTombstonesLoader(t *testing.T) {
+	const userID = "user"
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	ts, err := NewTombstone(10, 20, []string{`{job="a"}`}, time.Now())
+	require.NoError(t, err)
+
+	loader := NewTombstonesLoader(bkt, time.Hour)
+
+	// The empty result is cached as well.
+	actual, err := loader.GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, ts))
+
+	actual, err = loader.GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+
+	// Once the cache expired, the requests are read again.
+	loader.cacheTTL = 0
+	actual, err = loader.GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, Tombstones{ts}, actual)
+
+	// A nil loader returns no requests.
+	actual, err = (*TombstonesLoader)(nil).GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+}
+
+func TestTombstonesLoader_ShouldNotReturnDoneRequests(t *testing.T) {
+	const userID = "user"
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	processed, err := NewTombstone(10, 20, []string{`{job="a"}`}, time.Now())
+	require.NoError(t, err)
+	processed.State = TombstoneProcessed
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, processed))
+
+	done, err := NewTombstone(10, 20, []string{`{job="b"}`}, time.Now())
+	require.NoError(t, err)
+	done.State = TombstoneDone
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, done))
+
+	actual, err := NewTombstonesLoader(bkt, time.Hour).GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, actual, 1)
+	assert.Equal(t, processed.RequestID, actual[0].RequestID)
+}
+
+func TestTombstonesLoader_ShouldReturnCachedRequestsOnError(t *testing.T) {
+	const userID = "user"
+	ctx := context.Background()
+	bkt := &failingIterBucket{Bucket: objstore.NewInMemBucket()}
+
+	ts, err := NewTombstone(10, 20, []string{`{job="a"}`}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, WriteTombstone(ctx, bkt, userID, nil, ts))
+
+	loader := NewTombstonesLoader(bkt, 0)
+
+	// Without cached requests, the error is returned.
+	bkt.err = errors.New("listing failed")
+	_, err = loader.GetTombstones(ctx, userID)
+	require.Error(t, err)
+
+	bkt.err = nil
+	actual, err := loader.GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, Tombstones{ts}, actual)
+
+	// Once cached, the requests are returned even if they can't be read.
+	bkt.err = errors.New("listing failed")
+	actual, err = loader.GetTombstones(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, Tombstones{ts}, actual)
+}
+
+type failingIterBucket struct {
+	objstore.Bucket
+	err error
+}
+
+func (b *failingIterBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if b.err != nil {
+		return b.err
+	}
+	return b.Bucket.Iter(ctx, dir, f, options...)
+}
@@ -132,6 +132,12 @@ type BucketStore struct {
 
 	// Enables hints in the Series() response.
 	enableSeriesResponseHints bool
+
+	// Series deletion requests whose deleted samples are filtered out of the Series() response.
+	tombstones *mimir_tsdb.TombstonesLoader
+
+	// Number of series loaded from each block at once when streaming the Series() response. 0 to disable streaming.
+	seriesBatchSize int
 }
 
 type noopCache struct{}
@@ -202,6 +208,22 @@ func WithChunkPool(chunkPool pool.Bytes) BucketStoreOption {
 	}
 }
 
+// WithTombstones sets the loader of the series deletion requests, whose deleted samples are filtered
+// out of the Series() response.
+func WithTombstones(tombstones *mimir_tsdb.TombstonesLoader) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.tombstones = tombstones
+	}
+}
+
+// WithSeriesBatchSize enables the streaming of the Series() response: the series and chunks are loaded from
+// each block in batches of the given number of series, and sent as soon as they're loaded.
+func WithSeriesBatchSize(size int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.seriesBatchSize = size
+	}
+}
+
 // WithDebugLogging enables debug logging.
 func WithDebugLogging() BucketStoreOption {
 	return func(s *BucketStore) {
@@ -628,6 +650,39 @@ func blockSeries(
 
 	// Transform all series into the response types and mark their relevant chunks
 	// for preloading.
+	res, err := lookupSeries(ctx, indexr, chunkr, ps, shard, seriesHashCache, chunksLimiter, seriesLimiter, skipChunks, minTime, maxTime, &seriesCacheStats)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if skipChunks {
+		storeCachedSeries(ctx, indexr.block.indexCache, indexr.block.userID, indexr.block.meta.ULID, matchers, shard, res, logger)
+		return newBucketSeriesSet(res), indexr.stats.merge(&seriesCacheStats), nil
+	}
+
+	if err := chunkr.load(res, loadAggregates); err != nil {
+		return nil, nil, errors.Wrap(err, "load chunks")
+	}
+
+	return newBucketSeriesSet(res), indexr.stats.merge(chunkr.stats).merge(&seriesCacheStats), nil
+}
+
+// lookupSeries returns the series of the postings ps having chunks in the given time range, and schedules
+// the loading of their chunks through chunkr unless skipChunks is true. The series hash cache lookups are
+// accounted in stats.
+func lookupSeries(
+	ctx context.Context,
+	indexr *bucketIndexReader,
+	chunkr *bucketChunkReader,
+	ps []storage.SeriesRef,
+	shard *sharding.ShardSelector,
+	seriesHashCache *hashcache.BlockSeriesHashCache,
+	chunksLimiter ChunksLimiter,
+	seriesLimiter SeriesLimiter,
+	skipChunks bool,
+	minTime, maxTime int64,
+	stats *queryStats,
+) ([]seriesEntry, error) {
 	var (
 		res       []seriesEntry
 		lookupErr error
@@ -658,13 +713,13 @@ func blockSeries(
 			// Skip the series if it doesn't belong to the shard.
 			if shard != nil {
 				hash, ok := seriesHashCache.Fetch(id)
-				seriesCacheStats.seriesHashCacheRequests++
+				stats.seriesHashCacheRequests++
 
 				if !ok {
 					hash = lset.Hash()
 					seriesHashCache.Store(id, hash)
 				} else {
-					seriesCacheStats.seriesHashCacheHits++
+					stats.seriesHashCacheHits++
 				}
 
 				if hash%shard.ShardCount != shard.ShardIndex {
@@ -709,20 +764,7 @@ func blockSeries(
 		}
 	})
 
-	if lookupErr != nil {
-		return nil, nil, lookupErr
-	}
-
-	if skipChunks {
-		storeCachedSeries(ctx, indexr.block.indexCache, indexr.block.userID, indexr.block.meta.ULID, matchers, shard, res, logger)
-		return newBucketSeriesSet(res), indexr.stats.merge(&seriesCacheStats), nil
-	}
-
-	if err := chunkr.load(res, loadAggregates); err != nil {
-		return nil, nil, errors.Wrap(err, "load chunks")
-	}
-
-	return newBucketSeriesSet(res), indexr.stats.merge(chunkr.stats).merge(&seriesCacheStats), nil
+	return res, lookupErr
 }
 
 type seriesCacheEntry struct {
@@ -947,6 +989,11 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		reqBlockMatchers []*labels.Matcher
 		chunksLimiter    = s.chunksLimiterFactory(s.metrics.queriesDropped.WithLabelValues("chunks"))
 		seriesLimiter    = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
+
+		// When streaming, the series are loaded in batches while they're merged and sent. The requests
+		// not fetching chunks keep loading all series at once, because their result is cached.
+		streaming  = s.seriesBatchSize > 0 && !req.SkipChunks
+		streamSets []*batchedBlockSeriesSet
 	)
 
 	if req.Hints != nil {
@@ -961,6 +1008,17 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		}
 	}
 
+	// The samples deleted by the series deletion requests are filtered out until the compactor rewrites the blocks.
+	// The loader falls back to the last known requests when they can't be read, and if there are none, the query
+	// is served without filtering the deleted samples rather than failing until the requests can be read again.
+	tombstones, err := s.tombstones.GetTombstones(ctx, s.userID)
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "failed to read series deletion requests, the deleted samples won't be filtered out", "err", err)
+		s.metrics.tombstonesReadFailures.Inc()
+		tombstones = nil
+	}
+	tombstones = tombstones.Overlapping(req.MinTime, req.MaxTime)
+
 	gspan, gctx := tracing.StartSpan(gctx, "bucket_store_preload_all")
 
 	s.mtx.RLock()
@@ -988,7 +1046,12 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 			var chunkr *bucketChunkReader
 			// We must keep the readers open until all their data has been sent.
 			indexr := b.indexReader()
-			if !req.SkipChunks {
+			if streaming {
+				// The batches following the first one are loaded once the errgroup context has been canceled.
+				chunkr = b.chunkReader(ctx)
+				chunkr.unpooled = true
+				defer runutil.CloseWithLogOnErr(s.logger, chunkr, "series block")
+			} else if !req.SkipChunks {
 				chunkr = b.chunkReader(gctx)
 				defer runutil.CloseWithLogOnErr(s.logger, chunkr, "series block")
 			}
@@ -1003,6 +1066,24 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				blockSeriesHashCache = s.seriesHashCache.GetBlockCache(b.meta.ULID.String())
 			}
 
+			if streaming {
+				set := newBatchedBlockSeriesSet(ctx, indexr, chunkr, blockMatchers, shardSelector, blockSeriesHashCache, chunksLimiter, seriesLimiter, req.MinTime, req.MaxTime, req.Aggregates, s.seriesBatchSize)
+
+				g.Go(func() error {
+					if err := set.init(gctx); err != nil {
+						return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
+					}
+
+					mtx.Lock()
+					res = append(res, set)
+					streamSets = append(streamSets, set)
+					mtx.Unlock()
+
+					return nil
+				})
+				continue
+			}
+
 			g.Go(func() error {
 				part, pstats, err := blockSeries(
 					gctx,
@@ -1095,9 +1176,23 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 			var lset labels.Labels
 			if req.SkipChunks {
 				lset, _ = set.At()
+
+				if len(tombstones) > 0 && coveredByIntervals(tombstones.DeletedIntervals(lset), req.MinTime, req.MaxTime) {
+					continue
+				}
 			} else {
 				lset, series.Chunks = set.At()
 
+				if len(tombstones) > 0 {
+					if series.Chunks, err = filterDeletedChunks(series.Chunks, tombstones.DeletedIntervals(lset)); err != nil {
+						err = status.Error(codes.Internal, errors.Wrap(err, "filter deleted samples").Error())
+						return
+					}
+					if len(series.Chunks) == 0 {
+						continue
+					}
+				}
+
 				stats.mergedChunksCount += len(series.Chunks)
 				s.metrics.chunkSizeBytes.Observe(float64(chunksSize(series.Chunks)))
 			}
@@ -1108,7 +1203,12 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 			}
 		}
 		if set.Err() != nil {
-			err = status.Error(codes.Unknown, errors.Wrap(set.Err(), "expand series set").Error())
+			// The streamed series sets fail when a limit is reached, whose error carries its own status code.
+			code := codes.Unknown
+			if s, ok := status.FromError(errors.Cause(set.Err())); ok {
+				code = s.Code()
+			}
+			err = status.Error(code, errors.Wrap(set.Err(), "expand series set").Error())
 			return
 		}
 		stats.mergeDuration = time.Since(begin)
@@ -1117,6 +1217,14 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		err = nil
 	})
 
+	// The streamed series sets keep fetching data from the blocks while they're merged.
+	for _, set := range streamSets {
+		stats = stats.merge(set.stats())
+	}
+	if err != nil {
+		return err
+	}
+
 	if s.enableSeriesResponseHints {
 		var anyHints *types.Any
 
@@ -1550,7 +1658,8 @@ func int64index(s []int64, x int64) int {
 
 // getFor returns a time-ordered list of blocks that cover date between mint and maxt.
 // Blocks with the biggest resolution possible but not bigger than the given max resolution are returned.
-// It supports overlapping blocks.
+// It supports overlapping blocks. The blocks not matching the block-level matchers are ignored, so that
+// the resolution is picked among the blocks requested by the querier.
 //
 // NOTE: s.blocks are expected to be sorted in minTime order.
 func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64, blockMatchers []*labels.Matcher) (bs []*bucketBlock) {
@@ -1579,16 +1688,16 @@ func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64, blockMatc
 			break
 		}
 
-		if i+1 < len(s.resolutions) {
-			bs = append(bs, s.getFor(start, b.meta.MinTime-1, s.resolutions[i+1], blockMatchers)...)
+		// Consider the block only if there are no block-level matchers or they actually match.
+		if len(blockMatchers) > 0 && !b.matchRelabelLabels(blockMatchers) {
+			continue
 		}
 
-		// Include the block in the list of matching ones only if there are no block-level matchers
-		// or they actually match.
-		if len(blockMatchers) == 0 || b.matchRelabelLabels(blockMatchers) {
-			bs = append(bs, b)
+		if i+1 < len(s.resolutions) {
+			bs = append(bs, s.getFor(start, b.meta.MinTime-1, s.resolutions[i+1], blockMatchers)...)
 		}
 
+		bs = append(bs, b)
 		start = b.meta.MaxTime
 	}
 
@@ -2375,6 +2484,13 @@ func (it *bigEndianPostings) length() int {
 	return len(it.list) / 4
 }
 
+// resetLoadedSeries releases the series preloaded so far.
+func (r *bucketIndexReader) resetLoadedSeries() {
+	r.mtx.Lock()
+	r.loadedSeries = map[storage.SeriesRef][]byte{}
+	r.mtx.Unlock()
+}
+
 func (r *bucketIndexReader) PreloadSeries(ctx context.Context, ids []storage.SeriesRef) error {
 	span, ctx := tracing.StartSpan(ctx, "PreloadSeries()")
 	defer span.Finish()
@@ -2577,6 +2693,11 @@ type bucketChunkReader struct {
 
 	toLoad [][]loadIdx
 
+	// If true, the loaded chunks are copied to memory not taken from the chunk pool. It's used when streaming the
+	// series, because the merged series set may still reference the chunks of a batch while the next one is loaded,
+	// and the memory of the chunks already sent can be released without waiting for the reader to be closed.
+	unpooled bool
+
 	// Mutex protects access to following fields, when updated from chunks-loading goroutines.
 	// After chunks are loaded, mutex is no longer used.
 	mtx        sync.Mutex
@@ -2602,6 +2723,14 @@ func (r *bucketChunkReader) Close() error {
 	return nil
 }
 
+// reset clears the chunks scheduled for loading, so that the reader can be used to load the chunks
+// of another batch of series.
+func (r *bucketChunkReader) reset() {
+	for seq := range r.toLoad {
+		r.toLoad[seq] = r.toLoad[seq][:0]
+	}
+}
+
 // addLoad adds the chunk with id to the data set to be fetched.
 // Chunk will be fetched and saved to res[seriesEntry][chunk] upon r.load(res, <...>) call.
 func (r *bucketChunkReader) addLoad(id chunks.ChunkRef, seriesEntry, chunk int) error {
@@ -2758,8 +2887,12 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 }
 
 // save saves a copy of b's payload to a memory pool of its own and returns a new byte slice referencing said copy.
-// Returned slice becomes invalid once r.block.chunkPool.Put() is called.
+// Returned slice becomes invalid once r.block.chunkPool.Put() is called, unless the reader is unpooled.
 func (r *bucketChunkReader) save(b []byte) ([]byte, error) {
+	if r.unpooled {
+		return append(make([]byte, 0, len(b)), b...), nil
+	}
+
 	// Ensure we never grow slab beyond original capacity.
 	if len(r.chunkBytes) == 0 ||
 		cap(*r.chunkBytes[len(r.chunkBytes)-1])-len(*r.chunkBytes[len(r.chunkBytes)-1]) < len(b) {
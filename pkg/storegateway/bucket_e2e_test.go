@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -16,15 +17,19 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/gogo/status"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/tsdb/hashcache"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/weaveworks/common/httpgrpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/grafana/mimir/pkg/storage/bucket"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storegateway/indexcache"
 	"github.com/grafana/mimir/pkg/storegateway/indexheader"
@@ -484,6 +489,39 @@ func TestBucketStore_ManyParts_e2e(t *testing.T) {
 	})
 }
 
+func TestBucketStore_StreamingSeries_e2e(t *testing.T) {
+	for _, batchSize := range []int{1, 3, 1000} {
+		t.Run(fmt.Sprintf("batch size: %d", batchSize), func(t *testing.T) {
+			foreachStore(t, func(t *testing.T, bkt objstore.Bucket) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				dir := t.TempDir()
+
+				s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0))
+				s.store.seriesBatchSize = batchSize
+
+				if ok := t.Run("no index cache", func(t *testing.T) {
+					s.cache.SwapWith(noopCache{})
+					testBucketStore_e2e(t, ctx, s)
+				}); !ok {
+					return
+				}
+
+				t.Run("with large, sufficient index cache", func(t *testing.T) {
+					indexCache, err := indexcache.NewInMemoryIndexCacheWithConfig(s.logger, nil, indexcache.InMemoryIndexCacheConfig{
+						MaxItemSize: 1e5,
+						MaxSize:     2e5,
+					})
+					assert.NoError(t, err)
+					s.cache.SwapWith(indexCache)
+					testBucketStore_e2e(t, ctx, s)
+				})
+			})
+		})
+	}
+}
+
 func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	// The query will fetch 2 series from 6 blocks, so we do expect to hit a total of 12 chunks.
 	expectedChunks := uint64(2 * 6)
@@ -516,39 +554,72 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 
 	for testName, testData := range cases {
-		t.Run(testName, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-			bkt := objstore.NewInMemBucket()
+		for _, batchSize := range []int{0, 1} {
+			testName, testData, batchSize := testName, testData, batchSize
 
-			dir := t.TempDir()
+			t.Run(fmt.Sprintf("%s, series batch size: %d", testName, batchSize), func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				bkt := objstore.NewInMemBucket()
 
-			s := prepareStoreWithTestBlocks(t, dir, bkt, false, newCustomChunksLimiterFactory(testData.maxChunksLimit, testData.code), newCustomSeriesLimiterFactory(testData.maxSeriesLimit, testData.code))
-			assert.NoError(t, s.store.SyncBlocks(ctx))
+				dir := t.TempDir()
 
-			req := &storepb.SeriesRequest{
-				Matchers: []storepb.LabelMatcher{
-					{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
-				},
-				MinTime: minTimeDuration.PrometheusTimestamp(),
-				MaxTime: maxTimeDuration.PrometheusTimestamp(),
-			}
+				s := prepareStoreWithTestBlocks(t, dir, bkt, false, newCustomChunksLimiterFactory(testData.maxChunksLimit, testData.code), newCustomSeriesLimiterFactory(testData.maxSeriesLimit, testData.code))
+				s.store.seriesBatchSize = batchSize
+				assert.NoError(t, s.store.SyncBlocks(ctx))
 
-			s.cache.SwapWith(noopCache{})
-			srv := newBucketStoreSeriesServer(ctx)
-			err := s.store.Series(req, srv)
+				req := &storepb.SeriesRequest{
+					Matchers: []storepb.LabelMatcher{
+						{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+					},
+					MinTime: minTimeDuration.PrometheusTimestamp(),
+					MaxTime: maxTimeDuration.PrometheusTimestamp(),
+				}
+
+				s.cache.SwapWith(noopCache{})
+				srv := newBucketStoreSeriesServer(ctx)
+				err := s.store.Series(req, srv)
+
+				if testData.expectedErr == "" {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+					assert.True(t, strings.Contains(err.Error(), testData.expectedErr))
+					status, ok := status.FromError(err)
+					assert.Equal(t, true, ok)
+					assert.Equal(t, testData.code, status.Code())
+				}
+			})
+		}
+	}
+}
 
-			if testData.expectedErr == "" {
-				assert.NoError(t, err)
-			} else {
-				assert.Error(t, err)
-				assert.True(t, strings.Contains(err.Error(), testData.expectedErr))
-				status, ok := status.FromError(err)
-				assert.Equal(t, true, ok)
-				assert.Equal(t, testData.code, status.Code())
-			}
-		})
+func TestBucketStore_Series_ShouldNotFailWhenTheSeriesDeletionRequestsCantBeRead_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := prepareStoreWithTestBlocks(t, t.TempDir(), objstore.NewInMemBucket(), false, newCustomChunksLimiterFactory(0, codes.OK), newCustomSeriesLimiterFactory(0, codes.OK))
+
+	tombstonesBkt := &bucket.ClientMock{}
+	tombstonesBkt.MockIter(path.Join("tenant", mimir_tsdb.TombstonesPath)+"/", nil, errors.New("failed to list the series deletion requests"))
+	s.store.tombstones = mimir_tsdb.NewTombstonesLoader(tombstonesBkt, time.Minute)
+
+	req := &storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+		},
+		MinTime: minTimeDuration.PrometheusTimestamp(),
+		MaxTime: maxTimeDuration.PrometheusTimestamp(),
 	}
+
+	s.cache.SwapWith(noopCache{})
+	for i := 0; i < 2; i++ {
+		srv := newBucketStoreSeriesServer(ctx)
+		require.NoError(t, s.store.Series(req, srv))
+		assert.Len(t, srv.SeriesSet, 4)
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(s.store.metrics.tombstonesReadFailures))
 }
 
 func TestBucketStore_LabelNames_e2e(t *testing.T) {
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/hashcache"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tracing"
+
+	"github.com/grafana/mimir/pkg/storage/sharding"
+)
+
+// batchedBlockSeriesSet is a storepb.SeriesSet which loads the series matching a request, and their chunks,
+// from a block in batches of postings. Each batch is loaded only once the previous one has been iterated,
+// so the memory used by the request is bounded by the batch size instead of the number of matching series,
+// and the request stops fetching data from the block as soon as a limit is reached.
+type batchedBlockSeriesSet struct {
+	ctx             context.Context
+	indexr          *bucketIndexReader
+	chunkr          *bucketChunkReader
+	matchers        []*labels.Matcher
+	shard           *sharding.ShardSelector
+	seriesHashCache *hashcache.BlockSeriesHashCache
+	chunksLimiter   ChunksLimiter
+	seriesLimiter   SeriesLimiter
+	minTime         int64
+	maxTime         int64
+	loadAggregates  []storepb.Aggr
+	batchSize       int
+
+	// The postings whose series haven't been loaded yet.
+	postings []storage.SeriesRef
+
+	batch            []seriesEntry
+	i                int
+	seriesCacheStats queryStats
+	err              error
+}
+
+func newBatchedBlockSeriesSet(
+	ctx context.Context, // Context used to load the batches following the first one.
+	indexr *bucketIndexReader,
+	chunkr *bucketChunkReader, // Chunk reader for block, which must be unpooled.
+	matchers []*labels.Matcher,
+	shard *sharding.ShardSelector,
+	seriesHashCache *hashcache.BlockSeriesHashCache,
+	chunksLimiter ChunksLimiter,
+	seriesLimiter SeriesLimiter,
+	minTime, maxTime int64,
+	loadAggregates []storepb.Aggr,
+	batchSize int,
+) *batchedBlockSeriesSet {
+	return &batchedBlockSeriesSet{
+		ctx:             ctx,
+		indexr:          indexr,
+		chunkr:          chunkr,
+		matchers:        matchers,
+		shard:           shard,
+		seriesHashCache: seriesHashCache,
+		chunksLimiter:   chunksLimiter,
+		seriesLimiter:   seriesLimiter,
+		minTime:         minTime,
+		maxTime:         maxTime,
+		loadAggregates:  loadAggregates,
+		batchSize:       batchSize,
+		i:               -1,
+	}
+}
+
+// init expands the postings matching the request and loads the first batch of series, so that the first
+// batches of all the queried blocks are loaded concurrently.
+func (s *batchedBlockSeriesSet) init(ctx context.Context) error {
+	span, ctx := tracing.StartSpan(ctx, "blockSeries()")
+	span.LogKV("block ID", s.indexr.block.meta.ULID.String(), "batch size", s.batchSize)
+	defer span.Finish()
+
+	ps, err := s.indexr.ExpandedPostings(ctx, s.matchers)
+	if err != nil {
+		return errors.Wrap(err, "expanded matching posting")
+	}
+
+	// Remove the postings of the series whose hash is cached and which don't belong to the shard.
+	if s.shard != nil {
+		ps, s.seriesCacheStats = filterPostingsByCachedShardHash(ps, s.shard, s.seriesHashCache)
+	}
+	s.postings = ps
+
+	if len(s.postings) == 0 {
+		return nil
+	}
+	return s.loadBatch(ctx)
+}
+
+// loadBatch loads the series of the next batch of postings, and their chunks, releasing the previous batch.
+func (s *batchedBlockSeriesSet) loadBatch(ctx context.Context) error {
+	span, ctx := tracing.StartSpan(ctx, "blockSeries() load batch")
+	defer span.Finish()
+
+	size := s.batchSize
+	if len(s.postings) < size {
+		size = len(s.postings)
+	}
+	ps := s.postings[:size]
+	s.postings = s.postings[size:]
+	span.LogKV("block ID", s.indexr.block.meta.ULID.String(), "postings", len(ps))
+
+	s.batch, s.i = nil, -1
+	s.indexr.resetLoadedSeries()
+	s.chunkr.reset()
+
+	if err := s.indexr.PreloadSeries(ctx, ps); err != nil {
+		return errors.Wrap(err, "preload series")
+	}
+
+	res, err := lookupSeries(ctx, s.indexr, s.chunkr, ps, s.shard, s.seriesHashCache, s.chunksLimiter, s.seriesLimiter, false, s.minTime, s.maxTime, &s.seriesCacheStats)
+	if err != nil {
+		return err
+	}
+
+	if err := s.chunkr.load(res, s.loadAggregates); err != nil {
+		return errors.Wrap(err, "load chunks")
+	}
+
+	s.batch = res
+	return nil
+}
+
+func (s *batchedBlockSeriesSet) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	// The series of a batch may all be filtered out, so we keep loading batches until we find one with series.
+	for s.i >= len(s.batch)-1 {
+		if len(s.postings) == 0 {
+			s.batch, s.i = nil, -1
+			return false
+		}
+		if err := s.loadBatch(s.ctx); err != nil {
+			s.err = errors.Wrapf(err, "fetch series for block %s", s.indexr.block.meta.ULID)
+			return false
+		}
+	}
+
+	s.i++
+	return true
+}
+
+func (s *batchedBlockSeriesSet) At() (labels.Labels, []storepb.AggrChunk) {
+	return s.batch[s.i].lset, s.batch[s.i].chks
+}
+
+func (s *batchedBlockSeriesSet) Err() error {
+	return s.err
+}
+
+// stats returns the stats of the data fetched from the block so far.
+func (s *batchedBlockSeriesSet) stats() *queryStats {
+	return s.indexr.stats.merge(s.chunkr.stats).merge(&s.seriesCacheStats)
+}
@@ -64,6 +64,9 @@ type BucketStores struct {
 	// Series hash cache shared across all tenants.
 	seriesHashCache *hashcache.SeriesHashCache
 
+	// Series deletion requests of all tenants.
+	tombstones *tsdb.TombstonesLoader
+
 	// Chunks bytes pool shared across all tenants.
 	chunksPool pool.Bytes
 
@@ -113,6 +116,7 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		queryGate:          queryGate,
 		partitioner:        newGapBasedPartitioner(cfg.BucketStore.PartitionerMaxGapBytes, reg),
 		seriesHashCache:    hashcache.NewSeriesHashCache(cfg.BucketStore.SeriesHashCacheMaxBytes),
+		tombstones:         tsdb.NewTombstonesLoader(bucketClient, cfg.BucketStore.TombstonesCacheTTL),
 		syncBackoffConfig: backoff.Config{
 			MinBackoff: 1 * time.Second,
 			MaxBackoff: 10 * time.Second,
@@ -474,6 +478,8 @@ func (u *BucketStores) getOrCreateStore(userID string) (*BucketStore, error) {
 		WithIndexCache(u.indexCache),
 		WithQueryGate(u.queryGate),
 		WithChunkPool(u.chunksPool),
+		WithTombstones(u.tombstones),
+		WithSeriesBatchSize(u.cfg.BucketStore.SeriesBatchSize),
 	}
 	if u.logLevel.String() == "debug" {
 		bucketStoreOpts = append(bucketStoreOpts, WithDebugLogging())
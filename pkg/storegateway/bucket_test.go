@@ -21,6 +21,7 @@ import (
 	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -431,6 +432,63 @@ func TestBucketBlockSet_remove(t *testing.T) {
 	assert.Equal(t, input[2].id, res[1].meta.ULID)
 }
 
+func TestBucketBlockSet_getFor_WithBlockMatchers(t *testing.T) {
+	set := newBucketBlockSet(labels.Labels{})
+
+	type resBlock struct {
+		id         ulid.ULID
+		window     int64
+		mint, maxt int64
+	}
+	input := []resBlock{
+		{id: ulid.MustNew(1, nil), window: downsample.ResLevel0, mint: 0, maxt: 100},
+		{id: ulid.MustNew(2, nil), window: downsample.ResLevel0, mint: 100, maxt: 200},
+		{id: ulid.MustNew(3, nil), window: downsample.ResLevel1, mint: 0, maxt: 100},
+		{id: ulid.MustNew(4, nil), window: downsample.ResLevel1, mint: 100, maxt: 200},
+	}
+
+	for _, in := range input {
+		var m metadata.Meta
+		m.ULID = in.id
+		m.Thanos.Downsample.Resolution = in.window
+		m.MinTime = in.mint
+		m.MaxTime = in.maxt
+		assert.NoError(t, set.add(&bucketBlock{meta: &m, relabelLabels: labels.FromStrings(block.BlockIDLabel, in.id.String())}))
+	}
+
+	for name, tc := range map[string]struct {
+		requested []ulid.ULID
+		expected  []ulid.ULID
+	}{
+		"downsampled blocks requested": {
+			requested: []ulid.ULID{input[2].id, input[3].id},
+			expected:  []ulid.ULID{input[2].id, input[3].id},
+		},
+		"raw blocks requested": {
+			requested: []ulid.ULID{input[0].id, input[1].id},
+			expected:  []ulid.ULID{input[0].id, input[1].id},
+		},
+		"mixed resolutions requested": {
+			requested: []ulid.ULID{input[2].id, input[1].id},
+			expected:  []ulid.ULID{input[2].id, input[1].id},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ids := make([]string, 0, len(tc.requested))
+			for _, id := range tc.requested {
+				ids = append(ids, id.String())
+			}
+			matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, block.BlockIDLabel, strings.Join(ids, "|"))}
+
+			var actual []ulid.ULID
+			for _, b := range set.getFor(0, 200, downsample.ResLevel1, matchers) {
+				actual = append(actual, b.meta.ULID)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
 func TestBucketBlockSet_labelMatchers(t *testing.T) {
 	set := newBucketBlockSet(labels.FromStrings("a", "b", "c", "d"))
 
@@ -2244,7 +2302,7 @@ func BenchmarkBlockSeries(b *testing.B) {
 	}
 }
 
-func prepareBucket(b *testing.B, resolutionLevel compactor.ResolutionLevel) (*bucketBlock, *metadata.Meta) {
+func prepareBucket(b testing.TB, resolutionLevel compactor.ResolutionLevel) (*bucketBlock, *metadata.Meta) {
 	var (
 		ctx    = context.Background()
 		logger = log.NewNopLogger()
@@ -2502,6 +2560,93 @@ func TestBlockSeries_Cache(t *testing.T) {
 	})
 }
 
+func TestBatchedBlockSeriesSet(t *testing.T) {
+	blk, blockMeta := prepareBucket(t, compactor.ResolutionLevelRaw)
+
+	var (
+		ctx             = context.Background()
+		aggrs           = []storepb.Aggr{storepb.Aggr_RAW}
+		seriesHashCache = hashcache.NewSeriesHashCache(1024 * 1024).GetBlockCache(blockMeta.ULID.String())
+	)
+
+	readSeries := func(t *testing.T, set storepb.SeriesSet) []storepb.Series {
+		var res []storepb.Series
+		for set.Next() {
+			lset, chks := set.At()
+			res = append(res, storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset), Chunks: chks})
+		}
+		require.NoError(t, set.Err())
+		return res
+	}
+
+	newBatchedSet := func(t *testing.T, matchers []*labels.Matcher, shard *sharding.ShardSelector, seriesLimiter SeriesLimiter, batchSize int) *batchedBlockSeriesSet {
+		indexr, chunkr := blk.indexReader(), blk.chunkReader(ctx)
+		chunkr.unpooled = true
+		t.Cleanup(func() {
+			require.NoError(t, indexr.Close())
+			require.NoError(t, chunkr.Close())
+		})
+
+		set := newBatchedBlockSeriesSet(ctx, indexr, chunkr, matchers, shard, seriesHashCache, NewChunksLimiterFactory(0)(nil), seriesLimiter, blockMeta.MinTime, blockMeta.MaxTime, aggrs, batchSize)
+		require.NoError(t, set.init(ctx))
+		return set
+	}
+
+	tests := map[string]struct {
+		matchers []*labels.Matcher
+		shard    *sharding.ShardSelector
+	}{
+		"all series": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "i", ".+")},
+		},
+		"subset of the series": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "i", ".*1.*")},
+		},
+		"shard of the series": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "i", ".+")},
+			shard:    &sharding.ShardSelector{ShardIndex: 1, ShardCount: 3},
+		},
+	}
+
+	for name, tc := range tests {
+		for _, batchSize := range []int{1, 7, 1000, 5000} {
+			t.Run(fmt.Sprintf("%s, batch size: %d", name, batchSize), func(t *testing.T) {
+				indexr, chunkr := blk.indexReader(), blk.chunkReader(ctx)
+				defer func() {
+					require.NoError(t, indexr.Close())
+					require.NoError(t, chunkr.Close())
+				}()
+
+				expectedSet, expectedStats, err := blockSeries(ctx, indexr, chunkr, tc.matchers, tc.shard, seriesHashCache, NewChunksLimiterFactory(0)(nil), NewSeriesLimiterFactory(0)(nil), false, blockMeta.MinTime, blockMeta.MaxTime, aggrs, log.NewNopLogger())
+				require.NoError(t, err)
+				expected := readSeries(t, expectedSet)
+				require.NotEmpty(t, expected)
+
+				set := newBatchedSet(t, tc.matchers, tc.shard, NewSeriesLimiterFactory(0)(nil), batchSize)
+				assert.Equal(t, expected, readSeries(t, set))
+				assert.Equal(t, expectedStats.chunksTouched, set.stats().chunksTouched)
+			})
+		}
+	}
+
+	t.Run("stops loading the series once the series limit is reached", func(t *testing.T) {
+		seriesLimiter := NewSeriesLimiterFactory(10)(prometheus.NewCounter(prometheus.CounterOpts{}))
+		set := newBatchedSet(t, []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "i", ".+")}, nil, seriesLimiter, 3)
+
+		var count int
+		for set.Next() {
+			count++
+		}
+		require.Error(t, set.Err())
+		assert.Contains(t, set.Err().Error(), "exceeded series limit")
+
+		// The series of the batches loaded before reaching the limit have been returned,
+		// and no series has been read after the one exceeding the limit.
+		assert.Equal(t, 9, count)
+		assert.Equal(t, 11, set.stats().seriesTouched)
+	})
+}
+
 func lsetFromSeriesSet(t *testing.T, ss storepb.SeriesSet) []labels.Labels {
 	var lset []labels.Labels
 	for ss.Next() {
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// filterDeletedChunks removes the samples in the deleted intervals from the chunks, modifying the input slice.
+// The fully deleted chunks are removed, while the partially deleted raw chunks are re-encoded. The partially
+// deleted downsampled chunks are returned as is, and their deleted samples are filtered out by the querier.
+func filterDeletedChunks(chks []storepb.AggrChunk, intervals tombstones.Intervals) ([]storepb.AggrChunk, error) {
+	if len(intervals) == 0 {
+		return chks, nil
+	}
+
+	res := chks[:0]
+	for _, chk := range chks {
+		switch {
+		case !overlapsIntervals(intervals, chk.MinTime, chk.MaxTime):
+			res = append(res, chk)
+
+		case coveredByIntervals(intervals, chk.MinTime, chk.MaxTime):
+			// The whole chunk has been deleted.
+
+		case chk.Raw == nil || chk.Raw.Type != storepb.Chunk_XOR:
+			res = append(res, chk)
+
+		default:
+			filtered, ok, err := filterDeletedSamples(chk.Raw.Data, intervals)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res = append(res, filtered)
+			}
+		}
+	}
+	return res, nil
+}
+
+// filterDeletedSamples re-encodes the XOR chunk without the samples in the deleted intervals.
+// It returns false if all the samples have been deleted.
+func filterDeletedSamples(data []byte, intervals tombstones.Intervals) (storepb.AggrChunk, bool, error) {
+	in, err := chunkenc.FromData(chunkenc.EncXOR, data)
+	if err != nil {
+		return storepb.AggrChunk{}, false, errors.Wrap(err, "decode chunk")
+	}
+
+	out := chunkenc.NewXORChunk()
+	app, err := out.Appender()
+	if err != nil {
+		return storepb.AggrChunk{}, false, errors.Wrap(err, "create chunk appender")
+	}
+
+	res := storepb.AggrChunk{}
+	it := in.Iterator(nil)
+	for it.Next() {
+		ts, v := it.At()
+		if inIntervals(intervals, ts) {
+			continue
+		}
+
+		if out.NumSamples() == 0 {
+			res.MinTime = ts
+		}
+		res.MaxTime = ts
+		app.Append(ts, v)
+	}
+	if err := it.Err(); err != nil {
+		return storepb.AggrChunk{}, false, errors.Wrap(err, "iterate chunk")
+	}
+
+	if out.NumSamples() == 0 {
+		return storepb.AggrChunk{}, false, nil
+	}
+
+	res.Raw = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: out.Bytes()}
+	return res, true, nil
+}
+
+func overlapsIntervals(intervals tombstones.Intervals, mint, maxt int64) bool {
+	for _, interval := range intervals {
+		if interval.Mint <= maxt && interval.Maxt >= mint {
+			return true
+		}
+	}
+	return false
+}
+
+func coveredByIntervals(intervals tombstones.Intervals, mint, maxt int64) bool {
+	for _, interval := range intervals {
+		if interval.Mint <= mint && interval.Maxt >= maxt {
+			return true
+		}
+	}
+	return false
+}
+
+func inIntervals(intervals tombstones.Intervals, ts int64) bool {
+	for _, interval := range intervals {
+		if interval.InBounds(ts) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+func TestFilterDeletedChunks(t *testing.T) {
+	newChunk := func(timestamps ...int64) storepb.AggrChunk {
+		chk := chunkenc.NewXORChunk()
+		app, err := chk.Appender()
+		require.NoError(t, err)
+		for _, ts := range timestamps {
+			app.Append(ts, float64(ts))
+		}
+		return storepb.AggrChunk{
+			MinTime: timestamps[0],
+			MaxTime: timestamps[len(timestamps)-1],
+			Raw:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()},
+		}
+	}
+
+	downsampled := storepb.AggrChunk{MinTime: 30, MaxTime: 39, Count: &storepb.Chunk{Type: storepb.Chunk_XOR}}
+
+	tests := map[string]struct {
+		chunks    []storepb.AggrChunk
+		intervals tombstones.Intervals
+		expected  []storepb.AggrChunk
+	}{
+		"no deleted intervals": {
+			chunks:   []storepb.AggrChunk{newChunk(0, 1, 2), newChunk(3, 4, 5)},
+			expected: []storepb.AggrChunk{newChunk(0, 1, 2), newChunk(3, 4, 5)},
+		},
+		"chunks not overlapping the deleted intervals": {
+			chunks:    []storepb.AggrChunk{newChunk(0, 1, 2), newChunk(10, 11, 12)},
+			intervals: tombstones.Intervals{{Mint: 3, Maxt: 9}, {Mint: 13, Maxt: 20}},
+			expected:  []storepb.AggrChunk{newChunk(0, 1, 2), newChunk(10, 11, 12)},
+		},
+		"fully deleted chunk": {
+			chunks:    []storepb.AggrChunk{newChunk(0, 1, 2), newChunk(10, 11, 12)},
+			intervals: tombstones.Intervals{{Mint: 5, Maxt: 15}},
+			expected:  []storepb.AggrChunk{newChunk(0, 1, 2)},
+		},
+		"partially deleted chunks": {
+			chunks:    []storepb.AggrChunk{newChunk(0, 1, 2, 3, 4), newChunk(10, 11, 12)},
+			intervals: tombstones.Intervals{{Mint: 1, Maxt: 2}, {Mint: 4, Maxt: 10}},
+			expected:  []storepb.AggrChunk{newChunk(0, 3), newChunk(11, 12)},
+		},
+		"chunk without samples left": {
+			chunks:    []storepb.AggrChunk{newChunk(0, 5, 10)},
+			intervals: tombstones.Intervals{{Mint: 0, Maxt: 1}, {Mint: 4, Maxt: 6}, {Mint: 9, Maxt: 20}},
+			expected:  []storepb.AggrChunk{},
+		},
+		"partially deleted downsampled chunk": {
+			chunks:    []storepb.AggrChunk{downsampled},
+			intervals: tombstones.Intervals{{Mint: 35, Maxt: 40}},
+			expected:  []storepb.AggrChunk{downsampled},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := filterDeletedChunks(tc.chunks, tc.intervals)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,392 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+const (
+	// OverflowValue is the value of all the attribution labels of the usage which can't be attributed
+	// because the tenant reached the maximum cardinality of the cost attribution.
+	OverflowValue = "__overflow__"
+
+	userLabel   = "user"
+	reasonLabel = "reason"
+
+	// keySeparator separates the values of the attribution labels in the attribution keys.
+	keySeparator = "\xff"
+)
+
+// Limits are the per-tenant limits used by the Tracker.
+type Limits interface {
+	CostAttributionLabels(userID string) []string
+	MaxCostAttributionCardinalityPerUser(userID string) int
+}
+
+// Tracker tracks the usage of each tenant broken down by the values of the tenant's cost attribution
+// labels, so that it can be charged back to the teams and services the series belong to. The number of
+// distinct combinations of values tracked for each tenant is limited: once the limit is reached, the
+// usage with new combinations is attributed to the overflow combination, where all the labels have
+// the OverflowValue value.
+//
+// The tracked usage is exposed as metrics by the Tracker, which implements prometheus.Collector, and
+// in JSON format by its HTTP handler.
+type Tracker struct {
+	limits Limits
+
+	receivedSamplesDesc  string
+	discardedSamplesDesc string
+	activeSeriesDesc     string
+
+	// The mutex only protects the map of tenants, while the attributions of each tenant are protected
+	// by the tenant's mutex, so that the pushes of different tenants don't contend on the same lock.
+	mtx   sync.RWMutex
+	users map[string]*userTracker
+}
+
+type userTracker struct {
+	// The cost attribution labels as configured, and the valid ones the usage is attributed by.
+	configuredLabels []string
+	labels           []string
+
+	mtx          sync.Mutex
+	attributions map[string]*attribution
+}
+
+type attribution struct {
+	key        string
+	values     []string
+	lastUpdate time.Time
+
+	receivedSamples  float64
+	discardedSamples map[string]float64
+	activeSeries     int
+}
+
+// NewTracker returns a Tracker whose metrics are named after the component, e.g. cortex_<component>_attributed_active_series.
+func NewTracker(component string, limits Limits) *Tracker {
+	return &Tracker{
+		limits:               limits,
+		receivedSamplesDesc:  "cortex_" + component + "_attributed_received_samples_total",
+		discardedSamplesDesc: "cortex_" + component + "_attributed_discarded_samples_total",
+		activeSeriesDesc:     "cortex_" + component + "_attributed_active_series",
+		users:                map[string]*userTracker{},
+	}
+}
+
+// Enabled returns whether the usage of the tenant is attributed.
+func (t *Tracker) Enabled(userID string) bool {
+	return t != nil && len(t.limits.CostAttributionLabels(userID)) > 0
+}
+
+// Attribution returns the key of the attribution of the series for the tenant, or an empty string
+// if the tenant has no cost attribution labels.
+func (t *Tracker) Attribution(userID string, series labels.Labels, now time.Time) string {
+	if !t.Enabled(userID) {
+		return ""
+	}
+
+	u := t.user(userID)
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if a := t.attributionLocked(userID, u, series, now); a != nil {
+		return a.key
+	}
+	return ""
+}
+
+// IncrementReceivedSamples attributes the samples received for the series.
+func (t *Tracker) IncrementReceivedSamples(userID string, series labels.Labels, samples int, now time.Time) {
+	if samples == 0 || !t.Enabled(userID) {
+		return
+	}
+
+	u := t.user(userID)
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if a := t.attributionLocked(userID, u, series, now); a != nil {
+		a.receivedSamples += float64(samples)
+	}
+}
+
+// IncrementDiscardedSamples attributes the samples of the series discarded for the given reason.
+func (t *Tracker) IncrementDiscardedSamples(userID string, series labels.Labels, reason string, samples int, now time.Time) {
+	if samples == 0 || !t.Enabled(userID) {
+		return
+	}
+
+	u := t.user(userID)
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if a := t.attributionLocked(userID, u, series, now); a != nil {
+		if a.discardedSamples == nil {
+			a.discardedSamples = map[string]float64{}
+		}
+		a.discardedSamples[reason] += float64(samples)
+	}
+}
+
+// SetActiveSeries sets the number of active series of the tenant by attribution key, as returned by Attribution.
+// The attributions not included are set to 0.
+func (t *Tracker) SetActiveSeries(userID string, activeSeries map[string]int, now time.Time) {
+	t.mtx.RLock()
+	u := t.users[userID]
+	t.mtx.RUnlock()
+
+	if u == nil {
+		return
+	}
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	for key, a := range u.attributions {
+		count, ok := activeSeries[key]
+		a.activeSeries = count
+		if ok {
+			a.lastUpdate = now
+		}
+	}
+}
+
+// attributionLocked returns the attribution of the series, creating it if it doesn't exist, or nil if the tenant
+// has no valid cost attribution labels. It must be called with the mutex of the tenant held.
+func (t *Tracker) attributionLocked(userID string, u *userTracker, series labels.Labels, now time.Time) *attribution {
+	if len(u.labels) == 0 {
+		return nil
+	}
+
+	// The key is built in a buffer on the stack, and the lookup doesn't allocate it on the heap,
+	// so that attributing the usage of an existing attribution doesn't allocate.
+	var buf [256]byte
+	key := buf[:0]
+	for i, name := range u.labels {
+		if i > 0 {
+			key = append(key, keySeparator...)
+		}
+		key = append(key, series.Get(name)...)
+	}
+
+	a, ok := u.attributions[string(key)]
+	if !ok {
+		if len(u.attributions) >= t.limits.MaxCostAttributionCardinalityPerUser(userID) {
+			key = key[:0]
+			for i := range u.labels {
+				if i > 0 {
+					key = append(key, keySeparator...)
+				}
+				key = append(key, OverflowValue...)
+			}
+			a, ok = u.attributions[string(key)]
+		}
+		if !ok {
+			// The key is converted to a new string, so the label values don't reference the buffer of the request.
+			a = &attribution{key: string(key)}
+			a.values = strings.Split(a.key, keySeparator)
+			u.attributions[a.key] = a
+		}
+	}
+
+	a.lastUpdate = now
+	return a
+}
+
+// user returns the tracker of the tenant, resetting it if the cost attribution labels have changed.
+func (t *Tracker) user(userID string) *userTracker {
+	configuredLabels := t.limits.CostAttributionLabels(userID)
+
+	t.mtx.RLock()
+	u, ok := t.users[userID]
+	t.mtx.RUnlock()
+	if ok && stringsEqual(u.configuredLabels, configuredLabels) {
+		return u
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	u, ok = t.users[userID]
+	if !ok || !stringsEqual(u.configuredLabels, configuredLabels) {
+		u = &userTracker{
+			configuredLabels: append([]string(nil), configuredLabels...),
+			labels:           validLabels(configuredLabels),
+			attributions:     map[string]*attribution{},
+		}
+		t.users[userID] = u
+	}
+	return u
+}
+
+// Purge removes the attributions which haven't been updated since the given time, to make room for new ones.
+func (t *Tracker) Purge(before time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for userID, u := range t.users {
+		u.mtx.Lock()
+		for key, a := range u.attributions {
+			if a.lastUpdate.Before(before) {
+				delete(u.attributions, key)
+			}
+		}
+		empty := len(u.attributions) == 0
+		u.mtx.Unlock()
+
+		if empty {
+			delete(t.users, userID)
+		}
+	}
+}
+
+// RemoveUser removes all the attributions of the tenant.
+func (t *Tracker) RemoveUser(userID string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.users, userID)
+}
+
+// Describe implements prometheus.Collector. The Tracker is an unchecked collector, because the
+// labels of its metrics depend on the cost attribution labels of each tenant.
+func (t *Tracker) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (t *Tracker) Collect(out chan<- prometheus.Metric) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	for userID, u := range t.users {
+		u.mtx.Lock()
+		labelNames := append([]string{userLabel}, u.labels...)
+		receivedDesc := prometheus.NewDesc(t.receivedSamplesDesc, "The total number of samples received, by cost attribution.", labelNames, nil)
+		activeDesc := prometheus.NewDesc(t.activeSeriesDesc, "The number of active series, by cost attribution.", labelNames, nil)
+		discardedDesc := prometheus.NewDesc(t.discardedSamplesDesc, "The total number of samples discarded, by cost attribution.", append(labelNames, reasonLabel), nil)
+
+		for _, a := range u.attributions {
+			labelValues := append([]string{userID}, a.values...)
+			if a.receivedSamples > 0 {
+				out <- prometheus.MustNewConstMetric(receivedDesc, prometheus.CounterValue, a.receivedSamples, labelValues...)
+			}
+			if a.activeSeries > 0 {
+				out <- prometheus.MustNewConstMetric(activeDesc, prometheus.GaugeValue, float64(a.activeSeries), labelValues...)
+			}
+			for reason, discarded := range a.discardedSamples {
+				out <- prometheus.MustNewConstMetric(discardedDesc, prometheus.CounterValue, discarded, append(labelValues, reason)...)
+			}
+		}
+		u.mtx.Unlock()
+	}
+}
+
+// UserAttribution is the usage of a tenant attributed to a combination of cost attribution label values.
+type UserAttribution struct {
+	Labels           map[string]string  `json:"labels"`
+	ReceivedSamples  float64            `json:"received_samples,omitempty"`
+	DiscardedSamples map[string]float64 `json:"discarded_samples,omitempty"`
+	ActiveSeries     int                `json:"active_series,omitempty"`
+}
+
+// ServeHTTP returns the tracked usage in JSON format, grouped by tenant. The usage of a single
+// tenant can be requested with the "tenant" query parameter.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	result := map[string][]UserAttribution{}
+
+	t.mtx.RLock()
+	for userID, u := range t.users {
+		if tenant != "" && tenant != userID {
+			continue
+		}
+
+		u.mtx.Lock()
+		attributions := make([]UserAttribution, 0, len(u.attributions))
+		for _, a := range u.attributions {
+			ua := UserAttribution{
+				Labels:          make(map[string]string, len(u.labels)),
+				ReceivedSamples: a.receivedSamples,
+				ActiveSeries:    a.activeSeries,
+			}
+			for i, name := range u.labels {
+				ua.Labels[name] = a.values[i]
+			}
+			if len(a.discardedSamples) > 0 {
+				ua.DiscardedSamples = make(map[string]float64, len(a.discardedSamples))
+				for reason, discarded := range a.discardedSamples {
+					ua.DiscardedSamples[reason] = discarded
+				}
+			}
+			attributions = append(attributions, ua)
+		}
+		u.mtx.Unlock()
+
+		sort.Slice(attributions, func(i, j int) bool {
+			return labels.FromMap(attributions[i].Labels).String() < labels.FromMap(attributions[j].Labels).String()
+		})
+		result[userID] = attributions
+	}
+	t.mtx.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ValidateLabels returns an error if any of the cost attribution labels is not a valid label name,
+// or clashes with the labels added to the cost attribution metrics.
+func ValidateLabels(attributionLabels []string) error {
+	for _, name := range attributionLabels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid cost attribution label %q", name)
+		}
+		if name == userLabel || name == reasonLabel {
+			return fmt.Errorf("cost attribution label %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+// validLabels returns the cost attribution labels which are valid, without duplicates.
+func validLabels(attributionLabels []string) []string {
+	var valid []string
+	for _, name := range attributionLabels {
+		if ValidateLabels([]string{name}) != nil {
+			continue
+		}
+
+		duplicate := false
+		for _, v := range valid {
+			duplicate = duplicate || v == name
+		}
+		if !duplicate {
+			valid = append(valid, name)
+		}
+	}
+	return valid
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type limitsMock struct {
+	labels         map[string][]string
+	maxCardinality int
+}
+
+func (m limitsMock) CostAttributionLabels(userID string) []string {
+	return m.labels[userID]
+}
+
+func (m limitsMock) MaxCostAttributionCardinalityPerUser(string) int {
+	return m.maxCardinality
+}
+
+func TestTracker(t *testing.T) {
+	limits := limitsMock{
+		labels:         map[string][]string{"user-1": {"team", "service"}},
+		maxCardinality: 2,
+	}
+	tracker := NewTracker("distributor", limits)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(tracker)
+
+	now := time.Now()
+	assert.True(t, tracker.Enabled("user-1"))
+	assert.False(t, tracker.Enabled("user-2"))
+
+	tracker.IncrementReceivedSamples("user-1", labels.FromStrings("__name__", "up", "team", "a", "service", "foo"), 3, now)
+	tracker.IncrementReceivedSamples("user-1", labels.FromStrings("__name__", "up", "team", "b"), 2, now)
+	// The cardinality limit has been reached, so the usage of new combinations is attributed to the overflow.
+	tracker.IncrementReceivedSamples("user-1", labels.FromStrings("__name__", "up", "team", "c"), 1, now)
+	tracker.IncrementDiscardedSamples("user-1", labels.FromStrings("__name__", "up", "team", "c"), "rate_limited", 1, now)
+	tracker.IncrementDiscardedSamples("user-1", labels.FromStrings("__name__", "up", "team", "a", "service", "foo"), "rate_limited", 4, now)
+	// The usage of tenants without cost attribution labels isn't tracked.
+	tracker.IncrementReceivedSamples("user-2", labels.FromStrings("__name__", "up", "team", "a"), 1, now)
+
+	assert.Equal(t, "a\xfffoo", tracker.Attribution("user-1", labels.FromStrings("team", "a", "service", "foo"), now))
+	assert.Equal(t, OverflowValue+"\xff"+OverflowValue, tracker.Attribution("user-1", labels.FromStrings("team", "d"), now))
+	assert.Equal(t, "", tracker.Attribution("user-2", labels.FromStrings("team", "a"), now))
+
+	tracker.SetActiveSeries("user-1", map[string]int{"a\xfffoo": 10}, now)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_attributed_active_series The number of active series, by cost attribution.
+		# TYPE cortex_distributor_attributed_active_series gauge
+		cortex_distributor_attributed_active_series{service="foo",team="a",user="user-1"} 10
+		# HELP cortex_distributor_attributed_discarded_samples_total The total number of samples discarded, by cost attribution.
+		# TYPE cortex_distributor_attributed_discarded_samples_total counter
+		cortex_distributor_attributed_discarded_samples_total{reason="rate_limited",service="__overflow__",team="__overflow__",user="user-1"} 1
+		cortex_distributor_attributed_discarded_samples_total{reason="rate_limited",service="foo",team="a",user="user-1"} 4
+		# HELP cortex_distributor_attributed_received_samples_total The total number of samples received, by cost attribution.
+		# TYPE cortex_distributor_attributed_received_samples_total counter
+		cortex_distributor_attributed_received_samples_total{service="",team="b",user="user-1"} 2
+		cortex_distributor_attributed_received_samples_total{service="__overflow__",team="__overflow__",user="user-1"} 1
+		cortex_distributor_attributed_received_samples_total{service="foo",team="a",user="user-1"} 3
+	`)))
+
+	// The usage is also exposed in JSON format.
+	resp := httptest.NewRecorder()
+	tracker.ServeHTTP(resp, httptest.NewRequest("GET", "/distributor/cost_attribution?tenant=user-1", nil))
+	var result map[string][]UserAttribution
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, map[string][]UserAttribution{
+		"user-1": {
+			{Labels: map[string]string{"team": "b", "service": ""}, ReceivedSamples: 2},
+			{Labels: map[string]string{"team": OverflowValue, "service": OverflowValue}, ReceivedSamples: 1, DiscardedSamples: map[string]float64{"rate_limited": 1}},
+			{Labels: map[string]string{"team": "a", "service": "foo"}, ReceivedSamples: 3, DiscardedSamples: map[string]float64{"rate_limited": 4}, ActiveSeries: 10},
+		},
+	}, result)
+
+	// Attributions which haven't been updated are purged, making room for new ones.
+	tracker.IncrementReceivedSamples("user-1", labels.FromStrings("team", "a", "service", "foo"), 1, now.Add(time.Minute))
+	tracker.Purge(now.Add(time.Second))
+	assert.Equal(t, "e\xff", tracker.Attribution("user-1", labels.FromStrings("team", "e"), now.Add(time.Minute)))
+
+	tracker.RemoveUser("user-1")
+	assert.Equal(t, 0, testutil.CollectAndCount(tracker))
+}
+
+func TestTracker_LabelsChange(t *testing.T) {
+	limits := limitsMock{
+		labels:         map[string][]string{"user-1": {"team"}},
+		maxCardinality: 10,
+	}
+	tracker := NewTracker("ingester", limits)
+
+	now := time.Now()
+	tracker.IncrementReceivedSamples("user-1", labels.FromStrings("team", "a", "service", "foo"), 1, now)
+	assert.Equal(t, 1, testutil.CollectAndCount(tracker, "cortex_ingester_attributed_received_samples_total"))
+
+	// Changing the cost attribution labels resets the usage of the tenant.
+	limits.labels["user-1"] = []string{"service"}
+	assert.Equal(t, "foo", tracker.Attribution("user-1", labels.FromStrings("team", "a", "service", "foo"), now))
+	assert.Equal(t, 0, testutil.CollectAndCount(tracker, "cortex_ingester_attributed_received_samples_total"))
+}
+
+func TestTracker_ExistingAttributionDoesNotAllocate(t *testing.T) {
+	limits := limitsMock{
+		labels:         map[string][]string{"user-1": {"team", "service"}},
+		maxCardinality: 1,
+	}
+	tracker := NewTracker("distributor", limits)
+
+	now := time.Now()
+	series := labels.FromStrings("__name__", "up", "team", "a", "service", "foo")
+	overflow := labels.FromStrings("__name__", "up", "team", "b", "service", "foo")
+	tracker.IncrementReceivedSamples("user-1", series, 1, now)
+	tracker.IncrementReceivedSamples("user-1", overflow, 1, now)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		tracker.IncrementReceivedSamples("user-1", series, 1, now)
+		tracker.IncrementReceivedSamples("user-1", overflow, 1, now)
+		tracker.IncrementDiscardedSamples("user-1", series, "rate_limited", 1, now)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestTracker_Concurrency(t *testing.T) {
+	const (
+		numUsers      = 4
+		numGoroutines = 8
+		numPushes     = 1000
+	)
+
+	limits := limitsMock{labels: map[string][]string{}, maxCardinality: 10}
+	for u := 0; u < numUsers; u++ {
+		limits.labels[fmt.Sprintf("user-%d", u)] = []string{"team"}
+	}
+	tracker := NewTracker("distributor", limits)
+
+	now := time.Now()
+	wg := sync.WaitGroup{}
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < numPushes; i++ {
+				userID := fmt.Sprintf("user-%d", (g+i)%numUsers)
+				tracker.IncrementReceivedSamples(userID, labels.FromStrings("team", strconv.Itoa(i%3)), 1, now)
+				if i%100 == 0 {
+					testutil.CollectAndCount(tracker)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.Equal(t, numUsers*3, testutil.CollectAndCount(tracker, "cortex_distributor_attributed_received_samples_total"))
+
+	// No sample should have been lost.
+	resp := httptest.NewRecorder()
+	tracker.ServeHTTP(resp, httptest.NewRequest("GET", "/distributor/cost_attribution", nil))
+	var result map[string][]UserAttribution
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	total := 0.0
+	for _, attributions := range result {
+		for _, a := range attributions {
+			total += a.ReceivedSamples
+		}
+	}
+	assert.Equal(t, float64(numGoroutines*numPushes), total)
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels([]string{"team", "service"}))
+	assert.Error(t, ValidateLabels([]string{"team", "invalid-label"}))
+	assert.Error(t, ValidateLabels([]string{"user"}))
+	assert.Error(t, ValidateLabels([]string{"reason"}))
+}
@@ -23,6 +23,8 @@ const (
 	SeriesWithDuplicateLabelNames ID = "duplicate-label-names"
 	SeriesLabelsNotSorted         ID = "labels-not-sorted"
 	SampleTooFarInFuture          ID = "too-far-in-future"
+	InvalidNativeHistogram        ID = "invalid-native-histogram"
+	MaxNativeHistogramBuckets     ID = "max-native-histogram-buckets"
 	MaxSeriesPerMetric            ID = "max-series-per-metric"
 	MaxMetadataPerMetric          ID = "max-metadata-per-metric"
 	MaxSeriesPerUser              ID = "max-series-per-user"
@@ -48,10 +50,13 @@ const (
 	MetricMetadataHelpTooLong       ID = "help-too-long"
 	MetricMetadataUnitTooLong       ID = "unit-too-long"
 
-	MaxQueryLength       ID = "max-query-length"
-	RequestRateLimited   ID = "tenant-max-request-rate"
-	IngestionRateLimited ID = "tenant-max-ingestion-rate"
-	TooManyHAClusters    ID = "tenant-too-many-ha-clusters"
+	MaxQueryLength        ID = "max-query-length"
+	QueryBlocked          ID = "query-blocked"
+	MaxEstimatedQueryCost ID = "max-estimated-query-cost"
+	MaxQueryResponseSize  ID = "max-query-response-size"
+	RequestRateLimited    ID = "tenant-max-request-rate"
+	IngestionRateLimited  ID = "tenant-max-ingestion-rate"
+	TooManyHAClusters     ID = "tenant-too-many-ha-clusters"
 
 	SampleTimestampTooOld    ID = "sample-timestamp-too-old"
 	SampleOutOfOrder         ID = "sample-out-of-order"
@@ -35,6 +35,19 @@ func FormatTimeModel(t model.Time) string {
 	return TimeFromMillis(int64(t)).String()
 }
 
+// MaxQueryResolutionPoints is the max number of points per series of a range query, like in the Prometheus API.
+// This is sufficient for 60s resolution for a week or 1h resolution for a year.
+const MaxQueryResolutionPoints = 11000
+
+var (
+	// PrometheusMinTime and PrometheusMaxTime are the min and max timestamps accepted by the Prometheus API.
+	PrometheusMinTime = time.Unix(math.MinInt64/1000+62135596801, 0).UTC()
+	PrometheusMaxTime = time.Unix(math.MaxInt64/1000-62135596801, 999999999).UTC()
+
+	prometheusMinTimeFormatted = PrometheusMinTime.Format(time.RFC3339Nano)
+	prometheusMaxTimeFormatted = PrometheusMaxTime.Format(time.RFC3339Nano)
+)
+
 // ParseTime parses the string into an int64, milliseconds since epoch.
 func ParseTime(s string) (int64, error) {
 	if t, err := strconv.ParseFloat(s, 64); err == nil {
@@ -46,9 +59,32 @@ func ParseTime(s string) (int64, error) {
 	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
 		return TimeToMillis(t), nil
 	}
+
+	// The min and max timestamps can't be parsed as RFC3339 because their year has more than 4 digits.
+	switch s {
+	case prometheusMinTimeFormatted:
+		return TimeToMillis(PrometheusMinTime), nil
+	case prometheusMaxTimeFormatted:
+		return TimeToMillis(PrometheusMaxTime), nil
+	}
 	return 0, httpgrpc.Errorf(http.StatusBadRequest, "cannot parse %q to a valid timestamp", s)
 }
 
+// ParseDurationMs parses the string into an int64, milliseconds.
+func ParseDurationMs(s string) (int64, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		ts := d * float64(time.Second/time.Millisecond)
+		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
+			return 0, httpgrpc.Errorf(http.StatusBadRequest, "cannot parse %q to a valid duration. It overflows int64", s)
+		}
+		return int64(ts), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return int64(d) / int64(time.Millisecond/time.Nanosecond), nil
+	}
+	return 0, httpgrpc.Errorf(http.StatusBadRequest, "cannot parse %q to a valid duration", s)
+}
+
 // DurationWithJitter returns random duration from "input - input*variance" to "input + input*variance" interval.
 func DurationWithJitter(input time.Duration, variancePerc float64) time.Duration {
 	// No duration? No jitter.
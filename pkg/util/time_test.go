@@ -118,6 +118,12 @@ func TestParseTime(t *testing.T) {
 			// Test float rounding.
 			input:  "1543578564.705",
 			result: time.Unix(1543578564, 705*1e6),
+		}, {
+			input:  PrometheusMinTime.Format(time.RFC3339Nano),
+			result: PrometheusMinTime,
+		}, {
+			input:  PrometheusMaxTime.Format(time.RFC3339Nano),
+			result: PrometheusMaxTime,
 		},
 	}
 
@@ -133,6 +139,48 @@ func TestParseTime(t *testing.T) {
 	}
 }
 
+func TestParseDurationMs(t *testing.T) {
+	var tests = []struct {
+		input  string
+		fail   bool
+		result int64
+	}{
+		{
+			input: "",
+			fail:  true,
+		}, {
+			input: "abc",
+			fail:  true,
+		}, {
+			input: "1e100",
+			fail:  true,
+		}, {
+			input:  "30",
+			result: 30000,
+		}, {
+			input:  "1.5",
+			result: 1500,
+		}, {
+			input:  "5m",
+			result: 300000,
+		}, {
+			input:  "1h30m",
+			result: 5400000,
+		},
+	}
+
+	for _, test := range tests {
+		d, err := ParseDurationMs(test.input)
+		if test.fail {
+			require.Error(t, err)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, test.result, d)
+	}
+}
+
 func TestNewDisableableTicker_Enabled(t *testing.T) {
 	stop, ch := NewDisableableTicker(10 * time.Millisecond)
 	defer stop()
@@ -163,6 +163,46 @@ func newSampleTimestampTooNewError(metricName string, timestamp int64) Validatio
 	}
 }
 
+type invalidNativeHistogramError struct {
+	metricName string
+	timestamp  int64
+	cause      string
+}
+
+func newInvalidNativeHistogramError(metricName string, timestamp int64, cause string) ValidationError {
+	return invalidNativeHistogramError{
+		metricName: metricName,
+		timestamp:  timestamp,
+		cause:      cause,
+	}
+}
+
+func (e invalidNativeHistogramError) Error() string {
+	return globalerror.InvalidNativeHistogram.Message(fmt.Sprintf("received an invalid native histogram (%s), timestamp: %d series: '%.200s'", e.cause, e.timestamp, e.metricName))
+}
+
+type tooManyNativeHistogramBucketsError struct {
+	metricName string
+	timestamp  int64
+	buckets    int
+	limit      int
+}
+
+func newTooManyNativeHistogramBucketsError(metricName string, timestamp int64, buckets, limit int) ValidationError {
+	return tooManyNativeHistogramBucketsError{
+		metricName: metricName,
+		timestamp:  timestamp,
+		buckets:    buckets,
+		limit:      limit,
+	}
+}
+
+func (e tooManyNativeHistogramBucketsError) Error() string {
+	return globalerror.MaxNativeHistogramBuckets.MessageWithLimitConfig(
+		fmt.Sprintf("received a native histogram whose number of buckets exceeds the limit (actual: %d, limit: %d), timestamp: %d series: '%.200s'", e.buckets, e.limit, e.timestamp, e.metricName),
+		maxNativeHistogramBucketsFlag)
+}
+
 // exemplarValidationError is a ValidationError implementation suitable for exemplar validation errors.
 type exemplarValidationError struct {
 	message        string
@@ -275,6 +315,18 @@ func NewMaxQueryLengthError(actualQueryLen, maxQueryLength time.Duration) LimitE
 		maxQueryLengthFlag))
 }
 
+func NewMaxEstimatedQueryCostError(estimatedCost uint64, maxCost int) LimitError {
+	return LimitError(globalerror.MaxEstimatedQueryCost.MessageWithLimitConfig(
+		fmt.Sprintf("the estimated cost of the query exceeds the limit (estimated cost: %d, limit: %d)", estimatedCost, maxCost),
+		maxEstimatedQueryCostFlag))
+}
+
+func NewMaxQueryResponseSizeError(maxSize int) LimitError {
+	return LimitError(globalerror.MaxQueryResponseSize.MessageWithLimitConfig(
+		fmt.Sprintf("the total size of the query responses exceeds the limit (limit: %d bytes)", maxSize),
+		maxQueryResponseSizeFlag))
+}
+
 func NewRequestRateLimitedError(limit float64, burst int) LimitError {
 	return LimitError(globalerror.RequestRateLimited.MessageWithLimitConfig(
 		fmt.Sprintf("the request has been rejected because the tenant exceeded the request rate limit, set to %v requests/s across all distributors with a maximum allowed burst of %d", limit, burst),
@@ -9,37 +9,45 @@ import (
 	"bytes"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"math"
 	"strings"
 	"time"
 
 	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/regexp"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
 	"golang.org/x/time/rate"
 
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
+	"github.com/grafana/mimir/pkg/util/costattribution"
 )
 
 const (
-	MaxSeriesPerMetricFlag     = "ingester.max-global-series-per-metric"
-	MaxMetadataPerMetricFlag   = "ingester.max-global-metadata-per-metric"
-	MaxSeriesPerUserFlag       = "ingester.max-global-series-per-user"
-	MaxMetadataPerUserFlag     = "ingester.max-global-metadata-per-user"
-	MaxChunksPerQueryFlag      = "querier.max-fetched-chunks-per-query"
-	MaxChunkBytesPerQueryFlag  = "querier.max-fetched-chunk-bytes-per-query"
-	MaxSeriesPerQueryFlag      = "querier.max-fetched-series-per-query"
-	maxLabelNamesPerSeriesFlag = "validation.max-label-names-per-series"
-	maxLabelNameLengthFlag     = "validation.max-length-label-name"
-	maxLabelValueLengthFlag    = "validation.max-length-label-value"
-	maxMetadataLengthFlag      = "validation.max-metadata-length"
-	creationGracePeriodFlag    = "validation.create-grace-period"
-	maxQueryLengthFlag         = "store.max-query-length"
-	requestRateFlag            = "distributor.request-rate-limit"
-	requestBurstSizeFlag       = "distributor.request-burst-size"
-	ingestionRateFlag          = "distributor.ingestion-rate-limit"
-	ingestionBurstSizeFlag     = "distributor.ingestion-burst-size"
-	HATrackerMaxClustersFlag   = "distributor.ha-tracker.max-clusters"
+	MaxSeriesPerMetricFlag            = "ingester.max-global-series-per-metric"
+	MaxMetadataPerMetricFlag          = "ingester.max-global-metadata-per-metric"
+	MaxSeriesPerUserFlag              = "ingester.max-global-series-per-user"
+	MaxMetadataPerUserFlag            = "ingester.max-global-metadata-per-user"
+	MaxChunksPerQueryFlag             = "querier.max-fetched-chunks-per-query"
+	MaxChunkBytesPerQueryFlag         = "querier.max-fetched-chunk-bytes-per-query"
+	MaxSeriesPerQueryFlag             = "querier.max-fetched-series-per-query"
+	maxLabelNamesPerSeriesFlag        = "validation.max-label-names-per-series"
+	maxLabelNameLengthFlag            = "validation.max-length-label-name"
+	maxLabelValueLengthFlag           = "validation.max-length-label-value"
+	maxMetadataLengthFlag             = "validation.max-metadata-length"
+	creationGracePeriodFlag           = "validation.create-grace-period"
+	maxNativeHistogramBucketsFlag     = "distributor.max-native-histogram-buckets"
+	maxQueryLengthFlag                = "store.max-query-length"
+	requestRateFlag                   = "distributor.request-rate-limit"
+	requestBurstSizeFlag              = "distributor.request-burst-size"
+	ingestionRateFlag                 = "distributor.ingestion-rate-limit"
+	ingestionBurstSizeFlag            = "distributor.ingestion-burst-size"
+	HATrackerMaxClustersFlag          = "distributor.ha-tracker.max-clusters"
+	maxEstimatedQueryCostFlag         = "query-frontend.max-estimated-query-cost"
+	lowPriorityEstimatedQueryCostFlag = "query-frontend.low-priority-estimated-query-cost"
+	maxQueryResponseSizeFlag          = "query-frontend.max-query-response-size-bytes"
 )
 
 // LimitError are errors that do not comply with the limits specified.
@@ -60,6 +68,125 @@ type ForwardingRule struct {
 // ForwardingRules are keyed by metric names, excluding labels.
 type ForwardingRules map[string]ForwardingRule
 
+// GraphiteMappingRule maps the Graphite metrics whose path matches a glob pattern to a metric name and labels.
+type GraphiteMappingRule struct {
+	// Match is a glob pattern matched against the Graphite path, where "*" matches any sequence of characters within a node.
+	Match string `yaml:"match" json:"match" doc:"description=Glob pattern matched against the Graphite metric path, for example servers.*.cpu.*. Each * matches any sequence of characters within a single path node."`
+
+	// Name is the metric name, where $1, $2, ... are replaced with the sequences matched by the wildcards.
+	Name string `yaml:"name" json:"name" doc:"description=Metric name of the matching series. $1, $2, ... are replaced with the sequences matched by the wildcards."`
+
+	// Labels are added to the series, where $1, $2, ... are replaced with the sequences matched by the wildcards.
+	Labels map[string]string `yaml:"labels" json:"labels" doc:"description=Labels added to the matching series. $1, $2, ... in values are replaced with the sequences matched by the wildcards."`
+}
+
+// BlockedQuery is a query which the query-frontend rejects for the tenant.
+type BlockedQuery struct {
+	// Pattern is matched against the normalized PromQL query, either exactly or as a regular expression.
+	Pattern string `yaml:"pattern" json:"pattern" doc:"description=PromQL query to block. The query is normalized before being compared, so formatting differences don't matter."`
+
+	// Regex is whether the pattern is a regular expression.
+	Regex bool `yaml:"regex" json:"regex" doc:"description=If true, the pattern is a regular expression matched against the whole normalized query."`
+
+	// MinTimeRange scopes the block to the queries whose time range is at least this long.
+	MinTimeRange model.Duration `yaml:"min_time_range" json:"min_time_range" doc:"description=If set, only the queries whose time range (end - start) is at least this long are blocked."`
+}
+
+// validateBlockedQueries returns an error if the pattern of any blocked query regular expression is invalid.
+func validateBlockedQueries(queries []BlockedQuery) error {
+	for _, q := range queries {
+		if !q.Regex {
+			continue
+		}
+		if _, err := regexp.Compile(q.Pattern); err != nil {
+			return fmt.Errorf("invalid blocked query regular expression %q: %w", q.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// QueryPriorityRule assigns a priority in the tenant's queue to the queries whose HTTP header matches a regular expression.
+type QueryPriorityRule struct {
+	// Header is the name of the HTTP header to match. Defaults to User-Agent.
+	Header string `yaml:"header" json:"header" doc:"description=Name of the HTTP request header matched against the regular expression. Defaults to User-Agent if empty."`
+
+	// Regex is matched against the whole header value.
+	Regex string `yaml:"regex" json:"regex" doc:"description=Regular expression matched against the whole header value."`
+
+	// Priority is the priority of the matching queries.
+	Priority string `yaml:"priority" json:"priority" doc:"description=Priority of the matching queries in the tenant's queue. Supported values: high, normal, low."`
+
+	// re is the Regex anchored to the whole header value, compiled when the limits are loaded.
+	re *regexp.Regexp
+}
+
+// MatchString returns whether the whole header value matches the rule regular expression.
+func (r QueryPriorityRule) MatchString(value string) bool {
+	re := r.re
+	if re == nil {
+		// The rule hasn't been loaded from the limits, so we compile its regular expression now.
+		var err error
+		if re, err = compileQueryPriorityRuleRegex(r.Regex); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(value)
+}
+
+func compileQueryPriorityRuleRegex(regex string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + regex + ")$")
+}
+
+// compileQueryPriorityRules compiles the regular expression of each rule, and returns an error if the
+// regular expression or the priority of any rule is invalid.
+func compileQueryPriorityRules(rules []QueryPriorityRule) error {
+	for i, r := range rules {
+		re, err := compileQueryPriorityRuleRegex(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid query priority rule regular expression %q: %w", r.Regex, err)
+		}
+		if !isValidQueryPriority(r.Priority) {
+			return fmt.Errorf("invalid query priority %q, supported values: %s", r.Priority, strings.Join(queryPriorities, ", "))
+		}
+		rules[i].re = re
+	}
+	return nil
+}
+
+// SeriesRetentionRule is a retention period applying to the tenant's series matching a series selector.
+type SeriesRetentionRule struct {
+	// Matchers is a series selector, for example {job="debug"}.
+	Matchers string `yaml:"matchers" json:"matchers" doc:"description=Series selector of the series the retention period applies to, for example {job=\"debug\"}."`
+
+	// Retention is how long the samples of the matching series are kept.
+	Retention model.Duration `yaml:"retention" json:"retention" doc:"description=Retention period of the samples of the matching series."`
+}
+
+// validateSeriesRetentionRules returns an error if the series selector or the retention period of any rule is invalid.
+func validateSeriesRetentionRules(rules []SeriesRetentionRule) error {
+	for _, r := range rules {
+		if _, err := parser.ParseMetricSelector(r.Matchers); err != nil {
+			return fmt.Errorf("invalid series retention rule selector %q: %w", r.Matchers, err)
+		}
+		if r.Retention <= 0 {
+			return fmt.Errorf("invalid series retention rule retention period %q: must be greater than 0", r.Retention)
+		}
+	}
+	return nil
+}
+
+// queryPriorities are the supported priorities of the query priority rules, from the highest to the lowest.
+var queryPriorities = []string{"high", "normal", "low"}
+
+func isValidQueryPriority(priority string) bool {
+	for _, p := range queryPriorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
 // Limits describe all the limits for users; can be used to describe global default
 // limits via flags, or per-user limits via yaml config.
 type Limits struct {
@@ -80,8 +207,15 @@ type Limits struct {
 	CreationGracePeriod       model.Duration      `yaml:"creation_grace_period" json:"creation_grace_period" category:"advanced"`
 	EnforceMetadataMetricName bool                `yaml:"enforce_metadata_metric_name" json:"enforce_metadata_metric_name" category:"advanced"`
 	IngestionTenantShardSize  int                 `yaml:"ingestion_tenant_shard_size" json:"ingestion_tenant_shard_size"`
+	NativeHistogramsEnabled   bool                `yaml:"native_histograms_ingestion_enabled" json:"native_histograms_ingestion_enabled" category:"experimental"`
+	MaxNativeHistogramBuckets int                 `yaml:"max_native_histogram_buckets" json:"max_native_histogram_buckets" category:"experimental"`
 	MetricRelabelConfigs      []*relabel.Config   `yaml:"metric_relabel_configs,omitempty" json:"metric_relabel_configs,omitempty" doc:"nocli|description=List of metric relabel configurations. Note that in most situations, it is more effective to use metrics relabeling directly in the Prometheus server, e.g. remote_write.write_relabel_configs." category:"experimental"`
 
+	// Sample-level deduplication of HA replicas, enforced by distributors and ingesters.
+	HASampleDeduplicationEnabled bool `yaml:"ha_sample_deduplication_enabled" json:"ha_sample_deduplication_enabled" category:"experimental"`
+
+	GraphiteMappingRules []GraphiteMappingRule `yaml:"graphite_mapping_rules" json:"graphite_mapping_rules" doc:"nocli|description=List of rules mapping Graphite metric paths received on the Graphite push endpoint to metric names and labels. The first matching rule applies. Paths which don't match any rule are converted to metric names replacing dots with underscores." category:"experimental"`
+
 	// Ingester enforced limits.
 	// Series
 	MaxGlobalSeriesPerUser   int `yaml:"max_global_series_per_user" json:"max_global_series_per_user"`
@@ -95,6 +229,15 @@ type Limits struct {
 	// TODO remove this with Mimir version 2.4
 	ActiveSeriesCustomTrackersConfigOld activeseries.CustomTrackersConfig `yaml:"active_series_custom_trackers_config" json:"active_series_custom_trackers_config" doc:"hidden"`
 	ActiveSeriesCustomTrackersConfig    activeseries.CustomTrackersConfig `yaml:"active_series_custom_trackers" json:"active_series_custom_trackers" doc:"description=Additional custom trackers for active metrics. If there are active series matching a provided matcher (map value), the count will be exposed in the custom trackers metric labeled using the tracker name (map key). Zero valued counts are not exposed (and removed when they go back to zero)." category:"advanced"`
+	// Out-of-order
+	OutOfOrderTimeWindow model.Duration `yaml:"out_of_order_time_window" json:"out_of_order_time_window" category:"experimental"`
+	// Early head compaction
+	EarlyHeadCompactionMinInMemorySeries     int `yaml:"early_head_compaction_min_in_memory_series" json:"early_head_compaction_min_in_memory_series" category:"experimental"`
+	EarlyHeadCompactionMinEstimatedHeadBytes int `yaml:"early_head_compaction_min_estimated_head_bytes" json:"early_head_compaction_min_estimated_head_bytes" category:"experimental"`
+
+	// Cost attribution, tracked by distributors and ingesters.
+	CostAttributionLabels                flagext.StringSliceCSV `yaml:"cost_attribution_labels" json:"cost_attribution_labels" category:"experimental"`
+	MaxCostAttributionCardinalityPerUser int                    `yaml:"max_cost_attribution_cardinality_per_user" json:"max_cost_attribution_cardinality_per_user" category:"experimental"`
 
 	// Querier enforced limits.
 	MaxChunksPerQuery              int            `yaml:"max_fetched_chunks_per_query" json:"max_fetched_chunks_per_query"`
@@ -108,6 +251,24 @@ type Limits struct {
 	MaxQueriersPerTenant           int            `yaml:"max_queriers_per_tenant" json:"max_queriers_per_tenant"`
 	QueryShardingTotalShards       int            `yaml:"query_sharding_total_shards" json:"query_sharding_total_shards"`
 	QueryShardingMaxShardedQueries int            `yaml:"query_sharding_max_sharded_queries" json:"query_sharding_max_sharded_queries"`
+	BlockedQueries                 []BlockedQuery `yaml:"blocked_queries,omitempty" json:"blocked_queries,omitempty" doc:"nocli|description=List of queries to block. The matching queries are rejected by the query-frontend." category:"experimental"`
+
+	// Query-frontend query cost estimation.
+	MaxEstimatedQueryCost         int `yaml:"max_estimated_query_cost" json:"max_estimated_query_cost" category:"experimental"`
+	LowPriorityEstimatedQueryCost int `yaml:"low_priority_estimated_query_cost" json:"low_priority_estimated_query_cost" category:"experimental"`
+
+	// Query-frontend instant queries splitting.
+	SplitInstantQueriesByInterval model.Duration `yaml:"split_instant_queries_by_interval" json:"split_instant_queries_by_interval" category:"experimental"`
+
+	// Query-frontend responses size limit.
+	MaxQueryResponseSizeBytes int `yaml:"max_query_response_size_bytes" json:"max_query_response_size_bytes" category:"experimental"`
+
+	// Query-frontend and query-scheduler queue priorities.
+	QueryPriorityRules []QueryPriorityRule `yaml:"query_priority_rules,omitempty" json:"query_priority_rules,omitempty" doc:"nocli|description=List of rules assigning a priority to the tenant's queries in the query-frontend or query-scheduler queue, based on the HTTP request headers. The first matching rule applies, and queries not matching any rule have normal priority. The X-Query-Priority header can only lower the priority of a query." category:"experimental"`
+
+	// Query-frontend metadata queries results cache.
+	ResultsCacheMaxMetadataEntrySize int `yaml:"results_cache_max_metadata_entry_size_bytes" json:"results_cache_max_metadata_entry_size_bytes" category:"experimental"`
+
 	// Cardinality
 	CardinalityAnalysisEnabled                    bool `yaml:"cardinality_analysis_enabled" json:"cardinality_analysis_enabled"`
 	LabelNamesAndValuesResultsMaxSizeBytes        int  `yaml:"label_names_and_values_results_max_size_bytes" json:"label_names_and_values_results_max_size_bytes"`
@@ -123,11 +284,15 @@ type Limits struct {
 	StoreGatewayTenantShardSize int `yaml:"store_gateway_tenant_shard_size" json:"store_gateway_tenant_shard_size"`
 
 	// Compactor.
-	CompactorBlocksRetentionPeriod model.Duration `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
-	CompactorSplitAndMergeShards   int            `yaml:"compactor_split_and_merge_shards" json:"compactor_split_and_merge_shards"`
-	CompactorSplitGroups           int            `yaml:"compactor_split_groups" json:"compactor_split_groups"`
-	CompactorTenantShardSize       int            `yaml:"compactor_tenant_shard_size" json:"compactor_tenant_shard_size"`
-	CompactorBlockUploadEnabled    bool           `yaml:"compactor_block_upload_enabled" json:"compactor_block_upload_enabled"`
+	CompactorBlocksRetentionPeriod        model.Duration `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
+	CompactorSplitAndMergeShards          int            `yaml:"compactor_split_and_merge_shards" json:"compactor_split_and_merge_shards"`
+	CompactorSplitGroups                  int            `yaml:"compactor_split_groups" json:"compactor_split_groups"`
+	CompactorTenantShardSize              int            `yaml:"compactor_tenant_shard_size" json:"compactor_tenant_shard_size"`
+	CompactorBlockUploadEnabled           bool           `yaml:"compactor_block_upload_enabled" json:"compactor_block_upload_enabled"`
+	CompactorBlockUploadValidationEnabled bool           `yaml:"compactor_block_upload_validation_enabled" json:"compactor_block_upload_validation_enabled"`
+	CompactorDownsamplingEnabled          bool           `yaml:"compactor_downsampling_enabled" json:"compactor_downsampling_enabled" category:"experimental"`
+
+	SeriesRetentionRules []SeriesRetentionRule `yaml:"series_retention_rules,omitempty" json:"series_retention_rules,omitempty" doc:"nocli|description=List of retention periods applying to the tenant's series matching a series selector. The samples of the matching series older than the retention period are hidden from the query results by the queriers, and removed from the blocks by the compactor. If a series matches more than one rule, the shortest retention period applies. The series which don't match any rule are only subject to the blocks retention period." category:"experimental"`
 
 	// This config doesn't have a CLI flag registered here because they're registered in
 	// their own original config struct.
@@ -163,6 +328,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&l.HAClusterLabel, "distributor.ha-tracker.cluster", "cluster", "Prometheus label to look for in samples to identify a Prometheus HA cluster.")
 	f.StringVar(&l.HAReplicaLabel, "distributor.ha-tracker.replica", "__replica__", "Prometheus label to look for in samples to identify a Prometheus HA replica.")
 	f.IntVar(&l.HAMaxClusters, HATrackerMaxClustersFlag, 0, "Maximum number of clusters that HA tracker will keep track of for a single tenant. 0 to disable the limit.")
+	f.BoolVar(&l.HASampleDeduplicationEnabled, "distributor.ha-sample-deduplication-enabled", false, "Enable the deduplication of the samples received from the replicas of HA Prometheus clusters at sample level, as an alternative to the HA tracker: the samples of all the replicas are accepted, the replica label is removed from the series, and ingesters discard the samples with the same timestamp as a sample already ingested for the series. Samples with other timestamps are ingested whichever replica they come from, so the replicas should produce samples with the same timestamps. When enabled, the HA tracker is not used for the tenant.")
 	f.Var(&l.DropLabels, "distributor.drop-label", "This flag can be used to specify label names that to drop during sample ingestion within the distributor and can be repeated in order to drop multiple labels.")
 	f.IntVar(&l.MaxLabelNameLength, maxLabelNameLengthFlag, 1024, "Maximum length accepted for label names")
 	f.IntVar(&l.MaxLabelValueLength, maxLabelValueLengthFlag, 2048, "Maximum length accepted for label value. This setting also applies to the metric name")
@@ -171,6 +337,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	_ = l.CreationGracePeriod.Set("10m")
 	f.Var(&l.CreationGracePeriod, creationGracePeriodFlag, "Controls how far into the future incoming samples are accepted compared to the wall clock. Any sample with timestamp `t` will be rejected if `t > (now + validation.create-grace-period)`.")
 	f.BoolVar(&l.EnforceMetadataMetricName, "validation.enforce-metadata-metric-name", true, "Enforce every metadata has a metric name.")
+	f.BoolVar(&l.NativeHistogramsEnabled, "distributor.native-histograms-ingestion-enabled", false, "Enable ingestion of native histograms, which are converted to classic histogram series (_bucket, _count and _sum) by the distributor. The conversion is lossy, and storing and querying native histograms is not supported. When disabled, native histograms are discarded.")
+	f.IntVar(&l.MaxNativeHistogramBuckets, maxNativeHistogramBucketsFlag, 160, "Maximum number of buckets of a native histogram. Each bucket is converted to a classic histogram bucket series, so this limits the number of series a native histogram is converted to. Native histograms with more buckets are discarded. 0 to disable the limit.")
 
 	f.IntVar(&l.MaxGlobalSeriesPerUser, MaxSeriesPerUserFlag, 150000, "The maximum number of active series per tenant, across the cluster before replication. 0 to disable.")
 	f.IntVar(&l.MaxGlobalSeriesPerMetric, MaxSeriesPerMetricFlag, 20000, "The maximum number of active series per metric name, across the cluster before replication. 0 to disable.")
@@ -178,6 +346,11 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxGlobalMetricsWithMetadataPerUser, MaxMetadataPerUserFlag, 0, "The maximum number of active metrics with metadata per tenant, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalMetadataPerMetric, MaxMetadataPerMetricFlag, 0, "The maximum number of metadata per metric, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalExemplarsPerUser, "ingester.max-global-exemplars-per-user", 0, "The maximum number of exemplars in memory, across the cluster. 0 to disable exemplars ingestion.")
+	f.Var(&l.OutOfOrderTimeWindow, "ingester.out-of-order-time-window", "Non-zero value enables out-of-order samples ingestion: samples older than the most recent sample ingested for the tenant are accepted, as long as they're within this time window. Out-of-order samples are flushed to blocks which overlap with the other blocks of the tenant. 0 to disable.")
+	f.IntVar(&l.EarlyHeadCompactionMinInMemorySeries, "ingester.early-head-compaction-min-in-memory-series", 0, "When the number of in-memory series of the tenant in an ingester exceeds this setting, the tenant's TSDB head is compacted early, without waiting for the head to cover the smallest block range, to release the memory used by inactive series. 0 to disable.")
+	f.IntVar(&l.EarlyHeadCompactionMinEstimatedHeadBytes, "ingester.early-head-compaction-min-estimated-head-bytes", 0, "When the estimated memory used by the tenant's TSDB head in an ingester exceeds this setting, the tenant's TSDB head is compacted early, without waiting for the head to cover the smallest block range. 0 to disable.")
+	f.Var(&l.CostAttributionLabels, "validation.cost-attribution-labels", "Comma-separated list of labels, like team,service, by which the received samples, the discarded samples and the active series of the tenant are broken down, for cost attribution. The breakdown is exposed as metrics by distributors and ingesters. Empty to disable cost attribution.")
+	f.IntVar(&l.MaxCostAttributionCardinalityPerUser, "validation.max-cost-attribution-cardinality-per-user", 100, "Maximum number of distinct combinations of values of the cost attribution labels tracked for the tenant. Once the limit is reached, the usage of new combinations is attributed to the combination where all labels have the __overflow__ value.")
 	f.Var(&l.ActiveSeriesCustomTrackersConfig, "ingester.active-series-custom-trackers", "Additional active series metrics, matching the provided matchers. Matchers should be in form <name>:<matcher>, like 'foobar:{foo=\"bar\"}'. Multiple matchers can be provided either providing the flag multiple times or providing multiple semicolon-separated values to a single flag.")
 
 	f.IntVar(&l.MaxChunksPerQuery, MaxChunksPerQueryFlag, 2e6, "Maximum number of chunks that can be fetched in a single query from ingesters and long-term storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
@@ -195,6 +368,11 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxQueriersPerTenant, "query-frontend.max-queriers-per-tenant", 0, "Maximum number of queriers that can handle requests for a single tenant. If set to 0 or value higher than number of available queriers, *all* queriers will handle requests for the tenant. Each frontend (or query-scheduler, if used) will select the same set of queriers for the same tenant (given that all queriers are connected to all frontends / query-schedulers). This option only works with queriers connecting to the query-frontend / query-scheduler, not when using downstream URL.")
 	f.IntVar(&l.QueryShardingTotalShards, "query-frontend.query-sharding-total-shards", 16, "The amount of shards to use when doing parallelisation via query sharding by tenant. 0 to disable query sharding for tenant. Query sharding implementation will adjust the number of query shards based on compactor shards. This allows querier to not search the blocks which cannot possibly have the series for given query shard.")
 	f.IntVar(&l.QueryShardingMaxShardedQueries, "query-frontend.query-sharding-max-sharded-queries", 128, "The max number of sharded queries that can be run for a given received query. 0 to disable limit.")
+	f.IntVar(&l.MaxEstimatedQueryCost, maxEstimatedQueryCostFlag, 0, "Maximum estimated cost of a query, computed by the query-frontend before its execution as the number of in-memory series matching the query selectors multiplied by the number of steps, and by the number of samples selected by each range vector selector at each step. The whole query is estimated once, before it is split and looked up in the results cache. Queries exceeding the limit are rejected. Requires -querier.cardinality-analysis-enabled. 0 to disable the limit.")
+	f.IntVar(&l.LowPriorityEstimatedQueryCost, lowPriorityEstimatedQueryCostFlag, 0, "Estimated cost of a query, computed as for -"+maxEstimatedQueryCostFlag+", above which the query is executed with low priority in the tenant's queue. Requires -querier.cardinality-analysis-enabled. 0 to disable it.")
+	f.IntVar(&l.MaxQueryResponseSizeBytes, maxQueryResponseSizeFlag, 0, "Maximum total size in bytes of the responses received by the query-frontend from the queriers to execute a single query, including the responses of the split and sharded queries. The query is aborted as soon as the limit is exceeded. 0 to disable the limit.")
+	f.Var(&l.SplitInstantQueriesByInterval, "query-frontend.split-instant-queries-by-interval", "Split the range vector functions of instant queries whose range is longer than this interval into sub-queries covering at most this interval, and execute them in parallel. Only sum_over_time, count_over_time, max_over_time, min_over_time, rate and increase are split. The results of rate and increase are approximated. 0 to disable it.")
+	f.IntVar(&l.ResultsCacheMaxMetadataEntrySize, "query-frontend.results-cache-max-metadata-entry-size-bytes", 1024*1024, "Maximum size in bytes of the label names, label values and series results cached for each split interval. Bigger results are not cached. 0 to disable the limit.")
 
 	f.Var(&l.RulerEvaluationDelay, "ruler.evaluation-delay-duration", "Duration to delay the evaluation of rules to ensure the underlying metrics have been pushed.")
 	f.IntVar(&l.RulerTenantShardSize, "ruler.tenant-shard-size", 0, "The tenant's shard size when sharding is used by ruler. Value of 0 disables shuffle sharding for the tenant, and tenant rules will be sharded across all ruler replicas.")
@@ -206,6 +384,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.CompactorSplitGroups, "compactor.split-groups", 1, "Number of groups that blocks for splitting should be grouped into. Each group of blocks is then split separately. Number of output split shards is controlled by -compactor.split-and-merge-shards.")
 	f.IntVar(&l.CompactorTenantShardSize, "compactor.compactor-tenant-shard-size", 0, "Max number of compactors that can compact blocks for single tenant. 0 to disable the limit and use all compactors.")
 	f.BoolVar(&l.CompactorBlockUploadEnabled, "compactor.block-upload-enabled", false, "Enable block upload API for the tenant.")
+	f.BoolVar(&l.CompactorBlockUploadValidationEnabled, "compactor.block-upload-validation-enabled", true, "Enable the validation of the blocks uploaded via the block upload API for the tenant. When enabled, the uploaded blocks are made available only once their index, chunks and series labels have been successfully validated.")
+	f.BoolVar(&l.CompactorDownsamplingEnabled, "compactor.downsampling-enabled", false, "Enable the downsampling of the tenant's fully compacted blocks to 5m and 1h resolutions. Downsampled blocks are used by the queriers to run queries with a large step.")
 
 	// Store-gateway.
 	f.IntVar(&l.StoreGatewayTenantShardSize, "store-gateway.tenant-shard-size", 0, "The tenant's shard size, used when store-gateway sharding is enabled. Value of 0 disables shuffle sharding for the tenant, that is all tenant blocks are sharded across all store-gateway replicas.")
@@ -247,6 +427,29 @@ func (l *Limits) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
+	if err := costattribution.ValidateLabels(l.CostAttributionLabels); err != nil {
+		return err
+	}
+
+	if err := validateBlockedQueries(l.BlockedQueries); err != nil {
+		return err
+	}
+
+	if err := compileQueryPriorityRules(l.QueryPriorityRules); err != nil {
+		return err
+	}
+
+	// The limits loaded at startup are validated once the flags have been parsed too.
+	if defaultLimits != nil {
+		if err := l.validateQueryCostLimits(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateSeriesRetentionRules(l.SeriesRetentionRules); err != nil {
+		return err
+	}
+
 	if !l.ActiveSeriesCustomTrackersConfigOld.Empty() {
 		l.ActiveSeriesCustomTrackersConfig = l.ActiveSeriesCustomTrackersConfigOld
 		l.ActiveSeriesCustomTrackersConfigOld = activeseries.CustomTrackersConfig{}
@@ -274,6 +477,16 @@ func (l *Limits) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	if err := compileQueryPriorityRules(l.QueryPriorityRules); err != nil {
+		return err
+	}
+
+	if defaultLimits != nil {
+		if err := l.validateQueryCostLimits(); err != nil {
+			return err
+		}
+	}
+
 	if !l.ActiveSeriesCustomTrackersConfigOld.Empty() {
 		l.ActiveSeriesCustomTrackersConfig = l.ActiveSeriesCustomTrackersConfigOld
 		l.ActiveSeriesCustomTrackersConfigOld = activeseries.CustomTrackersConfig{}
@@ -281,6 +494,20 @@ func (l *Limits) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Validate returns an error if the limits are invalid.
+func (l *Limits) Validate() error {
+	return l.validateQueryCostLimits()
+}
+
+// validateQueryCostLimits returns an error if the query cost is limited but can't be estimated,
+// because the cost estimation requires the cardinality analysis.
+func (l *Limits) validateQueryCostLimits() error {
+	if (l.MaxEstimatedQueryCost > 0 || l.LowPriorityEstimatedQueryCost > 0) && !l.CardinalityAnalysisEnabled {
+		return fmt.Errorf("-%s and -%s require -querier.cardinality-analysis-enabled to estimate the cost of the queries", maxEstimatedQueryCostFlag, lowPriorityEstimatedQueryCostFlag)
+	}
+	return nil
+}
+
 func (l *Limits) copyNotificationIntegrationLimits(defaults NotificationRateLimitMap) {
 	l.NotificationRateLimitPerIntegration = make(map[string]float64, len(defaults))
 	for k, v := range defaults {
@@ -359,6 +586,21 @@ func (o *Overrides) IngestionBurstSize(userID string) int {
 	return o.getOverridesForUser(userID).IngestionBurstSize
 }
 
+// NativeHistogramsEnabled returns whether to ingest native histograms for the tenant.
+func (o *Overrides) NativeHistogramsEnabled(userID string) bool {
+	return o.getOverridesForUser(userID).NativeHistogramsEnabled
+}
+
+// MaxNativeHistogramBuckets returns the maximum number of buckets of a native histogram for the tenant.
+func (o *Overrides) MaxNativeHistogramBuckets(userID string) int {
+	return o.getOverridesForUser(userID).MaxNativeHistogramBuckets
+}
+
+// GraphiteMappingRules returns the rules mapping Graphite metric paths to metric names and labels for the tenant.
+func (o *Overrides) GraphiteMappingRules(userID string) []GraphiteMappingRule {
+	return o.getOverridesForUser(userID).GraphiteMappingRules
+}
+
 // AcceptHASamples returns whether the distributor should track and accept samples from HA replicas for this user.
 func (o *Overrides) AcceptHASamples(userID string) bool {
 	return o.getOverridesForUser(userID).AcceptHASamples
@@ -374,6 +616,11 @@ func (o *Overrides) HAReplicaLabel(userID string) string {
 	return o.getOverridesForUser(userID).HAReplicaLabel
 }
 
+// HASampleDeduplicationEnabled returns whether the samples received from HA replicas are deduplicated at sample level.
+func (o *Overrides) HASampleDeduplicationEnabled(userID string) bool {
+	return o.getOverridesForUser(userID).HASampleDeduplicationEnabled
+}
+
 // DropLabels returns the list of labels to be dropped when ingesting HA samples for the user.
 func (o *Overrides) DropLabels(userID string) flagext.StringSlice {
 	return o.getOverridesForUser(userID).DropLabels
@@ -459,6 +706,11 @@ func (o *Overrides) MaxQueriersPerUser(userID string) int {
 	return o.getOverridesForUser(userID).MaxQueriersPerTenant
 }
 
+// QueryPriorityRules returns the rules assigning a priority to the tenant's queries in the queue.
+func (o *Overrides) QueryPriorityRules(userID string) []QueryPriorityRule {
+	return o.getOverridesForUser(userID).QueryPriorityRules
+}
+
 // MaxQueryParallelism returns the limit to the number of split queries the
 // frontend will process in parallel.
 func (o *Overrides) MaxQueryParallelism(userID string) int {
@@ -477,6 +729,41 @@ func (o *Overrides) QueryShardingMaxShardedQueries(userID string) int {
 	return o.getOverridesForUser(userID).QueryShardingMaxShardedQueries
 }
 
+// MaxEstimatedQueryCost returns the max estimated cost of a query, as the number of series
+// matching the query selectors multiplied by the number of steps. 0 to disable the limit.
+func (o *Overrides) MaxEstimatedQueryCost(userID string) int {
+	return o.getOverridesForUser(userID).MaxEstimatedQueryCost
+}
+
+// LowPriorityEstimatedQueryCost returns the estimated cost of a query above which the query is
+// executed with low priority. 0 to disable it.
+func (o *Overrides) LowPriorityEstimatedQueryCost(userID string) int {
+	return o.getOverridesForUser(userID).LowPriorityEstimatedQueryCost
+}
+
+// SplitInstantQueriesByInterval returns the interval used to split the range vector functions
+// of instant queries. 0 to disable it.
+func (o *Overrides) SplitInstantQueriesByInterval(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).SplitInstantQueriesByInterval)
+}
+
+// MaxQueryResponseSizeBytes returns the max total size in bytes of the responses received by
+// the query-frontend to execute a single query. 0 to disable the limit.
+func (o *Overrides) MaxQueryResponseSizeBytes(userID string) int {
+	return o.getOverridesForUser(userID).MaxQueryResponseSizeBytes
+}
+
+// ResultsCacheMaxMetadataEntrySize returns the max size in bytes of the label names, label values
+// and series results cached for each split interval. 0 to disable the limit.
+func (o *Overrides) ResultsCacheMaxMetadataEntrySize(userID string) int {
+	return o.getOverridesForUser(userID).ResultsCacheMaxMetadataEntrySize
+}
+
+// BlockedQueries returns the queries blocked for the tenant.
+func (o *Overrides) BlockedQueries(userID string) []BlockedQuery {
+	return o.getOverridesForUser(userID).BlockedQueries
+}
+
 // EnforceMetadataMetricName whether to enforce the presence of a metric name on metadata.
 func (o *Overrides) EnforceMetadataMetricName(userID string) bool {
 	return o.getOverridesForUser(userID).EnforceMetadataMetricName
@@ -501,6 +788,33 @@ func (o *Overrides) ActiveSeriesCustomTrackersConfig(userID string) activeseries
 	return o.getOverridesForUser(userID).ActiveSeriesCustomTrackersConfig
 }
 
+// OutOfOrderTimeWindow returns the out-of-order time window for the user.
+func (o *Overrides) OutOfOrderTimeWindow(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).OutOfOrderTimeWindow)
+}
+
+// EarlyHeadCompactionMinInMemorySeries returns the number of in-memory series of the user in an ingester
+// above which the user's TSDB head is compacted early.
+func (o *Overrides) EarlyHeadCompactionMinInMemorySeries(userID string) int {
+	return o.getOverridesForUser(userID).EarlyHeadCompactionMinInMemorySeries
+}
+
+// EarlyHeadCompactionMinEstimatedHeadBytes returns the estimated size of the user's TSDB head in an ingester
+// above which the head is compacted early.
+func (o *Overrides) EarlyHeadCompactionMinEstimatedHeadBytes(userID string) int {
+	return o.getOverridesForUser(userID).EarlyHeadCompactionMinEstimatedHeadBytes
+}
+
+// CostAttributionLabels returns the labels by which the usage of the user is broken down.
+func (o *Overrides) CostAttributionLabels(userID string) []string {
+	return o.getOverridesForUser(userID).CostAttributionLabels
+}
+
+// MaxCostAttributionCardinalityPerUser returns the maximum number of cost attributions tracked for the user.
+func (o *Overrides) MaxCostAttributionCardinalityPerUser(userID string) int {
+	return o.getOverridesForUser(userID).MaxCostAttributionCardinalityPerUser
+}
+
 // IngestionTenantShardSize returns the ingesters shard size for a given user.
 func (o *Overrides) IngestionTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).IngestionTenantShardSize
@@ -536,6 +850,21 @@ func (o *Overrides) CompactorBlockUploadEnabled(tenantID string) bool {
 	return o.getOverridesForUser(tenantID).CompactorBlockUploadEnabled
 }
 
+// CompactorBlockUploadValidationEnabled returns whether the validation of the uploaded blocks is enabled for a certain tenant.
+func (o *Overrides) CompactorBlockUploadValidationEnabled(tenantID string) bool {
+	return o.getOverridesForUser(tenantID).CompactorBlockUploadValidationEnabled
+}
+
+// CompactorDownsamplingEnabled returns whether the downsampling of the blocks is enabled for a certain tenant.
+func (o *Overrides) CompactorDownsamplingEnabled(tenantID string) bool {
+	return o.getOverridesForUser(tenantID).CompactorDownsamplingEnabled
+}
+
+// SeriesRetentionRules returns the retention periods applying to the tenant's series matching a series selector.
+func (o *Overrides) SeriesRetentionRules(tenantID string) []SeriesRetentionRule {
+	return o.getOverridesForUser(tenantID).SeriesRetentionRules
+}
+
 // MetricRelabelConfigs returns the metric relabel configs for a given user.
 func (o *Overrides) MetricRelabelConfigs(userID string) []*relabel.Config {
 	return o.getOverridesForUser(userID).MetricRelabelConfigs
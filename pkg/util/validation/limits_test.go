@@ -189,6 +189,90 @@ metric_relabel_configs:
 	assert.Equal(t, []*relabel.Config{&exp}, l.MetricRelabelConfigs)
 }
 
+func TestBlockedQueriesLimitsLoadingFromYaml(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	inp := `
+blocked_queries:
+- pattern: '{__name__=~".+"}'
+- pattern: 'count\(.*\)'
+  regex: true
+  min_time_range: 1d
+`
+
+	l := Limits{}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(inp), &l))
+	assert.Equal(t, []BlockedQuery{
+		{Pattern: `{__name__=~".+"}`},
+		{Pattern: `count\(.*\)`, Regex: true, MinTimeRange: model.Duration(24 * time.Hour)},
+	}, l.BlockedQueries)
+
+	// Invalid regular expressions are rejected.
+	inp = `
+blocked_queries:
+- pattern: 'count('
+  regex: true
+`
+	require.Error(t, yaml.UnmarshalStrict([]byte(inp), &Limits{}))
+}
+
+func TestQueryPriorityRulesLimitsLoadingFromYaml(t *testing.T) {
+	inp := `
+query_priority_rules:
+- regex: 'mimir/.*'
+  priority: high
+- header: X-Dashboard-Uid
+  regex: '.+'
+  priority: low
+`
+
+	l := Limits{}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(inp), &l))
+
+	// The regular expressions are compiled once when loading the limits, and match the whole header value.
+	for i := range l.QueryPriorityRules {
+		require.NotNil(t, l.QueryPriorityRules[i].re)
+		l.QueryPriorityRules[i].re = nil
+	}
+	assert.Equal(t, []QueryPriorityRule{
+		{Regex: "mimir/.*", Priority: "high"},
+		{Header: "X-Dashboard-Uid", Regex: ".+", Priority: "low"},
+	}, l.QueryPriorityRules)
+
+	// Invalid regular expressions and priorities are rejected.
+	for _, inp := range []string{
+		"query_priority_rules: [{regex: '(', priority: high}]",
+		"query_priority_rules: [{regex: '.*', priority: urgent}]",
+	} {
+		require.Error(t, yaml.UnmarshalStrict([]byte(inp), &Limits{}), inp)
+	}
+}
+
+func TestSeriesRetentionRulesLimitsLoadingFromYaml(t *testing.T) {
+	inp := `
+series_retention_rules:
+- matchers: '{job="debug"}'
+  retention: 14d
+- matchers: '{__name__=~"slo:.+"}'
+  retention: 2y
+`
+
+	l := Limits{}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(inp), &l))
+	assert.Equal(t, []SeriesRetentionRule{
+		{Matchers: `{job="debug"}`, Retention: model.Duration(14 * 24 * time.Hour)},
+		{Matchers: `{__name__=~"slo:.+"}`, Retention: model.Duration(2 * 365 * 24 * time.Hour)},
+	}, l.SeriesRetentionRules)
+
+	// Invalid series selectors and retention periods are rejected.
+	for _, inp := range []string{
+		"series_retention_rules: [{matchers: '{job=', retention: 1d}]",
+		"series_retention_rules: [{matchers: '{job=\"debug\"}', retention: 0s}]",
+	} {
+		require.Error(t, yaml.UnmarshalStrict([]byte(inp), &Limits{}), inp)
+	}
+}
+
 func TestSmallestPositiveIntPerTenant(t *testing.T) {
 	tenantLimits := map[string]*Limits{
 		"tenant-a": {
@@ -536,3 +620,34 @@ func TestCustomTrackerConfigDeserialize(t *testing.T) {
 		})
 	}
 }
+
+func TestLimits_Validate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		limits      Limits
+		expectedErr bool
+	}{
+		"query cost not limited": {
+			limits: Limits{},
+		},
+		"query cost limited with the cardinality analysis enabled": {
+			limits: Limits{MaxEstimatedQueryCost: 100, LowPriorityEstimatedQueryCost: 10, CardinalityAnalysisEnabled: true},
+		},
+		"query cost limited with the cardinality analysis disabled": {
+			limits:      Limits{MaxEstimatedQueryCost: 100},
+			expectedErr: true,
+		},
+		"low priority query cost with the cardinality analysis disabled": {
+			limits:      Limits{LowPriorityEstimatedQueryCost: 10},
+			expectedErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.limits.Validate()
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@
 package validation
 
 import (
+	"fmt"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -27,19 +28,25 @@ const (
 	// The combined length of the label names and values of an Exemplar's LabelSet MUST NOT exceed 128 UTF-8 characters
 	// https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
 	ExemplarMaxLabelSetLength = 128
+
+	// Native histograms schemas supported by Prometheus.
+	minNativeHistogramSchema = -4
+	maxNativeHistogramSchema = 8
 )
 
 var (
 	// Discarded series / samples reasons.
-	reasonMissingMetricName      = metricReasonFromErrorID(globalerror.MissingMetricName)
-	reasonInvalidMetricName      = metricReasonFromErrorID(globalerror.InvalidMetricName)
-	reasonMaxLabelNamesPerSeries = metricReasonFromErrorID(globalerror.MaxLabelNamesPerSeries)
-	reasonInvalidLabel           = metricReasonFromErrorID(globalerror.SeriesInvalidLabel)
-	reasonLabelNameTooLong       = metricReasonFromErrorID(globalerror.SeriesLabelNameTooLong)
-	reasonLabelValueTooLong      = metricReasonFromErrorID(globalerror.SeriesLabelValueTooLong)
-	reasonDuplicateLabelNames    = metricReasonFromErrorID(globalerror.SeriesWithDuplicateLabelNames)
-	reasonLabelsNotSorted        = metricReasonFromErrorID(globalerror.SeriesLabelsNotSorted)
-	reasonTooFarInFuture         = metricReasonFromErrorID(globalerror.SampleTooFarInFuture)
+	reasonMissingMetricName         = metricReasonFromErrorID(globalerror.MissingMetricName)
+	reasonInvalidMetricName         = metricReasonFromErrorID(globalerror.InvalidMetricName)
+	reasonMaxLabelNamesPerSeries    = metricReasonFromErrorID(globalerror.MaxLabelNamesPerSeries)
+	reasonInvalidLabel              = metricReasonFromErrorID(globalerror.SeriesInvalidLabel)
+	reasonLabelNameTooLong          = metricReasonFromErrorID(globalerror.SeriesLabelNameTooLong)
+	reasonLabelValueTooLong         = metricReasonFromErrorID(globalerror.SeriesLabelValueTooLong)
+	reasonDuplicateLabelNames       = metricReasonFromErrorID(globalerror.SeriesWithDuplicateLabelNames)
+	reasonLabelsNotSorted           = metricReasonFromErrorID(globalerror.SeriesLabelsNotSorted)
+	reasonTooFarInFuture            = metricReasonFromErrorID(globalerror.SampleTooFarInFuture)
+	reasonInvalidNativeHistogram    = metricReasonFromErrorID(globalerror.InvalidNativeHistogram)
+	reasonMaxNativeHistogramBuckets = metricReasonFromErrorID(globalerror.MaxNativeHistogramBuckets)
 
 	// Discarded exemplars reasons.
 	reasonExemplarLabelsMissing    = metricReasonFromErrorID(globalerror.ExemplarLabelsMissing)
@@ -59,6 +66,18 @@ var (
 
 	// ReasonTooManyHAClusters is one of the reasons for discarding samples.
 	ReasonTooManyHAClusters = "too_many_ha_clusters"
+
+	// ReasonNativeHistogramsDisabled is one of the reasons for discarding samples.
+	ReasonNativeHistogramsDisabled = "native_histograms_disabled"
+
+	// Reasons for discarding samples received in the Influx line protocol and Graphite plaintext formats.
+	ReasonInfluxInvalidLine          = "influx_invalid_line"
+	ReasonInfluxUnsupportedFieldType = "influx_unsupported_field_type"
+	ReasonGraphiteInvalidLine        = "graphite_invalid_line"
+
+	// Reasons for discarding OTLP data points which can't be translated to Prometheus samples.
+	ReasonOTLPDeltaTemporality     = "otlp_delta_temporality"
+	ReasonOTLPExponentialHistogram = "otlp_exponential_histogram"
 )
 
 func metricReasonFromErrorID(id globalerror.ID) string {
@@ -126,6 +145,65 @@ func ValidateSample(now model.Time, cfg SampleValidationConfig, userID string, l
 	return nil
 }
 
+// HistogramValidationConfig helps with getting required config to validate native histograms.
+type HistogramValidationConfig interface {
+	MaxNativeHistogramBuckets(userID string) int
+}
+
+// ValidateHistogram returns an err if the native histogram is invalid.
+// The returned error may retain the provided series labels.
+func ValidateHistogram(cfg HistogramValidationConfig, userID string, ls []mimirpb.LabelAdapter, h mimirpb.Histogram) ValidationError {
+	unsafeMetricName, _ := extract.UnsafeMetricNameFromLabelAdapters(ls)
+
+	if cause := histogramInvalidCause(h); cause != "" {
+		DiscardedSamples.WithLabelValues(reasonInvalidNativeHistogram, userID).Inc()
+		return newInvalidNativeHistogramError(unsafeMetricName, h.Timestamp, cause)
+	}
+
+	maxBuckets := cfg.MaxNativeHistogramBuckets(userID)
+	if buckets := spansLength(h.NegativeSpans) + spansLength(h.PositiveSpans); maxBuckets > 0 && buckets > maxBuckets {
+		DiscardedSamples.WithLabelValues(reasonMaxNativeHistogramBuckets, userID).Inc()
+		return newTooManyNativeHistogramBucketsError(unsafeMetricName, h.Timestamp, buckets, maxBuckets)
+	}
+
+	return nil
+}
+
+func histogramInvalidCause(h mimirpb.Histogram) string {
+	if h.Schema < minNativeHistogramSchema || h.Schema > maxNativeHistogramSchema {
+		return fmt.Sprintf("schema %d is out of range [%d, %d]", h.Schema, minNativeHistogramSchema, maxNativeHistogramSchema)
+	}
+	if h.ZeroThreshold < 0 {
+		return "zero threshold is negative"
+	}
+
+	isFloat := h.IsFloatHistogram()
+	if _, zeroFloat := h.GetZeroCount().(*mimirpb.Histogram_ZeroCountFloat); h.GetZeroCount() != nil && zeroFloat != isFloat {
+		return "count and zero count types mismatch"
+	}
+
+	negativeBuckets, positiveBuckets := len(h.NegativeDeltas), len(h.PositiveDeltas)
+	if isFloat {
+		negativeBuckets, positiveBuckets = len(h.NegativeCounts), len(h.PositiveCounts)
+	}
+	if n := spansLength(h.NegativeSpans); n != negativeBuckets {
+		return fmt.Sprintf("negative spans cover %d buckets but %d buckets are provided", n, negativeBuckets)
+	}
+	if n := spansLength(h.PositiveSpans); n != positiveBuckets {
+		return fmt.Sprintf("positive spans cover %d buckets but %d buckets are provided", n, positiveBuckets)
+	}
+
+	return ""
+}
+
+func spansLength(spans []mimirpb.BucketSpan) int {
+	n := 0
+	for _, s := range spans {
+		n += int(s.Length)
+	}
+	return n
+}
+
 // ValidateExemplar returns an error if the exemplar is invalid.
 // The returned error may retain the provided series labels.
 func ValidateExemplar(userID string, ls []mimirpb.LabelAdapter, e mimirpb.Exemplar) ValidationError {
@@ -197,21 +275,36 @@ type LabelValidationConfig interface {
 // ValidateLabels returns an err if the labels are invalid.
 // The returned error may retain the provided series labels.
 func ValidateLabels(cfg LabelValidationConfig, userID string, ls []mimirpb.LabelAdapter, skipLabelNameValidation bool) ValidationError {
+	reason, err := validateLabels(cfg, userID, ls, skipLabelNameValidation)
+	if err != nil {
+		DiscardedSamples.WithLabelValues(reason, userID).Inc()
+	}
+	return err
+}
+
+// ValidateSeriesLabels returns an err if the labels are invalid, like ValidateLabels does, without
+// tracking the series as discarded. It's used to validate the series which are not ingested, like
+// the series of the uploaded blocks.
+// The returned error may retain the provided series labels.
+func ValidateSeriesLabels(cfg LabelValidationConfig, userID string, ls []mimirpb.LabelAdapter) ValidationError {
+	_, err := validateLabels(cfg, userID, ls, false)
+	return err
+}
+
+// validateLabels returns an err, and the reason of the discarded samples, if the labels are invalid.
+func validateLabels(cfg LabelValidationConfig, userID string, ls []mimirpb.LabelAdapter, skipLabelNameValidation bool) (string, ValidationError) {
 	unsafeMetricName, err := extract.UnsafeMetricNameFromLabelAdapters(ls)
 	if err != nil {
-		DiscardedSamples.WithLabelValues(reasonMissingMetricName, userID).Inc()
-		return newNoMetricNameError()
+		return reasonMissingMetricName, newNoMetricNameError()
 	}
 
 	if !model.IsValidMetricName(model.LabelValue(unsafeMetricName)) {
-		DiscardedSamples.WithLabelValues(reasonInvalidMetricName, userID).Inc()
-		return newInvalidMetricNameError(unsafeMetricName)
+		return reasonInvalidMetricName, newInvalidMetricNameError(unsafeMetricName)
 	}
 
 	numLabelNames := len(ls)
 	if numLabelNames > cfg.MaxLabelNamesPerSeries(userID) {
-		DiscardedSamples.WithLabelValues(reasonMaxLabelNamesPerSeries, userID).Inc()
-		return newTooManyLabelsError(ls, cfg.MaxLabelNamesPerSeries(userID))
+		return reasonMaxLabelNamesPerSeries, newTooManyLabelsError(ls, cfg.MaxLabelNamesPerSeries(userID))
 	}
 
 	maxLabelNameLength := cfg.MaxLabelNameLength(userID)
@@ -219,25 +312,20 @@ func ValidateLabels(cfg LabelValidationConfig, userID string, ls []mimirpb.Label
 	lastLabelName := ""
 	for _, l := range ls {
 		if !skipLabelNameValidation && !model.LabelName(l.Name).IsValid() {
-			DiscardedSamples.WithLabelValues(reasonInvalidLabel, userID).Inc()
-			return newInvalidLabelError(ls, l.Name)
+			return reasonInvalidLabel, newInvalidLabelError(ls, l.Name)
 		} else if len(l.Name) > maxLabelNameLength {
-			DiscardedSamples.WithLabelValues(reasonLabelNameTooLong, userID).Inc()
-			return newLabelNameTooLongError(ls, l.Name)
+			return reasonLabelNameTooLong, newLabelNameTooLongError(ls, l.Name)
 		} else if len(l.Value) > maxLabelValueLength {
-			DiscardedSamples.WithLabelValues(reasonLabelValueTooLong, userID).Inc()
-			return newLabelValueTooLongError(ls, l.Value)
+			return reasonLabelValueTooLong, newLabelValueTooLongError(ls, l.Value)
 		} else if lastLabelName == l.Name {
-			DiscardedSamples.WithLabelValues(reasonDuplicateLabelNames, userID).Inc()
-			return newDuplicatedLabelError(ls, l.Name)
+			return reasonDuplicateLabelNames, newDuplicatedLabelError(ls, l.Name)
 		} else if lastLabelName > l.Name {
-			DiscardedSamples.WithLabelValues(reasonLabelsNotSorted, userID).Inc()
-			return newLabelsNotSortedError(ls, l.Name)
+			return reasonLabelsNotSorted, newLabelsNotSortedError(ls, l.Name)
 		}
 
 		lastLabelName = l.Name
 	}
-	return nil
+	return "", nil
 }
 
 // MetadataValidationConfig helps with getting required config to validate metadata.
@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/globalerror"
 	util_log "github.com/grafana/mimir/pkg/util/log"
 )
 
@@ -50,6 +51,14 @@ func (vm validateMetadataCfg) MaxMetadataLength(userID string) int {
 	return vm.maxMetadataLength
 }
 
+type validateHistogramCfg struct {
+	maxNativeHistogramBuckets int
+}
+
+func (vh validateHistogramCfg) MaxNativeHistogramBuckets(userID string) int {
+	return vh.maxNativeHistogramBuckets
+}
+
 func TestValidateLabels(t *testing.T) {
 	var cfg validateLabelsCfg
 	userID := "testUser"
@@ -145,6 +154,25 @@ func TestValidateLabels(t *testing.T) {
 	`), "cortex_discarded_samples_total"))
 }
 
+func TestValidateSeriesLabels(t *testing.T) {
+	var cfg validateLabelsCfg
+	userID := "testUser"
+
+	cfg.maxLabelValueLength = 25
+	cfg.maxLabelNameLength = 25
+	cfg.maxLabelNamesPerSeries = 2
+
+	valid := mimirpb.FromMetricsToLabelAdapters(map[model.LabelName]model.LabelValue{model.MetricNameLabel: "valid"})
+	assert.NoError(t, ValidateSeriesLabels(cfg, userID, valid))
+
+	tooManyLabels := mimirpb.FromMetricsToLabelAdapters(map[model.LabelName]model.LabelValue{model.MetricNameLabel: "foo", "bar": "baz", "blip": "blop"})
+	assert.Equal(t, newTooManyLabelsError(tooManyLabels, 2), ValidateSeriesLabels(cfg, userID, tooManyLabels))
+
+	// The invalid series are not tracked as discarded samples.
+	assert.Equal(t, float64(0), testutil.ToFloat64(DiscardedSamples.WithLabelValues(reasonMaxLabelNamesPerSeries, userID)))
+	DeletePerUserValidationMetrics(userID, util_log.Logger)
+}
+
 func TestValidateExemplars(t *testing.T) {
 	userID := "testUser"
 
@@ -217,6 +245,78 @@ func TestValidateExemplars(t *testing.T) {
 	`), "cortex_discarded_exemplars_total"))
 }
 
+func TestValidateHistogram(t *testing.T) {
+	userID := "histogramsUser"
+	series := []mimirpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "foo"}}
+	cfg := validateHistogramCfg{maxNativeHistogramBuckets: 2}
+
+	valid := map[string]mimirpb.Histogram{
+		"integer histogram": {
+			Count:          &mimirpb.Histogram_CountInt{CountInt: 3},
+			Schema:         2,
+			ZeroCount:      &mimirpb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+			PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}, {Offset: 2, Length: 1}},
+			PositiveDeltas: []int64{1, 0},
+		},
+		"float histogram": {
+			Count:          &mimirpb.Histogram_CountFloat{CountFloat: 1.5},
+			Schema:         -4,
+			NegativeSpans:  []mimirpb.BucketSpan{{Offset: -1, Length: 1}},
+			NegativeCounts: []float64{1.5},
+		},
+	}
+	for name, h := range valid {
+		assert.NoError(t, ValidateHistogram(cfg, userID, series, h), name)
+	}
+
+	invalid := map[string]mimirpb.Histogram{
+		"schema out of range": {
+			Count:  &mimirpb.Histogram_CountInt{CountInt: 1},
+			Schema: 9,
+		},
+		"negative zero threshold": {
+			Count:         &mimirpb.Histogram_CountInt{CountInt: 1},
+			ZeroThreshold: -1,
+		},
+		"mixed integer and float counts": {
+			Count:     &mimirpb.Histogram_CountInt{CountInt: 1},
+			ZeroCount: &mimirpb.Histogram_ZeroCountFloat{ZeroCountFloat: 1},
+		},
+		"spans don't match positive buckets": {
+			Count:          &mimirpb.Histogram_CountInt{CountInt: 1},
+			PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 2}},
+			PositiveDeltas: []int64{1},
+		},
+		"spans don't match negative buckets": {
+			Count:          &mimirpb.Histogram_CountFloat{CountFloat: 1},
+			NegativeSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}},
+			NegativeDeltas: []int64{1},
+		},
+	}
+	for name, h := range invalid {
+		err := ValidateHistogram(cfg, userID, series, h)
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), globalerror.InvalidNativeHistogram.Message(""), name)
+	}
+
+	assert.Equal(t, float64(len(invalid)), testutil.ToFloat64(DiscardedSamples.WithLabelValues(reasonInvalidNativeHistogram, userID)))
+
+	tooManyBuckets := mimirpb.Histogram{
+		Count:          &mimirpb.Histogram_CountInt{CountInt: 3},
+		NegativeSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}},
+		NegativeDeltas: []int64{1},
+		PositiveSpans:  []mimirpb.BucketSpan{{Offset: 0, Length: 1}, {Offset: 100, Length: 1}},
+		PositiveDeltas: []int64{1, 0},
+	}
+	err := ValidateHistogram(cfg, userID, series, tooManyBuckets)
+	require.Error(t, err)
+	assert.Equal(t, newTooManyNativeHistogramBucketsError("foo", 0, 3, 2), err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(DiscardedSamples.WithLabelValues(reasonMaxNativeHistogramBuckets, userID)))
+
+	// The limit is disabled when set to 0.
+	assert.NoError(t, ValidateHistogram(validateHistogramCfg{}, userID, series, tooManyBuckets))
+}
+
 func TestValidateMetadata(t *testing.T) {
 	userID := "testUser"
 	var cfg validateMetadataCfg
@@ -550,6 +550,18 @@ func getCustomFieldEntry(field reflect.StructField, fieldValue reflect.Value, fl
 		if err != nil {
 			return nil, err
 		}
+		if fieldFlag == nil {
+			// The field can only be configured via YAML, like the fields of the list elements.
+			return &ConfigEntry{
+				Kind:          KindField,
+				Name:          getFieldName(field),
+				Required:      isFieldRequired(field),
+				FieldDesc:     getFieldDescription(field, ""),
+				FieldType:     "duration",
+				FieldDefault:  "0s",
+				FieldCategory: getFieldCategory(field, ""),
+			}, nil
+		}
 
 		return &ConfigEntry{
 			Kind:          KindField,